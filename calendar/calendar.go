@@ -0,0 +1,279 @@
+package calendar
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+type Impact int
+
+const (
+	ImpactLow Impact = iota
+	ImpactMedium
+	ImpactHigh
+)
+
+// ParseImpact converts a textual impact (low, medium, high) to Impact
+func ParseImpact(impact string) (Impact, error) {
+	switch strings.ToLower(strings.TrimSpace(impact)) {
+	case "low":
+		return ImpactLow, nil
+	case "medium":
+		return ImpactMedium, nil
+	case "high":
+		return ImpactHigh, nil
+	}
+	return ImpactLow, fmt.Errorf("invalid impact: %s", impact)
+}
+
+// Event is a scheduled event with expected market impact, eg: CPI release, FOMC meeting or a token unlock
+type Event struct {
+	ID       string
+	Name     string
+	Category string
+	Impact   Impact
+	Time     time.Time
+	// Assets affected by the event, eg: BTC, ETH. Empty means all assets (macro events)
+	Assets []string
+}
+
+// Affects returns true if the event impacts a given pair
+func (e Event) Affects(pair string) bool {
+	if len(e.Assets) == 0 {
+		return true
+	}
+
+	for _, asset := range e.Assets {
+		if strings.HasPrefix(strings.ToUpper(pair), strings.ToUpper(asset)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Source provides the events of a given period
+type Source interface {
+	Events(ctx context.Context, start, end time.Time) ([]Event, error)
+}
+
+// SourceFunc is an adapter to use ordinary functions as Source
+type SourceFunc func(ctx context.Context, start, end time.Time) ([]Event, error)
+
+func (f SourceFunc) Events(ctx context.Context, start, end time.Time) ([]Event, error) {
+	return f(ctx, start, end)
+}
+
+// StaticSource is a fixed list of events, useful for backtests and manual schedules
+type StaticSource []Event
+
+func (s StaticSource) Events(_ context.Context, start, end time.Time) ([]Event, error) {
+	events := make([]Event, 0)
+	for _, event := range s {
+		if !event.Time.Before(start) && !event.Time.After(end) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// FromCSV loads events from a CSV file with the columns: time (RFC3339), name, category, impact and assets.
+// Assets are separated by `|`, eg: BTC|ETH
+func FromCSV(path string) (StaticSource, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(StaticSource, 0, len(records))
+	for i, record := range records {
+		if len(record) < 4 {
+			return nil, fmt.Errorf("calendar: invalid record at line %d", i+1)
+		}
+
+		eventTime, err := time.Parse(time.RFC3339, record[0])
+		if err != nil {
+			// skip header
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("calendar: line %d: %w", i+1, err)
+		}
+
+		impact, err := ParseImpact(record[3])
+		if err != nil {
+			return nil, fmt.Errorf("calendar: line %d: %w", i+1, err)
+		}
+
+		event := Event{
+			ID:       fmt.Sprintf("%s-%d", record[1], eventTime.Unix()),
+			Name:     record[1],
+			Category: record[2],
+			Impact:   impact,
+			Time:     eventTime,
+		}
+
+		if len(record) > 4 && record[4] != "" {
+			event.Assets = strings.Split(record[4], "|")
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// Calendar aggregates event sources and defines the blackout window around each event,
+// when strategies should stand down or flatten positions.
+type Calendar struct {
+	mtx       sync.Mutex
+	sources   []Source
+	before    time.Duration
+	after     time.Duration
+	minImpact Impact
+	horizon   time.Duration
+	timeout   time.Duration
+
+	events     []Event
+	loadedFrom time.Time
+	loadedTo   time.Time
+}
+
+type Option func(*Calendar)
+
+// WithBlackout sets the window before and after an event where trading is not recommended, default: 30m / 30m
+func WithBlackout(before, after time.Duration) Option {
+	return func(calendar *Calendar) {
+		calendar.before = before
+		calendar.after = after
+	}
+}
+
+// WithMinImpact ignores events with impact lower than the given value in blackouts, default: ImpactHigh
+func WithMinImpact(impact Impact) Option {
+	return func(calendar *Calendar) {
+		calendar.minImpact = impact
+	}
+}
+
+// WithHorizon sets the period of events requested to sources in each load, default: 7 days
+func WithHorizon(horizon time.Duration) Option {
+	return func(calendar *Calendar) {
+		calendar.horizon = horizon
+	}
+}
+
+// WithTimeout sets the maximum duration of a source request, default: 10s
+func WithTimeout(timeout time.Duration) Option {
+	return func(calendar *Calendar) {
+		calendar.timeout = timeout
+	}
+}
+
+// New creates a calendar from a list of event sources
+func New(sources []Source, options ...Option) *Calendar {
+	calendar := &Calendar{
+		sources:   sources,
+		before:    30 * time.Minute,
+		after:     30 * time.Minute,
+		minImpact: ImpactHigh,
+		horizon:   7 * 24 * time.Hour,
+		timeout:   10 * time.Second,
+	}
+
+	for _, option := range options {
+		option(calendar)
+	}
+
+	return calendar
+}
+
+// Load fetches the events of a given period from all sources, replacing the cached events.
+// Errors in a source are logged, and the remaining sources are still loaded.
+func (c *Calendar) Load(ctx context.Context, start, end time.Time) {
+	events := make([]Event, 0)
+	for _, source := range c.sources {
+		sourceCtx, cancel := context.WithTimeout(ctx, c.timeout)
+		sourceEvents, err := source.Events(sourceCtx, start, end)
+		cancel()
+		if err != nil {
+			log.Warnf("calendar: fail to load events: %v", err)
+			continue
+		}
+		events = append(events, sourceEvents...)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Time.Before(events[j].Time)
+	})
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.events = events
+	c.loadedFrom = start
+	c.loadedTo = end
+}
+
+// ensure loads the events around a given time when it is out of the cached period.
+// Times are given by candles, so the same behavior is kept in backtests and live trading.
+func (c *Calendar) ensure(t time.Time) {
+	c.mtx.Lock()
+	loaded := !c.loadedTo.IsZero() && !t.Add(-c.after).Before(c.loadedFrom) && !t.Add(c.before).After(c.loadedTo)
+	c.mtx.Unlock()
+
+	if !loaded {
+		c.Load(context.Background(), t.Add(-c.after), t.Add(c.horizon))
+	}
+}
+
+// Events returns the cached events between start and end
+func (c *Calendar) Events(start, end time.Time) []Event {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	events := make([]Event, 0)
+	for _, event := range c.events {
+		if !event.Time.Before(start) && !event.Time.After(end) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Upcoming returns the events that affect a pair in the next period
+func (c *Calendar) Upcoming(pair string, t time.Time, period time.Duration) []Event {
+	c.ensure(t)
+
+	events := make([]Event, 0)
+	for _, event := range c.Events(t, t.Add(period)) {
+		if event.Affects(pair) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// Blackout returns the event whose blackout window contains the given time, if any
+func (c *Calendar) Blackout(pair string, t time.Time) (Event, bool) {
+	c.ensure(t)
+
+	for _, event := range c.Events(t.Add(-c.after), t.Add(c.before)) {
+		if event.Impact >= c.minImpact && event.Affects(pair) {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
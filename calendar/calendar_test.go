@@ -0,0 +1,69 @@
+package calendar
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendar(t *testing.T) {
+	fomc := time.Date(2022, 6, 15, 18, 0, 0, 0, time.UTC)
+	source := StaticSource{
+		{ID: "fomc", Name: "FOMC", Category: "macro", Impact: ImpactHigh, Time: fomc},
+		{ID: "unlock", Name: "APT unlock", Category: "unlock", Impact: ImpactHigh, Time: fomc.Add(24 * time.Hour),
+			Assets: []string{"APT"}},
+		{ID: "pmi", Name: "PMI", Category: "macro", Impact: ImpactLow, Time: fomc.Add(48 * time.Hour)},
+	}
+
+	cal := New([]Source{source}, WithBlackout(time.Hour, 30*time.Minute))
+
+	t.Run("blackout", func(t *testing.T) {
+		event, ok := cal.Blackout("BTCUSDT", fomc.Add(-30*time.Minute))
+		require.True(t, ok)
+		require.Equal(t, "fomc", event.ID)
+
+		_, ok = cal.Blackout("BTCUSDT", fomc.Add(time.Hour))
+		require.False(t, ok)
+
+		_, ok = cal.Blackout("BTCUSDT", fomc.Add(24*time.Hour))
+		require.False(t, ok)
+
+		_, ok = cal.Blackout("APTUSDT", fomc.Add(24*time.Hour))
+		require.True(t, ok)
+
+		// low impact events are ignored by default
+		_, ok = cal.Blackout("BTCUSDT", fomc.Add(48*time.Hour))
+		require.False(t, ok)
+	})
+
+	t.Run("upcoming", func(t *testing.T) {
+		events := cal.Upcoming("BTCUSDT", fomc.Add(-time.Hour), 72*time.Hour)
+		require.Len(t, events, 2)
+		require.Equal(t, "fomc", events[0].ID)
+		require.Equal(t, "pmi", events[1].ID)
+	})
+}
+
+func TestFromCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.csv")
+	content := "time,name,category,impact,assets\n" +
+		"2022-06-10T12:30:00Z,CPI,macro,high,\n" +
+		"2022-06-12T00:00:00Z,Unlock,unlock,medium,APT|OP\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	source, err := FromCSV(path)
+	require.NoError(t, err)
+	require.Len(t, source, 2)
+	require.Equal(t, "CPI", source[0].Name)
+	require.Equal(t, ImpactHigh, source[0].Impact)
+	require.Equal(t, []string{"APT", "OP"}, source[1].Assets)
+
+	events, err := source.Events(context.Background(), time.Date(2022, 6, 11, 0, 0, 0, 0, time.UTC),
+		time.Date(2022, 6, 13, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+}
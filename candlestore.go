@@ -0,0 +1,127 @@
+package ninjabot
+
+import (
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// WithCandleStore persists the complete candles of live feeds in a store, eg: storage.CandlesFromSQL.
+// After a restart, strategies are warmed up from the stored candles, and the candles are fetched from
+// the exchange only when the store does not have the recent warmup period.
+func WithCandleStore(store storage.CandleStore) Option {
+	return func(bot *NinjaBot) {
+		bot.candleStore = store
+	}
+}
+
+// WithIndicatorPersistence persists the indicators computed by the strategies for each complete candle,
+// the values of the dataframe metadata. It requires a candle store that is a storage.IndicatorStore.
+func WithIndicatorPersistence() Option {
+	return func(bot *NinjaBot) {
+		bot.storeIndicators = true
+	}
+}
+
+// storedCandles returns the last candles of the warmup period from the candle store, when the store has
+// the recent candles without gaps
+func (n *NinjaBot) storedCandles(pair, timeframe string, warmup int) ([]model.Candle, bool) {
+	if n.candleStore == nil || warmup <= 0 {
+		return nil, false
+	}
+
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil, false
+	}
+
+	now := time.Now()
+	candles, err := n.candleStore.Candles(pair, timeframe, now.Add(-time.Duration(warmup+1)*interval), now)
+	if err != nil {
+		log.Errorf("candle store: %v", err)
+		return nil, false
+	}
+
+	if len(candles) < warmup {
+		return nil, false
+	}
+	candles = candles[len(candles)-warmup:]
+
+	// the last complete candle opened one interval before the current candle
+	if candles[len(candles)-1].Time.Before(now.Add(-2 * interval)) {
+		return nil, false
+	}
+	for i := 1; i < len(candles); i++ {
+		if candles[i].Time.Sub(candles[i-1].Time) != interval {
+			return nil, false
+		}
+	}
+
+	log.Infof("[SETUP] Warmup of %s %s with %d stored candles", pair, timeframe, len(candles))
+	return candles, true
+}
+
+// saveCandles stores the candles fetched for a warmup
+func (n *NinjaBot) saveCandles(pair, timeframe string, candles []model.Candle) {
+	if n.candleStore == nil || len(candles) == 0 {
+		return
+	}
+
+	interval, _ := str2duration.ParseDuration(timeframe)
+	period := candlePeriod(candles[0].Time, candles[len(candles)-1].Time, interval)
+	if err := n.candleStore.Save(pair, timeframe, period, candles); err != nil {
+		log.Errorf("candle store: %v", err)
+	}
+}
+
+// storeCandle stores a complete candle and, with indicator persistence, the indicators of the strategies
+// of its feed computed with the candle
+func (n *NinjaBot) storeCandle(candle model.Candle, timeframe string, interval time.Duration) {
+	period := candlePeriod(candle.Time, candle.Time, interval)
+	if err := n.candleStore.Save(candle.Pair, timeframe, period, []model.Candle{candle}); err != nil {
+		log.Errorf("candle store: %v", err)
+		return
+	}
+
+	indicatorStore, ok := n.candleStore.(storage.IndicatorStore)
+	if !n.storeIndicators || !ok {
+		return
+	}
+
+	values := make(map[string]float64)
+	for _, controller := range n.feedControllers[feedKey(candle.Pair, timeframe)] {
+		df, ok := controller.Dataframe()
+		if !ok || len(df.Time) == 0 || !df.Time[len(df.Time)-1].Equal(candle.Time) {
+			continue
+		}
+		for key, series := range df.Metadata {
+			if len(series) > 0 {
+				values[key] = series[len(series)-1]
+			}
+		}
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	err := indicatorStore.SaveIndicators(candle.Pair, timeframe, []storage.IndicatorValues{
+		{Time: candle.Time, Values: values},
+	})
+	if err != nil {
+		log.Errorf("indicator store: %v", err)
+	}
+}
+
+// candlePeriod returns the period covered by candles from the first to the last open time, so the periods
+// of consecutive candles are contiguous
+func candlePeriod(first, last time.Time, interval time.Duration) storage.CandleRange {
+	end := last
+	if interval > time.Millisecond {
+		end = last.Add(interval - time.Millisecond)
+	}
+	return storage.CandleRange{Start: first, End: end}
+}
@@ -0,0 +1,74 @@
+package ninjabot
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+	"github.com/bengalm/ninjabot/strategy"
+)
+
+func TestCandleStore(t *testing.T) {
+	store, err := storage.CandlesFromSQL(sqlite.Open(filepath.Join(t.TempDir(), "candles.db")), &gorm.Config{})
+	require.NoError(t, err)
+
+	// strategies of the feed compute the indicators persisted with the candles
+	controller := strategy.NewStrategyController("BTCUSDT", new(fakeStrategy), nil)
+	bot := &NinjaBot{
+		feedControllers: map[string][]*strategy.Controller{feedKey("BTCUSDT", "1h"): {controller}},
+	}
+	WithCandleStore(store)(bot)
+	WithIndicatorPersistence()(bot)
+
+	// the last complete candle opened one hour before the current candle
+	last := time.Now().Truncate(time.Hour).Add(-time.Hour)
+	candles := make([]model.Candle, 0)
+	for i := 19; i >= 0; i-- {
+		candles = append(candles, model.Candle{
+			Pair:     "BTCUSDT",
+			Time:     last.Add(-time.Duration(i) * time.Hour),
+			Close:    float64(100 - i),
+			Complete: true,
+		})
+	}
+
+	_, ok := bot.storedCandles("BTCUSDT", "1h", 10)
+	require.False(t, ok)
+
+	// the warmup fetched from the exchange is stored, and live candles are stored as they close
+	bot.saveCandles("BTCUSDT", "1h", candles[:15])
+	for i, candle := range candles {
+		controller.OnCandle(candle)
+		if i >= 15 {
+			bot.storeCandle(candle, "1h", time.Hour)
+		}
+	}
+
+	ranges, err := store.Ranges("BTCUSDT", "1h")
+	require.NoError(t, err)
+	require.Len(t, ranges, 1)
+
+	warmup, ok := bot.storedCandles("BTCUSDT", "1h", 10)
+	require.True(t, ok)
+	require.Len(t, warmup, 10)
+	require.True(t, warmup[9].Time.Equal(last))
+	require.Equal(t, 100.0, warmup[9].Close)
+
+	indicators, err := store.Indicators("BTCUSDT", "1h", candles[0].Time, last)
+	require.NoError(t, err)
+	require.Len(t, indicators, 5)
+	require.True(t, indicators[4].Time.Equal(last))
+	require.InDelta(t, 96, indicators[4].Values["ema9"], 0.001)
+
+	// stored candles with gaps or without the recent candles are fetched from the exchange
+	_, ok = bot.storedCandles("BTCUSDT", "1h", 25)
+	require.False(t, ok)
+	_, ok = bot.storedCandles("BTCUSDT", "4h", 5)
+	require.False(t, ok)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
@@ -67,27 +68,178 @@ func main() {
 						Value:    false,
 						Required: false,
 					},
+					&cli.BoolFlag{
+						Name:     "coin",
+						Usage:    "download from Binance COIN-M futures, eg. BTCUSD_PERP",
+						Value:    false,
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "mark",
+						Usage:    "download mark price candles of futures, instead of the last trade price",
+						Value:    false,
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "overwrite",
+						Usage:    "download all candles again, instead of resuming an existing output",
+						Value:    false,
+						Required: false,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					exc, err := newFeeder(c)
+					if err != nil {
+						return err
+					}
+
+					var options []download.Option
+					if days := c.Int("days"); days > 0 {
+						options = append(options, download.WithDays(days))
+					}
+
+					start := c.Timestamp("start")
+					end := c.Timestamp("end")
+					if start != nil && end != nil && !start.IsZero() && !end.IsZero() {
+						options = append(options, download.WithInterval(*start, *end))
+					} else if start != nil || end != nil {
+						log.Fatal("START and END must be informed together")
+					}
+
+					if c.Bool("overwrite") {
+						options = append(options, download.WithOverwrite())
+					}
+					if c.Bool("mark") {
+						options = append(options, download.WithMarkPrice())
+					}
+
+					return download.NewDownloader(exc).Download(c.Context, c.String("pair"),
+						c.String("timeframe"), c.String("output"), options...)
+
+				},
+			},
+			{
+				Name:     "batch",
+				HelpName: "batch",
+				Usage:    "Download historical data of many pairs and timeframes, one file by pair and timeframe",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "pairs",
+						Aliases:  []string{"p"},
+						Usage:    "eg. BTCUSDT,ETHUSDT",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "timeframes",
+						Aliases:  []string{"t"},
+						Usage:    "eg. 1h,1d",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "config",
+						Aliases:  []string{"c"},
+						Usage:    "JSON file with the pairs, timeframes and output, eg. ./batch.json",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "output directory, eg. ./data",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:     "concurrency",
+						Usage:    "number of files downloaded at the same time (default 4)",
+						Required: false,
+					},
+					&cli.Float64Flag{
+						Name:     "rate",
+						Usage:    "maximum requests per second to the exchange, eg. 5 (default unlimited)",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:     "days",
+						Aliases:  []string{"d"},
+						Usage:    "eg. 100 (default 30 days)",
+						Required: false,
+					},
+					&cli.TimestampFlag{
+						Name:     "start",
+						Aliases:  []string{"s"},
+						Usage:    "eg. 2021-12-01",
+						Layout:   "2006-01-02",
+						Required: false,
+					},
+					&cli.TimestampFlag{
+						Name:     "end",
+						Aliases:  []string{"e"},
+						Usage:    "eg. 2020-12-31",
+						Layout:   "2006-01-02",
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "futures",
+						Aliases:  []string{"f"},
+						Usage:    "true or false",
+						Value:    false,
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "coin",
+						Usage:    "download from Binance COIN-M futures, eg. BTCUSD_PERP",
+						Value:    false,
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "mark",
+						Usage:    "download mark price candles of futures, instead of the last trade price",
+						Value:    false,
+						Required: false,
+					},
+					&cli.BoolFlag{
+						Name:     "overwrite",
+						Usage:    "download all candles again, instead of resuming existing outputs",
+						Value:    false,
+						Required: false,
+					},
 				},
 				Action: func(c *cli.Context) error {
 					var (
-						exc service.Feeder
-						err error
+						batch download.Batch
+						err   error
 					)
-
-					if c.Bool("futures") {
-						// fetch data from binance futures
-						exc, err = exchange.NewBinanceFuture(c.Context)
-						if err != nil {
-							return err
-						}
-					} else {
-						// fetch data from binance spot
-						exc, err = exchange.NewBinance(c.Context)
+					if config := c.String("config"); config != "" {
+						batch, err = download.LoadBatch(config)
 						if err != nil {
 							return err
 						}
 					}
 
+					// flags override the config file
+					if pairs := c.StringSlice("pairs"); len(pairs) > 0 {
+						batch.Pairs = pairs
+					}
+					if timeframes := c.StringSlice("timeframes"); len(timeframes) > 0 {
+						batch.Timeframes = timeframes
+					}
+					if output := c.String("output"); output != "" {
+						batch.Output = output
+					}
+					if concurrency := c.Int("concurrency"); concurrency > 0 {
+						batch.Concurrency = concurrency
+					}
+					if rate := c.Float64("rate"); rate > 0 {
+						batch.RequestsPerSecond = rate
+					}
+					if len(batch.Pairs) == 0 || len(batch.Timeframes) == 0 {
+						return fmt.Errorf("PAIRS and TIMEFRAMES must be informed, by flags or config file")
+					}
+
+					exc, err := newFeeder(c)
+					if err != nil {
+						return err
+					}
+
 					var options []download.Option
 					if days := c.Int("days"); days > 0 {
 						options = append(options, download.WithDays(days))
@@ -101,9 +253,162 @@ func main() {
 						log.Fatal("START and END must be informed together")
 					}
 
-					return download.NewDownloader(exc).Download(c.Context, c.String("pair"),
-						c.String("timeframe"), c.String("output"), options...)
+					if c.Bool("overwrite") {
+						options = append(options, download.WithOverwrite())
+					}
+					if c.Bool("mark") {
+						options = append(options, download.WithMarkPrice())
+					}
+
+					return download.NewDownloader(exc).DownloadBatch(c.Context, batch, options...)
+				},
+			},
+			{
+				Name:     "import",
+				HelpName: "import",
+				Usage:    "Convert candles of other tools to the CSV format of ninjabot",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "input",
+						Aliases:  []string{"i"},
+						Usage:    "eg. ./BTCUSDT-1h-2022-01.zip",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "eg. ./btc.csv",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "format",
+						Aliases:  []string{"f"},
+						Usage:    "binance (Binance Vision dumps), freqtrade (JSON) or csv",
+						Value:    string(download.FormatCSV),
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "columns",
+						Aliases:  []string{"c"},
+						Usage:    "columns of csv files, eg. time=Date,open=Open,volume=5,layout=2006-01-02",
+						Required: false,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					mapping, err := download.ParseColumnMapping(c.String("columns"))
+					if err != nil {
+						return err
+					}
+
+					_, err = download.Import(c.String("input"), c.String("output"),
+						download.Format(c.String("format")), download.WithColumnMapping(mapping))
+					return err
+				},
+			},
+			{
+				Name:     "verify",
+				HelpName: "verify",
+				Usage:    "Verify the continuity of a file of candles",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Aliases:  []string{"f"},
+						Usage:    "eg. ./btc.csv",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "timeframe",
+						Aliases:  []string{"t"},
+						Usage:    "eg. 1h",
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					gaps, err := download.Verify(c.String("file"), c.String("timeframe"))
+					if err != nil {
+						return err
+					}
+
+					for _, gap := range gaps {
+						fmt.Printf("%d missing candles between %s and %s\n", gap.Missing, gap.After, gap.Before)
+					}
+					fmt.Printf("%d gaps\n", len(gaps))
+					return nil
+				},
+			},
+			{
+				Name:     "funding",
+				HelpName: "funding",
+				Usage:    "Download historical funding rates of Binance Futures, USDT-M or COIN-M",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "pair",
+						Aliases:  []string{"p"},
+						Usage:    "eg. BTCUSDT",
+						Required: true,
+					},
+					&cli.IntFlag{
+						Name:     "days",
+						Aliases:  []string{"d"},
+						Usage:    "eg. 100 (default 30 days)",
+						Required: false,
+					},
+					&cli.TimestampFlag{
+						Name:     "start",
+						Aliases:  []string{"s"},
+						Usage:    "eg. 2021-12-01",
+						Layout:   "2006-01-02",
+						Required: false,
+					},
+					&cli.TimestampFlag{
+						Name:     "end",
+						Aliases:  []string{"e"},
+						Usage:    "eg. 2020-12-31",
+						Layout:   "2006-01-02",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "eg. ./btc-funding.csv",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:     "coin",
+						Usage:    "download from Binance COIN-M futures, eg. BTCUSD_PERP",
+						Value:    false,
+						Required: false,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					var (
+						exc service.Feeder
+						err error
+					)
+					if c.Bool("coin") {
+						exc, err = exchange.NewBinanceDelivery(c.Context)
+					} else {
+						exc, err = exchange.NewBinanceFuture(c.Context)
+					}
+					if err != nil {
+						return err
+					}
+
+					var options []download.Option
+					if days := c.Int("days"); days > 0 {
+						options = append(options, download.WithDays(days))
+					}
+
+					start := c.Timestamp("start")
+					end := c.Timestamp("end")
+					if start != nil && end != nil && !start.IsZero() && !end.IsZero() {
+						options = append(options, download.WithInterval(*start, *end))
+					} else if start != nil || end != nil {
+						log.Fatal("START and END must be informed together")
+					}
 
+					return download.NewDownloader(exc).DownloadFunding(c.Context, c.String("pair"),
+						c.String("output"), options...)
 				},
 			},
 		},
@@ -114,3 +419,16 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// newFeeder returns the market of the download flags: Binance spot by default, USDT-M futures with --futures
+// or COIN-M futures with --coin
+func newFeeder(c *cli.Context) (service.Feeder, error) {
+	switch {
+	case c.Bool("coin"):
+		return exchange.NewBinanceDelivery(c.Context)
+	case c.Bool("futures"):
+		return exchange.NewBinanceFuture(c.Context)
+	default:
+		return exchange.NewBinance(c.Context)
+	}
+}
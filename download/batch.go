@@ -0,0 +1,125 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// Batch is a list of pairs and timeframes downloaded together, one file by pair and timeframe in the output
+// directory, eg: btcusdt-1h.csv
+type Batch struct {
+	Pairs      []string `json:"pairs"`
+	Timeframes []string `json:"timeframes"`
+	Output     string   `json:"output"`
+	// Concurrency is the number of files downloaded at the same time, default: 4
+	Concurrency int `json:"concurrency"`
+	// RequestsPerSecond limits the requests of all the downloads, default: unlimited
+	RequestsPerSecond float64 `json:"requests_per_second"`
+}
+
+// LoadBatch reads a batch from a JSON file, eg:
+//
+//	{"pairs": ["BTCUSDT", "ETHUSDT"], "timeframes": ["1h", "1d"], "output": "data", "requests_per_second": 5}
+func LoadBatch(path string) (Batch, error) {
+	var batch Batch
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return batch, err
+	}
+	if err := json.Unmarshal(content, &batch); err != nil {
+		return batch, fmt.Errorf("invalid batch %s: %w", path, err)
+	}
+	return batch, nil
+}
+
+// File returns the output file of a pair and timeframe
+func (b Batch) File(pair, timeframe string) string {
+	return filepath.Join(b.Output, fmt.Sprintf("%s-%s.csv", strings.ToLower(pair), timeframe))
+}
+
+// DownloadBatch downloads the candles of all the pairs and timeframes of a batch concurrently, resuming
+// existing files. A failed download does not stop the others, the first error is returned at the end.
+func (d Downloader) DownloadBatch(ctx context.Context, batch Batch, options ...Option) error {
+	concurrency := batch.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	if batch.Output != "" {
+		if err := os.MkdirAll(batch.Output, 0755); err != nil {
+			return err
+		}
+	}
+
+	var throttle <-chan time.Time
+	if batch.RequestsPerSecond > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / batch.RequestsPerSecond))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+	options = append(options, withThrottle(throttle))
+
+	type job struct {
+		pair      string
+		timeframe string
+	}
+	jobs := make(chan job)
+	go func() {
+		defer close(jobs)
+		for _, pair := range batch.Pairs {
+			for _, timeframe := range batch.Timeframes {
+				select {
+				case jobs <- job{pair: pair, timeframe: timeframe}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		mtx      sync.Mutex
+		firstErr error
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				err := d.Download(ctx, job.pair, job.timeframe, batch.File(job.pair, job.timeframe), options...)
+				if err == nil {
+					continue
+				}
+
+				log.Errorf("download %s %s: %v", job.pair, job.timeframe, err)
+				mtx.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("download %s %s: %w", job.pair, job.timeframe, err)
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// withThrottle waits for a tick before each request, shared by the downloads of a batch
+func withThrottle(throttle <-chan time.Time) Option {
+	return func(parameters *Parameters) {
+		parameters.throttle = throttle
+	}
+}
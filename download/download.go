@@ -3,12 +3,15 @@ package download
 import (
 	"context"
 	"encoding/csv"
+	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/schollz/progressbar/v3"
 	"github.com/xhit/go-str2duration/v2"
 
+	"github.com/bengalm/ninjabot/exchange"
 	"github.com/bengalm/ninjabot/service"
 	"github.com/bengalm/ninjabot/tools/log"
 )
@@ -28,6 +31,13 @@ func NewDownloader(exchange service.Feeder) Downloader {
 type Parameters struct {
 	Start time.Time
 	End   time.Time
+	// Overwrite downloads all the candles again, instead of resuming an existing file
+	Overwrite bool
+	// MarkPrice downloads the candles of the mark price of futures, instead of the last trade price
+	MarkPrice bool
+
+	// throttle limits the requests of the downloads of a batch
+	throttle <-chan time.Time
 }
 
 type Option func(*Parameters)
@@ -46,6 +56,21 @@ func WithDays(days int) Option {
 	}
 }
 
+// WithOverwrite replaces an existing output file, by default the download resumes after its last candle
+func WithOverwrite() Option {
+	return func(parameters *Parameters) {
+		parameters.Overwrite = true
+	}
+}
+
+// WithMarkPrice downloads the mark-price candles of a futures pair, the price of liquidations and funding,
+// eg: to simulate them in backtests. The exchange must be a service.MarkPriceHistoryFeeder.
+func WithMarkPrice() Option {
+	return func(parameters *Parameters) {
+		parameters.MarkPrice = true
+	}
+}
+
 func candlesCount(start, end time.Time, timeframe string) (int, time.Duration, error) {
 	totalDuration := end.Sub(start)
 	interval, err := str2duration.ParseDuration(timeframe)
@@ -55,12 +80,9 @@ func candlesCount(start, end time.Time, timeframe string) (int, time.Duration, e
 	return int(totalDuration / interval), interval, nil
 }
 
+// Download writes the candles of a pair to a CSV file. When the file exists, only the candles after the last
+// stored candle are appended, and the continuity of the file is verified at the end.
 func (d Downloader) Download(ctx context.Context, pair, timeframe string, output string, options ...Option) error {
-	recordFile, err := os.Create(output)
-	if err != nil {
-		return err
-	}
-
 	now := time.Now()
 	parameters := &Parameters{
 		Start: now.AddDate(0, -1, 0),
@@ -81,13 +103,56 @@ func (d Downloader) Download(ctx context.Context, pair, timeframe string, output
 		parameters.End = now
 	}
 
+	fetch := d.exchange.CandlesByPeriod
+	if parameters.MarkPrice {
+		feeder, ok := d.exchange.(service.MarkPriceHistoryFeeder)
+		if !ok {
+			return fmt.Errorf("%w: mark price candles", exchange.ErrUnsupportedFeed)
+		}
+		fetch = feeder.MarkPriceCandlesByPeriod
+	}
+
+	var stored *storedCandles
+	if !parameters.Overwrite {
+		var err error
+		stored, err = resume(output)
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		recordFile *os.File
+		err        error
+	)
+	if stored != nil {
+		if stored.first.After(parameters.Start) {
+			log.Warnf("%s starts at %s, earlier candles are downloaded with overwrite", output, stored.first)
+		}
+		if stored.last.After(parameters.Start) {
+			parameters.Start = stored.last
+		}
+		recordFile, err = os.OpenFile(output, os.O_WRONLY|os.O_APPEND, 0)
+	} else {
+		recordFile, err = os.Create(output)
+	}
+	if err != nil {
+		return err
+	}
+	defer recordFile.Close()
+
 	candlesCount, interval, err := candlesCount(parameters.Start, parameters.End, timeframe)
 	if err != nil {
 		return err
 	}
 	candlesCount++
 
-	log.Infof("Downloading %d candles of %s for %s", candlesCount, timeframe, pair)
+	if stored != nil {
+		log.Infof("Resuming %s from %s, downloading %d candles of %s for %s", output, parameters.Start,
+			candlesCount, timeframe, pair)
+	} else {
+		log.Infof("Downloading %d candles of %s for %s", candlesCount, timeframe, pair)
+	}
 	info := d.exchange.AssetsInfo(pair)
 	writer := csv.NewWriter(recordFile)
 
@@ -95,12 +160,14 @@ func (d Downloader) Download(ctx context.Context, pair, timeframe string, output
 	lostData := 0
 	isLastLoop := false
 
-	// write headers
-	err = writer.Write([]string{
-		"time", "open", "close", "low", "high", "volume",
-	})
-	if err != nil {
-		return err
+	// write headers of new files
+	if stored == nil {
+		err = writer.Write([]string{
+			"time", "open", "close", "low", "high", "volume",
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	for begin := parameters.Start; begin.Before(parameters.End); begin = begin.Add(interval * batchSize) {
@@ -112,7 +179,15 @@ func (d Downloader) Download(ctx context.Context, pair, timeframe string, output
 			isLastLoop = true
 		}
 
-		candles, err := d.exchange.CandlesByPeriod(ctx, pair, timeframe, begin, end)
+		if parameters.throttle != nil {
+			select {
+			case <-parameters.throttle:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		candles, err := fetch(ctx, pair, timeframe, begin, end)
 		if err != nil {
 			return err
 		}
@@ -143,6 +218,68 @@ func (d Downloader) Download(ctx context.Context, pair, timeframe string, output
 	}
 
 	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	gaps, err := Verify(output, timeframe)
+	if err != nil {
+		return err
+	}
+	for _, gap := range gaps {
+		log.Warnf("gap of %d candles between %s and %s", gap.Missing, gap.After, gap.Before)
+	}
+
 	log.Info("Done!")
+	return nil
+}
+
+// DownloadFunding writes the settled funding rates of a perpetual pair to a CSV file, with time and rate
+// columns, eg: to simulate the funding in backtests with exchange.WithPaperFunding
+func (d Downloader) DownloadFunding(ctx context.Context, pair, output string, options ...Option) error {
+	feeder, ok := d.exchange.(service.FundingHistoryFeeder)
+	if !ok {
+		return fmt.Errorf("%w: funding rates", exchange.ErrUnsupportedFeed)
+	}
+
+	now := time.Now()
+	parameters := &Parameters{
+		Start: now.AddDate(0, -1, 0),
+		End:   now,
+	}
+
+	for _, option := range options {
+		option(parameters)
+	}
+
+	log.Infof("Downloading funding rates of %s", pair)
+	rates, err := feeder.FundingRates(ctx, pair, parameters.Start, parameters.End)
+	if err != nil {
+		return err
+	}
+
+	recordFile, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer recordFile.Close()
+
+	writer := csv.NewWriter(recordFile)
+	if err := writer.Write([]string{"time", "rate"}); err != nil {
+		return err
+	}
+
+	for _, rate := range rates {
+		err := writer.Write([]string{
+			strconv.FormatInt(rate.Time.Unix(), 10),
+			strconv.FormatFloat(rate.Rate, 'f', -1, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	log.Infof("Done! %d funding rates", len(rates))
 	return writer.Error()
 }
@@ -3,10 +3,13 @@ package download
 import (
 	"context"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
 	"github.com/bengalm/ninjabot/service"
 
 	"github.com/stretchr/testify/assert"
@@ -98,3 +101,188 @@ func TestDownloader_download(t *testing.T) {
 		require.Len(t, csvFeed.CandlePairTimeFrame["BTCUSDT--1d"], 14)
 	})
 }
+
+type fundingFeeder struct {
+	service.Feeder
+	rates []model.FundingRate
+}
+
+func (f fundingFeeder) FundingRates(_ context.Context, _ string, start, end time.Time) ([]model.FundingRate, error) {
+	rates := make([]model.FundingRate, 0)
+	for _, rate := range f.rates {
+		if !rate.Time.Before(start) && !rate.Time.After(end) {
+			rates = append(rates, rate)
+		}
+	}
+	return rates, nil
+}
+
+func TestDownloader_DownloadFunding(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	feeder := fundingFeeder{rates: []model.FundingRate{
+		{Pair: "BTCUSDT", Time: start, Rate: 0.0001},
+		{Pair: "BTCUSDT", Time: start.Add(8 * time.Hour), Rate: -0.00025},
+		{Pair: "BTCUSDT", Time: start.Add(16 * time.Hour), Rate: 0.0003},
+	}}
+
+	output := filepath.Join(t.TempDir(), "funding.csv")
+	err := NewDownloader(feeder).DownloadFunding(context.Background(), "BTCUSDT", output,
+		WithInterval(start, start.Add(8*time.Hour)))
+	require.NoError(t, err)
+
+	rates, err := exchange.FundingRatesFromCSV("BTCUSDT", output)
+	require.NoError(t, err)
+	require.Equal(t, feeder.rates[:2], rates)
+
+	// exchanges without funding history are not supported
+	err = NewDownloader(feeder.Feeder).DownloadFunding(context.Background(), "BTCUSDT", output)
+	require.ErrorIs(t, err, exchange.ErrUnsupportedFeed)
+}
+
+type markPriceFeeder struct {
+	service.Feeder
+}
+
+func (f markPriceFeeder) MarkPriceCandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	candles, err := f.CandlesByPeriod(ctx, pair, period, start, end)
+	for i := range candles {
+		candles[i].Close = 42
+	}
+	return candles, err
+}
+
+func TestDownloader_MarkPrice(t *testing.T) {
+	start := time.Date(2021, 4, 26, 0, 0, 0, 0, time.UTC)
+	csvFeed, err := exchange.NewCSVFeed("1d", exchange.PairFeed{
+		Pair:      "BTCUSDT",
+		File:      "../testdata/btc-1d.csv",
+		Timeframe: "1d",
+	})
+	require.NoError(t, err)
+
+	output := filepath.Join(t.TempDir(), "btc-mark.csv")
+	feeder := markPriceFeeder{struct{ service.Feeder }{csvFeed}}
+	err = NewDownloader(feeder).Download(context.Background(), "BTCUSDT", "1d", output,
+		WithInterval(start, start.AddDate(0, 0, 5)), WithMarkPrice())
+	require.NoError(t, err)
+
+	markFeed, err := exchange.NewCSVFeed("1d", exchange.PairFeed{Pair: "BTCUSDT", File: output, Timeframe: "1d"})
+	require.NoError(t, err)
+	candles := markFeed.CandlePairTimeFrame["BTCUSDT--1d"]
+	require.Len(t, candles, 6)
+	for _, candle := range candles {
+		require.Equal(t, 42.0, candle.Close)
+	}
+
+	// exchanges without mark price history are not supported
+	err = NewDownloader(feeder.Feeder).Download(context.Background(), "BTCUSDT", "1d", output, WithMarkPrice())
+	require.ErrorIs(t, err, exchange.ErrUnsupportedFeed)
+}
+
+func TestDownloader_Resume(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2021, 4, 26, 0, 0, 0, 0, time.UTC)
+	csvFeed, err := exchange.NewCSVFeed(
+		"1d",
+		exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "../testdata/btc-1d.csv",
+			Timeframe: "1d",
+		})
+	require.NoError(t, err)
+
+	downloader := NewDownloader(struct{ service.Feeder }{csvFeed})
+	output := filepath.Join(t.TempDir(), "btc.csv")
+	read := func() []model.Candle {
+		feed, err := exchange.NewCSVFeed("1d", exchange.PairFeed{Pair: "BTCUSDT", File: output, Timeframe: "1d"})
+		require.NoError(t, err)
+		return feed.CandlePairTimeFrame["BTCUSDT--1d"]
+	}
+
+	err = downloader.Download(ctx, "BTCUSDT", "1d", output, WithInterval(start, start.AddDate(0, 0, 5)))
+	require.NoError(t, err)
+	first := read()
+	require.Len(t, first, 6)
+
+	// the second download appends the candles after the last one, which is downloaded again
+	err = downloader.Download(ctx, "BTCUSDT", "1d", output, WithInterval(start, start.AddDate(0, 0, 10)))
+	require.NoError(t, err)
+	resumed := read()
+	require.Len(t, resumed, 11)
+	require.Equal(t, first, resumed[:6])
+
+	gaps, err := Verify(output, "1d")
+	require.NoError(t, err)
+	require.Empty(t, gaps)
+
+	// overwrite downloads the period from scratch
+	err = downloader.Download(ctx, "BTCUSDT", "1d", output, WithInterval(start, start.AddDate(0, 0, 2)),
+		WithOverwrite())
+	require.NoError(t, err)
+	require.Len(t, read(), 3)
+}
+
+func TestVerify(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "candles.csv")
+	content := "time,open,close,low,high,volume\n" +
+		"1640995200,1,1,1,1,1\n" + // 2022-01-01 00:00
+		"1640998800,1,1,1,1,1\n" + // 01:00
+		"1641009600,1,1,1,1,1\n" // 04:00
+	require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	gaps, err := Verify(file, "1h")
+	require.NoError(t, err)
+	require.Equal(t, []Gap{{
+		After:   time.Date(2022, 1, 1, 1, 0, 0, 0, time.UTC),
+		Before:  time.Date(2022, 1, 1, 4, 0, 0, 0, time.UTC),
+		Missing: 2,
+	}}, gaps)
+
+	require.NoError(t, os.WriteFile(file, []byte(content+"1640998800,1,1,1,1,1\n"), 0600))
+	_, err = Verify(file, "1h")
+	require.ErrorIs(t, err, ErrUnordered)
+}
+
+func TestDownloader_DownloadBatch(t *testing.T) {
+	csvFeed, err := exchange.NewCSVFeed(
+		"1h",
+		exchange.PairFeed{Pair: "BTCUSDT", File: "../testdata/btc-1h.csv", Timeframe: "1h"},
+		exchange.PairFeed{Pair: "ETHUSDT", File: "../testdata/eth-1h.csv", Timeframe: "1h"},
+	)
+	require.NoError(t, err)
+
+	start := csvFeed.CandlePairTimeFrame["ETHUSDT--1h"][0].Time
+	batch := Batch{
+		Pairs:             []string{"BTCUSDT", "ETHUSDT"},
+		Timeframes:        []string{"1h"},
+		Output:            filepath.Join(t.TempDir(), "data"),
+		Concurrency:       3,
+		RequestsPerSecond: 100,
+	}
+
+	downloader := NewDownloader(struct{ service.Feeder }{csvFeed})
+	err = downloader.DownloadBatch(context.Background(), batch, WithInterval(start, start.AddDate(0, 0, 3)))
+	require.NoError(t, err)
+
+	for _, pair := range batch.Pairs {
+		file := filepath.Join(batch.Output, strings.ToLower(pair)+"-1h.csv")
+		require.FileExists(t, file)
+		feed, err := exchange.NewCSVFeed("1h", exchange.PairFeed{Pair: pair, File: file, Timeframe: "1h"})
+		require.NoError(t, err)
+		require.Len(t, feed.CandlePairTimeFrame[pair+"--1h"], 73)
+	}
+}
+
+func TestLoadBatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "batch.json")
+	require.NoError(t, os.WriteFile(file, []byte(`{"pairs": ["BTCUSDT"], "timeframes": ["1h", "4h"],
+		"output": "data", "concurrency": 2, "requests_per_second": 5}`), 0600))
+
+	batch, err := LoadBatch(file)
+	require.NoError(t, err)
+	require.Equal(t, Batch{Pairs: []string{"BTCUSDT"}, Timeframes: []string{"1h", "4h"}, Output: "data",
+		Concurrency: 2, RequestsPerSecond: 5}, batch)
+	require.Equal(t, filepath.Join("data", "btcusdt-4h.csv"), batch.File("BTCUSDT", "4h"))
+}
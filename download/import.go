@@ -0,0 +1,381 @@
+package download
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+var (
+	// ErrUnknownFormat is returned for an import format that is not supported
+	ErrUnknownFormat = errors.New("unknown import format")
+	// ErrInvalidMapping is returned for a column mapping without a candle field or with unknown columns
+	ErrInvalidMapping = errors.New("invalid column mapping")
+)
+
+// Format is the format of an external file of candles
+type Format string
+
+var (
+	// FormatBinanceVision is a kline dump of data.binance.vision, a CSV or the zip file with the CSV
+	FormatBinanceVision Format = "binance"
+	// FormatFreqtrade is a JSON file of Freqtrade, a list of [timestamp, open, high, low, close, volume]
+	FormatFreqtrade Format = "freqtrade"
+	// FormatCSV is a CSV file with the columns of a ColumnMapping
+	FormatCSV Format = "csv"
+)
+
+// ColumnMapping maps the candle fields to the columns of a generic CSV file, by header name or by index
+// from zero, eg: ColumnMapping{Time: "Date", Open: "1", ...}
+type ColumnMapping struct {
+	Time   string
+	Open   string
+	High   string
+	Low    string
+	Close  string
+	Volume string
+	// TimeLayout parses text times with a Go layout, eg: 2006-01-02 15:04:05. Numeric times are unix
+	// timestamps, in seconds, milliseconds or microseconds
+	TimeLayout string
+}
+
+// DefaultColumnMapping maps the fields to the columns with the same names, ignoring the case
+var DefaultColumnMapping = ColumnMapping{
+	Time:   "time",
+	Open:   "open",
+	High:   "high",
+	Low:    "low",
+	Close:  "close",
+	Volume: "volume",
+}
+
+// ParseColumnMapping parses a mapping of fields to columns, eg: time=Date,open=Open,volume=5,layout=2006-01-02.
+// Fields that are not informed keep the default mapping.
+func ParseColumnMapping(value string) (ColumnMapping, error) {
+	mapping := DefaultColumnMapping
+	if strings.TrimSpace(value) == "" {
+		return mapping, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		field, column, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(column) == "" {
+			return mapping, fmt.Errorf("%w: %s", ErrInvalidMapping, item)
+		}
+
+		column = strings.TrimSpace(column)
+		switch strings.ToLower(strings.TrimSpace(field)) {
+		case "time":
+			mapping.Time = column
+		case "open":
+			mapping.Open = column
+		case "high":
+			mapping.High = column
+		case "low":
+			mapping.Low = column
+		case "close":
+			mapping.Close = column
+		case "volume":
+			mapping.Volume = column
+		case "layout":
+			mapping.TimeLayout = column
+		default:
+			return mapping, fmt.Errorf("%w: unknown field %s", ErrInvalidMapping, field)
+		}
+	}
+	return mapping, nil
+}
+
+type importParameters struct {
+	mapping ColumnMapping
+}
+
+// ImportOption customizes an import
+type ImportOption func(*importParameters)
+
+// WithColumnMapping sets the columns of a generic CSV import, default: DefaultColumnMapping
+func WithColumnMapping(mapping ColumnMapping) ImportOption {
+	return func(parameters *importParameters) {
+		parameters.mapping = mapping
+	}
+}
+
+// Import converts the candles of an external file to a CSV file of ninjabot, sorted by time and without
+// duplicated candles, and returns the number of candles
+func Import(input, output string, format Format, options ...ImportOption) (int, error) {
+	parameters := &importParameters{mapping: DefaultColumnMapping}
+	for _, option := range options {
+		option(parameters)
+	}
+
+	var (
+		candles []model.Candle
+		err     error
+	)
+	switch format {
+	case FormatBinanceVision:
+		candles, err = readBinanceVision(input)
+	case FormatFreqtrade:
+		candles, err = readFreqtrade(input)
+	case FormatCSV:
+		candles, err = readMappedCSV(input, parameters.mapping)
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("import %s: %w", input, err)
+	}
+
+	sort.SliceStable(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+
+	unique := candles[:0]
+	for _, candle := range candles {
+		if len(unique) > 0 && unique[len(unique)-1].Time.Equal(candle.Time) {
+			unique[len(unique)-1] = candle
+			continue
+		}
+		unique = append(unique, candle)
+	}
+
+	if err := writeCandles(output, unique); err != nil {
+		return 0, err
+	}
+	log.Infof("Imported %d candles from %s to %s", len(unique), input, output)
+	return len(unique), nil
+}
+
+func writeCandles(output string, candles []model.Candle) (err error) {
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"time", "open", "close", "low", "high", "volume"}); err != nil {
+		return err
+	}
+	for _, candle := range candles {
+		if err := writer.Write(candle.ToSlice(-1)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// readBinanceVision reads the klines of a Binance Vision dump, with the open time and the prices in the
+// first columns, and an optional header
+func readBinanceVision(input string) ([]model.Candle, error) {
+	var reader io.Reader
+	if strings.EqualFold(filepath.Ext(input), ".zip") {
+		archive, err := zip.OpenReader(input)
+		if err != nil {
+			return nil, err
+		}
+		defer archive.Close()
+
+		if len(archive.File) == 0 {
+			return nil, fmt.Errorf("empty zip file")
+		}
+		file, err := archive.File[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	} else {
+		file, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	lines, err := readCSV(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := ColumnMapping{Time: "0", Open: "1", High: "2", Low: "3", Close: "4", Volume: "5"}
+	return mappedCandles(lines, mapping)
+}
+
+// readFreqtrade reads the candles of a Freqtrade JSON file, with times in milliseconds
+func readFreqtrade(input string) ([]model.Candle, error) {
+	content, err := os.ReadFile(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows [][]float64
+	if err := json.Unmarshal(content, &rows); err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0, len(rows))
+	for i, row := range rows {
+		if len(row) < 6 {
+			return nil, fmt.Errorf("row %d: %d columns, expected 6", i+1, len(row))
+		}
+		candles = append(candles, model.Candle{
+			Time:   unixTime(int64(row[0])),
+			Open:   row[1],
+			High:   row[2],
+			Low:    row[3],
+			Close:  row[4],
+			Volume: row[5],
+		})
+	}
+	return candles, nil
+}
+
+func readMappedCSV(input string, mapping ColumnMapping) ([]model.Candle, error) {
+	file, err := os.Open(input)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines, err := readCSV(file)
+	if err != nil {
+		return nil, err
+	}
+	return mappedCandles(lines, mapping)
+}
+
+func readCSV(reader io.Reader) ([][]string, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	return csvReader.ReadAll()
+}
+
+// mappedCandles converts CSV lines to candles. The first line is a header when its time column is not a
+// time, and is required for mappings by column name.
+func mappedCandles(lines [][]string, mapping ColumnMapping) ([]model.Candle, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	header := make(map[string]int)
+	hasHeader := false
+	if index, err := strconv.Atoi(mapping.Time); err == nil && index < len(lines[0]) {
+		_, err := parseCandleTime(lines[0][index], mapping.TimeLayout)
+		hasHeader = err != nil
+	} else {
+		hasHeader = true
+	}
+	if hasHeader {
+		for index, name := range lines[0] {
+			header[strings.ToLower(strings.TrimSpace(name))] = index
+		}
+		lines = lines[1:]
+	}
+
+	fields := []string{mapping.Time, mapping.Open, mapping.High, mapping.Low, mapping.Close, mapping.Volume}
+	columns := make([]int, len(fields))
+	for i, field := range fields {
+		if index, err := strconv.Atoi(field); err == nil && index >= 0 {
+			columns[i] = index
+			continue
+		}
+		index, ok := header[strings.ToLower(field)]
+		if !ok {
+			return nil, fmt.Errorf("%w: column %s not found", ErrInvalidMapping, field)
+		}
+		columns[i] = index
+	}
+
+	candles := make([]model.Candle, 0, len(lines))
+	for number, line := range lines {
+		if len(line) == 1 && strings.TrimSpace(line[0]) == "" {
+			continue
+		}
+
+		values := make([]float64, len(columns))
+		for i, column := range columns[1:] {
+			if column >= len(line) {
+				return nil, fmt.Errorf("line %d: missing column %d", number+1, column)
+			}
+			value, err := strconv.ParseFloat(strings.TrimSpace(line[column]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", number+1, err)
+			}
+			values[i+1] = value
+		}
+
+		if columns[0] >= len(line) {
+			return nil, fmt.Errorf("line %d: missing column %d", number+1, columns[0])
+		}
+		candleTime, err := parseCandleTime(line[columns[0]], mapping.TimeLayout)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number+1, err)
+		}
+
+		candles = append(candles, model.Candle{
+			Time:   candleTime,
+			Open:   values[1],
+			High:   values[2],
+			Low:    values[3],
+			Close:  values[4],
+			Volume: values[5],
+		})
+	}
+	return candles, nil
+}
+
+// timeLayouts are tried for text times without a layout
+var timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04",
+	"2006-01-02"}
+
+// parseCandleTime parses a unix timestamp, in seconds, milliseconds or microseconds, or a text time in UTC
+func parseCandleTime(value, layout string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if layout != "" {
+		return time.ParseInLocation(layout, value, time.UTC)
+	}
+
+	if timestamp, err := strconv.ParseFloat(value, 64); err == nil {
+		return unixTime(int64(timestamp)), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if candleTime, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return candleTime.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", value)
+}
+
+// unixTime converts a timestamp in seconds, milliseconds or microseconds, eg: Binance Vision spot dumps
+// are in microseconds since 2025
+func unixTime(timestamp int64) time.Time {
+	switch {
+	case timestamp > 1e15:
+		return time.UnixMicro(timestamp).UTC()
+	case timestamp > 1e12:
+		return time.UnixMilli(timestamp).UTC()
+	default:
+		return time.Unix(timestamp, 0).UTC()
+	}
+}
@@ -0,0 +1,126 @@
+package download
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+)
+
+func importedCandles(t *testing.T, file string) []model.Candle {
+	t.Helper()
+	feed, err := exchange.NewCSVFeed("1h", exchange.PairFeed{Pair: "BTCUSDT", File: file, Timeframe: "1h"})
+	require.NoError(t, err)
+	return feed.CandlePairTimeFrame["BTCUSDT--1h"]
+}
+
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("binance vision", func(t *testing.T) {
+		// spot dumps have times in microseconds since 2025, and newer dumps have a header
+		content := "open_time,open,high,low,close,volume,close_time,quote_volume,count,taker_buy_volume," +
+			"taker_buy_quote_volume,ignore\n" +
+			"1640998800000,47000,47500,46900,47100,10.5,1641002399999,0,0,0,0,0\n" +
+			"1640995200000000,46500,47100,46400,47000,20,1640998799999999,0,0,0,0,0\n"
+
+		archive := filepath.Join(dir, "BTCUSDT-1h-2022-01.zip")
+		file, err := os.Create(archive)
+		require.NoError(t, err)
+		writer := zip.NewWriter(file)
+		entry, err := writer.Create("BTCUSDT-1h-2022-01.csv")
+		require.NoError(t, err)
+		_, err = entry.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		require.NoError(t, file.Close())
+
+		output := filepath.Join(dir, "binance.csv")
+		count, err := Import(archive, output, FormatBinanceVision)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		candles := importedCandles(t, output)
+		require.Len(t, candles, 2)
+		require.Equal(t, start, candles[0].Time)
+		require.Equal(t, 46500.0, candles[0].Open)
+		require.Equal(t, 47100.0, candles[0].High)
+		require.Equal(t, 46400.0, candles[0].Low)
+		require.Equal(t, 47000.0, candles[0].Close)
+		require.Equal(t, 20.0, candles[0].Volume)
+		require.Equal(t, start.Add(time.Hour), candles[1].Time)
+	})
+
+	t.Run("freqtrade", func(t *testing.T) {
+		input := filepath.Join(dir, "BTC_USDT-1h.json")
+		require.NoError(t, os.WriteFile(input, []byte(`[[1640995200000,46500,47100,46400,47000,20],
+			[1640998800000,47000,47500,46900,47100,10.5],[1640998800000,47000,47600,46900,47200,11]]`), 0600))
+
+		output := filepath.Join(dir, "freqtrade.csv")
+		count, err := Import(input, output, FormatFreqtrade)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		// duplicated candles keep the last one
+		candles := importedCandles(t, output)
+		require.Len(t, candles, 2)
+		require.Equal(t, start, candles[0].Time)
+		require.Equal(t, 47200.0, candles[1].Close)
+		require.Equal(t, 11.0, candles[1].Volume)
+	})
+
+	t.Run("generic csv", func(t *testing.T) {
+		input := filepath.Join(dir, "generic.csv")
+		require.NoError(t, os.WriteFile(input, []byte("Date,Vol,O,H,L,C\n"+
+			"01/01/2022 01:00,10.5,47000,47500,46900,47100\n"+
+			"01/01/2022 00:00,20,46500,47100,46400,47000\n"), 0600))
+
+		mapping, err := ParseColumnMapping("time=Date,open=O,high=H,low=L,close=C,volume=1,layout=01/02/2006 15:04")
+		require.NoError(t, err)
+
+		output := filepath.Join(dir, "generic-out.csv")
+		count, err := Import(input, output, FormatCSV, WithColumnMapping(mapping))
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		candles := importedCandles(t, output)
+		require.Equal(t, start, candles[0].Time)
+		require.Equal(t, 47000.0, candles[0].Close)
+		require.Equal(t, 20.0, candles[0].Volume)
+
+		// columns not found
+		mapping, err = ParseColumnMapping("time=Timestamp")
+		require.NoError(t, err)
+		_, err = Import(input, output, FormatCSV, WithColumnMapping(mapping))
+		require.ErrorIs(t, err, ErrInvalidMapping)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := Import("input.txt", filepath.Join(dir, "out.csv"), Format("mt4"))
+		require.ErrorIs(t, err, ErrUnknownFormat)
+
+		_, err = ParseColumnMapping("date=Date")
+		require.ErrorIs(t, err, ErrInvalidMapping)
+		_, err = ParseColumnMapping("time")
+		require.ErrorIs(t, err, ErrInvalidMapping)
+	})
+}
+
+func TestParseColumnMapping(t *testing.T) {
+	mapping, err := ParseColumnMapping("")
+	require.NoError(t, err)
+	require.Equal(t, DefaultColumnMapping, mapping)
+
+	mapping, err = ParseColumnMapping("time=0, close=Adj Close")
+	require.NoError(t, err)
+	require.Equal(t, "0", mapping.Time)
+	require.Equal(t, "Adj Close", mapping.Close)
+	require.Equal(t, "open", mapping.Open)
+}
@@ -0,0 +1,131 @@
+package download
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+)
+
+// ErrUnordered is returned by Verify for candles out of order or duplicated
+var ErrUnordered = errors.New("candles out of order")
+
+// Gap is a period without candles in a file
+type Gap struct {
+	// After and Before are the times of the candles around the gap
+	After  time.Time
+	Before time.Time
+	// Missing is the number of candles of the timeframe in the gap
+	Missing int
+}
+
+// storedCandles is the period of the candles of an existing file
+type storedCandles struct {
+	first time.Time
+	last  time.Time
+}
+
+// resume returns the period of the candles of an existing file, and removes the last candle from the file,
+// it may be incomplete and is downloaded again. Missing files or files without candles return nil.
+func resume(output string) (*storedCandles, error) {
+	content, err := os.ReadFile(output)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		stored     *storedCandles
+		lastOffset int
+	)
+	for offset := 0; offset < len(content); {
+		line := content[offset:]
+		next := len(content)
+		if index := bytes.IndexByte(line, '\n'); index >= 0 {
+			line, next = line[:index], offset+index+1
+		}
+
+		if candleTime, ok := parseTime(line); ok {
+			if stored == nil {
+				stored = &storedCandles{first: candleTime}
+			}
+			stored.last = candleTime
+			lastOffset = offset
+		}
+		offset = next
+	}
+
+	if stored == nil {
+		return nil, nil
+	}
+	return stored, os.Truncate(output, int64(lastOffset))
+}
+
+// parseTime returns the time of a candle line, false for headers and empty lines
+func parseTime(line []byte) (time.Time, bool) {
+	field := line
+	if index := bytes.IndexByte(line, ','); index >= 0 {
+		field = line[:index]
+	}
+
+	value, err := strconv.ParseInt(string(bytes.TrimSpace(field)), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return unixTime(value), true
+}
+
+// Verify returns the gaps between the candles of a CSV file of a timeframe, and ErrUnordered for candles
+// out of order or duplicated
+func Verify(file, timeframe string) ([]Gap, error) {
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	csvFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+
+	var (
+		gaps     []Gap
+		previous time.Time
+	)
+	reader := csv.NewReader(csvFile)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		candleTime, ok := parseTime([]byte(record[0]))
+		if !ok {
+			continue
+		}
+
+		if !previous.IsZero() {
+			if !candleTime.After(previous) {
+				return gaps, fmt.Errorf("%w: %s after %s", ErrUnordered, candleTime, previous)
+			}
+			if missing := int(candleTime.Sub(previous)/interval) - 1; missing > 0 {
+				gaps = append(gaps, Gap{After: previous, Before: candleTime, Missing: missing})
+			}
+		}
+		previous = candleTime
+	}
+	return gaps, nil
+}
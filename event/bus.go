@@ -0,0 +1,176 @@
+package event
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// Topic identifies a stream of events with a given payload type
+type Topic[T any] struct {
+	Name string
+}
+
+// NewTopic creates a custom topic, to be used by external subsystems
+func NewTopic[T any](name string) Topic[T] {
+	return Topic[T]{Name: name}
+}
+
+// RiskEvent is published by risk guards when a limit is reached or an action is taken
+type RiskEvent struct {
+	Time    time.Time
+	Pair    string
+	Kind    string
+	Message string
+}
+
+// Equity is the total value of the account, in the quote currency
+type Equity struct {
+	Time  time.Time
+	Value float64
+}
+
+// Error is an error raised by a module, eg: an order rejected by the exchange
+type Error struct {
+	Time   time.Time
+	Source string
+	Err    error
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Source, e.Err)
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// Candles receives all candles processed by the bot, including partial candles
+	Candles = NewTopic[model.Candle]("candle")
+	// Orders receives new orders and status updates
+	Orders = NewTopic[model.Order]("order")
+	// Fills receives filled orders
+	Fills = NewTopic[model.Order]("fill")
+	// Errors receives errors from order execution and data feeds
+	Errors = NewTopic[Error]("error")
+	// Risks receives events from risk guards
+	Risks = NewTopic[RiskEvent]("risk")
+	// Equities receives the account equity after each complete candle
+	Equities = NewTopic[Equity]("equity")
+	// Positions receives the positions of the bot updated by fills, with their profit and fees
+	Positions = NewTopic[model.PositionPnL]("position")
+	// ClosedPositions receives the positions closed by fills, with the closed size, the average entry price,
+	// the exit price as mark price, and the realized profit and fees of the position
+	ClosedPositions = NewTopic[model.PositionPnL]("position-closed")
+)
+
+type subscriber struct {
+	id      int64
+	handler func(payload interface{})
+}
+
+// Bus is a publish/subscribe event bus, it allows new subsystems (eg: metrics, dashboards or risk guards)
+// to receive bot events without changes in the controllers or exchanges. A nil bus discards all events.
+type Bus struct {
+	mtx         sync.RWMutex
+	counter     int64
+	subscribers map[string][]subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[string][]subscriber),
+	}
+}
+
+func (b *Bus) subscribe(topic string, handler func(payload interface{})) func() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.counter++
+	id := b.counter
+	b.subscribers[topic] = append(b.subscribers[topic], subscriber{id: id, handler: handler})
+
+	return func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+
+		subscribers := b.subscribers[topic]
+		for i, sub := range subscribers {
+			if sub.id == id {
+				b.subscribers[topic] = append(subscribers[:i:i], subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (b *Bus) publish(topic string, payload interface{}) {
+	b.mtx.RLock()
+	subscribers := b.subscribers[topic]
+	b.mtx.RUnlock()
+
+	for _, sub := range subscribers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("event/%s: subscriber panic: %v", topic, r)
+				}
+			}()
+			sub.handler(payload)
+		}()
+	}
+}
+
+// Subscribe registers a handler for a topic, handlers are executed synchronously in the publisher goroutine.
+// It returns a function to cancel the subscription.
+func Subscribe[T any](bus *Bus, topic Topic[T], handler func(T)) func() {
+	return bus.subscribe(topic.Name, func(payload interface{}) {
+		handler(payload.(T))
+	})
+}
+
+// SubscribeAsync registers a handler executed in a dedicated goroutine, so slow subscribers do not block
+// publishers. Events are buffered up to the given size, and new events are dropped when the buffer is full.
+func SubscribeAsync[T any](bus *Bus, topic Topic[T], buffer int, handler func(T)) func() {
+	events := make(chan T, buffer)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case payload := <-events:
+				handler(payload)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	unsubscribe := Subscribe(bus, topic, func(payload T) {
+		select {
+		case events <- payload:
+		default:
+			log.Warnf("event/%s: subscriber buffer is full, event dropped", topic.Name)
+		}
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			unsubscribe()
+			close(done)
+		})
+	}
+}
+
+// Publish sends an event to all subscribers of a topic
+func Publish[T any](bus *Bus, topic Topic[T], payload T) {
+	if bus == nil {
+		return
+	}
+	bus.publish(topic.Name, payload)
+}
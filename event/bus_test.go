@@ -0,0 +1,70 @@
+package event
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestBus(t *testing.T) {
+	t.Run("typed subscription", func(t *testing.T) {
+		bus := NewBus()
+
+		var orders, fills []model.Order
+		Subscribe(bus, Orders, func(order model.Order) {
+			orders = append(orders, order)
+		})
+		unsubscribe := Subscribe(bus, Fills, func(order model.Order) {
+			fills = append(fills, order)
+		})
+
+		Publish(bus, Orders, model.Order{ID: 1})
+		Publish(bus, Fills, model.Order{ID: 2})
+		unsubscribe()
+		Publish(bus, Fills, model.Order{ID: 3})
+
+		require.Len(t, orders, 1)
+		require.Len(t, fills, 1)
+		require.Equal(t, int64(2), fills[0].ID)
+	})
+
+	t.Run("panic in subscriber", func(t *testing.T) {
+		bus := NewBus()
+		var received error
+		Subscribe(bus, Errors, func(Error) {
+			panic("fail")
+		})
+		Subscribe(bus, Errors, func(err Error) {
+			received = err
+		})
+
+		Publish(bus, Errors, Error{Source: "test", Err: errors.New("fail")})
+		require.EqualError(t, received, "test: fail")
+	})
+
+	t.Run("async subscription", func(t *testing.T) {
+		bus := NewBus()
+		received := make(chan Equity, 1)
+		unsubscribe := SubscribeAsync(bus, Equities, 10, func(equity Equity) {
+			received <- equity
+		})
+		defer unsubscribe()
+
+		Publish(bus, Equities, Equity{Value: 100})
+		select {
+		case equity := <-received:
+			require.Equal(t, 100.0, equity.Value)
+		case <-time.After(time.Second):
+			require.Fail(t, "event not received")
+		}
+	})
+
+	t.Run("nil bus", func(t *testing.T) {
+		var bus *Bus
+		Publish(bus, Candles, model.Candle{})
+	})
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 
 	"github.com/bengalm/ninjabot"
 	"github.com/bengalm/ninjabot/examples/strategies"
@@ -15,6 +17,11 @@ import (
 // This example shows how to use backtesting with NinjaBot
 // Backtesting is a simulation of the strategy in historical data (from CSV)
 func main() {
+	manifestPath := flag.String("manifest", "manifest.json", "save the manifest of the backtest")
+	verifyPath := flag.String("verify", "", "verify that the backtest matches a manifest with the same "+
+		"data, strategy and wallet, eg: manifest.json")
+	flag.Parse()
+
 	ctx := context.Background()
 
 	// bot settings (eg: pairs, telegram, etc)
@@ -72,12 +79,7 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// initializer Ninjabot with the objects created before
-	bot, err := ninjabot.NewBot(
-		ctx,
-		settings,
-		wallet,
-		strategy,
+	options := []ninjabot.Option{
 		ninjabot.WithBacktest(wallet), // Required for Backtest mode
 		ninjabot.WithStorage(storage),
 
@@ -85,7 +87,22 @@ func main() {
 		ninjabot.WithCandleSubscription(chart),
 		ninjabot.WithOrderSubscription(chart),
 		ninjabot.WithLogLevel(log.WarnLevel),
-	)
+
+		// save the data hash, strategy params, wallet settings and seed to reproduce the backtest
+		ninjabot.WithManifest(*manifestPath),
+	}
+
+	// verify a previous backtest, the run fails when the result is not the same
+	if *verifyPath != "" {
+		manifest, err := ninjabot.LoadManifest(*verifyPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options = append(options, ninjabot.WithVerifyManifest(manifest))
+	}
+
+	// initializer Ninjabot with the objects created before
+	bot, err := ninjabot.NewBot(ctx, settings, wallet, strategy, options...)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -99,6 +116,12 @@ func main() {
 	// Print bot results
 	bot.Summary()
 
+	// Resample the trades to estimate the confidence intervals of the final equity and drawdown
+	for pair, result := range bot.MonteCarlo(10000) {
+		fmt.Println(pair)
+		fmt.Println(result)
+	}
+
 	// Display candlesticks chart in local browser
 	err = chart.Start()
 	if err != nil {
@@ -68,6 +68,8 @@ func main() {
 			indicator.EMA(8, "red"),
 			indicator.SMA(21, "blue"),
 		),
+		// plot the equity and drawdown of the wallet, use plot.WithAccount for a live exchange
+		plot.WithPaperWallet(paperWallet),
 	)
 	if err != nil {
 		log.Fatal(err)
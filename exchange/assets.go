@@ -0,0 +1,50 @@
+package exchange
+
+import (
+	"context"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// assetsMissInterval is the minimum interval between reloads of the assets info caused by unknown pairs,
+// so orders of invalid pairs do not flood the exchange info endpoint
+const assetsMissInterval = time.Minute
+
+// refreshAssetsInfo reloads the assets info of an exchange periodically until the context is done,
+// since exchanges adjust the filters of pairs and list new pairs while the bot is running
+func refreshAssetsInfo(ctx context.Context, name string, interval time.Duration,
+	load func(ctx context.Context) error) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := load(ctx); err != nil {
+				log.Errorf("[ASSETS] %s refresh fail: %v", name, err)
+			}
+		}
+	}
+}
+
+// logAssetsChanges logs the pairs listed and the pairs with new filters since the previous load
+func logAssetsChanges(name string, previous, current map[string]model.AssetInfo) {
+	if previous == nil {
+		return
+	}
+
+	for pair, info := range current {
+		old, ok := previous[pair]
+		switch {
+		case !ok:
+			log.Infof("[ASSETS] %s: new pair %s", name, pair)
+		case old != info:
+			log.Infof("[ASSETS] %s: %s filters updated", name, pair)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package exchange
+
+import (
+	"context"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// backfillTimeout is the time limit to fetch the candles missing in a feed
+const backfillTimeout = 30 * time.Second
+
+// missingCandles returns the candles lost between the last candle of a feed and a new candle, eg: after
+// a websocket reconnect, fetched from the exchange in chronological order. The last candle is fetched
+// again when its close was not received.
+func (d *DataFeedSubscription) missingCandles(key string, candle model.Candle) []model.Candle {
+	last, ok := d.guard.Last(key)
+	if !ok {
+		return nil
+	}
+
+	pair, timeframe := d.pairTimeframeFromKey(key)
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil
+	}
+
+	start := last.Time
+	if last.Complete {
+		start = start.Add(interval)
+	}
+	end := candle.Time.Add(-interval)
+	if end.Before(start) {
+		return nil
+	}
+
+	log.Warnf("[FEED] gap detected %s: candles from %s to %s, backfilling", key, start, end)
+	ctx, cancel := context.WithTimeout(context.Background(), backfillTimeout)
+	defer cancel()
+
+	candles, err := d.exchange.CandlesByPeriod(ctx, pair, timeframe, start, end)
+	if err != nil {
+		log.Errorf("[FEED] backfill fail %s: %v", key, err)
+		return nil
+	}
+
+	missing := make([]model.Candle, 0, len(candles))
+	for _, candle := range candles {
+		if candle.Time.Before(start) || candle.Time.After(end) {
+			continue
+		}
+		// candles before the new candle are closed
+		candle.Complete = true
+		missing = append(missing, candle)
+	}
+	log.Infof("[FEED] %d candles backfilled %s", len(missing), key)
+	return missing
+}
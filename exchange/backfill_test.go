@@ -0,0 +1,49 @@
+package exchange
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestDataFeedSubscription_Backfill(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := minuteCandles(start, 1, 2, 3, 4, 5, 6)
+	source := CandleSourceFunc(func(_ context.Context, _, _ string, from, to time.Time) ([]model.Candle, error) {
+		candles := make([]model.Candle, 0)
+		for _, candle := range history {
+			if !candle.Time.Before(from) && !candle.Time.After(to) {
+				candles = append(candles, candle)
+			}
+		}
+		return candles, nil
+	})
+
+	// the close of the second candle and the next two candles are lost in a reconnection
+	partial := history[1]
+	partial.Complete = false
+	partial.Close = 1.5
+	stream := []model.Candle{history[0], partial, history[4], history[5]}
+
+	feed := NewDataFeed(streamFeeder{Feeder: NewCustomFeed(source), candles: stream})
+	var mtx sync.Mutex
+	received := make([]float64, 0)
+	feed.Subscribe("BTCUSDT", "1m", func(candle model.Candle) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		received = append(received, candle.Close)
+	}, true)
+	feed.Start(false)
+
+	require.Eventually(t, func() bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return len(received) == len(history)
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, []float64{1, 2, 3, 4, 5, 6}, received)
+}
@@ -0,0 +1,422 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/adshao/go-binance/v2/delivery"
+	"github.com/gorilla/websocket"
+	"github.com/jpillora/backoff"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// binanceDeliveryStreamEndpoint is the websocket endpoint of the COIN-M futures market
+const binanceDeliveryStreamEndpoint = "wss://dstream.binance.com/ws"
+
+// binanceDeliveryFundingLimit is the maximum number of funding rates per request of the COIN-M API
+const binanceDeliveryFundingLimit = 1000
+
+type BinanceDeliveryOption func(*BinanceDelivery)
+
+// BinanceDelivery is a feeder of the Binance COIN-M futures market, contracts margined and settled in the
+// base asset, eg: BTCUSD_PERP. It provides candles, mark-price candles and the funding history for downloads
+// and backtests, trading is not supported.
+type BinanceDelivery struct {
+	ctx    context.Context
+	client *delivery.Client
+
+	// Endpoint and StreamEndpoint override the REST and websocket URLs, eg: for a mock server
+	Endpoint       string
+	StreamEndpoint string
+
+	// HTTPClient and ProxyURL customize the connections of REST requests and websocket streams
+	HTTPClient *http.Client
+	ProxyURL   string
+	dialer     *websocket.Dialer
+
+	// RateLimit is the request weight per minute of the REST API, requests are delayed near the limit
+	RateLimit int
+	limiter   *rateLimiter
+
+	assetsInfo map[string]model.AssetInfo
+	assetsMtx  sync.RWMutex
+}
+
+// WithBinanceDeliveryEndpoint overrides the REST and websocket endpoints, empty values keep the defaults
+func WithBinanceDeliveryEndpoint(endpoint, streamEndpoint string) BinanceDeliveryOption {
+	return func(b *BinanceDelivery) {
+		b.Endpoint = endpoint
+		b.StreamEndpoint = streamEndpoint
+	}
+}
+
+// WithBinanceDeliveryHTTPClient uses a custom HTTP client for REST requests
+func WithBinanceDeliveryHTTPClient(client *http.Client) BinanceDeliveryOption {
+	return func(b *BinanceDelivery) {
+		b.HTTPClient = client
+	}
+}
+
+// WithBinanceDeliveryProxy routes REST requests and websocket streams through a proxy, eg: http://host:8080
+func WithBinanceDeliveryProxy(proxyURL string) BinanceDeliveryOption {
+	return func(b *BinanceDelivery) {
+		b.ProxyURL = proxyURL
+	}
+}
+
+// NewBinanceDelivery creates a feeder of the Binance COIN-M futures market
+func NewBinanceDelivery(ctx context.Context, options ...BinanceDeliveryOption) (*BinanceDelivery, error) {
+	exchange := &BinanceDelivery{
+		ctx:       ctx,
+		RateLimit: binanceFutureWeightLimit,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	exchange.client = delivery.NewClient("", "")
+	if exchange.Endpoint != "" {
+		exchange.client.SetApiEndpoint(exchange.Endpoint)
+	}
+
+	proxyURL, err := parseProxy(exchange.ProxyURL)
+	if err != nil {
+		return nil, err
+	}
+	exchange.limiter = newRateLimiter(exchange.RateLimit, nil)
+	exchange.client.HTTPClient, err = newHTTPClient(exchange.HTTPClient, proxyURL, exchange.limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	exchange.dialer = newDialer(proxyURL)
+	if proxyURL != nil && exchange.StreamEndpoint == "" {
+		exchange.StreamEndpoint = binanceDeliveryStreamEndpoint
+	}
+
+	if err := exchange.client.NewPingService().Do(ctx); err != nil {
+		return nil, fmt.Errorf("binance delivery ping fail: %w", err)
+	}
+
+	if err := exchange.loadAssetsInfo(ctx); err != nil {
+		return nil, err
+	}
+
+	log.Info("[SETUP] Using Binance COIN-M Futures exchange")
+	return exchange, nil
+}
+
+func (b *BinanceDelivery) loadAssetsInfo(ctx context.Context) error {
+	results, err := b.client.NewExchangeInfoService().Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	assetsInfo := make(map[string]model.AssetInfo)
+	for _, info := range results.Symbols {
+		tradeLimits := model.AssetInfo{
+			BaseAsset:          info.BaseAsset,
+			QuoteAsset:         info.QuoteAsset,
+			BaseAssetPrecision: info.BaseAssetPrecision,
+			QuotePrecision:     info.QuotePrecision,
+			PricePrecision:     info.PricePrecision,
+		}
+		for _, filter := range info.Filters {
+			switch filter["filterType"] {
+			case "LOT_SIZE":
+				tradeLimits.MinQuantity, _ = strconv.ParseFloat(fmt.Sprint(filter["minQty"]), 64)
+				tradeLimits.MaxQuantity, _ = strconv.ParseFloat(fmt.Sprint(filter["maxQty"]), 64)
+				tradeLimits.StepSize, _ = strconv.ParseFloat(fmt.Sprint(filter["stepSize"]), 64)
+			case "PRICE_FILTER":
+				tradeLimits.MinPrice, _ = strconv.ParseFloat(fmt.Sprint(filter["minPrice"]), 64)
+				tradeLimits.MaxPrice, _ = strconv.ParseFloat(fmt.Sprint(filter["maxPrice"]), 64)
+				tradeLimits.TickSize, _ = strconv.ParseFloat(fmt.Sprint(filter["tickSize"]), 64)
+			}
+		}
+		assetsInfo[info.Symbol] = tradeLimits
+		RegisterPair(info.Symbol, info.BaseAsset, info.QuoteAsset)
+	}
+
+	b.assetsMtx.Lock()
+	defer b.assetsMtx.Unlock()
+	b.assetsInfo = assetsInfo
+	return nil
+}
+
+func (b *BinanceDelivery) AssetsInfo(pair string) model.AssetInfo {
+	b.assetsMtx.RLock()
+	defer b.assetsMtx.RUnlock()
+	return b.assetsInfo[pair]
+}
+
+func (b *BinanceDelivery) LastQuote(ctx context.Context, pair string) (float64, error) {
+	candles, err := b.CandlesByLimit(ctx, pair, "1m", 1)
+	if err != nil || len(candles) < 1 {
+		return 0, err
+	}
+	return candles[0].Close, nil
+}
+
+func (b *BinanceDelivery) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	data, err := b.client.NewKlinesService().Symbol(pair).
+		Interval(period).
+		Limit(limit + 1).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0, len(data))
+	for _, d := range data {
+		candles = append(candles, deliveryCandle(pair, d.OpenTime, d.Open, d.Close, d.High, d.Low, d.Volume, true))
+	}
+
+	if len(candles) == 0 {
+		return candles, nil
+	}
+	// discard last candle, because it is incomplete
+	return candles[:len(candles)-1], nil
+}
+
+// CandlesByPeriod returns the candles of a period, paginating the requests by the start time, since
+// the API returns up to 1500 candles per request
+func (b *BinanceDelivery) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	candles := make([]model.Candle, 0)
+	for !start.After(end) {
+		data, err := b.client.NewKlinesService().Symbol(pair).
+			Interval(period).
+			StartTime(start.UnixMilli()).
+			EndTime(end.UnixMilli()).
+			Limit(binanceFutureKlineLimit).
+			Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range data {
+			candles = append(candles, deliveryCandle(pair, d.OpenTime, d.Open, d.Close, d.High, d.Low, d.Volume, true))
+		}
+
+		if len(data) < binanceFutureKlineLimit {
+			break
+		}
+		start = time.UnixMilli(data[len(data)-1].OpenTime + 1)
+	}
+
+	return candles, nil
+}
+
+// MarkPriceCandlesByPeriod returns the candles of the mark price of a period, which triggers liquidations
+// and settles the funding, without volume
+func (b *BinanceDelivery) MarkPriceCandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	candles := make([]model.Candle, 0)
+	for !start.After(end) {
+		var data [][]interface{}
+		err := b.get(ctx, "/dapi/v1/markPriceKlines", url.Values{
+			"symbol":    {pair},
+			"interval":  {period},
+			"startTime": {strconv.FormatInt(start.UnixMilli(), 10)},
+			"endTime":   {strconv.FormatInt(end.UnixMilli(), 10)},
+			"limit":     {strconv.Itoa(binanceFutureKlineLimit)},
+		}, &data)
+		if err != nil {
+			return nil, err
+		}
+
+		var openTime float64
+		for _, kline := range data {
+			var ok bool
+			if len(kline) >= 5 {
+				openTime, ok = kline[0].(float64)
+			}
+			if !ok {
+				return nil, fmt.Errorf("%w: mark price kline of %s", ErrInsufficientData, pair)
+			}
+			candles = append(candles, deliveryCandle(pair, int64(openTime), fmt.Sprint(kline[1]),
+				fmt.Sprint(kline[4]), fmt.Sprint(kline[2]), fmt.Sprint(kline[3]), "0", true))
+		}
+
+		if len(data) < binanceFutureKlineLimit {
+			break
+		}
+		start = time.UnixMilli(int64(openTime) + 1)
+	}
+
+	return candles, nil
+}
+
+// FundingRates returns the settled funding rates of a perpetual pair between start and end, sorted by time
+func (b *BinanceDelivery) FundingRates(ctx context.Context, pair string, start,
+	end time.Time) ([]model.FundingRate, error) {
+
+	rates := make([]model.FundingRate, 0)
+	for begin := start; !begin.After(end); {
+		var history []struct {
+			FundingTime int64  `json:"fundingTime"`
+			FundingRate string `json:"fundingRate"`
+		}
+		err := b.get(ctx, "/dapi/v1/fundingRate", url.Values{
+			"symbol":    {pair},
+			"startTime": {strconv.FormatInt(begin.UnixMilli(), 10)},
+			"endTime":   {strconv.FormatInt(end.UnixMilli(), 10)},
+			"limit":     {strconv.Itoa(binanceDeliveryFundingLimit)},
+		}, &history)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range history {
+			rate, err := strconv.ParseFloat(item.FundingRate, 64)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, model.FundingRate{
+				Pair: pair,
+				Rate: rate,
+				Time: time.UnixMilli(item.FundingTime),
+			})
+		}
+
+		if len(history) < binanceDeliveryFundingLimit {
+			break
+		}
+		begin = time.UnixMilli(history[len(history)-1].FundingTime + 1)
+	}
+
+	return rates, nil
+}
+
+// get requests a public endpoint that is not supported by the client library
+func (b *BinanceDelivery) get(ctx context.Context, endpoint string, params url.Values, result interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		b.client.BaseURL+endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := b.client.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		apiError := new(common.APIError)
+		if err := json.Unmarshal(body, apiError); err != nil || apiError.Code == 0 {
+			return fmt.Errorf("binance delivery %s: status %d", endpoint, response.StatusCode)
+		}
+		return apiError
+	}
+	return json.Unmarshal(body, result)
+}
+
+func (b *BinanceDelivery) CandlesSubscription(ctx context.Context, pair,
+	period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		for {
+			done, _, err := b.klineServe(pair, period, func(event *delivery.WsKlineEvent) {
+				ba.Reset()
+				k := event.Kline
+				candle := deliveryCandle(pair, k.StartTime, k.Open, k.Close, k.High, k.Low, k.Volume, k.IsFinal)
+				select {
+				case ccandle <- candle:
+				case <-ctx.Done():
+				}
+			}, func(err error) {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+				}
+			})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				close(cerr)
+				close(ccandle)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// klineServe subscribes to the kline stream of a pair, using the custom stream endpoint when configured
+func (b *BinanceDelivery) klineServe(pair, period string, handler delivery.WsKlineHandler,
+	errHandler delivery.ErrHandler) (doneC, stopC chan struct{}, err error) {
+
+	if b.StreamEndpoint == "" {
+		return delivery.WsKlineServe(pair, period, handler, errHandler)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s@kline_%s", b.StreamEndpoint, strings.ToLower(pair), period)
+	return wsServeDialer(b.dialer, endpoint, func(message []byte) {
+		event := new(delivery.WsKlineEvent)
+		if err := json.Unmarshal(message, event); err != nil {
+			errHandler(err)
+			return
+		}
+		handler(event)
+	}, errHandler)
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (b *BinanceDelivery) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("binance delivery")
+}
+
+func deliveryCandle(pair string, openTime int64, open, closePrice, high, low, volume string,
+	complete bool) model.Candle {
+
+	var err error
+	t := time.UnixMilli(openTime)
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Complete: complete}
+	candle.Open, err = strconv.ParseFloat(open, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.Close, err = strconv.ParseFloat(closePrice, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.High, err = strconv.ParseFloat(high, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.Low, err = strconv.ParseFloat(low, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.Volume, err = strconv.ParseFloat(volume, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.Metadata = make(map[string]float64)
+	return candle
+}
@@ -0,0 +1,179 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func newTestBinanceDelivery(t *testing.T) *BinanceDelivery {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dapi/v1/ping", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/dapi/v1/exchangeInfo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"symbols":[{"symbol":"BTCUSD_PERP","pair":"BTCUSD","contractType":"PERPETUAL",
+			"baseAsset":"BTC","quoteAsset":"USD","marginAsset":"BTC","pricePrecision":1,"quantityPrecision":0,
+			"contractSize":100,"filters":[
+			{"filterType":"LOT_SIZE","minQty":"1","maxQty":"1000000","stepSize":"1"},
+			{"filterType":"PRICE_FILTER","minPrice":"1000","maxPrice":"4520958","tickSize":"0.1"}]}]}`))
+	})
+
+	// one candle per minute, with the minute as close price, and the mark price one above
+	klines := func(mark float64) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			require.Equal(t, "BTCUSD_PERP", query.Get("symbol"))
+			start, err := strconv.ParseInt(query.Get("startTime"), 10, 64)
+			require.NoError(t, err)
+			end, err := strconv.ParseInt(query.Get("endTime"), 10, 64)
+			require.NoError(t, err)
+			limit, err := strconv.Atoi(query.Get("limit"))
+			require.NoError(t, err)
+
+			result := make([][]interface{}, 0)
+			first := (start + time.Minute.Milliseconds() - 1) / time.Minute.Milliseconds()
+			for minute := first; minute*time.Minute.Milliseconds() <= end && len(result) < limit; minute++ {
+				openTime := minute * time.Minute.Milliseconds()
+				closePrice := strconv.FormatFloat(float64(minute)+mark, 'f', -1, 64)
+				result = append(result, []interface{}{openTime, "1", "2", "0.5", closePrice, "10",
+					openTime + time.Minute.Milliseconds() - 1, "1", 1, "1", "1", "0"})
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(result))
+		}
+	}
+	mux.HandleFunc("/dapi/v1/klines", klines(0))
+	mux.HandleFunc("/dapi/v1/markPriceKlines", klines(1))
+	mux.HandleFunc("/dapi/v1/fundingRate", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("symbol") != "BTCUSD_PERP" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":-1121,"msg":"Invalid symbol."}`))
+			return
+		}
+
+		// one funding every 8 hours, from the first funding after the start
+		start, err := strconv.ParseInt(query.Get("startTime"), 10, 64)
+		require.NoError(t, err)
+		end, err := strconv.ParseInt(query.Get("endTime"), 10, 64)
+		require.NoError(t, err)
+		limit, err := strconv.Atoi(query.Get("limit"))
+		require.NoError(t, err)
+
+		period := (8 * time.Hour).Milliseconds()
+		rates := make([]map[string]interface{}, 0)
+		first := (start + period - 1) / period * period
+		for fundingTime := first; fundingTime <= end && len(rates) < limit; fundingTime += period {
+			rates = append(rates, map[string]interface{}{"symbol": "BTCUSD_PERP", "fundingRate": "0.0001",
+				"fundingTime": fundingTime})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(rates))
+	})
+	mux.HandleFunc("/ws/btcusd_perp@kline_1m", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"kline","E":1640995260000,"s":"BTCUSD_PERP",
+			"k":{"t":1640995200000,"T":1640995259999,"s":"BTCUSD_PERP","i":"1m","o":"100","c":"101","h":"102",
+			"l":"99","v":"50","x":true}}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	binance, err := NewBinanceDelivery(ctx, WithBinanceDeliveryEndpoint(server.URL,
+		"ws"+strings.TrimPrefix(server.URL, "http")+"/ws"))
+	require.NoError(t, err)
+	return binance
+}
+
+func TestBinanceDelivery_AssetsInfo(t *testing.T) {
+	binance := newTestBinanceDelivery(t)
+
+	info := binance.AssetsInfo("BTCUSD_PERP")
+	require.Equal(t, "BTC", info.BaseAsset)
+	require.Equal(t, "USD", info.QuoteAsset)
+	require.Equal(t, 1.0, info.StepSize)
+	require.Equal(t, 0.1, info.TickSize)
+}
+
+func TestBinanceDelivery_CandlesByPeriod(t *testing.T) {
+	binance := newTestBinanceDelivery(t)
+
+	// two days of 1m candles are fetched in two pages of 1500 candles
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48*time.Hour - time.Minute)
+	candles, err := binance.CandlesByPeriod(context.Background(), "BTCUSD_PERP", "1m", start, end)
+	require.NoError(t, err)
+	require.Len(t, candles, 2880)
+	require.Equal(t, start, candles[0].Time.UTC())
+	require.Equal(t, float64(start.Unix()/60), candles[0].Close)
+	require.Equal(t, 10.0, candles[0].Volume)
+
+	marks, err := binance.MarkPriceCandlesByPeriod(context.Background(), "BTCUSD_PERP", "1m", start, end)
+	require.NoError(t, err)
+	require.Len(t, marks, 2880)
+	require.Equal(t, end, marks[len(marks)-1].Time.UTC())
+	require.Equal(t, float64(start.Unix()/60)+1, marks[0].Close)
+	require.Equal(t, 2.0, marks[0].High)
+	require.Zero(t, marks[0].Volume)
+}
+
+func TestBinanceDelivery_FundingRates(t *testing.T) {
+	binance := newTestBinanceDelivery(t)
+
+	// requests are paginated by the limit of the exchange
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Duration(binanceDeliveryFundingLimit+10) * 8 * time.Hour)
+	rates, err := binance.FundingRates(context.Background(), "BTCUSD_PERP", start, end)
+	require.NoError(t, err)
+	require.Len(t, rates, binanceDeliveryFundingLimit+11)
+	require.Equal(t, start, rates[0].Time.UTC())
+	require.Equal(t, end, rates[len(rates)-1].Time.UTC())
+	require.Equal(t, model.FundingRate{Pair: "BTCUSD_PERP", Rate: 0.0001, Time: rates[0].Time}, rates[0])
+
+	_, err = binance.FundingRates(context.Background(), "ETHUSD_PERP", start, end)
+	require.ErrorContains(t, err, "Invalid symbol")
+}
+
+func TestBinanceDelivery_CandlesSubscription(t *testing.T) {
+	binance := newTestBinanceDelivery(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	candles, _ := binance.CandlesSubscription(ctx, "BTCUSD_PERP", "1m")
+
+	select {
+	case candle := <-candles:
+		require.Equal(t, "BTCUSD_PERP", candle.Pair)
+		require.Equal(t, time.UnixMilli(1640995200000), candle.Time)
+		require.Equal(t, 101.0, candle.Close)
+		require.Equal(t, 50.0, candle.Volume)
+		require.True(t, candle.Complete)
+	case <-time.After(time.Second):
+		require.Fail(t, "candle not received")
+	}
+}
@@ -0,0 +1,138 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// binanceDepthLevels are the levels of the partial book depth streams
+var binanceDepthLevels = []int{5, 10, 20}
+
+// binanceDepthEvent is an event of the partial book depth streams. Spot events only have the book levels,
+// while futures events also have the event time and update IDs.
+type binanceDepthEvent struct {
+	Event         string      `json:"e"`
+	Time          int64       `json:"E"`
+	Symbol        string      `json:"s"`
+	FirstUpdateID int64       `json:"U"`
+	FinalUpdateID int64       `json:"u"`
+	LastUpdateID  int64       `json:"lastUpdateId"`
+	Bids          [][2]string `json:"bids"`
+	Asks          [][2]string `json:"asks"`
+	FutureBids    [][2]string `json:"b"`
+	FutureAsks    [][2]string `json:"a"`
+}
+
+// binanceDepthEndpoint returns the partial depth stream of a pair, with the supported levels closest to
+// the requested ones. Streams have up to 20 levels.
+func binanceDepthEndpoint(streamEndpoint, pair string, levels int) string {
+	stream := binanceDepthLevels[len(binanceDepthLevels)-1]
+	for _, supported := range binanceDepthLevels {
+		if levels <= supported {
+			stream = supported
+			break
+		}
+	}
+	return fmt.Sprintf("%s/%s@depth%d@100ms", streamEndpoint, strings.ToLower(pair), stream)
+}
+
+func parseBookLevels(levels [][2]string, limit int) ([]model.BookLevel, error) {
+	if limit > 0 && len(levels) > limit {
+		levels = levels[:limit]
+	}
+
+	book := make([]model.BookLevel, 0, len(levels))
+	for _, level := range levels {
+		price, err := strconv.ParseFloat(level[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		quantity, err := strconv.ParseFloat(level[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		book = append(book, model.BookLevel{Price: price, Quantity: quantity})
+	}
+	return book, nil
+}
+
+// newBinanceOrderBook converts an event of the partial depth streams, spot events are timestamped
+// with the receive time
+func newBinanceOrderBook(pair string, levels int, message []byte) (model.OrderBook, error) {
+	event := new(binanceDepthEvent)
+	if err := json.Unmarshal(message, event); err != nil {
+		return model.OrderBook{}, err
+	}
+
+	book := model.OrderBook{Pair: pair, Time: time.Now(), UpdateID: event.LastUpdateID}
+	bids, asks := event.Bids, event.Asks
+	if event.Event != "" {
+		book.Time = time.UnixMilli(event.Time)
+		book.UpdateID = event.FinalUpdateID
+		bids, asks = event.FutureBids, event.FutureAsks
+	}
+
+	var err error
+	if book.Bids, err = parseBookLevels(bids, levels); err != nil {
+		return model.OrderBook{}, err
+	}
+	if book.Asks, err = parseBookLevels(asks, levels); err != nil {
+		return model.OrderBook{}, err
+	}
+	return book, nil
+}
+
+// binanceDepthSubscription streams the order book snapshots of a partial depth stream, until the context is done
+func binanceDepthSubscription(ctx context.Context, dialer *websocket.Dialer, streamEndpoint, pair string,
+	levels int) (chan model.OrderBook, chan error) {
+
+	cbook := make(chan model.OrderBook)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cerr)
+		defer close(cbook)
+
+		binanceStream(ctx, dialer, binanceDepthEndpoint(streamEndpoint, pair, levels), func(message []byte) error {
+			book, err := newBinanceOrderBook(pair, levels, message)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case cbook <- book:
+			case <-ctx.Done():
+			}
+			return nil
+		}, cerr)
+	}()
+
+	return cbook, cerr
+}
+
+// DepthSubscription streams the best levels of the order book of a pair every 100ms, up to 20 levels
+func (b *Binance) DepthSubscription(ctx context.Context, pair string, levels int) (chan model.OrderBook, chan error) {
+	endpoint := b.StreamEndpoint
+	if endpoint == "" {
+		endpoint = binanceStreamEndpoint
+	}
+	return binanceDepthSubscription(ctx, b.dialer, endpoint, pair, levels)
+}
+
+// DepthSubscription streams the best levels of the order book of a pair every 100ms, up to 20 levels
+func (b *BinanceFuture) DepthSubscription(ctx context.Context, pair string,
+	levels int) (chan model.OrderBook, chan error) {
+	endpoint := b.StreamEndpoint
+	if endpoint == "" {
+		endpoint = binanceFutureStreamEndpoint
+	}
+	return binanceDepthSubscription(ctx, b.dialer, endpoint, pair, levels)
+}
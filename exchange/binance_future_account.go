@@ -0,0 +1,144 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/jpillora/backoff"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// binanceFutureKeepalive is the interval to extend the validity of the listen key, which expires after 60 minutes
+const binanceFutureKeepalive = 30 * time.Minute
+
+// userDataServe subscribes to the user data stream of a listen key, using the custom stream endpoint when
+// configured
+func (b *BinanceFuture) userDataServe(listenKey string, handler futures.WsUserDataHandler,
+	errHandler futures.ErrHandler) (doneC, stopC chan struct{}, err error) {
+
+	if b.StreamEndpoint == "" {
+		return futures.WsUserDataServe(listenKey, handler, errHandler)
+	}
+
+	return wsServeDialer(b.dialer, b.StreamEndpoint+"/"+listenKey, func(message []byte) {
+		event := new(futures.WsUserDataEvent)
+		if err := json.Unmarshal(message, event); err != nil {
+			errHandler(err)
+			return
+		}
+		handler(event)
+	}, errHandler)
+}
+
+// AccountSubscription streams the order updates of the user data stream, it renews the listen key
+// periodically and reconnects until the context is done
+func (b *BinanceFuture) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	errHandler := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		defer close(cerr)
+		defer close(corder)
+
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+
+		for {
+			listenKey, err := b.client.NewStartUserStreamService().Do(ctx)
+			var done, stop chan struct{}
+			if err == nil {
+				done, stop, err = b.userDataServe(listenKey, func(event *futures.WsUserDataEvent) {
+					if event.Event != futures.UserDataEventTypeOrderTradeUpdate {
+						return
+					}
+
+					ba.Reset()
+					select {
+					case corder <- newFutureOrderUpdate(event.OrderTradeUpdate, event.TransactionTime):
+					case <-ctx.Done():
+					}
+				}, errHandler)
+			}
+			if err != nil {
+				errHandler(err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(ba.Duration()):
+					continue
+				}
+			}
+
+			if !b.keepUserStream(ctx, listenKey, done, stop, errHandler) {
+				return
+			}
+			time.Sleep(ba.Duration())
+		}
+	}()
+
+	return corder, cerr
+}
+
+// keepUserStream renews the listen key of a user data stream until the stream is closed, returning true,
+// or the context is done, returning false after closing the stream
+func (b *BinanceFuture) keepUserStream(ctx context.Context, listenKey string, done, stop chan struct{},
+	errHandler futures.ErrHandler) bool {
+
+	ticker := time.NewTicker(binanceFutureKeepalive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// wait for the stream handlers before returning
+			close(stop)
+			<-done
+			return false
+		case <-done:
+			return true
+		case <-ticker.C:
+			err := b.client.NewKeepaliveUserStreamService().ListenKey(listenKey).Do(ctx)
+			if err != nil {
+				errHandler(err)
+			}
+		}
+	}
+}
+
+// newFutureOrderUpdate converts an order update of the user data stream, as newFutureOrder does with
+// orders of the REST API: filled orders have the average price and the executed quantity
+func newFutureOrderUpdate(update futures.WsOrderTradeUpdate, transactionTime int64) model.Order {
+	price, _ := strconv.ParseFloat(update.OriginalPrice, 64)
+	quantity, _ := strconv.ParseFloat(update.OriginalQty, 64)
+	average, _ := strconv.ParseFloat(update.AveragePrice, 64)
+	filled, _ := strconv.ParseFloat(update.AccumulatedFilledQty, 64)
+	if average > 0 && filled > 0 {
+		price, quantity = average, filled
+	}
+
+	return model.Order{
+		ExchangeID:   update.ID,
+		Pair:         update.Symbol,
+		CreatedAt:    time.UnixMilli(update.TradeTime),
+		UpdatedAt:    time.UnixMilli(transactionTime),
+		Side:         model.SideType(update.Side),
+		Type:         model.OrderType(update.Type),
+		Status:       model.OrderStatusType(update.Status),
+		Price:        price,
+		Quantity:     quantity,
+		PositionSide: model.PositionSideType(update.PositionSide),
+	}
+}
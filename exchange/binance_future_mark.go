@@ -0,0 +1,269 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2/futures"
+	"github.com/jpillora/backoff"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// Candle metadata of the funding subscription, see WithBinanceFutureFundingMetadata
+const (
+	MetadataFundingRate     = "funding_rate"
+	MetadataNextFundingTime = "next_funding_time"
+	MetadataMarkPrice       = "mark_price"
+)
+
+// WithBinanceFutureFundingMetadata will subscribe to the mark price stream of each pair with candle
+// subscriptions, and include the predicted funding rate, the time of the next funding (unix seconds) and
+// the mark price in the metadata of complete candles
+func WithBinanceFutureFundingMetadata() BinanceFutureOption {
+	return func(b *BinanceFuture) {
+		b.FundingMetadata = true
+	}
+}
+
+// FundingRate returns the last settled funding rate of a pair and the predicted rate of the next funding
+func (b *BinanceFuture) FundingRate(ctx context.Context, pair string) (model.FundingRate, error) {
+	indexes, err := b.client.NewPremiumIndexService().Symbol(pair).Do(ctx)
+	if err != nil {
+		return model.FundingRate{}, err
+	}
+
+	if len(indexes) == 0 {
+		return model.FundingRate{}, fmt.Errorf("%w: %s", ErrInvalidAsset, pair)
+	}
+
+	funding := model.FundingRate{
+		Pair:            pair,
+		NextFundingTime: time.UnixMilli(indexes[0].NextFundingTime),
+	}
+	funding.PredictedRate, err = strconv.ParseFloat(indexes[0].LastFundingRate, 64)
+	if err != nil {
+		return model.FundingRate{}, err
+	}
+	funding.MarkPrice, err = strconv.ParseFloat(indexes[0].MarkPrice, 64)
+	if err != nil {
+		return model.FundingRate{}, err
+	}
+
+	history, err := b.client.NewFundingRateService().Symbol(pair).Limit(1).Do(ctx)
+	if err != nil {
+		return model.FundingRate{}, err
+	}
+
+	if len(history) > 0 {
+		funding.Time = time.UnixMilli(history[0].FundingTime)
+		funding.Rate, err = strconv.ParseFloat(history[0].FundingRate, 64)
+		if err != nil {
+			return model.FundingRate{}, err
+		}
+	}
+
+	return funding, nil
+}
+
+// binanceFundingLimit is the maximum number of funding rates per request
+const binanceFundingLimit = 1000
+
+// FundingRates returns the settled funding rates of a pair between start and end, sorted by time
+func (b *BinanceFuture) FundingRates(ctx context.Context, pair string, start,
+	end time.Time) ([]model.FundingRate, error) {
+
+	rates := make([]model.FundingRate, 0)
+	for begin := start; !begin.After(end); {
+		history, err := b.client.NewFundingRateService().
+			Symbol(pair).
+			StartTime(begin.UnixMilli()).
+			EndTime(end.UnixMilli()).
+			Limit(binanceFundingLimit).
+			Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range history {
+			rate, err := strconv.ParseFloat(item.FundingRate, 64)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, model.FundingRate{
+				Pair: pair,
+				Rate: rate,
+				Time: time.UnixMilli(item.FundingTime),
+			})
+		}
+
+		if len(history) < binanceFundingLimit {
+			break
+		}
+		begin = time.UnixMilli(history[len(history)-1].FundingTime + 1)
+	}
+
+	return rates, nil
+}
+
+// MarkPriceCandlesByPeriod returns the candles of the mark price of a period, which triggers liquidations
+// and settles the funding, without volume
+func (b *BinanceFuture) MarkPriceCandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	candles := make([]model.Candle, 0)
+	for !start.After(end) {
+		data, err := b.client.NewMarkPriceKlinesService().Symbol(pair).
+			Interval(period).
+			StartTime(start.UnixMilli()).
+			EndTime(end.UnixMilli()).
+			Limit(binanceFutureKlineLimit).
+			Do(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range data {
+			candles = append(candles, FutureCandleFromKline(pair, *d))
+		}
+
+		if len(data) < binanceFutureKlineLimit {
+			break
+		}
+		start = time.UnixMilli(data[len(data)-1].OpenTime + 1)
+	}
+
+	return candles, nil
+}
+
+// markPriceServe subscribes to the mark price stream of a pair, using the custom stream endpoint when
+// configured
+func (b *BinanceFuture) markPriceServe(pair string, handler futures.WsMarkPriceHandler,
+	errHandler futures.ErrHandler) (doneC, stopC chan struct{}, err error) {
+
+	if b.StreamEndpoint == "" {
+		return futures.WsMarkPriceServe(pair, handler, errHandler)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s@markPrice", b.StreamEndpoint, strings.ToLower(pair))
+	return wsServeDialer(b.dialer, endpoint, func(message []byte) {
+		event := new(futures.WsMarkPriceEvent)
+		if err := json.Unmarshal(message, event); err != nil {
+			errHandler(err)
+			return
+		}
+		handler(event)
+	}, errHandler)
+}
+
+// markPriceStream sends the events of the mark price stream of a pair to the handler, reconnecting with
+// backoff until the context is done
+func (b *BinanceFuture) markPriceStream(ctx context.Context, pair string, handler futures.WsMarkPriceHandler,
+	errHandler futures.ErrHandler) {
+
+	ba := &backoff.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 1 * time.Second,
+	}
+
+	for {
+		done, stop, err := b.markPriceServe(pair, func(event *futures.WsMarkPriceEvent) {
+			ba.Reset()
+			handler(event)
+		}, errHandler)
+		if err != nil {
+			errHandler(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ba.Duration()):
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// wait for the stream handlers before returning
+			close(stop)
+			<-done
+			return
+		case <-done:
+			time.Sleep(ba.Duration())
+		}
+	}
+}
+
+// MarkPriceSubscription returns the mark and index prices of a pair, which trigger stops and liquidations
+// on Binance futures instead of the last trade price
+func (b *BinanceFuture) MarkPriceSubscription(ctx context.Context, pair string) (chan model.MarkPrice, chan error) {
+	cprice := make(chan model.MarkPrice)
+	cerr := make(chan error)
+
+	go func() {
+		b.markPriceStream(ctx, pair, func(event *futures.WsMarkPriceEvent) {
+			price := model.MarkPrice{Pair: pair, Time: time.UnixMilli(event.Time)}
+			var err error
+			if price.Mark, err = strconv.ParseFloat(event.MarkPrice, 64); err == nil {
+				price.Index, err = strconv.ParseFloat(event.IndexPrice, 64)
+			}
+			if err != nil {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			select {
+			case cprice <- price:
+			case <-ctx.Done():
+			}
+		}, func(err error) {
+			select {
+			case cerr <- err:
+			case <-ctx.Done():
+			}
+		})
+		close(cerr)
+		close(cprice)
+	}()
+
+	return cprice, cerr
+}
+
+// fundingSubscription keeps the last funding of a pair from the mark price stream, until the context is done
+func (b *BinanceFuture) fundingSubscription(ctx context.Context, pair string) {
+	b.markPriceStream(ctx, pair, func(event *futures.WsMarkPriceEvent) {
+		funding := model.FundingRate{
+			Pair:            pair,
+			NextFundingTime: time.UnixMilli(event.NextFundingTime),
+		}
+		funding.PredictedRate, _ = strconv.ParseFloat(event.FundingRate, 64)
+		funding.MarkPrice, _ = strconv.ParseFloat(event.MarkPrice, 64)
+
+		b.fundingMtx.Lock()
+		b.funding[pair] = funding
+		b.fundingMtx.Unlock()
+	}, func(err error) {})
+}
+
+// fundingMetadata includes the last funding of the pair in the candle metadata
+func (b *BinanceFuture) fundingMetadata(candle *model.Candle) {
+	b.fundingMtx.Lock()
+	funding, ok := b.funding[candle.Pair]
+	b.fundingMtx.Unlock()
+	if !ok {
+		return
+	}
+
+	if candle.Metadata == nil {
+		candle.Metadata = make(map[string]float64)
+	}
+	candle.Metadata[MetadataFundingRate] = funding.PredictedRate
+	candle.Metadata[MetadataNextFundingTime] = float64(funding.NextFundingTime.Unix())
+	candle.Metadata[MetadataMarkPrice] = funding.MarkPrice
+}
@@ -0,0 +1,854 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+type binanceFutureServer struct {
+	*httptest.Server
+	mtx         sync.Mutex
+	dualSide    string
+	multiAssets string
+	orders      []url.Values
+	assets      string
+	positions   string
+	symbols     string
+
+	// timeOffset is the server clock minus the local clock, in milliseconds
+	timeOffset int64
+	rejected   int
+	klines     int
+}
+
+func (s *binanceFutureServer) lastOrder() url.Values {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.orders[len(s.orders)-1]
+}
+
+func newTestBinanceFuture(t *testing.T, options ...BinanceFutureOption) (*BinanceFuture, *binanceFutureServer) {
+	t.Helper()
+
+	server := &binanceFutureServer{dualSide: "false", multiAssets: "false", positions: "[]",
+		assets: `[{"asset":"USDT","availableBalance":"1000","positionInitialMargin":"10"}]`,
+		symbols: `[{"symbol":"BTCUSDT","baseAsset":"BTC","quoteAsset":"USDT",
+			"pricePrecision":2,"quantityPrecision":3,"baseAssetPrecision":3,"filters":[
+			{"filterType":"LOT_SIZE","minQty":"0.001","maxQty":"1000","stepSize":"0.001"},
+			{"filterType":"PRICE_FILTER","minPrice":"0.1","maxPrice":"1000000","tickSize":"0.1"}]}]`}
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fapi/v1/ping", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("/fapi/v1/exchangeInfo", func(w http.ResponseWriter, r *http.Request) {
+		server.mtx.Lock()
+		defer server.mtx.Unlock()
+		_, _ = w.Write([]byte(`{"symbols":` + server.symbols + `}`))
+	})
+	mux.HandleFunc("/fapi/v1/positionSide/dual", func(w http.ResponseWriter, r *http.Request) {
+		server.mtx.Lock()
+		defer server.mtx.Unlock()
+
+		if r.Method == http.MethodPost {
+			require.NoError(t, r.ParseForm())
+			if r.Form.Get("dualSidePosition") == server.dualSide {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"code":-4059,"msg":"No need to change position side."}`))
+				return
+			}
+			server.dualSide = r.Form.Get("dualSidePosition")
+			_, _ = w.Write([]byte(`{"code":200,"msg":"success"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"dualSidePosition":` + server.dualSide + `}`))
+	})
+	klines := func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		start, err := strconv.ParseInt(query.Get("startTime"), 10, 64)
+		require.NoError(t, err)
+		end, err := strconv.ParseInt(query.Get("endTime"), 10, 64)
+		require.NoError(t, err)
+		limit, err := strconv.Atoi(query.Get("limit"))
+		require.NoError(t, err)
+
+		server.mtx.Lock()
+		server.klines++
+		server.mtx.Unlock()
+
+		// one candle per minute, with the minute as close price
+		klines := make([][]interface{}, 0)
+		first := (start + time.Minute.Milliseconds() - 1) / time.Minute.Milliseconds()
+		for minute := first; minute*time.Minute.Milliseconds() <= end && len(klines) < limit; minute++ {
+			openTime := minute * time.Minute.Milliseconds()
+			klines = append(klines, []interface{}{openTime, "1", "1", "1", strconv.FormatInt(minute, 10), "1",
+				openTime + time.Minute.Milliseconds() - 1, "1", 1, "1", "1", "0"})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(klines))
+	}
+	mux.HandleFunc("/fapi/v1/klines", klines)
+	mux.HandleFunc("/fapi/v1/markPriceKlines", klines)
+	mux.HandleFunc("/fapi/v1/time", func(w http.ResponseWriter, r *http.Request) {
+		server.mtx.Lock()
+		defer server.mtx.Unlock()
+		_, _ = fmt.Fprintf(w, `{"serverTime":%d}`, time.Now().UnixMilli()+server.timeOffset)
+	})
+	mux.HandleFunc("/fapi/v1/order", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+
+		// requests are valid within 5s of the server time, by default
+		timestamp, err := strconv.ParseInt(r.Form.Get("timestamp"), 10, 64)
+		require.NoError(t, err)
+		server.mtx.Lock()
+		delay := time.Now().UnixMilli() + server.timeOffset - timestamp
+		if delay < -1000 || delay > 5000 {
+			server.rejected++
+			server.mtx.Unlock()
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":-1021,"msg":"Timestamp for this request is outside of the recvWindow."}`))
+			return
+		}
+		server.mtx.Unlock()
+		if r.Method == http.MethodDelete {
+			// parameters of canceled orders are sent in the body, which is not parsed for DELETE requests
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			values, err := url.ParseQuery(string(body))
+			require.NoError(t, err)
+			for key, value := range values {
+				r.Form[key] = value
+			}
+		}
+		server.mtx.Lock()
+		server.orders = append(server.orders, r.Form)
+		server.mtx.Unlock()
+
+		if r.Method == http.MethodPut {
+			_, _ = w.Write([]byte(`{"symbol":"BTCUSDT","orderId":` + r.Form.Get("orderId") + `,"price":"` +
+				r.Form.Get("price") + `","origQty":"` + r.Form.Get("quantity") + `","executedQty":"0",
+				"cumQuote":"0","status":"NEW","type":"LIMIT","side":"` + r.Form.Get("side") + `"}`))
+			return
+		}
+
+		// post only orders with price 50 would take liquidity
+		if r.Form.Get("timeInForce") == "GTX" && r.Form.Get("price") == "50" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":-5022,"msg":"Due to the order could not be executed as maker,` +
+				` the Post Only order will be rejected."}`))
+			return
+		}
+
+		positionSide := r.Form.Get("positionSide")
+		if positionSide == "" {
+			positionSide = "BOTH"
+		}
+		_, _ = w.Write([]byte(`{"symbol":"BTCUSDT","orderId":1,"price":"0","origQty":"` + r.Form.Get("quantity") +
+			`","executedQty":"` + r.Form.Get("quantity") + `","cumQuote":"100","status":"FILLED",
+			"type":"` + r.Form.Get("type") + `","side":"` + r.Form.Get("side") + `",
+			"positionSide":"` + positionSide + `","updateTime":1640995200000}`))
+	})
+	mux.HandleFunc("/fapi/v2/account", func(w http.ResponseWriter, r *http.Request) {
+		server.mtx.Lock()
+		defer server.mtx.Unlock()
+		_, _ = w.Write([]byte(`{"availableBalance":"1000","multiAssetsMargin":` + server.multiAssets +
+			`,"assets":` + server.assets + `,"positions":` + server.positions + `}`))
+	})
+	mux.HandleFunc("/fapi/v1/multiAssetsMargin", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		server.mtx.Lock()
+		defer server.mtx.Unlock()
+
+		if r.Form.Get("multiAssetsMargin") == server.multiAssets {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"code":-4171,"msg":"Adjusted asset mode is currently set."}`))
+			return
+		}
+		server.multiAssets = r.Form.Get("multiAssetsMargin")
+		_, _ = w.Write([]byte(`{"code":200,"msg":"success"}`))
+	})
+	mux.HandleFunc("/fapi/v1/batchOrders", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		var requests []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(r.Form.Get("batchOrders")), &requests))
+
+		response := make([]map[string]interface{}, 0, len(requests))
+		for i, request := range requests {
+			values := url.Values{}
+			for key, value := range request {
+				values.Set(key, fmt.Sprint(value))
+			}
+			server.mtx.Lock()
+			server.orders = append(server.orders, values)
+			server.mtx.Unlock()
+
+			// orders with price or stop price 50 are rejected
+			if request["price"] == "50" || request["stopPrice"] == "50" {
+				response = append(response, map[string]interface{}{"code": -2019, "msg": "Margin is insufficient."})
+				continue
+			}
+			response = append(response, map[string]interface{}{
+				"symbol": request["symbol"], "orderId": i + 1, "clientOrderId": request["newClientOrderId"],
+				"price": request["price"], "origQty": request["quantity"], "executedQty": "0", "cumQuote": "0",
+				"status": "NEW", "type": request["type"], "side": request["side"],
+			})
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(response))
+	})
+	mux.HandleFunc("/fapi/v2/positionRisk", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+		_, _ = w.Write([]byte(`[
+			{"symbol":"BTCUSDT","positionSide":"LONG","positionAmt":"0.3","entryPrice":"100","markPrice":"110",
+			"liquidationPrice":"60","unRealizedProfit":"3","leverage":"10","isolatedMargin":"0"},
+			{"symbol":"BTCUSDT","positionSide":"SHORT","positionAmt":"-0.1","entryPrice":"120","markPrice":"110",
+			"liquidationPrice":"200","unRealizedProfit":"1","leverage":"10","isolatedMargin":"1.5"}]`))
+	})
+	mux.HandleFunc("/fapi/v1/premiumIndex", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+		_, _ = w.Write([]byte(`{"symbol":"BTCUSDT","markPrice":"100.5","lastFundingRate":"0.0002",
+			"nextFundingTime":1641024000000,"time":1640995200000}`))
+	})
+	mux.HandleFunc("/fapi/v1/fundingRate", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Has("startTime") {
+			// one funding every 8 hours, from the first funding after the start
+			start, err := strconv.ParseInt(query.Get("startTime"), 10, 64)
+			require.NoError(t, err)
+			end, err := strconv.ParseInt(query.Get("endTime"), 10, 64)
+			require.NoError(t, err)
+			limit, err := strconv.Atoi(query.Get("limit"))
+			require.NoError(t, err)
+
+			period := (8 * time.Hour).Milliseconds()
+			rates := make([]map[string]interface{}, 0)
+			first := (start + period - 1) / period * period
+			for fundingTime := first; fundingTime <= end && len(rates) < limit; fundingTime += period {
+				rates = append(rates, map[string]interface{}{"symbol": "BTCUSDT", "fundingRate": "0.0001",
+					"fundingTime": fundingTime})
+			}
+			require.NoError(t, json.NewEncoder(w).Encode(rates))
+			return
+		}
+		require.Equal(t, "1", query.Get("limit"))
+		_, _ = w.Write([]byte(`[{"symbol":"BTCUSDT","fundingRate":"0.0001","fundingTime":1640995200000}]`))
+	})
+	mux.HandleFunc("/ws/btcusdt@markPrice", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"markPriceUpdate","E":1640995200000,
+			"s":"BTCUSDT","p":"101.5","i":"101.4","P":"101.6","r":"-0.0003","T":1641024000000}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/ws/btcusdt@depth5@100ms", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"depthUpdate","E":1640995200000,
+			"T":1640995199999,"s":"BTCUSDT","U":157,"u":160,"pu":149,"b":[["100.5","2"],["100.4","1"],
+			["100.3","4"]],"a":[["100.6","3"],["100.7","0.5"],["100.8","1"]]}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/ws/btcusdt@aggTrade", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"aggTrade","E":1640995200001,"s":"BTCUSDT",
+			"a":5933014,"p":"100.5","q":"0.2","f":100,"l":105,"T":1640995200000,"m":true}`))
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"aggTrade","E":1640995200002,"s":"BTCUSDT",
+			"a":5933015,"p":"100.6","q":"1.5","f":106,"l":106,"T":1640995200001,"m":false}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/ws/btcusdt@bookTicker", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"bookTicker","u":400900217,"E":1640995200001,
+			"T":1640995200000,"s":"BTCUSDT","b":"99.9","B":"31.2","a":"100.1","A":"40.6"}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/fapi/v1/listenKey", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"listenKey":"listen-key"}`))
+	})
+	mux.HandleFunc("/ws/listen-key", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"ACCOUNT_UPDATE","E":1640995200000}`))
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"ORDER_TRADE_UPDATE","E":1640995200000,
+			"T":1640995200000,"o":{"s":"BTCUSDT","S":"SELL","o":"STOP_MARKET","q":"0.5","p":"0","ap":"99.5",
+			"sp":"100","X":"FILLED","i":2,"z":"0.5","T":1640995200000,"ps":"BOTH"}}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/ws/btcusdt@kline_1m", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"e":"kline","E":1640995260000,"s":"BTCUSDT",
+			"k":{"t":1640995200000,"T":1640995259999,"s":"BTCUSDT","i":"1m","o":"100","c":"101","h":"102",
+			"l":"99","v":"10","x":true}}`))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	stream := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	options = append([]BinanceFutureOption{
+		WithBinanceFutureCredentials("key", "secret"),
+		WithBinanceFutureEndpoint(server.URL, stream),
+	}, options...)
+
+	binance, err := NewBinanceFuture(context.Background(), options...)
+	require.NoError(t, err)
+	return binance, server
+}
+
+func TestBinanceFuture_Endpoint(t *testing.T) {
+	// custom endpoints have priority over the testnet
+	binance, _ := newTestBinanceFuture(t, WithBinanceFutureTestnet())
+	require.True(t, binance.Testnet)
+	require.Equal(t, "BTC", binance.AssetsInfo("BTCUSDT").BaseAsset)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	candles, _ := binance.CandlesSubscription(ctx, "BTCUSDT", "1m")
+	candle := <-candles
+	require.True(t, candle.Complete)
+	require.Equal(t, 101.0, candle.Close)
+	require.Equal(t, "BTCUSDT", candle.Pair)
+}
+
+func TestBinanceFuture_HedgeMode(t *testing.T) {
+	t.Run("one-way mode", func(t *testing.T) {
+		binance, server := newTestBinanceFuture(t)
+		require.False(t, binance.HedgeMode)
+
+		_, err := binance.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, true)
+		require.NoError(t, err)
+		require.Equal(t, "true", server.lastOrder().Get("reduceOnly"))
+		require.Empty(t, server.lastOrder().Get("positionSide"))
+	})
+
+	t.Run("detect account mode", func(t *testing.T) {
+		binance, server := newTestBinanceFuture(t, WithBinanceFuturePositionMode(true))
+		require.True(t, binance.HedgeMode)
+		require.Equal(t, "true", server.dualSide)
+
+		binance, err := NewBinanceFuture(context.Background(),
+			WithBinanceFutureCredentials("key", "secret"),
+			WithBinanceFutureEndpoint(server.URL, ""))
+		require.NoError(t, err)
+		require.True(t, binance.HedgeMode)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		binance, server := newTestBinanceFuture(t, WithBinanceFuturePositionMode(true))
+
+		tt := []struct {
+			name     string
+			create   func() (model.Order, error)
+			expected model.PositionSideType
+		}{
+			{"open long", func() (model.Order, error) {
+				return binance.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+			}, model.PositionSideTypeLong},
+			{"open short", func() (model.Order, error) {
+				return binance.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 100)
+			}, model.PositionSideTypeShort},
+			{"close long", func() (model.Order, error) {
+				return binance.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, true)
+			}, model.PositionSideTypeLong},
+			{"close short", func() (model.Order, error) {
+				return binance.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, true)
+			}, model.PositionSideTypeShort},
+			{"stop long", func() (model.Order, error) {
+				return binance.CreateOrderStop("BTCUSDT", 1, 90)
+			}, model.PositionSideTypeLong},
+			{"stop short", func() (model.Order, error) {
+				return binance.CreateOrderStop("BTCUSDT", 1, -110)
+			}, model.PositionSideTypeShort},
+			{"take profit short", func() (model.Order, error) {
+				return binance.TakeProfit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+			}, model.PositionSideTypeShort},
+		}
+
+		for _, tc := range tt {
+			t.Run(tc.name, func(t *testing.T) {
+				order, err := tc.create()
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, order.PositionSide)
+				require.Equal(t, string(tc.expected), server.lastOrder().Get("positionSide"))
+				require.Empty(t, server.lastOrder().Get("reduceOnly"))
+			})
+		}
+	})
+
+	t.Run("positions", func(t *testing.T) {
+		binance, server := newTestBinanceFuture(t, WithBinanceFuturePositionMode(true))
+		server.positions = `[
+			{"symbol":"BTCUSDT","positionSide":"LONG","positionAmt":"0.5","leverage":"10"},
+			{"symbol":"BTCUSDT","positionSide":"SHORT","positionAmt":"-0.2","leverage":"10"}]`
+
+		long, short, err := binance.PositionSides("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.5, long)
+		require.Equal(t, -0.2, short)
+
+		asset, quote, err := binance.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.InDelta(t, 0.3, asset, 1e-9)
+		require.Equal(t, 1000.0, quote)
+
+		risk, err := binance.PositionRisk("BTCUSDT")
+		require.NoError(t, err)
+		require.InDelta(t, 0.2, risk.Size, 1e-9)
+		require.InDelta(t, 105.0, risk.EntryPrice, 1e-9)
+		require.Equal(t, 110.0, risk.MarkPrice)
+		require.Equal(t, 60.0, risk.LiquidationPrice)
+		require.Equal(t, 4.0, risk.UnrealizedPnL)
+		require.InDelta(t, 4.8, risk.Margin, 1e-9) // 0.3 * 110 / 10 + 1.5
+		require.Equal(t, 10.0, risk.Leverage)
+	})
+}
+
+func TestBinanceFuture_FundingRate(t *testing.T) {
+	binance, _ := newTestBinanceFuture(t, WithBinanceFutureFundingMetadata())
+
+	funding, err := binance.FundingRate(context.Background(), "BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, "BTCUSDT", funding.Pair)
+	require.Equal(t, 0.0001, funding.Rate)
+	require.Equal(t, time.UnixMilli(1640995200000), funding.Time)
+	require.Equal(t, 0.0002, funding.PredictedRate)
+	require.Equal(t, time.UnixMilli(1641024000000), funding.NextFundingTime)
+	require.Equal(t, 100.5, funding.MarkPrice)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go binance.fundingSubscription(ctx, "BTCUSDT")
+
+	candle := model.Candle{Pair: "BTCUSDT", Complete: true}
+	require.Eventually(t, func() bool {
+		binance.fundingMetadata(&candle)
+		return candle.Metadata != nil
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, -0.0003, candle.Metadata[MetadataFundingRate])
+	require.Equal(t, 1641024000.0, candle.Metadata[MetadataNextFundingTime])
+	require.Equal(t, 101.5, candle.Metadata[MetadataMarkPrice])
+}
+
+func TestBinanceFuture_FundingRates(t *testing.T) {
+	binance, _ := newTestBinanceFuture(t)
+
+	// requests are paginated by the limit of the exchange
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(time.Duration(binanceFundingLimit+10) * 8 * time.Hour)
+	rates, err := binance.FundingRates(context.Background(), "BTCUSDT", start, end)
+	require.NoError(t, err)
+	require.Len(t, rates, binanceFundingLimit+11)
+	require.Equal(t, start, rates[0].Time.UTC())
+	require.Equal(t, end, rates[len(rates)-1].Time.UTC())
+	require.Equal(t, 0.0001, rates[0].Rate)
+	require.Equal(t, "BTCUSDT", rates[0].Pair)
+}
+
+func TestBinanceFuture_MarkPriceSubscription(t *testing.T) {
+	binance, _ := newTestBinanceFuture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	prices, errs := binance.MarkPriceSubscription(ctx, "BTCUSDT")
+
+	price := <-prices
+	require.Equal(t, "BTCUSDT", price.Pair)
+	require.Equal(t, 101.5, price.Mark)
+	require.Equal(t, 101.4, price.Index)
+	require.Equal(t, time.UnixMilli(1640995200000), price.Time)
+
+	// channels are closed after the context is done
+	cancel()
+	for range errs {
+	}
+	_, ok := <-prices
+	require.False(t, ok)
+}
+
+func TestBinanceFuture_CreateOrdersBatch(t *testing.T) {
+	binance, server := newTestBinanceFuture(t)
+
+	_, err := binance.CreateOrdersBatch(nil)
+	require.ErrorIs(t, err, ErrInvalidBatch)
+	_, err = binance.CreateOrdersBatch(make([]model.OrderRequest, MaxBatchOrders+1))
+	require.ErrorIs(t, err, ErrInvalidBatch)
+
+	_, err = binance.CreateOrdersBatch([]model.OrderRequest{
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeLimitMaker, Quantity: 1, Price: 100},
+	})
+	require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+	orders, err := binance.CreateOrdersBatch([]model.OrderRequest{
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeLimit, Quantity: 1, Price: 100.05},
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeLimit, Quantity: 0.5, Price: 90},
+		{Pair: "BTCUSDT", Side: model.SideTypeSell, Type: model.OrderTypeStopLoss, Quantity: 1.5, Stop: 80,
+			ReduceOnly: true},
+	})
+	require.NoError(t, err)
+	require.Len(t, orders, 3)
+	require.Equal(t, 100.0, orders[0].Price)
+	require.Equal(t, 0.5, orders[1].Quantity)
+	require.Equal(t, model.OrderType("STOP_MARKET"), orders[2].Type)
+	require.Equal(t, "80", server.lastOrder().Get("stopPrice"))
+	require.Equal(t, "true", server.lastOrder().Get("reduceOnly"))
+
+	// rejected orders are reported, created orders are returned
+	orders, err = binance.CreateOrdersBatch([]model.OrderRequest{
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeLimit, Quantity: 1, Price: 50},
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeLimit, Quantity: 1, Price: 60},
+	})
+	require.ErrorIs(t, err, ErrBatchRejected)
+	require.Len(t, orders, 1)
+	require.Equal(t, 60.0, orders[0].Price)
+}
+
+func TestBinanceFuture_ModifyOrder(t *testing.T) {
+	binance, server := newTestBinanceFuture(t)
+
+	t.Run("limit order", func(t *testing.T) {
+		order := model.Order{ExchangeID: 42, Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Type: model.OrderTypeLimit, Price: 100, Quantity: 1}
+		modified, err := binance.ModifyOrder(order, 95.55, 0)
+		require.NoError(t, err)
+		require.Equal(t, int64(42), modified.ExchangeID)
+		require.Equal(t, 95.5, modified.Price)
+		require.Equal(t, 1.0, modified.Quantity)
+		require.Equal(t, model.OrderStatusTypeNew, modified.Status)
+
+		values := server.lastOrder()
+		require.Equal(t, "42", values.Get("orderId"))
+		require.Equal(t, "BUY", values.Get("side"))
+		require.Equal(t, "95.5", values.Get("price"))
+		require.Equal(t, "1", values.Get("quantity"))
+		require.NotEmpty(t, values.Get("signature"))
+	})
+
+	t.Run("stop order is replaced", func(t *testing.T) {
+		stop := 90.0
+		order := model.Order{ExchangeID: 7, Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: "STOP_MARKET", Quantity: 0.5, Stop: &stop}
+		_, err := binance.ModifyOrder(order, 85, 0)
+		require.NoError(t, err)
+
+		values := server.lastOrder()
+		require.Equal(t, "STOP_MARKET", values.Get("type"))
+		require.Equal(t, "SELL", values.Get("side"))
+		require.Equal(t, "85", values.Get("stopPrice"))
+		require.Equal(t, "0.5", values.Get("quantity"))
+	})
+}
+
+func TestBinanceFuture_CreateOrderLimitTIF(t *testing.T) {
+	binance, server := newTestBinanceFuture(t)
+
+	_, err := binance.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 100, model.TimeInForceIOC)
+	require.NoError(t, err)
+	require.Equal(t, "IOC", server.lastOrder().Get("timeInForce"))
+
+	_, err = binance.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 100)
+	require.NoError(t, err)
+	require.Equal(t, "GTC", server.lastOrder().Get("timeInForce"))
+
+	_, err = binance.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 50, model.TimeInForceGTX)
+	require.ErrorIs(t, err, ErrPostOnlyRejected)
+	var orderError *OrderError
+	require.ErrorAs(t, err, &orderError)
+	require.Equal(t, "BTCUSDT", orderError.Pair)
+	require.Equal(t, 1.0, orderError.Quantity)
+}
+
+func TestBinanceFuture_CreateOrderOCO(t *testing.T) {
+	binance, server := newTestBinanceFuture(t)
+	require.True(t, binance.EmulatedOCO("BTCUSDT"))
+
+	orders, err := binance.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 0.5, 110, 90, 0)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	require.Equal(t, model.OrderType("TAKE_PROFIT_MARKET"), orders[0].Type)
+	require.Equal(t, model.OrderType("STOP_MARKET"), orders[1].Type)
+	require.NotNil(t, orders[0].GroupID)
+	require.Equal(t, orders[0].GroupID, orders[1].GroupID)
+
+	server.mtx.Lock()
+	legs := server.orders[len(server.orders)-2:]
+	server.mtx.Unlock()
+	require.Equal(t, "110", legs[0].Get("stopPrice"))
+	require.Equal(t, "90", legs[1].Get("stopPrice"))
+	for _, leg := range legs {
+		require.Equal(t, "SELL", leg.Get("side"))
+		require.Equal(t, "0.5", leg.Get("quantity"))
+		require.Equal(t, "true", leg.Get("reduceOnly"))
+	}
+
+	// the placed leg is canceled when the other is rejected
+	_, err = binance.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 0.5, 110, 50, 0)
+	require.ErrorIs(t, err, ErrBatchRejected)
+	require.Equal(t, "1", server.lastOrder().Get("orderId"))
+}
+
+func TestBinanceFuture_AccountSubscription(t *testing.T) {
+	binance, _ := newTestBinanceFuture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	orders, _ := binance.AccountSubscription(ctx)
+	select {
+	case order := <-orders:
+		require.Equal(t, int64(2), order.ExchangeID)
+		require.Equal(t, "BTCUSDT", order.Pair)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 99.5, order.Price)
+		require.Equal(t, 0.5, order.Quantity)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "order update not received")
+	}
+}
+
+func TestBinanceFuture_MultiAssetsMargin(t *testing.T) {
+	binance, server := newTestBinanceFuture(t, WithBinanceFutureMultiAssetsMargin())
+	require.Equal(t, "true", server.multiAssets)
+
+	// the mode is already set
+	_, err := NewBinanceFuture(context.Background(), WithBinanceFutureCredentials("key", "secret"),
+		WithBinanceFutureEndpoint(server.URL, ""), WithBinanceFutureMultiAssetsMargin())
+	require.NoError(t, err)
+
+	// each asset reports the shared available margin, which is the available of the account
+	server.mtx.Lock()
+	server.assets = `[
+		{"asset":"USDT","walletBalance":"500","initialMargin":"20","availableBalance":"2500"},
+		{"asset":"BNB","walletBalance":"10","initialMargin":"0","availableBalance":"8.3"},
+		{"asset":"BTC","walletBalance":"0.1","initialMargin":"0","availableBalance":"0.04"},
+		{"asset":"ETH","walletBalance":"0","initialMargin":"0","availableBalance":"1.2"}]`
+	server.positions = `[{"symbol":"BTCUSDT","positionSide":"BOTH","positionAmt":"0.2","leverage":"10"}]`
+	server.mtx.Unlock()
+
+	account, err := binance.Account()
+	require.NoError(t, err)
+	require.Equal(t, 1000.0, account.Available)
+	require.ElementsMatch(t, []model.Balance{
+		{Asset: "BTC", Free: 0.2, Leverage: 10},
+		{Asset: "USDT", Free: 480, Lock: 20},
+		{Asset: "BNB", Free: 10},
+	}, account.Balances)
+}
+
+func TestBinanceFuture_TimeSync(t *testing.T) {
+	binance, server := newTestBinanceFuture(t, WithBinanceFutureRecvWindow(10*time.Second))
+	require.InDelta(t, 0, binance.signer.Offset().Milliseconds(), 1000)
+
+	// the server clock drifts, the rejected order is retried after synchronizing the time
+	server.mtx.Lock()
+	server.timeOffset = 60000
+	server.mtx.Unlock()
+
+	order, err := binance.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.Equal(t, 1, server.rejected)
+	require.Equal(t, "10000", server.lastOrder().Get("recvWindow"))
+	require.InDelta(t, 60000, binance.signer.Offset().Milliseconds(), 1000)
+}
+
+func TestBinanceFuture_AssetsRefresh(t *testing.T) {
+	binance, server := newTestBinanceFuture(t, WithBinanceFutureAssetsRefresh(50*time.Millisecond))
+	require.Equal(t, 0.1, binance.AssetsInfo("BTCUSDT").TickSize)
+	require.Empty(t, binance.AssetsInfo("ETHUSDT").BaseAsset)
+
+	// the exchange adjusts the tick size of a pair and lists a new pair
+	server.mtx.Lock()
+	server.symbols = `[{"symbol":"BTCUSDT","baseAsset":"BTC","quoteAsset":"USDT","baseAssetPrecision":3,"filters":[
+		{"filterType":"LOT_SIZE","minQty":"0.001","maxQty":"1000","stepSize":"0.001"},
+		{"filterType":"PRICE_FILTER","minPrice":"0.01","maxPrice":"1000000","tickSize":"0.01"}]},
+		{"symbol":"ETHUSDT","baseAsset":"ETH","quoteAsset":"USDT","baseAssetPrecision":3,"filters":[]}]`
+	server.mtx.Unlock()
+
+	require.Eventually(t, func() bool {
+		return binance.AssetsInfo("BTCUSDT").TickSize == 0.01
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, "ETH", binance.AssetsInfo("ETHUSDT").BaseAsset)
+	require.Equal(t, "101.25", binance.formatPrice("BTCUSDT", 101.25))
+}
+
+func TestBinanceFuture_AssetsReloadUnknownPair(t *testing.T) {
+	binance, server := newTestBinanceFuture(t, WithBinanceFutureAssetsRefresh(time.Hour))
+
+	server.mtx.Lock()
+	server.symbols = `[{"symbol":"ETHUSDT","baseAsset":"ETH","quoteAsset":"USDT","baseAssetPrecision":3,"filters":[]}]`
+	server.mtx.Unlock()
+
+	// unknown pairs reload the exchange info at most once per minute
+	_, ok := binance.assetInfo("ETHUSDT")
+	require.False(t, ok)
+
+	binance.assetsMtx.Lock()
+	binance.assetsLoadedAt = time.Now().Add(-assetsMissInterval)
+	binance.assetsMtx.Unlock()
+
+	info, ok := binance.assetInfo("ETHUSDT")
+	require.True(t, ok)
+	require.Equal(t, "ETH", info.BaseAsset)
+}
+
+func TestBinanceFuture_CandlesByPeriod(t *testing.T) {
+	binance, server := newTestBinanceFuture(t)
+
+	// two days of 1m candles are fetched in two pages of 1500 candles
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48*time.Hour - time.Minute)
+	candles, err := binance.CandlesByPeriod(context.Background(), "BTCUSDT", "1m", start, end)
+	require.NoError(t, err)
+	require.Len(t, candles, 2880)
+	require.Equal(t, 2, server.klines)
+	for i, candle := range candles {
+		require.Equal(t, start.Add(time.Duration(i)*time.Minute), candle.Time.UTC())
+	}
+}
+
+func TestBinanceFuture_MarkPriceCandlesByPeriod(t *testing.T) {
+	binance, server := newTestBinanceFuture(t)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(48*time.Hour - time.Minute)
+	candles, err := binance.MarkPriceCandlesByPeriod(context.Background(), "BTCUSDT", "1m", start, end)
+	require.NoError(t, err)
+	require.Len(t, candles, 2880)
+	require.Equal(t, 2, server.klines)
+	require.Equal(t, start, candles[0].Time.UTC())
+	require.Equal(t, float64(start.Unix()/60), candles[0].Close)
+	require.Equal(t, end, candles[len(candles)-1].Time.UTC())
+}
+
+func TestBinanceFuture_DepthSubscription(t *testing.T) {
+	binance, _ := newTestBinanceFuture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	books, errs := binance.DepthSubscription(ctx, "BTCUSDT", 2)
+
+	book := <-books
+	require.Equal(t, model.OrderBook{
+		Pair:     "BTCUSDT",
+		Time:     time.UnixMilli(1640995200000),
+		UpdateID: 160,
+		Bids:     []model.BookLevel{{Price: 100.5, Quantity: 2}, {Price: 100.4, Quantity: 1}},
+		Asks:     []model.BookLevel{{Price: 100.6, Quantity: 3}, {Price: 100.7, Quantity: 0.5}},
+	}, book)
+
+	cancel()
+	for range errs {
+	}
+	_, ok := <-books
+	require.False(t, ok)
+}
+
+func TestBinanceFuture_TradesSubscription(t *testing.T) {
+	binance, _ := newTestBinanceFuture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	trades, errs := binance.TradesSubscription(ctx, "BTCUSDT")
+
+	// trades of buyer makers are sells
+	require.Equal(t, model.Trade{ID: 5933014, Pair: "BTCUSDT", Time: time.UnixMilli(1640995200000), Price: 100.5,
+		Quantity: 0.2, Side: model.SideTypeSell}, <-trades)
+	require.Equal(t, model.Trade{ID: 5933015, Pair: "BTCUSDT", Time: time.UnixMilli(1640995200001), Price: 100.6,
+		Quantity: 1.5, Side: model.SideTypeBuy}, <-trades)
+
+	cancel()
+	for range errs {
+	}
+	_, ok := <-trades
+	require.False(t, ok)
+}
+
+func TestBinanceFuture_QuoteSubscription(t *testing.T) {
+	binance, _ := newTestBinanceFuture(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	quotes, errs := binance.QuoteSubscription(ctx, "BTCUSDT")
+	require.Equal(t, model.Quote{Pair: "BTCUSDT", Time: time.UnixMilli(1640995200000), UpdateID: 400900217,
+		Bid: 99.9, BidQuantity: 31.2, Ask: 100.1, AskQuantity: 40.6}, <-quotes)
+
+	cancel()
+	for range errs {
+	}
+	_, ok := <-quotes
+	require.False(t, ok)
+}
+
+func TestNewBinanceQuote(t *testing.T) {
+	// spot events have no time
+	quote, err := newBinanceQuote("BNBUSDT", []byte(`{"u":400900217,"s":"BNBUSDT","b":"25.35","B":"31.21",
+		"a":"25.36","A":"40.66"}`))
+	require.NoError(t, err)
+	require.Equal(t, 25.35, quote.Bid)
+	require.Equal(t, 40.66, quote.AskQuantity)
+	require.WithinDuration(t, time.Now(), quote.Time, time.Second)
+
+	_, err = newBinanceQuote("BNBUSDT", []byte(`{"b":"invalid"}`))
+	require.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// binanceBookTickerEvent is an event of the book ticker streams. Spot events only have the best levels,
+// while futures events also have the event and transaction times.
+type binanceBookTickerEvent struct {
+	Event       string `json:"e"`
+	EventTime   int64  `json:"E"`
+	Time        int64  `json:"T"`
+	UpdateID    int64  `json:"u"`
+	Symbol      string `json:"s"`
+	Bid         string `json:"b"`
+	BidQuantity string `json:"B"`
+	Ask         string `json:"a"`
+	AskQuantity string `json:"A"`
+}
+
+// newBinanceQuote converts an event of the book ticker streams, spot events are timestamped with the
+// receive time
+func newBinanceQuote(pair string, message []byte) (model.Quote, error) {
+	event := new(binanceBookTickerEvent)
+	if err := json.Unmarshal(message, event); err != nil {
+		return model.Quote{}, err
+	}
+
+	quote := model.Quote{Pair: pair, Time: time.Now(), UpdateID: event.UpdateID}
+	if event.Time > 0 {
+		quote.Time = time.UnixMilli(event.Time)
+	}
+
+	var err error
+	if quote.Bid, err = strconv.ParseFloat(event.Bid, 64); err != nil {
+		return model.Quote{}, err
+	}
+	if quote.BidQuantity, err = strconv.ParseFloat(event.BidQuantity, 64); err != nil {
+		return model.Quote{}, err
+	}
+	if quote.Ask, err = strconv.ParseFloat(event.Ask, 64); err != nil {
+		return model.Quote{}, err
+	}
+	if quote.AskQuantity, err = strconv.ParseFloat(event.AskQuantity, 64); err != nil {
+		return model.Quote{}, err
+	}
+	return quote, nil
+}
+
+// binanceQuoteSubscription streams the best bid and ask of a pair, until the context is done
+func binanceQuoteSubscription(ctx context.Context, dialer *websocket.Dialer, streamEndpoint,
+	pair string) (chan model.Quote, chan error) {
+
+	cquote := make(chan model.Quote)
+	cerr := make(chan error)
+	endpoint := fmt.Sprintf("%s/%s@bookTicker", streamEndpoint, strings.ToLower(pair))
+
+	go func() {
+		defer close(cerr)
+		defer close(cquote)
+
+		binanceStream(ctx, dialer, endpoint, func(message []byte) error {
+			quote, err := newBinanceQuote(pair, message)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case cquote <- quote:
+			case <-ctx.Done():
+			}
+			return nil
+		}, cerr)
+	}()
+
+	return cquote, cerr
+}
+
+// QuoteSubscription streams the best bid and ask of a pair, on every change
+func (b *Binance) QuoteSubscription(ctx context.Context, pair string) (chan model.Quote, chan error) {
+	endpoint := b.StreamEndpoint
+	if endpoint == "" {
+		endpoint = binanceStreamEndpoint
+	}
+	return binanceQuoteSubscription(ctx, b.dialer, endpoint, pair)
+}
+
+// QuoteSubscription streams the best bid and ask of a pair, on every change
+func (b *BinanceFuture) QuoteSubscription(ctx context.Context, pair string) (chan model.Quote, chan error) {
+	endpoint := b.StreamEndpoint
+	if endpoint == "" {
+		endpoint = binanceFutureStreamEndpoint
+	}
+	return binanceQuoteSubscription(ctx, b.dialer, endpoint, pair)
+}
@@ -0,0 +1,55 @@
+package exchange
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jpillora/backoff"
+)
+
+// binanceStream sends the messages of a websocket stream to the handler, reconnecting with backoff until
+// the context is done. Connection and handler errors are sent to the error channel.
+func binanceStream(ctx context.Context, dialer *websocket.Dialer, endpoint string,
+	handler func(message []byte) error, cerr chan<- error) {
+
+	errHandler := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	ba := &backoff.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 1 * time.Second,
+	}
+
+	for {
+		done, stop, err := wsServeDialer(dialer, endpoint, func(message []byte) {
+			ba.Reset()
+			if err := handler(message); err != nil {
+				errHandler(err)
+			}
+		}, errHandler)
+		if err != nil {
+			errHandler(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ba.Duration()):
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// wait for the stream handlers before returning
+			close(stop)
+			<-done
+			return
+		case <-done:
+			time.Sleep(ba.Duration())
+		}
+	}
+}
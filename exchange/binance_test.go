@@ -51,3 +51,20 @@ func TestFormatQuantity(t *testing.T) {
 		})
 	}
 }
+
+func TestNewBinanceOrderBook(t *testing.T) {
+	book, err := newBinanceOrderBook("BTCUSDT", 5, []byte(`{"lastUpdateId":160,
+		"bids":[["0.0024","10"]],"asks":[["0.0026","100"],["0.0027","20"]]}`))
+	require.NoError(t, err)
+	require.Equal(t, "BTCUSDT", book.Pair)
+	require.Equal(t, int64(160), book.UpdateID)
+	require.Equal(t, []model.BookLevel{{Price: 0.0024, Quantity: 10}}, book.Bids)
+	require.Equal(t, []model.BookLevel{{Price: 0.0026, Quantity: 100}, {Price: 0.0027, Quantity: 20}}, book.Asks)
+
+	_, err = newBinanceOrderBook("BTCUSDT", 5, []byte(`{"bids":[["invalid","1"]]}`))
+	require.Error(t, err)
+
+	require.Equal(t, "wss://stream/btcusdt@depth5@100ms", binanceDepthEndpoint("wss://stream", "BTCUSDT", 1))
+	require.Equal(t, "wss://stream/btcusdt@depth20@100ms", binanceDepthEndpoint("wss://stream", "BTCUSDT", 15))
+	require.Equal(t, "wss://stream/btcusdt@depth20@100ms", binanceDepthEndpoint("wss://stream", "BTCUSDT", 100))
+}
@@ -0,0 +1,151 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// ErrInvalidTimestamp is the Binance error code of signed requests outside of the recvWindow,
+// usually caused by clock drift
+const ErrInvalidTimestamp int64 = -1021
+
+// binanceSigner is a http.RoundTripper that signs Binance requests with the server time, instead of the
+// local clock, and a custom recvWindow. The time offset is calibrated at startup and again when a
+// request is rejected by timestamp, which is retried once with the new offset.
+type binanceSigner struct {
+	transport  http.RoundTripper
+	secret     string
+	recvWindow time.Duration
+	timeURL    string
+	now        func() time.Time
+
+	// offset is the server time minus the local time, in milliseconds
+	offset int64
+}
+
+func newBinanceSigner(secret, timeURL string, recvWindow time.Duration) *binanceSigner {
+	return &binanceSigner{
+		transport:  http.DefaultTransport,
+		secret:     secret,
+		recvWindow: recvWindow,
+		timeURL:    timeURL,
+		now:        time.Now,
+	}
+}
+
+// wrap inserts the signer before the transport of a rate limiter, so retries are counted by the limiter
+func (s *binanceSigner) wrap(limiter *rateLimiter) {
+	s.transport = limiter.transport
+	limiter.transport = s
+}
+
+// Offset returns the difference between the server time and the local time
+func (s *binanceSigner) Offset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&s.offset)) * time.Millisecond
+}
+
+// sync calibrates the time offset with the server time, assuming a symmetric network latency
+func (s *binanceSigner) sync(ctx context.Context) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, s.timeURL, nil)
+	if err != nil {
+		return err
+	}
+
+	start := s.now()
+	response, err := s.transport.RoundTrip(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	end := s.now()
+
+	var result struct {
+		ServerTime int64 `json:"serverTime"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("binance server time: %w", err)
+	}
+
+	local := start.Add(end.Sub(start) / 2)
+	offset := result.ServerTime - local.UnixMilli()
+	atomic.StoreInt64(&s.offset, offset)
+	log.Debugf("[TIME] server time offset: %dms", offset)
+	return nil
+}
+
+func (s *binanceSigner) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !req.URL.Query().Has("signature") {
+		return s.transport.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := s.send(req, body)
+	if err != nil || response.StatusCode != http.StatusBadRequest {
+		return response, err
+	}
+
+	data, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(data))
+
+	apiErr := new(common.APIError)
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Code != ErrInvalidTimestamp {
+		return response, nil
+	}
+
+	log.Warnf("[TIME] request rejected by timestamp (offset %s), synchronizing with server time", s.Offset())
+	if err := s.sync(req.Context()); err != nil {
+		log.Errorf("[TIME] server time sync fail: %v", err)
+		return response, nil
+	}
+	return s.send(req, body)
+}
+
+// send signs a request with the current server time, the signature covers the query and the body
+func (s *binanceSigner) send(req *http.Request, body []byte) (*http.Response, error) {
+	query := req.URL.Query()
+	query.Del("signature")
+	query.Set("timestamp", strconv.FormatInt(s.now().UnixMilli()+atomic.LoadInt64(&s.offset), 10))
+	if s.recvWindow > 0 && !query.Has("recvWindow") {
+		query.Set("recvWindow", strconv.FormatInt(s.recvWindow.Milliseconds(), 10))
+	}
+	encoded := query.Encode()
+
+	mac := hmac.New(sha256.New, []byte(s.secret))
+	_, _ = mac.Write([]byte(encoded))
+	_, _ = mac.Write(body)
+
+	signed := req.Clone(req.Context())
+	signed.URL.RawQuery = encoded + "&signature=" + hex.EncodeToString(mac.Sum(nil))
+	if body != nil {
+		signed.Body = io.NopCloser(bytes.NewReader(body))
+		signed.ContentLength = int64(len(body))
+	}
+	return s.transport.RoundTrip(signed)
+}
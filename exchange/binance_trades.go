@@ -0,0 +1,103 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// binanceAggTradeEvent is an event of the aggregated trade streams, the same for spot and futures
+type binanceAggTradeEvent struct {
+	Event        string `json:"e"`
+	EventTime    int64  `json:"E"`
+	Symbol       string `json:"s"`
+	ID           int64  `json:"a"`
+	Price        string `json:"p"`
+	Quantity     string `json:"q"`
+	FirstTradeID int64  `json:"f"`
+	LastTradeID  int64  `json:"l"`
+	Time         int64  `json:"T"`
+	BuyerMaker   bool   `json:"m"`
+	BestMatch    bool   `json:"M"`
+}
+
+// newBinanceTrade converts an event of the aggregated trade streams, trades of buyer makers are sells
+func newBinanceTrade(pair string, message []byte) (model.Trade, error) {
+	event := new(binanceAggTradeEvent)
+	if err := json.Unmarshal(message, event); err != nil {
+		return model.Trade{}, err
+	}
+
+	trade := model.Trade{
+		ID:   event.ID,
+		Pair: pair,
+		Time: time.UnixMilli(event.Time),
+		Side: model.SideTypeBuy,
+	}
+	if event.BuyerMaker {
+		trade.Side = model.SideTypeSell
+	}
+
+	var err error
+	if trade.Price, err = strconv.ParseFloat(event.Price, 64); err != nil {
+		return model.Trade{}, err
+	}
+	if trade.Quantity, err = strconv.ParseFloat(event.Quantity, 64); err != nil {
+		return model.Trade{}, err
+	}
+	return trade, nil
+}
+
+// binanceTradesSubscription streams the aggregated trades of a pair, until the context is done
+func binanceTradesSubscription(ctx context.Context, dialer *websocket.Dialer, streamEndpoint,
+	pair string) (chan model.Trade, chan error) {
+
+	ctrade := make(chan model.Trade)
+	cerr := make(chan error)
+	endpoint := fmt.Sprintf("%s/%s@aggTrade", streamEndpoint, strings.ToLower(pair))
+
+	go func() {
+		defer close(cerr)
+		defer close(ctrade)
+
+		binanceStream(ctx, dialer, endpoint, func(message []byte) error {
+			trade, err := newBinanceTrade(pair, message)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case ctrade <- trade:
+			case <-ctx.Done():
+			}
+			return nil
+		}, cerr)
+	}()
+
+	return ctrade, cerr
+}
+
+// TradesSubscription streams the aggregated trades of a pair, as they happen
+func (b *Binance) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	endpoint := b.StreamEndpoint
+	if endpoint == "" {
+		endpoint = binanceStreamEndpoint
+	}
+	return binanceTradesSubscription(ctx, b.dialer, endpoint, pair)
+}
+
+// TradesSubscription streams the aggregated trades of a pair, as they happen
+func (b *BinanceFuture) TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error) {
+	endpoint := b.StreamEndpoint
+	if endpoint == "" {
+		endpoint = binanceFutureStreamEndpoint
+	}
+	return binanceTradesSubscription(ctx, b.dialer, endpoint, pair)
+}
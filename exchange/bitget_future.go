@@ -0,0 +1,1383 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	bitgetEndpoint              = "https://api.bitget.com"
+	bitgetStreamEndpoint        = "wss://ws.bitget.com/v2/ws/public"
+	bitgetPrivateStreamEndpoint = "wss://ws.bitget.com/v2/ws/private"
+
+	bitgetProductType = "USDT-FUTURES"
+	bitgetMarginCoin  = "USDT"
+
+	// bitgetCandleLimit is the maximum number of candles returned by a request
+	bitgetCandleLimit = 1000
+
+	bitgetSuccess = "00000"
+
+	// prefixes of the client order ids of plan orders, since their trigger direction is not reported
+	bitgetStopPrefix   = "stop_"
+	bitgetProfitPrefix = "profit_"
+)
+
+// Bitget error codes of missing orders
+var bitgetErrOrderNotFound = []string{"40109", "40768"}
+
+// BitgetError is an error returned by the Bitget API
+type BitgetError struct {
+	Code    string
+	Message string
+}
+
+func (e *BitgetError) Error() string {
+	return fmt.Sprintf("bitget error %s: %s", e.Code, e.Message)
+}
+
+// BitgetFuture is the Bitget USDT-M perpetual futures exchange, using the V2 API in one-way position mode.
+// Conditional orders are Bitget plan orders, and stops or take profits of the whole position are Bitget
+// position TP/SL orders.
+type BitgetFuture struct {
+	ctx        context.Context
+	client     *http.Client
+	assetsInfo map[string]model.AssetInfo
+	lastID     int64
+	HeikinAshi bool
+
+	APIKey     string
+	APISecret  string
+	Passphrase string
+
+	// Endpoint, StreamEndpoint and PrivateStreamEndpoint override the REST, public and private
+	// websocket URLs, eg: for a mock server
+	Endpoint              string
+	StreamEndpoint        string
+	PrivateStreamEndpoint string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+	PairOptions      []PairOption
+}
+
+type BitgetFutureOption func(*BitgetFuture)
+
+// WithBitgetFutureCredentials will set the credentials for Bitget
+func WithBitgetFutureCredentials(key, secret, passphrase string) BitgetFutureOption {
+	return func(b *BitgetFuture) {
+		b.APIKey = key
+		b.APISecret = secret
+		b.Passphrase = passphrase
+	}
+}
+
+// WithBitgetFutureHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithBitgetFutureHeikinAshiCandle() BitgetFutureOption {
+	return func(b *BitgetFuture) {
+		b.HeikinAshi = true
+	}
+}
+
+// WithBitgetFutureMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithBitgetFutureMetadataFetcher(fetcher MetadataFetchers) BitgetFutureOption {
+	return func(b *BitgetFuture) {
+		b.MetadataFetchers = append(b.MetadataFetchers, fetcher)
+	}
+}
+
+// WithBitgetFutureLeverage will set the leverage and margin type for a pair
+func WithBitgetFutureLeverage(pair string, leverage int, marginType MarginType) BitgetFutureOption {
+	return func(b *BitgetFuture) {
+		b.PairOptions = append(b.PairOptions, PairOption{
+			Pair:       strings.ToUpper(pair),
+			Leverage:   leverage,
+			MarginType: marginType,
+		})
+	}
+}
+
+// WithBitgetFutureEndpoint overrides the REST, public and private websocket endpoints
+func WithBitgetFutureEndpoint(endpoint, streamEndpoint, privateStreamEndpoint string) BitgetFutureOption {
+	return func(b *BitgetFuture) {
+		b.Endpoint = endpoint
+		b.StreamEndpoint = streamEndpoint
+		b.PrivateStreamEndpoint = privateStreamEndpoint
+	}
+}
+
+// NewBitgetFuture will create a new BitgetFuture instance
+func NewBitgetFuture(ctx context.Context, options ...BitgetFutureOption) (*BitgetFuture, error) {
+	exchange := &BitgetFuture{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		lastID:          time.Now().UnixNano() / int64(time.Microsecond),
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.Endpoint == "" {
+		exchange.Endpoint, exchange.StreamEndpoint, exchange.PrivateStreamEndpoint =
+			bitgetEndpoint, bitgetStreamEndpoint, bitgetPrivateStreamEndpoint
+	}
+
+	// Initialize with orders precision and assets limits
+	var err error
+	exchange.assetsInfo, err = exchange.contracts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("bitget ping fail: %w", err)
+	}
+
+	// Set leverage and margin type
+	for _, option := range exchange.PairOptions {
+		if err := exchange.setLeverage(ctx, option); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("[SETUP] Using Bitget Futures exchange")
+
+	return exchange, nil
+}
+
+// request sends a REST request, GET params are sent in the query string and POST params in a JSON body.
+// Signed requests are authenticated with the HMAC signature of the timestamp, method, path with the query
+// and body.
+func (b *BitgetFuture) request(ctx context.Context, method, path string, params map[string]interface{},
+	signed bool, result interface{}) error {
+
+	var body []byte
+	requestPath := path
+	if method == http.MethodGet {
+		query := url.Values{}
+		for key, value := range params {
+			query.Set(key, fmt.Sprint(value))
+		}
+		if len(query) > 0 {
+			requestPath += "?" + query.Encode()
+		}
+	} else {
+		var err error
+		body, err = json.Marshal(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, b.Endpoint+requestPath, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("locale", "en-US")
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		req.Header.Set("ACCESS-KEY", b.APIKey)
+		req.Header.Set("ACCESS-PASSPHRASE", b.Passphrase)
+		req.Header.Set("ACCESS-TIMESTAMP", timestamp)
+		req.Header.Set("ACCESS-SIGN", b.sign(timestamp+method+requestPath+string(body)))
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Code string          `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("bitget %s %s: status %d: %w", method, path, resp.StatusCode, err)
+	}
+
+	if response.Code != bitgetSuccess {
+		return &BitgetError{Code: response.Code, Message: response.Msg}
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Data, result)
+}
+
+func (b *BitgetFuture) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(b.APISecret))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+type bitgetContract struct {
+	Symbol         string `json:"symbol"`
+	BaseCoin       string `json:"baseCoin"`
+	QuoteCoin      string `json:"quoteCoin"`
+	MinTradeNum    string `json:"minTradeNum"`
+	MaxOrderQty    string `json:"maxOrderQty"`
+	SizeMultiplier string `json:"sizeMultiplier"`
+	PricePlace     string `json:"pricePlace"`
+	PriceEndStep   string `json:"priceEndStep"`
+	SymbolStatus   string `json:"symbolStatus"`
+}
+
+func (b *BitgetFuture) contracts(ctx context.Context) (map[string]model.AssetInfo, error) {
+	var contracts []bitgetContract
+	err := b.request(ctx, http.MethodGet, "/api/v2/mix/market/contracts", map[string]interface{}{
+		"productType": bitgetProductType,
+	}, false, &contracts)
+	if err != nil {
+		return nil, err
+	}
+
+	assetsInfo := make(map[string]model.AssetInfo)
+	for _, contract := range contracts {
+		if contract.SymbolStatus == "off" {
+			continue
+		}
+
+		info := model.AssetInfo{
+			BaseAsset:  contract.BaseCoin,
+			QuoteAsset: contract.QuoteCoin,
+			MaxPrice:   math.MaxFloat64,
+		}
+		info.MinQuantity, _ = strconv.ParseFloat(contract.MinTradeNum, 64)
+		info.MaxQuantity, _ = strconv.ParseFloat(contract.MaxOrderQty, 64)
+		if info.MaxQuantity == 0 {
+			info.MaxQuantity = math.MaxFloat64
+		}
+		info.StepSize, _ = strconv.ParseFloat(contract.SizeMultiplier, 64)
+
+		// the tick size is a number of steps of the last decimal place, eg: 5 steps of 0.1
+		info.PricePrecision, _ = strconv.Atoi(contract.PricePlace)
+		step, err := strconv.ParseFloat(contract.PriceEndStep, 64)
+		if err != nil || step == 0 {
+			step = 1
+		}
+		info.TickSize = step * math.Pow10(-info.PricePrecision)
+		info.MinPrice = info.TickSize
+
+		info.BaseAssetPrecision = getDecimalPrecision(info.StepSize)
+		info.QuotePrecision = info.PricePrecision
+		assetsInfo[contract.Symbol] = info
+		RegisterPair(contract.Symbol, info.BaseAsset, info.QuoteAsset)
+	}
+	return assetsInfo, nil
+}
+
+func (b *BitgetFuture) setLeverage(ctx context.Context, option PairOption) error {
+	if option.MarginType != "" {
+		marginMode := "crossed"
+		if option.MarginType == MarginTypeIsolated {
+			marginMode = "isolated"
+		}
+		err := b.request(ctx, http.MethodPost, "/api/v2/mix/account/set-margin-mode", map[string]interface{}{
+			"symbol":      option.Pair,
+			"productType": bitgetProductType,
+			"marginCoin":  bitgetMarginCoin,
+			"marginMode":  marginMode,
+		}, true, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.request(ctx, http.MethodPost, "/api/v2/mix/account/set-leverage", map[string]interface{}{
+		"symbol":      option.Pair,
+		"productType": bitgetProductType,
+		"marginCoin":  bitgetMarginCoin,
+		"leverage":    strconv.Itoa(option.Leverage),
+	}, true, nil)
+}
+
+// marginMode returns the configured margin mode of a pair, crossed by default
+func (b *BitgetFuture) marginMode(pair string) string {
+	for _, option := range b.PairOptions {
+		if option.Pair == pair && option.MarginType == MarginTypeIsolated {
+			return "isolated"
+		}
+	}
+	return "crossed"
+}
+
+func (b *BitgetFuture) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var tickers []struct {
+		LastPr string `json:"lastPr"`
+	}
+	err := b.request(ctx, http.MethodGet, "/api/v2/mix/market/ticker", map[string]interface{}{
+		"symbol":      pair,
+		"productType": bitgetProductType,
+	}, false, &tickers)
+	if err != nil {
+		return 0, err
+	}
+	if len(tickers) == 0 {
+		return 0, ErrInvalidAsset
+	}
+	return strconv.ParseFloat(tickers[0].LastPr, 64)
+}
+
+func (b *BitgetFuture) AssetsInfo(pair string) model.AssetInfo {
+	return b.assetsInfo[pair]
+}
+
+func (b *BitgetFuture) validate(pair string, quantity float64) error {
+	info, ok := b.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (b *BitgetFuture) formatPrice(pair string, value float64) string {
+	return formatStep(value, b.assetsInfo[pair].TickSize)
+}
+
+func (b *BitgetFuture) formatQuantity(pair string, value float64) string {
+	return formatStep(value, b.assetsInfo[pair].StepSize)
+}
+
+func bitgetSide(side model.SideType) string {
+	return strings.ToLower(string(side))
+}
+
+func bitgetReduceOnly(reduceOnly bool) string {
+	if reduceOnly {
+		return "YES"
+	}
+	return "NO"
+}
+
+// clientOid returns the client order ID of an order, a new one when the given client order ID is empty
+func (b *BitgetFuture) clientOid(clientOrderID string) string {
+	if clientOrderID == "" {
+		return strconv.FormatInt(atomic.AddInt64(&b.lastID, 1), 10)
+	}
+	return clientOrderID
+}
+
+// createOrder places an order and returns its current state
+func (b *BitgetFuture) createOrder(pair, clientOrderID string, params map[string]interface{}) (model.Order,
+	error) {
+	params["symbol"] = pair
+	params["productType"] = bitgetProductType
+	params["marginMode"] = b.marginMode(pair)
+	params["marginCoin"] = bitgetMarginCoin
+	params["clientOid"] = b.clientOid(clientOrderID)
+
+	var result struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := b.request(b.ctx, http.MethodPost, "/api/v2/mix/order/place-order", params, true, &result); err != nil {
+		return model.Order{}, err
+	}
+
+	id, err := strconv.ParseInt(result.OrderID, 10, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return b.Order(pair, id)
+}
+
+// createPlanOrder places a plan order triggered at the trigger price, or a position TP/SL order when the
+// quantity is zero, and returns its current state. The client order ID is prefixed with the kind of the order.
+func (b *BitgetFuture) createPlanOrder(side model.SideType, pair string, quantity, trigger, price float64,
+	takeProfit bool, clientOrderID string) (model.Order, error) {
+
+	prefix, planType := bitgetStopPrefix, "pos_loss"
+	if takeProfit {
+		prefix, planType = bitgetProfitPrefix, "pos_profit"
+	}
+
+	params := map[string]interface{}{
+		"symbol":       pair,
+		"productType":  bitgetProductType,
+		"marginCoin":   bitgetMarginCoin,
+		"triggerPrice": b.formatPrice(pair, trigger),
+		"triggerType":  "fill_price",
+		"clientOid":    prefix + b.clientOid(clientOrderID),
+	}
+
+	path := "/api/v2/mix/order/place-plan-order"
+	if quantity > 0 {
+		if err := b.validate(pair, quantity); err != nil {
+			return model.Order{}, err
+		}
+		params["planType"] = "normal_plan"
+		params["marginMode"] = b.marginMode(pair)
+		params["side"] = bitgetSide(side)
+		params["size"] = b.formatQuantity(pair, quantity)
+		params["orderType"] = "market"
+		if price > 0 {
+			params["orderType"] = "limit"
+			params["price"] = b.formatPrice(pair, price)
+		}
+	} else {
+		// position TP/SL orders are given the side of the position they close
+		path = "/api/v2/mix/order/place-tpsl-order"
+		params["planType"] = planType
+		params["holdSide"] = bitgetSide(bitgetOpposite(side))
+	}
+
+	var result struct {
+		OrderID string `json:"orderId"`
+	}
+	if err := b.request(b.ctx, http.MethodPost, path, params, true, &result); err != nil {
+		return model.Order{}, err
+	}
+
+	id, err := strconv.ParseInt(result.OrderID, 10, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return b.Order(pair, id)
+}
+
+func bitgetOpposite(side model.SideType) model.SideType {
+	if side == model.SideTypeSell {
+		return model.SideTypeBuy
+	}
+	return model.SideTypeSell
+}
+
+func (b *BitgetFuture) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: bitget oco", ErrUnsupportedOrder)
+}
+
+func (b *BitgetFuture) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return b.createOrderLimit(side, pair, quantity, limit, "")
+}
+
+func (b *BitgetFuture) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	clientOrderID string) (model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return b.createOrder(pair, clientOrderID, map[string]interface{}{
+		"side":      bitgetSide(side),
+		"orderType": "limit",
+		"force":     "gtc",
+		"size":      b.formatQuantity(pair, quantity),
+		"price":     b.formatPrice(pair, limit),
+	})
+}
+
+func (b *BitgetFuture) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+	return b.createOrderMarket(side, pair, quantity, reduceOnly, "")
+}
+
+func (b *BitgetFuture) createOrderMarket(side model.SideType, pair string, quantity float64, reduceOnly bool,
+	clientOrderID string) (model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return b.createOrder(pair, clientOrderID, map[string]interface{}{
+		"side":       bitgetSide(side),
+		"orderType":  "market",
+		"size":       b.formatQuantity(pair, quantity),
+		"reduceOnly": bitgetReduceOnly(reduceOnly),
+	})
+}
+
+func (b *BitgetFuture) CreateOrderMarketQuote(_ model.SideType, _ string, _ float64) (model.Order, error) {
+	return model.Order{}, fmt.Errorf("%w: bitget market order by quote", ErrUnsupportedOrder)
+}
+
+// CreateOrderStop places a stop market order, following the same semantics of BinanceFuture:
+// a negative limit creates a buy stop, and a zero quantity closes the whole position
+func (b *BitgetFuture) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	side := model.SideTypeSell
+	if limit < 0 {
+		side = model.SideTypeBuy
+		limit = -limit
+	}
+	return b.createPlanOrder(side, pair, quantity, limit, 0, false, "")
+}
+
+// TakeProfit places a plan order triggered at the limit price, a limit order for a given quantity or a
+// market order closing the whole position when the quantity is zero
+func (b *BitgetFuture) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (model.Order, error) {
+
+	return b.createPlanOrder(side, pair, quantity, limit, limit, true, "")
+}
+
+// CreateOrderRequest places an order with the client order ID of the request, prefixed with the kind of the
+// order for plan orders
+func (b *BitgetFuture) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: bitget time in force %s", ErrUnsupportedOrder, request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: bitget iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = b.createOrderLimit(request.Side, request.Pair, request.Quantity, request.Price,
+			request.ClientOrderID)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			return b.CreateOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity)
+		}
+		order, err = b.createOrderMarket(request.Side, request.Pair, request.Quantity, request.ReduceOnly,
+			request.ClientOrderID)
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		order, err = b.createPlanOrder(request.Side, request.Pair, request.Quantity, request.Stop, 0, false,
+			request.ClientOrderID)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = b.createPlanOrder(request.Side, request.Pair, request.Quantity, request.Stop, request.Stop, true,
+			request.ClientOrderID)
+	default:
+		return model.Order{}, fmt.Errorf("%w: bitget %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns a regular or plan order by its client order ID, or ErrOrderNotFound
+func (b *BitgetFuture) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	var order bitgetOrder
+	err := b.request(b.ctx, http.MethodGet, "/api/v2/mix/order/detail", map[string]interface{}{
+		"symbol":      pair,
+		"productType": bitgetProductType,
+		"clientOid":   clientOrderID,
+	}, true, &order)
+	if err == nil {
+		result := order.toModel()
+		result.ClientOrderID = clientOrderID
+		return result, nil
+	}
+	if !isBitgetOrderNotFound(err) {
+		return model.Order{}, err
+	}
+
+	for _, path := range []string{"/api/v2/mix/order/orders-plan-pending", "/api/v2/mix/order/orders-plan-history"} {
+		for _, planType := range []string{"normal_plan", "profit_loss"} {
+			orders, err := b.planOrderList(path, map[string]interface{}{
+				"symbol":   pair,
+				"planType": planType,
+			})
+			if err != nil {
+				return model.Order{}, err
+			}
+			for _, order := range orders {
+				if order.ClientOid == bitgetStopPrefix+clientOrderID ||
+					order.ClientOid == bitgetProfitPrefix+clientOrderID {
+					result := order.toModel()
+					result.ClientOrderID = clientOrderID
+					return result, nil
+				}
+			}
+		}
+	}
+	return model.Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, clientOrderID)
+}
+
+func (b *BitgetFuture) Cancel(order model.Order) error {
+	id := strconv.FormatInt(order.ExchangeID, 10)
+	if order.Stop == nil {
+		return b.request(b.ctx, http.MethodPost, "/api/v2/mix/order/cancel-order", map[string]interface{}{
+			"symbol":      order.Pair,
+			"productType": bitgetProductType,
+			"orderId":     id,
+		}, true, nil)
+	}
+
+	var err error
+	for _, planType := range []string{"normal_plan", "profit_loss"} {
+		var result struct {
+			FailureList []struct {
+				ErrorMsg string `json:"errorMsg"`
+			} `json:"failureList"`
+		}
+		err = b.request(b.ctx, http.MethodPost, "/api/v2/mix/order/cancel-plan-order", map[string]interface{}{
+			"orderIdList": []map[string]string{{"orderId": id}},
+			"symbol":      order.Pair,
+			"productType": bitgetProductType,
+			"marginCoin":  bitgetMarginCoin,
+			"planType":    planType,
+		}, true, &result)
+		if err == nil && len(result.FailureList) > 0 {
+			err = &BitgetError{Message: result.FailureList[0].ErrorMsg}
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (b *BitgetFuture) CancelOpenOrders(pair string) error {
+	orders, err := b.OpenOrders(pair)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if err := b.Cancel(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BitgetFuture) OpenOrders(pair string) ([]model.Order, error) {
+	var pending struct {
+		EntrustedList []bitgetOrder `json:"entrustedList"`
+	}
+	err := b.request(b.ctx, http.MethodGet, "/api/v2/mix/order/orders-pending", map[string]interface{}{
+		"symbol":      pair,
+		"productType": bitgetProductType,
+	}, true, &pending)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(pending.EntrustedList))
+	for _, order := range pending.EntrustedList {
+		orders = append(orders, order.toModel())
+	}
+
+	for _, planType := range []string{"normal_plan", "profit_loss"} {
+		plans, err := b.planOrders("/api/v2/mix/order/orders-plan-pending", map[string]interface{}{
+			"symbol":   pair,
+			"planType": planType,
+		})
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, plans...)
+	}
+	return orders, nil
+}
+
+func (b *BitgetFuture) planOrders(path string, params map[string]interface{}) ([]model.Order, error) {
+	list, err := b.planOrderList(path, params)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(list))
+	for _, order := range list {
+		orders = append(orders, order.toModel())
+	}
+	return orders, nil
+}
+
+func (b *BitgetFuture) planOrderList(path string, params map[string]interface{}) ([]bitgetPlanOrder, error) {
+	params["productType"] = bitgetProductType
+
+	var result struct {
+		EntrustedList []bitgetPlanOrder `json:"entrustedList"`
+	}
+	if err := b.request(b.ctx, http.MethodGet, path, params, true, &result); err != nil {
+		return nil, err
+	}
+	return result.EntrustedList, nil
+}
+
+func isBitgetOrderNotFound(err error) bool {
+	var apiError *BitgetError
+	if !errors.As(err, &apiError) {
+		return false
+	}
+	for _, code := range bitgetErrOrderNotFound {
+		if apiError.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Order returns a regular order by its id, or a plan order by its id, from the pending and past plan orders
+func (b *BitgetFuture) Order(pair string, id int64) (model.Order, error) {
+	var order bitgetOrder
+	err := b.request(b.ctx, http.MethodGet, "/api/v2/mix/order/detail", map[string]interface{}{
+		"symbol":      pair,
+		"productType": bitgetProductType,
+		"orderId":     strconv.FormatInt(id, 10),
+	}, true, &order)
+	if err == nil {
+		return order.toModel(), nil
+	}
+	if !isBitgetOrderNotFound(err) {
+		return model.Order{}, err
+	}
+
+	for _, path := range []string{"/api/v2/mix/order/orders-plan-pending", "/api/v2/mix/order/orders-plan-history"} {
+		for _, planType := range []string{"normal_plan", "profit_loss"} {
+			orders, err := b.planOrders(path, map[string]interface{}{
+				"symbol":   pair,
+				"planType": planType,
+				"orderId":  strconv.FormatInt(id, 10),
+			})
+			if err != nil {
+				return model.Order{}, err
+			}
+			for _, order := range orders {
+				if order.ExchangeID == id {
+					return order, nil
+				}
+			}
+		}
+	}
+	return model.Order{}, fmt.Errorf("bitget order %d not found", id)
+}
+
+// bitgetOrder is a regular order of the REST API and the orders channel
+type bitgetOrder struct {
+	OrderID       string `json:"orderId"`
+	Symbol        string `json:"symbol"`
+	InstID        string `json:"instId"`
+	Side          string `json:"side"`
+	OrderType     string `json:"orderType"`
+	Status        string `json:"status"`
+	Price         string `json:"price"`
+	Size          string `json:"size"`
+	PriceAvg      string `json:"priceAvg"`
+	BaseVolume    string `json:"baseVolume"`
+	AccBaseVolume string `json:"accBaseVolume"`
+	CTime         string `json:"cTime"`
+	UTime         string `json:"uTime"`
+}
+
+func bitgetTime(value string) time.Time {
+	milliseconds, _ := strconv.ParseInt(value, 10, 64)
+	return time.Unix(0, milliseconds*int64(time.Millisecond))
+}
+
+func (o bitgetOrder) toModel() model.Order {
+	id, _ := strconv.ParseInt(o.OrderID, 10, 64)
+	order := model.Order{
+		ExchangeID: id,
+		Pair:       o.Symbol,
+		Side:       model.SideType(strings.ToUpper(o.Side)),
+		Type:       model.OrderTypeLimit,
+		CreatedAt:  bitgetTime(o.CTime),
+		UpdatedAt:  bitgetTime(o.UTime),
+	}
+	if order.Pair == "" {
+		order.Pair = o.InstID
+	}
+	if o.OrderType == "market" {
+		order.Type = model.OrderTypeMarket
+	}
+
+	switch o.Status {
+	case "partially_filled":
+		order.Status = model.OrderStatusTypePartiallyFilled
+	case "filled":
+		order.Status = model.OrderStatusTypeFilled
+	case "canceled", "cancelled":
+		order.Status = model.OrderStatusTypeCanceled
+	default:
+		order.Status = model.OrderStatusTypeNew
+	}
+
+	var err error
+	executed := o.BaseVolume
+	if executed == "" {
+		executed = o.AccBaseVolume
+	}
+	filled, _ := strconv.ParseFloat(executed, 64)
+	average, _ := strconv.ParseFloat(o.PriceAvg, 64)
+	if filled > 0 && average > 0 {
+		order.Price, order.Quantity = average, filled
+	} else {
+		order.Price, err = strconv.ParseFloat(o.Price, 64)
+		log.CheckErr(log.WarnLevel, err)
+		order.Quantity, err = strconv.ParseFloat(o.Size, 64)
+		log.CheckErr(log.WarnLevel, err)
+	}
+
+	return order
+}
+
+type bitgetPlanOrder struct {
+	OrderID      string `json:"orderId"`
+	ClientOid    string `json:"clientOid"`
+	Symbol       string `json:"symbol"`
+	PlanType     string `json:"planType"`
+	Side         string `json:"side"`
+	OrderType    string `json:"orderType"`
+	PlanStatus   string `json:"planStatus"`
+	Size         string `json:"size"`
+	Price        string `json:"price"`
+	ExecutePrice string `json:"executePrice"`
+	TriggerPrice string `json:"triggerPrice"`
+	CTime        string `json:"cTime"`
+	UTime        string `json:"uTime"`
+}
+
+func (o bitgetPlanOrder) toModel() model.Order {
+	id, _ := strconv.ParseInt(o.OrderID, 10, 64)
+	trigger, _ := strconv.ParseFloat(o.TriggerPrice, 64)
+	order := model.Order{
+		ExchangeID: id,
+		Pair:       o.Symbol,
+		Side:       model.SideType(strings.ToUpper(o.Side)),
+		Price:      trigger,
+		Stop:       &trigger,
+		CreatedAt:  bitgetTime(o.CTime),
+		UpdatedAt:  bitgetTime(o.UTime),
+	}
+	if o.UTime == "" {
+		order.UpdatedAt = order.CreatedAt
+	}
+	order.Quantity, _ = strconv.ParseFloat(o.Size, 64)
+
+	takeProfit := strings.HasPrefix(o.ClientOid, bitgetProfitPrefix)
+	switch o.PlanType {
+	case "pos_profit", "pos_loss":
+		// position TP/SL orders are given the side of the position they close
+		takeProfit = o.PlanType == "pos_profit"
+		order.Side = bitgetOpposite(order.Side)
+	}
+
+	price := o.Price
+	if price == "" || price == "0" {
+		price = o.ExecutePrice
+	}
+	limit, _ := strconv.ParseFloat(price, 64)
+	if limit > 0 {
+		order.Price = limit
+	}
+
+	switch {
+	case takeProfit && limit > 0:
+		order.Type = model.OrderTypeTakeProfitLimit
+	case takeProfit:
+		order.Type = model.OrderTypeTakeProfit
+	case limit > 0:
+		order.Type = model.OrderTypeStopLossLimit
+	default:
+		order.Type = model.OrderTypeStopLoss
+	}
+
+	// triggered plan orders are executed as regular orders
+	switch o.PlanStatus {
+	case "executed", "triggered":
+		order.Status = model.OrderStatusTypeFilled
+	case "cancelled", "canceled":
+		order.Status = model.OrderStatusTypeCanceled
+	case "fail_execute", "fail_trigger":
+		order.Status = model.OrderStatusTypeRejected
+	default:
+		order.Status = model.OrderStatusTypeNew
+	}
+	return order
+}
+
+func (b *BitgetFuture) Account() (model.Account, error) {
+	var positions []struct {
+		Symbol   string `json:"symbol"`
+		HoldSide string `json:"holdSide"`
+		Total    string `json:"total"`
+		Leverage string `json:"leverage"`
+	}
+	err := b.request(b.ctx, http.MethodGet, "/api/v2/mix/position/all-position", map[string]interface{}{
+		"productType": bitgetProductType,
+		"marginCoin":  bitgetMarginCoin,
+	}, true, &positions)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0)
+	for _, position := range positions {
+		free, err := strconv.ParseFloat(position.Total, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		if free == 0 {
+			continue
+		}
+
+		leverage, err := strconv.ParseFloat(position.Leverage, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		if position.HoldSide == "short" {
+			free = -free
+		}
+
+		asset := position.Symbol
+		if info, ok := b.assetsInfo[position.Symbol]; ok {
+			asset = info.BaseAsset
+		}
+		balances = append(balances, model.Balance{
+			Asset:    asset,
+			Free:     free,
+			Leverage: leverage,
+		})
+	}
+
+	var accounts []struct {
+		MarginCoin string `json:"marginCoin"`
+		Available  string `json:"available"`
+		Locked     string `json:"locked"`
+	}
+	err = b.request(b.ctx, http.MethodGet, "/api/v2/mix/account/accounts", map[string]interface{}{
+		"productType": bitgetProductType,
+	}, true, &accounts)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	account := model.Account{}
+	for _, item := range accounts {
+		free, err := strconv.ParseFloat(item.Available, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+		lock, _ := strconv.ParseFloat(item.Locked, 64)
+
+		if free == 0 && lock == 0 {
+			continue
+		}
+
+		balances = append(balances, model.Balance{
+			Asset: item.MarginCoin,
+			Free:  free,
+			Lock:  lock,
+		})
+		account.Available += free
+	}
+
+	account.Balances = balances
+	return account, nil
+}
+
+func (b *BitgetFuture) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	acc, err := b.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free, nil
+}
+
+// PositionRisk returns the size of the position, BitgetFuture does not provide position details
+func (b *BitgetFuture) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(b, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, BitgetFuture does not support amending orders
+func (b *BitgetFuture) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(b, order, price, quantity)
+}
+
+// bitgetGranularity converts a ninjabot timeframe into a Bitget candle granularity, eg: 1h => 1H, 1d => 1D
+func bitgetGranularity(period string) (string, error) {
+	switch period {
+	case "1m", "3m", "5m", "15m", "30m":
+		return period, nil
+	case "1h", "4h", "6h", "12h", "1d", "1w":
+		return strings.ToUpper(period), nil
+	}
+	return "", fmt.Errorf("invalid bitget granularity %s", period)
+}
+
+// BitgetCandleFromKline converts a kline, a list of start time, open, high, low, close and base volume
+func BitgetCandleFromKline(pair string, kline []string) (model.Candle, error) {
+	if len(kline) < 6 {
+		return model.Candle{}, fmt.Errorf("invalid bitget kline: %v", kline)
+	}
+
+	t := bitgetTime(kline[0])
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Metadata: make(map[string]float64)}
+	for i, value := range []*float64{&candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume} {
+		var err error
+		if *value, err = strconv.ParseFloat(kline[i+1], 64); err != nil {
+			return model.Candle{}, err
+		}
+	}
+	return candle, nil
+}
+
+// klines returns the complete candles of a period, in chronological order
+func (b *BitgetFuture) klines(ctx context.Context, pair, period string,
+	params map[string]interface{}) ([]model.Candle, error) {
+
+	granularity, err := bitgetGranularity(period)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	params["symbol"] = pair
+	params["productType"] = bitgetProductType
+	params["granularity"] = granularity
+
+	var result [][]string
+	if err := b.request(ctx, http.MethodGet, "/api/v2/mix/market/candles", params, false, &result); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	candles := make([]model.Candle, 0, len(result))
+	for _, kline := range result {
+		candle, err := BitgetCandleFromKline(pair, kline)
+		if err != nil {
+			return nil, err
+		}
+
+		// the last candle is in progress until the end of its period
+		if candle.Time.Add(duration).After(now) {
+			continue
+		}
+		candle.Complete = true
+		candles = append(candles, candle)
+	}
+
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return candles, nil
+}
+
+func (b *BitgetFuture) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	size := limit + 1
+	if size > bitgetCandleLimit {
+		size = bitgetCandleLimit
+	}
+
+	candles, err := b.klines(ctx, pair, period, map[string]interface{}{"limit": size})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	if b.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+func (b *BitgetFuture) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	candles := make([]model.Candle, 0)
+	ha := model.NewHeikinAshi()
+	for !start.After(end) {
+		data, err := b.klines(ctx, pair, period, map[string]interface{}{
+			"startTime": start.UnixNano() / int64(time.Millisecond),
+			"endTime":   end.UnixNano() / int64(time.Millisecond),
+			"limit":     bitgetCandleLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, candle := range data {
+			if b.HeikinAshi {
+				candle = candle.ToHeikinAshi(ha)
+			}
+			candles = append(candles, candle)
+		}
+
+		if len(data) < bitgetCandleLimit {
+			break
+		}
+		start = data[len(data)-1].Time.Add(time.Millisecond)
+	}
+
+	return candles, nil
+}
+
+// bitgetEvent is a message of the websocket API
+type bitgetEvent struct {
+	Event  string `json:"event"`
+	Code   int    `json:"code"`
+	Msg    string `json:"msg"`
+	Action string `json:"action"`
+	Arg    struct {
+		Channel string `json:"channel"`
+	} `json:"arg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// CandlesSubscription streams the candles of a pair. Bitget sends the current candle on each trade, so the
+// previous candle is complete when a trade of the next period happens.
+func (b *BitgetFuture) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		granularity, err := bitgetGranularity(period)
+		if err != nil {
+			cerr <- err
+			close(cerr)
+			close(ccandle)
+			return
+		}
+
+		channel := "candle" + granularity
+		subscribe := map[string]interface{}{
+			"op":   "subscribe",
+			"args": []map[string]string{{"instType": bitgetProductType, "channel": channel, "instId": pair}},
+		}
+
+		var last *model.Candle
+		for {
+			done, stop, err := wsServeJSON(b.StreamEndpoint, []interface{}{subscribe}, "ping", func(message []byte) {
+				var event bitgetEvent
+				if err := json.Unmarshal(message, &event); err != nil || event.Arg.Channel != channel ||
+					len(event.Data) == 0 {
+					return
+				}
+
+				var data [][]string
+				if err := json.Unmarshal(event.Data, &data); err != nil {
+					log.Warn(err)
+					return
+				}
+
+				// the snapshot of the subscription starts with past candles
+				if event.Action == "snapshot" && len(data) > 0 {
+					data = data[len(data)-1:]
+				}
+
+				ba.Reset()
+				for _, kline := range data {
+					candle, err := BitgetCandleFromKline(pair, kline)
+					if err != nil {
+						log.Warn(err)
+						continue
+					}
+					candle.UpdatedAt = time.Now()
+
+					candles := []model.Candle{candle}
+					if last != nil && candle.Time.After(last.Time) {
+						complete := *last
+						complete.Complete = true
+						if b.HeikinAshi {
+							complete = complete.ToHeikinAshi(ha)
+						}
+						// fetch aditional data if needed
+						fetchMetadata(ctx, b.MetadataFetchers, b.MetadataTimeout, &b.metadataKeys, &complete)
+						candles = []model.Candle{complete, candle}
+					}
+					if last == nil || !candle.Time.Before(last.Time) {
+						last = &candle
+					}
+
+					for _, candle := range candles {
+						select {
+						case ccandle <- candle:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+			}, func(err error) {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+				}
+			})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				// wait for the stream handlers before closing the channels
+				close(stop)
+				<-done
+				close(cerr)
+				close(ccandle)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (b *BitgetFuture) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("bitget")
+}
+
+// AccountSubscription streams the updates of regular orders of the private websocket, it reconnects until
+// the context is done. Plan orders are not streamed and are updated by polling.
+func (b *BitgetFuture) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+
+		subscribe := map[string]interface{}{
+			"op":   "subscribe",
+			"args": []map[string]string{{"instType": bitgetProductType, "channel": "orders", "instId": "default"}},
+		}
+
+		for {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			login := map[string]interface{}{
+				"op": "login",
+				"args": []map[string]string{{
+					"apiKey":     b.APIKey,
+					"passphrase": b.Passphrase,
+					"timestamp":  timestamp,
+					"sign":       b.sign(timestamp + "GET/user/verify"),
+				}},
+			}
+
+			done, stop, err := wsConnect(b.PrivateStreamEndpoint, []interface{}{login}, "ping",
+				func(conn *wsConn, message []byte) {
+					var event bitgetEvent
+					if err := json.Unmarshal(message, &event); err != nil {
+						return
+					}
+
+					switch {
+					case event.Event == "login" && event.Code == 0:
+						// private channels are available after the login
+						if err := conn.send(subscribe); err != nil {
+							sendErr(err)
+						}
+						return
+					case event.Event == "error":
+						sendErr(&BitgetError{Code: strconv.Itoa(event.Code), Message: event.Msg})
+						return
+					case event.Arg.Channel != "orders" || len(event.Data) == 0:
+						return
+					}
+
+					var data []bitgetOrder
+					if err := json.Unmarshal(event.Data, &data); err != nil {
+						sendErr(err)
+						return
+					}
+
+					ba.Reset()
+					for _, order := range data {
+						select {
+						case corder <- order.toModel():
+						case <-ctx.Done():
+							return
+						}
+					}
+				}, sendErr)
+			if err != nil {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					close(cerr)
+					close(corder)
+					return
+				}
+				time.Sleep(ba.Duration())
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				close(stop)
+				<-done
+				close(cerr)
+				close(corder)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return corder, cerr
+}
@@ -0,0 +1,477 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// bitgetServer emulates the subset of the Bitget API used by the BitgetFuture exchange
+type bitgetServer struct {
+	*httptest.Server
+	mtx    sync.Mutex
+	lastID int64
+	orders map[int64]map[string]interface{}
+	plans  map[int64]map[string]interface{}
+	bodies []map[string]interface{}
+	paths  []string
+}
+
+func newBitgetServer(t *testing.T) *bitgetServer {
+	s := &bitgetServer{
+		lastID: 1000,
+		orders: make(map[int64]map[string]interface{}),
+		plans:  make(map[int64]map[string]interface{}),
+	}
+
+	reply := func(w http.ResponseWriter, data interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": bitgetSuccess, "msg": "success", "data": data})
+	}
+	sign := func(payload string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(payload))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	list := func(orders map[int64]map[string]interface{}, filter func(map[string]interface{}) bool) []interface{} {
+		result := make([]interface{}, 0)
+		for _, order := range orders {
+			if filter(order) {
+				result = append(result, order)
+			}
+		}
+		return result
+	}
+
+	mux := http.NewServeMux()
+	handle := func(path string, handler func(w http.ResponseWriter, r *http.Request, body map[string]interface{})) {
+		mux.HandleFunc("/api/v2/mix"+path, func(w http.ResponseWriter, r *http.Request) {
+			data, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			// verify the signature of private requests
+			requestPath := r.URL.Path
+			if r.URL.RawQuery != "" {
+				requestPath += "?" + r.URL.RawQuery
+			}
+			timestamp := r.Header.Get("ACCESS-TIMESTAMP")
+			require.Equal(t, sign(timestamp+r.Method+requestPath+string(data)), r.Header.Get("ACCESS-SIGN"))
+			require.Equal(t, "key", r.Header.Get("ACCESS-KEY"))
+			require.Equal(t, "passphrase", r.Header.Get("ACCESS-PASSPHRASE"))
+
+			body := make(map[string]interface{})
+			if len(data) > 0 {
+				require.NoError(t, json.Unmarshal(data, &body))
+			}
+
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			s.bodies = append(s.bodies, body)
+			s.paths = append(s.paths, r.URL.Path)
+			handler(w, r, body)
+		})
+	}
+
+	mux.HandleFunc("/api/v2/mix/market/contracts", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, bitgetProductType, r.URL.Query().Get("productType"))
+		reply(w, []map[string]string{
+			{"symbol": "BTCUSDT", "baseCoin": "BTC", "quoteCoin": "USDT", "minTradeNum": "0.001",
+				"maxOrderQty": "1000", "sizeMultiplier": "0.001", "pricePlace": "1", "priceEndStep": "5",
+				"symbolStatus": "normal"},
+		})
+	})
+	mux.HandleFunc("/api/v2/mix/market/ticker", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+		reply(w, []map[string]string{{"symbol": "BTCUSDT", "lastPr": "100"}})
+	})
+	mux.HandleFunc("/api/v2/mix/market/candles", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTCUSDT", r.URL.Query().Get("symbol"))
+		require.Equal(t, "1H", r.URL.Query().Get("granularity"))
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		times := []time.Time{start, start.Add(time.Hour), time.Now().Truncate(time.Hour)}
+		if value := r.URL.Query().Get("startTime"); value != "" {
+			from, _ := strconv.ParseInt(value, 10, 64)
+			times = times[:0]
+			for t := time.Unix(0, from*int64(time.Millisecond)); !t.After(start.Add(time.Hour)); t = t.Add(time.Hour) {
+				times = append(times, t)
+			}
+		}
+
+		result := make([][]string, 0)
+		for i, t := range times {
+			result = append(result, []string{strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10), "100",
+				"110", "90", strconv.Itoa(101 + i), "10", "1000"})
+		}
+		reply(w, result)
+	})
+
+	handle("/account/set-margin-mode", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, nil)
+	})
+	handle("/account/set-leverage", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, nil)
+	})
+	handle("/order/place-order", func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		s.lastID++
+		order := map[string]interface{}{"orderId": strconv.FormatInt(s.lastID, 10), "symbol": body["symbol"],
+			"clientOid": body["clientOid"], "side": body["side"], "orderType": body["orderType"], "size": body["size"],
+			"price": body["price"], "status": "live", "baseVolume": "0", "priceAvg": "", "cTime": "1640995200000",
+			"uTime": "1640995200000"}
+		if body["orderType"] == "market" {
+			order["status"], order["baseVolume"], order["priceAvg"] = "filled", body["size"], "100"
+		}
+		s.orders[s.lastID] = order
+		reply(w, map[string]string{"orderId": order["orderId"].(string), "clientOid": body["clientOid"].(string)})
+	})
+	placePlan := func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		s.lastID++
+		order := map[string]interface{}{"orderId": strconv.FormatInt(s.lastID, 10), "symbol": body["symbol"],
+			"clientOid": body["clientOid"], "planType": body["planType"], "side": body["side"],
+			"size": body["size"], "price": body["price"], "triggerPrice": body["triggerPrice"],
+			"planStatus": "live", "cTime": "1640995200000"}
+		if holdSide, ok := body["holdSide"]; ok {
+			order["side"], order["size"] = holdSide, ""
+		}
+		s.plans[s.lastID] = order
+		reply(w, map[string]string{"orderId": order["orderId"].(string)})
+	}
+	handle("/order/place-plan-order", placePlan)
+	handle("/order/place-tpsl-order", placePlan)
+	handle("/order/detail", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		id, _ := strconv.ParseInt(r.URL.Query().Get("orderId"), 10, 64)
+		order, ok := s.orders[id]
+		for _, placed := range s.orders {
+			if clientOid := r.URL.Query().Get("clientOid"); clientOid != "" && placed["clientOid"] == clientOid {
+				order, ok = placed, true
+			}
+		}
+		if !ok {
+			_ = json.NewEncoder(w).Encode(map[string]string{"code": "40109", "msg": "order not found"})
+			return
+		}
+		reply(w, order)
+	})
+	handle("/order/orders-pending", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, map[string]interface{}{"entrustedList": list(s.orders, func(order map[string]interface{}) bool {
+			return order["status"] == "live"
+		})})
+	})
+	plans := func(status string) func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		return func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+			planType, id := r.URL.Query().Get("planType"), r.URL.Query().Get("orderId")
+			reply(w, map[string]interface{}{"entrustedList": list(s.plans, func(order map[string]interface{}) bool {
+				isNormal := order["planType"] == "normal_plan"
+				return (planType == "normal_plan") == isNormal && (id == "" || order["orderId"] == id) &&
+					(order["planStatus"] == "live") == (status == "live")
+			})})
+		}
+	}
+	handle("/order/orders-plan-pending", plans("live"))
+	handle("/order/orders-plan-history", plans("history"))
+	handle("/order/cancel-order", func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		id, _ := strconv.ParseInt(body["orderId"].(string), 10, 64)
+		s.orders[id]["status"] = "canceled"
+		reply(w, map[string]string{"orderId": body["orderId"].(string)})
+	})
+	handle("/order/cancel-plan-order", func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		result := map[string]interface{}{"successList": []interface{}{}, "failureList": []interface{}{}}
+		for _, item := range body["orderIdList"].([]interface{}) {
+			id, _ := strconv.ParseInt(item.(map[string]interface{})["orderId"].(string), 10, 64)
+			order, ok := s.plans[id]
+			isNormal := ok && order["planType"] == "normal_plan"
+			if !ok || (body["planType"] == "normal_plan") != isNormal {
+				result["failureList"] = []interface{}{map[string]string{"orderId": "", "errorMsg": "not found"}}
+				continue
+			}
+			order["planStatus"] = "cancelled"
+		}
+		reply(w, result)
+	})
+	handle("/position/all-position", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, []map[string]string{
+			{"symbol": "BTCUSDT", "holdSide": "short", "total": "0.5", "leverage": "10"},
+			{"symbol": "ETHUSDT", "holdSide": "long", "total": "0", "leverage": "5"},
+		})
+	})
+	handle("/account/accounts", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, []map[string]string{{"marginCoin": "USDT", "available": "900", "locked": "100"}})
+	})
+
+	upgrader := websocket.Upgrader{}
+	stream := func(private bool) func(w http.ResponseWriter, r *http.Request) {
+		return func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			var request struct {
+				Op   string              `json:"op"`
+				Args []map[string]string `json:"args"`
+			}
+			if private {
+				require.NoError(t, conn.ReadJSON(&request))
+				require.Equal(t, "login", request.Op)
+				require.Equal(t, "key", request.Args[0]["apiKey"])
+				require.Equal(t, "passphrase", request.Args[0]["passphrase"])
+				require.Equal(t, sign(request.Args[0]["timestamp"]+"GET/user/verify"), request.Args[0]["sign"])
+				_ = conn.WriteJSON(map[string]interface{}{"event": "login", "code": 0})
+				request.Args = nil
+			}
+
+			require.NoError(t, conn.ReadJSON(&request))
+			require.Equal(t, "subscribe", request.Op)
+			arg := request.Args[0]
+			require.Equal(t, bitgetProductType, arg["instType"])
+			_ = conn.WriteJSON(map[string]interface{}{"event": "subscribe", "arg": arg})
+
+			push := func(action string, data interface{}) {
+				_ = conn.WriteJSON(map[string]interface{}{"action": action, "arg": arg, "data": data})
+			}
+
+			if private {
+				require.Equal(t, map[string]string{"instType": bitgetProductType, "channel": "orders",
+					"instId": "default"}, arg)
+				push("snapshot", []map[string]string{{"orderId": "7", "instId": "BTCUSDT", "side": "sell",
+					"orderType": "market", "size": "0.5", "price": "", "accBaseVolume": "0.5",
+					"priceAvg": "99.5", "status": "filled", "cTime": "1640995200000", "uTime": "1640995201000"}})
+			} else {
+				require.Equal(t, map[string]string{"instType": bitgetProductType, "channel": "candle1H",
+					"instId": "BTCUSDT"}, arg)
+				push("snapshot", [][]string{
+					{"1640991600000", "100", "110", "90", "100", "10", "1000", "1000"},
+					{"1640995200000", "100", "110", "90", "101", "10", "1000", "1000"},
+				})
+				push("update", [][]string{{"1640995200000", "100", "110", "90", "102", "10", "1000", "1000"}})
+				push("update", [][]string{{"1640998800000", "100", "110", "90", "103", "10", "1000", "1000"}})
+			}
+			_, _, _ = conn.ReadMessage()
+		}
+	}
+	mux.HandleFunc("/ws/public", stream(false))
+	mux.HandleFunc("/ws/private", stream(true))
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+func newTestBitgetFuture(t *testing.T, options ...BitgetFutureOption) (*BitgetFuture, *bitgetServer) {
+	server := newBitgetServer(t)
+	stream := "ws" + strings.TrimPrefix(server.URL, "http")
+	options = append([]BitgetFutureOption{
+		WithBitgetFutureCredentials("key", "secret", "passphrase"),
+		WithBitgetFutureEndpoint(server.URL, stream+"/ws/public", stream+"/ws/private"),
+	}, options...)
+	bitget, err := NewBitgetFuture(context.Background(), options...)
+	require.NoError(t, err)
+	return bitget, server
+}
+
+func TestBitgetFuture(t *testing.T) {
+	t.Run("contracts and leverage", func(t *testing.T) {
+		bitget, server := newTestBitgetFuture(t, WithBitgetFutureLeverage("btcusdt", 5, MarginTypeIsolated))
+		info := bitget.AssetsInfo("BTCUSDT")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USDT", info.QuoteAsset)
+		require.Equal(t, 0.001, info.MinQuantity)
+		require.Equal(t, 1000.0, info.MaxQuantity)
+		require.Equal(t, 0.001, info.StepSize)
+		require.Equal(t, 0.5, info.TickSize)
+		require.Equal(t, 3, info.BaseAssetPrecision)
+
+		require.Equal(t, []string{"/api/v2/mix/account/set-margin-mode", "/api/v2/mix/account/set-leverage"},
+			server.paths)
+		require.Equal(t, "isolated", server.bodies[0]["marginMode"])
+		require.Equal(t, "5", server.bodies[1]["leverage"])
+		require.Equal(t, "isolated", bitget.marginMode("BTCUSDT"))
+		require.Equal(t, "crossed", bitget.marginMode("ETHUSDT"))
+
+		quote, err := bitget.LastQuote(context.Background(), "BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 100.0, quote)
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		bitget, _ := newTestBitgetFuture(t)
+		candles, err := bitget.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, 101.0, candles[0].Close)
+		require.Equal(t, 10.0, candles[1].Volume)
+		require.True(t, candles[1].Complete)
+
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		candles, err = bitget.CandlesByPeriod(context.Background(), "BTCUSDT", "1h", start, start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, start, candles[0].Time.UTC())
+
+		_, err = bitget.CandlesByLimit(context.Background(), "BTCUSDT", "2h", 2)
+		require.Error(t, err)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		bitget, _ := newTestBitgetFuture(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream, _ := bitget.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		closes := make([]float64, 0)
+		completes := make([]bool, 0)
+		for i := 0; i < 4; i++ {
+			candle := <-stream
+			closes = append(closes, candle.Close)
+			completes = append(completes, candle.Complete)
+		}
+		// the snapshot history is skipped and the candle is complete on the next period
+		require.Equal(t, []float64{101, 102, 102, 103}, closes)
+		require.Equal(t, []bool{false, false, true, false}, completes)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		bitget, server := newTestBitgetFuture(t)
+
+		market, err := bitget.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5, true)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, model.SideTypeSell, market.Side)
+		require.Equal(t, 100.0, market.Price)
+		require.Equal(t, 0.5, market.Quantity)
+		require.Equal(t, "YES", server.bodies[0]["reduceOnly"])
+		require.Equal(t, "crossed", server.bodies[0]["marginMode"])
+		require.Equal(t, "0.500", server.bodies[0]["size"])
+
+		limit, err := bitget.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.5, 95.26)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, 95.0, limit.Price)
+
+		var orderError *OrderError
+		_, err = bitget.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.0001, 95)
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+
+		_, err = bitget.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 100)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+		_, err = bitget.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 110, 90, 89)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		// a negative limit creates a buy stop
+		stop, err := bitget.CreateOrderStop("BTCUSDT", 0.5, -110)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeBuy, stop.Side)
+		require.Equal(t, 110.0, *stop.Stop)
+		require.Equal(t, 0.5, stop.Quantity)
+		require.Equal(t, model.OrderStatusTypeNew, stop.Status)
+
+		// a zero quantity closes the whole position
+		closing, err := bitget.CreateOrderStop("BTCUSDT", 0, 90)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, closing.Type)
+		require.Equal(t, model.SideTypeSell, closing.Side)
+		require.Contains(t, server.paths, "/api/v2/mix/order/place-tpsl-order")
+
+		takeProfit, err := bitget.TakeProfit(model.SideTypeBuy, "BTCUSDT", 0.5, 80)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+		require.Equal(t, 80.0, takeProfit.Price)
+
+		orders, err := bitget.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 4)
+		sort.Slice(orders, func(i, j int) bool { return orders[i].ExchangeID < orders[j].ExchangeID })
+		require.Equal(t, []int64{limit.ExchangeID, stop.ExchangeID, closing.ExchangeID, takeProfit.ExchangeID},
+			[]int64{orders[0].ExchangeID, orders[1].ExchangeID, orders[2].ExchangeID, orders[3].ExchangeID})
+
+		require.NoError(t, bitget.CancelOpenOrders("BTCUSDT"))
+		orders, err = bitget.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+
+		// past plan orders are found in the history
+		order, err := bitget.Order("BTCUSDT", closing.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		require.Equal(t, model.OrderTypeStopLoss, order.Type)
+
+		_, err = bitget.Order("BTCUSDT", 1)
+		require.Error(t, err)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		bitget, server := newTestBitgetFuture(t)
+
+		limit, err := bitget.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 95, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Equal(t, "ninjabot-1", server.bodies[len(server.bodies)-2]["clientOid"])
+
+		takeProfit, err := bitget.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeTakeProfitLimit, Quantity: 0.5, Price: 120, Stop: 120, ClientOrderID: "ninjabot-2"})
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+
+		found, err := bitget.OrderByClientID("BTCUSDT", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, limit.ExchangeID, found.ExchangeID)
+		require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+		found, err = bitget.OrderByClientID("BTCUSDT", "ninjabot-2")
+		require.NoError(t, err)
+		require.Equal(t, takeProfit.ExchangeID, found.ExchangeID)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, found.Type)
+
+		_, err = bitget.OrderByClientID("BTCUSDT", "ninjabot-3")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		bitget, _ := newTestBitgetFuture(t)
+		account, err := bitget.Account()
+		require.NoError(t, err)
+		require.Equal(t, []model.Balance{
+			{Asset: "BTC", Free: -0.5, Leverage: 10},
+			{Asset: "USDT", Free: 900, Lock: 100},
+		}, account.Balances)
+		require.Equal(t, 900.0, account.Available)
+
+		asset, quote, err := bitget.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+		require.Equal(t, 900.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		bitget, _ := newTestBitgetFuture(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, _ := bitget.AccountSubscription(ctx)
+		order := <-updates
+		require.Equal(t, int64(7), order.ExchangeID)
+		require.Equal(t, "BTCUSDT", order.Pair)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.SideTypeSell, order.Side)
+		require.Equal(t, 99.5, order.Price)
+		require.Equal(t, 0.5, order.Quantity)
+	})
+}
@@ -0,0 +1,1215 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/jpillora/backoff"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	bybitEndpoint              = "https://api.bybit.com"
+	bybitStreamEndpoint        = "wss://stream.bybit.com/v5/public/linear"
+	bybitPrivateStreamEndpoint = "wss://stream.bybit.com/v5/private"
+
+	bybitTestnetEndpoint              = "https://api-testnet.bybit.com"
+	bybitTestnetStreamEndpoint        = "wss://stream-testnet.bybit.com/v5/public/linear"
+	bybitTestnetPrivateStreamEndpoint = "wss://stream-testnet.bybit.com/v5/private"
+
+	bybitRecvWindow = "5000"
+	// bybitKlineLimit is the maximum number of candles returned by a kline request
+	bybitKlineLimit = 1000
+
+	// trigger directions of conditional orders
+	bybitTriggerRise = 1
+	bybitTriggerFall = 2
+
+	// Bybit error codes that can be safely ignored at startup
+	bybitErrLeverageNotModified   = 110043
+	bybitErrMarginModeNotModified = 110026
+)
+
+// BybitError is an error returned by the Bybit API
+type BybitError struct {
+	Code    int
+	Message string
+}
+
+func (e *BybitError) Error() string {
+	return fmt.Sprintf("bybit error %d: %s", e.Code, e.Message)
+}
+
+// BybitFuture is the Bybit USDT perpetual exchange, using the V5 API of unified trading accounts.
+// Bybit order ids are strings, so orders are created with a numeric client order id (orderLinkId)
+// used as the ninjabot ExchangeID.
+type BybitFuture struct {
+	ctx        context.Context
+	client     *http.Client
+	assetsInfo map[string]model.AssetInfo
+	lastID     int64
+	HeikinAshi bool
+	Testnet    bool
+
+	APIKey    string
+	APISecret string
+
+	// Endpoint, StreamEndpoint and PrivateStreamEndpoint override the REST, public and private
+	// websocket URLs, eg: for a mock server
+	Endpoint              string
+	StreamEndpoint        string
+	PrivateStreamEndpoint string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+	PairOptions      []PairOption
+}
+
+type BybitFutureOption func(*BybitFuture)
+
+// WithBybitFutureCredentials will set the credentials for Bybit
+func WithBybitFutureCredentials(key, secret string) BybitFutureOption {
+	return func(b *BybitFuture) {
+		b.APIKey = key
+		b.APISecret = secret
+	}
+}
+
+// WithBybitFutureTestnet will use the Bybit testnet
+func WithBybitFutureTestnet() BybitFutureOption {
+	return func(b *BybitFuture) {
+		b.Testnet = true
+	}
+}
+
+// WithBybitFutureHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithBybitFutureHeikinAshiCandle() BybitFutureOption {
+	return func(b *BybitFuture) {
+		b.HeikinAshi = true
+	}
+}
+
+// WithBybitFutureMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithBybitFutureMetadataFetcher(fetcher MetadataFetchers) BybitFutureOption {
+	return func(b *BybitFuture) {
+		b.MetadataFetchers = append(b.MetadataFetchers, fetcher)
+	}
+}
+
+// WithBybitFutureLeverage will set the leverage and margin type for a pair
+func WithBybitFutureLeverage(pair string, leverage int, marginType MarginType) BybitFutureOption {
+	return func(b *BybitFuture) {
+		b.PairOptions = append(b.PairOptions, PairOption{
+			Pair:       strings.ToUpper(pair),
+			Leverage:   leverage,
+			MarginType: marginType,
+		})
+	}
+}
+
+// WithBybitFutureEndpoint overrides the REST, public and private websocket endpoints
+func WithBybitFutureEndpoint(endpoint, streamEndpoint, privateStreamEndpoint string) BybitFutureOption {
+	return func(b *BybitFuture) {
+		b.Endpoint = endpoint
+		b.StreamEndpoint = streamEndpoint
+		b.PrivateStreamEndpoint = privateStreamEndpoint
+	}
+}
+
+// WithBybitFutureHTTPClient sets the HTTP client used by REST requests
+func WithBybitFutureHTTPClient(client *http.Client) BybitFutureOption {
+	return func(b *BybitFuture) {
+		b.client = client
+	}
+}
+
+// NewBybitFuture will create a new BybitFuture instance
+func NewBybitFuture(ctx context.Context, options ...BybitFutureOption) (*BybitFuture, error) {
+	exchange := &BybitFuture{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		lastID:          time.Now().UnixNano() / int64(time.Microsecond),
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.Endpoint == "" {
+		exchange.Endpoint, exchange.StreamEndpoint, exchange.PrivateStreamEndpoint =
+			bybitEndpoint, bybitStreamEndpoint, bybitPrivateStreamEndpoint
+		if exchange.Testnet {
+			exchange.Endpoint, exchange.StreamEndpoint, exchange.PrivateStreamEndpoint =
+				bybitTestnetEndpoint, bybitTestnetStreamEndpoint, bybitTestnetPrivateStreamEndpoint
+		}
+	}
+
+	err := exchange.request(ctx, http.MethodGet, "/v5/market/time", nil, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("bybit ping fail: %w", err)
+	}
+
+	// Initialize with orders precision and assets limits
+	exchange.assetsInfo, err = exchange.instruments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set leverage and margin type
+	for _, option := range exchange.PairOptions {
+		if err := exchange.setLeverage(ctx, option); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("[SETUP] Using Bybit Futures exchange")
+
+	return exchange, nil
+}
+
+type bybitResponse struct {
+	RetCode int             `json:"retCode"`
+	RetMsg  string          `json:"retMsg"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// request sends a REST request, GET params are sent in the query string and POST params in a JSON body.
+// Signed requests are authenticated with the HMAC signature of the timestamp, key and payload.
+func (b *BybitFuture) request(ctx context.Context, method, path string, params map[string]interface{},
+	signed bool, result interface{}) error {
+
+	var payload string
+	endpoint := b.Endpoint + path
+	if method == http.MethodGet {
+		query := url.Values{}
+		for key, value := range params {
+			query.Set(key, fmt.Sprint(value))
+		}
+		payload = query.Encode()
+		if payload != "" {
+			endpoint += "?" + payload
+		}
+	} else {
+		body, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		payload = string(body)
+	}
+
+	var body io.Reader
+	if method != http.MethodGet {
+		body = bytes.NewBufferString(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		req.Header.Set("X-BAPI-API-KEY", b.APIKey)
+		req.Header.Set("X-BAPI-TIMESTAMP", timestamp)
+		req.Header.Set("X-BAPI-RECV-WINDOW", bybitRecvWindow)
+		req.Header.Set("X-BAPI-SIGN", b.sign(timestamp+b.APIKey+bybitRecvWindow+payload))
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response bybitResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("bybit %s %s: status %d: %w", method, path, resp.StatusCode, err)
+	}
+
+	if response.RetCode != 0 {
+		return &BybitError{Code: response.RetCode, Message: response.RetMsg}
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+func (b *BybitFuture) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(b.APISecret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type bybitInstrument struct {
+	Symbol        string `json:"symbol"`
+	BaseCoin      string `json:"baseCoin"`
+	QuoteCoin     string `json:"quoteCoin"`
+	PriceScale    string `json:"priceScale"`
+	LotSizeFilter struct {
+		MaxOrderQty string `json:"maxOrderQty"`
+		MinOrderQty string `json:"minOrderQty"`
+		QtyStep     string `json:"qtyStep"`
+	} `json:"lotSizeFilter"`
+	PriceFilter struct {
+		MinPrice string `json:"minPrice"`
+		MaxPrice string `json:"maxPrice"`
+		TickSize string `json:"tickSize"`
+	} `json:"priceFilter"`
+}
+
+func (b *BybitFuture) instruments(ctx context.Context) (map[string]model.AssetInfo, error) {
+	assetsInfo := make(map[string]model.AssetInfo)
+	params := map[string]interface{}{"category": "linear", "limit": 1000}
+	for {
+		var result struct {
+			List           []bybitInstrument `json:"list"`
+			NextPageCursor string            `json:"nextPageCursor"`
+		}
+		if err := b.request(ctx, http.MethodGet, "/v5/market/instruments-info", params, false, &result); err != nil {
+			return nil, err
+		}
+
+		for _, instrument := range result.List {
+			info := model.AssetInfo{
+				BaseAsset:  instrument.BaseCoin,
+				QuoteAsset: instrument.QuoteCoin,
+			}
+			info.MinQuantity, _ = strconv.ParseFloat(instrument.LotSizeFilter.MinOrderQty, 64)
+			info.MaxQuantity, _ = strconv.ParseFloat(instrument.LotSizeFilter.MaxOrderQty, 64)
+			info.StepSize, _ = strconv.ParseFloat(instrument.LotSizeFilter.QtyStep, 64)
+			info.MinPrice, _ = strconv.ParseFloat(instrument.PriceFilter.MinPrice, 64)
+			info.MaxPrice, _ = strconv.ParseFloat(instrument.PriceFilter.MaxPrice, 64)
+			info.TickSize, _ = strconv.ParseFloat(instrument.PriceFilter.TickSize, 64)
+			info.PricePrecision, _ = strconv.Atoi(instrument.PriceScale)
+			info.BaseAssetPrecision = getDecimalPrecision(info.StepSize)
+			info.QuotePrecision = getDecimalPrecision(info.TickSize)
+			assetsInfo[instrument.Symbol] = info
+			RegisterPair(instrument.Symbol, info.BaseAsset, info.QuoteAsset)
+		}
+
+		if result.NextPageCursor == "" {
+			return assetsInfo, nil
+		}
+		params["cursor"] = result.NextPageCursor
+	}
+}
+
+func (b *BybitFuture) setLeverage(ctx context.Context, option PairOption) error {
+	leverage := strconv.Itoa(option.Leverage)
+	if option.MarginType != "" {
+		tradeMode := 0
+		if option.MarginType == MarginTypeIsolated {
+			tradeMode = 1
+		}
+		err := b.request(ctx, http.MethodPost, "/v5/position/switch-isolated", map[string]interface{}{
+			"category":     "linear",
+			"symbol":       option.Pair,
+			"tradeMode":    tradeMode,
+			"buyLeverage":  leverage,
+			"sellLeverage": leverage,
+		}, true, nil)
+		var apiError *BybitError
+		if err != nil && (!errors.As(err, &apiError) || apiError.Code != bybitErrMarginModeNotModified) {
+			return err
+		}
+	}
+
+	err := b.request(ctx, http.MethodPost, "/v5/position/set-leverage", map[string]interface{}{
+		"category":     "linear",
+		"symbol":       option.Pair,
+		"buyLeverage":  leverage,
+		"sellLeverage": leverage,
+	}, true, nil)
+	var apiError *BybitError
+	if err != nil && (!errors.As(err, &apiError) || apiError.Code != bybitErrLeverageNotModified) {
+		return err
+	}
+	return nil
+}
+
+func (b *BybitFuture) LastQuote(ctx context.Context, pair string) (float64, error) {
+	candles, err := b.CandlesByLimit(ctx, pair, "1m", 1)
+	if err != nil || len(candles) < 1 {
+		return 0, err
+	}
+	return candles[0].Close, nil
+}
+
+func (b *BybitFuture) AssetsInfo(pair string) model.AssetInfo {
+	return b.assetsInfo[pair]
+}
+
+func (b *BybitFuture) validate(pair string, quantity float64) error {
+	info, ok := b.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (b *BybitFuture) formatPrice(pair string, value float64) string {
+	if info, ok := b.assetsInfo[pair]; ok {
+		precision := getDecimalPrecision(info.TickSize)
+		value = common.AmountToLotSize(info.TickSize, precision, value)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (b *BybitFuture) formatQuantity(pair string, value float64) string {
+	if info, ok := b.assetsInfo[pair]; ok {
+		value = common.AmountToLotSize(info.StepSize, info.BaseAssetPrecision, value)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func bybitSide(side model.SideType) string {
+	if side == model.SideTypeSell {
+		return "Sell"
+	}
+	return "Buy"
+}
+
+// createOrder places an order with a client order id, a new one when the id is zero, and returns its current state
+func (b *BybitFuture) createOrder(pair string, id int64, params map[string]interface{}) (model.Order, error) {
+	if id == 0 {
+		id = atomic.AddInt64(&b.lastID, 1)
+	}
+	params["category"] = "linear"
+	params["symbol"] = pair
+	params["orderLinkId"] = strconv.FormatInt(id, 10)
+
+	err := b.request(b.ctx, http.MethodPost, "/v5/order/create", params, true, nil)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return b.Order(pair, id)
+}
+
+func (b *BybitFuture) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: bybit oco", ErrUnsupportedOrder)
+}
+
+func (b *BybitFuture) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return b.createOrderLimit(side, pair, quantity, limit, 0)
+}
+
+func (b *BybitFuture) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return b.createOrder(pair, id, map[string]interface{}{
+		"side":        bybitSide(side),
+		"orderType":   "Limit",
+		"qty":         b.formatQuantity(pair, quantity),
+		"price":       b.formatPrice(pair, limit),
+		"timeInForce": "GTC",
+	})
+}
+
+func (b *BybitFuture) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+	return b.createOrderMarket(side, pair, quantity, reduceOnly, 0)
+}
+
+func (b *BybitFuture) createOrderMarket(side model.SideType, pair string, quantity float64, reduceOnly bool,
+	id int64) (model.Order, error) {
+
+	err := b.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return b.createOrder(pair, id, map[string]interface{}{
+		"side":       bybitSide(side),
+		"orderType":  "Market",
+		"qty":        b.formatQuantity(pair, quantity),
+		"reduceOnly": reduceOnly,
+	})
+}
+
+func (b *BybitFuture) CreateOrderMarketQuote(_ model.SideType, _ string, _ float64) (model.Order, error) {
+	return model.Order{}, fmt.Errorf("%w: bybit market order by quote", ErrUnsupportedOrder)
+}
+
+// CreateOrderStop places a stop market order, following the same semantics of BinanceFuture:
+// a negative limit creates a buy stop, and a zero quantity closes the whole position
+func (b *BybitFuture) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	side := model.SideTypeSell
+	if limit < 0 {
+		side = model.SideTypeBuy
+		limit = -limit
+	}
+	return b.createOrderStop(side, pair, quantity, limit, 0)
+}
+
+func (b *BybitFuture) createOrderStop(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+	direction := bybitTriggerFall
+	if side == model.SideTypeBuy {
+		direction = bybitTriggerRise
+	}
+
+	params := map[string]interface{}{
+		"side":             bybitSide(side),
+		"orderType":        "Market",
+		"triggerPrice":     b.formatPrice(pair, limit),
+		"triggerDirection": direction,
+	}
+	if quantity > 0 {
+		if err := b.validate(pair, quantity); err != nil {
+			return model.Order{}, err
+		}
+		params["qty"] = b.formatQuantity(pair, quantity)
+	} else {
+		params["qty"] = "0"
+		params["reduceOnly"] = true
+		params["closeOnTrigger"] = true
+	}
+
+	return b.createOrder(pair, id, params)
+}
+
+// TakeProfit places a conditional order triggered at the limit price, a limit order for a given quantity
+// or a market order closing the whole position when the quantity is zero
+func (b *BybitFuture) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (model.Order, error) {
+	return b.takeProfit(side, pair, quantity, limit, 0)
+}
+
+func (b *BybitFuture) takeProfit(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+
+	direction := bybitTriggerRise
+	if side == model.SideTypeBuy {
+		direction = bybitTriggerFall
+	}
+
+	params := map[string]interface{}{
+		"side":             bybitSide(side),
+		"triggerPrice":     b.formatPrice(pair, limit),
+		"triggerDirection": direction,
+	}
+	if quantity > 0 {
+		if err := b.validate(pair, quantity); err != nil {
+			return model.Order{}, err
+		}
+		params["orderType"] = "Limit"
+		params["qty"] = b.formatQuantity(pair, quantity)
+		params["price"] = b.formatPrice(pair, limit)
+	} else {
+		params["orderType"] = "Market"
+		params["qty"] = "0"
+		params["reduceOnly"] = true
+		params["closeOnTrigger"] = true
+	}
+
+	return b.createOrder(pair, id, params)
+}
+
+// CreateOrderRequest places an order with the client order ID of the request. The orderLinkId of the order,
+// its ExchangeID, is a number derived from the client order ID.
+func (b *BybitFuture) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	id := clientOrderNumber(request.ClientOrderID)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: bybit time in force %s", ErrUnsupportedOrder, request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: bybit iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = b.createOrderLimit(request.Side, request.Pair, request.Quantity, request.Price, id)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			return b.CreateOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity)
+		}
+		order, err = b.createOrderMarket(request.Side, request.Pair, request.Quantity, request.ReduceOnly, id)
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		order, err = b.createOrderStop(request.Side, request.Pair, request.Quantity, request.Stop, id)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = b.takeProfit(request.Side, request.Pair, request.Quantity, request.Stop, id)
+	default:
+		return model.Order{}, fmt.Errorf("%w: bybit %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns the order of a client order ID, or ErrOrderNotFound
+func (b *BybitFuture) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	order, err := b.findOrder(pair, clientOrderNumber(clientOrderID))
+	if err != nil {
+		return model.Order{}, err
+	}
+	if order == nil {
+		return model.Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, clientOrderID)
+	}
+
+	order.ClientOrderID = clientOrderID
+	return *order, nil
+}
+
+func (b *BybitFuture) Cancel(order model.Order) error {
+	return b.request(b.ctx, http.MethodPost, "/v5/order/cancel", map[string]interface{}{
+		"category":    "linear",
+		"symbol":      order.Pair,
+		"orderLinkId": strconv.FormatInt(order.ExchangeID, 10),
+	}, true, nil)
+}
+
+func (b *BybitFuture) CancelOpenOrders(pair string) error {
+	return b.request(b.ctx, http.MethodPost, "/v5/order/cancel-all", map[string]interface{}{
+		"category": "linear",
+		"symbol":   pair,
+	}, true, nil)
+}
+
+func (b *BybitFuture) orders(path string, params map[string]interface{}) ([]model.Order, error) {
+	params["category"] = "linear"
+
+	var result struct {
+		List []bybitOrder `json:"list"`
+	}
+	if err := b.request(b.ctx, http.MethodGet, path, params, true, &result); err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(result.List))
+	for _, order := range result.List {
+		orders = append(orders, order.toModel())
+	}
+	return orders, nil
+}
+
+func (b *BybitFuture) OpenOrders(pair string) ([]model.Order, error) {
+	return b.orders("/v5/order/realtime", map[string]interface{}{"symbol": pair})
+}
+
+func (b *BybitFuture) Orders(pair string, limit int) ([]model.Order, error) {
+	return b.orders("/v5/order/history", map[string]interface{}{"symbol": pair, "limit": limit})
+}
+
+// Order returns an order by its client order id, from the open and recent orders, or the order history
+func (b *BybitFuture) Order(pair string, id int64) (model.Order, error) {
+	order, err := b.findOrder(pair, id)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if order == nil {
+		return model.Order{}, fmt.Errorf("bybit order %d not found", id)
+	}
+	return *order, nil
+}
+
+// findOrder returns an order by its client order id, nil when it is not found
+func (b *BybitFuture) findOrder(pair string, id int64) (*model.Order, error) {
+	for _, path := range []string{"/v5/order/realtime", "/v5/order/history"} {
+		orders, err := b.orders(path, map[string]interface{}{
+			"symbol":      pair,
+			"orderLinkId": strconv.FormatInt(id, 10),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(orders) > 0 {
+			return &orders[0], nil
+		}
+	}
+	return nil, nil
+}
+
+type bybitOrder struct {
+	OrderID          string `json:"orderId"`
+	OrderLinkID      string `json:"orderLinkId"`
+	Symbol           string `json:"symbol"`
+	Side             string `json:"side"`
+	OrderType        string `json:"orderType"`
+	StopOrderType    string `json:"stopOrderType"`
+	OrderStatus      string `json:"orderStatus"`
+	Price            string `json:"price"`
+	Qty              string `json:"qty"`
+	AvgPrice         string `json:"avgPrice"`
+	CumExecQty       string `json:"cumExecQty"`
+	TriggerPrice     string `json:"triggerPrice"`
+	TriggerDirection int    `json:"triggerDirection"`
+	CreatedTime      string `json:"createdTime"`
+	UpdatedTime      string `json:"updatedTime"`
+}
+
+func (o bybitOrder) toModel() model.Order {
+	id, _ := strconv.ParseInt(o.OrderLinkID, 10, 64)
+	created, _ := strconv.ParseInt(o.CreatedTime, 10, 64)
+	updated, _ := strconv.ParseInt(o.UpdatedTime, 10, 64)
+
+	order := model.Order{
+		ExchangeID: id,
+		Pair:       o.Symbol,
+		Side:       model.SideType(strings.ToUpper(o.Side)),
+		Status:     bybitOrderStatus(o.OrderStatus),
+		CreatedAt:  time.Unix(0, created*int64(time.Millisecond)),
+		UpdatedAt:  time.Unix(0, updated*int64(time.Millisecond)),
+	}
+
+	trigger, _ := strconv.ParseFloat(o.TriggerPrice, 64)
+	if trigger > 0 {
+		order.Stop = &trigger
+	}
+
+	// conditional orders are stops when triggered against the position, take profits otherwise
+	stopDirection := bybitTriggerFall
+	if order.Side == model.SideTypeBuy {
+		stopDirection = bybitTriggerRise
+	}
+	switch {
+	case trigger > 0 && o.TriggerDirection == stopDirection && o.OrderType == "Limit":
+		order.Type = model.OrderTypeStopLossLimit
+	case trigger > 0 && o.TriggerDirection == stopDirection:
+		order.Type = model.OrderTypeStopLoss
+	case trigger > 0 && o.OrderType == "Limit":
+		order.Type = model.OrderTypeTakeProfitLimit
+	case trigger > 0:
+		order.Type = model.OrderTypeTakeProfit
+	case o.OrderType == "Limit":
+		order.Type = model.OrderTypeLimit
+	default:
+		order.Type = model.OrderTypeMarket
+	}
+
+	var err error
+	executed, _ := strconv.ParseFloat(o.CumExecQty, 64)
+	average, _ := strconv.ParseFloat(o.AvgPrice, 64)
+	if executed > 0 && average > 0 {
+		order.Price, order.Quantity = average, executed
+	} else {
+		order.Price, err = strconv.ParseFloat(o.Price, 64)
+		log.CheckErr(log.WarnLevel, err)
+		if order.Price == 0 {
+			order.Price = trigger
+		}
+		order.Quantity, err = strconv.ParseFloat(o.Qty, 64)
+		log.CheckErr(log.WarnLevel, err)
+	}
+
+	return order
+}
+
+func bybitOrderStatus(status string) model.OrderStatusType {
+	switch status {
+	case "PartiallyFilled":
+		return model.OrderStatusTypePartiallyFilled
+	case "Filled":
+		return model.OrderStatusTypeFilled
+	case "Cancelled", "PartiallyFilledCanceled", "Deactivated":
+		return model.OrderStatusTypeCanceled
+	case "Rejected":
+		return model.OrderStatusTypeRejected
+	default:
+		// New, Untriggered and Triggered orders are still open
+		return model.OrderStatusTypeNew
+	}
+}
+
+func (b *BybitFuture) Account() (model.Account, error) {
+	var positions struct {
+		List []struct {
+			Symbol   string `json:"symbol"`
+			Side     string `json:"side"`
+			Size     string `json:"size"`
+			Leverage string `json:"leverage"`
+		} `json:"list"`
+	}
+	err := b.request(b.ctx, http.MethodGet, "/v5/position/list", map[string]interface{}{
+		"category":   "linear",
+		"settleCoin": "USDT",
+	}, true, &positions)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0)
+	for _, position := range positions.List {
+		free, err := strconv.ParseFloat(position.Size, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		if free == 0 {
+			continue
+		}
+
+		leverage, err := strconv.ParseFloat(position.Leverage, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		if position.Side == "Sell" {
+			free = -free
+		}
+
+		asset, _ := SplitAssetQuote(position.Symbol)
+		balances = append(balances, model.Balance{
+			Asset:    asset,
+			Free:     free,
+			Leverage: leverage,
+		})
+	}
+
+	var wallet struct {
+		List []struct {
+			TotalAvailableBalance string `json:"totalAvailableBalance"`
+			Coin                  []struct {
+				Coin            string `json:"coin"`
+				WalletBalance   string `json:"walletBalance"`
+				TotalPositionIM string `json:"totalPositionIM"`
+				TotalOrderIM    string `json:"totalOrderIM"`
+			} `json:"coin"`
+		} `json:"list"`
+	}
+	err = b.request(b.ctx, http.MethodGet, "/v5/account/wallet-balance", map[string]interface{}{
+		"accountType": "UNIFIED",
+	}, true, &wallet)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	account := model.Account{}
+	for _, item := range wallet.List {
+		for _, coin := range item.Coin {
+			total, err := strconv.ParseFloat(coin.WalletBalance, 64)
+			if err != nil {
+				return model.Account{}, err
+			}
+
+			if total == 0 {
+				continue
+			}
+
+			positionMargin, _ := strconv.ParseFloat(coin.TotalPositionIM, 64)
+			orderMargin, _ := strconv.ParseFloat(coin.TotalOrderIM, 64)
+			balances = append(balances, model.Balance{
+				Asset: coin.Coin,
+				Free:  total - positionMargin - orderMargin,
+				Lock:  positionMargin + orderMargin,
+			})
+		}
+
+		if available, err := strconv.ParseFloat(item.TotalAvailableBalance, 64); err == nil {
+			account.Available += available
+		}
+	}
+
+	account.Balances = balances
+	return account, nil
+}
+
+func (b *BybitFuture) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	acc, err := b.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free, nil
+}
+
+// PositionRisk returns the size of the position, BybitFuture does not provide position details
+func (b *BybitFuture) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(b, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, BybitFuture does not support amending orders
+func (b *BybitFuture) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(b, order, price, quantity)
+}
+
+// bybitInterval converts a ninjabot timeframe into a Bybit kline interval, eg: 1h => 60, 1d => D
+func bybitInterval(period string) (string, error) {
+	if len(period) < 2 {
+		return "", fmt.Errorf("invalid bybit interval %s", period)
+	}
+
+	value, err := strconv.Atoi(period[:len(period)-1])
+	if err != nil {
+		return "", fmt.Errorf("invalid bybit interval %s: %w", period, err)
+	}
+
+	switch period[len(period)-1] {
+	case 'm':
+		return strconv.Itoa(value), nil
+	case 'h':
+		return strconv.Itoa(value * 60), nil
+	case 'd':
+		if value == 1 {
+			return "D", nil
+		}
+	case 'w':
+		if value == 1 {
+			return "W", nil
+		}
+	case 'M':
+		if value == 1 {
+			return "M", nil
+		}
+	}
+	return "", fmt.Errorf("invalid bybit interval %s", period)
+}
+
+// klines returns the candles of a period, in chronological order
+func (b *BybitFuture) klines(ctx context.Context, pair, period string,
+	params map[string]interface{}) ([]model.Candle, error) {
+
+	interval, err := bybitInterval(period)
+	if err != nil {
+		return nil, err
+	}
+
+	params["category"] = "linear"
+	params["symbol"] = pair
+	params["interval"] = interval
+
+	var result struct {
+		List [][]string `json:"list"`
+	}
+	if err := b.request(ctx, http.MethodGet, "/v5/market/kline", params, false, &result); err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0, len(result.List))
+	for _, kline := range result.List {
+		candle, err := BybitCandleFromKline(pair, kline)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, candle)
+	}
+
+	// bybit returns the newest candles first
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return candles, nil
+}
+
+func (b *BybitFuture) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	candles, err := b.klines(ctx, pair, period, map[string]interface{}{"limit": limit + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) == 0 {
+		return candles, nil
+	}
+
+	if b.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	// discard last candle, because it is incomplete
+	return candles[:len(candles)-1], nil
+}
+
+func (b *BybitFuture) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	candles := make([]model.Candle, 0)
+	ha := model.NewHeikinAshi()
+	for !start.After(end) {
+		data, err := b.klines(ctx, pair, period, map[string]interface{}{
+			"start": start.UnixNano() / int64(time.Millisecond),
+			"end":   end.UnixNano() / int64(time.Millisecond),
+			"limit": bybitKlineLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, candle := range data {
+			if b.HeikinAshi {
+				candle = candle.ToHeikinAshi(ha)
+			}
+			candles = append(candles, candle)
+		}
+
+		if len(data) < bybitKlineLimit {
+			break
+		}
+		start = data[len(data)-1].Time.Add(time.Millisecond)
+	}
+
+	return candles, nil
+}
+
+func (b *BybitFuture) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		interval, err := bybitInterval(period)
+		if err != nil {
+			cerr <- err
+			close(cerr)
+			close(ccandle)
+			return
+		}
+
+		topic := fmt.Sprintf("kline.%s.%s", interval, pair)
+		subscribe := map[string]interface{}{"op": "subscribe", "args": []string{topic}}
+
+		for {
+			done, stop, err := wsServeJSON(b.StreamEndpoint, []interface{}{subscribe}, bybitPing,
+				func(message []byte) {
+					var event struct {
+						Topic string            `json:"topic"`
+						Data  []bybitKlineEvent `json:"data"`
+					}
+					if err := json.Unmarshal(message, &event); err != nil || event.Topic != topic {
+						return
+					}
+
+					ba.Reset()
+					for _, kline := range event.Data {
+						candle := kline.toCandle(pair)
+
+						if candle.Complete && b.HeikinAshi {
+							candle = candle.ToHeikinAshi(ha)
+						}
+
+						if candle.Complete {
+							// fetch aditional data if needed
+							fetchMetadata(ctx, b.MetadataFetchers, b.MetadataTimeout, &b.metadataKeys, &candle)
+						}
+
+						select {
+						case ccandle <- candle:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}, func(err error) {
+					select {
+					case cerr <- err:
+					case <-ctx.Done():
+					}
+				})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				// wait for the stream handlers before closing the channels
+				close(stop)
+				<-done
+				close(cerr)
+				close(ccandle)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (b *BybitFuture) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("bybit")
+}
+
+// AccountSubscription streams the order updates of the private websocket, it reconnects until the context is done
+func (b *BybitFuture) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+
+		for {
+			expires := time.Now().Add(10*time.Second).UnixNano() / int64(time.Millisecond)
+			auth := map[string]interface{}{
+				"op":   "auth",
+				"args": []interface{}{b.APIKey, expires, b.sign(fmt.Sprintf("GET/realtime%d", expires))},
+			}
+			subscribe := map[string]interface{}{"op": "subscribe", "args": []string{"order.linear"}}
+
+			done, stop, err := wsServeJSON(b.PrivateStreamEndpoint, []interface{}{auth, subscribe}, bybitPing,
+				func(message []byte) {
+					var event struct {
+						Op      string       `json:"op"`
+						Success *bool        `json:"success"`
+						RetMsg  string       `json:"ret_msg"`
+						Topic   string       `json:"topic"`
+						Data    []bybitOrder `json:"data"`
+					}
+					if err := json.Unmarshal(message, &event); err != nil {
+						return
+					}
+
+					if event.Op == "auth" && event.Success != nil && !*event.Success {
+						select {
+						case cerr <- fmt.Errorf("bybit auth fail: %s", event.RetMsg):
+						case <-ctx.Done():
+						}
+						return
+					}
+
+					if !strings.HasPrefix(event.Topic, "order") {
+						return
+					}
+
+					ba.Reset()
+					for _, order := range event.Data {
+						select {
+						case corder <- order.toModel():
+						case <-ctx.Done():
+							return
+						}
+					}
+				}, func(err error) {
+					select {
+					case cerr <- err:
+					case <-ctx.Done():
+					}
+				})
+			if err != nil {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					close(cerr)
+					close(corder)
+					return
+				}
+				time.Sleep(ba.Duration())
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				close(stop)
+				<-done
+				close(cerr)
+				close(corder)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return corder, cerr
+}
+
+var bybitPing = map[string]string{"op": "ping"}
+
+type bybitKlineEvent struct {
+	Start   int64  `json:"start"`
+	Open    string `json:"open"`
+	Close   string `json:"close"`
+	High    string `json:"high"`
+	Low     string `json:"low"`
+	Volume  string `json:"volume"`
+	Confirm bool   `json:"confirm"`
+}
+
+func (k bybitKlineEvent) toCandle(pair string) model.Candle {
+	var err error
+	t := time.Unix(0, k.Start*int64(time.Millisecond))
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t}
+	candle.Open, err = strconv.ParseFloat(k.Open, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.Close, err = strconv.ParseFloat(k.Close, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.High, err = strconv.ParseFloat(k.High, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.Low, err = strconv.ParseFloat(k.Low, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.Volume, err = strconv.ParseFloat(k.Volume, 64)
+	log.CheckErr(log.WarnLevel, err)
+	candle.Complete = k.Confirm
+	candle.Metadata = make(map[string]float64)
+	return candle
+}
+
+// BybitCandleFromKline converts a REST kline, a list of start time, open, high, low, close, volume and turnover
+func BybitCandleFromKline(pair string, kline []string) (model.Candle, error) {
+	if len(kline) < 6 {
+		return model.Candle{}, fmt.Errorf("invalid bybit kline: %v", kline)
+	}
+
+	start, err := strconv.ParseInt(kline[0], 10, 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	t := time.Unix(0, start*int64(time.Millisecond))
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Complete: true, Metadata: make(map[string]float64)}
+	for i, value := range []*float64{&candle.Open, &candle.High, &candle.Low, &candle.Close, &candle.Volume} {
+		if *value, err = strconv.ParseFloat(kline[i+1], 64); err != nil {
+			return model.Candle{}, err
+		}
+	}
+	return candle, nil
+}
@@ -0,0 +1,385 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// bybitServer emulates the subset of the Bybit V5 API used by BybitFuture
+type bybitServer struct {
+	*httptest.Server
+	mtx      sync.Mutex
+	orders   map[string]bybitOrder
+	leverage map[string]string
+	updates  chan bybitOrder
+}
+
+func newBybitServer(t *testing.T) *bybitServer {
+	s := &bybitServer{
+		orders:   make(map[string]bybitOrder),
+		leverage: make(map[string]string),
+		updates:  make(chan bybitOrder),
+	}
+
+	reply := func(w http.ResponseWriter, result interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"retCode": 0, "retMsg": "OK", "result": result})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v5/market/time", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]string{"timeSecond": "1640995200"})
+	})
+	mux.HandleFunc("/v5/market/instruments-info", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"list": []map[string]interface{}{{
+			"symbol": "BTCUSDT", "baseCoin": "BTC", "quoteCoin": "USDT", "priceScale": "2",
+			"lotSizeFilter": map[string]string{"maxOrderQty": "100", "minOrderQty": "0.001", "qtyStep": "0.001"},
+			"priceFilter":   map[string]string{"minPrice": "0.1", "maxPrice": "199999", "tickSize": "0.1"},
+		}}})
+	})
+	mux.HandleFunc("/v5/market/kline", func(w http.ResponseWriter, r *http.Request) {
+		// newest first, as returned by bybit
+		reply(w, map[string]interface{}{"list": [][]string{
+			{"1641002400000", "102", "104", "101", "103", "12", "1230"},
+			{"1640998800000", "101", "103", "100", "102", "11", "1120"},
+			{"1640995200000", "100", "102", "99", "101", "10", "1010"},
+		}})
+	})
+	mux.HandleFunc("/v5/position/set-leverage", func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+		s.mtx.Lock()
+		s.leverage[params["symbol"]] = params["buyLeverage"]
+		s.mtx.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"retCode": 110043, "retMsg": "leverage not modified"})
+	})
+	mux.HandleFunc("/v5/position/switch-isolated", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]string{})
+	})
+	mux.HandleFunc("/v5/order/create", func(w http.ResponseWriter, r *http.Request) {
+		require.NotEmpty(t, r.Header.Get("X-BAPI-SIGN"))
+		var params map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+
+		order := bybitOrder{
+			OrderID:     fmt.Sprintf("uuid-%s", params["orderLinkId"]),
+			OrderLinkID: params["orderLinkId"].(string),
+			Symbol:      params["symbol"].(string),
+			Side:        params["side"].(string),
+			OrderType:   params["orderType"].(string),
+			OrderStatus: "New",
+			Qty:         params["qty"].(string),
+			CreatedTime: "1640995200000",
+			UpdatedTime: "1640995200000",
+		}
+		if price, ok := params["price"]; ok {
+			order.Price = price.(string)
+		}
+		if trigger, ok := params["triggerPrice"]; ok {
+			order.TriggerPrice = trigger.(string)
+			order.TriggerDirection = int(params["triggerDirection"].(float64))
+			order.OrderStatus = "Untriggered"
+		} else if order.OrderType == "Market" {
+			order.OrderStatus = "Filled"
+			order.AvgPrice = "101.5"
+			order.CumExecQty = order.Qty
+		}
+
+		s.mtx.Lock()
+		s.orders[order.OrderLinkID] = order
+		s.mtx.Unlock()
+		reply(w, map[string]string{"orderId": order.OrderID, "orderLinkId": order.OrderLinkID})
+	})
+	orders := func(w http.ResponseWriter, r *http.Request) {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		list := make([]bybitOrder, 0)
+		for id, order := range s.orders {
+			if linkID := r.URL.Query().Get("orderLinkId"); linkID == "" || linkID == id {
+				list = append(list, order)
+			}
+		}
+		reply(w, map[string]interface{}{"list": list})
+	}
+	mux.HandleFunc("/v5/order/realtime", orders)
+	mux.HandleFunc("/v5/order/history", orders)
+	mux.HandleFunc("/v5/order/cancel", func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+		s.mtx.Lock()
+		order := s.orders[params["orderLinkId"]]
+		order.OrderStatus = "Cancelled"
+		s.orders[params["orderLinkId"]] = order
+		s.mtx.Unlock()
+		reply(w, map[string]string{})
+	})
+	mux.HandleFunc("/v5/position/list", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"list": []map[string]string{
+			{"symbol": "BTCUSDT", "side": "Sell", "size": "0.5", "leverage": "5"},
+			{"symbol": "ETHUSDT", "side": "", "size": "0", "leverage": "10"},
+		}})
+	})
+	mux.HandleFunc("/v5/account/wallet-balance", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "UNIFIED", r.URL.Query().Get("accountType"))
+		reply(w, map[string]interface{}{"list": []map[string]interface{}{{
+			"totalAvailableBalance": "900",
+			"coin": []map[string]string{
+				{"coin": "USDT", "walletBalance": "1000", "totalPositionIM": "80", "totalOrderIM": "20"},
+			},
+		}}})
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/v5/public/linear", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var subscribe struct {
+			Op   string   `json:"op"`
+			Args []string `json:"args"`
+		}
+		require.NoError(t, conn.ReadJSON(&subscribe))
+		require.Equal(t, "subscribe", subscribe.Op)
+
+		for i, confirm := range []bool{false, true} {
+			_ = conn.WriteJSON(map[string]interface{}{
+				"topic": subscribe.Args[0],
+				"type":  "snapshot",
+				"data": []map[string]interface{}{{
+					"start": 1640995200000, "open": "100", "close": fmt.Sprint(101 + i), "high": "102",
+					"low": "99", "volume": "10", "confirm": confirm,
+				}},
+			})
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+	mux.HandleFunc("/v5/private", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var auth struct {
+			Op   string        `json:"op"`
+			Args []interface{} `json:"args"`
+		}
+		require.NoError(t, conn.ReadJSON(&auth))
+		require.Equal(t, "auth", auth.Op)
+		require.Equal(t, "key", auth.Args[0])
+		_ = conn.WriteJSON(map[string]interface{}{"op": "auth", "success": true})
+
+		var subscribe map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&subscribe))
+
+		for order := range s.updates {
+			_ = conn.WriteJSON(map[string]interface{}{"topic": "order", "data": []bybitOrder{order}})
+		}
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		close(s.updates)
+		s.Server.Close()
+	})
+	return s
+}
+
+func newTestBybitFuture(t *testing.T, options ...BybitFutureOption) (*BybitFuture, *bybitServer) {
+	server := newBybitServer(t)
+	stream := "ws" + strings.TrimPrefix(server.URL, "http")
+	options = append([]BybitFutureOption{
+		WithBybitFutureCredentials("key", "secret"),
+		WithBybitFutureEndpoint(server.URL, stream+"/v5/public/linear", stream+"/v5/private"),
+	}, options...)
+
+	bybit, err := NewBybitFuture(context.Background(), options...)
+	require.NoError(t, err)
+	return bybit, server
+}
+
+func TestBybitFuture(t *testing.T) {
+	t.Run("assets info and leverage", func(t *testing.T) {
+		bybit, server := newTestBybitFuture(t, WithBybitFutureLeverage("btcusdt", 5, MarginTypeIsolated))
+
+		info := bybit.AssetsInfo("BTCUSDT")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USDT", info.QuoteAsset)
+		require.Equal(t, 0.001, info.MinQuantity)
+		require.Equal(t, 0.1, info.TickSize)
+		require.Equal(t, 3, info.BaseAssetPrecision)
+		require.Equal(t, "5", server.leverage["BTCUSDT"])
+
+		require.Equal(t, "0.123", bybit.formatQuantity("BTCUSDT", 0.12345))
+		require.Equal(t, "100.1", bybit.formatPrice("BTCUSDT", 100.15))
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		bybit, _ := newTestBybitFuture(t)
+
+		candles, err := bybit.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, 101.0, candles[0].Close)
+		require.Equal(t, 102.0, candles[1].Close)
+		require.True(t, candles[0].Time.Before(candles[1].Time))
+
+		start := time.Unix(1640995200, 0)
+		candles, err = bybit.CandlesByPeriod(context.Background(), "BTCUSDT", "1h", start, start.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 3)
+
+		quote, err := bybit.LastQuote(context.Background(), "BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 101.0, quote)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		bybit, _ := newTestBybitFuture(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		candles, _ := bybit.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		partial := <-candles
+		require.False(t, partial.Complete)
+		require.Equal(t, 101.0, partial.Close)
+
+		complete := <-candles
+		require.True(t, complete.Complete)
+		require.Equal(t, 102.0, complete.Close)
+		require.Equal(t, "BTCUSDT", complete.Pair)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		bybit, _ := newTestBybitFuture(t)
+
+		market, err := bybit.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.5, false)
+		require.NoError(t, err)
+		require.NotZero(t, market.ExchangeID)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, model.SideTypeBuy, market.Side)
+		require.Equal(t, 101.5, market.Price)
+		require.Equal(t, 0.5, market.Quantity)
+
+		limit, err := bybit.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.5, 120)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, 120.0, limit.Price)
+		require.NotEqual(t, market.ExchangeID, limit.ExchangeID)
+
+		stop, err := bybit.CreateOrderStop("BTCUSDT", 0.5, 90)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeSell, stop.Side)
+		require.Equal(t, 90.0, *stop.Stop)
+
+		takeProfit, err := bybit.TakeProfit(model.SideTypeSell, "BTCUSDT", 0, 130)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfit, takeProfit.Type)
+
+		require.NoError(t, bybit.Cancel(limit))
+		limit, err = bybit.Order("BTCUSDT", limit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, limit.Status)
+
+		var orderError *OrderError
+		_, err = bybit.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1000, false)
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+
+		_, err = bybit.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 120, 90, 89)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		bybit, _ := newTestBybitFuture(t)
+
+		limit, err := bybit.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 120, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, clientOrderNumber("ninjabot-1"), limit.ExchangeID)
+
+		stop, err := bybit.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Type: model.OrderTypeStopLoss, Quantity: 0.5, Stop: 130, ClientOrderID: "ninjabot-2"})
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeBuy, stop.Side)
+
+		found, err := bybit.OrderByClientID("BTCUSDT", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, limit.ExchangeID, found.ExchangeID)
+		require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+		found, err = bybit.OrderByClientID("BTCUSDT", "ninjabot-2")
+		require.NoError(t, err)
+		require.Equal(t, stop.ExchangeID, found.ExchangeID)
+
+		_, err = bybit.OrderByClientID("BTCUSDT", "ninjabot-3")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		bybit, _ := newTestBybitFuture(t)
+
+		account, err := bybit.Account()
+		require.NoError(t, err)
+		require.Equal(t, 900.0, account.Available)
+
+		btc, usdt := account.Balance("BTC", "USDT")
+		require.Equal(t, -0.5, btc.Free)
+		require.Equal(t, 5.0, btc.Leverage)
+		require.Equal(t, 900.0, usdt.Free)
+		require.Equal(t, 100.0, usdt.Lock)
+
+		asset, quote, err := bybit.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+		require.Equal(t, 900.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		bybit, server := newTestBybitFuture(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		orders, _ := bybit.AccountSubscription(ctx)
+		server.updates <- bybitOrder{
+			OrderLinkID: "42", Symbol: "BTCUSDT", Side: "Sell", OrderType: "Market", OrderStatus: "Filled",
+			Qty: "1", AvgPrice: "99", CumExecQty: "1", TriggerPrice: "99.5", TriggerDirection: bybitTriggerFall,
+		}
+
+		order := <-orders
+		require.Equal(t, int64(42), order.ExchangeID)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.OrderTypeStopLoss, order.Type)
+		require.Equal(t, 99.0, order.Price)
+	})
+}
+
+func TestBybitInterval(t *testing.T) {
+	tt := map[string]string{"1m": "1", "15m": "15", "1h": "60", "4h": "240", "1d": "D", "1w": "W", "1M": "M"}
+	for period, expected := range tt {
+		interval, err := bybitInterval(period)
+		require.NoError(t, err)
+		require.Equal(t, expected, interval)
+	}
+
+	for _, period := range []string{"", "h", "2d", "1y"} {
+		_, err := bybitInterval(period)
+		require.Error(t, err)
+	}
+}
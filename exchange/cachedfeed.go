@@ -0,0 +1,148 @@
+package exchange
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/storage"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// CachedFeeder is a feeder that persists the candles of CandlesByPeriod in a store, fetching from the
+// inner feeder only the periods missing in the store, eg: to speed up repeated backtests.
+// Candles still open are returned but not stored. Other methods are served by the inner feeder.
+type CachedFeeder struct {
+	service.Feeder
+	store storage.CandleStore
+	now   func() time.Time
+
+	mtx   sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewCachedFeeder wraps a feeder with a candle store, eg: storage.CandlesFromSQL
+func NewCachedFeeder(inner service.Feeder, store storage.CandleStore) *CachedFeeder {
+	return &CachedFeeder{
+		Feeder: inner,
+		store:  store,
+		now:    time.Now,
+		locks:  make(map[string]*sync.Mutex),
+	}
+}
+
+// lock serializes the requests of a pair and timeframe, so missing periods are downloaded once
+func (c *CachedFeeder) lock(pair, timeframe string) *sync.Mutex {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	key := pair + "--" + timeframe
+	if _, ok := c.locks[key]; !ok {
+		c.locks[key] = &sync.Mutex{}
+	}
+	return c.locks[key]
+}
+
+func (c *CachedFeeder) CandlesByPeriod(ctx context.Context, pair, timeframe string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	mtx := c.lock(pair, timeframe)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	ranges, err := c.store.Ranges(pair, timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	// candles are closed after their interval
+	closed := c.now().Add(-interval)
+	recent := make([]model.Candle, 0)
+	for _, missing := range missingRanges(ranges, storage.CandleRange{Start: start, End: end}, interval) {
+		candles, err := c.Feeder.CandlesByPeriod(ctx, pair, timeframe, missing.Start, missing.End)
+		if err != nil {
+			return nil, err
+		}
+
+		complete := make([]model.Candle, 0, len(candles))
+		for _, candle := range candles {
+			if candle.Time.After(closed) || !candle.Complete {
+				recent = append(recent, candle)
+				continue
+			}
+			complete = append(complete, candle)
+		}
+
+		if missing.End.After(closed) {
+			missing.End = closed
+		}
+		if missing.End.Before(missing.Start) {
+			continue
+		}
+
+		if err := c.store.Save(pair, timeframe, missing, complete); err != nil {
+			return nil, err
+		}
+		log.Debugf("[CACHE] %s %s: %d candles stored from %s to %s", pair, timeframe, len(complete),
+			missing.Start, missing.End)
+	}
+
+	candles, err := c.store.Candles(pair, timeframe, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recent) > 0 {
+		candles = append(candles, recent...)
+		sort.SliceStable(candles, func(i, j int) bool {
+			return candles[i].Time.Before(candles[j].Time)
+		})
+	}
+	return candles, nil
+}
+
+// missingRanges returns the periods of a request not covered by the stored ranges, ignoring the periods
+// without the open time of any candle
+func missingRanges(covered []storage.CandleRange, period storage.CandleRange,
+	interval time.Duration) []storage.CandleRange {
+
+	gaps := make([]storage.CandleRange, 0)
+	add := func(gap storage.CandleRange) {
+		first := gap.Start.Truncate(interval)
+		if first.Before(gap.Start) {
+			first = first.Add(interval)
+		}
+		if !first.After(gap.End) {
+			gaps = append(gaps, gap)
+		}
+	}
+
+	cursor := period.Start
+	for _, stored := range storage.MergeRanges(covered, time.Millisecond) {
+		if stored.End.Before(cursor) {
+			continue
+		}
+		if stored.Start.After(period.End) {
+			break
+		}
+		if stored.Start.After(cursor) {
+			add(storage.CandleRange{Start: cursor, End: stored.Start.Add(-time.Millisecond)})
+		}
+		cursor = stored.End.Add(time.Millisecond)
+	}
+
+	if !cursor.After(period.End) {
+		add(storage.CandleRange{Start: cursor, End: period.End})
+	}
+	return gaps
+}
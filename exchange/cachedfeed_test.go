@@ -0,0 +1,77 @@
+package exchange
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestCachedFeeder(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(20*time.Hour + 30*time.Minute)
+
+	var requests []storage.CandleRange
+	source := CandleSourceFunc(func(_ context.Context, pair, _ string, from, to time.Time) ([]model.Candle, error) {
+		requests = append(requests, storage.CandleRange{Start: from.UTC(), End: to.UTC()})
+		candles := make([]model.Candle, 0)
+		for t := from.Truncate(time.Hour); !t.After(to) && !t.After(now); t = t.Add(time.Hour) {
+			if t.Before(from) {
+				continue
+			}
+			candles = append(candles, model.Candle{
+				Pair: pair, Time: t, Close: float64(t.Sub(start) / time.Hour), Complete: true,
+			})
+		}
+		return candles, nil
+	})
+
+	store, err := storage.CandlesFromSQL(sqlite.Open(filepath.Join(t.TempDir(), "candles.db")), &gorm.Config{})
+	require.NoError(t, err)
+	feeder := NewCachedFeeder(NewCustomFeed(source), store)
+	feeder.now = func() time.Time {
+		return now
+	}
+
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+	candlesByPeriod := func(from, to int) []model.Candle {
+		candles, err := feeder.CandlesByPeriod(context.Background(), "BTCUSDT", "1h", at(from), at(to))
+		require.NoError(t, err)
+		require.Len(t, candles, to-from+1)
+		for i, candle := range candles {
+			require.Equal(t, float64(from+i), candle.Close)
+		}
+		return candles
+	}
+
+	candlesByPeriod(0, 10)
+	require.Equal(t, []storage.CandleRange{{Start: at(0), End: at(10)}}, requests)
+
+	// only the missing period is fetched
+	requests = nil
+	candlesByPeriod(5, 15)
+	require.Equal(t, []storage.CandleRange{{Start: at(10).Add(time.Millisecond), End: at(15)}}, requests)
+
+	requests = nil
+	candlesByPeriod(0, 15)
+	require.Empty(t, requests)
+
+	// the open candle of 20h is returned, but not stored
+	requests = nil
+	candlesByPeriod(14, 20)
+	require.Len(t, requests, 1)
+
+	requests = nil
+	candlesByPeriod(14, 20)
+	require.Equal(t, []storage.CandleRange{{Start: at(19).Add(30*time.Minute + time.Millisecond), End: at(20)}},
+		requests)
+}
@@ -0,0 +1,66 @@
+package exchange
+
+import (
+	"sync"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// candleGuard protects the feed pipeline against duplicated and out-of-order candles,
+// which usually happens after a websocket resubscription.
+type candleGuard struct {
+	mtx  sync.Mutex
+	last map[string]model.Candle
+}
+
+func newCandleGuard() *candleGuard {
+	return &candleGuard{
+		last: make(map[string]model.Candle),
+	}
+}
+
+// Accept returns the candle to deliver to subscribers of a given feed, and false when it is dropped. A closed
+// bar received again with different values replaces the stored bar, and is delivered as a repaired candle.
+func (g *candleGuard) Accept(key string, candle model.Candle) (model.Candle, bool) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	last, ok := g.last[key]
+	if !ok || candle.Time.After(last.Time) {
+		g.last[key] = candle
+		return candle, true
+	}
+
+	if candle.Time.Before(last.Time) {
+		log.Warnf("[FEED] out-of-order candle dropped %s: %s (last %s)",
+			key, candle.Time, last.Time)
+		return candle, false
+	}
+
+	// same bar: partial updates are accepted until the bar is closed
+	if !last.Complete {
+		g.last[key] = candle
+		return candle, true
+	}
+
+	if candle.Complete && (candle.Close != last.Close || candle.Open != last.Open ||
+		candle.High != last.High || candle.Low != last.Low || candle.Volume != last.Volume) {
+		log.Warnf("[FEED] overlapped candle with divergent values repaired %s: %s (close %f, received %f)",
+			key, candle.Time, last.Close, candle.Close)
+		candle.Repaired = true
+		g.last[key] = candle
+		return candle, true
+	}
+
+	log.Debugf("[FEED] duplicated candle dropped %s: %s", key, candle.Time)
+	return candle, false
+}
+
+// Last returns the last candle accepted in a feed
+func (g *candleGuard) Last(key string) (model.Candle, bool) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	last, ok := g.last[key]
+	return last, ok
+}
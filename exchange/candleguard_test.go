@@ -0,0 +1,72 @@
+package exchange
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestCandleGuard_Accept(t *testing.T) {
+	guard := newCandleGuard()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(minutes int, closePrice float64, complete bool) model.Candle {
+		return model.Candle{
+			Pair:     "BTCUSDT",
+			Time:     start.Add(time.Duration(minutes) * time.Minute),
+			Close:    closePrice,
+			Complete: complete,
+		}
+	}
+
+	accept := func(key string, candle model.Candle) bool {
+		_, ok := guard.Accept(key, candle)
+		return ok
+	}
+
+	require.True(t, accept("BTCUSDT--1m", candle(0, 1, false)))
+	require.True(t, accept("BTCUSDT--1m", candle(0, 2, false)))
+	require.True(t, accept("BTCUSDT--1m", candle(0, 3, true)))
+
+	// duplicated bar after resubscription
+	require.False(t, accept("BTCUSDT--1m", candle(0, 3, true)))
+	require.False(t, accept("BTCUSDT--1m", candle(0, 3, false)))
+
+	// other feeds are independent
+	require.True(t, accept("ETHUSDT--1m", candle(0, 3, true)))
+
+	require.True(t, accept("BTCUSDT--1m", candle(2, 5, true)))
+
+	// out-of-order
+	require.False(t, accept("BTCUSDT--1m", candle(1, 4, true)))
+}
+
+func TestCandleGuard_Repair(t *testing.T) {
+	guard := newCandleGuard()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	bar := model.Candle{Pair: "BTCUSDT", Time: start, Close: 3, Complete: true}
+
+	candle, ok := guard.Accept("BTCUSDT--1m", bar)
+	require.True(t, ok)
+	require.False(t, candle.Repaired)
+
+	// a closed bar received again with different values replaces the stored bar
+	bar.Close = 4
+	candle, ok = guard.Accept("BTCUSDT--1m", bar)
+	require.True(t, ok)
+	require.True(t, candle.Repaired)
+	require.Equal(t, 4.0, candle.Close)
+
+	last, ok := guard.Last("BTCUSDT--1m")
+	require.True(t, ok)
+	require.Equal(t, 4.0, last.Close)
+
+	// the repaired bar is not repaired twice, and partial updates of the closed bar are dropped
+	_, ok = guard.Accept("BTCUSDT--1m", bar)
+	require.False(t, ok)
+	bar.Close, bar.Complete = 5, false
+	_, ok = guard.Accept("BTCUSDT--1m", bar)
+	require.False(t, ok)
+}
@@ -0,0 +1,74 @@
+package exchange
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+// placeRequest places an order request with the order methods of a broker, without the client order ID.
+// Stop loss requests are stop limit orders at the stop price, as placed by CreateOrderStop, where buy stops
+// have a negative price.
+func placeRequest(broker service.Broker, request model.OrderRequest) (model.Order, error) {
+	switch request.Type {
+	case model.OrderTypeLimit, model.OrderTypeLimitMaker:
+		timeInForce := request.TimeInForce
+		if request.Type == model.OrderTypeLimitMaker {
+			timeInForce = model.TimeInForceGTX
+		}
+		options := model.OrderOptions{TimeInForce: timeInForce, IcebergQuantity: request.IcebergQuantity}
+		if optionsBroker, ok := broker.(service.OrderOptionsBroker); ok {
+			return optionsBroker.CreateOrderLimitOptions(request.Side, request.Pair, request.Quantity, request.Price,
+				options)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: iceberg order", ErrUnsupportedOrder)
+		}
+		if tifBroker, ok := broker.(service.TimeInForceBroker); ok {
+			return tifBroker.CreateOrderLimitTIF(request.Side, request.Pair, request.Quantity, request.Price,
+				timeInForce)
+		}
+		if timeInForce != "" && timeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: time in force %s", ErrUnsupportedOrder, timeInForce)
+		}
+		return broker.CreateOrderLimit(request.Side, request.Pair, request.Quantity, request.Price)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			return broker.CreateOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity)
+		}
+		return broker.CreateOrderMarket(request.Side, request.Pair, request.Quantity, request.ReduceOnly)
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		if request.Side == model.SideTypeBuy {
+			return broker.CreateOrderStop(request.Pair, request.Quantity, -request.Stop)
+		}
+		return broker.CreateOrderStop(request.Pair, request.Quantity, request.Stop)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		return broker.TakeProfit(request.Side, request.Pair, request.Quantity, request.Stop)
+	case model.OrderTypeTrailingStop:
+		trailingBroker, ok := broker.(service.TrailingStopBroker)
+		if !ok {
+			return model.Order{}, fmt.Errorf("%w: trailing stop", ErrUnsupportedOrder)
+		}
+		return trailingBroker.CreateOrderTrailingStop(request.Side, request.Pair, request.Quantity, request.Stop,
+			request.CallbackRate)
+	default:
+		return model.Order{}, fmt.Errorf("%w: %s", ErrUnsupportedOrder, request.Type)
+	}
+}
+
+// placeOCORequest places the legs of an OCO order with the OCO method of a broker, without client order IDs
+func placeOCORequest(broker service.Broker, limit, stop model.OrderRequest) ([]model.Order, error) {
+	return broker.CreateOrderOCO(limit.Side, limit.Pair, limit.Quantity, limit.Price, stop.Stop, stop.Price)
+}
+
+// clientOrderNumber returns a positive number derived from a client order ID, for exchanges that only accept
+// numeric or alphanumeric client order IDs, or that use their numeric client order IDs as the ExchangeID of
+// the orders. The number is the same on every call, so the order is found again by its client order ID.
+func clientOrderNumber(clientOrderID string) int64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(clientOrderID))
+	return int64(hash.Sum64() & math.MaxInt64)
+}
@@ -0,0 +1,1449 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	coinbaseEndpoint       = "https://api.coinbase.com"
+	coinbaseStreamEndpoint = "wss://advanced-trade-ws.coinbase.com"
+
+	// coinbaseCandleLimit is the maximum number of candles returned by a request
+	coinbaseCandleLimit = 350
+	// coinbaseStreamTimeframe is the timeframe of the candles channel, other timeframes are aggregated
+	coinbaseStreamTimeframe = 5 * time.Minute
+	// coinbaseTokenExpiration is the lifetime of the JWT of each request
+	coinbaseTokenExpiration = 2 * time.Minute
+
+	// coinbaseStopSlippage is the default distance of the limit price of stop orders from the trigger
+	coinbaseStopSlippage = 0.005
+)
+
+// CoinbaseError is an error returned by the Coinbase API
+type CoinbaseError struct {
+	Code    string
+	Message string
+}
+
+func (e *CoinbaseError) Error() string {
+	return fmt.Sprintf("coinbase error %s: %s", e.Code, e.Message)
+}
+
+type coinbaseProduct struct {
+	ProductID      string `json:"product_id"`
+	BaseCurrency   string `json:"base_currency_id"`
+	QuoteCurrency  string `json:"quote_currency_id"`
+	BaseIncrement  string `json:"base_increment"`
+	QuoteIncrement string `json:"quote_increment"`
+	PriceIncrement string `json:"price_increment"`
+	BaseMinSize    string `json:"base_min_size"`
+	BaseMaxSize    string `json:"base_max_size"`
+	Price          string `json:"price"`
+}
+
+// Coinbase is the Coinbase Advanced Trade exchange, for spot markets. Pairs keep the ninjabot format,
+// eg: BTCUSD, and are translated to Coinbase products, eg: BTC-USD. Coinbase order ids are UUIDs, so
+// orders are created with a numeric client order id used as the ninjabot ExchangeID.
+type Coinbase struct {
+	ctx        context.Context
+	client     *http.Client
+	assetsInfo map[string]model.AssetInfo
+	products   map[string]string
+	privateKey *ecdsa.PrivateKey
+	HeikinAshi bool
+
+	// APIKey is the name of a CDP API key, eg: organizations/{org_id}/apiKeys/{key_id}, and APISecret
+	// its EC private key in the PEM format
+	APIKey    string
+	APISecret string
+
+	// Endpoint and StreamEndpoint override the REST and websocket URLs, eg: for a mock server
+	Endpoint       string
+	StreamEndpoint string
+
+	// StopSlippage is the distance of the limit price of stop orders from the trigger price, as Coinbase
+	// spot stops are stop limit orders
+	StopSlippage float64
+
+	// orderIDs maps the ExchangeID of orders to the Coinbase order id, and stopTypes keeps the type of
+	// stop orders, as the user channel does not have their direction
+	mtx       sync.Mutex
+	lastID    int64
+	orderIDs  map[int64]string
+	external  map[string]int64
+	stopTypes map[int64]model.OrderType
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+}
+
+type CoinbaseOption func(*Coinbase)
+
+// WithCoinbaseCredentials will set the name and the private key of a Coinbase CDP API key
+func WithCoinbaseCredentials(key, secret string) CoinbaseOption {
+	return func(c *Coinbase) {
+		c.APIKey = key
+		c.APISecret = secret
+	}
+}
+
+// WithCoinbaseHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithCoinbaseHeikinAshiCandle() CoinbaseOption {
+	return func(c *Coinbase) {
+		c.HeikinAshi = true
+	}
+}
+
+// WithCoinbaseMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithCoinbaseMetadataFetcher(fetcher MetadataFetchers) CoinbaseOption {
+	return func(c *Coinbase) {
+		c.MetadataFetchers = append(c.MetadataFetchers, fetcher)
+	}
+}
+
+// WithCoinbaseStopSlippage will set the distance of the limit price of stop orders from the trigger price,
+// eg: 0.01 sells a stop at 100 with a limit of 99
+func WithCoinbaseStopSlippage(slippage float64) CoinbaseOption {
+	return func(c *Coinbase) {
+		c.StopSlippage = slippage
+	}
+}
+
+// WithCoinbaseEndpoint overrides the REST and websocket endpoints
+func WithCoinbaseEndpoint(endpoint, streamEndpoint string) CoinbaseOption {
+	return func(c *Coinbase) {
+		c.Endpoint = endpoint
+		c.StreamEndpoint = streamEndpoint
+	}
+}
+
+// NewCoinbase will create a new Coinbase Advanced Trade instance
+func NewCoinbase(ctx context.Context, options ...CoinbaseOption) (*Coinbase, error) {
+	exchange := &Coinbase{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		Endpoint:        coinbaseEndpoint,
+		StreamEndpoint:  coinbaseStreamEndpoint,
+		StopSlippage:    coinbaseStopSlippage,
+		lastID:          time.Now().UnixNano() / int64(time.Microsecond),
+		orderIDs:        make(map[int64]string),
+		external:        make(map[string]int64),
+		stopTypes:       make(map[int64]model.OrderType),
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.APISecret != "" {
+		key, err := parseCoinbaseKey(exchange.APISecret)
+		if err != nil {
+			return nil, fmt.Errorf("coinbase invalid api secret: %w", err)
+		}
+		exchange.privateKey = key
+	}
+
+	// Initialize with orders precision and assets limits
+	if err := exchange.loadProducts(ctx); err != nil {
+		return nil, fmt.Errorf("coinbase ping fail: %w", err)
+	}
+
+	log.Info("[SETUP] Using Coinbase exchange")
+
+	return exchange, nil
+}
+
+// parseCoinbaseKey parses an EC private key, also accepting keys with escaped line breaks
+func parseCoinbaseKey(secret string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(secret, `\n`, "\n")))
+	if block == nil {
+		return nil, errors.New("pem key not found")
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an ec private key")
+	}
+	return ecKey, nil
+}
+
+// token returns a JWT signed with the API key, the uri identifies the REST request and it is empty for
+// websocket subscriptions
+func (c *Coinbase) token(uri string) (string, error) {
+	if c.privateKey == nil {
+		return "", errors.New("coinbase credentials not found")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	header, err := json.Marshal(map[string]string{
+		"alg": "ES256", "typ": "JWT", "kid": c.APIKey, "nonce": hex.EncodeToString(nonce),
+	})
+	if err != nil {
+		return "", err
+	}
+	claims := map[string]interface{}{
+		"sub": c.APIKey,
+		"iss": "cdp",
+		"nbf": now,
+		"exp": now + int64(coinbaseTokenExpiration/time.Second),
+	}
+	if uri != "" {
+		claims["uri"] = uri
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, c.privateKey, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	// ES256 signatures are the concatenation of r and s as 32 bytes each
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// request sends a REST request, GET params must be a map sent in the query string, and POST params are sent
+// in a JSON body. Signed requests are authenticated with a JWT of the method, host and path.
+func (c *Coinbase) request(ctx context.Context, method, path string, params interface{},
+	signed bool, result interface{}) error {
+
+	var body []byte
+	requestPath := path
+	if method == http.MethodGet {
+		query := url.Values{}
+		if values, ok := params.(map[string]interface{}); ok {
+			for key, value := range values {
+				query.Set(key, fmt.Sprint(value))
+			}
+		}
+		if len(query) > 0 {
+			requestPath += "?" + query.Encode()
+		}
+	} else {
+		var err error
+		body, err = json.Marshal(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.Endpoint+requestPath, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if signed {
+		token, err := c.token(method + " " + req.URL.Host + path)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var response struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(data, &response); err != nil || response.Error == "" {
+			return &CoinbaseError{Code: strconv.Itoa(resp.StatusCode), Message: string(data)}
+		}
+		return &CoinbaseError{Code: response.Error, Message: response.Message}
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (c *Coinbase) loadProducts(ctx context.Context) error {
+	var result struct {
+		Products []coinbaseProduct `json:"products"`
+	}
+	err := c.request(ctx, http.MethodGet, "/api/v3/brokerage/market/products", map[string]interface{}{
+		"product_type": "SPOT",
+	}, false, &result)
+	if err != nil {
+		return err
+	}
+
+	c.assetsInfo = make(map[string]model.AssetInfo)
+	c.products = make(map[string]string)
+	for _, product := range result.Products {
+		info := model.AssetInfo{
+			BaseAsset:  product.BaseCurrency,
+			QuoteAsset: product.QuoteCurrency,
+			MaxPrice:   math.MaxFloat64,
+		}
+
+		tick := product.PriceIncrement
+		if tick == "" {
+			tick = product.QuoteIncrement
+		}
+		info.StepSize, _ = strconv.ParseFloat(product.BaseIncrement, 64)
+		info.TickSize, _ = strconv.ParseFloat(tick, 64)
+		info.MinQuantity, _ = strconv.ParseFloat(product.BaseMinSize, 64)
+		info.MaxQuantity, _ = strconv.ParseFloat(product.BaseMaxSize, 64)
+		info.MinPrice = info.TickSize
+		info.BaseAssetPrecision = getDecimalPrecision(info.StepSize)
+		info.PricePrecision = getDecimalPrecision(info.TickSize)
+		quoteIncrement, _ := strconv.ParseFloat(product.QuoteIncrement, 64)
+		info.QuotePrecision = getDecimalPrecision(quoteIncrement)
+
+		pair := product.BaseCurrency + product.QuoteCurrency
+		c.assetsInfo[pair] = info
+		RegisterPair(pair, info.BaseAsset, info.QuoteAsset)
+		c.products[pair] = product.ProductID
+	}
+
+	return nil
+}
+
+// productID returns the Coinbase product of a pair, eg: BTCUSD => BTC-USD
+func (c *Coinbase) productID(pair string) string {
+	if product, ok := c.products[pair]; ok {
+		return product
+	}
+
+	asset, quote := SplitAssetQuote(pair)
+	return asset + "-" + quote
+}
+
+// pair returns the ninjabot pair of a Coinbase product, eg: BTC-USD => BTCUSD
+func (c *Coinbase) pair(productID string) string {
+	return strings.ReplaceAll(productID, "-", "")
+}
+
+func (c *Coinbase) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var product coinbaseProduct
+	err := c.request(ctx, http.MethodGet, "/api/v3/brokerage/market/products/"+c.productID(pair), nil,
+		false, &product)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(product.Price, 64)
+}
+
+func (c *Coinbase) AssetsInfo(pair string) model.AssetInfo {
+	return c.assetsInfo[pair]
+}
+
+func (c *Coinbase) validate(pair string, quantity float64) error {
+	info, ok := c.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (c *Coinbase) formatPrice(pair string, value float64) string {
+	return formatStep(value, c.assetsInfo[pair].TickSize)
+}
+
+func (c *Coinbase) formatQuantity(pair string, value float64) string {
+	return formatStep(value, c.assetsInfo[pair].StepSize)
+}
+
+// coinbaseOrderConfiguration is the configuration of an order type, eg: limit_limit_gtc
+type coinbaseOrderConfiguration struct {
+	BaseSize      string `json:"base_size,omitempty"`
+	QuoteSize     string `json:"quote_size,omitempty"`
+	LimitPrice    string `json:"limit_price,omitempty"`
+	StopPrice     string `json:"stop_price,omitempty"`
+	StopDirection string `json:"stop_direction,omitempty"`
+	PostOnly      bool   `json:"post_only,omitempty"`
+}
+
+const (
+	coinbaseMarket    = "market_market_ioc"
+	coinbaseLimit     = "limit_limit_gtc"
+	coinbaseStopLimit = "stop_limit_stop_limit_gtc"
+
+	coinbaseStopDown = "STOP_DIRECTION_STOP_DOWN"
+	coinbaseStopUp   = "STOP_DIRECTION_STOP_UP"
+)
+
+// createOrder places an order with a client order id, a new one when the id is zero, and returns its
+// current state
+func (c *Coinbase) createOrder(side model.SideType, pair, orderType string, id int64,
+	configuration coinbaseOrderConfiguration) (model.Order, error) {
+
+	if id == 0 {
+		id = atomic.AddInt64(&c.lastID, 1)
+	}
+	var result struct {
+		Success         bool `json:"success"`
+		SuccessResponse struct {
+			OrderID string `json:"order_id"`
+		} `json:"success_response"`
+		ErrorResponse struct {
+			Error                 string `json:"error"`
+			Message               string `json:"message"`
+			PreviewFailureReason  string `json:"preview_failure_reason"`
+			NewOrderFailureReason string `json:"new_order_failure_reason"`
+		} `json:"error_response"`
+	}
+	err := c.request(c.ctx, http.MethodPost, "/api/v3/brokerage/orders", map[string]interface{}{
+		"client_order_id":     strconv.FormatInt(id, 10),
+		"product_id":          c.productID(pair),
+		"side":                string(side),
+		"order_configuration": map[string]coinbaseOrderConfiguration{orderType: configuration},
+	}, true, &result)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if !result.Success {
+		reason := result.ErrorResponse
+		code := reason.Error
+		for _, detail := range []string{reason.PreviewFailureReason, reason.NewOrderFailureReason} {
+			if code == "" || code == "UNKNOWN_FAILURE_REASON" {
+				code = detail
+			}
+		}
+		return model.Order{}, &CoinbaseError{Code: code, Message: reason.Message}
+	}
+
+	c.mtx.Lock()
+	c.orderIDs[id] = result.SuccessResponse.OrderID
+	c.mtx.Unlock()
+
+	return c.Order(pair, id)
+}
+
+func (c *Coinbase) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: coinbase oco", ErrUnsupportedOrder)
+}
+
+func (c *Coinbase) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return c.createOrderLimit(side, pair, quantity, limit, 0)
+}
+
+func (c *Coinbase) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+
+	err := c.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return c.createOrder(side, pair, coinbaseLimit, id, coinbaseOrderConfiguration{
+		BaseSize:   c.formatQuantity(pair, quantity),
+		LimitPrice: c.formatPrice(pair, limit),
+	})
+}
+
+func (c *Coinbase) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	_ bool) (model.Order, error) {
+	return c.createOrderMarket(side, pair, quantity, 0)
+}
+
+func (c *Coinbase) createOrderMarket(side model.SideType, pair string, quantity float64,
+	id int64) (model.Order, error) {
+
+	err := c.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return c.createOrder(side, pair, coinbaseMarket, id, coinbaseOrderConfiguration{
+		BaseSize: c.formatQuantity(pair, quantity),
+	})
+}
+
+func (c *Coinbase) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	return c.createOrderMarketQuote(side, pair, quote, 0)
+}
+
+func (c *Coinbase) createOrderMarketQuote(side model.SideType, pair string, quote float64,
+	id int64) (model.Order, error) {
+	return c.createOrder(side, pair, coinbaseMarket, id, coinbaseOrderConfiguration{
+		QuoteSize: strconv.FormatFloat(quote, 'f', c.assetsInfo[pair].QuotePrecision, 64),
+	})
+}
+
+// CreateOrderStop places a sell stop limit order triggered at the limit price, with the limit price of
+// the order at the StopSlippage distance from the trigger
+func (c *Coinbase) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	return c.createOrderStop(pair, quantity, limit, 0)
+}
+
+func (c *Coinbase) createOrderStop(pair string, quantity float64, limit float64, id int64) (model.Order, error) {
+	err := c.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return c.createOrder(model.SideTypeSell, pair, coinbaseStopLimit, id, coinbaseOrderConfiguration{
+		BaseSize:      c.formatQuantity(pair, quantity),
+		StopPrice:     c.formatPrice(pair, limit),
+		LimitPrice:    c.formatPrice(pair, limit*(1-c.StopSlippage)),
+		StopDirection: coinbaseStopDown,
+	})
+}
+
+// TakeProfit places a stop limit order triggered when the price reaches the limit, as a sell above or a buy
+// below the market price
+func (c *Coinbase) TakeProfit(side model.SideType, pair string, quantity float64, limit float64) (model.Order, error) {
+	return c.takeProfit(side, pair, quantity, limit, 0)
+}
+
+func (c *Coinbase) takeProfit(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+	err := c.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	direction := coinbaseStopUp
+	if side == model.SideTypeBuy {
+		direction = coinbaseStopDown
+	}
+
+	return c.createOrder(side, pair, coinbaseStopLimit, id, coinbaseOrderConfiguration{
+		BaseSize:      c.formatQuantity(pair, quantity),
+		StopPrice:     c.formatPrice(pair, limit),
+		LimitPrice:    c.formatPrice(pair, limit),
+		StopDirection: direction,
+	})
+}
+
+// CreateOrderRequest places an order with the client order ID of the request. The client_order_id of the
+// order, its ExchangeID, is a number derived from the client order ID.
+func (c *Coinbase) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	id := clientOrderNumber(request.ClientOrderID)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: coinbase time in force %s", ErrUnsupportedOrder,
+				request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: coinbase iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = c.createOrderLimit(request.Side, request.Pair, request.Quantity, request.Price, id)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			order, err = c.createOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity, id)
+		} else {
+			order, err = c.createOrderMarket(request.Side, request.Pair, request.Quantity, id)
+		}
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		if request.Side == model.SideTypeBuy {
+			return model.Order{}, fmt.Errorf("%w: coinbase buy stop", ErrUnsupportedOrder)
+		}
+		order, err = c.createOrderStop(request.Pair, request.Quantity, request.Stop, id)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = c.takeProfit(request.Side, request.Pair, request.Quantity, request.Stop, id)
+	default:
+		return model.Order{}, fmt.Errorf("%w: coinbase %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns the order of a client order ID, or ErrOrderNotFound
+func (c *Coinbase) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	id := strconv.FormatInt(clientOrderNumber(clientOrderID), 10)
+	orders, err := c.orders(pair, "")
+	if err != nil {
+		return model.Order{}, err
+	}
+	for _, order := range orders {
+		if order.ClientOrderID == id {
+			result := c.order(order)
+			result.ClientOrderID = clientOrderID
+			return result, nil
+		}
+	}
+	return model.Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, clientOrderID)
+}
+
+func (c *Coinbase) cancel(ids ...string) error {
+	var result struct {
+		Results []struct {
+			Success       bool   `json:"success"`
+			FailureReason string `json:"failure_reason"`
+			OrderID       string `json:"order_id"`
+		} `json:"results"`
+	}
+	err := c.request(c.ctx, http.MethodPost, "/api/v3/brokerage/orders/batch_cancel", map[string]interface{}{
+		"order_ids": ids,
+	}, true, &result)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range result.Results {
+		if !item.Success {
+			return &CoinbaseError{Code: item.FailureReason, Message: "cancel order " + item.OrderID}
+		}
+	}
+	return nil
+}
+
+func (c *Coinbase) Cancel(order model.Order) error {
+	id, err := c.orderID(order.Pair, order.ExchangeID)
+	if err != nil {
+		return err
+	}
+	return c.cancel(id)
+}
+
+func (c *Coinbase) CancelOpenOrders(pair string) error {
+	orders, err := c.orders(pair, "OPEN")
+	if err != nil {
+		return err
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.OrderID)
+	}
+	return c.cancel(ids...)
+}
+
+func (c *Coinbase) OpenOrders(pair string) ([]model.Order, error) {
+	orders, err := c.orders(pair, "OPEN")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]model.Order, 0, len(orders))
+	for _, order := range orders {
+		result = append(result, c.order(order))
+	}
+	return result, nil
+}
+
+// orders returns all pages of the orders of a pair, filtered by status when given
+func (c *Coinbase) orders(pair, status string) ([]coinbaseOrder, error) {
+	params := map[string]interface{}{
+		"product_ids": c.productID(pair),
+		"limit":       250,
+	}
+	if status != "" {
+		params["order_status"] = status
+	}
+
+	orders := make([]coinbaseOrder, 0)
+	for {
+		var result struct {
+			Orders  []coinbaseOrder `json:"orders"`
+			HasNext bool            `json:"has_next"`
+			Cursor  string          `json:"cursor"`
+		}
+		err := c.request(c.ctx, http.MethodGet, "/api/v3/brokerage/orders/historical/batch", params, true, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, result.Orders...)
+		if !result.HasNext || result.Cursor == "" {
+			return orders, nil
+		}
+		params["cursor"] = result.Cursor
+	}
+}
+
+// orderID returns the Coinbase order id of an ExchangeID, searching the orders of the pair for orders
+// created by a previous instance
+func (c *Coinbase) orderID(pair string, id int64) (string, error) {
+	c.mtx.Lock()
+	orderID, ok := c.orderIDs[id]
+	c.mtx.Unlock()
+	if ok {
+		return orderID, nil
+	}
+
+	orders, err := c.orders(pair, "")
+	if err != nil {
+		return "", err
+	}
+	for _, order := range orders {
+		if c.order(order).ExchangeID == id {
+			return order.OrderID, nil
+		}
+	}
+	return "", fmt.Errorf("coinbase order %d not found", id)
+}
+
+func (c *Coinbase) Order(pair string, id int64) (model.Order, error) {
+	orderID, err := c.orderID(pair, id)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var result struct {
+		Order coinbaseOrder `json:"order"`
+	}
+	err = c.request(c.ctx, http.MethodGet, "/api/v3/brokerage/orders/historical/"+orderID, nil, true, &result)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return c.order(result.Order), nil
+}
+
+type coinbaseOrder struct {
+	OrderID            string                                `json:"order_id"`
+	ClientOrderID      string                                `json:"client_order_id"`
+	ProductID          string                                `json:"product_id"`
+	Side               string                                `json:"side"`
+	Status             string                                `json:"status"`
+	OrderConfiguration map[string]coinbaseOrderConfiguration `json:"order_configuration"`
+	AverageFilledPrice string                                `json:"average_filled_price"`
+	FilledSize         string                                `json:"filled_size"`
+	CreatedTime        time.Time                             `json:"created_time"`
+	LastFillTime       time.Time                             `json:"last_fill_time"`
+}
+
+// exchangeID returns the ninjabot id of an order, the client order id of orders created by ninjabot or
+// a new id for orders created elsewhere
+func (c *Coinbase) exchangeID(orderID, clientOrderID string) int64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if id, err := strconv.ParseInt(clientOrderID, 10, 64); err == nil {
+		c.orderIDs[id] = orderID
+		return id
+	}
+
+	if id, ok := c.external[orderID]; ok {
+		return id
+	}
+
+	id := atomic.AddInt64(&c.lastID, 1)
+	c.external[orderID] = id
+	c.orderIDs[id] = orderID
+	return id
+}
+
+func coinbaseStatus(status string, filled float64) model.OrderStatusType {
+	switch status {
+	case "FILLED":
+		return model.OrderStatusTypeFilled
+	case "CANCELLED":
+		return model.OrderStatusTypeCanceled
+	case "CANCEL_QUEUED":
+		return model.OrderStatusTypePendingCancel
+	case "EXPIRED":
+		return model.OrderStatusTypeExpired
+	case "FAILED":
+		return model.OrderStatusTypeRejected
+	}
+
+	if filled > 0 {
+		return model.OrderStatusTypePartiallyFilled
+	}
+	return model.OrderStatusTypeNew
+}
+
+func (c *Coinbase) order(order coinbaseOrder) model.Order {
+	result := model.Order{
+		ExchangeID: c.exchangeID(order.OrderID, order.ClientOrderID),
+		Pair:       c.pair(order.ProductID),
+		Side:       model.SideType(order.Side),
+		CreatedAt:  order.CreatedTime,
+		UpdatedAt:  order.CreatedTime,
+	}
+	if order.LastFillTime.After(order.CreatedTime) {
+		result.UpdatedAt = order.LastFillTime
+	}
+
+	var configuration coinbaseOrderConfiguration
+	for orderType, value := range order.OrderConfiguration {
+		configuration = value
+		switch orderType {
+		case coinbaseMarket:
+			result.Type = model.OrderTypeMarket
+		case coinbaseStopLimit:
+			result.Type = model.OrderTypeStopLossLimit
+			if (value.StopDirection == coinbaseStopUp) == (result.Side == model.SideTypeSell) {
+				result.Type = model.OrderTypeTakeProfitLimit
+			}
+			stop, _ := strconv.ParseFloat(value.StopPrice, 64)
+			result.Stop = &stop
+
+			c.mtx.Lock()
+			c.stopTypes[result.ExchangeID] = result.Type
+			c.mtx.Unlock()
+		default:
+			result.Type = model.OrderTypeLimit
+			if value.PostOnly {
+				result.Type = model.OrderTypeLimitMaker
+			}
+		}
+	}
+
+	filled, _ := strconv.ParseFloat(order.FilledSize, 64)
+	average, _ := strconv.ParseFloat(order.AverageFilledPrice, 64)
+	result.Status = coinbaseStatus(order.Status, filled)
+	if filled > 0 && average > 0 {
+		result.Price, result.Quantity = average, filled
+	} else {
+		result.Price, _ = strconv.ParseFloat(configuration.LimitPrice, 64)
+		result.Quantity, _ = strconv.ParseFloat(configuration.BaseSize, 64)
+	}
+
+	return result
+}
+
+func (c *Coinbase) Account() (model.Account, error) {
+	balances := make([]model.Balance, 0)
+	params := map[string]interface{}{"limit": 250}
+	for {
+		var result struct {
+			Accounts []struct {
+				Currency         string `json:"currency"`
+				AvailableBalance struct {
+					Value string `json:"value"`
+				} `json:"available_balance"`
+				Hold struct {
+					Value string `json:"value"`
+				} `json:"hold"`
+			} `json:"accounts"`
+			HasNext bool   `json:"has_next"`
+			Cursor  string `json:"cursor"`
+		}
+		if err := c.request(c.ctx, http.MethodGet, "/api/v3/brokerage/accounts", params, true, &result); err != nil {
+			return model.Account{}, err
+		}
+
+		for _, account := range result.Accounts {
+			free, err := strconv.ParseFloat(account.AvailableBalance.Value, 64)
+			if err != nil {
+				return model.Account{}, err
+			}
+			lock, _ := strconv.ParseFloat(account.Hold.Value, 64)
+
+			if free == 0 && lock == 0 {
+				continue
+			}
+
+			balances = append(balances, model.Balance{
+				Asset: account.Currency,
+				Free:  free,
+				Lock:  lock,
+			})
+		}
+
+		if !result.HasNext || result.Cursor == "" {
+			break
+		}
+		params["cursor"] = result.Cursor
+	}
+
+	return model.Account{Balances: balances}, nil
+}
+
+func (c *Coinbase) Position(pair string) (asset, quote float64, err error) {
+	info, ok := c.assetsInfo[pair]
+	if !ok {
+		return 0, 0, ErrInvalidAsset
+	}
+
+	acc, err := c.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(info.BaseAsset, info.QuoteAsset)
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
+
+// PositionRisk returns the size of the position, Coinbase does not provide position details
+func (c *Coinbase) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(c, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, Coinbase does not support amending orders
+func (c *Coinbase) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(c, order, price, quantity)
+}
+
+// coinbaseGranularity converts a ninjabot timeframe into a Coinbase candle granularity
+func coinbaseGranularity(period string) (string, error) {
+	granularity, ok := map[string]string{
+		"1m":  "ONE_MINUTE",
+		"5m":  "FIVE_MINUTE",
+		"15m": "FIFTEEN_MINUTE",
+		"30m": "THIRTY_MINUTE",
+		"1h":  "ONE_HOUR",
+		"2h":  "TWO_HOUR",
+		"4h":  "FOUR_HOUR",
+		"6h":  "SIX_HOUR",
+		"1d":  "ONE_DAY",
+	}[period]
+	if !ok {
+		return "", fmt.Errorf("invalid coinbase granularity %s", period)
+	}
+	return granularity, nil
+}
+
+type coinbaseCandle struct {
+	Start     string `json:"start"`
+	Open      string `json:"open"`
+	High      string `json:"high"`
+	Low       string `json:"low"`
+	Close     string `json:"close"`
+	Volume    string `json:"volume"`
+	ProductID string `json:"product_id"`
+}
+
+func (c coinbaseCandle) toModel(pair string) (model.Candle, error) {
+	start, err := strconv.ParseInt(c.Start, 10, 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	t := time.Unix(start, 0)
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Metadata: make(map[string]float64)}
+	for _, field := range []struct {
+		value  string
+		target *float64
+	}{
+		{c.Open, &candle.Open},
+		{c.High, &candle.High},
+		{c.Low, &candle.Low},
+		{c.Close, &candle.Close},
+		{c.Volume, &candle.Volume},
+	} {
+		*field.target, err = strconv.ParseFloat(field.value, 64)
+		if err != nil {
+			return model.Candle{}, err
+		}
+	}
+	return candle, nil
+}
+
+// candles requests the candles of a period, up to coinbaseCandleLimit, and returns the complete ones in
+// chronological order
+func (c *Coinbase) candles(ctx context.Context, pair, period string, start, end time.Time) ([]model.Candle, error) {
+	granularity, err := coinbaseGranularity(period)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Candles []coinbaseCandle `json:"candles"`
+	}
+	err = c.request(ctx, http.MethodGet, "/api/v3/brokerage/market/products/"+c.productID(pair)+"/candles",
+		map[string]interface{}{
+			"start":       start.Unix(),
+			"end":         end.Unix(),
+			"granularity": granularity,
+		}, false, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	candles := make([]model.Candle, 0, len(result.Candles))
+	for _, item := range result.Candles {
+		candle, err := item.toModel(pair)
+		if err != nil {
+			return nil, err
+		}
+
+		// the last candle is in progress until the end of its period
+		if candle.Time.Add(duration).After(now) {
+			continue
+		}
+		candle.Complete = true
+		candles = append(candles, candle)
+	}
+
+	// coinbase returns the newest candles first
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return candles, nil
+}
+
+func (c *Coinbase) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	size := limit + 1
+	if size > coinbaseCandleLimit {
+		size = coinbaseCandleLimit
+	}
+
+	end := time.Now()
+	candles, err := c.candles(ctx, pair, period, end.Add(-time.Duration(size)*duration), end)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	if c.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// CandlesByPeriod returns the candles of a period, requested in pages of coinbaseCandleLimit candles
+func (c *Coinbase) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0)
+	for from := start; from.Before(end); from = from.Add(coinbaseCandleLimit * duration) {
+		to := from.Add((coinbaseCandleLimit - 1) * duration)
+		if to.After(end) {
+			to = end
+		}
+
+		data, err := c.candles(ctx, pair, period, from, to)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, data...)
+	}
+
+	if c.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// coinbaseAggregator builds candles of a timeframe from the 5 minutes candles of the websocket, keeping
+// the last update of each 5 minutes candle of the current period
+type coinbaseAggregator struct {
+	pair     string
+	duration time.Duration
+	period   time.Time
+	parts    map[time.Time]model.Candle
+}
+
+// update adds a 5 minutes candle and returns the complete candle of the previous period, when the candle
+// starts a new one, and the partial candle of the current period
+func (a *coinbaseAggregator) update(candle model.Candle) (complete *model.Candle, partial model.Candle) {
+	period := candle.Time.Truncate(a.duration)
+	if period.After(a.period) {
+		if len(a.parts) > 0 {
+			previous := a.candle()
+			previous.Complete = true
+			complete = &previous
+		}
+		a.period = period
+		a.parts = make(map[time.Time]model.Candle)
+	}
+
+	if period.Equal(a.period) {
+		a.parts[candle.Time] = candle
+	}
+	return complete, a.candle()
+}
+
+func (a *coinbaseAggregator) candle() model.Candle {
+	times := make([]time.Time, 0, len(a.parts))
+	for t := range a.parts {
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i].Before(times[j])
+	})
+
+	candle := model.Candle{Pair: a.pair, Time: a.period, Metadata: make(map[string]float64)}
+	for i, t := range times {
+		part := a.parts[t]
+		if i == 0 {
+			candle.Open, candle.High, candle.Low = part.Open, part.High, part.Low
+		}
+		candle.High = math.Max(candle.High, part.High)
+		candle.Low = math.Min(candle.Low, part.Low)
+		candle.Close = part.Close
+		candle.Volume += part.Volume
+		candle.UpdatedAt = part.UpdatedAt
+	}
+	return candle
+}
+
+// CandlesSubscription streams candles of timeframes multiple of 5 minutes, the only timeframe of the
+// Coinbase candles channel. The first period is loaded from the REST API, as the stream starts with the
+// current candle only.
+func (c *Coinbase) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		duration, err := str2duration.ParseDuration(period)
+		if err == nil && (duration < coinbaseStreamTimeframe || duration%coinbaseStreamTimeframe != 0) {
+			err = fmt.Errorf("coinbase stream timeframe %s is not a multiple of 5m", period)
+		}
+		if err != nil {
+			cerr <- err
+			close(cerr)
+			close(ccandle)
+			return
+		}
+
+		aggregator := &coinbaseAggregator{pair: pair, duration: duration}
+		productID := c.productID(pair)
+
+		for {
+			requests := []interface{}{
+				map[string]interface{}{"type": "subscribe", "channel": "candles", "product_ids": []string{productID}},
+				map[string]interface{}{"type": "subscribe", "channel": "heartbeats"},
+			}
+
+			done, stop, err := wsServeJSON(c.StreamEndpoint, requests, nil, func(message []byte) {
+				var event struct {
+					Channel string `json:"channel"`
+					Events  []struct {
+						Candles []coinbaseCandle `json:"candles"`
+					} `json:"events"`
+				}
+				if err := json.Unmarshal(message, &event); err != nil || event.Channel != "candles" {
+					return
+				}
+
+				ba.Reset()
+				for _, item := range event.Events {
+					for _, data := range item.Candles {
+						if data.ProductID != productID {
+							continue
+						}
+
+						part, err := data.toModel(pair)
+						if err != nil {
+							log.Warn(err)
+							continue
+						}
+						part.UpdatedAt = time.Now()
+
+						if len(aggregator.parts) == 0 {
+							c.loadPeriod(ctx, aggregator, part.Time)
+						}
+
+						complete, partial := aggregator.update(part)
+						candles := []model.Candle{partial}
+						if complete != nil {
+							if c.HeikinAshi {
+								*complete = complete.ToHeikinAshi(ha)
+							}
+							// fetch aditional data if needed
+							fetchMetadata(ctx, c.MetadataFetchers, c.MetadataTimeout, &c.metadataKeys, complete)
+							candles = []model.Candle{*complete, partial}
+						}
+
+						for _, candle := range candles {
+							select {
+							case ccandle <- candle:
+							case <-ctx.Done():
+								return
+							}
+						}
+					}
+				}
+			}, func(err error) {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+				}
+			})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				// wait for the stream handlers before closing the channels
+				close(stop)
+				<-done
+				close(cerr)
+				close(ccandle)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (c *Coinbase) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("coinbase")
+}
+
+// loadPeriod adds the 5 minutes candles of the current period, before the given candle, to the aggregator
+func (c *Coinbase) loadPeriod(ctx context.Context, aggregator *coinbaseAggregator, current time.Time) {
+	period := current.Truncate(aggregator.duration)
+	if !period.Before(current) {
+		return
+	}
+
+	candles, err := c.candles(ctx, aggregator.pair, "5m", period, current)
+	if err != nil {
+		log.Warnf("coinbase: load candles of %s: %v", aggregator.pair, err)
+		return
+	}
+	for _, candle := range candles {
+		if candle.Time.Before(current) {
+			aggregator.update(candle)
+		}
+	}
+}
+
+type coinbaseOrderUpdate struct {
+	OrderID            string    `json:"order_id"`
+	ClientOrderID      string    `json:"client_order_id"`
+	ProductID          string    `json:"product_id"`
+	OrderSide          string    `json:"order_side"`
+	OrderType          string    `json:"order_type"`
+	Status             string    `json:"status"`
+	CumulativeQuantity string    `json:"cumulative_quantity"`
+	LeavesQuantity     string    `json:"leaves_quantity"`
+	AvgPrice           string    `json:"avg_price"`
+	LimitPrice         string    `json:"limit_price"`
+	StopPrice          string    `json:"stop_price"`
+	CreationTime       time.Time `json:"creation_time"`
+}
+
+func (c *Coinbase) orderUpdate(update coinbaseOrderUpdate) model.Order {
+	filled, _ := strconv.ParseFloat(update.CumulativeQuantity, 64)
+	leaves, _ := strconv.ParseFloat(update.LeavesQuantity, 64)
+
+	order := model.Order{
+		ExchangeID: c.exchangeID(update.OrderID, update.ClientOrderID),
+		Pair:       c.pair(update.ProductID),
+		Side:       model.SideType(update.OrderSide),
+		Type:       model.OrderTypeLimit,
+		Status:     coinbaseStatus(update.Status, filled),
+		Quantity:   filled + leaves,
+		CreatedAt:  update.CreationTime,
+		UpdatedAt:  time.Now(),
+	}
+
+	switch update.OrderType {
+	case "MARKET":
+		order.Type = model.OrderTypeMarket
+	case "STOP_LIMIT":
+		c.mtx.Lock()
+		orderType, ok := c.stopTypes[order.ExchangeID]
+		c.mtx.Unlock()
+		order.Type = model.OrderTypeStopLossLimit
+		if ok {
+			order.Type = orderType
+		}
+		stop, _ := strconv.ParseFloat(update.StopPrice, 64)
+		order.Stop = &stop
+	}
+
+	order.Price, _ = strconv.ParseFloat(update.LimitPrice, 64)
+	if average, _ := strconv.ParseFloat(update.AvgPrice, 64); filled > 0 && average > 0 {
+		order.Price = average
+	}
+	if order.Status == model.OrderStatusTypeFilled {
+		order.Quantity = filled
+	}
+	return order
+}
+
+// AccountSubscription streams the order updates of the user channel, it reconnects until the context is done
+func (c *Coinbase) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+
+		for {
+			var done, stop chan struct{}
+			token, err := c.token("")
+			if err == nil {
+				requests := []interface{}{
+					map[string]interface{}{"type": "subscribe", "channel": "user", "jwt": token},
+					map[string]interface{}{"type": "subscribe", "channel": "heartbeats", "jwt": token},
+				}
+				done, stop, err = wsServeJSON(c.StreamEndpoint, requests, nil, func(message []byte) {
+					var event struct {
+						Type    string `json:"type"`
+						Message string `json:"message"`
+						Channel string `json:"channel"`
+						Events  []struct {
+							Orders []coinbaseOrderUpdate `json:"orders"`
+						} `json:"events"`
+					}
+					if err := json.Unmarshal(message, &event); err != nil {
+						return
+					}
+
+					if event.Type == "error" {
+						sendErr(&CoinbaseError{Code: "stream", Message: event.Message})
+						return
+					}
+					if event.Channel != "user" {
+						return
+					}
+
+					ba.Reset()
+					for _, item := range event.Events {
+						for _, update := range item.Orders {
+							select {
+							case corder <- c.orderUpdate(update):
+							case <-ctx.Done():
+								return
+							}
+						}
+					}
+				}, sendErr)
+			}
+			if err != nil {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					close(cerr)
+					close(corder)
+					return
+				}
+				time.Sleep(ba.Duration())
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				close(stop)
+				<-done
+				close(cerr)
+				close(corder)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return corder, cerr
+}
@@ -0,0 +1,530 @@
+package exchange
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// coinbaseStart is the start time of the candles of the test server
+var coinbaseStart = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// coinbaseServer emulates the subset of the Coinbase Advanced Trade API used by the Coinbase exchange
+type coinbaseServer struct {
+	*httptest.Server
+	key     *ecdsa.PrivateKey
+	secret  string
+	mtx     sync.Mutex
+	lastID  int
+	orders  []coinbaseOrder
+	params  []map[string]interface{}
+	updates chan coinbaseOrderUpdate
+}
+
+func coinbaseTestCandle(start time.Time, open, close float64) coinbaseCandle {
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return coinbaseCandle{
+		Start: strconv.FormatInt(start.Unix(), 10), Open: format(open), Close: format(close),
+		High: format(close + 1), Low: format(open - 1), Volume: "10", ProductID: "BTC-USD",
+	}
+}
+
+// verify checks the ES256 signature and the claims of a JWT
+func (s *coinbaseServer) verify(t *testing.T, token, uri string) {
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	require.Len(t, signature, 64)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, sig := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	require.True(t, ecdsa.Verify(&s.key.PublicKey, digest[:], r, sig))
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+	var claims map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	require.Equal(t, "key", claims["sub"])
+	require.Equal(t, "cdp", claims["iss"])
+	if uri != "" {
+		require.Equal(t, uri, claims["uri"])
+	}
+}
+
+func newCoinbaseServer(t *testing.T) *coinbaseServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	s := &coinbaseServer{
+		key:     key,
+		secret:  string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		updates: make(chan coinbaseOrderUpdate),
+		orders: []coinbaseOrder{{
+			OrderID: "external", ClientOrderID: "c7b2-external", ProductID: "BTC-USD", Side: "BUY",
+			Status: "OPEN", CreatedTime: coinbaseStart,
+			OrderConfiguration: map[string]coinbaseOrderConfiguration{
+				coinbaseLimit: {BaseSize: "0.1", LimitPrice: "90"},
+			},
+		}},
+	}
+
+	reply := func(w http.ResponseWriter, data interface{}) {
+		_ = json.NewEncoder(w).Encode(data)
+	}
+	signed := func(r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.verify(t, token, r.Method+" "+r.Host+r.URL.Path)
+	}
+	decode := func(r *http.Request) map[string]interface{} {
+		var params map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+		s.mtx.Lock()
+		s.params = append(s.params, params)
+		s.mtx.Unlock()
+		return params
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/brokerage/market/products", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"products": []coinbaseProduct{{
+			ProductID: "BTC-USD", BaseCurrency: "BTC", QuoteCurrency: "USD", BaseIncrement: "0.00000001",
+			QuoteIncrement: "0.01", PriceIncrement: "0.01", BaseMinSize: "0.00001", BaseMaxSize: "1000",
+		}}})
+	})
+	mux.HandleFunc("/api/v3/brokerage/market/products/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/candles") {
+			reply(w, coinbaseProduct{ProductID: "BTC-USD", Price: "101.5"})
+			return
+		}
+
+		// newest first
+		candles := []coinbaseCandle{
+			coinbaseTestCandle(coinbaseStart.Add(2*time.Hour), 102, 103),
+			coinbaseTestCandle(coinbaseStart.Add(time.Hour), 101, 102),
+			coinbaseTestCandle(coinbaseStart, 100, 101),
+		}
+		if r.URL.Query().Get("granularity") == "FIVE_MINUTE" {
+			candles = []coinbaseCandle{
+				coinbaseTestCandle(coinbaseStart.Add(5*time.Minute), 101, 102),
+				coinbaseTestCandle(coinbaseStart, 100, 101),
+			}
+		} else {
+			require.Equal(t, "ONE_HOUR", r.URL.Query().Get("granularity"))
+		}
+		reply(w, map[string]interface{}{"candles": candles})
+	})
+	mux.HandleFunc("/api/v3/brokerage/orders", func(w http.ResponseWriter, r *http.Request) {
+		signed(r)
+		params := decode(r)
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		s.lastID++
+		order := coinbaseOrder{
+			OrderID: "order-" + strconv.Itoa(s.lastID), ClientOrderID: params["client_order_id"].(string),
+			ProductID: params["product_id"].(string), Side: params["side"].(string), Status: "OPEN",
+			CreatedTime: coinbaseStart,
+		}
+
+		data, _ := json.Marshal(params["order_configuration"])
+		require.NoError(t, json.Unmarshal(data, &order.OrderConfiguration))
+		if _, ok := order.OrderConfiguration[coinbaseMarket]; ok {
+			order.Status, order.AverageFilledPrice = "FILLED", "101.5"
+			order.FilledSize = order.OrderConfiguration[coinbaseMarket].BaseSize
+		}
+
+		s.orders = append(s.orders, order)
+		reply(w, map[string]interface{}{
+			"success":          true,
+			"success_response": map[string]string{"order_id": order.OrderID},
+		})
+	})
+	mux.HandleFunc("/api/v3/brokerage/orders/historical/", func(w http.ResponseWriter, r *http.Request) {
+		signed(r)
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		if strings.HasSuffix(r.URL.Path, "/batch") {
+			require.Equal(t, "BTC-USD", r.URL.Query().Get("product_ids"))
+			status := r.URL.Query().Get("order_status")
+			orders := make([]coinbaseOrder, 0)
+			for _, order := range s.orders {
+				if status == "" || order.Status == status {
+					orders = append(orders, order)
+				}
+			}
+
+			// pages of two orders
+			start, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+			end := start + 2
+			if end >= len(orders) {
+				reply(w, map[string]interface{}{"orders": orders[start:]})
+				return
+			}
+			reply(w, map[string]interface{}{"orders": orders[start:end], "has_next": true,
+				"cursor": strconv.Itoa(end)})
+			return
+		}
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/v3/brokerage/orders/historical/")
+		for _, order := range s.orders {
+			if order.OrderID == id {
+				reply(w, map[string]interface{}{"order": order})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		reply(w, map[string]string{"error": "NOT_FOUND", "message": "order not found"})
+	})
+	mux.HandleFunc("/api/v3/brokerage/orders/batch_cancel", func(w http.ResponseWriter, r *http.Request) {
+		signed(r)
+		params := decode(r)
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		results := make([]map[string]interface{}, 0)
+		for _, id := range params["order_ids"].([]interface{}) {
+			for i, order := range s.orders {
+				if order.OrderID == id {
+					s.orders[i].Status = "CANCELLED"
+				}
+			}
+			results = append(results, map[string]interface{}{"success": true, "order_id": id})
+		}
+		reply(w, map[string]interface{}{"results": results})
+	})
+	mux.HandleFunc("/api/v3/brokerage/accounts", func(w http.ResponseWriter, r *http.Request) {
+		signed(r)
+		account := func(currency, available, hold string) map[string]interface{} {
+			return map[string]interface{}{
+				"currency":          currency,
+				"available_balance": map[string]string{"value": available, "currency": currency},
+				"hold":              map[string]string{"value": hold, "currency": currency},
+			}
+		}
+		if r.URL.Query().Get("cursor") == "" {
+			reply(w, map[string]interface{}{"accounts": []interface{}{account("USD", "900", "100"),
+				account("ETH", "0", "0")}, "has_next": true, "cursor": "next"})
+			return
+		}
+		reply(w, map[string]interface{}{"accounts": []interface{}{account("BTC", "0.5", "0.1")}})
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		channels := make(map[string]map[string]interface{})
+		for i := 0; i < 2; i++ {
+			var subscribe map[string]interface{}
+			require.NoError(t, conn.ReadJSON(&subscribe))
+			require.Equal(t, "subscribe", subscribe["type"])
+			channels[subscribe["channel"].(string)] = subscribe
+		}
+		require.Contains(t, channels, "heartbeats")
+
+		if _, ok := channels["candles"]; ok {
+			for _, candle := range []coinbaseCandle{
+				coinbaseTestCandle(coinbaseStart.Add(10*time.Minute), 102, 103),
+				coinbaseTestCandle(coinbaseStart.Add(10*time.Minute), 102, 104),
+				coinbaseTestCandle(coinbaseStart.Add(15*time.Minute), 104, 105),
+			} {
+				_ = conn.WriteJSON(map[string]interface{}{
+					"channel": "candles",
+					"events":  []interface{}{map[string]interface{}{"type": "update", "candles": []coinbaseCandle{candle}}},
+				})
+			}
+			_, _, _ = conn.ReadMessage()
+			return
+		}
+
+		s.verify(t, channels["user"]["jwt"].(string), "")
+		for update := range s.updates {
+			_ = conn.WriteJSON(map[string]interface{}{
+				"channel": "user",
+				"events": []interface{}{
+					map[string]interface{}{"type": "update", "orders": []coinbaseOrderUpdate{update}},
+				},
+			})
+		}
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		close(s.updates)
+		s.Server.Close()
+	})
+	return s
+}
+
+func newTestCoinbase(t *testing.T) (*Coinbase, *coinbaseServer) {
+	server := newCoinbaseServer(t)
+	coinbase, err := NewCoinbase(context.Background(),
+		WithCoinbaseCredentials("key", strings.ReplaceAll(server.secret, "\n", `\n`)),
+		WithCoinbaseEndpoint(server.URL, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws"),
+	)
+	require.NoError(t, err)
+	return coinbase, server
+}
+
+func TestCoinbase(t *testing.T) {
+	t.Run("assets info", func(t *testing.T) {
+		coinbase, _ := newTestCoinbase(t)
+		info := coinbase.AssetsInfo("BTCUSD")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USD", info.QuoteAsset)
+		require.Equal(t, 0.00001, info.MinQuantity)
+		require.Equal(t, 1000.0, info.MaxQuantity)
+		require.Equal(t, 0.00000001, info.StepSize)
+		require.Equal(t, 0.01, info.TickSize)
+		require.Equal(t, 8, info.BaseAssetPrecision)
+		require.Equal(t, 2, info.QuotePrecision)
+		require.Equal(t, "BTC-USD", coinbase.productID("BTCUSD"))
+		require.Equal(t, "0.50000000", coinbase.formatQuantity("BTCUSD", 0.5))
+		require.Equal(t, "100.12", coinbase.formatPrice("BTCUSD", 100.129))
+
+		quote, err := coinbase.LastQuote(context.Background(), "BTCUSD")
+		require.NoError(t, err)
+		require.Equal(t, 101.5, quote)
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		coinbase, _ := newTestCoinbase(t)
+
+		candles, err := coinbase.CandlesByLimit(context.Background(), "BTCUSD", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, 102.0, candles[0].Close)
+		require.Equal(t, 103.0, candles[1].Close)
+		require.True(t, candles[1].Complete)
+
+		candles, err = coinbase.CandlesByPeriod(context.Background(), "BTCUSD", "1h", coinbaseStart,
+			coinbaseStart.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 3)
+		require.Equal(t, coinbaseStart, candles[0].Time.UTC())
+
+		_, err = coinbase.CandlesByLimit(context.Background(), "BTCUSD", "3m", 2)
+		require.Error(t, err)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		coinbase, _ := newTestCoinbase(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		_, cerr := coinbase.CandlesSubscription(ctx, "BTCUSD", "1m")
+		require.Error(t, <-cerr)
+
+		candles, _ := coinbase.CandlesSubscription(ctx, "BTCUSD", "15m")
+		partial := <-candles
+		require.False(t, partial.Complete)
+		require.Equal(t, 100.0, partial.Open)
+		require.Equal(t, 103.0, partial.Close)
+
+		partial = <-candles
+		require.Equal(t, 104.0, partial.Close)
+		require.Equal(t, 105.0, partial.High)
+
+		candle := <-candles
+		require.True(t, candle.Complete)
+		require.Equal(t, coinbaseStart, candle.Time.UTC())
+		require.Equal(t, "BTCUSD", candle.Pair)
+		require.Equal(t, 100.0, candle.Open)
+		require.Equal(t, 104.0, candle.Close)
+		require.Equal(t, 105.0, candle.High)
+		require.Equal(t, 99.0, candle.Low)
+		require.Equal(t, 30.0, candle.Volume)
+
+		partial = <-candles
+		require.False(t, partial.Complete)
+		require.Equal(t, coinbaseStart.Add(15*time.Minute), partial.Time.UTC())
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		coinbase, server := newTestCoinbase(t)
+
+		market, err := coinbase.CreateOrderMarket(model.SideTypeBuy, "BTCUSD", 0.5, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, "BTCUSD", market.Pair)
+		require.Equal(t, 101.5, market.Price)
+		require.Equal(t, 0.5, market.Quantity)
+		require.Equal(t, strconv.FormatInt(market.ExchangeID, 10), server.params[0]["client_order_id"])
+
+		limit, err := coinbase.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.5, 120)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, model.SideTypeSell, limit.Side)
+		require.Equal(t, 120.0, limit.Price)
+
+		stop, err := coinbase.CreateOrderStop("BTCUSD", 0.5, 90)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLossLimit, stop.Type)
+		require.Equal(t, 90.0, *stop.Stop)
+		require.Equal(t, 89.55, stop.Price)
+
+		takeProfit, err := coinbase.TakeProfit(model.SideTypeSell, "BTCUSD", 0.5, 130)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+		require.Equal(t, 130.0, *takeProfit.Stop)
+
+		_, err = coinbase.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.000001, 120)
+		var orderError *OrderError
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+
+		_, err = coinbase.CreateOrderOCO(model.SideTypeSell, "BTCUSD", 1, 120, 90, 89)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		orders, err := coinbase.OpenOrders("BTCUSD")
+		require.NoError(t, err)
+		require.Len(t, orders, 4)
+
+		require.NoError(t, coinbase.Cancel(limit))
+		limit, err = coinbase.Order("BTCUSD", limit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, limit.Status)
+
+		require.NoError(t, coinbase.CancelOpenOrders("BTCUSD"))
+		orders, err = coinbase.OpenOrders("BTCUSD")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+
+		// a new instance finds orders by their client order id
+		restarted, err := NewCoinbase(context.Background(), WithCoinbaseCredentials("key", server.secret),
+			WithCoinbaseEndpoint(server.URL, ""))
+		require.NoError(t, err)
+		order, err := restarted.Order("BTCUSD", stop.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		require.Equal(t, model.OrderTypeStopLossLimit, order.Type)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		coinbase, server := newTestCoinbase(t)
+
+		limit, err := coinbase.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 120, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Equal(t, clientOrderNumber("ninjabot-1"), limit.ExchangeID)
+		require.Equal(t, strconv.FormatInt(limit.ExchangeID, 10), server.params[0]["client_order_id"])
+
+		_, err = coinbase.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeBuy,
+			Type: model.OrderTypeStopLoss, Quantity: 0.5, Stop: 130, ClientOrderID: "ninjabot-2"})
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		// a new instance finds orders by their client order id
+		restarted, err := NewCoinbase(context.Background(), WithCoinbaseCredentials("key", server.secret),
+			WithCoinbaseEndpoint(server.URL, ""))
+		require.NoError(t, err)
+		found, err := restarted.OrderByClientID("BTCUSD", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, limit.ExchangeID, found.ExchangeID)
+		require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+		_, err = restarted.OrderByClientID("BTCUSD", "ninjabot-2")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("external orders", func(t *testing.T) {
+		coinbase, _ := newTestCoinbase(t)
+		orders, err := coinbase.OpenOrders("BTCUSD")
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.NotZero(t, orders[0].ExchangeID)
+
+		order, err := coinbase.Order("BTCUSD", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, orders[0].ExchangeID, order.ExchangeID)
+		require.Equal(t, 90.0, order.Price)
+		require.Equal(t, 0.1, order.Quantity)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		coinbase, _ := newTestCoinbase(t)
+		account, err := coinbase.Account()
+		require.NoError(t, err)
+		require.Len(t, account.Balances, 2)
+
+		asset, quote, err := coinbase.Position("BTCUSD")
+		require.NoError(t, err)
+		require.Equal(t, 0.6, asset)
+		require.Equal(t, 1000.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		coinbase, server := newTestCoinbase(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		takeProfit, err := coinbase.TakeProfit(model.SideTypeSell, "BTCUSD", 0.5, 130)
+		require.NoError(t, err)
+
+		orders, _ := coinbase.AccountSubscription(ctx)
+		server.updates <- coinbaseOrderUpdate{
+			OrderID: "order-1", ClientOrderID: strconv.FormatInt(takeProfit.ExchangeID, 10), ProductID: "BTC-USD",
+			OrderSide: "SELL", OrderType: "STOP_LIMIT", Status: "FILLED", CumulativeQuantity: "0.5",
+			LeavesQuantity: "0", AvgPrice: "130.5", LimitPrice: "130", StopPrice: "130",
+		}
+
+		order := <-orders
+		require.Equal(t, takeProfit.ExchangeID, order.ExchangeID)
+		require.Equal(t, "BTCUSD", order.Pair)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, order.Type)
+		require.Equal(t, 130.5, order.Price)
+		require.Equal(t, 0.5, order.Quantity)
+	})
+}
+
+func TestCoinbaseAggregator(t *testing.T) {
+	aggregator := &coinbaseAggregator{pair: "BTCUSD", duration: time.Hour}
+	candles := make([]model.Candle, 0)
+	for i := 0; i < 13; i++ {
+		candle, err := coinbaseTestCandle(coinbaseStart.Add(time.Duration(i)*5*time.Minute), 100, float64(100+i)).
+			toModel("BTCUSD")
+		require.NoError(t, err)
+
+		complete, partial := aggregator.update(candle)
+		require.False(t, partial.Complete)
+		if complete != nil {
+			candles = append(candles, *complete)
+		}
+	}
+
+	require.Len(t, candles, 1)
+	require.True(t, candles[0].Complete)
+	require.Equal(t, 111.0, candles[0].Close)
+	require.Equal(t, 112.0, candles[0].High)
+	require.Equal(t, 120.0, candles[0].Volume)
+}
@@ -23,6 +23,11 @@ type PairFeed struct {
 	File       string
 	Timeframe  string
 	HeikinAshi bool
+	// Session sets the timezone and day start used to aggregate daily and weekly candles, default: UTC
+	Session model.Session
+	// Ticks reads a file of trades, with time, price and quantity columns, aggregated in candles of the
+	// timeframe of the feed, default: 1s. Times are in seconds or milliseconds.
+	Ticks bool
 }
 
 type CSVFeed struct {
@@ -89,78 +94,182 @@ func NewCSVFeed(targetTimeframe string, feeds ...PairFeed) (*CSVFeed, error) {
 		}
 
 		var candles []model.Candle
-		ha := model.NewHeikinAshi()
+		if feed.Ticks {
+			if feed.Timeframe == "" {
+				feed.Timeframe = "1s"
+				csvFeed.Feeds[feed.Pair] = feed
+			}
+			candles, err = readTicks(feed, csvLines)
+		} else {
+			candles, err = readCandles(feed, csvLines)
+		}
+		if err != nil {
+			return nil, err
+		}
 
-		// map each header label with its index
-		headerMap, additionalHeaders, hasCustomHeaders := parseHeaders(csvLines[0])
-		if hasCustomHeaders {
-			csvLines = csvLines[1:]
+		csvFeed.CandlePairTimeFrame[csvFeed.feedTimeframeKey(feed.Pair, feed.Timeframe)] = candles
+
+		err = csvFeed.resample(feed.Pair, feed.Timeframe, targetTimeframe, feed.Session)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		for _, line := range csvLines {
-			timestamp, err := strconv.Atoi(line[headerMap["time"]])
-			if err != nil {
-				return nil, err
-			}
+	return csvFeed, nil
+}
 
-			candle := model.Candle{
-				Time:      time.Unix(int64(timestamp), 0).UTC(),
-				UpdatedAt: time.Unix(int64(timestamp), 0).UTC(),
-				Pair:      feed.Pair,
-				Complete:  true,
-			}
+// readCandles parses the candles of a CSV file, with an optional header and additional metadata columns
+func readCandles(feed PairFeed, csvLines [][]string) ([]model.Candle, error) {
+	var candles []model.Candle
+	ha := model.NewHeikinAshi()
 
-			candle.Open, err = strconv.ParseFloat(line[headerMap["open"]], 64)
-			if err != nil {
-				return nil, err
-			}
+	// map each header label with its index
+	headerMap, additionalHeaders, hasCustomHeaders := parseHeaders(csvLines[0])
+	if hasCustomHeaders {
+		csvLines = csvLines[1:]
+	}
 
-			candle.Close, err = strconv.ParseFloat(line[headerMap["close"]], 64)
-			if err != nil {
-				return nil, err
-			}
+	for _, line := range csvLines {
+		timestamp, err := strconv.Atoi(line[headerMap["time"]])
+		if err != nil {
+			return nil, err
+		}
 
-			candle.Low, err = strconv.ParseFloat(line[headerMap["low"]], 64)
-			if err != nil {
-				return nil, err
-			}
+		candle := model.Candle{
+			Time:      time.Unix(int64(timestamp), 0).UTC(),
+			UpdatedAt: time.Unix(int64(timestamp), 0).UTC(),
+			Pair:      feed.Pair,
+			Complete:  true,
+		}
 
-			candle.High, err = strconv.ParseFloat(line[headerMap["high"]], 64)
-			if err != nil {
-				return nil, err
-			}
+		candle.Open, err = strconv.ParseFloat(line[headerMap["open"]], 64)
+		if err != nil {
+			return nil, err
+		}
 
-			candle.Volume, err = strconv.ParseFloat(line[headerMap["volume"]], 64)
-			if err != nil {
-				return nil, err
-			}
+		candle.Close, err = strconv.ParseFloat(line[headerMap["close"]], 64)
+		if err != nil {
+			return nil, err
+		}
 
-			if hasCustomHeaders {
-				candle.Metadata = make(map[string]float64)
-				for _, header := range additionalHeaders {
-					candle.Metadata[header], err = strconv.ParseFloat(line[headerMap[header]], 64)
-					if err != nil {
-						return nil, err
-					}
+		candle.Low, err = strconv.ParseFloat(line[headerMap["low"]], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		candle.High, err = strconv.ParseFloat(line[headerMap["high"]], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		candle.Volume, err = strconv.ParseFloat(line[headerMap["volume"]], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if hasCustomHeaders {
+			candle.Metadata = make(map[string]float64)
+			for _, header := range additionalHeaders {
+				candle.Metadata[header], err = strconv.ParseFloat(line[headerMap[header]], 64)
+				if err != nil {
+					return nil, err
 				}
 			}
+		}
 
-			if feed.HeikinAshi {
-				candle = candle.ToHeikinAshi(ha)
-			}
+		if feed.HeikinAshi {
+			candle = candle.ToHeikinAshi(ha)
+		}
+
+		candles = append(candles, candle)
+	}
+
+	return candles, nil
+}
 
-			candles = append(candles, candle)
+// readTicks aggregates the trades of a CSV file in candles of the feed timeframe. Periods without trades are
+// filled with candles at the last price and no volume, so candles are contiguous to be resampled.
+func readTicks(feed PairFeed, csvLines [][]string) ([]model.Candle, error) {
+	interval, err := str2duration.ParseDuration(feed.Timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	headerMap := map[string]int{"time": 0, "price": 1, "quantity": 2}
+	if _, err := strconv.ParseFloat(csvLines[0][0], 64); err != nil {
+		for index, header := range csvLines[0] {
+			headerMap[header] = index
 		}
+		csvLines = csvLines[1:]
+	}
 
-		csvFeed.CandlePairTimeFrame[csvFeed.feedTimeframeKey(feed.Pair, feed.Timeframe)] = candles
+	var candles []model.Candle
+	for _, line := range csvLines {
+		timestamp, err := strconv.ParseInt(line[headerMap["time"]], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		tradeTime := time.Unix(timestamp, 0).UTC()
+		if timestamp > 1e12 {
+			tradeTime = time.UnixMilli(timestamp).UTC()
+		}
+
+		price, err := strconv.ParseFloat(line[headerMap["price"]], 64)
+		if err != nil {
+			return nil, err
+		}
 
-		err = csvFeed.resample(feed.Pair, feed.Timeframe, targetTimeframe)
+		quantity, err := strconv.ParseFloat(line[headerMap["quantity"]], 64)
 		if err != nil {
 			return nil, err
 		}
+
+		start := tradeTime.Truncate(interval)
+		last := len(candles) - 1
+		if last >= 0 && candles[last].Time.Equal(start) {
+			candles[last].High = math.Max(candles[last].High, price)
+			candles[last].Low = math.Min(candles[last].Low, price)
+			candles[last].Close = price
+			candles[last].Volume += quantity
+			candles[last].UpdatedAt = tradeTime
+			continue
+		}
+
+		if last >= 0 && start.Before(candles[last].Time) {
+			return nil, fmt.Errorf("trades of %s out of order at %s", feed.Pair, tradeTime)
+		}
+
+		// periods without trades
+		for last >= 0 && candles[last].Time.Add(interval).Before(start) {
+			previous := candles[last]
+			candles = append(candles, model.Candle{
+				Pair:      feed.Pair,
+				Time:      previous.Time.Add(interval),
+				UpdatedAt: previous.Time.Add(interval),
+				Open:      previous.Close,
+				Close:     previous.Close,
+				Low:       previous.Close,
+				High:      previous.Close,
+				Complete:  true,
+			})
+			last++
+		}
+
+		candles = append(candles, model.Candle{
+			Pair:      feed.Pair,
+			Time:      start,
+			UpdatedAt: tradeTime,
+			Open:      price,
+			Close:     price,
+			Low:       price,
+			High:      price,
+			Volume:    quantity,
+			Complete:  true,
+		})
 	}
 
-	return csvFeed, nil
+	return candles, nil
 }
 
 func (c CSVFeed) feedTimeframeKey(pair, timeframe string) string {
@@ -204,42 +313,53 @@ func isLastCandlePeriod(t time.Time, fromTimeframe, targetTimeframe string) (boo
 
 	next := t.Add(fromDuration).UTC()
 
+	// sources of seconds, eg: 1s candles, close minute periods at the first second
+	aligned := next.Second() == 0
+
 	switch targetTimeframe {
 	case "1m":
-		return next.Second()%60 == 0, nil
+		return aligned, nil
 	case "5m":
-		return next.Minute()%5 == 0, nil
+		return aligned && next.Minute()%5 == 0, nil
 	case "10m":
-		return next.Minute()%10 == 0, nil
+		return aligned && next.Minute()%10 == 0, nil
 	case "15m":
-		return next.Minute()%15 == 0, nil
+		return aligned && next.Minute()%15 == 0, nil
 	case "30m":
-		return next.Minute()%30 == 0, nil
+		return aligned && next.Minute()%30 == 0, nil
 	case "1h":
-		return next.Minute()%60 == 0, nil
+		return aligned && next.Minute()%60 == 0, nil
 	case "2h":
-		return next.Minute() == 0 && next.Hour()%2 == 0, nil
+		return aligned && next.Minute() == 0 && next.Hour()%2 == 0, nil
 	case "4h":
-		return next.Minute() == 0 && next.Hour()%4 == 0, nil
+		return aligned && next.Minute() == 0 && next.Hour()%4 == 0, nil
 	case "12h":
-		return next.Minute() == 0 && next.Hour()%12 == 0, nil
+		return aligned && next.Minute() == 0 && next.Hour()%12 == 0, nil
 	case "1d":
-		return next.Minute() == 0 && next.Hour()%24 == 0, nil
+		return aligned && next.Minute() == 0 && next.Hour()%24 == 0, nil
 	case "1w":
-		return next.Minute() == 0 && next.Hour()%24 == 0 && next.Weekday() == time.Sunday, nil
+		return aligned && next.Minute() == 0 && next.Hour()%24 == 0 && next.Weekday() == time.Sunday, nil
 	}
 
 	return false, fmt.Errorf("invalid timeframe: %s", targetTimeframe)
 }
 
-func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string) error {
+// sessionTime converts a candle time to the session clock for daily and weekly timeframes
+func sessionTime(t time.Time, timeframe string, session model.Session) time.Time {
+	if timeframe == "1d" || timeframe == "1w" {
+		return session.SessionTime(t)
+	}
+	return t
+}
+
+func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string, session model.Session) error {
 	sourceKey := c.feedTimeframeKey(pair, sourceTimeframe)
 	targetKey := c.feedTimeframeKey(pair, targetTimeframe)
 
 	var i int
 	for ; i < len(c.CandlePairTimeFrame[sourceKey]); i++ {
-		if ok, err := isFistCandlePeriod(c.CandlePairTimeFrame[sourceKey][i].Time, sourceTimeframe,
-			targetTimeframe); err != nil {
+		candleTime := sessionTime(c.CandlePairTimeFrame[sourceKey][i].Time, targetTimeframe, session)
+		if ok, err := isFistCandlePeriod(candleTime, sourceTimeframe, targetTimeframe); err != nil {
 			return err
 		} else if ok {
 			break
@@ -249,7 +369,8 @@ func (c *CSVFeed) resample(pair, sourceTimeframe, targetTimeframe string) error
 	candles := make([]model.Candle, 0)
 	for ; i < len(c.CandlePairTimeFrame[sourceKey]); i++ {
 		candle := c.CandlePairTimeFrame[sourceKey][i]
-		if last, err := isLastCandlePeriod(candle.Time, sourceTimeframe, targetTimeframe); err != nil {
+		candleTime := sessionTime(candle.Time, targetTimeframe, session)
+		if last, err := isLastCandlePeriod(candleTime, sourceTimeframe, targetTimeframe); err != nil {
 			return err
 		} else if last {
 			candle.Complete = true
@@ -302,6 +423,11 @@ func (c *CSVFeed) CandlesByLimit(_ context.Context, pair, timeframe string, limi
 	return result, nil
 }
 
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (c CSVFeed) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("csv feed")
+}
+
 func (c CSVFeed) CandlesSubscription(_ context.Context, pair, timeframe string) (chan model.Candle, chan error) {
 	ccandle := make(chan model.Candle)
 	cerr := make(chan error)
@@ -3,11 +3,15 @@ package exchange
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
 )
 
 func TestNewCSVFeed(t *testing.T) {
@@ -49,6 +53,61 @@ func TestNewCSVFeed(t *testing.T) {
 	})
 }
 
+func TestNewCSVFeed_Ticks(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ticks.csv")
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticks := "time,price,quantity\n"
+	for _, tick := range []struct {
+		offset   time.Duration
+		price    float64
+		quantity float64
+	}{
+		{0, 100, 1},
+		{300 * time.Millisecond, 102, 2},
+		{900 * time.Millisecond, 99, 1},
+		{3 * time.Second, 101, 1},
+		{61 * time.Second, 103, 1},
+		{119 * time.Second, 104, 1},
+	} {
+		ticks += fmt.Sprintf("%d,%g,%g\n", start.Add(tick.offset).UnixMilli(), tick.price, tick.quantity)
+	}
+	require.NoError(t, os.WriteFile(file, []byte(ticks), 0600))
+
+	feed, err := NewCSVFeed("1m", PairFeed{Pair: "BTCUSDT", File: file, Ticks: true})
+	require.NoError(t, err)
+	require.Equal(t, "1s", feed.Feeds["BTCUSDT"].Timeframe)
+
+	// trades are aggregated by second, with the seconds without trades at the last price
+	seconds := feed.CandlePairTimeFrame["BTCUSDT--1s"]
+	require.Len(t, seconds, 120)
+	require.Equal(t, model.Candle{
+		Pair:      "BTCUSDT",
+		Time:      start,
+		UpdatedAt: start.Add(900 * time.Millisecond),
+		Open:      100,
+		Close:     99,
+		Low:       99,
+		High:      102,
+		Volume:    4,
+		Complete:  true,
+	}, seconds[0])
+	require.Equal(t, 99.0, seconds[2].Open)
+	require.Equal(t, 99.0, seconds[2].Close)
+	require.Zero(t, seconds[2].Volume)
+	require.Equal(t, start.Add(2*time.Minute-time.Second), seconds[119].Time)
+
+	minutes := feed.CandlePairTimeFrame["BTCUSDT--1m"]
+	require.Len(t, minutes, 120)
+	require.True(t, minutes[59].Complete)
+	require.Equal(t, start, minutes[59].Time)
+	require.Equal(t, 100.0, minutes[59].Open)
+	require.Equal(t, 101.0, minutes[59].Close)
+	require.Equal(t, 102.0, minutes[59].High)
+	require.Equal(t, 5.0, minutes[59].Volume)
+	require.True(t, minutes[119].Complete)
+	require.Equal(t, 104.0, minutes[119].Close)
+}
+
 func TestCSVFeed_CandlesByLimit(t *testing.T) {
 	feed, err := NewCSVFeed("1d", PairFeed{
 		Timeframe: "1d",
@@ -94,6 +153,25 @@ func TestCSVFeed_resample(t *testing.T) {
 		assert.Equal(t, 147332.0, last.Volume)
 		assert.True(t, last.Complete)
 
+		// daily candles with a custom session, starting at 12:00 UTC
+		feed, err = NewCSVFeed(
+			"1d",
+			PairFeed{
+				Timeframe: "1h",
+				Pair:      "BTCUSDT",
+				File:      "../testdata/btc-1h.csv",
+				Session:   model.Session{DayStart: 12 * time.Hour},
+			})
+		require.NoError(t, err)
+		sessionComplete := 0
+		for _, candle := range feed.CandlePairTimeFrame["BTCUSDT--1d"] {
+			if candle.Complete {
+				sessionComplete++
+				require.Equal(t, 12, candle.Time.UTC().Hour())
+			}
+		}
+		require.Greater(t, sessionComplete, 0)
+
 		// load feed with 180 days witch candles of 1h
 		feed, err = NewCSVFeed(
 			"1d",
@@ -155,6 +233,9 @@ func TestIsLastCandlePeriod(t *testing.T) {
 			{"1m", "4h", time.Date(2021, 1, 2, 3, 59, 0, 0, time.UTC), true},
 			{"1m", "12h", time.Date(2021, 1, 2, 23, 59, 0, 0, time.UTC), true},
 			{"1d", "1w", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), true},
+			{"1s", "1h", time.Date(2021, 1, 2, 0, 59, 59, 0, time.UTC), true},
+			{"1s", "1h", time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), false},
+			{"1s", "5m", time.Date(2021, 1, 2, 0, 4, 30, 0, time.UTC), false},
 		}
 
 		for _, tc := range tt {
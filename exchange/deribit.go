@@ -0,0 +1,1065 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	deribitEndpoint              = "https://www.deribit.com"
+	deribitStreamEndpoint        = "wss://www.deribit.com/ws/api/v2"
+	deribitTestnetEndpoint       = "https://test.deribit.com"
+	deribitTestnetStreamEndpoint = "wss://test.deribit.com/ws/api/v2"
+
+	// deribitCandleLimit is the number of candles requested at once
+	deribitCandleLimit = 1000
+)
+
+// DeribitError is an error returned by the Deribit JSON-RPC API
+type DeribitError struct {
+	Code    int
+	Message string
+}
+
+func (e *DeribitError) Error() string {
+	return fmt.Sprintf("deribit error %d: %s", e.Code, e.Message)
+}
+
+// deribitResolutions maps the ninjabot periods to the Deribit chart resolutions, in minutes
+var deribitResolutions = map[string]string{
+	"1m": "1", "3m": "3", "5m": "5", "10m": "10", "15m": "15", "30m": "30", "1h": "60", "2h": "120",
+	"3h": "180", "6h": "360", "12h": "720", "1d": "1D",
+}
+
+// deribitInstrument is a future or option of the public/get_instruments method
+type deribitInstrument struct {
+	InstrumentName     string  `json:"instrument_name"`
+	Kind               string  `json:"kind"`
+	BaseCurrency       string  `json:"base_currency"`
+	SettlementCurrency string  `json:"settlement_currency"`
+	TickSize           float64 `json:"tick_size"`
+	MinTradeAmount     float64 `json:"min_trade_amount"`
+	ContractSize       float64 `json:"contract_size"`
+	IsActive           bool    `json:"is_active"`
+}
+
+// Deribit is the Deribit exchange of inverse futures and options. Pairs are the instrument names, eg:
+// BTC-PERPETUAL, BTC-29DEC23 or BTC-29DEC23-40000-C, registered for SplitAssetQuote with the instrument as
+// asset and the settlement currency as quote, since results are settled in the currency.
+//
+// Quantities are Deribit amounts: USD for inverse futures and the base currency for options. Positions
+// are reported by instrument in Account, along with the collateral of each currency.
+type Deribit struct {
+	ctx         context.Context
+	client      *http.Client
+	instruments map[string]deribitInstrument
+	assetsInfo  map[string]model.AssetInfo
+	lastID      int64
+	HeikinAshi  bool
+
+	APIKey    string
+	APISecret string
+
+	// Currencies are the currencies of the loaded instruments
+	Currencies []string
+
+	Endpoint       string
+	StreamEndpoint string
+
+	// orderIDs maps the ExchangeID of orders created outside ninjabot, which have no numeric label, to
+	// the Deribit order ids
+	mtx      sync.Mutex
+	orderIDs map[int64]string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+}
+
+type DeribitOption func(*Deribit)
+
+// WithDeribitCredentials will set the client id and secret of an API key
+func WithDeribitCredentials(key, secret string) DeribitOption {
+	return func(d *Deribit) {
+		d.APIKey = key
+		d.APISecret = secret
+	}
+}
+
+// WithDeribitCurrencies will load the instruments of the given currencies, BTC and ETH by default
+func WithDeribitCurrencies(currencies ...string) DeribitOption {
+	return func(d *Deribit) {
+		d.Currencies = currencies
+	}
+}
+
+// WithDeribitTestnet will use the Deribit testnet
+func WithDeribitTestnet() DeribitOption {
+	return func(d *Deribit) {
+		d.Endpoint = deribitTestnetEndpoint
+		d.StreamEndpoint = deribitTestnetStreamEndpoint
+	}
+}
+
+// WithDeribitHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithDeribitHeikinAshiCandle() DeribitOption {
+	return func(d *Deribit) {
+		d.HeikinAshi = true
+	}
+}
+
+// WithDeribitMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithDeribitMetadataFetcher(fetcher MetadataFetchers) DeribitOption {
+	return func(d *Deribit) {
+		d.MetadataFetchers = append(d.MetadataFetchers, fetcher)
+	}
+}
+
+// WithDeribitEndpoint overrides the REST and websocket endpoints
+func WithDeribitEndpoint(endpoint, streamEndpoint string) DeribitOption {
+	return func(d *Deribit) {
+		d.Endpoint = endpoint
+		d.StreamEndpoint = streamEndpoint
+	}
+}
+
+// NewDeribit will create a new Deribit instance
+func NewDeribit(ctx context.Context, options ...DeribitOption) (*Deribit, error) {
+	exchange := &Deribit{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		lastID:          time.Now().UnixNano(),
+		Currencies:      []string{"BTC", "ETH"},
+		Endpoint:        deribitEndpoint,
+		StreamEndpoint:  deribitStreamEndpoint,
+		orderIDs:        make(map[int64]string),
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	// Initialize with orders precision and assets limits
+	exchange.instruments = make(map[string]deribitInstrument)
+	exchange.assetsInfo = make(map[string]model.AssetInfo)
+	for _, currency := range exchange.Currencies {
+		for _, kind := range []string{"future", "option"} {
+			var instruments []deribitInstrument
+			err := exchange.call(ctx, "public/get_instruments", url.Values{
+				"currency": {currency},
+				"kind":     {kind},
+				"expired":  {"false"},
+			}, &instruments)
+			if err != nil {
+				return nil, fmt.Errorf("deribit ping fail: %w", err)
+			}
+
+			for _, instrument := range instruments {
+				if !instrument.IsActive {
+					continue
+				}
+
+				pair := instrument.InstrumentName
+				RegisterPair(pair, pair, instrument.SettlementCurrency)
+				exchange.instruments[pair] = instrument
+				exchange.assetsInfo[pair] = model.AssetInfo{
+					BaseAsset:          pair,
+					QuoteAsset:         instrument.SettlementCurrency,
+					MinQuantity:        instrument.MinTradeAmount,
+					MaxQuantity:        math.MaxFloat64,
+					StepSize:           instrument.MinTradeAmount,
+					MinPrice:           instrument.TickSize,
+					MaxPrice:           math.MaxFloat64,
+					TickSize:           instrument.TickSize,
+					BaseAssetPrecision: getDecimalPrecision(instrument.MinTradeAmount),
+					QuotePrecision:     getDecimalPrecision(instrument.TickSize),
+				}
+			}
+		}
+	}
+
+	log.Info("[SETUP] Using Deribit exchange")
+
+	return exchange, nil
+}
+
+// sign returns the authorization header of a request, signed with the HMAC-SHA256 of the timestamp,
+// nonce and request data
+func (d *Deribit) sign(method, uri, body string) string {
+	timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	nonce := strconv.FormatInt(atomic.AddInt64(&d.lastID, 1), 36)
+	data := timestamp + "\n" + nonce + "\n" + method + "\n" + uri + "\n" + body + "\n"
+
+	mac := hmac.New(sha256.New, []byte(d.APISecret))
+	mac.Write([]byte(data))
+	return fmt.Sprintf("deri-hmac-sha256 id=%s,ts=%s,sig=%s,nonce=%s", d.APIKey, timestamp,
+		hex.EncodeToString(mac.Sum(nil)), nonce)
+}
+
+// call sends a JSON-RPC method over HTTP, private methods are signed with the API key
+func (d *Deribit) call(ctx context.Context, method string, params url.Values, result interface{}) error {
+	uri := "/api/v2/" + method
+	if len(params) > 0 {
+		uri += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.Endpoint+uri, nil)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(method, "private/") {
+		req.Header.Set("Authorization", d.sign(http.MethodGet, uri, ""))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int             `json:"code"`
+			Message string          `json:"message"`
+			Data    json.RawMessage `json:"data"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("deribit: invalid response with status %d: %w", resp.StatusCode, err)
+	}
+
+	if response.Error != nil {
+		message := response.Error.Message
+		if len(response.Error.Data) > 0 {
+			message += ": " + string(response.Error.Data)
+		}
+		return &DeribitError{Code: response.Error.Code, Message: message}
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+func (d *Deribit) AssetsInfo(pair string) model.AssetInfo {
+	return d.assetsInfo[pair]
+}
+
+// LastQuote returns the mark price of an instrument, as options may have no recent trades
+func (d *Deribit) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var ticker struct {
+		MarkPrice float64 `json:"mark_price"`
+	}
+	err := d.call(ctx, "public/ticker", url.Values{"instrument_name": {pair}}, &ticker)
+	if err != nil {
+		return 0, err
+	}
+	return ticker.MarkPrice, nil
+}
+
+func (d *Deribit) validate(pair string, quantity float64) error {
+	info, ok := d.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+// deribitOrder is an order of the private methods and the user.orders channel. The price of market
+// orders is the market_price string.
+type deribitOrder struct {
+	OrderID        string      `json:"order_id"`
+	Label          string      `json:"label"`
+	InstrumentName string      `json:"instrument_name"`
+	Direction      string      `json:"direction"`
+	OrderType      string      `json:"order_type"`
+	OrderState     string      `json:"order_state"`
+	Price          interface{} `json:"price"`
+	TriggerPrice   float64     `json:"trigger_price"`
+	Amount         float64     `json:"amount"`
+	FilledAmount   float64     `json:"filled_amount"`
+	AveragePrice   float64     `json:"average_price"`
+	CreatedAt      int64       `json:"creation_timestamp"`
+	UpdatedAt      int64       `json:"last_update_timestamp"`
+}
+
+// exchangeID returns the numeric label of orders created by ninjabot, other orders are identified by a hash
+// of the order id, which is kept to send requests with the order id
+func (d *Deribit) exchangeID(order deribitOrder) int64 {
+	if id, err := strconv.ParseInt(order.Label, 10, 64); err == nil {
+		return id
+	}
+
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(order.OrderID))
+	id := int64(hash.Sum64() & math.MaxInt64)
+
+	d.mtx.Lock()
+	d.orderIDs[id] = order.OrderID
+	d.mtx.Unlock()
+	return id
+}
+
+func (d *Deribit) toModel(order deribitOrder) model.Order {
+	result := model.Order{
+		ExchangeID: d.exchangeID(order),
+		Pair:       order.InstrumentName,
+		Side:       model.SideType(strings.ToUpper(order.Direction)),
+		Quantity:   order.Amount,
+		CreatedAt:  time.Unix(0, order.CreatedAt*int64(time.Millisecond)),
+		UpdatedAt:  time.Unix(0, order.UpdatedAt*int64(time.Millisecond)),
+	}
+
+	switch order.OrderType {
+	case "market":
+		result.Type = model.OrderTypeMarket
+	case "stop_market":
+		result.Type = model.OrderTypeStopLoss
+	case "stop_limit":
+		result.Type = model.OrderTypeStopLossLimit
+	case "take_market":
+		result.Type = model.OrderTypeTakeProfit
+	case "take_limit":
+		result.Type = model.OrderTypeTakeProfitLimit
+	default:
+		result.Type = model.OrderTypeLimit
+	}
+
+	switch order.OrderState {
+	case "filled":
+		result.Status = model.OrderStatusTypeFilled
+	case "cancelled":
+		result.Status = model.OrderStatusTypeCanceled
+	case "rejected":
+		result.Status = model.OrderStatusTypeRejected
+	default:
+		result.Status = model.OrderStatusTypeNew
+		if order.FilledAmount > 0 {
+			result.Status = model.OrderStatusTypePartiallyFilled
+		}
+	}
+
+	if price, ok := order.Price.(float64); ok {
+		result.Price = price
+	}
+	if order.FilledAmount > 0 {
+		result.Price = order.AveragePrice
+	}
+	if order.TriggerPrice > 0 {
+		stop := order.TriggerPrice
+		result.Stop = &stop
+		if result.Price == 0 {
+			result.Price = stop
+		}
+	}
+	if result.Status == model.OrderStatusTypeFilled {
+		result.Quantity = order.FilledAmount
+	}
+
+	return result
+}
+
+// createOrder places an order labeled with its ExchangeID, a new one when the id is zero
+func (d *Deribit) createOrder(side model.SideType, pair, orderType string, id int64, quantity float64,
+	params url.Values) (model.Order, error) {
+
+	if err := d.validate(pair, quantity); err != nil {
+		return model.Order{}, err
+	}
+
+	info := d.assetsInfo[pair]
+	params.Set("instrument_name", pair)
+	params.Set("amount", formatStep(quantity, info.StepSize))
+	params.Set("type", orderType)
+	if id == 0 {
+		id = atomic.AddInt64(&d.lastID, 1)
+	}
+	params.Set("label", strconv.FormatInt(id, 10))
+	for _, key := range []string{"price", "trigger_price"} {
+		if value := params.Get(key); value != "" {
+			price, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return model.Order{}, err
+			}
+			params.Set(key, formatStep(price, info.TickSize))
+		}
+	}
+
+	var result struct {
+		Order deribitOrder `json:"order"`
+	}
+	err := d.call(d.ctx, "private/"+strings.ToLower(string(side)), params, &result)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return d.toModel(result.Order), nil
+}
+
+// closingQuantity returns the size of the position of an instrument
+func (d *Deribit) closingQuantity(pair string) (float64, error) {
+	position, _, err := d.Position(pair)
+	if err != nil {
+		return 0, err
+	}
+	if position == 0 {
+		return 0, fmt.Errorf("%w: no open position of %s", ErrInvalidQuantity, pair)
+	}
+	return math.Abs(position), nil
+}
+
+func (d *Deribit) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: deribit oco", ErrUnsupportedOrder)
+}
+
+func (d *Deribit) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return d.createOrderLimit(side, pair, quantity, limit, 0)
+}
+
+func (d *Deribit) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+
+	return d.createOrder(side, pair, "limit", id, quantity, url.Values{
+		"price": {strconv.FormatFloat(limit, 'f', -1, 64)},
+	})
+}
+
+func (d *Deribit) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+	return d.createOrderMarket(side, pair, quantity, reduceOnly, 0)
+}
+
+func (d *Deribit) createOrderMarket(side model.SideType, pair string, quantity float64, reduceOnly bool,
+	id int64) (model.Order, error) {
+
+	return d.createOrder(side, pair, "market", id, quantity, url.Values{
+		"reduce_only": {strconv.FormatBool(reduceOnly)},
+	})
+}
+
+func (d *Deribit) CreateOrderMarketQuote(_ model.SideType, _ string, _ float64) (model.Order, error) {
+	return model.Order{}, fmt.Errorf("%w: deribit market order by quote", ErrUnsupportedOrder)
+}
+
+// CreateOrderStop places a stop market order triggered by the mark price, following the same semantics
+// of BinanceFuture: a negative limit creates a buy stop, and a zero quantity closes the position
+func (d *Deribit) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	side := model.SideTypeSell
+	if limit < 0 {
+		side = model.SideTypeBuy
+		limit = -limit
+	}
+	return d.createOrderStop(side, pair, quantity, limit, 0)
+}
+
+func (d *Deribit) createOrderStop(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+
+	reduceOnly := quantity == 0
+	if reduceOnly {
+		var err error
+		if quantity, err = d.closingQuantity(pair); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	return d.createOrder(side, pair, "stop_market", id, quantity, url.Values{
+		"trigger_price": {strconv.FormatFloat(limit, 'f', -1, 64)},
+		"trigger":       {"mark_price"},
+		"reduce_only":   {strconv.FormatBool(reduceOnly)},
+	})
+}
+
+// TakeProfit places a take limit order for a given quantity, or a take market order closing the
+// position when the quantity is zero
+func (d *Deribit) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (model.Order, error) {
+	return d.takeProfit(side, pair, quantity, limit, 0)
+}
+
+func (d *Deribit) takeProfit(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+
+	price := strconv.FormatFloat(limit, 'f', -1, 64)
+	params := url.Values{"trigger_price": {price}, "trigger": {"mark_price"}}
+	orderType := "take_limit"
+	if quantity == 0 {
+		var err error
+		if quantity, err = d.closingQuantity(pair); err != nil {
+			return model.Order{}, err
+		}
+		orderType = "take_market"
+		params.Set("reduce_only", "true")
+	} else {
+		params.Set("price", price)
+	}
+
+	return d.createOrder(side, pair, orderType, id, quantity, params)
+}
+
+// CreateOrderRequest places an order with the client order ID of the request. The label of the order, its
+// ExchangeID, is a number derived from the client order ID.
+func (d *Deribit) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	id := clientOrderNumber(request.ClientOrderID)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: deribit time in force %s", ErrUnsupportedOrder,
+				request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: deribit iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = d.createOrderLimit(request.Side, request.Pair, request.Quantity, request.Price, id)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			return d.CreateOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity)
+		}
+		order, err = d.createOrderMarket(request.Side, request.Pair, request.Quantity, request.ReduceOnly, id)
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		order, err = d.createOrderStop(request.Side, request.Pair, request.Quantity, request.Stop, id)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = d.takeProfit(request.Side, request.Pair, request.Quantity, request.Stop, id)
+	default:
+		return model.Order{}, fmt.Errorf("%w: deribit %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns the order of a client order ID, or ErrOrderNotFound
+func (d *Deribit) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	order, err := d.orderByLabel(pair, clientOrderNumber(clientOrderID))
+	if err != nil {
+		return model.Order{}, err
+	}
+	if order == nil {
+		return model.Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, clientOrderID)
+	}
+
+	order.ClientOrderID = clientOrderID
+	return *order, nil
+}
+
+// currency returns the currency of an instrument, used by requests of orders by label
+func (d *Deribit) currency(pair string) string {
+	if instrument, ok := d.instruments[pair]; ok {
+		return instrument.BaseCurrency
+	}
+	return strings.Split(pair, "-")[0]
+}
+
+// orderID returns the Deribit order id of orders created outside ninjabot
+func (d *Deribit) orderID(id int64) (string, bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	orderID, ok := d.orderIDs[id]
+	return orderID, ok
+}
+
+func (d *Deribit) Cancel(order model.Order) error {
+	if orderID, ok := d.orderID(order.ExchangeID); ok {
+		return d.call(d.ctx, "private/cancel", url.Values{"order_id": {orderID}}, nil)
+	}
+
+	return d.call(d.ctx, "private/cancel_by_label", url.Values{
+		"label":    {strconv.FormatInt(order.ExchangeID, 10)},
+		"currency": {d.currency(order.Pair)},
+	}, nil)
+}
+
+func (d *Deribit) CancelOpenOrders(pair string) error {
+	return d.call(d.ctx, "private/cancel_all_by_instrument", url.Values{"instrument_name": {pair}}, nil)
+}
+
+func (d *Deribit) OpenOrders(pair string) ([]model.Order, error) {
+	var result []deribitOrder
+	err := d.call(d.ctx, "private/get_open_orders_by_instrument", url.Values{"instrument_name": {pair}}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(result))
+	for _, order := range result {
+		orders = append(orders, d.toModel(order))
+	}
+	return orders, nil
+}
+
+func (d *Deribit) Order(pair string, id int64) (model.Order, error) {
+	if orderID, ok := d.orderID(id); ok {
+		var order deribitOrder
+		err := d.call(d.ctx, "private/get_order_state", url.Values{"order_id": {orderID}}, &order)
+		if err != nil {
+			return model.Order{}, err
+		}
+		return d.toModel(order), nil
+	}
+
+	order, err := d.orderByLabel(pair, id)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if order == nil {
+		return model.Order{}, fmt.Errorf("deribit order %d not found", id)
+	}
+	return *order, nil
+}
+
+// orderByLabel returns an order of an instrument by its label, nil when it is not found
+func (d *Deribit) orderByLabel(pair string, id int64) (*model.Order, error) {
+	var result []deribitOrder
+	err := d.call(d.ctx, "private/get_order_state_by_label", url.Values{
+		"label":    {strconv.FormatInt(id, 10)},
+		"currency": {d.currency(pair)},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, order := range result {
+		if order.InstrumentName == pair {
+			found := d.toModel(order)
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+// Account returns the positions of each instrument, negative for short positions, and the collateral of
+// each currency. The available funds are free and the remaining equity is locked by positions and orders.
+func (d *Deribit) Account() (model.Account, error) {
+	balances := make([]model.Balance, 0)
+	for _, currency := range d.Currencies {
+		var positions []struct {
+			InstrumentName string  `json:"instrument_name"`
+			Size           float64 `json:"size"`
+			Leverage       float64 `json:"leverage"`
+		}
+		err := d.call(d.ctx, "private/get_positions", url.Values{"currency": {currency}}, &positions)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		for _, position := range positions {
+			if position.Size == 0 {
+				continue
+			}
+
+			balances = append(balances, model.Balance{
+				Asset:    position.InstrumentName,
+				Free:     position.Size,
+				Leverage: position.Leverage,
+			})
+		}
+	}
+
+	for _, currency := range d.Currencies {
+		var summary struct {
+			Equity         float64 `json:"equity"`
+			AvailableFunds float64 `json:"available_funds"`
+		}
+		err := d.call(d.ctx, "private/get_account_summary", url.Values{"currency": {currency}}, &summary)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		balances = append(balances, model.Balance{
+			Asset: currency,
+			Free:  summary.AvailableFunds,
+			Lock:  math.Max(summary.Equity-summary.AvailableFunds, 0),
+		})
+	}
+
+	return model.Account{
+		Balances: balances,
+	}, nil
+}
+
+// Position returns the position of an instrument and the available funds of its settlement currency
+func (d *Deribit) Position(pair string) (asset, quote float64, err error) {
+	acc, err := d.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(pair, d.assetsInfo[pair].QuoteAsset)
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free, nil
+}
+
+// PositionRisk returns the size of the position, Deribit does not provide position details
+func (d *Deribit) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(d, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, Deribit does not support amending orders
+func (d *Deribit) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(d, order, price, quantity)
+}
+
+// candles returns the complete candles of traded prices of a period, Deribit has no history of mark prices
+func (d *Deribit) candles(ctx context.Context, pair, period string, start, end time.Time) ([]model.Candle, error) {
+	resolution, ok := deribitResolutions[period]
+	if !ok {
+		return nil, fmt.Errorf("invalid deribit resolution %s", period)
+	}
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	candles := make([]model.Candle, 0)
+	for !start.After(end) {
+		chunkEnd := start.Add(time.Duration(deribitCandleLimit-1) * duration)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+
+		var chart struct {
+			Ticks  []int64   `json:"ticks"`
+			Open   []float64 `json:"open"`
+			High   []float64 `json:"high"`
+			Low    []float64 `json:"low"`
+			Close  []float64 `json:"close"`
+			Volume []float64 `json:"volume"`
+		}
+		err := d.call(ctx, "public/get_tradingview_chart_data", url.Values{
+			"instrument_name": {pair},
+			"resolution":      {resolution},
+			"start_timestamp": {strconv.FormatInt(start.UnixNano()/int64(time.Millisecond), 10)},
+			"end_timestamp":   {strconv.FormatInt(chunkEnd.UnixNano()/int64(time.Millisecond), 10)},
+		}, &chart)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, tick := range chart.Ticks {
+			t := time.Unix(0, tick*int64(time.Millisecond))
+			// the last candle is in progress until the end of its period
+			if t.Add(duration).After(now) || i >= len(chart.Close) || i >= len(chart.Volume) {
+				continue
+			}
+
+			candles = append(candles, model.Candle{
+				Pair:      pair,
+				Time:      t,
+				UpdatedAt: t.Add(duration - time.Millisecond),
+				Open:      chart.Open[i],
+				High:      chart.High[i],
+				Low:       chart.Low[i],
+				Close:     chart.Close[i],
+				Volume:    chart.Volume[i],
+				Complete:  true,
+				Metadata:  make(map[string]float64),
+			})
+		}
+		start = chunkEnd.Add(duration)
+	}
+
+	if d.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+func (d *Deribit) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	candles, err := d.candles(ctx, pair, period, end.Add(-time.Duration(limit+1)*duration), end)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	return candles, nil
+}
+
+func (d *Deribit) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+	return d.candles(ctx, pair, period, start, end)
+}
+
+// deribitMessage is a response or a subscription notification of the websocket API
+type deribitMessage struct {
+	ID     int64  `json:"id"`
+	Method string `json:"method"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Params struct {
+		Channel string          `json:"channel"`
+		Data    json.RawMessage `json:"data"`
+	} `json:"params"`
+}
+
+func deribitRequest(id int64, method string, params interface{}) map[string]interface{} {
+	return map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+}
+
+var deribitPing = deribitRequest(0, "public/test", map[string]interface{}{})
+
+// CandlesSubscription streams candles of the mark price of an instrument, aggregated from the ticker
+// channel, which keeps candles of options with few trades meaningful. Mark prices have no volume, and
+// candles are complete when a mark price of the next period is received.
+func (d *Deribit) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		duration, err := str2duration.ParseDuration(period)
+		if err != nil {
+			cerr <- err
+			close(cerr)
+			close(ccandle)
+			return
+		}
+
+		subscribe := deribitRequest(1, "public/subscribe", map[string]interface{}{
+			"channels": []string{"ticker." + pair + ".100ms"},
+		})
+
+		var current *model.Candle
+		for {
+			done, stop, err := wsServeJSON(d.StreamEndpoint, []interface{}{subscribe}, deribitPing,
+				func(message []byte) {
+					var event deribitMessage
+					if err := json.Unmarshal(message, &event); err != nil || event.Method != "subscription" {
+						return
+					}
+
+					var ticker struct {
+						Timestamp int64   `json:"timestamp"`
+						MarkPrice float64 `json:"mark_price"`
+					}
+					if err := json.Unmarshal(event.Params.Data, &ticker); err != nil || ticker.MarkPrice == 0 {
+						return
+					}
+
+					ba.Reset()
+					updatedAt := time.Unix(0, ticker.Timestamp*int64(time.Millisecond))
+					start := updatedAt.Truncate(duration)
+					if current != nil && start.Before(current.Time) {
+						return
+					}
+
+					candles := make([]model.Candle, 0, 2)
+					if current != nil && start.After(current.Time) {
+						complete := *current
+						complete.Complete = true
+						if d.HeikinAshi {
+							complete = complete.ToHeikinAshi(ha)
+						}
+						// fetch aditional data if needed
+						fetchMetadata(ctx, d.MetadataFetchers, d.MetadataTimeout, &d.metadataKeys, &complete)
+						candles = append(candles, complete)
+						current = nil
+					}
+
+					price := ticker.MarkPrice
+					if current == nil {
+						current = &model.Candle{Pair: pair, Time: start, Open: price, High: price, Low: price,
+							Metadata: make(map[string]float64)}
+					}
+					current.High = math.Max(current.High, price)
+					current.Low = math.Min(current.Low, price)
+					current.Close = price
+					current.UpdatedAt = updatedAt
+					candles = append(candles, *current)
+
+					for _, candle := range candles {
+						select {
+						case ccandle <- candle:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}, func(err error) {
+					select {
+					case cerr <- err:
+					case <-ctx.Done():
+					}
+				})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				// wait for the stream handlers before closing the channels
+				close(stop)
+				<-done
+				close(cerr)
+				close(ccandle)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (d *Deribit) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("deribit")
+}
+
+// AccountSubscription streams the order events of the account, it authenticates the connection with a
+// signature of the API key and reconnects until the context is done
+func (d *Deribit) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+
+		subscribe := deribitRequest(2, "private/subscribe", map[string]interface{}{
+			"channels": []string{"user.orders.any.any.raw"},
+		})
+
+		for {
+			timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+			nonce := strconv.FormatInt(atomic.AddInt64(&d.lastID, 1), 36)
+			mac := hmac.New(sha256.New, []byte(d.APISecret))
+			mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "\n" + nonce + "\n"))
+			auth := deribitRequest(1, "public/auth", map[string]interface{}{
+				"grant_type": "client_signature",
+				"client_id":  d.APIKey,
+				"timestamp":  timestamp,
+				"nonce":      nonce,
+				"data":       "",
+				"signature":  hex.EncodeToString(mac.Sum(nil)),
+			})
+
+			done, stop, err := wsConnect(d.StreamEndpoint, []interface{}{auth}, deribitPing,
+				func(conn *wsConn, message []byte) {
+					var event deribitMessage
+					if err := json.Unmarshal(message, &event); err != nil {
+						return
+					}
+
+					switch {
+					case event.Error != nil:
+						sendErr(&DeribitError{Code: event.Error.Code, Message: event.Error.Message})
+						return
+					case event.ID == 1:
+						// private channels are available after the authentication
+						if err := conn.send(subscribe); err != nil {
+							sendErr(err)
+						}
+						return
+					case event.Method != "subscription" || len(event.Params.Data) == 0:
+						return
+					}
+
+					var order deribitOrder
+					if err := json.Unmarshal(event.Params.Data, &order); err != nil {
+						sendErr(err)
+						return
+					}
+
+					ba.Reset()
+					select {
+					case corder <- d.toModel(order):
+					case <-ctx.Done():
+					}
+				}, sendErr)
+			if err != nil {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					close(cerr)
+					close(corder)
+					return
+				}
+				time.Sleep(ba.Duration())
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				close(stop)
+				<-done
+				close(cerr)
+				close(corder)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return corder, cerr
+}
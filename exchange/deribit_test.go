@@ -0,0 +1,448 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// deribitServer emulates the JSON-RPC methods over HTTP and the websocket API of Deribit
+type deribitServer struct {
+	*httptest.Server
+	mtx      sync.Mutex
+	requests []url.Values
+}
+
+func (s *deribitServer) request(i int) url.Values {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.requests[i]
+}
+
+func newDeribitServer(t *testing.T) *deribitServer {
+	s := &deribitServer{}
+
+	reply := func(w http.ResponseWriter, result interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "result": result})
+	}
+
+	order := func(params url.Values, state string) map[string]interface{} {
+		orderType := params.Get("type")
+		var price interface{} = "market_price"
+		if value, err := strconv.ParseFloat(params.Get("price"), 64); err == nil {
+			price = value
+		}
+		trigger, _ := strconv.ParseFloat(params.Get("trigger_price"), 64)
+		amount, _ := strconv.ParseFloat(params.Get("amount"), 64)
+		filled := 0.0
+		if state == "filled" {
+			filled = amount
+		}
+		return map[string]interface{}{"order_id": "ETH-1", "label": params.Get("label"),
+			"instrument_name": params.Get("instrument_name"), "direction": params.Get("direction"),
+			"order_type": orderType, "order_state": state, "price": price, "trigger_price": trigger,
+			"amount": amount, "filled_amount": filled, "average_price": 2000.5,
+			"creation_timestamp": 1640995200000, "last_update_timestamp": 1640995200000}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v2/", func(w http.ResponseWriter, r *http.Request) {
+		method := strings.TrimPrefix(r.URL.Path, "/api/v2/")
+		params := r.URL.Query()
+
+		if strings.HasPrefix(method, "private/") {
+			// verify the signature of the request
+			header := strings.TrimPrefix(r.Header.Get("Authorization"), "deri-hmac-sha256 ")
+			fields := make(map[string]string)
+			for _, field := range strings.Split(header, ",") {
+				parts := strings.SplitN(field, "=", 2)
+				fields[parts[0]] = parts[1]
+			}
+			require.Equal(t, "key", fields["id"])
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte(fields["ts"] + "\n" + fields["nonce"] + "\nGET\n" + r.URL.RequestURI() + "\n\n"))
+			require.Equal(t, hex.EncodeToString(mac.Sum(nil)), fields["sig"])
+
+			s.mtx.Lock()
+			params.Set("method", method)
+			s.requests = append(s.requests, params)
+			s.mtx.Unlock()
+		}
+
+		switch method {
+		case "public/get_instruments":
+			require.Equal(t, "false", params.Get("expired"))
+			instruments := make([]map[string]interface{}, 0)
+			if params.Get("currency") == "ETH" && params.Get("kind") == "future" {
+				instruments = append(instruments,
+					map[string]interface{}{"instrument_name": "ETH-PERPETUAL", "kind": "future",
+						"base_currency": "ETH", "settlement_currency": "ETH", "tick_size": 0.05,
+						"min_trade_amount": 1, "contract_size": 1, "is_active": true},
+					map[string]interface{}{"instrument_name": "ETH-OLD", "kind": "future", "is_active": false})
+			}
+			if params.Get("currency") == "ETH" && params.Get("kind") == "option" {
+				instruments = append(instruments, map[string]interface{}{"instrument_name": "ETH-29DEC23-2000-C",
+					"kind": "option", "base_currency": "ETH", "settlement_currency": "ETH", "tick_size": 0.0005,
+					"min_trade_amount": 1, "contract_size": 1, "is_active": true})
+			}
+			reply(w, instruments)
+		case "public/ticker":
+			reply(w, map[string]interface{}{"instrument_name": params.Get("instrument_name"), "mark_price": 2000.1,
+				"last_price": nil})
+		case "public/get_tradingview_chart_data":
+			require.Equal(t, "60", params.Get("resolution"))
+			start, _ := strconv.ParseInt(params.Get("start_timestamp"), 10, 64)
+			end, _ := strconv.ParseInt(params.Get("end_timestamp"), 10, 64)
+			chart := map[string][]interface{}{}
+			for tick := (start + 3599999) / 3600000 * 3600000; tick <= end; tick += 3600000 {
+				chart["ticks"] = append(chart["ticks"], tick)
+				chart["open"] = append(chart["open"], 2000)
+				chart["high"] = append(chart["high"], 2100)
+				chart["low"] = append(chart["low"], 1900)
+				chart["close"] = append(chart["close"], 2050)
+				chart["volume"] = append(chart["volume"], 10)
+			}
+			reply(w, chart)
+		case "private/buy", "private/sell":
+			state := "open"
+			if params.Get("type") == "market" {
+				state = "filled"
+			}
+			params.Set("direction", strings.TrimPrefix(method, "private/"))
+			reply(w, map[string]interface{}{"order": order(params, state), "trades": []interface{}{}})
+		case "private/get_open_orders_by_instrument":
+			limit := order(url.Values{"label": {"7"}, "instrument_name": {params.Get("instrument_name")},
+				"direction": {"buy"}, "type": {"limit"}, "price": {"1900"}, "amount": {"10"}}, "open")
+			limit["filled_amount"] = 2.0
+			stop := order(url.Values{"instrument_name": {params.Get("instrument_name")}, "direction": {"sell"},
+				"type": {"stop_market"}, "trigger_price": {"1800"}, "amount": {"10"}}, "untriggered")
+			reply(w, []interface{}{limit, stop})
+		case "private/get_order_state":
+			require.Equal(t, "ETH-1", params.Get("order_id"))
+			reply(w, order(url.Values{"instrument_name": {"ETH-PERPETUAL"}, "direction": {"sell"},
+				"type": {"stop_market"}, "trigger_price": {"1800"}, "amount": {"10"}}, "filled"))
+		case "private/get_order_state_by_label":
+			require.Equal(t, "ETH", params.Get("currency"))
+			orders := []interface{}{}
+			if params.Get("label") == "9" {
+				orders = append(orders, order(url.Values{"label": {"9"}, "instrument_name": {"ETH-PERPETUAL"},
+					"direction": {"buy"}, "type": {"limit"}, "price": {"1900"}, "amount": {"10"}}, "cancelled"))
+			}
+			// orders placed before are found by their label
+			s.mtx.Lock()
+			for _, placed := range s.requests {
+				method := placed.Get("method")
+				if (method == "private/buy" || method == "private/sell") && placed.Get("label") == params.Get("label") {
+					placed.Set("direction", strings.TrimPrefix(method, "private/"))
+					orders = append(orders, order(placed, "open"))
+				}
+			}
+			s.mtx.Unlock()
+			reply(w, orders)
+		case "private/get_positions":
+			positions := []interface{}{}
+			if params.Get("currency") == "ETH" {
+				positions = append(positions,
+					map[string]interface{}{"instrument_name": "ETH-PERPETUAL", "size": -20.0, "leverage": 25},
+					map[string]interface{}{"instrument_name": "ETH-29DEC23-2000-C", "size": 0.0})
+			}
+			reply(w, positions)
+		case "private/get_account_summary":
+			reply(w, map[string]interface{}{"currency": params.Get("currency"), "equity": 1.5,
+				"available_funds": 1.0})
+		case "private/cancel", "private/cancel_by_label", "private/cancel_all_by_instrument":
+			reply(w, 1)
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0",
+				"error": map[string]interface{}{"code": -32601, "message": "Method not found"}})
+		}
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws/api/v2", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var request struct {
+			ID     int64                  `json:"id"`
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		require.NoError(t, conn.ReadJSON(&request))
+		notify := func(channel string, data interface{}) {
+			_ = conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "method": "subscription",
+				"params": map[string]interface{}{"channel": channel, "data": data}})
+		}
+
+		switch request.Method {
+		case "public/subscribe":
+			require.Equal(t, []interface{}{"ticker.ETH-PERPETUAL.100ms"}, request.Params["channels"])
+			_ = conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": request.ID,
+				"result": request.Params["channels"]})
+			ticker := func(timestamp int64, price float64) map[string]interface{} {
+				return map[string]interface{}{"timestamp": timestamp, "mark_price": price}
+			}
+			notify("ticker.ETH-PERPETUAL.100ms", ticker(1640995200000, 2000))
+			notify("ticker.ETH-PERPETUAL.100ms", ticker(1640995260000, 2010))
+			notify("ticker.ETH-PERPETUAL.100ms", ticker(1640995320000, 1990))
+			notify("ticker.ETH-PERPETUAL.100ms", ticker(1640998800000, 2020))
+		case "public/auth":
+			require.Equal(t, "client_signature", request.Params["grant_type"])
+			require.Equal(t, "key", request.Params["client_id"])
+			timestamp := strconv.FormatInt(int64(request.Params["timestamp"].(float64)), 10)
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write([]byte(timestamp + "\n" + request.Params["nonce"].(string) + "\n"))
+			require.Equal(t, hex.EncodeToString(mac.Sum(nil)), request.Params["signature"])
+			_ = conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": request.ID,
+				"result": map[string]interface{}{"access_token": "token"}})
+
+			request.Params = nil
+			require.NoError(t, conn.ReadJSON(&request))
+			require.Equal(t, "private/subscribe", request.Method)
+			require.Equal(t, []interface{}{"user.orders.any.any.raw"}, request.Params["channels"])
+			notify("user.orders.any.any.raw", order(url.Values{"label": {"7"}, "instrument_name": {"ETH-PERPETUAL"},
+				"direction": {"buy"}, "type": {"stop_limit"}, "price": {"2100"}, "trigger_price": {"2050"},
+				"amount": {"10"}}, "filled"))
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+func newTestDeribit(t *testing.T) (*Deribit, *deribitServer) {
+	server := newDeribitServer(t)
+	deribit, err := NewDeribit(context.Background(),
+		WithDeribitCredentials("key", "secret"),
+		WithDeribitCurrencies("ETH"),
+		WithDeribitEndpoint(server.URL, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws/api/v2"),
+	)
+	require.NoError(t, err)
+	return deribit, server
+}
+
+func TestDeribit(t *testing.T) {
+	t.Run("instruments", func(t *testing.T) {
+		deribit, _ := newTestDeribit(t)
+		info := deribit.AssetsInfo("ETH-PERPETUAL")
+		require.Equal(t, "ETH-PERPETUAL", info.BaseAsset)
+		require.Equal(t, "ETH", info.QuoteAsset)
+		require.Equal(t, 1.0, info.MinQuantity)
+		require.Equal(t, 0.05, info.TickSize)
+		require.Equal(t, 0.0005, deribit.AssetsInfo("ETH-29DEC23-2000-C").TickSize)
+		require.Empty(t, deribit.AssetsInfo("ETH-OLD").BaseAsset)
+
+		asset, quote := SplitAssetQuote("ETH-29DEC23-2000-C")
+		require.Equal(t, "ETH-29DEC23-2000-C", asset)
+		require.Equal(t, "ETH", quote)
+
+		price, err := deribit.LastQuote(context.Background(), "ETH-PERPETUAL")
+		require.NoError(t, err)
+		require.Equal(t, 2000.1, price)
+
+		var apiError *DeribitError
+		err = deribit.call(context.Background(), "public/unknown", nil, nil)
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, -32601, apiError.Code)
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		deribit, _ := newTestDeribit(t)
+		candles, err := deribit.CandlesByLimit(context.Background(), "ETH-PERPETUAL", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, time.Now().Truncate(time.Hour).Add(-time.Hour), candles[1].Time)
+		require.Equal(t, 2050.0, candles[1].Close)
+		require.Equal(t, 10.0, candles[1].Volume)
+		require.True(t, candles[1].Complete)
+
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		candles, err = deribit.CandlesByPeriod(context.Background(), "ETH-PERPETUAL", "1h", start,
+			start.Add(1500*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 1501)
+		require.Equal(t, start, candles[0].Time.UTC())
+		require.Equal(t, start.Add(1500*time.Hour), candles[1500].Time.UTC())
+
+		_, err = deribit.CandlesByLimit(context.Background(), "ETH-PERPETUAL", "4h", 2)
+		require.Error(t, err)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		deribit, _ := newTestDeribit(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream, _ := deribit.CandlesSubscription(ctx, "ETH-PERPETUAL", "1h")
+		candles := make([]model.Candle, 0)
+		for i := 0; i < 5; i++ {
+			candles = append(candles, <-stream)
+		}
+
+		// mark prices are aggregated until a price of the next period
+		complete := candles[3]
+		require.True(t, complete.Complete)
+		require.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), complete.Time.UTC())
+		require.Equal(t, 2000.0, complete.Open)
+		require.Equal(t, 2010.0, complete.High)
+		require.Equal(t, 1990.0, complete.Low)
+		require.Equal(t, 1990.0, complete.Close)
+		require.False(t, candles[2].Complete)
+		require.False(t, candles[4].Complete)
+		require.Equal(t, 2020.0, candles[4].Open)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		deribit, server := newTestDeribit(t)
+
+		market, err := deribit.CreateOrderMarket(model.SideTypeBuy, "ETH-PERPETUAL", 10, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, model.SideTypeBuy, market.Side)
+		require.Equal(t, 2000.5, market.Price)
+		request := server.request(0)
+		require.Equal(t, "private/buy", request.Get("method"))
+		require.Equal(t, strconv.FormatInt(market.ExchangeID, 10), request.Get("label"))
+		require.Equal(t, "10", request.Get("amount"))
+		require.Equal(t, "false", request.Get("reduce_only"))
+
+		limit, err := deribit.CreateOrderLimit(model.SideTypeSell, "ETH-PERPETUAL", 10, 2100.07)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, 2100.05, limit.Price)
+		require.Equal(t, "2100.05", server.request(1).Get("price"))
+		require.NotEqual(t, market.ExchangeID, limit.ExchangeID)
+
+		var orderError *OrderError
+		_, err = deribit.CreateOrderLimit(model.SideTypeSell, "ETH-PERPETUAL", 0.5, 2100)
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+		_, err = deribit.CreateOrderMarketQuote(model.SideTypeBuy, "ETH-PERPETUAL", 100)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+		_, err = deribit.CreateOrderOCO(model.SideTypeSell, "ETH-PERPETUAL", 1, 110, 90, 89)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		// a zero quantity closes the short position with a reduce only buy stop
+		stop, err := deribit.CreateOrderStop("ETH-PERPETUAL", 0, -2200)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeBuy, stop.Side)
+		require.Equal(t, 2200.0, *stop.Stop)
+		require.Equal(t, 20.0, stop.Quantity)
+		request = server.request(4)
+		require.Equal(t, "private/buy", request.Get("method"))
+		require.Equal(t, "stop_market", request.Get("type"))
+		require.Equal(t, "mark_price", request.Get("trigger"))
+		require.Equal(t, "true", request.Get("reduce_only"))
+
+		takeProfit, err := deribit.TakeProfit(model.SideTypeBuy, "ETH-PERPETUAL", 10, 1800)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+		require.Equal(t, "1800.00", server.request(5).Get("price"))
+
+		require.NoError(t, deribit.Cancel(limit))
+		request = server.request(6)
+		require.Equal(t, "private/cancel_by_label", request.Get("method"))
+		require.Equal(t, strconv.FormatInt(limit.ExchangeID, 10), request.Get("label"))
+
+		orders, err := deribit.OpenOrders("ETH-PERPETUAL")
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Equal(t, int64(7), orders[0].ExchangeID)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, orders[0].Status)
+		require.Equal(t, model.OrderTypeStopLoss, orders[1].Type)
+		require.Equal(t, 1800.0, *orders[1].Stop)
+
+		// orders without labels are requested by their order id
+		order, err := deribit.Order("ETH-PERPETUAL", orders[1].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.NoError(t, deribit.Cancel(orders[1]))
+		require.Equal(t, "ETH-1", server.request(9).Get("order_id"))
+
+		order, err = deribit.Order("ETH-PERPETUAL", 9)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		_, err = deribit.Order("ETH-PERPETUAL", 1)
+		require.Error(t, err)
+
+		require.NoError(t, deribit.CancelOpenOrders("ETH-PERPETUAL"))
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		deribit, server := newTestDeribit(t)
+
+		limit, err := deribit.CreateOrderRequest(model.OrderRequest{Pair: "ETH-PERPETUAL", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 10, Price: 2100, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Equal(t, clientOrderNumber("ninjabot-1"), limit.ExchangeID)
+		require.Equal(t, strconv.FormatInt(limit.ExchangeID, 10), server.request(0).Get("label"))
+
+		stop, err := deribit.CreateOrderRequest(model.OrderRequest{Pair: "ETH-PERPETUAL", Side: model.SideTypeBuy,
+			Type: model.OrderTypeStopLoss, Quantity: 10, Stop: 2200, ClientOrderID: "ninjabot-2"})
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, "private/buy", server.request(1).Get("method"))
+
+		found, err := deribit.OrderByClientID("ETH-PERPETUAL", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, limit.ExchangeID, found.ExchangeID)
+		require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+		_, err = deribit.OrderByClientID("ETH-PERPETUAL", "ninjabot-3")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		deribit, _ := newTestDeribit(t)
+		account, err := deribit.Account()
+		require.NoError(t, err)
+		require.Equal(t, []model.Balance{
+			{Asset: "ETH-PERPETUAL", Free: -20, Leverage: 25},
+			{Asset: "ETH", Free: 1, Lock: 0.5},
+		}, account.Balances)
+
+		asset, quote, err := deribit.Position("ETH-PERPETUAL")
+		require.NoError(t, err)
+		require.Equal(t, -20.0, asset)
+		require.Equal(t, 1.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		deribit, _ := newTestDeribit(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, _ := deribit.AccountSubscription(ctx)
+		order := <-updates
+		require.Equal(t, int64(7), order.ExchangeID)
+		require.Equal(t, "ETH-PERPETUAL", order.Pair)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.OrderTypeStopLossLimit, order.Type)
+		require.Equal(t, model.SideTypeBuy, order.Side)
+		require.Equal(t, 2000.5, order.Price)
+		require.Equal(t, 2050.0, *order.Stop)
+		require.Equal(t, 10.0, order.Quantity)
+	})
+}
@@ -0,0 +1,1359 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	dydxEndpoint       = "https://indexer.dydx.trade/v4"
+	dydxStreamEndpoint = "wss://indexer.dydx.trade/v4/ws"
+	dydxNodeEndpoint   = "https://dydx-ops-rest.kingnodes.com"
+	dydxChainID        = "dydx-mainnet-1"
+
+	dydxTestnetEndpoint       = "https://indexer.v4testnet.dydx.exchange/v4"
+	dydxTestnetStreamEndpoint = "wss://indexer.v4testnet.dydx.exchange/v4/ws"
+	dydxTestnetNodeEndpoint   = "https://test-dydx-rest.kingnodes.com"
+	dydxTestnetChainID        = "dydx-testnet-4"
+
+	// dydxCandleLimit and dydxOrderLimit are the maximum number of candles and orders returned by a request
+	dydxCandleLimit = 100
+	dydxOrderLimit  = 100
+
+	// dydxQuoteExponent converts quote quantums to USDC, which has 6 decimals
+	dydxQuoteExponent = 6
+
+	// dydxShortTermBlocks is the number of blocks a short-term order lives, the chain accepts up to 20
+	dydxShortTermBlocks = 10
+
+	// dydxStatefulOrderTTL is the expiration of long-term and conditional orders, the chain accepts up to 95 days
+	dydxStatefulOrderTTL = 30 * 24 * time.Hour
+
+	// dydxMarketSlippage is the worst price of market orders, which are immediate or cancel limit orders
+	dydxMarketSlippage = 0.05
+
+	// dydxErrWrongSequence is the Cosmos error of a transaction with an outdated account sequence
+	dydxErrWrongSequence = 32
+)
+
+// ErrDydxPrivateKey is returned when submitting transactions without a private key
+var ErrDydxPrivateKey = errors.New("dydx private key is required to submit orders")
+
+// DydxError is an error returned by the dYdX indexer, node or chain
+type DydxError struct {
+	Code    int
+	Message string
+}
+
+func (e *DydxError) Error() string {
+	return fmt.Sprintf("dydx error %d: %s", e.Code, e.Message)
+}
+
+// Dydx is the dYdX v4 decentralized perpetuals exchange. Market data, orders and positions are read
+// from the indexer, while orders are signed and broadcast to a node of the dYdX chain.
+//
+// Market orders are short-term immediate or cancel orders, limited by a slippage from the last price.
+// Limit orders are long-term orders and stops or take profits are conditional orders, both stored
+// on-chain until canceled or expired. Orders are identified by their client id.
+type Dydx struct {
+	ctx        context.Context
+	client     *http.Client
+	markets    map[string]dydxMarket
+	pairs      map[string]string
+	assetsInfo map[string]model.AssetInfo
+	lastID     uint32
+	HeikinAshi bool
+
+	// Address is the dydx address of the account and PrivateKey is its secp256k1 key, in hex
+	Address    string
+	PrivateKey string
+	Subaccount int
+
+	key           *secp256k1.PrivateKey
+	txMtx         sync.Mutex
+	accountNumber uint64
+	sequence      uint64
+	hasSequence   bool
+
+	// Endpoint and StreamEndpoint are the indexer REST and websocket URLs, NodeEndpoint is the REST
+	// URL of a full node of the chain
+	Endpoint       string
+	StreamEndpoint string
+	NodeEndpoint   string
+	ChainID        string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+}
+
+type DydxOption func(*Dydx)
+
+// WithDydxCredentials will set the address of the account and its private key, in hex
+func WithDydxCredentials(address, privateKey string) DydxOption {
+	return func(d *Dydx) {
+		d.Address = address
+		d.PrivateKey = privateKey
+	}
+}
+
+// WithDydxSubaccount will trade with a subaccount of the address, the subaccount 0 is used by default
+func WithDydxSubaccount(number int) DydxOption {
+	return func(d *Dydx) {
+		d.Subaccount = number
+	}
+}
+
+// WithDydxTestnet will use the dYdX testnet
+func WithDydxTestnet() DydxOption {
+	return func(d *Dydx) {
+		d.Endpoint = dydxTestnetEndpoint
+		d.StreamEndpoint = dydxTestnetStreamEndpoint
+		d.NodeEndpoint = dydxTestnetNodeEndpoint
+		d.ChainID = dydxTestnetChainID
+	}
+}
+
+// WithDydxHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithDydxHeikinAshiCandle() DydxOption {
+	return func(d *Dydx) {
+		d.HeikinAshi = true
+	}
+}
+
+// WithDydxMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithDydxMetadataFetcher(fetcher MetadataFetchers) DydxOption {
+	return func(d *Dydx) {
+		d.MetadataFetchers = append(d.MetadataFetchers, fetcher)
+	}
+}
+
+// WithDydxEndpoint overrides the indexer REST and websocket endpoints and the node endpoint
+func WithDydxEndpoint(endpoint, streamEndpoint, nodeEndpoint string) DydxOption {
+	return func(d *Dydx) {
+		d.Endpoint = endpoint
+		d.StreamEndpoint = streamEndpoint
+		d.NodeEndpoint = nodeEndpoint
+	}
+}
+
+// NewDydx will create a new Dydx instance
+func NewDydx(ctx context.Context, options ...DydxOption) (*Dydx, error) {
+	exchange := &Dydx{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		lastID:          uint32(time.Now().Unix()),
+		Endpoint:        dydxEndpoint,
+		StreamEndpoint:  dydxStreamEndpoint,
+		NodeEndpoint:    dydxNodeEndpoint,
+		ChainID:         dydxChainID,
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.PrivateKey != "" {
+		key, err := hex.DecodeString(strings.TrimPrefix(exchange.PrivateKey, "0x"))
+		if err != nil || len(key) != secp256k1.PrivKeyBytesLen {
+			return nil, fmt.Errorf("dydx: invalid private key")
+		}
+		exchange.key = secp256k1.PrivKeyFromBytes(key)
+	}
+
+	// Initialize with orders precision and assets limits
+	err := exchange.loadMarkets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dydx ping fail: %w", err)
+	}
+
+	log.Info("[SETUP] Using dYdX exchange")
+
+	return exchange, nil
+}
+
+// request sends a JSON request and decodes the response, errors of the indexer and node are returned
+// as DydxError
+func (d *Dydx) request(ctx context.Context, method, endpoint string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var response struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Errors  []struct {
+				Msg string `json:"msg"`
+			} `json:"errors"`
+		}
+		_ = json.Unmarshal(data, &response)
+		apiError := &DydxError{Code: response.Code, Message: response.Message}
+		if len(response.Errors) > 0 {
+			apiError.Message = response.Errors[0].Msg
+		}
+		if apiError.Code == 0 {
+			apiError.Code = resp.StatusCode
+		}
+		return apiError
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+// indexer sends a GET request to the indexer
+func (d *Dydx) indexer(ctx context.Context, path string, params url.Values, result interface{}) error {
+	endpoint := d.Endpoint + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	return d.request(ctx, http.MethodGet, endpoint, nil, result)
+}
+
+// dydxMarket is a perpetual market of the indexer, with the parameters to convert quantities and
+// prices to the integer quantums and subticks of the chain
+type dydxMarket struct {
+	Ticker                    string `json:"ticker"`
+	ClobPairID                string `json:"clobPairId"`
+	Status                    string `json:"status"`
+	TickSize                  string `json:"tickSize"`
+	StepSize                  string `json:"stepSize"`
+	AtomicResolution          int    `json:"atomicResolution"`
+	QuantumConversionExponent int    `json:"quantumConversionExponent"`
+	StepBaseQuantums          int64  `json:"stepBaseQuantums"`
+	SubticksPerTick           int64  `json:"subticksPerTick"`
+}
+
+// quantums converts a quantity to quantums, rounded down to the step of the market
+func (m dydxMarket) quantums(quantity float64) uint64 {
+	step := float64(m.StepBaseQuantums)
+	if step <= 0 {
+		step = 1
+	}
+	quantums := math.Round(quantity * math.Pow10(-m.AtomicResolution))
+	quantums = math.Max(math.Floor(quantums/step)*step, step)
+	return uint64(quantums)
+}
+
+// subticks converts a price to subticks, rounded to the tick of the market
+func (m dydxMarket) subticks(price float64) uint64 {
+	step := float64(m.SubticksPerTick)
+	if step <= 0 {
+		step = 1
+	}
+	subticks := price * math.Pow10(m.AtomicResolution-m.QuantumConversionExponent+dydxQuoteExponent)
+	subticks = math.Max(math.Round(subticks/step)*step, step)
+	return uint64(subticks)
+}
+
+func (m dydxMarket) clobPairID() uint32 {
+	id, _ := strconv.ParseUint(m.ClobPairID, 10, 32)
+	return uint32(id)
+}
+
+func (d *Dydx) loadMarkets(ctx context.Context) error {
+	var response struct {
+		Markets map[string]dydxMarket `json:"markets"`
+	}
+	if err := d.indexer(ctx, "/perpetualMarkets", nil, &response); err != nil {
+		return err
+	}
+
+	d.markets = make(map[string]dydxMarket)
+	d.pairs = make(map[string]string)
+	d.assetsInfo = make(map[string]model.AssetInfo)
+	for ticker, market := range response.Markets {
+		if market.Status != "" && market.Status != "ACTIVE" {
+			continue
+		}
+
+		parts := strings.Split(ticker, "-")
+		if len(parts) != 2 {
+			continue
+		}
+		pair := parts[0] + parts[1]
+		RegisterPair(pair, parts[0], parts[1])
+
+		info := model.AssetInfo{
+			BaseAsset:   parts[0],
+			QuoteAsset:  parts[1],
+			MaxQuantity: math.MaxFloat64,
+			MaxPrice:    math.MaxFloat64,
+		}
+		info.StepSize, _ = strconv.ParseFloat(market.StepSize, 64)
+		info.TickSize, _ = strconv.ParseFloat(market.TickSize, 64)
+		info.MinQuantity = info.StepSize
+		info.MinPrice = info.TickSize
+		info.BaseAssetPrecision = getDecimalPrecision(info.StepSize)
+		info.QuotePrecision = getDecimalPrecision(info.TickSize)
+
+		d.markets[pair] = market
+		d.pairs[ticker] = pair
+		d.assetsInfo[pair] = info
+	}
+	return nil
+}
+
+// ticker returns the market of a pair, eg: BTCUSD => BTC-USD
+func (d *Dydx) ticker(pair string) string {
+	if market, ok := d.markets[pair]; ok {
+		return market.Ticker
+	}
+
+	asset, quote := SplitAssetQuote(pair)
+	return asset + "-" + quote
+}
+
+// pair returns the pair of a market, eg: BTC-USD => BTCUSD
+func (d *Dydx) pair(ticker string) string {
+	if pair, ok := d.pairs[ticker]; ok {
+		return pair
+	}
+	return strings.ReplaceAll(ticker, "-", "")
+}
+
+func (d *Dydx) AssetsInfo(pair string) model.AssetInfo {
+	return d.assetsInfo[pair]
+}
+
+func (d *Dydx) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var response struct {
+		Trades []struct {
+			Price string `json:"price"`
+		} `json:"trades"`
+	}
+	err := d.indexer(ctx, "/trades/perpetualMarket/"+d.ticker(pair), url.Values{"limit": {"1"}}, &response)
+	if err != nil {
+		return 0, err
+	}
+	if len(response.Trades) == 0 {
+		return 0, ErrInvalidAsset
+	}
+	return strconv.ParseFloat(response.Trades[0].Price, 64)
+}
+
+func (d *Dydx) validate(pair string, quantity float64) error {
+	info, ok := d.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+// height returns the current block height of the chain
+func (d *Dydx) height(ctx context.Context) (uint32, error) {
+	var response struct {
+		Height string `json:"height"`
+	}
+	if err := d.indexer(ctx, "/height", nil, &response); err != nil {
+		return 0, err
+	}
+	height, err := strconv.ParseUint(response.Height, 10, 32)
+	return uint32(height), err
+}
+
+// loadSequence fetches the account number and sequence of the address from the node
+func (d *Dydx) loadSequence(ctx context.Context) error {
+	var response struct {
+		Account struct {
+			AccountNumber string `json:"account_number"`
+			Sequence      string `json:"sequence"`
+		} `json:"account"`
+	}
+	err := d.request(ctx, http.MethodGet, d.NodeEndpoint+"/cosmos/auth/v1beta1/accounts/"+d.Address, nil, &response)
+	if err != nil {
+		return err
+	}
+
+	if d.accountNumber, err = strconv.ParseUint(response.Account.AccountNumber, 10, 64); err != nil {
+		return err
+	}
+	if d.sequence, err = strconv.ParseUint(response.Account.Sequence, 10, 64); err != nil {
+		return err
+	}
+	d.hasSequence = true
+	return nil
+}
+
+// broadcast signs and broadcasts a transaction with a message. Stateful messages increase the account
+// sequence, which is kept locally and fetched again when the chain rejects it.
+func (d *Dydx) broadcast(msg protoMessage, stateful bool) error {
+	if d.key == nil {
+		return ErrDydxPrivateKey
+	}
+
+	d.txMtx.Lock()
+	defer d.txMtx.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if !d.hasSequence {
+			if err = d.loadSequence(d.ctx); err != nil {
+				return err
+			}
+		}
+
+		tx := dydxSignTx(d.key, d.ChainID, d.accountNumber, d.sequence, msg)
+		var response struct {
+			TxResponse struct {
+				Code   int    `json:"code"`
+				RawLog string `json:"raw_log"`
+			} `json:"tx_response"`
+		}
+		err = d.request(d.ctx, http.MethodPost, d.NodeEndpoint+"/cosmos/tx/v1beta1/txs", map[string]string{
+			"tx_bytes": base64.StdEncoding.EncodeToString(tx),
+			"mode":     "BROADCAST_MODE_SYNC",
+		}, &response)
+		if err != nil {
+			return err
+		}
+
+		switch response.TxResponse.Code {
+		case 0:
+			if stateful {
+				d.sequence++
+			}
+			return nil
+		case dydxErrWrongSequence:
+			d.hasSequence = false
+		}
+		err = &DydxError{Code: response.TxResponse.Code, Message: response.TxResponse.RawLog}
+	}
+	return err
+}
+
+func dydxSide(side model.SideType) int {
+	if side == model.SideTypeBuy {
+		return dydxSideBuy
+	}
+	return dydxSideSell
+}
+
+// dydxSlippagePrice returns the worst price accepted by an immediate or cancel order
+func dydxSlippagePrice(side model.SideType, price float64) float64 {
+	if side == model.SideTypeBuy {
+		return price * (1 + dydxMarketSlippage)
+	}
+	return price * (1 - dydxMarketSlippage)
+}
+
+// dydxClientID returns the dYdX client id of a client order ID, a number of 32 bits derived from it
+func dydxClientID(clientOrderID string) uint32 {
+	return uint32(clientOrderNumber(clientOrderID))
+}
+
+// createOrder submits an order to the chain with a client id, a new one when the id is zero. The order is
+// not indexed until included in a block, so it is returned with the submitted values and updated by the
+// account subscription.
+func (d *Dydx) createOrder(side model.SideType, pair string, orderType model.OrderType, quantity,
+	price float64, stop *float64, reduceOnly bool, id uint32) (model.Order, error) {
+
+	market, ok := d.markets[pair]
+	if !ok {
+		return model.Order{}, ErrInvalidAsset
+	}
+
+	if err := d.validate(pair, quantity); err != nil {
+		return model.Order{}, err
+	}
+
+	if id == 0 {
+		id = atomic.AddUint32(&d.lastID, 1)
+	}
+	msg := dydxOrderMsg{
+		ID: dydxOrderID{
+			Owner:      d.Address,
+			Subaccount: uint32(d.Subaccount),
+			ClientID:   id,
+			ClobPairID: market.clobPairID(),
+		},
+		Side:       dydxSide(side),
+		Quantums:   market.quantums(quantity),
+		Subticks:   market.subticks(price),
+		ReduceOnly: reduceOnly,
+	}
+
+	switch orderType {
+	case model.OrderTypeMarket:
+		height, err := d.height(d.ctx)
+		if err != nil {
+			return model.Order{}, err
+		}
+		msg.ID.OrderFlags = dydxOrderFlagShortTerm
+		msg.GoodTilBlock = height + dydxShortTermBlocks
+		msg.TimeInForce = dydxTimeInForceIOC
+	case model.OrderTypeLimit:
+		msg.ID.OrderFlags = dydxOrderFlagLongTerm
+		msg.GoodTilBlockTime = uint32(time.Now().Add(dydxStatefulOrderTTL).Unix())
+	default:
+		msg.ID.OrderFlags = dydxOrderFlagConditional
+		msg.GoodTilBlockTime = uint32(time.Now().Add(dydxStatefulOrderTTL).Unix())
+		msg.ConditionalTrigger = market.subticks(*stop)
+		msg.ConditionType = dydxConditionStopLoss
+		if orderType == model.OrderTypeTakeProfit || orderType == model.OrderTypeTakeProfitLimit {
+			msg.ConditionType = dydxConditionTakeProfit
+		}
+		if orderType == model.OrderTypeStopLoss || orderType == model.OrderTypeTakeProfit {
+			msg.TimeInForce = dydxTimeInForceIOC
+		}
+	}
+
+	if err := d.broadcast(msg.encode(), msg.ID.OrderFlags != dydxOrderFlagShortTerm); err != nil {
+		return model.Order{}, err
+	}
+
+	now := time.Now()
+	return model.Order{
+		ExchangeID: int64(msg.ID.ClientID),
+		Pair:       pair,
+		Side:       side,
+		Type:       orderType,
+		Status:     model.OrderStatusTypeNew,
+		Price:      price,
+		Quantity:   quantity,
+		Stop:       stop,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// closingQuantity returns the quantity of the open position of a pair
+func (d *Dydx) closingQuantity(pair string) (float64, error) {
+	position, _, err := d.Position(pair)
+	if err != nil {
+		return 0, err
+	}
+	if position == 0 {
+		return 0, fmt.Errorf("%w: no open position of %s", ErrInvalidQuantity, pair)
+	}
+	return math.Abs(position), nil
+}
+
+func (d *Dydx) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: dydx oco", ErrUnsupportedOrder)
+}
+
+func (d *Dydx) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return d.createOrder(side, pair, model.OrderTypeLimit, quantity, limit, nil, false, 0)
+}
+
+func (d *Dydx) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+	return d.createOrderMarket(side, pair, quantity, reduceOnly, 0)
+}
+
+func (d *Dydx) createOrderMarket(side model.SideType, pair string, quantity float64, reduceOnly bool,
+	id uint32) (model.Order, error) {
+
+	price, err := d.LastQuote(d.ctx, pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return d.createOrder(side, pair, model.OrderTypeMarket, quantity, dydxSlippagePrice(side, price), nil,
+		reduceOnly, id)
+}
+
+func (d *Dydx) CreateOrderMarketQuote(_ model.SideType, _ string, _ float64) (model.Order, error) {
+	return model.Order{}, fmt.Errorf("%w: dydx market order by quote", ErrUnsupportedOrder)
+}
+
+// CreateOrderStop places a conditional stop market order, following the same semantics of BinanceFuture:
+// a negative limit creates a buy stop, and a zero quantity closes the position. dYdX has no orders
+// closing a position, so the quantity is the position open when the stop is placed.
+func (d *Dydx) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	side := model.SideTypeSell
+	if limit < 0 {
+		side = model.SideTypeBuy
+		limit = -limit
+	}
+	return d.createOrderStop(side, pair, quantity, limit, 0)
+}
+
+func (d *Dydx) createOrderStop(side model.SideType, pair string, quantity float64, limit float64,
+	id uint32) (model.Order, error) {
+
+	reduceOnly := quantity == 0
+	if reduceOnly {
+		var err error
+		if quantity, err = d.closingQuantity(pair); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	return d.createOrder(side, pair, model.OrderTypeStopLoss, quantity, dydxSlippagePrice(side, limit),
+		&limit, reduceOnly, id)
+}
+
+// TakeProfit places a conditional order triggered at the limit price, a limit order for a given quantity
+// or an immediate or cancel order closing the position when the quantity is zero
+func (d *Dydx) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (model.Order, error) {
+	return d.takeProfit(side, pair, quantity, limit, 0)
+}
+
+func (d *Dydx) takeProfit(side model.SideType, pair string, quantity float64, limit float64,
+	id uint32) (model.Order, error) {
+
+	orderType := model.OrderTypeTakeProfitLimit
+	if quantity == 0 {
+		var err error
+		if quantity, err = d.closingQuantity(pair); err != nil {
+			return model.Order{}, err
+		}
+		orderType = model.OrderTypeTakeProfit
+	}
+
+	return d.createOrder(side, pair, orderType, quantity, limit, &limit, orderType == model.OrderTypeTakeProfit, id)
+}
+
+// CreateOrderRequest places an order with the client order ID of the request. dYdX client ids are numbers
+// of 32 bits, so the client id of the order, its ExchangeID, is derived from the client order ID.
+func (d *Dydx) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	id := dydxClientID(request.ClientOrderID)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: dydx time in force %s", ErrUnsupportedOrder, request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: dydx iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = d.createOrder(request.Side, request.Pair, model.OrderTypeLimit, request.Quantity,
+			request.Price, nil, false, id)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			return d.CreateOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity)
+		}
+		order, err = d.createOrderMarket(request.Side, request.Pair, request.Quantity, request.ReduceOnly, id)
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		order, err = d.createOrderStop(request.Side, request.Pair, request.Quantity, request.Stop, id)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = d.takeProfit(request.Side, request.Pair, request.Quantity, request.Stop, id)
+	default:
+		return model.Order{}, fmt.Errorf("%w: dydx %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns the order of a client order ID from the latest orders of the indexer, or
+// ErrOrderNotFound
+func (d *Dydx) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	order, err := d.Order(pair, int64(dydxClientID(clientOrderID)))
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = clientOrderID
+	return order, nil
+}
+
+func (d *Dydx) Cancel(order model.Order) error {
+	market, ok := d.markets[order.Pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	msg := dydxCancelMsg{
+		ID: dydxOrderID{
+			Owner:      d.Address,
+			Subaccount: uint32(d.Subaccount),
+			ClientID:   uint32(order.ExchangeID),
+			ClobPairID: market.clobPairID(),
+		},
+	}
+
+	switch order.Type {
+	case model.OrderTypeMarket:
+		height, err := d.height(d.ctx)
+		if err != nil {
+			return err
+		}
+		msg.ID.OrderFlags = dydxOrderFlagShortTerm
+		msg.GoodTilBlock = height + dydxShortTermBlocks
+	case model.OrderTypeLimit:
+		msg.ID.OrderFlags = dydxOrderFlagLongTerm
+		msg.GoodTilBlockTime = uint32(time.Now().Add(dydxStatefulOrderTTL).Unix())
+	default:
+		msg.ID.OrderFlags = dydxOrderFlagConditional
+		msg.GoodTilBlockTime = uint32(time.Now().Add(dydxStatefulOrderTTL).Unix())
+	}
+
+	return d.broadcast(msg.encode(), msg.ID.OrderFlags != dydxOrderFlagShortTerm)
+}
+
+func (d *Dydx) CancelOpenOrders(pair string) error {
+	orders, err := d.OpenOrders(pair)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if err := d.Cancel(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orders returns the indexed orders of the subaccount in a market
+func (d *Dydx) orders(pair string, params url.Values) ([]model.Order, error) {
+	params.Set("address", d.Address)
+	params.Set("subaccountNumber", strconv.Itoa(d.Subaccount))
+	params.Set("ticker", d.ticker(pair))
+
+	var result []dydxOrder
+	if err := d.indexer(d.ctx, "/orders", params, &result); err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(result))
+	for _, order := range result {
+		orders = append(orders, order.toModel(d.pair(order.Ticker)))
+	}
+	return orders, nil
+}
+
+func (d *Dydx) OpenOrders(pair string) ([]model.Order, error) {
+	orders := make([]model.Order, 0)
+	for _, status := range []string{"OPEN", "UNTRIGGERED", "BEST_EFFORT_OPENED"} {
+		result, err := d.orders(pair, url.Values{"status": {status}})
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, result...)
+	}
+	return orders, nil
+}
+
+// Order returns an order by its client id, from the latest orders of the indexer
+func (d *Dydx) Order(pair string, id int64) (model.Order, error) {
+	orders, err := d.orders(pair, url.Values{"limit": {strconv.Itoa(dydxOrderLimit)}})
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	for _, order := range orders {
+		if order.ExchangeID == id {
+			return order, nil
+		}
+	}
+	return model.Order{}, fmt.Errorf("%w: dydx order %d", ErrOrderNotFound, id)
+}
+
+// dydxOrder is an order of the indexer
+type dydxOrder struct {
+	ID           string `json:"id"`
+	ClientID     string `json:"clientId"`
+	Ticker       string `json:"ticker"`
+	Side         string `json:"side"`
+	Size         string `json:"size"`
+	TotalFilled  string `json:"totalFilled"`
+	Price        string `json:"price"`
+	Type         string `json:"type"`
+	Status       string `json:"status"`
+	TriggerPrice string `json:"triggerPrice"`
+	UpdatedAt    string `json:"updatedAt"`
+}
+
+func (o dydxOrder) toModel(pair string) model.Order {
+	id, _ := strconv.ParseInt(o.ClientID, 10, 64)
+	order := model.Order{
+		ExchangeID: id,
+		Pair:       pair,
+		Side:       model.SideType(o.Side),
+	}
+
+	order.UpdatedAt, _ = time.Parse(time.RFC3339, o.UpdatedAt)
+	if order.UpdatedAt.IsZero() {
+		order.UpdatedAt = time.Now()
+	}
+	order.CreatedAt = order.UpdatedAt
+
+	switch o.Type {
+	case "MARKET":
+		order.Type = model.OrderTypeMarket
+	case "STOP_LIMIT":
+		order.Type = model.OrderTypeStopLossLimit
+	case "STOP_MARKET":
+		order.Type = model.OrderTypeStopLoss
+	case "TAKE_PROFIT":
+		order.Type = model.OrderTypeTakeProfitLimit
+	case "TAKE_PROFIT_MARKET":
+		order.Type = model.OrderTypeTakeProfit
+	default:
+		order.Type = model.OrderTypeLimit
+	}
+
+	if trigger, err := strconv.ParseFloat(o.TriggerPrice, 64); err == nil && trigger > 0 {
+		order.Stop = &trigger
+	}
+
+	var err error
+	order.Price, err = strconv.ParseFloat(o.Price, 64)
+	log.CheckErr(log.WarnLevel, err)
+	order.Quantity, err = strconv.ParseFloat(o.Size, 64)
+	log.CheckErr(log.WarnLevel, err)
+	filled, _ := strconv.ParseFloat(o.TotalFilled, 64)
+
+	switch o.Status {
+	case "FILLED":
+		order.Status = model.OrderStatusTypeFilled
+	case "CANCELED", "BEST_EFFORT_CANCELED":
+		order.Status = model.OrderStatusTypeCanceled
+	default:
+		order.Status = model.OrderStatusTypeNew
+		if filled > 0 {
+			order.Status = model.OrderStatusTypePartiallyFilled
+		}
+	}
+
+	return order
+}
+
+type dydxSubaccount struct {
+	Equity                 string `json:"equity"`
+	FreeCollateral         string `json:"freeCollateral"`
+	OpenPerpetualPositions map[string]struct {
+		Side string `json:"side"`
+		Size string `json:"size"`
+	} `json:"openPerpetualPositions"`
+}
+
+func (d *Dydx) subaccount() (dydxSubaccount, error) {
+	var response struct {
+		Subaccount dydxSubaccount `json:"subaccount"`
+	}
+	path := fmt.Sprintf("/addresses/%s/subaccountNumber/%d", d.Address, d.Subaccount)
+	if err := d.indexer(d.ctx, path, nil, &response); err != nil {
+		return dydxSubaccount{}, err
+	}
+	return response.Subaccount, nil
+}
+
+// Account returns the open positions, negative for short positions, and the USDC collateral.
+// The free collateral is available to open positions and the remaining equity is locked by them.
+func (d *Dydx) Account() (model.Account, error) {
+	subaccount, err := d.subaccount()
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	tickers := make([]string, 0, len(subaccount.OpenPerpetualPositions))
+	for ticker := range subaccount.OpenPerpetualPositions {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	balances := make([]model.Balance, 0)
+	for _, ticker := range tickers {
+		position := subaccount.OpenPerpetualPositions[ticker]
+		size, err := strconv.ParseFloat(position.Size, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		if size == 0 {
+			continue
+		}
+
+		if position.Side == "SHORT" && size > 0 {
+			size = -size
+		}
+
+		balances = append(balances, model.Balance{
+			Asset: strings.Split(ticker, "-")[0],
+			Free:  size,
+		})
+	}
+
+	free, err := strconv.ParseFloat(subaccount.FreeCollateral, 64)
+	if err != nil {
+		return model.Account{}, err
+	}
+	equity, _ := strconv.ParseFloat(subaccount.Equity, 64)
+	balances = append(balances, model.Balance{
+		Asset: "USDC",
+		Free:  free,
+		Lock:  math.Max(equity-free, 0),
+	})
+
+	return model.Account{
+		Balances:  balances,
+		Available: free,
+	}, nil
+}
+
+// Position returns the position of a pair and the free USDC collateral
+func (d *Dydx) Position(pair string) (asset, quote float64, err error) {
+	acc, err := d.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info := d.assetsInfo[pair]
+	assetBalance, quoteBalance := acc.Balance(info.BaseAsset, "USDC")
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free, nil
+}
+
+// PositionRisk returns the size of the position, Dydx does not provide position details
+func (d *Dydx) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(d, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, Dydx does not support amending orders
+func (d *Dydx) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(d, order, price, quantity)
+}
+
+// dydxResolution converts a ninjabot timeframe into a dYdX candle resolution, eg: 1h => 1HOUR
+func dydxResolution(period string) (string, error) {
+	resolutions := map[string]string{
+		"1m":  "1MIN",
+		"5m":  "5MINS",
+		"15m": "15MINS",
+		"30m": "30MINS",
+		"1h":  "1HOUR",
+		"4h":  "4HOURS",
+		"1d":  "1DAY",
+	}
+	if resolution, ok := resolutions[period]; ok {
+		return resolution, nil
+	}
+	return "", fmt.Errorf("invalid dydx resolution %s", period)
+}
+
+type dydxCandle struct {
+	StartedAt       string `json:"startedAt"`
+	Open            string `json:"open"`
+	High            string `json:"high"`
+	Low             string `json:"low"`
+	Close           string `json:"close"`
+	BaseTokenVolume string `json:"baseTokenVolume"`
+}
+
+func (c dydxCandle) toModel(pair string) (model.Candle, error) {
+	t, err := time.Parse(time.RFC3339, c.StartedAt)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Metadata: make(map[string]float64)}
+	for _, value := range []struct {
+		target *float64
+		value  string
+	}{
+		{&candle.Open, c.Open},
+		{&candle.High, c.High},
+		{&candle.Low, c.Low},
+		{&candle.Close, c.Close},
+		{&candle.Volume, c.BaseTokenVolume},
+	} {
+		if *value.target, err = strconv.ParseFloat(value.value, 64); err != nil {
+			return model.Candle{}, err
+		}
+	}
+	return candle, nil
+}
+
+// candles returns the complete candles of a period in chronological order, fetching pages backwards from
+// the end until the start or the limit of candles, when not zero
+func (d *Dydx) candles(ctx context.Context, pair, period string, start, end time.Time,
+	limit int) ([]model.Candle, error) {
+
+	resolution, err := dydxResolution(period)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	candles := make([]model.Candle, 0)
+	for limit == 0 || len(candles) < limit {
+		params := url.Values{
+			"resolution": {resolution},
+			"limit":      {strconv.Itoa(dydxCandleLimit)},
+			"toISO":      {end.UTC().Format(time.RFC3339)},
+		}
+		if !start.IsZero() {
+			params.Set("fromISO", start.UTC().Format(time.RFC3339))
+		}
+
+		var response struct {
+			Candles []dydxCandle `json:"candles"`
+		}
+		if err := d.indexer(ctx, "/candles/perpetualMarkets/"+d.ticker(pair), params, &response); err != nil {
+			return nil, err
+		}
+
+		oldest := end
+		for _, data := range response.Candles {
+			candle, err := data.toModel(pair)
+			if err != nil {
+				return nil, err
+			}
+			if candle.Time.Before(oldest) {
+				oldest = candle.Time
+			}
+
+			// the last candle is in progress until the end of its period
+			if candle.Time.Add(duration).After(now) {
+				continue
+			}
+			candle.Complete = true
+			candles = append(candles, candle)
+		}
+
+		if len(response.Candles) < dydxCandleLimit {
+			break
+		}
+		end = oldest.Add(-time.Second)
+	}
+
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	if limit > 0 && len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	if d.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+func (d *Dydx) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	return d.candles(ctx, pair, period, time.Time{}, time.Now(), limit)
+}
+
+func (d *Dydx) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+	return d.candles(ctx, pair, period, start, end, 0)
+}
+
+// dydxMessage is a message of the indexer websocket
+type dydxMessage struct {
+	Type     string          `json:"type"`
+	Channel  string          `json:"channel"`
+	ID       string          `json:"id"`
+	Message  string          `json:"message"`
+	Contents json.RawMessage `json:"contents"`
+}
+
+// CandlesSubscription streams the candles of a pair. The indexer sends the current candle on each trade,
+// so the previous candle is complete when a trade of the next period happens.
+func (d *Dydx) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		resolution, err := dydxResolution(period)
+		if err != nil {
+			cerr <- err
+			close(cerr)
+			close(ccandle)
+			return
+		}
+
+		subscribe := map[string]string{
+			"type":    "subscribe",
+			"channel": "v4_candles",
+			"id":      d.ticker(pair) + "/" + resolution,
+		}
+
+		var last *model.Candle
+		for {
+			done, stop, err := wsServeJSON(d.StreamEndpoint, []interface{}{subscribe}, nil, func(message []byte) {
+				var event dydxMessage
+				if err := json.Unmarshal(message, &event); err != nil || event.Channel != "v4_candles" {
+					return
+				}
+
+				var data dydxCandle
+				switch event.Type {
+				case "subscribed":
+					// the subscription starts with past candles, from the newest
+					var snapshot struct {
+						Candles []dydxCandle `json:"candles"`
+					}
+					if err := json.Unmarshal(event.Contents, &snapshot); err != nil || len(snapshot.Candles) == 0 {
+						return
+					}
+					data = snapshot.Candles[0]
+				case "channel_data":
+					if err := json.Unmarshal(event.Contents, &data); err != nil {
+						log.Warn(err)
+						return
+					}
+				default:
+					return
+				}
+
+				candle, err := data.toModel(pair)
+				if err != nil {
+					log.Warn(err)
+					return
+				}
+				candle.UpdatedAt = time.Now()
+
+				ba.Reset()
+				candles := []model.Candle{candle}
+				if last != nil && candle.Time.After(last.Time) {
+					complete := *last
+					complete.Complete = true
+					if d.HeikinAshi {
+						complete = complete.ToHeikinAshi(ha)
+					}
+					// fetch aditional data if needed
+					fetchMetadata(ctx, d.MetadataFetchers, d.MetadataTimeout, &d.metadataKeys, &complete)
+					candles = []model.Candle{complete, candle}
+				}
+				if last == nil || !candle.Time.Before(last.Time) {
+					last = &candle
+				}
+
+				for _, candle := range candles {
+					select {
+					case ccandle <- candle:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}, func(err error) {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+				}
+			})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				// wait for the stream handlers before closing the channels
+				close(stop)
+				<-done
+				close(cerr)
+				close(ccandle)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (d *Dydx) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("dydx")
+}
+
+// AccountSubscription streams the order updates of the subaccount, it reconnects until the context is done.
+// Updates may include only the changed fields of an order, so they are merged into the last known state.
+func (d *Dydx) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+
+		subscribe := map[string]string{
+			"type":    "subscribe",
+			"channel": "v4_subaccounts",
+			"id":      fmt.Sprintf("%s/%d", d.Address, d.Subaccount),
+		}
+
+		orders := make(map[string]*dydxOrder)
+		for {
+			done, stop, err := wsServeJSON(d.StreamEndpoint, []interface{}{subscribe}, nil, func(message []byte) {
+				var event dydxMessage
+				if err := json.Unmarshal(message, &event); err != nil {
+					return
+				}
+
+				switch {
+				case event.Type == "error":
+					sendErr(&DydxError{Message: event.Message})
+					return
+				case event.Channel != "v4_subaccounts":
+					return
+				}
+
+				var contents struct {
+					Orders []json.RawMessage `json:"orders"`
+				}
+				if err := json.Unmarshal(event.Contents, &contents); err != nil {
+					sendErr(err)
+					return
+				}
+
+				// the subscription starts with the open orders, which are kept to merge their updates
+				if event.Type == "subscribed" {
+					for _, data := range contents.Orders {
+						var order dydxOrder
+						if err := json.Unmarshal(data, &order); err == nil {
+							orders[order.ID] = &order
+						}
+					}
+					return
+				}
+				if event.Type != "channel_data" {
+					return
+				}
+
+				ba.Reset()
+				for _, data := range contents.Orders {
+					var update dydxOrder
+					if err := json.Unmarshal(data, &update); err != nil {
+						sendErr(err)
+						continue
+					}
+
+					order, ok := orders[update.ID]
+					if !ok {
+						order = &dydxOrder{}
+						orders[update.ID] = order
+					}
+					if err := json.Unmarshal(data, order); err != nil {
+						sendErr(err)
+						continue
+					}
+
+					if order.ClientID == "" || order.Ticker == "" {
+						continue
+					}
+
+					select {
+					case corder <- order.toModel(d.pair(order.Ticker)):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}, sendErr)
+			if err != nil {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					close(cerr)
+					close(corder)
+					return
+				}
+				time.Sleep(ba.Duration())
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				close(stop)
+				<-done
+				close(cerr)
+				close(corder)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return corder, cerr
+}
@@ -0,0 +1,484 @@
+package exchange
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// protoField is a decoded protobuf field, with the value of varint and fixed fields or the data of
+// length delimited fields
+type protoField struct {
+	value uint64
+	data  []byte
+}
+
+// decodeProto decodes the fields of a protobuf message, keeping the last value of repeated fields
+func decodeProto(t *testing.T, data []byte) map[int]protoField {
+	fields := make(map[int]protoField)
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		require.Positive(t, n)
+		data = data[n:]
+
+		var field protoField
+		switch key & 7 {
+		case 0:
+			field.value, n = binary.Uvarint(data)
+			require.Positive(t, n)
+			data = data[n:]
+		case 2:
+			size, n := binary.Uvarint(data)
+			require.Positive(t, n)
+			field.data = data[n : n+int(size)]
+			data = data[n+int(size):]
+		case 5:
+			field.value = uint64(binary.LittleEndian.Uint32(data))
+			data = data[4:]
+		default:
+			require.Fail(t, "unexpected wire type")
+		}
+		fields[int(key>>3)] = field
+	}
+	return fields
+}
+
+// dydxTx is a message of a transaction received by the test node
+type dydxTx struct {
+	typeURL string
+	order   map[int]protoField
+	orderID map[int]protoField
+}
+
+// dydxServer emulates the dYdX indexer and the transactions endpoints of a node
+type dydxServer struct {
+	*httptest.Server
+	mtx      sync.Mutex
+	sequence uint64
+	txs      []dydxTx
+}
+
+func newDydxServer(t *testing.T) *dydxServer {
+	s := &dydxServer{sequence: 5}
+
+	reply := func(w http.ResponseWriter, result interface{}) {
+		_ = json.NewEncoder(w).Encode(result)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v4/perpetualMarkets", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"markets": map[string]interface{}{
+			"BTC-USD": map[string]interface{}{"ticker": "BTC-USD", "clobPairId": "0", "status": "ACTIVE",
+				"tickSize": "1", "stepSize": "0.0001", "atomicResolution": -10, "quantumConversionExponent": -9,
+				"stepBaseQuantums": 1000000, "subticksPerTick": 100000},
+			"OLD-USD": map[string]interface{}{"ticker": "OLD-USD", "clobPairId": "9", "status": "FINAL_SETTLEMENT"},
+		}})
+	})
+	mux.HandleFunc("/v4/trades/perpetualMarket/BTC-USD", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"trades": []map[string]string{{"price": "100", "size": "1"}}})
+	})
+	mux.HandleFunc("/v4/height", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]string{"height": "1000", "time": "2022-01-01T00:00:00.000Z"})
+	})
+	mux.HandleFunc("/v4/candles/perpetualMarkets/BTC-USD", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "1HOUR", r.URL.Query().Get("resolution"))
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		times := []time.Time{time.Now().Truncate(time.Hour), start.Add(time.Hour), start}
+		if value := r.URL.Query().Get("fromISO"); value != "" {
+			from, err := time.Parse(time.RFC3339, value)
+			require.NoError(t, err)
+			require.Equal(t, start, from)
+			times = times[1:]
+		}
+
+		candles := make([]map[string]string, 0)
+		for i, t := range times {
+			candles = append(candles, map[string]string{"startedAt": t.Format(time.RFC3339), "open": "100",
+				"high": "110", "low": "90", "close": strconv.Itoa(103 - i), "baseTokenVolume": "10",
+				"usdVolume": "1000"})
+		}
+		reply(w, map[string]interface{}{"candles": candles})
+	})
+	mux.HandleFunc("/v4/orders", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "dydx1address", r.URL.Query().Get("address"))
+		require.Equal(t, "2", r.URL.Query().Get("subaccountNumber"))
+		require.Equal(t, "BTC-USD", r.URL.Query().Get("ticker"))
+
+		orders := []map[string]interface{}{
+			{"id": "a", "clientId": "7", "ticker": "BTC-USD", "side": "BUY", "size": "0.5", "totalFilled": "0.1",
+				"price": "95", "type": "LIMIT", "status": "OPEN", "updatedAt": "2022-01-01T00:00:00.000Z"},
+			{"id": "b", "clientId": "8", "ticker": "BTC-USD", "side": "SELL", "size": "0.5", "totalFilled": "0",
+				"price": "85", "type": "STOP_MARKET", "status": "UNTRIGGERED", "triggerPrice": "90"},
+			{"id": "c", "clientId": "9", "ticker": "BTC-USD", "side": "SELL", "size": "0.5", "totalFilled": "0.5",
+				"price": "95", "type": "MARKET", "status": "FILLED"},
+		}
+		result := make([]map[string]interface{}, 0)
+		for _, order := range orders {
+			if status := r.URL.Query().Get("status"); status == "" || status == order["status"] {
+				result = append(result, order)
+			}
+		}
+		reply(w, result)
+	})
+	mux.HandleFunc("/v4/addresses/dydx1address/subaccountNumber/2", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{"subaccount": map[string]interface{}{
+			"address": "dydx1address", "subaccountNumber": 2, "equity": "1000", "freeCollateral": "900",
+			"openPerpetualPositions": map[string]interface{}{
+				"BTC-USD": map[string]string{"market": "BTC-USD", "side": "SHORT", "size": "-0.5"},
+			},
+		}})
+	})
+
+	mux.HandleFunc("/cosmos/auth/v1beta1/accounts/dydx1address", func(w http.ResponseWriter, r *http.Request) {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		reply(w, map[string]interface{}{"account": map[string]string{"account_number": "42",
+			"sequence": strconv.FormatUint(s.sequence, 10)}})
+	})
+	mux.HandleFunc("/cosmos/tx/v1beta1/txs", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			TxBytes string `json:"tx_bytes"`
+			Mode    string `json:"mode"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		require.Equal(t, "BROADCAST_MODE_SYNC", request.Mode)
+		raw, err := base64.StdEncoding.DecodeString(request.TxBytes)
+		require.NoError(t, err)
+
+		// verify the signature of the transaction
+		tx := decodeProto(t, raw)
+		body, authInfo, signature := tx[1].data, tx[2].data, tx[3].data
+		signerInfo := decodeProto(t, decodeProto(t, authInfo)[1].data)
+		pubKeyAny := decodeProto(t, signerInfo[1].data)
+		require.Equal(t, dydxPubKeyType, string(pubKeyAny[1].data))
+		pubKey, err := secp256k1.ParsePubKey(decodeProto(t, pubKeyAny[2].data)[1].data)
+		require.NoError(t, err)
+
+		signDoc := protoMessage{}.bytes(1, body).bytes(2, authInfo).string(3, "dydx-testnet-4").uint(4, 42)
+		hash := sha256.Sum256(signDoc)
+		require.Len(t, signature, 64)
+		var r1, s1 secp256k1.ModNScalar
+		r1.SetByteSlice(signature[:32])
+		s1.SetByteSlice(signature[32:])
+		require.True(t, ecdsa.NewSignature(&r1, &s1).Verify(hash[:], pubKey))
+
+		message := decodeProto(t, decodeProto(t, body)[1].data)
+		received := dydxTx{typeURL: string(message[1].data)}
+		if received.typeURL == dydxMsgPlaceOrder {
+			received.order = decodeProto(t, decodeProto(t, message[2].data)[1].data)
+			received.orderID = decodeProto(t, received.order[1].data)
+		} else {
+			received.orderID = decodeProto(t, decodeProto(t, message[2].data)[1].data)
+		}
+
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+
+		// stateful orders must follow the account sequence
+		stateful := received.orderID[3].value != uint64(dydxOrderFlagShortTerm)
+		if stateful && signerInfo[3].value != s.sequence {
+			reply(w, map[string]interface{}{"tx_response": map[string]interface{}{"code": dydxErrWrongSequence,
+				"raw_log": "account sequence mismatch"}})
+			return
+		}
+		if stateful {
+			s.sequence++
+		}
+		s.txs = append(s.txs, received)
+		reply(w, map[string]interface{}{"tx_response": map[string]interface{}{"code": 0, "txhash": "HASH"}})
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/v4/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_ = conn.WriteJSON(map[string]string{"type": "connected", "connection_id": "1"})
+		var subscribe map[string]string
+		require.NoError(t, conn.ReadJSON(&subscribe))
+		require.Equal(t, "subscribe", subscribe["type"])
+
+		send := func(messageType string, contents interface{}) {
+			_ = conn.WriteJSON(map[string]interface{}{"type": messageType, "channel": subscribe["channel"],
+				"id": subscribe["id"], "contents": contents})
+		}
+		candle := func(start, closing string) map[string]string {
+			return map[string]string{"startedAt": start, "open": "100", "high": "110", "low": "90",
+				"close": closing, "baseTokenVolume": "10"}
+		}
+
+		switch subscribe["channel"] {
+		case "v4_candles":
+			require.Equal(t, "BTC-USD/1HOUR", subscribe["id"])
+			send("subscribed", map[string]interface{}{"candles": []interface{}{
+				candle("2022-01-01T01:00:00.000Z", "101"),
+				candle("2022-01-01T00:00:00.000Z", "100"),
+			}})
+			send("channel_data", candle("2022-01-01T01:00:00.000Z", "102"))
+			send("channel_data", candle("2022-01-01T02:00:00.000Z", "103"))
+		case "v4_subaccounts":
+			require.Equal(t, "dydx1address/2", subscribe["id"])
+			send("subscribed", map[string]interface{}{"orders": []interface{}{
+				map[string]string{"id": "a", "clientId": "7", "ticker": "BTC-USD", "side": "BUY", "size": "0.5",
+					"totalFilled": "0", "price": "95", "type": "LIMIT", "status": "OPEN"},
+			}})
+			// updates of known orders may only include the changed fields
+			send("channel_data", map[string]interface{}{"orders": []interface{}{
+				map[string]string{"id": "a", "totalFilled": "0.5", "status": "FILLED"},
+				map[string]string{"id": "unknown", "status": "FILLED"},
+			}})
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+func newTestDydx(t *testing.T, options ...DydxOption) (*Dydx, *dydxServer) {
+	server := newDydxServer(t)
+	key, err := secp256k1.GeneratePrivateKey()
+	require.NoError(t, err)
+
+	options = append([]DydxOption{
+		WithDydxTestnet(),
+		WithDydxCredentials("dydx1address", hex.EncodeToString(key.Serialize())),
+		WithDydxSubaccount(2),
+		WithDydxEndpoint(server.URL+"/v4", "ws"+strings.TrimPrefix(server.URL, "http")+"/v4/ws", server.URL),
+	}, options...)
+	dydx, err := NewDydx(context.Background(), options...)
+	require.NoError(t, err)
+	return dydx, server
+}
+
+func TestDydx(t *testing.T) {
+	t.Run("markets", func(t *testing.T) {
+		dydx, _ := newTestDydx(t)
+		info := dydx.AssetsInfo("BTCUSD")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USD", info.QuoteAsset)
+		require.Equal(t, 0.0001, info.MinQuantity)
+		require.Equal(t, 0.0001, info.StepSize)
+		require.Equal(t, 1.0, info.TickSize)
+		require.Equal(t, 4, info.BaseAssetPrecision)
+		require.Empty(t, dydx.AssetsInfo("OLDUSD").BaseAsset)
+
+		require.Equal(t, "BTC-USD", dydx.ticker("BTCUSD"))
+		require.Equal(t, "BTCUSD", dydx.pair("BTC-USD"))
+		asset, quote := SplitAssetQuote("BTCUSD")
+		require.Equal(t, "BTC", asset)
+		require.Equal(t, "USD", quote)
+
+		market := dydx.markets["BTCUSD"]
+		require.Equal(t, uint64(5_000_000_000), market.quantums(0.5))
+		require.Equal(t, uint64(1_000_000), market.quantums(0.00001))
+		require.Equal(t, uint64(5_000_000_000), market.subticks(50_000.4))
+
+		price, err := dydx.LastQuote(context.Background(), "BTCUSD")
+		require.NoError(t, err)
+		require.Equal(t, 100.0, price)
+
+		_, err = NewDydx(context.Background(), WithDydxCredentials("dydx1address", "invalid"))
+		require.Error(t, err)
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		dydx, _ := newTestDydx(t)
+		candles, err := dydx.CandlesByLimit(context.Background(), "BTCUSD", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, 101.0, candles[0].Close)
+		require.Equal(t, 102.0, candles[1].Close)
+		require.Equal(t, 10.0, candles[1].Volume)
+		require.True(t, candles[1].Complete)
+
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		candles, err = dydx.CandlesByPeriod(context.Background(), "BTCUSD", "1h", start, start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, start, candles[0].Time.UTC())
+
+		_, err = dydx.CandlesByLimit(context.Background(), "BTCUSD", "2h", 2)
+		require.Error(t, err)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		dydx, _ := newTestDydx(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream, _ := dydx.CandlesSubscription(ctx, "BTCUSD", "1h")
+		closes := make([]float64, 0)
+		completes := make([]bool, 0)
+		for i := 0; i < 4; i++ {
+			candle := <-stream
+			closes = append(closes, candle.Close)
+			completes = append(completes, candle.Complete)
+		}
+		// the snapshot history is skipped and the candle is complete on the next period
+		require.Equal(t, []float64{101, 102, 102, 103}, closes)
+		require.Equal(t, []bool{false, false, true, false}, completes)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		dydx, server := newTestDydx(t)
+
+		market, err := dydx.CreateOrderMarket(model.SideTypeBuy, "BTCUSD", 0.5, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.InDelta(t, 105.0, market.Price, 1e-9)
+
+		tx := server.txs[0]
+		require.Equal(t, dydxMsgPlaceOrder, tx.typeURL)
+		require.Equal(t, uint64(market.ExchangeID), tx.orderID[2].value)
+		require.Equal(t, uint64(dydxOrderFlagShortTerm), tx.orderID[3].value)
+		require.Equal(t, uint64(dydxSideBuy), tx.order[2].value)
+		require.Equal(t, uint64(5_000_000_000), tx.order[3].value)
+		require.Equal(t, uint64(10_500_000), tx.order[4].value)
+		require.Equal(t, uint64(1010), tx.order[5].value)
+		require.Equal(t, uint64(dydxTimeInForceIOC), tx.order[7].value)
+		owner := decodeProto(t, tx.orderID[1].data)
+		require.Equal(t, "dydx1address", string(owner[1].data))
+		require.Equal(t, uint64(2), owner[2].value)
+
+		limit, err := dydx.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.5, 120)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, uint64(dydxOrderFlagLongTerm), server.txs[1].orderID[3].value)
+		require.Greater(t, server.txs[1].order[6].value, uint64(time.Now().Unix()))
+
+		var orderError *OrderError
+		_, err = dydx.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.00001, 120)
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+		_, err = dydx.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSD", 100)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+		_, err = dydx.CreateOrderOCO(model.SideTypeSell, "BTCUSD", 1, 110, 90, 89)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		// a zero quantity closes the short position with a reduce only buy stop
+		stop, err := dydx.CreateOrderStop("BTCUSD", 0, -110)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeBuy, stop.Side)
+		require.Equal(t, 110.0, *stop.Stop)
+		require.Equal(t, 0.5, stop.Quantity)
+		tx = server.txs[2]
+		require.Equal(t, uint64(dydxOrderFlagConditional), tx.orderID[3].value)
+		require.Equal(t, uint64(dydxConditionStopLoss), tx.order[10].value)
+		require.Equal(t, uint64(11_000_000), tx.order[11].value)
+		require.Equal(t, uint64(1), tx.order[8].value)
+
+		takeProfit, err := dydx.TakeProfit(model.SideTypeBuy, "BTCUSD", 0.5, 80)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+		require.Equal(t, uint64(dydxConditionTakeProfit), server.txs[3].order[10].value)
+
+		// the account sequence is fetched again when outdated
+		server.mtx.Lock()
+		server.sequence += 3
+		server.mtx.Unlock()
+		require.NoError(t, dydx.Cancel(limit))
+		tx = server.txs[4]
+		require.Equal(t, dydxMsgCancelOrder, tx.typeURL)
+		require.Equal(t, uint64(limit.ExchangeID), tx.orderID[2].value)
+		require.Equal(t, uint64(dydxOrderFlagLongTerm), tx.orderID[3].value)
+
+		orders, err := dydx.OpenOrders("BTCUSD")
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, orders[0].Status)
+		require.Equal(t, model.OrderTypeStopLoss, orders[1].Type)
+		require.Equal(t, 90.0, *orders[1].Stop)
+
+		order, err := dydx.Order("BTCUSD", 9)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.OrderTypeMarket, order.Type)
+		require.Equal(t, model.SideTypeSell, order.Side)
+		_, err = dydx.Order("BTCUSD", 1)
+		require.Error(t, err)
+
+		require.NoError(t, dydx.CancelOpenOrders("BTCUSD"))
+		require.Len(t, server.txs, 7)
+		require.Equal(t, uint64(dydxOrderFlagConditional), server.txs[6].orderID[3].value)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		dydx, server := newTestDydx(t)
+
+		limit, err := dydx.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 120, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Equal(t, int64(dydxClientID("ninjabot-1")), limit.ExchangeID)
+		require.Equal(t, uint64(limit.ExchangeID), server.txs[0].orderID[2].value)
+
+		// the order is not indexed yet
+		_, err = dydx.OrderByClientID("BTCUSD", "ninjabot-1")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+
+		_, err = dydx.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 120, TimeInForce: model.TimeInForceIOC,
+			ClientOrderID: "ninjabot-2"})
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+	})
+
+	t.Run("no private key", func(t *testing.T) {
+		dydx, _ := newTestDydx(t, WithDydxCredentials("dydx1address", ""))
+		_, err := dydx.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.5, 120)
+		require.ErrorIs(t, err, ErrDydxPrivateKey)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		dydx, _ := newTestDydx(t)
+		account, err := dydx.Account()
+		require.NoError(t, err)
+		require.Equal(t, []model.Balance{
+			{Asset: "BTC", Free: -0.5},
+			{Asset: "USDC", Free: 900, Lock: 100},
+		}, account.Balances)
+		require.Equal(t, 900.0, account.Available)
+
+		asset, quote, err := dydx.Position("BTCUSD")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+		require.Equal(t, 900.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		dydx, _ := newTestDydx(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, _ := dydx.AccountSubscription(ctx)
+		order := <-updates
+		require.Equal(t, int64(7), order.ExchangeID)
+		require.Equal(t, "BTCUSD", order.Pair)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.SideTypeBuy, order.Side)
+		require.Equal(t, 95.0, order.Price)
+		require.Equal(t, 0.5, order.Quantity)
+		require.Equal(t, model.OrderTypeLimit, order.Type)
+	})
+}
@@ -0,0 +1,184 @@
+package exchange
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// dYdX order flags, short-term orders live in memory of validators until a block height,
+// while stateful orders are stored on-chain until a block time
+const (
+	dydxOrderFlagShortTerm   uint32 = 0
+	dydxOrderFlagConditional uint32 = 32
+	dydxOrderFlagLongTerm    uint32 = 64
+)
+
+// dYdX order enums, as defined in the dydxprotocol.clob protobuf package
+const (
+	dydxSideBuy  = 1
+	dydxSideSell = 2
+
+	dydxTimeInForceIOC = 1
+
+	dydxConditionStopLoss   = 1
+	dydxConditionTakeProfit = 2
+)
+
+const (
+	dydxMsgPlaceOrder  = "/dydxprotocol.clob.MsgPlaceOrder"
+	dydxMsgCancelOrder = "/dydxprotocol.clob.MsgCancelOrder"
+	dydxPubKeyType     = "/cosmos.crypto.secp256k1.PubKey"
+	dydxSignModeDirect = 1
+)
+
+// protoMessage is a minimal protobuf encoder of the dYdX and Cosmos messages, fields with default values
+// are omitted as in proto3.
+type protoMessage []byte
+
+func appendUvarint(m protoMessage, value uint64) protoMessage {
+	var buf [binary.MaxVarintLen64]byte
+	return append(m, buf[:binary.PutUvarint(buf[:], value)]...)
+}
+
+func (m protoMessage) tag(field, wireType int) protoMessage {
+	return appendUvarint(m, uint64(field<<3|wireType))
+}
+
+func (m protoMessage) uint(field int, value uint64) protoMessage {
+	if value == 0 {
+		return m
+	}
+	return appendUvarint(m.tag(field, 0), value)
+}
+
+func (m protoMessage) bool(field int, value bool) protoMessage {
+	if !value {
+		return m
+	}
+	return m.uint(field, 1)
+}
+
+func (m protoMessage) fixed32(field int, value uint32) protoMessage {
+	if value == 0 {
+		return m
+	}
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], value)
+	return append(m.tag(field, 5), buf[:]...)
+}
+
+func (m protoMessage) bytes(field int, value []byte) protoMessage {
+	if len(value) == 0 {
+		return m
+	}
+	m = appendUvarint(m.tag(field, 2), uint64(len(value)))
+	return append(m, value...)
+}
+
+func (m protoMessage) string(field int, value string) protoMessage {
+	return m.bytes(field, []byte(value))
+}
+
+// message encodes an embedded message, which is kept even when empty
+func (m protoMessage) message(field int, value protoMessage) protoMessage {
+	m = appendUvarint(m.tag(field, 2), uint64(len(value)))
+	return append(m, value...)
+}
+
+func protoAny(typeURL string, value protoMessage) protoMessage {
+	return protoMessage{}.string(1, typeURL).bytes(2, value)
+}
+
+// dydxOrderID identifies an order by its subaccount, client id, flags and market
+type dydxOrderID struct {
+	Owner      string
+	Subaccount uint32
+	ClientID   uint32
+	OrderFlags uint32
+	ClobPairID uint32
+}
+
+func (id dydxOrderID) encode() protoMessage {
+	subaccount := protoMessage{}.string(1, id.Owner).uint(2, uint64(id.Subaccount))
+	return protoMessage{}.
+		message(1, subaccount).
+		fixed32(2, id.ClientID).
+		uint(3, uint64(id.OrderFlags)).
+		uint(4, uint64(id.ClobPairID))
+}
+
+// dydxOrderMsg is an order of the dYdX chain, expressed in quantums and subticks of its market.
+// Short-term orders expire at a block height and stateful orders at a block time.
+type dydxOrderMsg struct {
+	ID                 dydxOrderID
+	Side               int
+	Quantums           uint64
+	Subticks           uint64
+	GoodTilBlock       uint32
+	GoodTilBlockTime   uint32
+	TimeInForce        int
+	ReduceOnly         bool
+	ConditionType      int
+	ConditionalTrigger uint64
+}
+
+func (o dydxOrderMsg) encode() protoMessage {
+	order := protoMessage{}.
+		message(1, o.ID.encode()).
+		uint(2, uint64(o.Side)).
+		uint(3, o.Quantums).
+		uint(4, o.Subticks).
+		uint(5, uint64(o.GoodTilBlock)).
+		fixed32(6, o.GoodTilBlockTime).
+		uint(7, uint64(o.TimeInForce)).
+		bool(8, o.ReduceOnly).
+		uint(10, uint64(o.ConditionType)).
+		uint(11, o.ConditionalTrigger)
+	return protoAny(dydxMsgPlaceOrder, protoMessage{}.message(1, order))
+}
+
+// dydxCancelMsg cancels an order, the expiration must follow the order flags as in dydxOrderMsg
+type dydxCancelMsg struct {
+	ID               dydxOrderID
+	GoodTilBlock     uint32
+	GoodTilBlockTime uint32
+}
+
+func (c dydxCancelMsg) encode() protoMessage {
+	cancel := protoMessage{}.
+		message(1, c.ID.encode()).
+		uint(2, uint64(c.GoodTilBlock)).
+		fixed32(3, c.GoodTilBlockTime)
+	return protoAny(dydxMsgCancelOrder, cancel)
+}
+
+// dydxSignTx builds a Cosmos transaction with a message, signed in direct mode with a secp256k1 key.
+// dYdX has no gas fees for trading messages, so the fee is empty.
+func dydxSignTx(key *secp256k1.PrivateKey, chainID string, accountNumber, sequence uint64,
+	msg protoMessage) []byte {
+
+	body := protoMessage{}.bytes(1, msg)
+
+	pubKey := protoAny(dydxPubKeyType, protoMessage{}.bytes(1, key.PubKey().SerializeCompressed()))
+	modeInfo := protoMessage{}.message(1, protoMessage{}.uint(1, dydxSignModeDirect))
+	signerInfo := protoMessage{}.message(1, pubKey).message(2, modeInfo).uint(3, sequence)
+	authInfo := protoMessage{}.message(1, signerInfo).message(2, protoMessage{})
+
+	signDoc := protoMessage{}.
+		bytes(1, body).
+		bytes(2, authInfo).
+		string(3, chainID).
+		uint(4, accountNumber)
+	hash := sha256.Sum256(signDoc)
+
+	// compact signatures are prefixed by the recovery code, followed by r and s
+	signature := ecdsa.SignCompact(key, hash[:], true)
+
+	return protoMessage{}.
+		bytes(1, body).
+		bytes(2, authInfo).
+		bytes(3, signature[1:])
+}
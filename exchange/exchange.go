@@ -6,30 +6,48 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/StudioSol/set"
+	"github.com/xhit/go-str2duration/v2"
 
 	"github.com/bengalm/ninjabot/model"
 	"github.com/bengalm/ninjabot/service"
 	"github.com/bengalm/ninjabot/tools/log"
+	"github.com/bengalm/ninjabot/tools/supervisor"
+	"github.com/bengalm/ninjabot/tools/watchdog"
 )
 
 var (
 	ErrInvalidQuantity   = errors.New("invalid quantity")
 	ErrInsufficientFunds = errors.New("insufficient funds or locked")
 	ErrInvalidAsset      = errors.New("invalid asset")
+	ErrFeedClosed        = errors.New("data feed closed")
+	ErrPostOnlyRejected  = errors.New("post only order would take liquidity")
+	ErrUnsupportedFeed   = errors.New("feed not supported")
+	ErrUnsupportedOrder  = errors.New("order type not supported")
+	// ErrOrderNotFound is returned for an order unknown by the exchange, eg: a client order ID never placed
+	ErrOrderNotFound = errors.New("order not found")
 )
 
 type DataFeed struct {
 	Data chan model.Candle
 	Err  chan error
+
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type DataFeedSubscription struct {
-	exchange                service.Exchange
+	exchange                service.Feeder
 	Feeds                   *set.LinkedHashSetString
 	DataFeeds               map[string]*DataFeed
 	SubscriptionsByDataFeed map[string][]Subscription
+	guard                   *candleGuard
+	supervisor              *supervisor.Supervisor
+	backfill                bool
+	watchdog                *watchdog.Watchdog
+	staleCandles            int
 }
 
 type Subscription struct {
@@ -47,17 +65,125 @@ func (o *OrderError) Error() string {
 	return fmt.Sprintf("order error: %v", o.Err)
 }
 
+func (o *OrderError) Unwrap() error {
+	return o.Err
+}
+
 type DataFeedConsumer func(model.Candle)
 
-func NewDataFeed(exchange service.Exchange) *DataFeedSubscription {
+// positionRisk returns the risk of exchanges without position details, with the size of the position only
+func positionRisk(broker service.Broker, pair string) (model.PositionRisk, error) {
+	asset, _, err := broker.Position(pair)
+	if err != nil {
+		return model.PositionRisk{}, err
+	}
+	return model.PositionRisk{Pair: pair, Size: asset}, nil
+}
+
+// depthUnsupported returns the closed channels of a depth subscription, with ErrUnsupportedFeed,
+// for feeders without order book data
+func depthUnsupported(feeder string) (chan model.OrderBook, chan error) {
+	cbook := make(chan model.OrderBook)
+	cerr := make(chan error, 1)
+	cerr <- fmt.Errorf("%w: %s order book depth", ErrUnsupportedFeed, feeder)
+	close(cbook)
+	close(cerr)
+	return cbook, cerr
+}
+
+// modifyOrder amends an order of exchanges without native support, canceling and replacing it
+// with a new order. Zero price or quantity keep the current values of the order.
+func modifyOrder(broker service.Broker, order model.Order, price, quantity float64) (model.Order, error) {
+	request, err := ReplaceRequest(order, price, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if err := broker.Cancel(order); err != nil {
+		return model.Order{}, err
+	}
+
+	replaced, err := placeRequest(broker, request)
+	if err != nil {
+		return model.Order{}, fmt.Errorf("order %d canceled, replacement failed: %w", order.ExchangeID, err)
+	}
+	return replaced, nil
+}
+
+// ReplaceRequest returns the request of a new order replacing an open order with another price or quantity,
+// zero values keep the current ones. Stop and take profit orders are replaced with their trigger at the price.
+func ReplaceRequest(order model.Order, price, quantity float64) (model.OrderRequest, error) {
+	if quantity <= 0 {
+		quantity = order.Quantity
+	}
+	if price <= 0 {
+		price = order.Price
+		if order.Stop != nil && *order.Stop > 0 {
+			price = *order.Stop
+		}
+	}
+
+	request := model.OrderRequest{Pair: order.Pair, Side: order.Side, Quantity: quantity, Price: price}
+	switch order.Type {
+	case model.OrderTypeLimit, model.OrderTypeLimitMaker:
+		request.Type = model.OrderTypeLimit
+	case model.OrderTypeStopLoss, "STOP_MARKET":
+		request.Type, request.Stop = model.OrderTypeStopLoss, price
+	case model.OrderTypeStopLossLimit, "STOP":
+		request.Type, request.Stop = model.OrderTypeStopLossLimit, price
+	case model.OrderTypeTakeProfit, "TAKE_PROFIT_MARKET":
+		request.Type, request.Stop = model.OrderTypeTakeProfit, price
+	case model.OrderTypeTakeProfitLimit:
+		request.Type, request.Stop = model.OrderTypeTakeProfitLimit, price
+	default:
+		return model.OrderRequest{}, fmt.Errorf("%w: modify %s", ErrUnsupportedOrder, order.Type)
+	}
+	return request, nil
+}
+
+// validateIceberg checks the options of an iceberg order, the visible quantity must be lower than
+// the order size and the remaining size must stay in the book
+func validateIceberg(pair string, quantity float64, options model.OrderOptions) error {
+	if options.IcebergQuantity >= quantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: iceberg quantity %f", ErrInvalidQuantity, options.IcebergQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+	if options.TimeInForce == model.TimeInForceIOC || options.TimeInForce == model.TimeInForceFOK {
+		return fmt.Errorf("%w: iceberg %s order", ErrUnsupportedOrder, options.TimeInForce)
+	}
+	return nil
+}
+
+func NewDataFeed(exchange service.Feeder) *DataFeedSubscription {
 	return &DataFeedSubscription{
 		exchange:                exchange,
 		Feeds:                   set.NewLinkedHashSetString(),
 		DataFeeds:               make(map[string]*DataFeed),
 		SubscriptionsByDataFeed: make(map[string][]Subscription),
+		guard:                   newCandleGuard(),
 	}
 }
 
+// SetFeeder replaces the candle source of the subscriptions, it must be called before Start
+func (d *DataFeedSubscription) SetFeeder(feeder service.Feeder) {
+	d.exchange = feeder
+}
+
+// SetSupervisor enables the supervision of data feeds in live mode, closed or panicking feeds are reconnected
+func (d *DataFeedSubscription) SetSupervisor(supervisor *supervisor.Supervisor) {
+	d.supervisor = supervisor
+}
+
+// SetWatchdog monitors the supervised data feeds, feeds without candles within a number of timeframes,
+// eg: 3 candles, are reconnected
+func (d *DataFeedSubscription) SetWatchdog(watchdog *watchdog.Watchdog, candles int) {
+	d.watchdog = watchdog
+	d.staleCandles = candles
+}
+
 func (d *DataFeedSubscription) feedKey(pair, timeframe string) string {
 	return fmt.Sprintf("%s--%s", pair, timeframe)
 }
@@ -76,6 +202,15 @@ func (d *DataFeedSubscription) Subscribe(pair, timeframe string, consumer DataFe
 	})
 }
 
+// SubscribePair registers a consumer in the feeds of a pair on several timeframes, eg: 15m signals with a
+// 4h trend filter. Candles are tagged with the timeframe of their feed.
+func (d *DataFeedSubscription) SubscribePair(pair string, consumer DataFeedConsumer, onCandleClose bool,
+	timeframes ...string) {
+	for _, timeframe := range timeframes {
+		d.Subscribe(pair, timeframe, consumer, onCandleClose)
+	}
+}
+
 func (d *DataFeedSubscription) Preload(pair, timeframe string, candles []model.Candle) {
 	log.Infof("[SETUP] preloading %d candles for %s-%s", len(candles), pair, timeframe)
 	key := d.feedKey(pair, timeframe)
@@ -83,6 +218,11 @@ func (d *DataFeedSubscription) Preload(pair, timeframe string, candles []model.C
 		if !candle.Complete {
 			continue
 		}
+		candle, ok := d.guard.Accept(key, candle)
+		if !ok {
+			continue
+		}
+		candle.Timeframe = timeframe
 
 		for _, subscription := range d.SubscriptionsByDataFeed[key] {
 			subscription.consumer(candle)
@@ -93,40 +233,109 @@ func (d *DataFeedSubscription) Preload(pair, timeframe string, candles []model.C
 func (d *DataFeedSubscription) Connect() {
 	log.Infof("Connecting to the exchange.")
 	for feed := range d.Feeds.Iter() {
-		pair, timeframe := d.pairTimeframeFromKey(feed)
-		ccandle, cerr := d.exchange.CandlesSubscription(context.Background(), pair, timeframe)
-		d.DataFeeds[feed] = &DataFeed{
-			Data: ccandle,
-			Err:  cerr,
+		d.DataFeeds[feed] = d.subscribe(context.Background(), feed)
+	}
+}
+
+// subscribe opens the candle subscription of a feed, canceled with the feed
+func (d *DataFeedSubscription) subscribe(ctx context.Context, key string) *DataFeed {
+	pair, timeframe := d.pairTimeframeFromKey(key)
+	ctx, cancel := context.WithCancel(ctx)
+	ccandle, cerr := d.exchange.CandlesSubscription(ctx, pair, timeframe)
+	return &DataFeed{Data: ccandle, Err: cerr, ctx: ctx, cancel: cancel}
+}
+
+// consume sends the candles of a feed to its subscribers, until the feed is closed
+func (d *DataFeedSubscription) consume(key string, feed *DataFeed) {
+	_, timeframe := d.pairTimeframeFromKey(key)
+	errs := feed.Err
+	for {
+		select {
+		case candle, ok := <-feed.Data:
+			if !ok {
+				return
+			}
+			if d.watchdog != nil {
+				d.watchdog.Beat("feed/" + key)
+			}
+
+			if d.backfill {
+				for _, missing := range d.missingCandles(key, candle) {
+					d.deliver(key, timeframe, missing)
+				}
+			}
+			d.deliver(key, timeframe, candle)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if err != nil {
+				log.Error("dataFeedSubscription/start: ", err)
+			}
+		case <-feed.ctx.Done():
+			return
 		}
 	}
 }
 
+// deliver sends a candle to the subscribers of a feed, unless it is a duplicated or out-of-order candle
+func (d *DataFeedSubscription) deliver(key, timeframe string, candle model.Candle) {
+	candle, ok := d.guard.Accept(key, candle)
+	if !ok {
+		return
+	}
+	candle.Timeframe = timeframe
+
+	for _, subscription := range d.SubscriptionsByDataFeed[key] {
+		if subscription.onCandleClose && !candle.Complete {
+			continue
+		}
+		subscription.consumer(candle)
+	}
+}
+
+// supervise consumes a feed under the supervisor, reconnecting when the feed is closed or, with a watchdog,
+// when the feed is stale
+func (d *DataFeedSubscription) supervise(key string, feed *DataFeed) {
+	_, timeframe := d.pairTimeframeFromKey(key)
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil && d.watchdog != nil {
+		log.Warnf("[FEED] %s not monitored by the watchdog: %v", key, err)
+	}
+
+	d.supervisor.Go(context.Background(), "feed/"+key, func(ctx context.Context) error {
+		if feed == nil {
+			feed = d.subscribe(ctx, key)
+		}
+		defer feed.cancel()
+
+		if d.watchdog != nil && interval > 0 && d.staleCandles > 0 {
+			d.watchdog.Watch("feed/"+key, time.Duration(d.staleCandles)*interval, feed.cancel)
+		}
+
+		d.consume(key, feed)
+		feed = nil
+		return fmt.Errorf("%w: %s", ErrFeedClosed, key)
+	})
+}
+
+// Start connects and consumes the data feeds. Live feeds (without loadSync) backfill the candles lost
+// between reconnections from the exchange.
 func (d *DataFeedSubscription) Start(loadSync bool) {
+	d.backfill = !loadSync
 	d.Connect()
 	wg := new(sync.WaitGroup)
 	for key, feed := range d.DataFeeds {
+		if d.supervisor != nil && !loadSync {
+			d.supervise(key, feed)
+			continue
+		}
+
 		wg.Add(1)
 		go func(key string, feed *DataFeed) {
-			for {
-				select {
-				case candle, ok := <-feed.Data:
-					if !ok {
-						wg.Done()
-						return
-					}
-					for _, subscription := range d.SubscriptionsByDataFeed[key] {
-						if subscription.onCandleClose && !candle.Complete {
-							continue
-						}
-						subscription.consumer(candle)
-					}
-				case err := <-feed.Err:
-					if err != nil {
-						log.Error("dataFeedSubscription/start: ", err)
-					}
-				}
-			}
+			defer wg.Done()
+			d.consume(key, feed)
 		}(key, feed)
 	}
 
@@ -0,0 +1,270 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+var ErrFeederNotFound = errors.New("feeder not registered")
+
+// FeederConfig is a free-form configuration given to a registered feeder factory, eg: file path, DSN or API key
+type FeederConfig map[string]string
+
+// FeederFactory creates a custom data feeder from a given configuration
+type FeederFactory func(ctx context.Context, config FeederConfig) (service.Feeder, error)
+
+var (
+	feederMtx       sync.RWMutex
+	feederFactories = make(map[string]FeederFactory)
+)
+
+func init() {
+	RegisterFeeder("csv", func(_ context.Context, config FeederConfig) (service.Feeder, error) {
+		target := config["target"]
+		if target == "" {
+			target = config["timeframe"]
+		}
+
+		return NewCSVFeed(target, PairFeed{
+			Pair:      config["pair"],
+			File:      config["file"],
+			Timeframe: config["timeframe"],
+		})
+	})
+}
+
+// RegisterFeeder registers a custom feeder factory under a given name. Registering the same name twice
+// will replace the previous factory.
+func RegisterFeeder(name string, factory FeederFactory) {
+	feederMtx.Lock()
+	defer feederMtx.Unlock()
+	feederFactories[name] = factory
+}
+
+// Feeders returns the name of all registered feeders
+func Feeders() []string {
+	feederMtx.RLock()
+	defer feederMtx.RUnlock()
+
+	names := make([]string, 0, len(feederFactories))
+	for name := range feederFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewFeeder creates a feeder from the registry, given its name and configuration
+func NewFeeder(ctx context.Context, name string, config FeederConfig) (service.Feeder, error) {
+	feederMtx.RLock()
+	factory, ok := feederFactories[name]
+	feederMtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrFeederNotFound, name)
+	}
+	return factory(ctx, config)
+}
+
+// CandleSource is the minimal contract to plug external data into ninjabot. Databases, vendor APIs or
+// synthetic series only need to return the candles of a given period, the remaining Feeder methods
+// are provided by CustomFeed. Candles are sorted by time, and sources without the Complete flag, eg: CSV
+// files, can leave it unset: candles followed by another one, or whose period ended, are complete.
+type CandleSource interface {
+	Candles(ctx context.Context, pair, timeframe string, start, end time.Time) ([]model.Candle, error)
+}
+
+// CandleSourceFunc is an adapter to use ordinary functions as CandleSource
+type CandleSourceFunc func(ctx context.Context, pair, timeframe string, start, end time.Time) ([]model.Candle, error)
+
+func (f CandleSourceFunc) Candles(ctx context.Context, pair, timeframe string,
+	start, end time.Time) ([]model.Candle, error) {
+	return f(ctx, pair, timeframe, start, end)
+}
+
+// CustomFeed implements service.Feeder on top of a CandleSource
+type CustomFeed struct {
+	source       CandleSource
+	assetsInfo   map[string]model.AssetInfo
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+type CustomFeedOption func(*CustomFeed)
+
+// WithCustomFeedAssetInfo sets the asset limits and precision of a pair, by default no limits are applied
+func WithCustomFeedAssetInfo(pair string, info model.AssetInfo) CustomFeedOption {
+	return func(feed *CustomFeed) {
+		feed.assetsInfo[pair] = info
+	}
+}
+
+// WithCustomFeedPollInterval sets the interval used to check new candles in subscriptions.
+// By default, the source is checked once per timeframe.
+func WithCustomFeedPollInterval(interval time.Duration) CustomFeedOption {
+	return func(feed *CustomFeed) {
+		feed.pollInterval = interval
+	}
+}
+
+// NewCustomFeed creates a new feeder from an external candle source
+func NewCustomFeed(source CandleSource, options ...CustomFeedOption) *CustomFeed {
+	feed := &CustomFeed{
+		source:     source,
+		assetsInfo: make(map[string]model.AssetInfo),
+		now:        time.Now,
+	}
+
+	for _, option := range options {
+		option(feed)
+	}
+
+	return feed
+}
+
+func (c *CustomFeed) AssetsInfo(pair string) model.AssetInfo {
+	if info, ok := c.assetsInfo[pair]; ok {
+		return info
+	}
+
+	asset, quote := SplitAssetQuote(pair)
+	return model.AssetInfo{
+		BaseAsset:          asset,
+		QuoteAsset:         quote,
+		MaxPrice:           math.MaxFloat64,
+		MaxQuantity:        math.MaxFloat64,
+		StepSize:           0.00000001,
+		TickSize:           0.00000001,
+		QuotePrecision:     8,
+		BaseAssetPrecision: 8,
+	}
+}
+
+func (c *CustomFeed) LastQuote(ctx context.Context, pair string) (float64, error) {
+	now := c.now()
+	candles, err := c.source.Candles(ctx, pair, "1m", now.Add(-time.Hour), now)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(candles) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrInsufficientData, pair)
+	}
+
+	return candles[len(candles)-1].Close, nil
+}
+
+func (c *CustomFeed) CandlesByPeriod(ctx context.Context, pair, timeframe string,
+	start, end time.Time) ([]model.Candle, error) {
+	return c.source.Candles(ctx, pair, timeframe, start, end)
+}
+
+func (c *CustomFeed) CandlesByLimit(ctx context.Context, pair, timeframe string, limit int) ([]model.Candle, error) {
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil, err
+	}
+
+	end := c.now()
+	candles, err := c.source.Candles(ctx, pair, timeframe, end.Add(-interval*time.Duration(limit+1)), end)
+	if err != nil {
+		return nil, err
+	}
+
+	complete := make([]model.Candle, 0, len(candles))
+	for _, candle := range completeCandles(candles, interval, end) {
+		if candle.Complete {
+			complete = append(complete, candle)
+		}
+	}
+
+	if len(complete) > limit {
+		complete = complete[len(complete)-limit:]
+	}
+
+	return complete, nil
+}
+
+func (c *CustomFeed) CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(ccandle)
+		defer close(cerr)
+
+		interval, err := str2duration.ParseDuration(timeframe)
+		if err != nil {
+			cerr <- err
+			return
+		}
+
+		pollInterval := c.pollInterval
+		if pollInterval == 0 {
+			pollInterval = interval
+		}
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		var lastCandle time.Time
+		for {
+			candles, err := c.source.Candles(ctx, pair, timeframe, c.now().Add(-2*interval), c.now())
+			if err != nil {
+				log.Warnf("customFeed/subscription %s: %v", pair, err)
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			for _, candle := range completeCandles(candles, interval, c.now()) {
+				if !candle.Complete || !candle.Time.After(lastCandle) {
+					continue
+				}
+
+				lastCandle = candle.Time
+				select {
+				case ccandle <- candle:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// completeCandles flags the candles of a source without the Complete flag: every candle before the latest one,
+// and the latest one when its period ended
+func completeCandles(candles []model.Candle, interval time.Duration, now time.Time) []model.Candle {
+	for i := range candles {
+		if i < len(candles)-1 || !candles[i].Time.Add(interval).After(now) {
+			candles[i].Complete = true
+		}
+	}
+	return candles
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (c *CustomFeed) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("custom feed")
+}
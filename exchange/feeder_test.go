@@ -0,0 +1,118 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+func TestFeederRegistry(t *testing.T) {
+	t.Run("csv feeder", func(t *testing.T) {
+		feeder, err := NewFeeder(context.Background(), "csv", FeederConfig{
+			"pair":      "BTCUSDT",
+			"file":      "../testdata/btc-1d.csv",
+			"timeframe": "1d",
+		})
+		require.NoError(t, err)
+
+		candles, err := feeder.CandlesByLimit(context.Background(), "BTCUSDT", "1d", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+	})
+
+	t.Run("custom feeder", func(t *testing.T) {
+		RegisterFeeder("custom", func(_ context.Context, config FeederConfig) (service.Feeder, error) {
+			if config["key"] == "" {
+				return nil, errors.New("missing key")
+			}
+			return NewCustomFeed(nil), nil
+		})
+		require.Contains(t, Feeders(), "custom")
+
+		_, err := NewFeeder(context.Background(), "custom", nil)
+		require.EqualError(t, err, "missing key")
+
+		feeder, err := NewFeeder(context.Background(), "custom", FeederConfig{"key": "value"})
+		require.NoError(t, err)
+		require.NotNil(t, feeder)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := NewFeeder(context.Background(), "invalid", nil)
+		require.ErrorIs(t, err, ErrFeederNotFound)
+	})
+}
+
+func TestCustomFeed(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 30, 0, 0, time.UTC)
+	source := CandleSourceFunc(func(_ context.Context, pair, _ string, start, end time.Time) ([]model.Candle, error) {
+		candles := make([]model.Candle, 0)
+		for t := start.Truncate(time.Hour); !t.After(end); t = t.Add(time.Hour) {
+			candles = append(candles, model.Candle{
+				Pair:     pair,
+				Time:     t,
+				Close:    float64(t.Hour()),
+				Complete: t.Add(time.Hour).Before(end),
+			})
+		}
+		return candles, nil
+	})
+
+	feed := NewCustomFeed(source)
+	feed.now = func() time.Time { return now }
+
+	t.Run("candles by limit", func(t *testing.T) {
+		candles, err := feed.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 3)
+		require.NoError(t, err)
+		require.Len(t, candles, 3)
+		require.Equal(t, 9.0, candles[2].Close)
+		require.Equal(t, 7.0, candles[0].Close)
+	})
+
+	t.Run("candles without the complete flag", func(t *testing.T) {
+		source := CandleSourceFunc(func(_ context.Context, pair, _ string, _, _ time.Time) ([]model.Candle, error) {
+			return []model.Candle{
+				{Pair: pair, Time: now.Add(-150 * time.Minute), Close: 8},
+				{Pair: pair, Time: now.Add(-90 * time.Minute), Close: 9},
+				{Pair: pair, Time: now.Add(-30 * time.Minute), Close: 10},
+			}, nil
+		})
+		feed := NewCustomFeed(source)
+		feed.now = func() time.Time { return now }
+
+		// all candles before the latest are complete, the latest one is in progress
+		candles, err := feed.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 3)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, 9.0, candles[1].Close)
+		require.True(t, candles[1].Complete)
+
+		feed.now = func() time.Time { return now.Add(time.Hour) }
+		candles, err = feed.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 3)
+		require.NoError(t, err)
+		require.Len(t, candles, 3)
+		require.Equal(t, 10.0, candles[2].Close)
+	})
+
+	t.Run("last quote", func(t *testing.T) {
+		quote, err := feed.LastQuote(context.Background(), "BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 10.0, quote)
+	})
+
+	t.Run("subscription", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ccandle, _ := feed.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		candle := <-ccandle
+		require.True(t, candle.Complete)
+		require.Equal(t, "BTCUSDT", candle.Pair)
+	})
+}
@@ -0,0 +1,60 @@
+package exchange
+
+import (
+	"encoding/csv"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// FundingRatesFromCSV reads the funding rates of a pair from a CSV file with the columns time (unix seconds)
+// and rate, eg: downloaded with `ninjabot funding`. The header line is optional.
+func FundingRatesFromCSV(pair, file string) ([]model.FundingRate, error) {
+	csvFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer csvFile.Close()
+
+	lines, err := csv.NewReader(csvFile).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) > 0 && len(lines[0]) > 0 {
+		if _, err := strconv.ParseInt(lines[0][0], 10, 64); err != nil {
+			lines = lines[1:]
+		}
+	}
+
+	rates := make([]model.FundingRate, 0, len(lines))
+	for _, line := range lines {
+		if len(line) < 2 {
+			return nil, ErrInsufficientData
+		}
+
+		timestamp, err := strconv.ParseInt(line[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		rate, err := strconv.ParseFloat(line[1], 64)
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, model.FundingRate{
+			Pair: pair,
+			Rate: rate,
+			Time: time.Unix(timestamp, 0).UTC(),
+		})
+	}
+
+	sort.SliceStable(rates, func(i, j int) bool {
+		return rates[i].Time.Before(rates[j].Time)
+	})
+	return rates, nil
+}
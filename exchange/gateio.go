@@ -0,0 +1,1637 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	gateioEndpoint              = "https://api.gateio.ws/api/v4"
+	gateioStreamEndpoint        = "wss://api.gateio.ws/ws/v4/"
+	gateioFuturesStreamEndpoint = "wss://fx-ws.gateio.ws/v4/ws/usdt"
+
+	// gateioCandleLimit is the maximum number of candles returned by a request
+	gateioCandleLimit = 1000
+
+	// gateioTriggerExpiration is the lifetime in seconds of spot price-triggered orders
+	gateioTriggerExpiration = 30 * 24 * 60 * 60
+
+	gateioErrOrderNotFound = "ORDER_NOT_FOUND"
+)
+
+// GateIOError is an error returned by the Gate.io API
+type GateIOError struct {
+	Label   string
+	Message string
+}
+
+func (e *GateIOError) Error() string {
+	return fmt.Sprintf("gateio error %s: %s", e.Label, e.Message)
+}
+
+// gateNumber is a number sent either as a JSON string or a JSON number
+type gateNumber float64
+
+func (n *gateNumber) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "" || value == "null" {
+		*n = 0
+		return nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	*n = gateNumber(number)
+	return nil
+}
+
+type gateioContract struct {
+	// name is the Gate.io currency pair or contract, eg: BTC_USDT
+	name string
+	// multiplier is the size of a contract in the base asset, 1 for spot
+	multiplier float64
+}
+
+// GateIO is the Gate.io exchange, for spot or USDT perpetual futures markets. Pairs keep the ninjabot format,
+// eg: BTCUSDT, and are translated to Gate.io currency pairs and contracts, eg: BTC_USDT. Futures quantities are
+// also given in the base asset and converted to contracts.
+type GateIO struct {
+	ctx        context.Context
+	client     *http.Client
+	assetsInfo map[string]model.AssetInfo
+	contracts  map[string]gateioContract
+	pairs      map[string]string
+	Futures    bool
+	HeikinAshi bool
+
+	APIKey    string
+	APISecret string
+
+	// Endpoint and StreamEndpoint override the REST and websocket URLs, eg: for a mock server
+	Endpoint       string
+	StreamEndpoint string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+	PairOptions      []PairOption
+}
+
+type GateIOOption func(*GateIO)
+
+// WithGateIOCredentials will set the credentials for Gate.io
+func WithGateIOCredentials(key, secret string) GateIOOption {
+	return func(g *GateIO) {
+		g.APIKey = key
+		g.APISecret = secret
+	}
+}
+
+// WithGateIOFutures will trade USDT perpetual futures instead of spot
+func WithGateIOFutures() GateIOOption {
+	return func(g *GateIO) {
+		g.Futures = true
+	}
+}
+
+// WithGateIOHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithGateIOHeikinAshiCandle() GateIOOption {
+	return func(g *GateIO) {
+		g.HeikinAshi = true
+	}
+}
+
+// WithGateIOMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithGateIOMetadataFetcher(fetcher MetadataFetchers) GateIOOption {
+	return func(g *GateIO) {
+		g.MetadataFetchers = append(g.MetadataFetchers, fetcher)
+	}
+}
+
+// WithGateIOLeverage will set the leverage and margin type of a futures pair
+func WithGateIOLeverage(pair string, leverage int, marginType MarginType) GateIOOption {
+	return func(g *GateIO) {
+		g.PairOptions = append(g.PairOptions, PairOption{
+			Pair:       strings.ToUpper(pair),
+			Leverage:   leverage,
+			MarginType: marginType,
+		})
+	}
+}
+
+// WithGateIOEndpoint overrides the REST and websocket endpoints
+func WithGateIOEndpoint(endpoint, streamEndpoint string) GateIOOption {
+	return func(g *GateIO) {
+		g.Endpoint = endpoint
+		g.StreamEndpoint = streamEndpoint
+	}
+}
+
+// NewGateIO will create a new Gate.io instance, for spot markets by default
+func NewGateIO(ctx context.Context, options ...GateIOOption) (*GateIO, error) {
+	exchange := &GateIO{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.Endpoint == "" {
+		exchange.Endpoint, exchange.StreamEndpoint = gateioEndpoint, gateioStreamEndpoint
+		if exchange.Futures {
+			exchange.StreamEndpoint = gateioFuturesStreamEndpoint
+		}
+	}
+
+	// Initialize with orders precision and assets limits
+	if err := exchange.loadContracts(ctx); err != nil {
+		return nil, fmt.Errorf("gateio ping fail: %w", err)
+	}
+
+	// Set leverage and margin type, a zero leverage is the cross margin mode
+	for _, option := range exchange.PairOptions {
+		query := map[string]interface{}{"leverage": option.Leverage}
+		if option.MarginType != MarginTypeIsolated {
+			query = map[string]interface{}{"leverage": 0, "cross_leverage_limit": option.Leverage}
+		}
+		path := fmt.Sprintf("/futures/usdt/positions/%s/leverage", exchange.name(option.Pair))
+		if err := exchange.request(ctx, http.MethodPost, path, query, nil, true, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	market := "spot"
+	if exchange.Futures {
+		market = "futures"
+	}
+	log.Infof("[SETUP] Using Gate.io exchange (%s)", market)
+
+	return exchange, nil
+}
+
+func (g *GateIO) sign(payload string) string {
+	mac := hmac.New(sha512.New, []byte(g.APISecret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// request sends a REST request with params in the query string and an optional JSON body. Signed requests
+// are authenticated with the HMAC signature of the method, path, query, body hash and timestamp.
+func (g *GateIO) request(ctx context.Context, method, path string, query map[string]interface{},
+	body interface{}, signed bool, result interface{}) error {
+
+	values := url.Values{}
+	for key, value := range query {
+		values.Set(key, fmt.Sprint(value))
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	endpoint, err := url.Parse(g.Endpoint + path)
+	if err != nil {
+		return err
+	}
+	endpoint.RawQuery = values.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		hash := sha512.Sum512(payload)
+		req.Header.Set("KEY", g.APIKey)
+		req.Header.Set("Timestamp", timestamp)
+		req.Header.Set("SIGN", g.sign(strings.Join([]string{
+			method, endpoint.Path, endpoint.RawQuery, hex.EncodeToString(hash[:]), timestamp,
+		}, "\n")))
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiError := &GateIOError{}
+		if err := json.Unmarshal(data, apiError); err != nil || apiError.Label == "" {
+			return fmt.Errorf("gateio %s %s: status %d: %s", method, path, resp.StatusCode, data)
+		}
+		return apiError
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (g *GateIO) loadContracts(ctx context.Context) error {
+	g.assetsInfo = make(map[string]model.AssetInfo)
+	g.contracts = make(map[string]gateioContract)
+	g.pairs = make(map[string]string)
+
+	add := func(name string, info model.AssetInfo, multiplier float64) {
+		info.BaseAssetPrecision = getDecimalPrecision(info.StepSize)
+		info.QuotePrecision = getDecimalPrecision(info.TickSize)
+		info.PricePrecision = info.QuotePrecision
+		info.MinPrice = info.TickSize
+		info.MaxPrice = math.MaxFloat64
+
+		pair := info.BaseAsset + info.QuoteAsset
+		g.assetsInfo[pair] = info
+		g.contracts[pair] = gateioContract{name: name, multiplier: multiplier}
+		g.pairs[name] = pair
+		RegisterPair(pair, info.BaseAsset, info.QuoteAsset)
+	}
+
+	if g.Futures {
+		var contracts []struct {
+			Name             string     `json:"name"`
+			QuantoMultiplier gateNumber `json:"quanto_multiplier"`
+			OrderSizeMin     gateNumber `json:"order_size_min"`
+			OrderSizeMax     gateNumber `json:"order_size_max"`
+			OrderPriceRound  gateNumber `json:"order_price_round"`
+			InDelisting      bool       `json:"in_delisting"`
+		}
+		if err := g.request(ctx, http.MethodGet, "/futures/usdt/contracts", nil, nil, false, &contracts); err != nil {
+			return err
+		}
+
+		for _, contract := range contracts {
+			parts := strings.Split(contract.Name, "_")
+			if len(parts) != 2 || contract.InDelisting {
+				continue
+			}
+
+			multiplier := float64(contract.QuantoMultiplier)
+			if multiplier <= 0 {
+				multiplier = 1
+			}
+			add(contract.Name, model.AssetInfo{
+				BaseAsset:   parts[0],
+				QuoteAsset:  parts[1],
+				StepSize:    multiplier,
+				MinQuantity: float64(contract.OrderSizeMin) * multiplier,
+				MaxQuantity: float64(contract.OrderSizeMax) * multiplier,
+				TickSize:    float64(contract.OrderPriceRound),
+			}, multiplier)
+		}
+		return nil
+	}
+
+	var pairs []struct {
+		ID              string     `json:"id"`
+		Base            string     `json:"base"`
+		Quote           string     `json:"quote"`
+		MinBaseAmount   gateNumber `json:"min_base_amount"`
+		MaxBaseAmount   gateNumber `json:"max_base_amount"`
+		AmountPrecision int        `json:"amount_precision"`
+		Precision       int        `json:"precision"`
+		TradeStatus     string     `json:"trade_status"`
+	}
+	if err := g.request(ctx, http.MethodGet, "/spot/currency_pairs", nil, nil, false, &pairs); err != nil {
+		return err
+	}
+
+	for _, pair := range pairs {
+		if pair.TradeStatus == "untradable" {
+			continue
+		}
+
+		info := model.AssetInfo{
+			BaseAsset:   pair.Base,
+			QuoteAsset:  pair.Quote,
+			StepSize:    math.Pow10(-pair.AmountPrecision),
+			TickSize:    math.Pow10(-pair.Precision),
+			MinQuantity: float64(pair.MinBaseAmount),
+			MaxQuantity: float64(pair.MaxBaseAmount),
+		}
+		if info.MaxQuantity == 0 {
+			info.MaxQuantity = math.MaxFloat64
+		}
+		add(pair.ID, info, 1)
+	}
+	return nil
+}
+
+// name returns the Gate.io currency pair or contract of a pair, eg: BTCUSDT => BTC_USDT
+func (g *GateIO) name(pair string) string {
+	if contract, ok := g.contracts[pair]; ok {
+		return contract.name
+	}
+
+	asset, quote := SplitAssetQuote(pair)
+	return asset + "_" + quote
+}
+
+// pair returns the ninjabot pair of a Gate.io currency pair or contract, eg: BTC_USDT => BTCUSDT
+func (g *GateIO) pair(name string) string {
+	if pair, ok := g.pairs[name]; ok {
+		return pair
+	}
+	return strings.ReplaceAll(name, "_", "")
+}
+
+func (g *GateIO) multiplier(pair string) float64 {
+	if contract, ok := g.contracts[pair]; ok {
+		return contract.multiplier
+	}
+	return 1
+}
+
+// prefix returns the path prefix of the market endpoints
+func (g *GateIO) prefix() string {
+	if g.Futures {
+		return "/futures/usdt"
+	}
+	return "/spot"
+}
+
+// market returns the query of the pair in the market endpoints
+func (g *GateIO) market(pair string) map[string]interface{} {
+	if g.Futures {
+		return map[string]interface{}{"contract": g.name(pair)}
+	}
+	return map[string]interface{}{"currency_pair": g.name(pair)}
+}
+
+func (g *GateIO) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var tickers []struct {
+		Last gateNumber `json:"last"`
+	}
+	err := g.request(ctx, http.MethodGet, g.prefix()+"/tickers", g.market(pair), nil, false, &tickers)
+	if err != nil {
+		return 0, err
+	}
+	if len(tickers) == 0 {
+		return 0, ErrInvalidAsset
+	}
+	return float64(tickers[0].Last), nil
+}
+
+func (g *GateIO) AssetsInfo(pair string) model.AssetInfo {
+	return g.assetsInfo[pair]
+}
+
+func (g *GateIO) validate(pair string, quantity float64) error {
+	info, ok := g.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (g *GateIO) formatPrice(pair string, value float64) string {
+	return formatStep(value, g.assetsInfo[pair].TickSize)
+}
+
+func (g *GateIO) formatQuantity(pair string, value float64) string {
+	return formatStep(value, g.assetsInfo[pair].StepSize)
+}
+
+func (g *GateIO) formatQuote(pair string, value float64) string {
+	return strconv.FormatFloat(value, 'f', g.assetsInfo[pair].QuotePrecision, 64)
+}
+
+// size returns the signed number of contracts of a futures order, negative for sells
+func (g *GateIO) size(side model.SideType, pair string, quantity float64) int64 {
+	size := int64(math.Floor(quantity/g.multiplier(pair) + 1e-9))
+	if side == model.SideTypeSell {
+		return -size
+	}
+	return size
+}
+
+// gateioText returns the custom ID of an order with a client order ID, Gate.io custom IDs start with t- and
+// are limited to 28 characters after it
+func gateioText(clientOrderID string) string {
+	return "t-" + strconv.FormatInt(clientOrderNumber(clientOrderID), 10)
+}
+
+// createOrder places a spot or futures order, with the custom ID of the client order ID when it is given,
+// and returns its state
+func (g *GateIO) createOrder(side model.SideType, pair string, quantity float64, price float64,
+	reduceOnly bool, clientOrderID string) (model.Order, error) {
+
+	if err := g.validate(pair, quantity); err != nil {
+		return model.Order{}, err
+	}
+
+	if g.Futures {
+		body := map[string]interface{}{
+			"contract":    g.name(pair),
+			"size":        g.size(side, pair, quantity),
+			"price":       "0",
+			"tif":         "ioc",
+			"reduce_only": reduceOnly,
+		}
+		if price > 0 {
+			body["price"], body["tif"] = g.formatPrice(pair, price), "gtc"
+		}
+		if clientOrderID != "" {
+			body["text"] = gateioText(clientOrderID)
+		}
+
+		var order gateioFuturesOrder
+		if err := g.request(g.ctx, http.MethodPost, "/futures/usdt/orders", nil, body, true, &order); err != nil {
+			return model.Order{}, err
+		}
+		return g.futuresOrder(order), nil
+	}
+
+	body := map[string]interface{}{
+		"currency_pair": g.name(pair),
+		"side":          strings.ToLower(string(side)),
+		"type":          "limit",
+		"account":       "spot",
+		"amount":        g.formatQuantity(pair, quantity),
+		"time_in_force": "gtc",
+	}
+	if price > 0 {
+		body["price"] = g.formatPrice(pair, price)
+	} else {
+		body["type"], body["time_in_force"] = "market", "ioc"
+		if side == model.SideTypeBuy {
+			// spot market buys are sized in the quote currency
+			last, err := g.LastQuote(g.ctx, pair)
+			if err != nil {
+				return model.Order{}, err
+			}
+			body["amount"] = g.formatQuote(pair, quantity*last)
+		}
+	}
+	if clientOrderID != "" {
+		body["text"] = gateioText(clientOrderID)
+	}
+
+	var order gateioSpotOrder
+	if err := g.request(g.ctx, http.MethodPost, "/spot/orders", nil, body, true, &order); err != nil {
+		return model.Order{}, err
+	}
+	return g.spotOrder(order), nil
+}
+
+// createPriceOrder places a price-triggered order, a market order when the price is zero and, for
+// futures, an order closing the whole position when the quantity is zero
+func (g *GateIO) createPriceOrder(side model.SideType, pair string, quantity, trigger, price float64,
+	rising bool) (model.Order, error) {
+
+	if quantity > 0 || !g.Futures {
+		if err := g.validate(pair, quantity); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	var body interface{}
+	if g.Futures {
+		rule := 2
+		if rising {
+			rule = 1
+		}
+
+		initial := map[string]interface{}{
+			"contract":    g.name(pair),
+			"size":        g.size(side, pair, quantity),
+			"price":       "0",
+			"tif":         "ioc",
+			"reduce_only": quantity == 0,
+		}
+		if quantity == 0 {
+			initial["close"] = true
+		}
+		if price > 0 {
+			initial["price"], initial["tif"] = g.formatPrice(pair, price), "gtc"
+		}
+		body = map[string]interface{}{
+			"initial": initial,
+			"trigger": map[string]interface{}{
+				"strategy_type": 0,
+				"price_type":    0,
+				"price":         g.formatPrice(pair, trigger),
+				"rule":          rule,
+			},
+		}
+	} else {
+		rule := "<="
+		if rising {
+			rule = ">="
+		}
+
+		put := map[string]interface{}{
+			"type":          "limit",
+			"side":          strings.ToLower(string(side)),
+			"price":         g.formatPrice(pair, price),
+			"amount":        g.formatQuantity(pair, quantity),
+			"account":       "normal",
+			"time_in_force": "gtc",
+		}
+		if price == 0 {
+			put["type"], put["price"], put["time_in_force"] = "market", g.formatPrice(pair, trigger), "ioc"
+			if side == model.SideTypeBuy {
+				// spot market buys are sized in the quote currency
+				put["amount"] = g.formatQuote(pair, quantity*trigger)
+			}
+		}
+		body = map[string]interface{}{
+			"market": g.name(pair),
+			"put":    put,
+			"trigger": map[string]interface{}{
+				"price":      g.formatPrice(pair, trigger),
+				"rule":       rule,
+				"expiration": gateioTriggerExpiration,
+			},
+		}
+	}
+
+	var result struct {
+		ID int64 `json:"id"`
+	}
+	if err := g.request(g.ctx, http.MethodPost, g.prefix()+"/price_orders", nil, body, true, &result); err != nil {
+		return model.Order{}, err
+	}
+	return g.priceOrder(pair, result.ID)
+}
+
+func (g *GateIO) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: gateio oco", ErrUnsupportedOrder)
+}
+
+func (g *GateIO) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+
+	return g.createOrder(side, pair, quantity, limit, false, "")
+}
+
+// CreateOrderMarket places a market order, spot market buys are converted to the quote currency with the
+// last price
+func (g *GateIO) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+
+	return g.createOrder(side, pair, quantity, 0, reduceOnly, "")
+}
+
+func (g *GateIO) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	return g.createOrderMarketQuote(side, pair, quote, "")
+}
+
+func (g *GateIO) createOrderMarketQuote(side model.SideType, pair string, quote float64,
+	clientOrderID string) (model.Order, error) {
+	if g.Futures {
+		return model.Order{}, fmt.Errorf("%w: gateio futures market order by quote", ErrUnsupportedOrder)
+	}
+
+	if _, ok := g.assetsInfo[pair]; !ok {
+		return model.Order{}, ErrInvalidAsset
+	}
+
+	amount := g.formatQuote(pair, quote)
+	if side == model.SideTypeSell {
+		// spot market sells are sized in the base currency
+		last, err := g.LastQuote(g.ctx, pair)
+		if err != nil {
+			return model.Order{}, err
+		}
+		amount = g.formatQuantity(pair, quote/last)
+	}
+
+	body := map[string]interface{}{
+		"currency_pair": g.name(pair),
+		"side":          strings.ToLower(string(side)),
+		"type":          "market",
+		"account":       "spot",
+		"amount":        amount,
+		"time_in_force": "ioc",
+	}
+	if clientOrderID != "" {
+		body["text"] = gateioText(clientOrderID)
+	}
+
+	var order gateioSpotOrder
+	if err := g.request(g.ctx, http.MethodPost, "/spot/orders", nil, body, true, &order); err != nil {
+		return model.Order{}, err
+	}
+	return g.spotOrder(order), nil
+}
+
+// CreateOrderStop places a price-triggered market order. As in BinanceFuture, a negative limit creates a buy
+// stop, and a zero quantity closes the whole futures position.
+func (g *GateIO) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	if limit < 0 {
+		return g.createPriceOrder(model.SideTypeBuy, pair, quantity, -limit, 0, true)
+	}
+	return g.createPriceOrder(model.SideTypeSell, pair, quantity, limit, 0, false)
+}
+
+// TakeProfit places a price-triggered order at the limit price, a limit order for a given quantity or a
+// market order closing the whole futures position when the quantity is zero
+func (g *GateIO) TakeProfit(side model.SideType, pair string, quantity float64, limit float64) (model.Order, error) {
+	price := limit
+	if quantity == 0 {
+		price = 0
+	}
+	return g.createPriceOrder(side, pair, quantity, limit, price, side == model.SideTypeSell)
+}
+
+// CreateOrderRequest places an order with the client order ID of the request, sent as the custom ID of the
+// order. Gate.io price-triggered orders have no custom IDs, so stops and take profits are placed without it.
+func (g *GateIO) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: gateio time in force %s", ErrUnsupportedOrder, request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: gateio iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = g.createOrder(request.Side, request.Pair, request.Quantity, request.Price, false,
+			request.ClientOrderID)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			order, err = g.createOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity,
+				request.ClientOrderID)
+		} else {
+			order, err = g.createOrder(request.Side, request.Pair, request.Quantity, 0, request.ReduceOnly,
+				request.ClientOrderID)
+		}
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit, model.OrderTypeTakeProfit,
+		model.OrderTypeTakeProfitLimit:
+		return placeRequest(g, request)
+	default:
+		return model.Order{}, fmt.Errorf("%w: gateio %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns a regular order by its client order ID, or ErrOrderNotFound
+func (g *GateIO) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	path := g.prefix() + "/orders/" + gateioText(clientOrderID)
+
+	var (
+		order model.Order
+		err   error
+	)
+	if g.Futures {
+		var result gateioFuturesOrder
+		if err = g.request(g.ctx, http.MethodGet, path, nil, nil, true, &result); err == nil {
+			order = g.futuresOrder(result)
+		}
+	} else {
+		var result gateioSpotOrder
+		if err = g.request(g.ctx, http.MethodGet, path, g.market(pair), nil, true, &result); err == nil {
+			order = g.spotOrder(result)
+		}
+	}
+
+	var apiError *GateIOError
+	if errors.As(err, &apiError) && apiError.Label == gateioErrOrderNotFound {
+		return model.Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, clientOrderID)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = clientOrderID
+	return order, nil
+}
+
+func isGateIOPriceOrder(order model.Order) bool {
+	return order.Stop != nil
+}
+
+func (g *GateIO) Cancel(order model.Order) error {
+	id := strconv.FormatInt(order.ExchangeID, 10)
+	if isGateIOPriceOrder(order) {
+		return g.request(g.ctx, http.MethodDelete, g.prefix()+"/price_orders/"+id, nil, nil, true, nil)
+	}
+
+	var query map[string]interface{}
+	if !g.Futures {
+		query = g.market(order.Pair)
+	}
+	return g.request(g.ctx, http.MethodDelete, g.prefix()+"/orders/"+id, query, nil, true, nil)
+}
+
+func (g *GateIO) CancelOpenOrders(pair string) error {
+	if err := g.request(g.ctx, http.MethodDelete, g.prefix()+"/orders", g.market(pair), nil, true, nil); err != nil {
+		return err
+	}
+	return g.request(g.ctx, http.MethodDelete, g.prefix()+"/price_orders", g.priceMarket(pair), nil, true, nil)
+}
+
+// priceMarket returns the query of the pair in the price-triggered order endpoints
+func (g *GateIO) priceMarket(pair string) map[string]interface{} {
+	if g.Futures {
+		return g.market(pair)
+	}
+	return map[string]interface{}{"market": g.name(pair), "account": "normal"}
+}
+
+func (g *GateIO) OpenOrders(pair string) ([]model.Order, error) {
+	query := g.market(pair)
+	query["status"] = "open"
+	query["limit"] = 100
+
+	orders := make([]model.Order, 0)
+	if g.Futures {
+		var result []gateioFuturesOrder
+		err := g.request(g.ctx, http.MethodGet, "/futures/usdt/orders", query, nil, true, &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, order := range result {
+			orders = append(orders, g.futuresOrder(order))
+		}
+
+		var prices []gateioFuturesPriceOrder
+		err = g.request(g.ctx, http.MethodGet, "/futures/usdt/price_orders", query, nil, true, &prices)
+		if err != nil {
+			return nil, err
+		}
+		for _, order := range prices {
+			orders = append(orders, g.futuresPriceOrder(order))
+		}
+		return orders, nil
+	}
+
+	var result []gateioSpotOrder
+	if err := g.request(g.ctx, http.MethodGet, "/spot/orders", query, nil, true, &result); err != nil {
+		return nil, err
+	}
+	for _, order := range result {
+		orders = append(orders, g.spotOrder(order))
+	}
+
+	query = g.priceMarket(pair)
+	query["status"] = "open"
+	var prices []gateioSpotPriceOrder
+	if err := g.request(g.ctx, http.MethodGet, "/spot/price_orders", query, nil, true, &prices); err != nil {
+		return nil, err
+	}
+	for _, order := range prices {
+		orders = append(orders, g.spotPriceOrder(order))
+	}
+	return orders, nil
+}
+
+// Order returns a regular order by its id, or a price-triggered order by its id
+func (g *GateIO) Order(pair string, id int64) (model.Order, error) {
+	path := g.prefix() + "/orders/" + strconv.FormatInt(id, 10)
+
+	var err error
+	if g.Futures {
+		var order gateioFuturesOrder
+		if err = g.request(g.ctx, http.MethodGet, path, nil, nil, true, &order); err == nil {
+			return g.futuresOrder(order), nil
+		}
+	} else {
+		var order gateioSpotOrder
+		if err = g.request(g.ctx, http.MethodGet, path, g.market(pair), nil, true, &order); err == nil {
+			return g.spotOrder(order), nil
+		}
+	}
+
+	var apiError *GateIOError
+	if !errors.As(err, &apiError) || apiError.Label != gateioErrOrderNotFound {
+		return model.Order{}, err
+	}
+	return g.priceOrder(pair, id)
+}
+
+func (g *GateIO) priceOrder(pair string, id int64) (model.Order, error) {
+	path := g.prefix() + "/price_orders/" + strconv.FormatInt(id, 10)
+	if g.Futures {
+		var order gateioFuturesPriceOrder
+		if err := g.request(g.ctx, http.MethodGet, path, nil, nil, true, &order); err != nil {
+			return model.Order{}, err
+		}
+		return g.futuresPriceOrder(order), nil
+	}
+
+	var order gateioSpotPriceOrder
+	if err := g.request(g.ctx, http.MethodGet, path, nil, nil, true, &order); err != nil {
+		return model.Order{}, err
+	}
+	if order.Market == "" {
+		order.Market = g.name(pair)
+	}
+	return g.spotPriceOrder(order), nil
+}
+
+type gateioSpotOrder struct {
+	ID           string     `json:"id"`
+	Text         string     `json:"text"`
+	CurrencyPair string     `json:"currency_pair"`
+	Type         string     `json:"type"`
+	Side         string     `json:"side"`
+	Amount       gateNumber `json:"amount"`
+	Price        gateNumber `json:"price"`
+	Left         gateNumber `json:"left"`
+	FilledTotal  gateNumber `json:"filled_total"`
+	AvgDealPrice gateNumber `json:"avg_deal_price"`
+	Status       string     `json:"status"`
+	Event        string     `json:"event"`
+	FinishAs     string     `json:"finish_as"`
+	CreateTimeMs gateNumber `json:"create_time_ms"`
+	UpdateTimeMs gateNumber `json:"update_time_ms"`
+}
+
+type gateioFuturesOrder struct {
+	ID           int64      `json:"id"`
+	Text         string     `json:"text"`
+	Contract     string     `json:"contract"`
+	Size         gateNumber `json:"size"`
+	Left         gateNumber `json:"left"`
+	Price        gateNumber `json:"price"`
+	FillPrice    gateNumber `json:"fill_price"`
+	Status       string     `json:"status"`
+	FinishAs     string     `json:"finish_as"`
+	CreateTime   gateNumber `json:"create_time"`
+	FinishTime   gateNumber `json:"finish_time"`
+	IsReduceOnly bool       `json:"is_reduce_only"`
+}
+
+type gateioSpotPriceOrder struct {
+	ID      int64      `json:"id"`
+	Market  string     `json:"market"`
+	Status  string     `json:"status"`
+	Ctime   gateNumber `json:"ctime"`
+	Ftime   gateNumber `json:"ftime"`
+	Trigger struct {
+		Price gateNumber `json:"price"`
+		Rule  string     `json:"rule"`
+	} `json:"trigger"`
+	Put struct {
+		Type   string     `json:"type"`
+		Side   string     `json:"side"`
+		Price  gateNumber `json:"price"`
+		Amount gateNumber `json:"amount"`
+	} `json:"put"`
+}
+
+type gateioFuturesPriceOrder struct {
+	ID         int64      `json:"id"`
+	Status     string     `json:"status"`
+	FinishAs   string     `json:"finish_as"`
+	CreateTime gateNumber `json:"create_time"`
+	FinishTime gateNumber `json:"finish_time"`
+	Initial    struct {
+		Contract string     `json:"contract"`
+		Size     gateNumber `json:"size"`
+		Price    gateNumber `json:"price"`
+	} `json:"initial"`
+	Trigger struct {
+		Price gateNumber `json:"price"`
+		Rule  int        `json:"rule"`
+	} `json:"trigger"`
+}
+
+func gateioSeconds(value gateNumber) time.Time {
+	return time.Unix(0, int64(float64(value)*float64(time.Second)))
+}
+
+func gateioMilliseconds(value gateNumber) time.Time {
+	return time.Unix(0, int64(value)*int64(time.Millisecond))
+}
+
+func (g *GateIO) spotOrder(order gateioSpotOrder) model.Order {
+	id, _ := strconv.ParseInt(order.ID, 10, 64)
+	result := model.Order{
+		ExchangeID: id,
+		Pair:       g.pair(order.CurrencyPair),
+		Side:       model.SideType(strings.ToUpper(order.Side)),
+		Type:       model.OrderTypeLimit,
+		Price:      float64(order.Price),
+		Quantity:   float64(order.Amount),
+		CreatedAt:  gateioMilliseconds(order.CreateTimeMs),
+		UpdatedAt:  gateioMilliseconds(order.UpdateTimeMs),
+	}
+	if order.Type == "market" {
+		result.Type = model.OrderTypeMarket
+	}
+
+	// the amount of market buys is in the quote currency, the filled quantity is given by the average price
+	var filled float64
+	if order.AvgDealPrice > 0 {
+		filled = float64(order.FilledTotal / order.AvgDealPrice)
+		result.Price = float64(order.AvgDealPrice)
+	}
+
+	// streamed orders have an event instead of the status
+	status := order.Status
+	if status == "" {
+		status = "open"
+		if order.Event == "finish" {
+			status = "cancelled"
+			if order.FinishAs == "filled" || (order.FinishAs == "ioc" && filled > 0) {
+				status = "closed"
+			}
+		}
+	}
+
+	switch {
+	case status == "closed":
+		result.Status = model.OrderStatusTypeFilled
+		result.Quantity = filled
+	case status == "cancelled":
+		result.Status = model.OrderStatusTypeCanceled
+	case filled > 0:
+		result.Status = model.OrderStatusTypePartiallyFilled
+	default:
+		result.Status = model.OrderStatusTypeNew
+	}
+	return result
+}
+
+func (g *GateIO) futuresOrder(order gateioFuturesOrder) model.Order {
+	pair := g.pair(order.Contract)
+	multiplier := g.multiplier(pair)
+	size := math.Abs(float64(order.Size))
+	filled := size - math.Abs(float64(order.Left))
+
+	result := model.Order{
+		ExchangeID: order.ID,
+		Pair:       pair,
+		Side:       model.SideTypeBuy,
+		Type:       model.OrderTypeLimit,
+		Price:      float64(order.Price),
+		Quantity:   size * multiplier,
+		CreatedAt:  gateioSeconds(order.CreateTime),
+		UpdatedAt:  gateioSeconds(order.CreateTime),
+	}
+	if order.FinishTime > 0 {
+		result.UpdatedAt = gateioSeconds(order.FinishTime)
+	}
+	if order.Size < 0 {
+		result.Side = model.SideTypeSell
+	}
+	if order.Price == 0 {
+		result.Type = model.OrderTypeMarket
+	}
+	if filled > 0 && order.FillPrice > 0 {
+		result.Price = float64(order.FillPrice)
+	}
+
+	switch {
+	case order.Status == "finished" && filled > 0 && (order.FinishAs == "filled" || order.FinishAs == "ioc"):
+		result.Status = model.OrderStatusTypeFilled
+		result.Quantity = filled * multiplier
+	case order.Status == "finished":
+		result.Status = model.OrderStatusTypeCanceled
+	case filled > 0:
+		result.Status = model.OrderStatusTypePartiallyFilled
+	default:
+		result.Status = model.OrderStatusTypeNew
+	}
+	return result
+}
+
+// gateioPriceOrderType returns the type of a price-triggered order, by the trigger direction and the side
+func gateioPriceOrderType(side model.SideType, rising, limit bool) model.OrderType {
+	takeProfit := rising == (side == model.SideTypeSell)
+	switch {
+	case takeProfit && limit:
+		return model.OrderTypeTakeProfitLimit
+	case takeProfit:
+		return model.OrderTypeTakeProfit
+	case limit:
+		return model.OrderTypeStopLossLimit
+	}
+	return model.OrderTypeStopLoss
+}
+
+func (g *GateIO) spotPriceOrder(order gateioSpotPriceOrder) model.Order {
+	side := model.SideType(strings.ToUpper(order.Put.Side))
+	limit := order.Put.Type != "market"
+	stop := float64(order.Trigger.Price)
+
+	result := model.Order{
+		ExchangeID: order.ID,
+		Pair:       g.pair(order.Market),
+		Side:       side,
+		Type:       gateioPriceOrderType(side, order.Trigger.Rule == ">=", limit),
+		Price:      stop,
+		Quantity:   float64(order.Put.Amount),
+		Stop:       &stop,
+		CreatedAt:  gateioSeconds(order.Ctime),
+		UpdatedAt:  gateioSeconds(order.Ctime),
+	}
+	if limit {
+		result.Price = float64(order.Put.Price)
+	}
+	if !limit && side == model.SideTypeBuy && stop > 0 {
+		// market buys are sized in the quote currency
+		result.Quantity /= stop
+	}
+	if order.Ftime > 0 {
+		result.UpdatedAt = gateioSeconds(order.Ftime)
+	}
+
+	// triggered orders are executed as regular orders
+	switch order.Status {
+	case "finish":
+		result.Status = model.OrderStatusTypeFilled
+	case "cancelled":
+		result.Status = model.OrderStatusTypeCanceled
+	case "failed":
+		result.Status = model.OrderStatusTypeRejected
+	case "expired":
+		result.Status = model.OrderStatusTypeExpired
+	default:
+		result.Status = model.OrderStatusTypeNew
+	}
+	return result
+}
+
+func (g *GateIO) futuresPriceOrder(order gateioFuturesPriceOrder) model.Order {
+	pair := g.pair(order.Initial.Contract)
+	side := model.SideTypeBuy
+	rising := order.Trigger.Rule == 1
+	if order.Initial.Size < 0 || (order.Initial.Size == 0 && !rising) {
+		// orders closing the whole position have no size, a falling trigger closes a long position
+		side = model.SideTypeSell
+	}
+	stop := float64(order.Trigger.Price)
+
+	result := model.Order{
+		ExchangeID: order.ID,
+		Pair:       pair,
+		Side:       side,
+		Type:       gateioPriceOrderType(side, rising, order.Initial.Price > 0),
+		Price:      stop,
+		Quantity:   math.Abs(float64(order.Initial.Size)) * g.multiplier(pair),
+		Stop:       &stop,
+		CreatedAt:  gateioSeconds(order.CreateTime),
+		UpdatedAt:  gateioSeconds(order.CreateTime),
+	}
+	if order.Initial.Price > 0 {
+		result.Price = float64(order.Initial.Price)
+	}
+	if order.FinishTime > 0 {
+		result.UpdatedAt = gateioSeconds(order.FinishTime)
+	}
+
+	// triggered orders are executed as regular orders
+	switch {
+	case order.Status == "open":
+		result.Status = model.OrderStatusTypeNew
+	case order.FinishAs == "succeeded":
+		result.Status = model.OrderStatusTypeFilled
+	case order.FinishAs == "cancelled":
+		result.Status = model.OrderStatusTypeCanceled
+	case order.FinishAs == "expired":
+		result.Status = model.OrderStatusTypeExpired
+	default:
+		result.Status = model.OrderStatusTypeRejected
+	}
+	return result
+}
+
+func (g *GateIO) Account() (model.Account, error) {
+	if !g.Futures {
+		var accounts []struct {
+			Currency  string     `json:"currency"`
+			Available gateNumber `json:"available"`
+			Locked    gateNumber `json:"locked"`
+		}
+		if err := g.request(g.ctx, http.MethodGet, "/spot/accounts", nil, nil, true, &accounts); err != nil {
+			return model.Account{}, err
+		}
+
+		balances := make([]model.Balance, 0, len(accounts))
+		for _, account := range accounts {
+			if account.Available == 0 && account.Locked == 0 {
+				continue
+			}
+
+			balances = append(balances, model.Balance{
+				Asset: account.Currency,
+				Free:  float64(account.Available),
+				Lock:  float64(account.Locked),
+			})
+		}
+		return model.Account{Balances: balances}, nil
+	}
+
+	var positions []struct {
+		Contract           string     `json:"contract"`
+		Size               gateNumber `json:"size"`
+		Leverage           gateNumber `json:"leverage"`
+		CrossLeverageLimit gateNumber `json:"cross_leverage_limit"`
+	}
+	if err := g.request(g.ctx, http.MethodGet, "/futures/usdt/positions", nil, nil, true, &positions); err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0)
+	for _, position := range positions {
+		if position.Size == 0 {
+			continue
+		}
+
+		// a zero leverage is the cross margin mode
+		leverage := position.Leverage
+		if leverage == 0 {
+			leverage = position.CrossLeverageLimit
+		}
+
+		pair := g.pair(position.Contract)
+		asset, _ := SplitAssetQuote(pair)
+		balances = append(balances, model.Balance{
+			Asset:    asset,
+			Free:     float64(position.Size) * g.multiplier(pair),
+			Leverage: float64(leverage),
+		})
+	}
+
+	var account gateioFuturesAccount
+	if err := g.request(g.ctx, http.MethodGet, "/futures/usdt/accounts", nil, nil, true, &account); err != nil {
+		return model.Account{}, err
+	}
+	balances = append(balances, model.Balance{
+		Asset: account.Currency,
+		Free:  float64(account.Available),
+		Lock:  float64(account.OrderMargin + account.PositionMargin),
+	})
+
+	return model.Account{Balances: balances, Available: float64(account.Available)}, nil
+}
+
+type gateioFuturesAccount struct {
+	User           int64      `json:"user"`
+	Currency       string     `json:"currency"`
+	Available      gateNumber `json:"available"`
+	OrderMargin    gateNumber `json:"order_margin"`
+	PositionMargin gateNumber `json:"position_margin"`
+}
+
+func (g *GateIO) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	acc, err := g.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+	if g.Futures {
+		return assetBalance.Free + assetBalance.Lock, quoteBalance.Free, nil
+	}
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
+
+// PositionRisk returns the size of the position, GateIO does not provide position details
+func (g *GateIO) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(g, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, GateIO does not support amending orders
+func (g *GateIO) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(g, order, price, quantity)
+}
+
+// gateioInterval converts a ninjabot timeframe into a Gate.io candle interval, eg: 1w => 7d
+func gateioInterval(period string) (string, error) {
+	switch period {
+	case "1m", "5m", "15m", "30m", "1h", "4h", "8h", "1d":
+		return period, nil
+	case "1w":
+		return "7d", nil
+	}
+	return "", fmt.Errorf("invalid gateio interval %s", period)
+}
+
+// gateioCandle is a candle of the futures API and the websocket API: start time, volume, close, high, low,
+// open and, for spot, the base currency volume
+type gateioCandle struct {
+	T gateNumber `json:"t"`
+	V gateNumber `json:"v"`
+	C gateNumber `json:"c"`
+	H gateNumber `json:"h"`
+	L gateNumber `json:"l"`
+	O gateNumber `json:"o"`
+	A gateNumber `json:"a"`
+}
+
+// UnmarshalJSON decodes the candles of the spot API, an array of start time, quote currency volume, close,
+// high, low, open and base currency volume, and the candle objects of the other APIs
+func (c *gateioCandle) UnmarshalJSON(data []byte) error {
+	type candle gateioCandle
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, (*candle)(c))
+	}
+
+	var row []json.RawMessage
+	if err := json.Unmarshal(data, &row); err != nil {
+		return err
+	}
+	if len(row) < 7 {
+		return fmt.Errorf("invalid gateio candle: %s", data)
+	}
+
+	for i, target := range []*gateNumber{&c.T, &c.V, &c.C, &c.H, &c.L, &c.O, &c.A} {
+		if err := json.Unmarshal(row[i], target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GateIO) candle(pair string, data gateioCandle) model.Candle {
+	t := time.Unix(int64(data.T), 0)
+	candle := model.Candle{
+		Pair:      pair,
+		Time:      t,
+		UpdatedAt: t,
+		Open:      float64(data.O),
+		Close:     float64(data.C),
+		Low:       float64(data.L),
+		High:      float64(data.H),
+		Volume:    float64(data.A),
+		Metadata:  make(map[string]float64),
+	}
+
+	// futures volumes are given in contracts
+	if g.Futures {
+		candle.Volume = float64(data.V) * g.multiplier(pair)
+	}
+	return candle
+}
+
+// candles requests candles and returns the complete ones in chronological order
+func (g *GateIO) candles(ctx context.Context, pair, period string,
+	query map[string]interface{}) ([]model.Candle, error) {
+
+	interval, err := gateioInterval(period)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range g.market(pair) {
+		query[key] = value
+	}
+	query["interval"] = interval
+
+	var data []gateioCandle
+	if err := g.request(ctx, http.MethodGet, g.prefix()+"/candlesticks", query, nil, false, &data); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	candles := make([]model.Candle, 0, len(data))
+	for _, item := range data {
+		candle := g.candle(pair, item)
+
+		// the last candle is in progress until the end of its period
+		if candle.Time.Add(duration).After(now) {
+			continue
+		}
+		candle.Complete = true
+		candles = append(candles, candle)
+	}
+
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return candles, nil
+}
+
+func (g *GateIO) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	size := limit + 1
+	if size > gateioCandleLimit {
+		size = gateioCandleLimit
+	}
+
+	candles, err := g.candles(ctx, pair, period, map[string]interface{}{"limit": size})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	if g.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// CandlesByPeriod returns the candles of a period, requested in pages of gateioCandleLimit candles
+func (g *GateIO) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0)
+	for from := start; !from.After(end); from = from.Add(gateioCandleLimit * duration) {
+		// the end time is inclusive
+		to := from.Add((gateioCandleLimit - 1) * duration)
+		if to.After(end) {
+			to = end
+		}
+
+		data, err := g.candles(ctx, pair, period, map[string]interface{}{
+			"from": from.Unix(),
+			"to":   to.Unix(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, data...)
+	}
+
+	if g.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// gateioEvent is a message of the websocket API
+type gateioEvent struct {
+	Channel string `json:"channel"`
+	Event   string `json:"event"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+// channel returns the websocket channel of the market, eg: spot.candlesticks
+func (g *GateIO) channel(name string) string {
+	if g.Futures {
+		return "futures." + name
+	}
+	return "spot." + name
+}
+
+// stream subscribes to a websocket channel and sends its updates to the handler, it reconnects until the
+// context is done. Private channels are authenticated with the signature of the subscription.
+func (g *GateIO) stream(ctx context.Context, channel string, payload []interface{}, private bool,
+	handler func(result json.RawMessage), cerr chan error) {
+
+	ba := &backoff.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 5 * time.Second,
+	}
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	for {
+		now := time.Now().Unix()
+		subscribe := map[string]interface{}{
+			"time":    now,
+			"channel": channel,
+			"event":   "subscribe",
+			"payload": payload,
+		}
+		if private {
+			subscribe["auth"] = map[string]string{
+				"method": "api_key",
+				"KEY":    g.APIKey,
+				"SIGN":   g.sign(fmt.Sprintf("channel=%s&event=subscribe&time=%d", channel, now)),
+			}
+		}
+		ping := map[string]interface{}{"time": now, "channel": g.channel("ping")}
+
+		done, stop, err := wsServeJSON(g.StreamEndpoint, []interface{}{subscribe}, ping, func(message []byte) {
+			var event gateioEvent
+			if err := json.Unmarshal(message, &event); err != nil || event.Channel != channel {
+				return
+			}
+
+			if event.Error != nil {
+				sendErr(&GateIOError{Label: strconv.Itoa(event.Error.Code), Message: event.Error.Message})
+				return
+			}
+
+			if event.Event == "update" {
+				ba.Reset()
+				handler(event.Result)
+			}
+		}, sendErr)
+		if err != nil {
+			sendErr(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ba.Duration()):
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// wait for the stream handlers before closing the channels
+			close(stop)
+			<-done
+			return
+		case <-done:
+			time.Sleep(ba.Duration())
+		}
+	}
+}
+
+// CandlesSubscription streams the candles of a pair. Gate.io sends the current candle on each trade, so the
+// previous candle is complete when a trade of the next period happens.
+func (g *GateIO) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		defer close(cerr)
+		defer close(ccandle)
+
+		interval, err := gateioInterval(period)
+		if err != nil {
+			cerr <- err
+			return
+		}
+
+		var last *model.Candle
+		payload := []interface{}{interval, g.name(pair)}
+		g.stream(ctx, g.channel("candlesticks"), payload, false, func(result json.RawMessage) {
+			// spot updates are a single candle and futures updates a list of candles
+			var data []gateioCandle
+			if bytes.HasPrefix(bytes.TrimSpace(result), []byte("{")) {
+				result = append(append([]byte("["), result...), ']')
+			}
+			if err := json.Unmarshal(result, &data); err != nil {
+				log.Warn(err)
+				return
+			}
+
+			for _, item := range data {
+				candle := g.candle(pair, item)
+				candle.UpdatedAt = time.Now()
+
+				candles := []model.Candle{candle}
+				if last != nil && candle.Time.After(last.Time) {
+					complete := *last
+					complete.Complete = true
+					if g.HeikinAshi {
+						complete = complete.ToHeikinAshi(ha)
+					}
+					// fetch aditional data if needed
+					fetchMetadata(ctx, g.MetadataFetchers, g.MetadataTimeout, &g.metadataKeys, &complete)
+					candles = []model.Candle{complete, candle}
+				}
+				if last == nil || !candle.Time.Before(last.Time) {
+					last = &candle
+				}
+
+				for _, candle := range candles {
+					select {
+					case ccandle <- candle:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}, cerr)
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (g *GateIO) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("gate.io")
+}
+
+// AccountSubscription streams the updates of regular orders, it reconnects until the context is done.
+// Price-triggered orders are not streamed and are updated by polling.
+func (g *GateIO) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cerr)
+		defer close(corder)
+
+		payload := []interface{}{"!all"}
+		if g.Futures {
+			// the futures channel is subscribed by user id
+			var account gateioFuturesAccount
+			err := g.request(ctx, http.MethodGet, "/futures/usdt/accounts", nil, nil, true, &account)
+			if err != nil {
+				cerr <- err
+				return
+			}
+			payload = []interface{}{strconv.FormatInt(account.User, 10), "!all"}
+		}
+
+		g.stream(ctx, g.channel("orders"), payload, true, func(result json.RawMessage) {
+			orders := make([]model.Order, 0)
+			if g.Futures {
+				var data []gateioFuturesOrder
+				if err := json.Unmarshal(result, &data); err != nil {
+					log.Warn(err)
+					return
+				}
+				for _, order := range data {
+					orders = append(orders, g.futuresOrder(order))
+				}
+			} else {
+				var data []gateioSpotOrder
+				if err := json.Unmarshal(result, &data); err != nil {
+					log.Warn(err)
+					return
+				}
+				for _, order := range data {
+					orders = append(orders, g.spotOrder(order))
+				}
+			}
+
+			for _, order := range orders {
+				select {
+				case corder <- order:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}, cerr)
+	}()
+
+	return corder, cerr
+}
@@ -0,0 +1,763 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// gateioServer emulates the subset of the Gate.io API used by the GateIO exchange
+type gateioServer struct {
+	*httptest.Server
+	mtx           sync.Mutex
+	lastID        int64
+	spotOrders    map[int64]gateioSpotOrder
+	futureOrders  map[int64]gateioFuturesOrder
+	spotPrices    map[int64]gateioSpotPriceOrder
+	futuresPrices map[int64]gateioFuturesPriceOrder
+	bodies        []map[string]interface{}
+	queries       []map[string]string
+}
+
+func newGateIOServer(t *testing.T) *gateioServer {
+	s := &gateioServer{
+		spotOrders:    make(map[int64]gateioSpotOrder),
+		futureOrders:  make(map[int64]gateioFuturesOrder),
+		spotPrices:    make(map[int64]gateioSpotPriceOrder),
+		futuresPrices: make(map[int64]gateioFuturesPriceOrder),
+	}
+
+	reply := func(w http.ResponseWriter, result interface{}) {
+		_ = json.NewEncoder(w).Encode(result)
+	}
+	notFound := func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusNotFound)
+		reply(w, map[string]string{"label": gateioErrOrderNotFound, "message": "Order not found"})
+	}
+	id := func(r *http.Request, prefix string) int64 {
+		value, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, prefix), 10, 64)
+		return value
+	}
+	// text returns the custom id of an order path, orders are found by their id or their custom id
+	text := func(r *http.Request, prefix string) string {
+		if value := strings.TrimPrefix(r.URL.Path, prefix); strings.HasPrefix(value, "t-") {
+			return value
+		}
+		return ""
+	}
+
+	mux := http.NewServeMux()
+	handle := func(path string, handler func(w http.ResponseWriter, r *http.Request, body map[string]interface{})) {
+		mux.HandleFunc("/api/v4"+path, func(w http.ResponseWriter, r *http.Request) {
+			data, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			// verify the signature of private requests
+			hash := sha512.Sum512(data)
+			mac := hmac.New(sha512.New, []byte("secret"))
+			mac.Write([]byte(strings.Join([]string{r.Method, r.URL.Path, r.URL.RawQuery, hex.EncodeToString(hash[:]),
+				r.Header.Get("Timestamp")}, "\n")))
+			require.Equal(t, hex.EncodeToString(mac.Sum(nil)), r.Header.Get("SIGN"))
+			require.Equal(t, "key", r.Header.Get("KEY"))
+
+			body := make(map[string]interface{})
+			if len(data) > 0 {
+				require.NoError(t, json.Unmarshal(data, &body))
+			}
+			query := make(map[string]string)
+			for key := range r.URL.Query() {
+				query[key] = r.URL.Query().Get(key)
+			}
+
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			s.bodies = append(s.bodies, body)
+			s.queries = append(s.queries, query)
+			handler(w, r, body)
+		})
+	}
+
+	mux.HandleFunc("/api/v4/spot/currency_pairs", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, []map[string]interface{}{
+			{"id": "BTC_USDT", "base": "BTC", "quote": "USDT", "min_base_amount": "0.0001", "amount_precision": 4,
+				"precision": 1, "trade_status": "tradable"},
+			{"id": "OLD_USDT", "base": "OLD", "quote": "USDT", "trade_status": "untradable"},
+		})
+	})
+	mux.HandleFunc("/api/v4/futures/usdt/contracts", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, []map[string]interface{}{
+			{"name": "BTC_USDT", "quanto_multiplier": "0.0001", "order_size_min": 1, "order_size_max": 1000000,
+				"order_price_round": "0.1"},
+		})
+	})
+	for _, prefix := range []string{"/api/v4/spot", "/api/v4/futures/usdt"} {
+		mux.HandleFunc(prefix+"/tickers", func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "BTC_USDT", r.URL.Query().Get("currency_pair")+r.URL.Query().Get("contract"))
+			reply(w, []map[string]string{{"last": "100"}})
+		})
+	}
+	candles := func(w http.ResponseWriter, r *http.Request, futures bool) {
+		require.Equal(t, "1h", r.URL.Query().Get("interval"))
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+		times := []int64{start, start + 3600, time.Now().Truncate(time.Hour).Unix()}
+		if r.URL.Query().Get("from") != "" {
+			from, _ := strconv.ParseInt(r.URL.Query().Get("from"), 10, 64)
+			to, _ := strconv.ParseInt(r.URL.Query().Get("to"), 10, 64)
+			times = times[:0]
+			for t := from; t <= to && t <= start+3600; t += 3600 {
+				times = append(times, t)
+			}
+		}
+
+		result := make([]interface{}, 0)
+		for i, t := range times {
+			closing := strconv.Itoa(101 + i)
+			if futures {
+				result = append(result, map[string]interface{}{"t": t, "v": 1000 * (i + 1), "c": closing, "h": "110",
+					"l": "90", "o": "100", "sum": "1000"})
+			} else {
+				result = append(result, []string{strconv.FormatInt(t, 10), "1000", closing, "110", "90", "100",
+					fmt.Sprintf("%d.5", 10+i), "true"})
+			}
+		}
+		reply(w, result)
+	}
+	mux.HandleFunc("/api/v4/spot/candlesticks", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTC_USDT", r.URL.Query().Get("currency_pair"))
+		candles(w, r, false)
+	})
+	mux.HandleFunc("/api/v4/futures/usdt/candlesticks", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTC_USDT", r.URL.Query().Get("contract"))
+		candles(w, r, true)
+	})
+
+	handle("/spot/orders", func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		switch r.Method {
+		case http.MethodPost:
+			s.lastID++
+			order := gateioSpotOrder{ID: strconv.FormatInt(s.lastID, 10), CurrencyPair: body["currency_pair"].(string),
+				Type: body["type"].(string), Side: body["side"].(string), Status: "open", CreateTimeMs: 1640995200000}
+			if value, ok := body["text"].(string); ok {
+				order.Text = value
+			}
+			amount, _ := strconv.ParseFloat(body["amount"].(string), 64)
+			order.Amount, order.Left = gateNumber(amount), gateNumber(amount)
+			if price, ok := body["price"].(string); ok {
+				value, _ := strconv.ParseFloat(price, 64)
+				order.Price = gateNumber(value)
+			}
+			if order.Type == "market" {
+				// market buys are sized in the quote currency
+				order.Status, order.Left, order.AvgDealPrice = "closed", 0, 100
+				order.FilledTotal = order.Amount * 100
+				if order.Side == "buy" {
+					order.FilledTotal = order.Amount
+				}
+			}
+			s.spotOrders[s.lastID] = order
+			reply(w, order)
+		case http.MethodGet:
+			require.Equal(t, "open", r.URL.Query().Get("status"))
+			orders := make([]gateioSpotOrder, 0)
+			for _, order := range s.spotOrders {
+				if order.Status == "open" {
+					orders = append(orders, order)
+				}
+			}
+			reply(w, orders)
+		case http.MethodDelete:
+			for id, order := range s.spotOrders {
+				if order.Status == "open" {
+					order.Status = "cancelled"
+					s.spotOrders[id] = order
+				}
+			}
+			reply(w, []interface{}{})
+		}
+	})
+	handle("/spot/orders/", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		require.Equal(t, "BTC_USDT", r.URL.Query().Get("currency_pair"))
+		order, ok := s.spotOrders[id(r, "/api/v4/spot/orders/")]
+		for _, placed := range s.spotOrders {
+			if value := text(r, "/api/v4/spot/orders/"); value != "" && placed.Text == value {
+				order, ok = placed, true
+			}
+		}
+		if !ok {
+			notFound(w)
+			return
+		}
+		if r.Method == http.MethodDelete {
+			order.Status = "cancelled"
+			s.spotOrders[id(r, "/api/v4/spot/orders/")] = order
+		}
+		reply(w, order)
+	})
+	handle("/spot/price_orders", func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		switch r.Method {
+		case http.MethodPost:
+			data, _ := json.Marshal(body)
+			var order gateioSpotPriceOrder
+			require.NoError(t, json.Unmarshal(data, &order))
+			s.lastID++
+			order.ID, order.Status, order.Ctime = s.lastID, "open", 1640995200
+			s.spotPrices[s.lastID] = order
+			reply(w, map[string]int64{"id": s.lastID})
+		case http.MethodGet:
+			orders := make([]gateioSpotPriceOrder, 0)
+			for _, order := range s.spotPrices {
+				orders = append(orders, order)
+			}
+			reply(w, orders)
+		case http.MethodDelete:
+			require.Equal(t, "BTC_USDT", r.URL.Query().Get("market"))
+			s.spotPrices = make(map[int64]gateioSpotPriceOrder)
+			reply(w, []interface{}{})
+		}
+	})
+	handle("/spot/price_orders/", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		order, ok := s.spotPrices[id(r, "/api/v4/spot/price_orders/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			reply(w, map[string]string{"label": "AUTO_ORDER_NOT_FOUND", "message": "Order not found"})
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(s.spotPrices, order.ID)
+		}
+		reply(w, order)
+	})
+	handle("/spot/accounts", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, []map[string]string{
+			{"currency": "BTC", "available": "0.4", "locked": "0.1"},
+			{"currency": "USDT", "available": "900", "locked": "100"},
+			{"currency": "ETH", "available": "0", "locked": "0"},
+		})
+	})
+
+	handle("/futures/usdt/positions/BTC_USDT/leverage", func(w http.ResponseWriter, r *http.Request,
+		_ map[string]interface{}) {
+		require.Equal(t, http.MethodPost, r.Method)
+		reply(w, map[string]string{})
+	})
+	handle("/futures/usdt/orders", func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		switch r.Method {
+		case http.MethodPost:
+			s.lastID++
+			size := body["size"].(float64)
+			price, _ := strconv.ParseFloat(body["price"].(string), 64)
+			order := gateioFuturesOrder{ID: s.lastID, Contract: body["contract"].(string), Size: gateNumber(size),
+				Left: gateNumber(size), Price: gateNumber(price), Status: "open", CreateTime: 1640995200.5,
+				IsReduceOnly: body["reduce_only"].(bool)}
+			if value, ok := body["text"].(string); ok {
+				order.Text = value
+			}
+			if price == 0 {
+				order.Status, order.FinishAs, order.Left, order.FillPrice = "finished", "filled", 0, 100
+				order.FinishTime = 1640995201
+			}
+			s.futureOrders[s.lastID] = order
+			reply(w, order)
+		case http.MethodGet:
+			orders := make([]gateioFuturesOrder, 0)
+			for _, order := range s.futureOrders {
+				if order.Status == "open" {
+					orders = append(orders, order)
+				}
+			}
+			reply(w, orders)
+		case http.MethodDelete:
+			for id, order := range s.futureOrders {
+				if order.Status == "open" {
+					order.Status, order.FinishAs = "finished", "cancelled"
+					s.futureOrders[id] = order
+				}
+			}
+			reply(w, []interface{}{})
+		}
+	})
+	handle("/futures/usdt/orders/", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		order, ok := s.futureOrders[id(r, "/api/v4/futures/usdt/orders/")]
+		for _, placed := range s.futureOrders {
+			if value := text(r, "/api/v4/futures/usdt/orders/"); value != "" && placed.Text == value {
+				order, ok = placed, true
+			}
+		}
+		if !ok {
+			notFound(w)
+			return
+		}
+		reply(w, order)
+	})
+	handle("/futures/usdt/price_orders", func(w http.ResponseWriter, r *http.Request, body map[string]interface{}) {
+		switch r.Method {
+		case http.MethodPost:
+			data, _ := json.Marshal(body)
+			var order gateioFuturesPriceOrder
+			require.NoError(t, json.Unmarshal(data, &order))
+			s.lastID++
+			order.ID, order.Status, order.CreateTime = s.lastID, "open", 1640995200
+			s.futuresPrices[s.lastID] = order
+			reply(w, map[string]int64{"id": s.lastID})
+		case http.MethodGet:
+			orders := make([]gateioFuturesPriceOrder, 0)
+			for _, order := range s.futuresPrices {
+				orders = append(orders, order)
+			}
+			reply(w, orders)
+		case http.MethodDelete:
+			s.futuresPrices = make(map[int64]gateioFuturesPriceOrder)
+			reply(w, []interface{}{})
+		}
+	})
+	handle("/futures/usdt/price_orders/", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, s.futuresPrices[id(r, "/api/v4/futures/usdt/price_orders/")])
+	})
+	handle("/futures/usdt/positions", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, []map[string]interface{}{
+			{"contract": "BTC_USDT", "size": -5000, "leverage": "0", "cross_leverage_limit": "10"},
+			{"contract": "ETH_USDT", "size": 0, "leverage": "5"},
+		})
+	})
+	handle("/futures/usdt/accounts", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		reply(w, map[string]interface{}{"user": 42, "currency": "USDT", "available": "900", "order_margin": "60",
+			"position_margin": "40"})
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var subscribe struct {
+			Time    int64             `json:"time"`
+			Channel string            `json:"channel"`
+			Event   string            `json:"event"`
+			Payload []string          `json:"payload"`
+			Auth    map[string]string `json:"auth"`
+		}
+		require.NoError(t, conn.ReadJSON(&subscribe))
+		require.Equal(t, "subscribe", subscribe.Event)
+		_ = conn.WriteJSON(map[string]interface{}{"channel": subscribe.Channel, "event": "subscribe",
+			"result": map[string]string{"status": "success"}})
+
+		update := func(result interface{}) {
+			_ = conn.WriteJSON(map[string]interface{}{"channel": subscribe.Channel, "event": "update",
+				"result": result})
+		}
+
+		switch subscribe.Channel {
+		case "spot.candlesticks", "futures.candlesticks":
+			require.Equal(t, []string{"1h", "BTC_USDT"}, subscribe.Payload)
+			for _, candle := range []struct {
+				t     string
+				close string
+			}{
+				{"1640995200", "101"},
+				{"1640995200", "102"},
+				{"1640998800", "103"},
+			} {
+				data := map[string]interface{}{"t": candle.t, "v": "1000", "c": candle.close, "h": "110", "l": "90",
+					"o": "100", "n": "1h_BTC_USDT", "a": "10", "w": false}
+				if subscribe.Channel == "futures.candlesticks" {
+					update([]interface{}{data})
+				} else {
+					update(data)
+				}
+			}
+		case "spot.orders", "futures.orders":
+			mac := hmac.New(sha512.New, []byte("secret"))
+			mac.Write([]byte(fmt.Sprintf("channel=%s&event=subscribe&time=%d", subscribe.Channel, subscribe.Time)))
+			require.Equal(t, hex.EncodeToString(mac.Sum(nil)), subscribe.Auth["SIGN"])
+			require.Equal(t, "key", subscribe.Auth["KEY"])
+			require.Equal(t, "api_key", subscribe.Auth["method"])
+
+			if subscribe.Channel == "futures.orders" {
+				require.Equal(t, []string{"42", "!all"}, subscribe.Payload)
+				update([]map[string]interface{}{{"id": 7, "contract": "BTC_USDT", "size": -5000, "left": 0,
+					"price": "0", "fill_price": "99.5", "status": "finished", "finish_as": "filled",
+					"create_time": 1640995200, "finish_time": 1640995201}})
+				break
+			}
+
+			require.Equal(t, []string{"!all"}, subscribe.Payload)
+			order := map[string]interface{}{"id": "7", "currency_pair": "BTC_USDT", "type": "limit", "side": "sell",
+				"amount": "0.5", "price": "120", "left": "0.5", "filled_total": "0", "avg_deal_price": "0",
+				"event": "put", "finish_as": "open", "create_time_ms": "1640995200000",
+				"update_time_ms": "1640995200000"}
+			update([]interface{}{order})
+			order["event"], order["finish_as"], order["left"] = "finish", "filled", "0"
+			order["filled_total"], order["avg_deal_price"] = "60", "120"
+			update([]interface{}{order})
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+func newTestGateIO(t *testing.T, options ...GateIOOption) (*GateIO, *gateioServer) {
+	server := newGateIOServer(t)
+	options = append([]GateIOOption{
+		WithGateIOCredentials("key", "secret"),
+		WithGateIOEndpoint(server.URL+"/api/v4", "ws"+strings.TrimPrefix(server.URL, "http")+"/ws"),
+	}, options...)
+	gateio, err := NewGateIO(context.Background(), options...)
+	require.NoError(t, err)
+	return gateio, server
+}
+
+func TestGateIO_Spot(t *testing.T) {
+	t.Run("currency pairs", func(t *testing.T) {
+		gateio, _ := newTestGateIO(t)
+		info := gateio.AssetsInfo("BTCUSDT")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USDT", info.QuoteAsset)
+		require.Equal(t, 0.0001, info.MinQuantity)
+		require.Equal(t, 0.0001, info.StepSize)
+		require.Equal(t, 0.1, info.TickSize)
+		require.Equal(t, 4, info.BaseAssetPrecision)
+		require.Empty(t, gateio.AssetsInfo("OLDUSDT").BaseAsset)
+
+		require.Equal(t, "BTC_USDT", gateio.name("BTCUSDT"))
+		require.Equal(t, "BTCUSDT", gateio.pair("BTC_USDT"))
+	})
+
+	t.Run("quotes and candles", func(t *testing.T) {
+		gateio, _ := newTestGateIO(t)
+		quote, err := gateio.LastQuote(context.Background(), "BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 100.0, quote)
+
+		candles, err := gateio.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 1)
+		require.NoError(t, err)
+		require.Len(t, candles, 1)
+		require.Equal(t, 102.0, candles[0].Close)
+		require.Equal(t, 11.5, candles[0].Volume)
+		require.True(t, candles[0].Complete)
+
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		candles, err = gateio.CandlesByPeriod(context.Background(), "BTCUSDT", "1h", start, start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, start, candles[0].Time.UTC())
+		require.Equal(t, 101.0, candles[0].Close)
+		require.Equal(t, 110.0, candles[0].High)
+		require.Equal(t, 90.0, candles[0].Low)
+		require.Equal(t, 100.0, candles[0].Open)
+
+		_, err = gateio.CandlesByLimit(context.Background(), "BTCUSDT", "2h", 1)
+		require.Error(t, err)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		gateio, _ := newTestGateIO(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		candles, _ := gateio.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		require.Equal(t, 101.0, (<-candles).Close)
+		require.Equal(t, 102.0, (<-candles).Close)
+
+		candle := <-candles
+		require.True(t, candle.Complete)
+		require.Equal(t, "BTCUSDT", candle.Pair)
+		require.Equal(t, 102.0, candle.Close)
+		require.Equal(t, 10.0, candle.Volume)
+		require.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), candle.Time.UTC())
+
+		candle = <-candles
+		require.False(t, candle.Complete)
+		require.Equal(t, 103.0, candle.Close)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		gateio, server := newTestGateIO(t)
+
+		market, err := gateio.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.5, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, model.SideTypeBuy, market.Side)
+		require.Equal(t, "BTCUSDT", market.Pair)
+		require.Equal(t, 100.0, market.Price)
+		require.Equal(t, 0.5, market.Quantity)
+		// spot market buys are sized in the quote currency
+		require.Equal(t, "50.0", server.bodies[0]["amount"])
+		require.Equal(t, "ioc", server.bodies[0]["time_in_force"])
+
+		sell, err := gateio.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5, false)
+		require.NoError(t, err)
+		require.Equal(t, 0.5, sell.Quantity)
+		require.Equal(t, "0.5000", server.bodies[1]["amount"])
+
+		limit, err := gateio.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.5, 120.06)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, 120.0, limit.Price)
+
+		quote, err := gateio.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 200)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, quote.Quantity)
+
+		stop, err := gateio.CreateOrderStop("BTCUSDT", 0.5, 90)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeSell, stop.Side)
+		require.Equal(t, model.OrderStatusTypeNew, stop.Status)
+		require.Equal(t, 90.0, *stop.Stop)
+		require.Equal(t, 0.5, stop.Quantity)
+
+		takeProfit, err := gateio.TakeProfit(model.SideTypeSell, "BTCUSDT", 0.5, 150)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+		require.Equal(t, 150.0, takeProfit.Price)
+
+		_, err = gateio.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.00001, 120)
+		var orderError *OrderError
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+
+		_, err = gateio.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 1, 1, 1)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		orders, err := gateio.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 3)
+
+		order, err := gateio.Order("BTCUSDT", stop.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, order.Type)
+
+		require.NoError(t, gateio.Cancel(limit))
+		order, err = gateio.Order("BTCUSDT", limit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+
+		require.NoError(t, gateio.Cancel(stop))
+		_, err = gateio.Order("BTCUSDT", stop.ExchangeID)
+		var gateioError *GateIOError
+		require.ErrorAs(t, err, &gateioError)
+		require.Equal(t, "AUTO_ORDER_NOT_FOUND", gateioError.Label)
+
+		require.NoError(t, gateio.CancelOpenOrders("BTCUSDT"))
+		orders, err = gateio.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		gateio, server := newTestGateIO(t)
+
+		limit, err := gateio.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 120, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Equal(t, gateioText("ninjabot-1"), server.bodies[0]["text"])
+		require.LessOrEqual(t, len(gateioText("ninjabot-1")), 30)
+
+		market, err := gateio.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Type: model.OrderTypeMarket, QuoteQuantity: 200, ClientOrderID: "ninjabot-2"})
+		require.NoError(t, err)
+		require.Equal(t, 2.0, market.Quantity)
+
+		// price-triggered orders are placed without custom ids
+		stop, err := gateio.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeStopLoss, Quantity: 0.5, Stop: 90, ClientOrderID: "ninjabot-3"})
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+
+		found, err := gateio.OrderByClientID("BTCUSDT", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, limit.ExchangeID, found.ExchangeID)
+		require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+		found, err = gateio.OrderByClientID("BTCUSDT", "ninjabot-2")
+		require.NoError(t, err)
+		require.Equal(t, market.ExchangeID, found.ExchangeID)
+
+		_, err = gateio.OrderByClientID("BTCUSDT", "ninjabot-3")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		gateio, _ := newTestGateIO(t)
+		account, err := gateio.Account()
+		require.NoError(t, err)
+		require.Equal(t, []model.Balance{
+			{Asset: "BTC", Free: 0.4, Lock: 0.1},
+			{Asset: "USDT", Free: 900, Lock: 100},
+		}, account.Balances)
+
+		asset, quote, err := gateio.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.5, asset)
+		require.Equal(t, 1000.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		gateio, _ := newTestGateIO(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, _ := gateio.AccountSubscription(ctx)
+		order := <-updates
+		require.Equal(t, int64(7), order.ExchangeID)
+		require.Equal(t, "BTCUSDT", order.Pair)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, 120.0, order.Price)
+
+		order = <-updates
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 120.0, order.Price)
+		require.Equal(t, 0.5, order.Quantity)
+	})
+}
+
+func TestGateIO_Futures(t *testing.T) {
+	t.Run("leverage", func(t *testing.T) {
+		gateio, server := newTestGateIO(t, WithGateIOFutures(),
+			WithGateIOLeverage("btcusdt", 5, MarginTypeIsolated), WithGateIOLeverage("BTCUSDT", 10, MarginTypeCrossed))
+		require.True(t, gateio.Futures)
+		require.Equal(t, []map[string]string{
+			{"leverage": "5"},
+			{"leverage": "0", "cross_leverage_limit": "10"},
+		}, server.queries)
+
+		info := gateio.AssetsInfo("BTCUSDT")
+		require.Equal(t, 0.0001, info.StepSize)
+		require.Equal(t, 0.0001, info.MinQuantity)
+		require.Equal(t, 100.0, info.MaxQuantity)
+		require.Equal(t, 0.1, info.TickSize)
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		gateio, _ := newTestGateIO(t, WithGateIOFutures())
+		candles, err := gateio.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, 101.0, candles[0].Close)
+		// volumes are given in contracts
+		require.Equal(t, 0.2, candles[1].Volume)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, _ := gateio.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		candle := <-stream
+		require.Equal(t, 101.0, candle.Close)
+		require.Equal(t, 0.1, candle.Volume)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		gateio, server := newTestGateIO(t, WithGateIOFutures())
+
+		market, err := gateio.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5, true)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, model.SideTypeSell, market.Side)
+		require.Equal(t, 100.0, market.Price)
+		require.Equal(t, 0.5, market.Quantity)
+		require.Equal(t, -5000.0, server.bodies[0]["size"])
+		require.Equal(t, true, server.bodies[0]["reduce_only"])
+		require.Equal(t, "ioc", server.bodies[0]["tif"])
+
+		limit, err := gateio.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.5, 95.06)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, 95.0, limit.Price)
+		require.Equal(t, 0.5, limit.Quantity)
+
+		_, err = gateio.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 100)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		// a negative limit creates a buy stop
+		stop, err := gateio.CreateOrderStop("BTCUSDT", 0.5, -110)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeBuy, stop.Side)
+		require.Equal(t, 110.0, *stop.Stop)
+		require.Equal(t, 0.5, stop.Quantity)
+
+		// a zero quantity closes the whole position
+		closing, err := gateio.CreateOrderStop("BTCUSDT", 0, 90)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, closing.Type)
+		require.Equal(t, model.SideTypeSell, closing.Side)
+		initial := server.bodies[len(server.bodies)-2]["initial"].(map[string]interface{})
+		require.Equal(t, true, initial["close"])
+		require.Equal(t, 0.0, initial["size"])
+
+		takeProfit, err := gateio.TakeProfit(model.SideTypeBuy, "BTCUSDT", 0.5, 80)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+		require.Equal(t, 80.0, takeProfit.Price)
+
+		orders, err := gateio.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 4)
+		sort.Slice(orders, func(i, j int) bool { return orders[i].ExchangeID < orders[j].ExchangeID })
+		require.Equal(t, limit.ExchangeID, orders[0].ExchangeID)
+
+		order, err := gateio.Order("BTCUSDT", takeProfit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, order.Type)
+
+		require.NoError(t, gateio.CancelOpenOrders("BTCUSDT"))
+		orders, err = gateio.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		gateio, _ := newTestGateIO(t, WithGateIOFutures())
+		account, err := gateio.Account()
+		require.NoError(t, err)
+		require.Equal(t, []model.Balance{
+			{Asset: "BTC", Free: -0.5, Leverage: 10},
+			{Asset: "USDT", Free: 900, Lock: 100},
+		}, account.Balances)
+		require.Equal(t, 900.0, account.Available)
+
+		asset, quote, err := gateio.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+		require.Equal(t, 900.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		gateio, _ := newTestGateIO(t, WithGateIOFutures())
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, _ := gateio.AccountSubscription(ctx)
+		order := <-updates
+		require.Equal(t, int64(7), order.ExchangeID)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.SideTypeSell, order.Side)
+		require.Equal(t, 99.5, order.Price)
+		require.Equal(t, 0.5, order.Quantity)
+	})
+}
@@ -0,0 +1,1400 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	hyperliquidEndpoint              = "https://api.hyperliquid.xyz"
+	hyperliquidStreamEndpoint        = "wss://api.hyperliquid.xyz/ws"
+	hyperliquidTestnetEndpoint       = "https://api.hyperliquid-testnet.xyz"
+	hyperliquidTestnetStreamEndpoint = "wss://api.hyperliquid-testnet.xyz/ws"
+
+	// hyperliquidCandleLimit is the maximum number of candles returned by a request
+	hyperliquidCandleLimit = 5000
+
+	// hyperliquidPriceDecimals is the maximum number of decimals of perpetual prices and sizes together,
+	// prices also have at most 5 significant figures
+	hyperliquidPriceDecimals = 6
+	hyperliquidPriceFigures  = 5
+
+	// hyperliquidMarketSlippage is the worst price of market orders, which are immediate or cancel limit orders
+	hyperliquidMarketSlippage = 0.05
+)
+
+// ErrHyperliquidPrivateKey is returned when submitting actions without a private key
+var ErrHyperliquidPrivateKey = errors.New("hyperliquid private key is required to submit actions")
+
+// HyperliquidError is an error returned by the Hyperliquid API
+type HyperliquidError struct {
+	Message string
+}
+
+func (e *HyperliquidError) Error() string {
+	return "hyperliquid error: " + e.Message
+}
+
+// hyperliquidIntervals are the candle intervals supported by Hyperliquid
+var hyperliquidIntervals = map[string]bool{
+	"1m": true, "3m": true, "5m": true, "15m": true, "30m": true, "1h": true, "2h": true, "4h": true,
+	"8h": true, "12h": true, "1d": true, "3d": true, "1w": true,
+}
+
+type hyperliquidAsset struct {
+	Index       int
+	Name        string
+	SzDecimals  int
+	MaxLeverage int
+}
+
+// Hyperliquid is the Hyperliquid perpetuals exchange. Pairs are the coins quoted in USD, eg: BTCUSD, and
+// actions are signed with an Ethereum key, which may be an API wallet of the account address.
+//
+// Market orders are immediate or cancel orders, limited by a slippage from the mid price, and stops or take
+// profits are trigger orders. Hyperliquid has no orders closing a position, so orders with a zero quantity
+// use the position open when they are placed.
+type Hyperliquid struct {
+	ctx        context.Context
+	client     *http.Client
+	assets     map[string]hyperliquidAsset
+	pairs      map[string]string
+	assetsInfo map[string]model.AssetInfo
+	key        *secp256k1.PrivateKey
+	nonce      int64
+	lastID     int64
+	HeikinAshi bool
+	Testnet    bool
+
+	// Address is the account address, derived from the private key when empty
+	Address    string
+	PrivateKey string
+
+	Endpoint       string
+	StreamEndpoint string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+	PairOptions      []PairOption
+}
+
+type HyperliquidOption func(*Hyperliquid)
+
+// WithHyperliquidCredentials will set the account address and the private key used to sign actions, in hex
+func WithHyperliquidCredentials(address, privateKey string) HyperliquidOption {
+	return func(h *Hyperliquid) {
+		h.Address = strings.ToLower(address)
+		h.PrivateKey = privateKey
+	}
+}
+
+// WithHyperliquidTestnet will use the Hyperliquid testnet
+func WithHyperliquidTestnet() HyperliquidOption {
+	return func(h *Hyperliquid) {
+		h.Testnet = true
+		h.Endpoint = hyperliquidTestnetEndpoint
+		h.StreamEndpoint = hyperliquidTestnetStreamEndpoint
+	}
+}
+
+// WithHyperliquidHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithHyperliquidHeikinAshiCandle() HyperliquidOption {
+	return func(h *Hyperliquid) {
+		h.HeikinAshi = true
+	}
+}
+
+// WithHyperliquidMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithHyperliquidMetadataFetcher(fetcher MetadataFetchers) HyperliquidOption {
+	return func(h *Hyperliquid) {
+		h.MetadataFetchers = append(h.MetadataFetchers, fetcher)
+	}
+}
+
+// WithHyperliquidLeverage will set the leverage and margin type for a pair
+func WithHyperliquidLeverage(pair string, leverage int, marginType MarginType) HyperliquidOption {
+	return func(h *Hyperliquid) {
+		h.PairOptions = append(h.PairOptions, PairOption{
+			Pair:       strings.ToUpper(pair),
+			Leverage:   leverage,
+			MarginType: marginType,
+		})
+	}
+}
+
+// WithHyperliquidEndpoint overrides the REST and websocket endpoints
+func WithHyperliquidEndpoint(endpoint, streamEndpoint string) HyperliquidOption {
+	return func(h *Hyperliquid) {
+		h.Endpoint = endpoint
+		h.StreamEndpoint = streamEndpoint
+	}
+}
+
+// NewHyperliquid will create a new Hyperliquid instance
+func NewHyperliquid(ctx context.Context, options ...HyperliquidOption) (*Hyperliquid, error) {
+	exchange := &Hyperliquid{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		lastID:          time.Now().UnixNano(),
+		Endpoint:        hyperliquidEndpoint,
+		StreamEndpoint:  hyperliquidStreamEndpoint,
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.PrivateKey != "" {
+		key, err := hex.DecodeString(strings.TrimPrefix(exchange.PrivateKey, "0x"))
+		if err != nil || len(key) != secp256k1.PrivKeyBytesLen {
+			return nil, fmt.Errorf("hyperliquid: invalid private key")
+		}
+		exchange.key = secp256k1.PrivKeyFromBytes(key)
+		if exchange.Address == "" {
+			exchange.Address = hyperliquidAddress(exchange.key.PubKey())
+		}
+	}
+
+	// Initialize with orders precision and assets limits
+	err := exchange.loadAssets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("hyperliquid ping fail: %w", err)
+	}
+
+	// Set leverage and margin type
+	for _, option := range exchange.PairOptions {
+		asset, ok := exchange.assets[option.Pair]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAsset, option.Pair)
+		}
+
+		_, err := exchange.exchange(hyperliquidMap{
+			{"type", "updateLeverage"},
+			{"asset", asset.Index},
+			{"isCross", option.MarginType != MarginTypeIsolated},
+			{"leverage", option.Leverage},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info("[SETUP] Using Hyperliquid exchange")
+
+	return exchange, nil
+}
+
+func (h *Hyperliquid) post(ctx context.Context, path string, body, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.Endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var message bytes.Buffer
+		_, _ = message.ReadFrom(resp.Body)
+		return &HyperliquidError{Message: fmt.Sprintf("status %d: %s", resp.StatusCode, message.String())}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// info sends a query to the info endpoint
+func (h *Hyperliquid) info(ctx context.Context, request map[string]interface{}, result interface{}) error {
+	return h.post(ctx, "/info", request, result)
+}
+
+// exchange signs and sends an action, returning the response data
+func (h *Hyperliquid) exchange(action hyperliquidMap) (json.RawMessage, error) {
+	if h.key == nil {
+		return nil, ErrHyperliquidPrivateKey
+	}
+
+	// nonces are timestamps in milliseconds, increased to be unique
+	nonce := time.Now().UnixNano() / int64(time.Millisecond)
+	for {
+		last := atomic.LoadInt64(&h.nonce)
+		if nonce <= last {
+			nonce = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&h.nonce, last, nonce) {
+			break
+		}
+	}
+
+	signature, err := hyperliquidSignAction(h.key, action, uint64(nonce), !h.Testnet)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Status   string          `json:"status"`
+		Response json.RawMessage `json:"response"`
+	}
+	err = h.post(h.ctx, "/exchange", map[string]interface{}{
+		"action":       action,
+		"nonce":        nonce,
+		"signature":    signature,
+		"vaultAddress": nil,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Status != "ok" {
+		var message string
+		if err := json.Unmarshal(response.Response, &message); err != nil {
+			message = string(response.Response)
+		}
+		return nil, &HyperliquidError{Message: message}
+	}
+
+	var result struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(response.Response, &result); err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+func (h *Hyperliquid) loadAssets(ctx context.Context) error {
+	var meta struct {
+		Universe []struct {
+			Name        string `json:"name"`
+			SzDecimals  int    `json:"szDecimals"`
+			MaxLeverage int    `json:"maxLeverage"`
+			IsDelisted  bool   `json:"isDelisted"`
+		} `json:"universe"`
+	}
+	if err := h.info(ctx, map[string]interface{}{"type": "meta"}, &meta); err != nil {
+		return err
+	}
+
+	h.assets = make(map[string]hyperliquidAsset)
+	h.pairs = make(map[string]string)
+	h.assetsInfo = make(map[string]model.AssetInfo)
+	for index, item := range meta.Universe {
+		if item.IsDelisted {
+			continue
+		}
+
+		pair := item.Name + "USD"
+		RegisterPair(pair, item.Name, "USD")
+
+		step := math.Pow10(-item.SzDecimals)
+		priceDecimals := hyperliquidPriceDecimals - item.SzDecimals
+		h.assets[pair] = hyperliquidAsset{
+			Index:       index,
+			Name:        item.Name,
+			SzDecimals:  item.SzDecimals,
+			MaxLeverage: item.MaxLeverage,
+		}
+		h.pairs[item.Name] = pair
+		h.assetsInfo[pair] = model.AssetInfo{
+			BaseAsset:          item.Name,
+			QuoteAsset:         "USD",
+			MinQuantity:        step,
+			MaxQuantity:        math.MaxFloat64,
+			StepSize:           step,
+			MinPrice:           math.Pow10(-priceDecimals),
+			MaxPrice:           math.MaxFloat64,
+			TickSize:           math.Pow10(-priceDecimals),
+			BaseAssetPrecision: item.SzDecimals,
+			QuotePrecision:     priceDecimals,
+		}
+	}
+	return nil
+}
+
+// coin returns the coin of a pair, eg: BTCUSD => BTC
+func (h *Hyperliquid) coin(pair string) string {
+	if asset, ok := h.assets[pair]; ok {
+		return asset.Name
+	}
+	return strings.TrimSuffix(pair, "USD")
+}
+
+// pair returns the pair of a coin, eg: BTC => BTCUSD
+func (h *Hyperliquid) pair(coin string) string {
+	if pair, ok := h.pairs[coin]; ok {
+		return pair
+	}
+	return coin + "USD"
+}
+
+func (h *Hyperliquid) AssetsInfo(pair string) model.AssetInfo {
+	return h.assetsInfo[pair]
+}
+
+// LastQuote returns the mid price of a pair
+func (h *Hyperliquid) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var mids map[string]string
+	if err := h.info(ctx, map[string]interface{}{"type": "allMids"}, &mids); err != nil {
+		return 0, err
+	}
+
+	mid, ok := mids[h.coin(pair)]
+	if !ok {
+		return 0, ErrInvalidAsset
+	}
+	return strconv.ParseFloat(mid, 64)
+}
+
+func (h *Hyperliquid) validate(pair string, quantity float64) error {
+	info, ok := h.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+// hyperliquidFloat formats a number as expected in signed actions, without trailing zeros
+func hyperliquidFloat(value float64) string {
+	formatted := strconv.FormatFloat(value, 'f', 8, 64)
+	formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	if formatted == "-0" {
+		return "0"
+	}
+	return formatted
+}
+
+// formatPrice rounds a price to 5 significant figures and the decimals allowed for the pair
+func (h *Hyperliquid) formatPrice(pair string, price float64) string {
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(price, 'g', hyperliquidPriceFigures, 64), 64)
+	decimals := math.Pow10(hyperliquidPriceDecimals - h.assets[pair].SzDecimals)
+	return hyperliquidFloat(math.Round(rounded*decimals) / decimals)
+}
+
+// formatQuantity rounds a quantity to the size decimals of the pair
+func (h *Hyperliquid) formatQuantity(pair string, quantity float64) string {
+	decimals := math.Pow10(h.assets[pair].SzDecimals)
+	return hyperliquidFloat(math.Round(quantity*decimals) / decimals)
+}
+
+func hyperliquidSlippagePrice(side model.SideType, price float64) float64 {
+	if side == model.SideTypeBuy {
+		return price * (1 + hyperliquidMarketSlippage)
+	}
+	return price * (1 - hyperliquidMarketSlippage)
+}
+
+// hyperliquidClientID returns the cloid of a client order ID, a hex number of 128 bits derived from it
+func hyperliquidClientID(clientOrderID string) string {
+	return fmt.Sprintf("0x%032x", clientOrderNumber(clientOrderID))
+}
+
+// createOrder places an order with a client order id, a new one when the cloid is empty, which identifies
+// trigger orders that are accepted without an order id
+func (h *Hyperliquid) createOrder(side model.SideType, pair string, orderType model.OrderType, quantity,
+	price float64, stop *float64, reduceOnly bool, wire hyperliquidMap, cloid string) (model.Order, error) {
+
+	asset, ok := h.assets[pair]
+	if !ok {
+		return model.Order{}, ErrInvalidAsset
+	}
+
+	if err := h.validate(pair, quantity); err != nil {
+		return model.Order{}, err
+	}
+
+	if cloid == "" {
+		cloid = fmt.Sprintf("0x%032x", atomic.AddInt64(&h.lastID, 1))
+	}
+	data, err := h.exchange(hyperliquidMap{
+		{"type", "order"},
+		{"orders", []interface{}{hyperliquidMap{
+			{"a", asset.Index},
+			{"b", side == model.SideTypeBuy},
+			{"p", h.formatPrice(pair, price)},
+			{"s", h.formatQuantity(pair, quantity)},
+			{"r", reduceOnly},
+			{"t", wire},
+			{"c", cloid},
+		}}},
+		{"grouping", "na"},
+	})
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var result struct {
+		Statuses []json.RawMessage `json:"statuses"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return model.Order{}, err
+	}
+	if len(result.Statuses) == 0 {
+		return model.Order{}, &HyperliquidError{Message: "order without status"}
+	}
+
+	var status struct {
+		Error   string `json:"error"`
+		Resting *struct {
+			Oid int64 `json:"oid"`
+		} `json:"resting"`
+		Filled *struct {
+			Oid     int64  `json:"oid"`
+			TotalSz string `json:"totalSz"`
+			AvgPx   string `json:"avgPx"`
+		} `json:"filled"`
+	}
+	// trigger orders may be accepted with a text status, eg: waitingForTrigger
+	_ = json.Unmarshal(result.Statuses[0], &status)
+	if status.Error != "" {
+		return model.Order{}, &HyperliquidError{Message: status.Error}
+	}
+
+	now := time.Now()
+	order := model.Order{
+		Pair:      pair,
+		Side:      side,
+		Type:      orderType,
+		Status:    model.OrderStatusTypeNew,
+		Price:     price,
+		Quantity:  quantity,
+		Stop:      stop,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	switch {
+	case status.Filled != nil:
+		order.ExchangeID = status.Filled.Oid
+		order.Status = model.OrderStatusTypeFilled
+		order.Price, err = strconv.ParseFloat(status.Filled.AvgPx, 64)
+		log.CheckErr(log.WarnLevel, err)
+		order.Quantity, err = strconv.ParseFloat(status.Filled.TotalSz, 64)
+		log.CheckErr(log.WarnLevel, err)
+	case status.Resting != nil:
+		order.ExchangeID = status.Resting.Oid
+	default:
+		placed, err := h.orderStatus(pair, cloid)
+		if err != nil {
+			return model.Order{}, err
+		}
+		order.ExchangeID = placed.ExchangeID
+	}
+
+	return order, nil
+}
+
+// closingQuantity returns the quantity of the open position of a pair
+func (h *Hyperliquid) closingQuantity(pair string) (float64, error) {
+	position, _, err := h.Position(pair)
+	if err != nil {
+		return 0, err
+	}
+	if position == 0 {
+		return 0, fmt.Errorf("%w: no open position of %s", ErrInvalidQuantity, pair)
+	}
+	return math.Abs(position), nil
+}
+
+func (h *Hyperliquid) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: hyperliquid oco", ErrUnsupportedOrder)
+}
+
+func (h *Hyperliquid) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return h.createOrderLimit(side, pair, quantity, limit, "")
+}
+
+func (h *Hyperliquid) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	cloid string) (model.Order, error) {
+
+	return h.createOrder(side, pair, model.OrderTypeLimit, quantity, limit, nil, false, hyperliquidMap{
+		{"limit", hyperliquidMap{{"tif", "Gtc"}}},
+	}, cloid)
+}
+
+func (h *Hyperliquid) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+	return h.createOrderMarket(side, pair, quantity, reduceOnly, "")
+}
+
+func (h *Hyperliquid) createOrderMarket(side model.SideType, pair string, quantity float64, reduceOnly bool,
+	cloid string) (model.Order, error) {
+
+	price, err := h.LastQuote(h.ctx, pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return h.createOrder(side, pair, model.OrderTypeMarket, quantity, hyperliquidSlippagePrice(side, price), nil,
+		reduceOnly, hyperliquidMap{
+			{"limit", hyperliquidMap{{"tif", "Ioc"}}},
+		}, cloid)
+}
+
+func (h *Hyperliquid) CreateOrderMarketQuote(_ model.SideType, _ string, _ float64) (model.Order, error) {
+	return model.Order{}, fmt.Errorf("%w: hyperliquid market order by quote", ErrUnsupportedOrder)
+}
+
+// CreateOrderStop places a stop market trigger order, following the same semantics of BinanceFuture:
+// a negative limit creates a buy stop, and a zero quantity closes the position
+func (h *Hyperliquid) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	side := model.SideTypeSell
+	if limit < 0 {
+		side = model.SideTypeBuy
+		limit = -limit
+	}
+	return h.createOrderStop(side, pair, quantity, limit, "")
+}
+
+func (h *Hyperliquid) createOrderStop(side model.SideType, pair string, quantity float64, limit float64,
+	cloid string) (model.Order, error) {
+
+	reduceOnly := quantity == 0
+	if reduceOnly {
+		var err error
+		if quantity, err = h.closingQuantity(pair); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	return h.createOrder(side, pair, model.OrderTypeStopLoss, quantity, hyperliquidSlippagePrice(side, limit),
+		&limit, reduceOnly, hyperliquidMap{
+			{"trigger", hyperliquidMap{
+				{"isMarket", true},
+				{"triggerPx", h.formatPrice(pair, limit)},
+				{"tpsl", "sl"},
+			}},
+		}, cloid)
+}
+
+// TakeProfit places a trigger order at the limit price, a limit order for a given quantity or a market
+// order closing the position when the quantity is zero
+func (h *Hyperliquid) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (model.Order, error) {
+	return h.takeProfit(side, pair, quantity, limit, "")
+}
+
+func (h *Hyperliquid) takeProfit(side model.SideType, pair string, quantity float64, limit float64,
+	cloid string) (model.Order, error) {
+
+	orderType := model.OrderTypeTakeProfitLimit
+	if quantity == 0 {
+		var err error
+		if quantity, err = h.closingQuantity(pair); err != nil {
+			return model.Order{}, err
+		}
+		orderType = model.OrderTypeTakeProfit
+	}
+
+	price := limit
+	if orderType == model.OrderTypeTakeProfit {
+		price = hyperliquidSlippagePrice(side, limit)
+	}
+
+	return h.createOrder(side, pair, orderType, quantity, price, &limit, orderType == model.OrderTypeTakeProfit,
+		hyperliquidMap{
+			{"trigger", hyperliquidMap{
+				{"isMarket", orderType == model.OrderTypeTakeProfit},
+				{"triggerPx", h.formatPrice(pair, limit)},
+				{"tpsl", "tp"},
+			}},
+		}, cloid)
+}
+
+// CreateOrderRequest places an order with the client order ID of the request, sent as a cloid derived
+// from it, since Hyperliquid only accepts client order ids of 128 bits
+func (h *Hyperliquid) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	cloid := hyperliquidClientID(request.ClientOrderID)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: hyperliquid time in force %s", ErrUnsupportedOrder,
+				request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: hyperliquid iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = h.createOrderLimit(request.Side, request.Pair, request.Quantity, request.Price, cloid)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			return h.CreateOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity)
+		}
+		order, err = h.createOrderMarket(request.Side, request.Pair, request.Quantity, request.ReduceOnly, cloid)
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		order, err = h.createOrderStop(request.Side, request.Pair, request.Quantity, request.Stop, cloid)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = h.takeProfit(request.Side, request.Pair, request.Quantity, request.Stop, cloid)
+	default:
+		return model.Order{}, fmt.Errorf("%w: hyperliquid %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns the order of a client order ID, or ErrOrderNotFound
+func (h *Hyperliquid) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	order, err := h.order(pair, hyperliquidClientID(clientOrderID))
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = clientOrderID
+	return order, nil
+}
+
+func (h *Hyperliquid) cancel(pair string, orders []model.Order) error {
+	asset, ok := h.assets[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	cancels := make([]interface{}, 0, len(orders))
+	for _, order := range orders {
+		cancels = append(cancels, hyperliquidMap{{"a", asset.Index}, {"o", order.ExchangeID}})
+	}
+
+	data, err := h.exchange(hyperliquidMap{{"type", "cancel"}, {"cancels", cancels}})
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Statuses []json.RawMessage `json:"statuses"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	for _, status := range result.Statuses {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(status, &failure) == nil && failure.Error != "" {
+			return &HyperliquidError{Message: failure.Error}
+		}
+	}
+	return nil
+}
+
+func (h *Hyperliquid) Cancel(order model.Order) error {
+	return h.cancel(order.Pair, []model.Order{order})
+}
+
+func (h *Hyperliquid) CancelOpenOrders(pair string) error {
+	orders, err := h.OpenOrders(pair)
+	if err != nil {
+		return err
+	}
+
+	if len(orders) == 0 {
+		return nil
+	}
+	return h.cancel(pair, orders)
+}
+
+// hyperliquidOrder is an order of the info endpoint
+type hyperliquidOrder struct {
+	Coin       string `json:"coin"`
+	Side       string `json:"side"`
+	LimitPx    string `json:"limitPx"`
+	Sz         string `json:"sz"`
+	OrigSz     string `json:"origSz"`
+	Oid        int64  `json:"oid"`
+	Timestamp  int64  `json:"timestamp"`
+	OrderType  string `json:"orderType"`
+	TriggerPx  string `json:"triggerPx"`
+	IsTrigger  bool   `json:"isTrigger"`
+	ReduceOnly bool   `json:"reduceOnly"`
+}
+
+func (o hyperliquidOrder) toModel(pair, status string) model.Order {
+	order := model.Order{
+		ExchangeID: o.Oid,
+		Pair:       pair,
+		Side:       model.SideTypeSell,
+		Status:     hyperliquidStatus(status),
+		CreatedAt:  time.Unix(0, o.Timestamp*int64(time.Millisecond)),
+		UpdatedAt:  time.Now(),
+	}
+	if o.Side == "B" {
+		order.Side = model.SideTypeBuy
+	}
+
+	switch o.OrderType {
+	case "Market":
+		order.Type = model.OrderTypeMarket
+	case "Stop Market":
+		order.Type = model.OrderTypeStopLoss
+	case "Stop Limit":
+		order.Type = model.OrderTypeStopLossLimit
+	case "Take Profit Market":
+		order.Type = model.OrderTypeTakeProfit
+	case "Take Profit Limit":
+		order.Type = model.OrderTypeTakeProfitLimit
+	default:
+		order.Type = model.OrderTypeLimit
+	}
+
+	if trigger, err := strconv.ParseFloat(o.TriggerPx, 64); err == nil && o.IsTrigger {
+		order.Stop = &trigger
+	}
+
+	var err error
+	order.Price, err = strconv.ParseFloat(o.LimitPx, 64)
+	log.CheckErr(log.WarnLevel, err)
+
+	size := o.OrigSz
+	if size == "" {
+		size = o.Sz
+	}
+	order.Quantity, err = strconv.ParseFloat(size, 64)
+	log.CheckErr(log.WarnLevel, err)
+
+	remaining, _ := strconv.ParseFloat(o.Sz, 64)
+	if order.Status == model.OrderStatusTypeNew && remaining > 0 && remaining < order.Quantity {
+		order.Status = model.OrderStatusTypePartiallyFilled
+	}
+
+	return order
+}
+
+// hyperliquidStatus converts an order status, open orders include triggered orders
+func hyperliquidStatus(status string) model.OrderStatusType {
+	switch {
+	case status == "filled":
+		return model.OrderStatusTypeFilled
+	case status == "rejected" || strings.HasSuffix(status, "Rejected"):
+		return model.OrderStatusTypeRejected
+	case strings.HasSuffix(status, "anceled") || status == "scheduledCancel":
+		return model.OrderStatusTypeCanceled
+	default:
+		return model.OrderStatusTypeNew
+	}
+}
+
+func (h *Hyperliquid) OpenOrders(pair string) ([]model.Order, error) {
+	var result []hyperliquidOrder
+	err := h.info(h.ctx, map[string]interface{}{"type": "frontendOpenOrders", "user": h.Address}, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	coin := h.coin(pair)
+	orders := make([]model.Order, 0)
+	for _, order := range result {
+		if order.Coin == coin {
+			orders = append(orders, order.toModel(pair, "open"))
+		}
+	}
+	return orders, nil
+}
+
+// orderStatus returns an order by its order id or client order id
+func (h *Hyperliquid) orderStatus(pair string, id interface{}) (model.Order, error) {
+	var result struct {
+		Status string `json:"status"`
+		Order  struct {
+			Order  hyperliquidOrder `json:"order"`
+			Status string           `json:"status"`
+		} `json:"order"`
+	}
+	err := h.info(h.ctx, map[string]interface{}{"type": "orderStatus", "user": h.Address, "oid": id}, &result)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if result.Status != "order" {
+		return model.Order{}, fmt.Errorf("%w: hyperliquid order %v", ErrOrderNotFound, id)
+	}
+	return result.Order.Order.toModel(pair, result.Order.Status), nil
+}
+
+// Order returns an order by its id, filled orders have the average price and quantity of their fills
+func (h *Hyperliquid) Order(pair string, id int64) (model.Order, error) {
+	return h.order(pair, id)
+}
+
+// order returns an order by its order id or client order id, with the average price of its fills
+func (h *Hyperliquid) order(pair string, id interface{}) (model.Order, error) {
+	order, err := h.orderStatus(pair, id)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if order.Status == model.OrderStatusTypeFilled || order.Status == model.OrderStatusTypePartiallyFilled {
+		var fills []hyperliquidFill
+		err := h.info(h.ctx, map[string]interface{}{"type": "userFills", "user": h.Address}, &fills)
+		if err != nil {
+			return model.Order{}, err
+		}
+
+		var quantity, cost float64
+		for _, fill := range fills {
+			if fill.Oid == order.ExchangeID {
+				quantity += fill.size()
+				cost += fill.size() * fill.price()
+			}
+		}
+		if quantity > 0 {
+			order.Price = cost / quantity
+			if order.Status == model.OrderStatusTypeFilled {
+				order.Quantity = quantity
+			}
+		}
+	}
+	return order, nil
+}
+
+type hyperliquidFill struct {
+	Coin string `json:"coin"`
+	Px   string `json:"px"`
+	Sz   string `json:"sz"`
+	Oid  int64  `json:"oid"`
+	Time int64  `json:"time"`
+}
+
+func (f hyperliquidFill) price() float64 {
+	price, _ := strconv.ParseFloat(f.Px, 64)
+	return price
+}
+
+func (f hyperliquidFill) size() float64 {
+	size, _ := strconv.ParseFloat(f.Sz, 64)
+	return size
+}
+
+// Account returns the open positions, negative for short positions, and the USDC collateral. The withdrawable
+// collateral is free and the remaining account value is locked by positions and orders.
+func (h *Hyperliquid) Account() (model.Account, error) {
+	var state struct {
+		AssetPositions []struct {
+			Position struct {
+				Coin     string `json:"coin"`
+				Szi      string `json:"szi"`
+				Leverage struct {
+					Value float64 `json:"value"`
+				} `json:"leverage"`
+			} `json:"position"`
+		} `json:"assetPositions"`
+		MarginSummary struct {
+			AccountValue string `json:"accountValue"`
+		} `json:"marginSummary"`
+		Withdrawable string `json:"withdrawable"`
+	}
+	err := h.info(h.ctx, map[string]interface{}{"type": "clearinghouseState", "user": h.Address}, &state)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0)
+	for _, item := range state.AssetPositions {
+		size, err := strconv.ParseFloat(item.Position.Szi, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		if size == 0 {
+			continue
+		}
+
+		balances = append(balances, model.Balance{
+			Asset:    item.Position.Coin,
+			Free:     size,
+			Leverage: item.Position.Leverage.Value,
+		})
+	}
+
+	free, err := strconv.ParseFloat(state.Withdrawable, 64)
+	if err != nil {
+		return model.Account{}, err
+	}
+	value, _ := strconv.ParseFloat(state.MarginSummary.AccountValue, 64)
+	balances = append(balances, model.Balance{
+		Asset: "USDC",
+		Free:  free,
+		Lock:  math.Max(value-free, 0),
+	})
+
+	return model.Account{
+		Balances:  balances,
+		Available: free,
+	}, nil
+}
+
+// Position returns the position of a pair and the withdrawable USDC collateral
+func (h *Hyperliquid) Position(pair string) (asset, quote float64, err error) {
+	acc, err := h.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(h.coin(pair), "USDC")
+
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free, nil
+}
+
+// PositionRisk returns the size of the position, Hyperliquid does not provide position details
+func (h *Hyperliquid) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(h, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, Hyperliquid does not support amending orders
+func (h *Hyperliquid) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(h, order, price, quantity)
+}
+
+// hyperliquidCandle is a candle of the info endpoint and the candle channel
+type hyperliquidCandle struct {
+	T int64  `json:"t"`
+	O string `json:"o"`
+	H string `json:"h"`
+	L string `json:"l"`
+	C string `json:"c"`
+	V string `json:"v"`
+}
+
+func (c hyperliquidCandle) toModel(pair string) (model.Candle, error) {
+	t := time.Unix(0, c.T*int64(time.Millisecond))
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Metadata: make(map[string]float64)}
+	for _, value := range []struct {
+		target *float64
+		value  string
+	}{
+		{&candle.Open, c.O},
+		{&candle.High, c.H},
+		{&candle.Low, c.L},
+		{&candle.Close, c.C},
+		{&candle.Volume, c.V},
+	} {
+		var err error
+		if *value.target, err = strconv.ParseFloat(value.value, 64); err != nil {
+			return model.Candle{}, err
+		}
+	}
+	return candle, nil
+}
+
+// candles returns the complete candles of a period in chronological order
+func (h *Hyperliquid) candles(ctx context.Context, pair, period string, start,
+	end time.Time) ([]model.Candle, error) {
+
+	if !hyperliquidIntervals[period] {
+		return nil, fmt.Errorf("invalid hyperliquid interval %s", period)
+	}
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	candles := make([]model.Candle, 0)
+	for !start.After(end) {
+		var result []hyperliquidCandle
+		err := h.info(ctx, map[string]interface{}{
+			"type": "candleSnapshot",
+			"req": map[string]interface{}{
+				"coin":      h.coin(pair),
+				"interval":  period,
+				"startTime": start.UnixNano() / int64(time.Millisecond),
+				"endTime":   end.UnixNano() / int64(time.Millisecond),
+			},
+		}, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, data := range result {
+			candle, err := data.toModel(pair)
+			if err != nil {
+				return nil, err
+			}
+
+			// the last candle is in progress until the end of its period
+			if candle.Time.Add(duration).After(now) {
+				continue
+			}
+			candle.Complete = true
+			candles = append(candles, candle)
+		}
+
+		if len(result) < hyperliquidCandleLimit {
+			break
+		}
+		start = time.Unix(0, result[len(result)-1].T*int64(time.Millisecond)).Add(duration)
+	}
+
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+
+	if h.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+func (h *Hyperliquid) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	end := time.Now()
+	candles, err := h.candles(ctx, pair, period, end.Add(-time.Duration(limit+1)*duration), end)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	return candles, nil
+}
+
+func (h *Hyperliquid) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+	return h.candles(ctx, pair, period, start, end)
+}
+
+// hyperliquidMessage is a message of the websocket API
+type hyperliquidMessage struct {
+	Channel string          `json:"channel"`
+	Data    json.RawMessage `json:"data"`
+}
+
+var hyperliquidPing = map[string]string{"method": "ping"}
+
+// CandlesSubscription streams the candles of a pair. Hyperliquid sends the current candle on each trade,
+// so the previous candle is complete when a trade of the next period happens.
+func (h *Hyperliquid) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		if !hyperliquidIntervals[period] {
+			cerr <- fmt.Errorf("invalid hyperliquid interval %s", period)
+			close(cerr)
+			close(ccandle)
+			return
+		}
+
+		subscribe := map[string]interface{}{
+			"method":       "subscribe",
+			"subscription": map[string]string{"type": "candle", "coin": h.coin(pair), "interval": period},
+		}
+
+		var last *model.Candle
+		for {
+			done, stop, err := wsServeJSON(h.StreamEndpoint, []interface{}{subscribe}, hyperliquidPing,
+				func(message []byte) {
+					var event hyperliquidMessage
+					if err := json.Unmarshal(message, &event); err != nil || event.Channel != "candle" {
+						return
+					}
+
+					var data hyperliquidCandle
+					if err := json.Unmarshal(event.Data, &data); err != nil {
+						log.Warn(err)
+						return
+					}
+
+					candle, err := data.toModel(pair)
+					if err != nil {
+						log.Warn(err)
+						return
+					}
+					candle.UpdatedAt = time.Now()
+
+					ba.Reset()
+					candles := []model.Candle{candle}
+					if last != nil && candle.Time.After(last.Time) {
+						complete := *last
+						complete.Complete = true
+						if h.HeikinAshi {
+							complete = complete.ToHeikinAshi(ha)
+						}
+						// fetch aditional data if needed
+						fetchMetadata(ctx, h.MetadataFetchers, h.MetadataTimeout, &h.metadataKeys, &complete)
+						candles = []model.Candle{complete, candle}
+					}
+					if last == nil || !candle.Time.Before(last.Time) {
+						last = &candle
+					}
+
+					for _, candle := range candles {
+						select {
+						case ccandle <- candle:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}, func(err error) {
+					select {
+					case cerr <- err:
+					case <-ctx.Done():
+					}
+				})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				// wait for the stream handlers before closing the channels
+				close(stop)
+				<-done
+				close(cerr)
+				close(ccandle)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (h *Hyperliquid) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("hyperliquid")
+}
+
+// hyperliquidTracker keeps the state of orders of the account subscription, since order updates
+// do not include the order type and fills only include the filled size and price
+type hyperliquidTracker struct {
+	mtx      sync.Mutex
+	exchange *Hyperliquid
+	orders   map[int64]*hyperliquidTrackedOrder
+}
+
+type hyperliquidTrackedOrder struct {
+	order  model.Order
+	filled float64
+	cost   float64
+}
+
+// get returns the tracked state of an order, fetching the order when it is unknown
+func (t *hyperliquidTracker) get(pair string, id int64, update *hyperliquidOrder) *hyperliquidTrackedOrder {
+	if tracked, ok := t.orders[id]; ok {
+		return tracked
+	}
+
+	order, err := t.exchange.orderStatus(pair, id)
+	if err != nil && update != nil {
+		order = update.toModel(pair, "open")
+	} else if err != nil {
+		order = model.Order{ExchangeID: id, Pair: pair, Type: model.OrderTypeMarket, CreatedAt: time.Now()}
+	}
+
+	tracked := &hyperliquidTrackedOrder{order: order}
+	t.orders[id] = tracked
+	return tracked
+}
+
+// onOrderUpdate applies a status update
+func (t *hyperliquidTracker) onOrderUpdate(pair string, data hyperliquidOrder, status string) model.Order {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	tracked := t.get(pair, data.Oid, &data)
+	tracked.order.Status = data.toModel(pair, status).Status
+	tracked.order.UpdatedAt = time.Now()
+	if tracked.filled > 0 && tracked.order.Status == model.OrderStatusTypeFilled {
+		tracked.order.Price = tracked.cost / tracked.filled
+		tracked.order.Quantity = tracked.filled
+	}
+	return tracked.order
+}
+
+// onFill applies a fill, orders are filled when the filled size reaches the order size
+func (t *hyperliquidTracker) onFill(fill hyperliquidFill) model.Order {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	tracked := t.get(t.exchange.pair(fill.Coin), fill.Oid, nil)
+	tracked.filled += fill.size()
+	tracked.cost += fill.size() * fill.price()
+	tracked.order.Price = tracked.cost / tracked.filled
+	tracked.order.UpdatedAt = time.Unix(0, fill.Time*int64(time.Millisecond))
+
+	tracked.order.Status = model.OrderStatusTypePartiallyFilled
+	if tracked.order.Quantity == 0 || tracked.filled >= tracked.order.Quantity*(1-1e-9) {
+		tracked.order.Status = model.OrderStatusTypeFilled
+		tracked.order.Quantity = tracked.filled
+	}
+	return tracked.order
+}
+
+// AccountSubscription streams the order updates and fills of the account, it reconnects until the context
+// is done. Fills update the filled quantity and average price of their orders.
+func (h *Hyperliquid) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+
+		requests := []interface{}{
+			map[string]interface{}{
+				"method":       "subscribe",
+				"subscription": map[string]string{"type": "orderUpdates", "user": h.Address},
+			},
+			map[string]interface{}{
+				"method":       "subscribe",
+				"subscription": map[string]string{"type": "userFills", "user": h.Address},
+			},
+		}
+
+		tracker := &hyperliquidTracker{exchange: h, orders: make(map[int64]*hyperliquidTrackedOrder)}
+		for {
+			done, stop, err := wsServeJSON(h.StreamEndpoint, requests, hyperliquidPing, func(message []byte) {
+				var event hyperliquidMessage
+				if err := json.Unmarshal(message, &event); err != nil {
+					return
+				}
+
+				orders := make([]model.Order, 0)
+				switch event.Channel {
+				case "orderUpdates":
+					var updates []struct {
+						Order  hyperliquidOrder `json:"order"`
+						Status string           `json:"status"`
+					}
+					if err := json.Unmarshal(event.Data, &updates); err != nil {
+						sendErr(err)
+						return
+					}
+					for _, update := range updates {
+						orders = append(orders, tracker.onOrderUpdate(h.pair(update.Order.Coin), update.Order,
+							update.Status))
+					}
+				case "userFills":
+					var data struct {
+						IsSnapshot bool              `json:"isSnapshot"`
+						Fills      []hyperliquidFill `json:"fills"`
+					}
+					if err := json.Unmarshal(event.Data, &data); err != nil {
+						sendErr(err)
+						return
+					}
+					// the subscription starts with past fills
+					if data.IsSnapshot {
+						return
+					}
+					for _, fill := range data.Fills {
+						orders = append(orders, tracker.onFill(fill))
+					}
+				case "error":
+					var message string
+					_ = json.Unmarshal(event.Data, &message)
+					sendErr(&HyperliquidError{Message: message})
+					return
+				default:
+					return
+				}
+
+				ba.Reset()
+				for _, order := range orders {
+					select {
+					case corder <- order:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}, sendErr)
+			if err != nil {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					close(cerr)
+					close(corder)
+					return
+				}
+				time.Sleep(ba.Duration())
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				close(stop)
+				<-done
+				close(cerr)
+				close(corder)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return corder, cerr
+}
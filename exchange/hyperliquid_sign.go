@@ -0,0 +1,224 @@
+package exchange
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"golang.org/x/crypto/sha3"
+)
+
+// hyperliquidKV is an entry of an ordered map. Hyperliquid signs the msgpack encoding of actions,
+// so keys must keep the same order in msgpack and in the JSON request.
+type hyperliquidKV struct {
+	Key   string
+	Value interface{}
+}
+
+type hyperliquidMap []hyperliquidKV
+
+func (m hyperliquidMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, entry := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// msgpackEncode encodes a value with the msgpack format, using the smallest representation of
+// integers, strings and collections as the reference msgpack implementations
+func msgpackEncode(buf *bytes.Buffer, value interface{}) error {
+	writeSize := func(size int, fix, base byte, fixLimit int) {
+		switch {
+		case size < fixLimit:
+			buf.WriteByte(fix | byte(size))
+		case size <= 0xffff:
+			buf.WriteByte(base)
+			_ = binary.Write(buf, binary.BigEndian, uint16(size))
+		default:
+			buf.WriteByte(base + 1)
+			_ = binary.Write(buf, binary.BigEndian, uint32(size))
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case int:
+		return msgpackEncode(buf, int64(v))
+	case int64:
+		switch {
+		case v >= 0:
+			return msgpackEncode(buf, uint64(v))
+		case v >= -32:
+			buf.WriteByte(byte(v))
+		case v >= math.MinInt8:
+			buf.WriteByte(0xd0)
+			buf.WriteByte(byte(v))
+		case v >= math.MinInt16:
+			buf.WriteByte(0xd1)
+			_ = binary.Write(buf, binary.BigEndian, int16(v))
+		case v >= math.MinInt32:
+			buf.WriteByte(0xd2)
+			_ = binary.Write(buf, binary.BigEndian, int32(v))
+		default:
+			buf.WriteByte(0xd3)
+			_ = binary.Write(buf, binary.BigEndian, v)
+		}
+	case uint64:
+		switch {
+		case v < 0x80:
+			buf.WriteByte(byte(v))
+		case v <= 0xff:
+			buf.WriteByte(0xcc)
+			buf.WriteByte(byte(v))
+		case v <= 0xffff:
+			buf.WriteByte(0xcd)
+			_ = binary.Write(buf, binary.BigEndian, uint16(v))
+		case v <= 0xffffffff:
+			buf.WriteByte(0xce)
+			_ = binary.Write(buf, binary.BigEndian, uint32(v))
+		default:
+			buf.WriteByte(0xcf)
+			_ = binary.Write(buf, binary.BigEndian, v)
+		}
+	case string:
+		switch {
+		case len(v) < 32:
+			buf.WriteByte(0xa0 | byte(len(v)))
+		case len(v) <= 0xff:
+			buf.WriteByte(0xd9)
+			buf.WriteByte(byte(len(v)))
+		default:
+			writeSize(len(v), 0xa0, 0xda, 0)
+		}
+		buf.WriteString(v)
+	case []interface{}:
+		writeSize(len(v), 0x90, 0xdc, 16)
+		for _, item := range v {
+			if err := msgpackEncode(buf, item); err != nil {
+				return err
+			}
+		}
+	case hyperliquidMap:
+		writeSize(len(v), 0x80, 0xde, 16)
+		for _, entry := range v {
+			if err := msgpackEncode(buf, entry.Key); err != nil {
+				return err
+			}
+			if err := msgpackEncode(buf, entry.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %T", value)
+	}
+	return nil
+}
+
+func keccak256(data ...[]byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	for _, item := range data {
+		hash.Write(item)
+	}
+	return hash.Sum(nil)
+}
+
+// hyperliquidSignature is an Ethereum signature, with the recovery id in v
+type hyperliquidSignature struct {
+	R string `json:"r"`
+	S string `json:"s"`
+	V int    `json:"v"`
+}
+
+// hyperliquidActionHash is the hash of the msgpack encoding of an action, followed by the nonce and
+// the flag of a missing vault address
+func hyperliquidActionHash(action hyperliquidMap, nonce uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := msgpackEncode(&buf, action); err != nil {
+		return nil, err
+	}
+	_ = binary.Write(&buf, binary.BigEndian, nonce)
+	buf.WriteByte(0)
+	return keccak256(buf.Bytes()), nil
+}
+
+// hyperliquidAgentHash is the EIP-712 hash of the phantom agent of an action, whose source identifies
+// the mainnet or testnet
+func hyperliquidAgentHash(action hyperliquidMap, nonce uint64, mainnet bool) ([]byte, error) {
+	connectionID, err := hyperliquidActionHash(action, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	source := "b"
+	if mainnet {
+		source = "a"
+	}
+
+	chainID := make([]byte, 32)
+	big.NewInt(1337).FillBytes(chainID)
+	domain := keccak256(
+		keccak256([]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)")),
+		keccak256([]byte("Exchange")),
+		keccak256([]byte("1")),
+		chainID,
+		make([]byte, 32),
+	)
+	message := keccak256(
+		keccak256([]byte("Agent(string source,bytes32 connectionId)")),
+		keccak256([]byte(source)),
+		connectionID,
+	)
+	return keccak256([]byte{0x19, 0x01}, domain, message), nil
+}
+
+// hyperliquidSignAction signs an action with the typed data of its phantom agent
+func hyperliquidSignAction(key *secp256k1.PrivateKey, action hyperliquidMap, nonce uint64,
+	mainnet bool) (hyperliquidSignature, error) {
+
+	hash, err := hyperliquidAgentHash(action, nonce, mainnet)
+	if err != nil {
+		return hyperliquidSignature{}, err
+	}
+
+	// compact signatures of uncompressed keys start with 27 plus the recovery id, as v in Ethereum
+	signature := ecdsa.SignCompact(key, hash, false)
+	return hyperliquidSignature{
+		R: "0x" + hex.EncodeToString(signature[1:33]),
+		S: "0x" + hex.EncodeToString(signature[33:]),
+		V: int(signature[0]),
+	}, nil
+}
+
+// hyperliquidAddress returns the Ethereum address of a key
+func hyperliquidAddress(key *secp256k1.PublicKey) string {
+	return "0x" + hex.EncodeToString(keccak256(key.SerializeUncompressed()[1:])[12:])
+}
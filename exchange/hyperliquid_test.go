@@ -0,0 +1,557 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// decodeOrderedJSON decodes a JSON value keeping the order of object keys, as signed by Hyperliquid
+func decodeOrderedJSON(t *testing.T, decoder *json.Decoder) interface{} {
+	token, err := decoder.Token()
+	require.NoError(t, err)
+
+	switch value := token.(type) {
+	case json.Delim:
+		if value == '{' {
+			result := hyperliquidMap{}
+			for decoder.More() {
+				key, err := decoder.Token()
+				require.NoError(t, err)
+				result = append(result, hyperliquidKV{key.(string), decodeOrderedJSON(t, decoder)})
+			}
+			_, err = decoder.Token()
+			require.NoError(t, err)
+			return result
+		}
+
+		result := make([]interface{}, 0)
+		for decoder.More() {
+			result = append(result, decodeOrderedJSON(t, decoder))
+		}
+		_, err = decoder.Token()
+		require.NoError(t, err)
+		return result
+	case json.Number:
+		// actions only have integers, decimals are sent as strings
+		number, err := value.Int64()
+		require.NoError(t, err)
+		return number
+	default:
+		return value
+	}
+}
+
+func hyperliquidValue(m hyperliquidMap, key string) interface{} {
+	for _, entry := range m {
+		if entry.Key == key {
+			return entry.Value
+		}
+	}
+	return nil
+}
+
+// hyperliquidServer emulates the info, exchange and websocket endpoints of Hyperliquid
+type hyperliquidServer struct {
+	*httptest.Server
+	mtx     sync.Mutex
+	address string
+	actions []hyperliquidMap
+}
+
+func newHyperliquidServer(t *testing.T) *hyperliquidServer {
+	s := &hyperliquidServer{}
+
+	reply := func(w http.ResponseWriter, result interface{}) {
+		_ = json.NewEncoder(w).Encode(result)
+	}
+
+	hourly := func(start, end time.Time) []map[string]interface{} {
+		candles := make([]map[string]interface{}, 0)
+		for t := start.Truncate(time.Hour); !t.After(end); t = t.Add(time.Hour) {
+			if t.Before(start) {
+				continue
+			}
+			candles = append(candles, map[string]interface{}{"t": t.UnixNano() / int64(time.Millisecond),
+				"T": t.Add(time.Hour).UnixNano()/int64(time.Millisecond) - 1, "s": "BTC", "i": "1h",
+				"o": "100", "h": "110", "l": "90", "c": "101", "v": "10", "n": 5})
+		}
+		return candles
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/info", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Type string                 `json:"type"`
+			User string                 `json:"user"`
+			Oid  interface{}            `json:"oid"`
+			Req  map[string]interface{} `json:"req"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		if request.User != "" {
+			require.Equal(t, s.address, request.User)
+		}
+
+		order := func(oid int64, orderType, size, origSize string) map[string]interface{} {
+			return map[string]interface{}{"coin": "BTC", "side": "B", "limitPx": "95", "sz": size,
+				"origSz": origSize, "oid": oid, "timestamp": 1640995200000, "orderType": orderType,
+				"triggerPx": "0.0", "isTrigger": false, "reduceOnly": false}
+		}
+
+		switch request.Type {
+		case "meta":
+			reply(w, map[string]interface{}{"universe": []map[string]interface{}{
+				{"name": "BTC", "szDecimals": 3, "maxLeverage": 50},
+				{"name": "OLD", "szDecimals": 1, "maxLeverage": 3, "isDelisted": true},
+			}})
+		case "allMids":
+			reply(w, map[string]string{"BTC": "100", "ETH": "10"})
+		case "candleSnapshot":
+			require.Equal(t, "BTC", request.Req["coin"])
+			require.Equal(t, "1h", request.Req["interval"])
+			start := time.Unix(0, int64(request.Req["startTime"].(float64))*int64(time.Millisecond))
+			end := time.Unix(0, int64(request.Req["endTime"].(float64))*int64(time.Millisecond))
+			reply(w, hourly(start, end))
+		case "clearinghouseState":
+			reply(w, map[string]interface{}{
+				"assetPositions": []map[string]interface{}{
+					{"type": "oneWay", "position": map[string]interface{}{"coin": "BTC", "szi": "-0.5",
+						"leverage": map[string]interface{}{"type": "cross", "value": 10}}},
+				},
+				"marginSummary": map[string]string{"accountValue": "1000"},
+				"withdrawable":  "900",
+			})
+		case "frontendOpenOrders":
+			stop := order(8, "Stop Market", "0.5", "0.5")
+			stop["side"], stop["triggerPx"], stop["isTrigger"] = "A", "90", true
+			other := order(3, "Limit", "1", "1")
+			other["coin"] = "ETH"
+			reply(w, []map[string]interface{}{order(7, "Limit", "0.4", "0.5"), stop, other})
+		case "orderStatus":
+			switch request.Oid {
+			case 7.0:
+				reply(w, map[string]interface{}{"status": "order",
+					"order": map[string]interface{}{"order": order(7, "Limit", "0.5", "0.5"), "status": "open"}})
+			case 9.0:
+				reply(w, map[string]interface{}{"status": "order",
+					"order": map[string]interface{}{"order": order(9, "Market", "0", "0.5"), "status": "filled"}})
+			default:
+				// trigger orders are found by their client order id
+				if cloid, ok := request.Oid.(string); ok && strings.HasPrefix(cloid, "0x") && len(cloid) == 34 {
+					reply(w, map[string]interface{}{"status": "order", "order": map[string]interface{}{
+						"order": order(11, "Stop Market", "0.5", "0.5"), "status": "open"}})
+					return
+				}
+				reply(w, map[string]interface{}{"status": "unknownOid"})
+			}
+		case "userFills":
+			reply(w, []map[string]interface{}{
+				{"coin": "BTC", "px": "100", "sz": "0.2", "oid": 9, "time": 1640995200000},
+				{"coin": "BTC", "px": "110", "sz": "0.3", "oid": 9, "time": 1640995200000},
+				{"coin": "BTC", "px": "50", "sz": "1", "oid": 1, "time": 1640995200000},
+			})
+		default:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+	})
+
+	mux.HandleFunc("/exchange", func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Action       json.RawMessage      `json:"action"`
+			Nonce        uint64               `json:"nonce"`
+			Signature    hyperliquidSignature `json:"signature"`
+			VaultAddress *string              `json:"vaultAddress"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		require.Nil(t, request.VaultAddress)
+
+		decoder := json.NewDecoder(bytes.NewReader(request.Action))
+		decoder.UseNumber()
+		action := decodeOrderedJSON(t, decoder).(hyperliquidMap)
+
+		// verify the signer of the action
+		hash, err := hyperliquidAgentHash(action, request.Nonce, false)
+		require.NoError(t, err)
+		r1, err := hex.DecodeString(strings.TrimPrefix(request.Signature.R, "0x"))
+		require.NoError(t, err)
+		s1, err := hex.DecodeString(strings.TrimPrefix(request.Signature.S, "0x"))
+		require.NoError(t, err)
+		signature := append(append([]byte{byte(request.Signature.V)}, r1...), s1...)
+		pubKey, _, err := ecdsa.RecoverCompact(signature, hash)
+		require.NoError(t, err)
+		require.Equal(t, s.address, hyperliquidAddress(pubKey))
+
+		s.mtx.Lock()
+		s.actions = append(s.actions, action)
+		s.mtx.Unlock()
+
+		ok := func(data interface{}) {
+			reply(w, map[string]interface{}{"status": "ok", "response": map[string]interface{}{
+				"type": hyperliquidValue(action, "type"), "data": data}})
+		}
+
+		switch hyperliquidValue(action, "type") {
+		case "updateLeverage":
+			if hyperliquidValue(action, "leverage").(int64) > 50 {
+				reply(w, map[string]interface{}{"status": "err", "response": "Invalid leverage value"})
+				return
+			}
+			reply(w, map[string]interface{}{"status": "ok", "response": map[string]string{"type": "default"}})
+		case "order":
+			wire := hyperliquidValue(action, "orders").([]interface{})[0].(hyperliquidMap)
+			orderType := hyperliquidValue(wire, "t").(hyperliquidMap)
+			if orderType[0].Key == "trigger" {
+				ok(map[string]interface{}{"statuses": []interface{}{"waitingForTrigger"}})
+				return
+			}
+			limit := hyperliquidValue(orderType, "limit").(hyperliquidMap)
+			if hyperliquidValue(limit, "tif") == "Ioc" {
+				ok(map[string]interface{}{"statuses": []interface{}{map[string]interface{}{
+					"filled": map[string]interface{}{"totalSz": "0.5", "avgPx": "100.5", "oid": 10}}}})
+				return
+			}
+			ok(map[string]interface{}{"statuses": []interface{}{map[string]interface{}{
+				"resting": map[string]interface{}{"oid": 12}}}})
+		case "cancel":
+			statuses := make([]interface{}, 0)
+			for range hyperliquidValue(action, "cancels").([]interface{}) {
+				statuses = append(statuses, "success")
+			}
+			ok(map[string]interface{}{"statuses": statuses})
+		}
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var subscribe struct {
+			Method       string            `json:"method"`
+			Subscription map[string]string `json:"subscription"`
+		}
+		require.NoError(t, conn.ReadJSON(&subscribe))
+		require.Equal(t, "subscribe", subscribe.Method)
+
+		send := func(channel string, data interface{}) {
+			_ = conn.WriteJSON(map[string]interface{}{"channel": channel, "data": data})
+		}
+		send("subscriptionResponse", subscribe)
+
+		switch subscribe.Subscription["type"] {
+		case "candle":
+			require.Equal(t, "BTC", subscribe.Subscription["coin"])
+			require.Equal(t, "1h", subscribe.Subscription["interval"])
+			candle := func(start int64, closing string) map[string]interface{} {
+				return map[string]interface{}{"t": start, "s": "BTC", "i": "1h", "o": "100", "h": "110",
+					"l": "90", "c": closing, "v": "10"}
+			}
+			send("candle", candle(1640998800000, "101"))
+			send("candle", candle(1640998800000, "102"))
+			send("candle", candle(1641002400000, "103"))
+		case "orderUpdates":
+			require.Equal(t, s.address, subscribe.Subscription["user"])
+			require.NoError(t, conn.ReadJSON(&subscribe))
+			require.Equal(t, "userFills", subscribe.Subscription["type"])
+
+			fill := func(px, sz string) map[string]interface{} {
+				return map[string]interface{}{"coin": "BTC", "px": px, "sz": sz, "oid": 7, "time": 1640995200000}
+			}
+			send("orderUpdates", []interface{}{map[string]interface{}{"status": "open", "order": map[string]interface{}{
+				"coin": "BTC", "side": "B", "limitPx": "95", "sz": "0.5", "origSz": "0.5", "oid": 7}}})
+			send("userFills", map[string]interface{}{"isSnapshot": true, "user": s.address,
+				"fills": []interface{}{fill("50", "1")}})
+			send("userFills", map[string]interface{}{"user": s.address,
+				"fills": []interface{}{fill("94", "0.2"), fill("95.5", "0.3")}})
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+func newTestHyperliquid(t *testing.T, options ...HyperliquidOption) (*Hyperliquid, *hyperliquidServer) {
+	server := newHyperliquidServer(t)
+	key, err := secp256k1.GeneratePrivateKey()
+	require.NoError(t, err)
+	server.address = hyperliquidAddress(key.PubKey())
+
+	options = append([]HyperliquidOption{
+		WithHyperliquidTestnet(),
+		WithHyperliquidCredentials("", hex.EncodeToString(key.Serialize())),
+		WithHyperliquidEndpoint(server.URL, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws"),
+	}, options...)
+	hyperliquid, err := NewHyperliquid(context.Background(), options...)
+	require.NoError(t, err)
+	return hyperliquid, server
+}
+
+func TestHyperliquidSign(t *testing.T) {
+	require.Equal(t, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470",
+		hex.EncodeToString(keccak256(nil)))
+
+	// the address of the private key 1
+	var key secp256k1.ModNScalar
+	key.SetInt(1)
+	require.Equal(t, "0x7e5f4552091a69125d5dfcb7b8c2659029395bdf",
+		hyperliquidAddress(secp256k1.NewPrivateKey(&key).PubKey()))
+
+	var buf bytes.Buffer
+	require.NoError(t, msgpackEncode(&buf, hyperliquidMap{
+		{"type", "cancel"},
+		{"a", 200},
+		{"b", []interface{}{true, nil, int64(-1), int64(-200), int64(70000)}},
+	}))
+	require.Equal(t, "83a474797065a663616e63656ca161ccc8a16295c3c0ffd1ff38ce00011170",
+		hex.EncodeToString(buf.Bytes()))
+
+	data, err := json.Marshal(hyperliquidMap{{"z", 1}, {"a", hyperliquidMap{{"y", "1"}, {"b", false}}}})
+	require.NoError(t, err)
+	require.Equal(t, `{"z":1,"a":{"y":"1","b":false}}`, string(data))
+}
+
+func TestHyperliquid(t *testing.T) {
+	t.Run("assets", func(t *testing.T) {
+		hyperliquid, server := newTestHyperliquid(t, WithHyperliquidLeverage("btcusd", 20, MarginTypeIsolated))
+		info := hyperliquid.AssetsInfo("BTCUSD")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USD", info.QuoteAsset)
+		require.Equal(t, 0.001, info.StepSize)
+		require.Equal(t, 0.001, info.TickSize)
+		require.Equal(t, 3, info.BaseAssetPrecision)
+		require.Empty(t, hyperliquid.AssetsInfo("OLDUSD").BaseAsset)
+
+		require.Equal(t, "BTC", hyperliquid.coin("BTCUSD"))
+		require.Equal(t, "BTCUSD", hyperliquid.pair("BTC"))
+		require.Equal(t, server.address, hyperliquid.Address)
+		require.Equal(t, hyperliquidMap{{"type", "updateLeverage"}, {"asset", int64(0)}, {"isCross", false},
+			{"leverage", int64(20)}}, server.actions[0])
+
+		require.Equal(t, "12346", hyperliquid.formatPrice("BTCUSD", 12345.6789))
+		require.Equal(t, "1.235", hyperliquid.formatPrice("BTCUSD", 1.23456))
+		require.Equal(t, "0.001", hyperliquid.formatPrice("BTCUSD", 0.0012345))
+		require.Equal(t, "0.123", hyperliquid.formatQuantity("BTCUSD", 0.12345))
+
+		price, err := hyperliquid.LastQuote(context.Background(), "BTCUSD")
+		require.NoError(t, err)
+		require.Equal(t, 100.0, price)
+
+		var apiError *HyperliquidError
+		server = newHyperliquidServer(t)
+		key, err := secp256k1.GeneratePrivateKey()
+		require.NoError(t, err)
+		server.address = hyperliquidAddress(key.PubKey())
+		_, err = NewHyperliquid(context.Background(), WithHyperliquidTestnet(),
+			WithHyperliquidCredentials("", hex.EncodeToString(key.Serialize())),
+			WithHyperliquidEndpoint(server.URL, ""),
+			WithHyperliquidLeverage("BTCUSD", 100, MarginTypeCrossed))
+		require.ErrorAs(t, err, &apiError)
+		require.Equal(t, "Invalid leverage value", apiError.Message)
+
+		_, err = NewHyperliquid(context.Background(), WithHyperliquidCredentials("", "invalid"))
+		require.Error(t, err)
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		hyperliquid, _ := newTestHyperliquid(t)
+		candles, err := hyperliquid.CandlesByLimit(context.Background(), "BTCUSD", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, time.Now().Truncate(time.Hour).Add(-time.Hour), candles[1].Time)
+		require.Equal(t, 101.0, candles[1].Close)
+		require.Equal(t, 10.0, candles[1].Volume)
+		require.True(t, candles[1].Complete)
+
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		candles, err = hyperliquid.CandlesByPeriod(context.Background(), "BTCUSD", "1h", start, start.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, start, candles[0].Time.UTC())
+
+		_, err = hyperliquid.CandlesByLimit(context.Background(), "BTCUSD", "6h", 2)
+		require.Error(t, err)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		hyperliquid, _ := newTestHyperliquid(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		stream, _ := hyperliquid.CandlesSubscription(ctx, "BTCUSD", "1h")
+		closes := make([]float64, 0)
+		completes := make([]bool, 0)
+		for i := 0; i < 4; i++ {
+			candle := <-stream
+			closes = append(closes, candle.Close)
+			completes = append(completes, candle.Complete)
+		}
+		// the candle is complete on the first update of the next period
+		require.Equal(t, []float64{101, 102, 102, 103}, closes)
+		require.Equal(t, []bool{false, false, true, false}, completes)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		hyperliquid, server := newTestHyperliquid(t)
+		wire := func(i int) hyperliquidMap {
+			return hyperliquidValue(server.actions[i], "orders").([]interface{})[0].(hyperliquidMap)
+		}
+
+		market, err := hyperliquid.CreateOrderMarket(model.SideTypeBuy, "BTCUSD", 0.5, false)
+		require.NoError(t, err)
+		require.Equal(t, int64(10), market.ExchangeID)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, 100.5, market.Price)
+		require.Equal(t, hyperliquidMap{{"a", int64(0)}, {"b", true}, {"p", "105"}, {"s", "0.5"}, {"r", false},
+			{"t", hyperliquidMap{{"limit", hyperliquidMap{{"tif", "Ioc"}}}}}, {"c", hyperliquidValue(wire(0), "c")}},
+			wire(0))
+
+		limit, err := hyperliquid.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.5, 120)
+		require.NoError(t, err)
+		require.Equal(t, int64(12), limit.ExchangeID)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, false, hyperliquidValue(wire(1), "b"))
+		require.NotEqual(t, hyperliquidValue(wire(0), "c"), hyperliquidValue(wire(1), "c"))
+
+		var orderError *OrderError
+		_, err = hyperliquid.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.0001, 120)
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+		_, err = hyperliquid.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSD", 100)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+		_, err = hyperliquid.CreateOrderOCO(model.SideTypeSell, "BTCUSD", 1, 110, 90, 89)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		// a zero quantity closes the short position with a reduce only buy stop
+		stop, err := hyperliquid.CreateOrderStop("BTCUSD", 0, -110)
+		require.NoError(t, err)
+		require.Equal(t, int64(11), stop.ExchangeID)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeBuy, stop.Side)
+		require.Equal(t, 110.0, *stop.Stop)
+		require.Equal(t, 0.5, stop.Quantity)
+		require.Equal(t, true, hyperliquidValue(wire(2), "r"))
+		require.Equal(t, hyperliquidMap{{"trigger", hyperliquidMap{{"isMarket", true}, {"triggerPx", "110"},
+			{"tpsl", "sl"}}}}, hyperliquidValue(wire(2), "t"))
+
+		takeProfit, err := hyperliquid.TakeProfit(model.SideTypeBuy, "BTCUSD", 0.5, 80)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+		require.Equal(t, "80", hyperliquidValue(wire(3), "p"))
+		require.Equal(t, hyperliquidMap{{"trigger", hyperliquidMap{{"isMarket", false}, {"triggerPx", "80"},
+			{"tpsl", "tp"}}}}, hyperliquidValue(wire(3), "t"))
+
+		require.NoError(t, hyperliquid.Cancel(limit))
+		require.Equal(t, hyperliquidMap{{"type", "cancel"}, {"cancels", []interface{}{
+			hyperliquidMap{{"a", int64(0)}, {"o", int64(12)}}}}}, server.actions[4])
+
+		orders, err := hyperliquid.OpenOrders("BTCUSD")
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, orders[0].Status)
+		require.Equal(t, 0.5, orders[0].Quantity)
+		require.Equal(t, model.OrderTypeStopLoss, orders[1].Type)
+		require.Equal(t, model.SideTypeSell, orders[1].Side)
+		require.Equal(t, 90.0, *orders[1].Stop)
+
+		order, err := hyperliquid.Order("BTCUSD", 9)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.OrderTypeMarket, order.Type)
+		require.InDelta(t, 106.0, order.Price, 1e-9)
+		require.Equal(t, 0.5, order.Quantity)
+		_, err = hyperliquid.Order("BTCUSD", 1)
+		require.Error(t, err)
+
+		require.NoError(t, hyperliquid.CancelOpenOrders("BTCUSD"))
+		require.Len(t, hyperliquidValue(server.actions[5], "cancels"), 2)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		hyperliquid, server := newTestHyperliquid(t)
+
+		stop, err := hyperliquid.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeSell,
+			Type: model.OrderTypeStopLoss, Quantity: 0.5, Stop: 90, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", stop.ClientOrderID)
+		require.Equal(t, int64(11), stop.ExchangeID)
+		wire := hyperliquidValue(server.actions[0], "orders").([]interface{})[0].(hyperliquidMap)
+		require.Equal(t, hyperliquidClientID("ninjabot-1"), hyperliquidValue(wire, "c"))
+
+		order, err := hyperliquid.OrderByClientID("BTCUSD", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", order.ClientOrderID)
+		require.Equal(t, int64(11), order.ExchangeID)
+		require.Equal(t, model.OrderTypeStopLoss, order.Type)
+
+		_, err = hyperliquid.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeBuy,
+			Type: model.OrderTypeMarket, QuoteQuantity: 100, ClientOrderID: "ninjabot-2"})
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+	})
+
+	t.Run("no private key", func(t *testing.T) {
+		hyperliquid, _ := newTestHyperliquid(t, WithHyperliquidCredentials("0xADDRESS", ""))
+		require.Equal(t, "0xaddress", hyperliquid.Address)
+		_, err := hyperliquid.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.5, 120)
+		require.ErrorIs(t, err, ErrHyperliquidPrivateKey)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		hyperliquid, _ := newTestHyperliquid(t)
+		account, err := hyperliquid.Account()
+		require.NoError(t, err)
+		require.Equal(t, []model.Balance{
+			{Asset: "BTC", Free: -0.5, Leverage: 10},
+			{Asset: "USDC", Free: 900, Lock: 100},
+		}, account.Balances)
+		require.Equal(t, 900.0, account.Available)
+
+		asset, quote, err := hyperliquid.Position("BTCUSD")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+		require.Equal(t, 900.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		hyperliquid, _ := newTestHyperliquid(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, _ := hyperliquid.AccountSubscription(ctx)
+		order := <-updates
+		require.Equal(t, int64(7), order.ExchangeID)
+		require.Equal(t, "BTCUSD", order.Pair)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, model.OrderTypeLimit, order.Type)
+		require.Equal(t, model.SideTypeBuy, order.Side)
+
+		// fills of the snapshot are skipped
+		order = <-updates
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+		require.Equal(t, 94.0, order.Price)
+		require.Equal(t, 0.5, order.Quantity)
+
+		order = <-updates
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 94.9, order.Price, 1e-9)
+		require.InDelta(t, 0.5, order.Quantity, 1e-9)
+		require.Equal(t, model.OrderTypeLimit, order.Type)
+	})
+}
@@ -0,0 +1,1161 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	krakenEndpoint       = "https://api.kraken.com"
+	krakenStreamEndpoint = "wss://ws.kraken.com/v2"
+)
+
+// krakenAliases are the Kraken asset names that differ from the usual ones, after removing the X and Z
+// prefixes of legacy assets, eg: XXBT => XBT => BTC
+var krakenAliases = map[string]string{
+	"XBT": "BTC",
+	"XDG": "DOGE",
+}
+
+// KrakenError is an error returned by the Kraken API, eg: EOrder:Insufficient funds
+type KrakenError struct {
+	Code    string
+	Message string
+}
+
+func (e *KrakenError) Error() string {
+	return fmt.Sprintf("kraken error %s: %s", e.Code, e.Message)
+}
+
+func newKrakenError(message string) *KrakenError {
+	parts := strings.SplitN(message, ":", 2)
+	if len(parts) < 2 {
+		return &KrakenError{Code: message}
+	}
+	return &KrakenError{Code: parts[0], Message: parts[1]}
+}
+
+type krakenAssetPair struct {
+	Altname      string `json:"altname"`
+	WSName       string `json:"wsname"`
+	Base         string `json:"base"`
+	Quote        string `json:"quote"`
+	PairDecimals int    `json:"pair_decimals"`
+	LotDecimals  int    `json:"lot_decimals"`
+	CostDecimals int    `json:"cost_decimals"`
+	OrderMin     string `json:"ordermin"`
+	TickSize     string `json:"tick_size"`
+}
+
+// Kraken is the Kraken spot exchange. Kraken assets have legacy names, eg: XXBT and ZUSD, so pairs are
+// normalized to the usual names in the ninjabot format, eg: XXBTZUSD => BTCUSD, and registered for
+// SplitAssetQuote. Kraken order ids are strings, eg: OQCLML-BW3P3-BUCMWZ, and the ninjabot ExchangeID is
+// a hash of the order id.
+type Kraken struct {
+	ctx        context.Context
+	client     *http.Client
+	assetsInfo map[string]model.AssetInfo
+	HeikinAshi bool
+
+	APIKey    string
+	APISecret string
+
+	// Endpoint and StreamEndpoint override the REST and websocket URLs, eg: for a mock server
+	Endpoint       string
+	StreamEndpoint string
+
+	// krakenPairs maps ninjabot pairs to Kraken pairs, and pairs maps the Kraken pair names, altnames and
+	// websocket names to ninjabot pairs
+	krakenPairs map[string]krakenAssetPair
+	pairs       map[string]string
+	assets      map[string]string
+
+	mtx   sync.Mutex
+	nonce int64
+	txids map[int64]string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+}
+
+type KrakenOption func(*Kraken)
+
+// WithKrakenCredentials will set the credentials for Kraken
+func WithKrakenCredentials(key, secret string) KrakenOption {
+	return func(k *Kraken) {
+		k.APIKey = key
+		k.APISecret = secret
+	}
+}
+
+// WithKrakenHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithKrakenHeikinAshiCandle() KrakenOption {
+	return func(k *Kraken) {
+		k.HeikinAshi = true
+	}
+}
+
+// WithKrakenMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithKrakenMetadataFetcher(fetcher MetadataFetchers) KrakenOption {
+	return func(k *Kraken) {
+		k.MetadataFetchers = append(k.MetadataFetchers, fetcher)
+	}
+}
+
+// WithKrakenEndpoint overrides the REST and websocket endpoints
+func WithKrakenEndpoint(endpoint, streamEndpoint string) KrakenOption {
+	return func(k *Kraken) {
+		k.Endpoint = endpoint
+		k.StreamEndpoint = streamEndpoint
+	}
+}
+
+// NewKraken will create a new Kraken instance
+func NewKraken(ctx context.Context, options ...KrakenOption) (*Kraken, error) {
+	exchange := &Kraken{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		Endpoint:        krakenEndpoint,
+		StreamEndpoint:  krakenStreamEndpoint,
+		txids:           make(map[int64]string),
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	// Initialize with orders precision and assets limits
+	if err := exchange.loadAssetPairs(ctx); err != nil {
+		return nil, fmt.Errorf("kraken ping fail: %w", err)
+	}
+
+	log.Info("[SETUP] Using Kraken exchange")
+
+	return exchange, nil
+}
+
+// request sends a public GET request or a signed POST request, with form encoded params. Private requests
+// are signed with the HMAC-SHA512 of the path and the SHA256 of the nonce and the params.
+func (k *Kraken) request(ctx context.Context, path string, params url.Values, result interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+
+	var req *http.Request
+	var err error
+	if strings.HasPrefix(path, "/0/private/") {
+		secret, err := base64.StdEncoding.DecodeString(k.APISecret)
+		if err != nil {
+			return fmt.Errorf("kraken invalid api secret: %w", err)
+		}
+
+		nonce := strconv.FormatInt(k.nextNonce(), 10)
+		params.Set("nonce", nonce)
+		body := params.Encode()
+
+		digest := sha256.Sum256([]byte(nonce + body))
+		mac := hmac.New(sha512.New, secret)
+		mac.Write(append([]byte(path), digest[:]...))
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, k.Endpoint+path, strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("API-Key", k.APIKey)
+		req.Header.Set("API-Sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	} else {
+		query := ""
+		if len(params) > 0 {
+			query = "?" + params.Encode()
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, k.Endpoint+path+query, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Error  []string        `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("kraken %s: status %d: %w", path, resp.StatusCode, err)
+	}
+
+	if len(response.Error) > 0 {
+		return newKrakenError(response.Error[0])
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Result, result)
+}
+
+// nextNonce returns an increasing nonce, the current time in microseconds unless it was already used
+func (k *Kraken) nextNonce() int64 {
+	for {
+		last := atomic.LoadInt64(&k.nonce)
+		nonce := time.Now().UnixNano() / int64(time.Microsecond)
+		if nonce <= last {
+			nonce = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&k.nonce, last, nonce) {
+			return nonce
+		}
+	}
+}
+
+func (k *Kraken) loadAssetPairs(ctx context.Context) error {
+	var assets map[string]struct {
+		Altname string `json:"altname"`
+	}
+	if err := k.request(ctx, "/0/public/Assets", nil, &assets); err != nil {
+		return err
+	}
+
+	k.assets = make(map[string]string)
+	for name, asset := range assets {
+		k.assets[name] = krakenAsset(asset.Altname)
+	}
+
+	var assetPairs map[string]krakenAssetPair
+	if err := k.request(ctx, "/0/public/AssetPairs", nil, &assetPairs); err != nil {
+		return err
+	}
+
+	k.assetsInfo = make(map[string]model.AssetInfo)
+	k.krakenPairs = make(map[string]krakenAssetPair)
+	k.pairs = make(map[string]string)
+	for name, assetPair := range assetPairs {
+		base, quote := k.asset(assetPair.Base), k.asset(assetPair.Quote)
+		pair := base + quote
+
+		info := model.AssetInfo{
+			BaseAsset:          base,
+			QuoteAsset:         quote,
+			MaxQuantity:        math.MaxFloat64,
+			MaxPrice:           math.MaxFloat64,
+			StepSize:           math.Pow10(-assetPair.LotDecimals),
+			TickSize:           math.Pow10(-assetPair.PairDecimals),
+			BaseAssetPrecision: assetPair.LotDecimals,
+			PricePrecision:     assetPair.PairDecimals,
+			QuotePrecision:     assetPair.CostDecimals,
+		}
+		info.MinQuantity, _ = strconv.ParseFloat(assetPair.OrderMin, 64)
+		if tick, err := strconv.ParseFloat(assetPair.TickSize, 64); err == nil && tick > 0 {
+			info.TickSize = tick
+		}
+		info.MinPrice = info.TickSize
+
+		k.assetsInfo[pair] = info
+		k.krakenPairs[pair] = assetPair
+		k.pairs[name] = pair
+		k.pairs[assetPair.Altname] = pair
+		k.pairs[assetPair.WSName] = pair
+		k.pairs[base+"/"+quote] = pair
+		RegisterPair(pair, base, quote)
+	}
+
+	return nil
+}
+
+// krakenAsset returns the usual name of a Kraken asset altname, eg: XBT => BTC
+func krakenAsset(altname string) string {
+	if alias, ok := krakenAliases[altname]; ok {
+		return alias
+	}
+	return altname
+}
+
+// asset returns the usual name of a Kraken asset, eg: XXBT => BTC, ZUSD => USD
+func (k *Kraken) asset(name string) string {
+	if asset, ok := k.assets[name]; ok {
+		return asset
+	}
+	if len(name) == 4 && (name[0] == 'X' || name[0] == 'Z') {
+		return krakenAsset(name[1:])
+	}
+	return krakenAsset(name)
+}
+
+// krakenPair returns the Kraken pair name used by the REST API, eg: BTCUSD => XXBTZUSD
+func (k *Kraken) krakenPair(pair string) string {
+	if assetPair, ok := k.krakenPairs[pair]; ok {
+		return assetPair.Altname
+	}
+	return pair
+}
+
+// symbol returns the symbol of a pair used by the websocket, eg: BTCUSD => BTC/USD
+func (k *Kraken) symbol(pair string) string {
+	if info, ok := k.assetsInfo[pair]; ok {
+		return info.BaseAsset + "/" + info.QuoteAsset
+	}
+	asset, quote := SplitAssetQuote(pair)
+	return asset + "/" + quote
+}
+
+// pair returns the ninjabot pair of a Kraken pair name, altname or websocket symbol
+func (k *Kraken) pair(name string) string {
+	if pair, ok := k.pairs[name]; ok {
+		return pair
+	}
+	return strings.ReplaceAll(name, "/", "")
+}
+
+func (k *Kraken) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var result map[string]struct {
+		Close []string `json:"c"`
+	}
+	err := k.request(ctx, "/0/public/Ticker", url.Values{"pair": {k.krakenPair(pair)}}, &result)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ticker := range result {
+		if len(ticker.Close) > 0 {
+			return strconv.ParseFloat(ticker.Close[0], 64)
+		}
+	}
+	return 0, fmt.Errorf("kraken ticker of %s not found", pair)
+}
+
+func (k *Kraken) AssetsInfo(pair string) model.AssetInfo {
+	return k.assetsInfo[pair]
+}
+
+func (k *Kraken) validate(pair string, quantity float64) error {
+	info, ok := k.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (k *Kraken) formatPrice(pair string, value float64) string {
+	return formatStep(value, k.assetsInfo[pair].TickSize)
+}
+
+func (k *Kraken) formatQuantity(pair string, value float64) string {
+	return formatStep(value, k.assetsInfo[pair].StepSize)
+}
+
+// krakenExchangeID returns the ninjabot id of a Kraken order id
+func krakenExchangeID(txid string) int64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(txid))
+	return int64(hash.Sum64() & math.MaxInt64)
+}
+
+// krakenClientOrderID returns the Kraken client order id of a client order ID, as a short UUID of 32
+// hexadecimal characters
+func krakenClientOrderID(clientOrderID string) string {
+	return fmt.Sprintf("%032x", clientOrderNumber(clientOrderID))
+}
+
+// createOrder places an order, with the Kraken client order id of the client order ID when it is given,
+// and returns its current state
+func (k *Kraken) createOrder(side model.SideType, pair string, quantity float64, clientOrderID string,
+	params url.Values) (model.Order, error) {
+
+	err := k.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	params.Set("pair", k.krakenPair(pair))
+	params.Set("type", strings.ToLower(string(side)))
+	params.Set("volume", k.formatQuantity(pair, quantity))
+	if clientOrderID != "" {
+		params.Set("cl_ord_id", krakenClientOrderID(clientOrderID))
+	}
+
+	var result struct {
+		TxID []string `json:"txid"`
+	}
+	if err := k.request(k.ctx, "/0/private/AddOrder", params, &result); err != nil {
+		return model.Order{}, err
+	}
+	if len(result.TxID) == 0 {
+		return model.Order{}, errors.New("kraken order without id")
+	}
+
+	id := krakenExchangeID(result.TxID[0])
+	k.mtx.Lock()
+	k.txids[id] = result.TxID[0]
+	k.mtx.Unlock()
+
+	return k.Order(pair, id)
+}
+
+func (k *Kraken) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: kraken oco", ErrUnsupportedOrder)
+}
+
+func (k *Kraken) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return k.createOrderLimit(side, pair, quantity, limit, "")
+}
+
+func (k *Kraken) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	clientOrderID string) (model.Order, error) {
+
+	return k.createOrder(side, pair, quantity, clientOrderID, url.Values{
+		"ordertype": {"limit"},
+		"price":     {k.formatPrice(pair, limit)},
+	})
+}
+
+func (k *Kraken) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	_ bool) (model.Order, error) {
+	return k.createOrder(side, pair, quantity, "", url.Values{"ordertype": {"market"}})
+}
+
+// CreateOrderMarketQuote places a market order with the quantity of the quote amount at the last price, as
+// Kraken market orders are sized in the base asset
+func (k *Kraken) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	return k.createOrderMarketQuote(side, pair, quote, "")
+}
+
+func (k *Kraken) createOrderMarketQuote(side model.SideType, pair string, quote float64,
+	clientOrderID string) (model.Order, error) {
+	price, err := k.LastQuote(k.ctx, pair)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if price <= 0 {
+		return model.Order{}, fmt.Errorf("kraken invalid price of %s: %f", pair, price)
+	}
+
+	return k.createOrder(side, pair, quote/price, clientOrderID, url.Values{"ordertype": {"market"}})
+}
+
+func (k *Kraken) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	return k.createOrderStop(pair, quantity, limit, "")
+}
+
+func (k *Kraken) createOrderStop(pair string, quantity float64, limit float64,
+	clientOrderID string) (model.Order, error) {
+	return k.createOrder(model.SideTypeSell, pair, quantity, clientOrderID, url.Values{
+		"ordertype": {"stop-loss"},
+		"price":     {k.formatPrice(pair, limit)},
+	})
+}
+
+func (k *Kraken) TakeProfit(side model.SideType, pair string, quantity float64, limit float64) (model.Order, error) {
+	return k.takeProfit(side, pair, quantity, limit, "")
+}
+
+func (k *Kraken) takeProfit(side model.SideType, pair string, quantity float64, limit float64,
+	clientOrderID string) (model.Order, error) {
+	return k.createOrder(side, pair, quantity, clientOrderID, url.Values{
+		"ordertype": {"take-profit"},
+		"price":     {k.formatPrice(pair, limit)},
+	})
+}
+
+// CreateOrderRequest places an order with the client order ID of the request, sent as the Kraken client
+// order id
+func (k *Kraken) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: kraken time in force %s", ErrUnsupportedOrder, request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: kraken iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = k.createOrderLimit(request.Side, request.Pair, request.Quantity, request.Price,
+			request.ClientOrderID)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			order, err = k.createOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity,
+				request.ClientOrderID)
+		} else {
+			order, err = k.createOrder(request.Side, request.Pair, request.Quantity, request.ClientOrderID,
+				url.Values{"ordertype": {"market"}})
+		}
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		if request.Side == model.SideTypeBuy {
+			return model.Order{}, fmt.Errorf("%w: kraken buy stop", ErrUnsupportedOrder)
+		}
+		order, err = k.createOrderStop(request.Pair, request.Quantity, request.Stop, request.ClientOrderID)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = k.takeProfit(request.Side, request.Pair, request.Quantity, request.Stop, request.ClientOrderID)
+	default:
+		return model.Order{}, fmt.Errorf("%w: kraken %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns an open or closed order by its client order ID, or ErrOrderNotFound
+func (k *Kraken) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	clOrdID := krakenClientOrderID(clientOrderID)
+	for _, path := range []string{"/0/private/OpenOrders", "/0/private/ClosedOrders"} {
+		var result struct {
+			Open   map[string]krakenOrder `json:"open"`
+			Closed map[string]krakenOrder `json:"closed"`
+		}
+		if err := k.request(k.ctx, path, url.Values{"cl_ord_id": {clOrdID}}, &result); err != nil {
+			return model.Order{}, err
+		}
+
+		for _, orders := range []map[string]krakenOrder{result.Open, result.Closed} {
+			for txid, order := range orders {
+				if order.ClOrdID == clOrdID {
+					found := k.order(txid, order)
+					found.ClientOrderID = clientOrderID
+					return found, nil
+				}
+			}
+		}
+	}
+	return model.Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, clientOrderID)
+}
+
+func (k *Kraken) Cancel(order model.Order) error {
+	txid, err := k.txid(order.Pair, order.ExchangeID)
+	if err != nil {
+		return err
+	}
+	return k.request(k.ctx, "/0/private/CancelOrder", url.Values{"txid": {txid}}, nil)
+}
+
+func (k *Kraken) CancelOpenOrders(pair string) error {
+	orders, err := k.OpenOrders(pair)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if err := k.Cancel(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openOrders returns the open orders of all pairs by order id
+func (k *Kraken) openOrders() (map[string]krakenOrder, error) {
+	var result struct {
+		Open map[string]krakenOrder `json:"open"`
+	}
+	if err := k.request(k.ctx, "/0/private/OpenOrders", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Open, nil
+}
+
+func (k *Kraken) OpenOrders(pair string) ([]model.Order, error) {
+	open, err := k.openOrders()
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(open))
+	for txid, order := range open {
+		if k.pair(order.Descr.Pair) == pair {
+			orders = append(orders, k.order(txid, order))
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+	return orders, nil
+}
+
+// txid returns the Kraken order id of an ExchangeID, searching the open and closed orders for orders
+// created by a previous instance
+func (k *Kraken) txid(pair string, id int64) (string, error) {
+	k.mtx.Lock()
+	txid, ok := k.txids[id]
+	k.mtx.Unlock()
+	if ok {
+		return txid, nil
+	}
+
+	open, err := k.openOrders()
+	if err != nil {
+		return "", err
+	}
+	for txid := range open {
+		if krakenExchangeID(txid) == id {
+			return txid, nil
+		}
+	}
+
+	for offset := 0; ; {
+		var result struct {
+			Closed map[string]krakenOrder `json:"closed"`
+			Count  int                    `json:"count"`
+		}
+		err := k.request(k.ctx, "/0/private/ClosedOrders", url.Values{"ofs": {strconv.Itoa(offset)}}, &result)
+		if err != nil {
+			return "", err
+		}
+
+		for txid := range result.Closed {
+			if krakenExchangeID(txid) == id {
+				return txid, nil
+			}
+		}
+
+		offset += len(result.Closed)
+		if len(result.Closed) == 0 || offset >= result.Count {
+			return "", fmt.Errorf("kraken order %d of %s not found", id, pair)
+		}
+	}
+}
+
+func (k *Kraken) Order(pair string, id int64) (model.Order, error) {
+	txid, err := k.txid(pair, id)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	var result map[string]krakenOrder
+	if err := k.request(k.ctx, "/0/private/QueryOrders", url.Values{"txid": {txid}}, &result); err != nil {
+		return model.Order{}, err
+	}
+
+	order, ok := result[txid]
+	if !ok {
+		return model.Order{}, fmt.Errorf("kraken order %s not found", txid)
+	}
+	return k.order(txid, order), nil
+}
+
+type krakenOrder struct {
+	ClOrdID string  `json:"cl_ord_id"`
+	Status  string  `json:"status"`
+	OpenTm  float64 `json:"opentm"`
+	CloseTm float64 `json:"closetm"`
+	Descr   struct {
+		Pair      string `json:"pair"`
+		Type      string `json:"type"`
+		OrderType string `json:"ordertype"`
+		Price     string `json:"price"`
+		Price2    string `json:"price2"`
+	} `json:"descr"`
+	Vol     string `json:"vol"`
+	VolExec string `json:"vol_exec"`
+	Price   string `json:"price"`
+}
+
+func krakenTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func (k *Kraken) order(txid string, order krakenOrder) model.Order {
+	result := model.Order{
+		ExchangeID: krakenExchangeID(txid),
+		Pair:       k.pair(order.Descr.Pair),
+		Side:       model.SideType(strings.ToUpper(order.Descr.Type)),
+		CreatedAt:  krakenTime(order.OpenTm),
+		UpdatedAt:  krakenTime(order.OpenTm),
+	}
+	if order.CloseTm > 0 {
+		result.UpdatedAt = krakenTime(order.CloseTm)
+	}
+
+	k.mtx.Lock()
+	k.txids[result.ExchangeID] = txid
+	k.mtx.Unlock()
+
+	price, _ := strconv.ParseFloat(order.Descr.Price, 64)
+	price2, _ := strconv.ParseFloat(order.Descr.Price2, 64)
+	result.Price = price
+	switch order.Descr.OrderType {
+	case "market":
+		result.Type = model.OrderTypeMarket
+	case "stop-loss":
+		result.Type = model.OrderTypeStopLoss
+		result.Stop = &price
+	case "stop-loss-limit":
+		result.Type, result.Price = model.OrderTypeStopLossLimit, price2
+		result.Stop = &price
+	case "take-profit":
+		result.Type = model.OrderTypeTakeProfit
+		result.Stop = &price
+	case "take-profit-limit":
+		result.Type, result.Price = model.OrderTypeTakeProfitLimit, price2
+		result.Stop = &price
+	default:
+		result.Type = model.OrderTypeLimit
+	}
+
+	filled, _ := strconv.ParseFloat(order.VolExec, 64)
+	result.Quantity, _ = strconv.ParseFloat(order.Vol, 64)
+	if average, _ := strconv.ParseFloat(order.Price, 64); filled > 0 && average > 0 {
+		result.Price = average
+	}
+
+	switch order.Status {
+	case "closed":
+		result.Status = model.OrderStatusTypeFilled
+		result.Quantity = filled
+	case "canceled":
+		result.Status = model.OrderStatusTypeCanceled
+	case "expired":
+		result.Status = model.OrderStatusTypeExpired
+	default:
+		result.Status = model.OrderStatusTypeNew
+		if filled > 0 {
+			result.Status = model.OrderStatusTypePartiallyFilled
+		}
+	}
+
+	return result
+}
+
+func (k *Kraken) Account() (model.Account, error) {
+	var result map[string]struct {
+		Balance   string `json:"balance"`
+		HoldTrade string `json:"hold_trade"`
+	}
+	if err := k.request(k.ctx, "/0/private/BalanceEx", nil, &result); err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0, len(result))
+	for name, item := range result {
+		// balances with a suffix are not available for trading, eg: XBT.F of Kraken Rewards
+		if strings.Contains(name, ".") {
+			continue
+		}
+
+		balance, err := strconv.ParseFloat(item.Balance, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+		hold, _ := strconv.ParseFloat(item.HoldTrade, 64)
+
+		if balance == 0 {
+			continue
+		}
+
+		balances = append(balances, model.Balance{
+			Asset: k.asset(name),
+			Free:  balance - hold,
+			Lock:  hold,
+		})
+	}
+
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].Asset < balances[j].Asset
+	})
+	return model.Account{Balances: balances}, nil
+}
+
+func (k *Kraken) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	acc, err := k.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
+
+// PositionRisk returns the size of the position, Kraken does not provide position details
+func (k *Kraken) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(k, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, Kraken does not support amending orders
+func (k *Kraken) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(k, order, price, quantity)
+}
+
+// krakenInterval converts a ninjabot timeframe into a Kraken interval in minutes
+func krakenInterval(period string) (int, error) {
+	switch period {
+	case "1m", "5m", "15m", "30m", "1h", "4h", "1d", "1w":
+		duration, err := str2duration.ParseDuration(period)
+		if err != nil {
+			return 0, err
+		}
+		return int(duration / time.Minute), nil
+	}
+	return 0, fmt.Errorf("invalid kraken interval %s", period)
+}
+
+// candles requests the candles since a time, Kraken returns up to the last 720 candles of an interval.
+// The last candle is in progress and it is discarded.
+func (k *Kraken) candles(ctx context.Context, pair, period string, since time.Time) ([]model.Candle, error) {
+	interval, err := krakenInterval(period)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		"pair":     {k.krakenPair(pair)},
+		"interval": {strconv.Itoa(interval)},
+	}
+	if !since.IsZero() {
+		params.Set("since", strconv.FormatInt(since.Unix(), 10))
+	}
+
+	var result map[string]json.RawMessage
+	if err := k.request(ctx, "/0/public/OHLC", params, &result); err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0)
+	for name, data := range result {
+		if name == "last" {
+			continue
+		}
+
+		// time, open, high, low, close, vwap, volume and count
+		var rows [][]interface{}
+		if err := json.Unmarshal(data, &rows); err != nil {
+			return nil, err
+		}
+
+		for i, row := range rows {
+			if i == len(rows)-1 {
+				break
+			}
+
+			candle, err := krakenCandle(pair, row)
+			if err != nil {
+				return nil, err
+			}
+			candles = append(candles, candle)
+		}
+	}
+
+	return candles, nil
+}
+
+func krakenCandle(pair string, row []interface{}) (model.Candle, error) {
+	if len(row) < 7 {
+		return model.Candle{}, fmt.Errorf("invalid kraken candle: %v", row)
+	}
+
+	start, ok := row[0].(float64)
+	if !ok {
+		return model.Candle{}, fmt.Errorf("invalid kraken candle time: %v", row[0])
+	}
+
+	t := time.Unix(int64(start), 0)
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Complete: true, Metadata: make(map[string]float64)}
+	for i, target := range map[int]*float64{
+		1: &candle.Open,
+		2: &candle.High,
+		3: &candle.Low,
+		4: &candle.Close,
+		6: &candle.Volume,
+	} {
+		value, err := strconv.ParseFloat(fmt.Sprint(row[i]), 64)
+		if err != nil {
+			return model.Candle{}, err
+		}
+		*target = value
+	}
+	return candle, nil
+}
+
+func (k *Kraken) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	candles, err := k.candles(ctx, pair, period, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	if k.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// CandlesByPeriod returns the candles of a period, limited to the last 720 candles of the timeframe
+// available in the Kraken API
+func (k *Kraken) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	data, err := k.candles(ctx, pair, period, start.Add(-time.Second))
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0, len(data))
+	for _, candle := range data {
+		if !candle.Time.Before(start) && !candle.Time.After(end) {
+			candles = append(candles, candle)
+		}
+	}
+
+	if k.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// krakenMessage is a message of the websocket API
+type krakenMessage struct {
+	Channel string          `json:"channel"`
+	Type    string          `json:"type"`
+	Method  string          `json:"method"`
+	Success *bool           `json:"success"`
+	Error   string          `json:"error"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// stream subscribes to a public channel and sends its messages to the handler, it reconnects until the
+// context is done
+func (k *Kraken) stream(ctx context.Context, params map[string]interface{}, handler func(krakenMessage),
+	cerr chan error) {
+
+	ba := &backoff.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 1 * time.Second,
+	}
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	subscribe := map[string]interface{}{"method": "subscribe", "params": params}
+	ping := map[string]string{"method": "ping"}
+	for {
+		done, stop, err := wsServeJSON(k.StreamEndpoint, []interface{}{subscribe}, ping, func(data []byte) {
+			var message krakenMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				return
+			}
+
+			if message.Success != nil && !*message.Success {
+				sendErr(&KrakenError{Code: "stream", Message: message.Error})
+				return
+			}
+			if message.Channel != params["channel"] || len(message.Data) == 0 {
+				return
+			}
+
+			ba.Reset()
+			handler(message)
+		}, sendErr)
+		if err != nil {
+			sendErr(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ba.Duration()):
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// wait for the stream handlers before closing the channels
+			close(stop)
+			<-done
+			return
+		case <-done:
+			time.Sleep(ba.Duration())
+		}
+	}
+}
+
+// CandlesSubscription streams the candles of the ohlc channel. Kraken sends the current candle on each
+// trade, so the previous candle is complete when a trade of the next period happens.
+func (k *Kraken) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		defer close(cerr)
+		defer close(ccandle)
+
+		interval, err := krakenInterval(period)
+		if err != nil {
+			cerr <- err
+			return
+		}
+
+		var last *model.Candle
+		params := map[string]interface{}{
+			"channel":  "ohlc",
+			"symbol":   []string{k.symbol(pair)},
+			"interval": interval,
+			"snapshot": false,
+		}
+		k.stream(ctx, params, func(message krakenMessage) {
+			var data []struct {
+				Open          float64   `json:"open"`
+				High          float64   `json:"high"`
+				Low           float64   `json:"low"`
+				Close         float64   `json:"close"`
+				Volume        float64   `json:"volume"`
+				IntervalBegin time.Time `json:"interval_begin"`
+				Timestamp     time.Time `json:"timestamp"`
+			}
+			if err := json.Unmarshal(message.Data, &data); err != nil {
+				log.Warn(err)
+				return
+			}
+
+			for _, item := range data {
+				candle := model.Candle{
+					Pair:      pair,
+					Time:      item.IntervalBegin,
+					UpdatedAt: item.Timestamp,
+					Open:      item.Open,
+					High:      item.High,
+					Low:       item.Low,
+					Close:     item.Close,
+					Volume:    item.Volume,
+					Metadata:  make(map[string]float64),
+				}
+
+				candles := []model.Candle{candle}
+				if last != nil && candle.Time.After(last.Time) {
+					complete := *last
+					complete.Complete = true
+					if k.HeikinAshi {
+						complete = complete.ToHeikinAshi(ha)
+					}
+					// fetch aditional data if needed
+					fetchMetadata(ctx, k.MetadataFetchers, k.MetadataTimeout, &k.metadataKeys, &complete)
+					candles = []model.Candle{complete, candle}
+				}
+				if last == nil || !candle.Time.Before(last.Time) {
+					last = &candle
+				}
+
+				for _, candle := range candles {
+					select {
+					case ccandle <- candle:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}, cerr)
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (k *Kraken) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("kraken")
+}
+
+// KrakenTicker is an update of the ticker channel
+type KrakenTicker struct {
+	Pair   string
+	Bid    float64
+	Ask    float64
+	Last   float64
+	Volume float64
+}
+
+// TickerSubscription streams the best prices and the last trade price of a pair
+func (k *Kraken) TickerSubscription(ctx context.Context, pair string) (chan KrakenTicker, chan error) {
+	cticker := make(chan KrakenTicker)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cerr)
+		defer close(cticker)
+
+		params := map[string]interface{}{
+			"channel": "ticker",
+			"symbol":  []string{k.symbol(pair)},
+		}
+		k.stream(ctx, params, func(message krakenMessage) {
+			var data []struct {
+				Symbol string  `json:"symbol"`
+				Bid    float64 `json:"bid"`
+				Ask    float64 `json:"ask"`
+				Last   float64 `json:"last"`
+				Volume float64 `json:"volume"`
+			}
+			if err := json.Unmarshal(message.Data, &data); err != nil {
+				log.Warn(err)
+				return
+			}
+
+			for _, item := range data {
+				select {
+				case cticker <- KrakenTicker{Pair: k.pair(item.Symbol), Bid: item.Bid, Ask: item.Ask,
+					Last: item.Last, Volume: item.Volume}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}, cerr)
+	}()
+
+	return cticker, cerr
+}
@@ -0,0 +1,411 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+var krakenSecret = base64.StdEncoding.EncodeToString([]byte("kraken secret"))
+
+// krakenServer emulates the subset of the Kraken API used by the Kraken exchange
+type krakenServer struct {
+	*httptest.Server
+	mtx    sync.Mutex
+	lastID int
+	orders map[string]krakenOrder
+	params []map[string]string
+}
+
+func newKrakenServer(t *testing.T) *krakenServer {
+	s := &krakenServer{orders: make(map[string]krakenOrder)}
+
+	reply := func(w http.ResponseWriter, result interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{}, "result": result})
+	}
+	mux := http.NewServeMux()
+	handle := func(path string, handler func(w http.ResponseWriter, params map[string]string)) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodPost, r.Method)
+			require.NoError(t, r.ParseForm())
+
+			// verify the signature of private requests
+			secret, _ := base64.StdEncoding.DecodeString(krakenSecret)
+			digest := sha256.Sum256([]byte(r.PostForm.Get("nonce") + r.PostForm.Encode()))
+			mac := hmac.New(sha512.New, secret)
+			mac.Write(append([]byte(r.URL.Path), digest[:]...))
+			require.Equal(t, base64.StdEncoding.EncodeToString(mac.Sum(nil)), r.Header.Get("API-Sign"))
+			require.Equal(t, "key", r.Header.Get("API-Key"))
+
+			params := make(map[string]string)
+			for key := range r.PostForm {
+				params[key] = r.PostForm.Get(key)
+			}
+
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			s.params = append(s.params, params)
+			handler(w, params)
+		})
+	}
+
+	mux.HandleFunc("/0/public/Assets", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]interface{}{
+			"XXBT": map[string]string{"altname": "XBT"},
+			"ZUSD": map[string]string{"altname": "USD"},
+			"XETH": map[string]string{"altname": "ETH"},
+		})
+	})
+	mux.HandleFunc("/0/public/AssetPairs", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]krakenAssetPair{
+			"XXBTZUSD": {Altname: "XBTUSD", WSName: "XBT/USD", Base: "XXBT", Quote: "ZUSD", PairDecimals: 1,
+				LotDecimals: 8, CostDecimals: 5, OrderMin: "0.0001", TickSize: "0.1"},
+			"XETHXXBT": {Altname: "ETHXBT", WSName: "ETH/XBT", Base: "XETH", Quote: "XXBT", PairDecimals: 5,
+				LotDecimals: 8, CostDecimals: 10, OrderMin: "0.01"},
+		})
+	})
+	mux.HandleFunc("/0/public/Ticker", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "XBTUSD", r.URL.Query().Get("pair"))
+		reply(w, map[string]interface{}{"XXBTZUSD": map[string][]string{"c": {"101.5", "0.1"}}})
+	})
+	mux.HandleFunc("/0/public/OHLC", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "XBTUSD", r.URL.Query().Get("pair"))
+		require.Equal(t, "60", r.URL.Query().Get("interval"))
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+		// the last candle is in progress
+		reply(w, map[string]interface{}{
+			"XXBTZUSD": [][]interface{}{
+				{start, "100.0", "102.0", "99.0", "101.0", "100.5", "10.5", 5},
+				{start + 3600, "101.0", "103.0", "100.0", "102.0", "101.5", "11.5", 6},
+				{start + 7200, "102.0", "104.0", "101.0", "103.0", "102.5", "12.5", 7},
+			},
+			"last": start + 7200,
+		})
+	})
+
+	handle("/0/private/AddOrder", func(w http.ResponseWriter, params map[string]string) {
+		require.NotEmpty(t, params["nonce"])
+		s.lastID++
+		txid := "O" + strconv.Itoa(s.lastID) + "-ABCDE-FGHIJK"
+
+		order := krakenOrder{ClOrdID: params["cl_ord_id"], Status: "open", OpenTm: 1640995200.5, Vol: params["volume"]}
+		order.Descr.Pair, order.Descr.Type, order.Descr.OrderType = params["pair"], params["type"], params["ordertype"]
+		order.Descr.Price = params["price"]
+		if order.Descr.OrderType == "market" {
+			order.Status, order.VolExec, order.Price, order.CloseTm = "closed", params["volume"], "101.5", 1640995201
+		}
+		s.orders[txid] = order
+		reply(w, map[string]interface{}{"txid": []string{txid}})
+	})
+	handle("/0/private/QueryOrders", func(w http.ResponseWriter, params map[string]string) {
+		order, ok := s.orders[params["txid"]]
+		if !ok {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": []string{"EOrder:Invalid order"}})
+			return
+		}
+		reply(w, map[string]krakenOrder{params["txid"]: order})
+	})
+	handle("/0/private/OpenOrders", func(w http.ResponseWriter, params map[string]string) {
+		open := make(map[string]krakenOrder)
+		for txid, order := range s.orders {
+			if order.Status == "open" && (params["cl_ord_id"] == "" || order.ClOrdID == params["cl_ord_id"]) {
+				open[txid] = order
+			}
+		}
+		reply(w, map[string]interface{}{"open": open})
+	})
+	handle("/0/private/ClosedOrders", func(w http.ResponseWriter, params map[string]string) {
+		txids := make([]string, 0)
+		for txid, order := range s.orders {
+			if order.Status != "open" && (params["cl_ord_id"] == "" || order.ClOrdID == params["cl_ord_id"]) {
+				txids = append(txids, txid)
+			}
+		}
+		sort.Strings(txids)
+
+		// pages of one order
+		offset, _ := strconv.Atoi(params["ofs"])
+		closed := make(map[string]krakenOrder)
+		if offset < len(txids) {
+			closed[txids[offset]] = s.orders[txids[offset]]
+		}
+		reply(w, map[string]interface{}{"closed": closed, "count": len(txids)})
+	})
+	handle("/0/private/CancelOrder", func(w http.ResponseWriter, params map[string]string) {
+		order := s.orders[params["txid"]]
+		order.Status = "canceled"
+		s.orders[params["txid"]] = order
+		reply(w, map[string]int{"count": 1})
+	})
+	handle("/0/private/BalanceEx", func(w http.ResponseWriter, params map[string]string) {
+		reply(w, map[string]interface{}{
+			"XXBT":  map[string]string{"balance": "0.5", "hold_trade": "0.1"},
+			"ZUSD":  map[string]string{"balance": "1000", "hold_trade": "100"},
+			"XETH":  map[string]string{"balance": "0", "hold_trade": "0"},
+			"XBT.F": map[string]string{"balance": "2", "hold_trade": "0"},
+		})
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var subscribe struct {
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		require.NoError(t, conn.ReadJSON(&subscribe))
+		require.Equal(t, "subscribe", subscribe.Method)
+		require.Equal(t, []interface{}{"BTC/USD"}, subscribe.Params["symbol"])
+		_ = conn.WriteJSON(map[string]interface{}{"method": "subscribe", "success": true})
+
+		switch subscribe.Params["channel"] {
+		case "ohlc":
+			require.Equal(t, 60.0, subscribe.Params["interval"])
+			for _, update := range []struct {
+				begin string
+				close float64
+			}{
+				{"2022-01-01T00:00:00Z", 101},
+				{"2022-01-01T00:00:00Z", 102},
+				{"2022-01-01T01:00:00Z", 103},
+			} {
+				_ = conn.WriteJSON(map[string]interface{}{
+					"channel": "ohlc", "type": "update",
+					"data": []map[string]interface{}{{
+						"symbol": "BTC/USD", "open": 100, "high": 104, "low": 99, "close": update.close,
+						"volume": 10, "interval_begin": update.begin, "timestamp": update.begin, "interval": 60,
+					}},
+				})
+			}
+		case "ticker":
+			_ = conn.WriteJSON(map[string]interface{}{
+				"channel": "ticker", "type": "snapshot",
+				"data": []map[string]interface{}{{"symbol": "BTC/USD", "bid": 101, "ask": 102, "last": 101.5,
+					"volume": 100}},
+			})
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+func newTestKraken(t *testing.T) (*Kraken, *krakenServer) {
+	server := newKrakenServer(t)
+	kraken, err := NewKraken(context.Background(),
+		WithKrakenCredentials("key", krakenSecret),
+		WithKrakenEndpoint(server.URL, "ws"+strings.TrimPrefix(server.URL, "http")+"/ws"),
+	)
+	require.NoError(t, err)
+	return kraken, server
+}
+
+func TestKraken(t *testing.T) {
+	t.Run("pair normalization", func(t *testing.T) {
+		kraken, _ := newTestKraken(t)
+		info := kraken.AssetsInfo("BTCUSD")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USD", info.QuoteAsset)
+		require.Equal(t, 0.0001, info.MinQuantity)
+		require.Equal(t, 0.00000001, info.StepSize)
+		require.Equal(t, 0.1, info.TickSize)
+		require.Equal(t, 8, info.BaseAssetPrecision)
+		require.Equal(t, 0.00001, kraken.AssetsInfo("ETHBTC").TickSize)
+
+		require.Equal(t, "XBTUSD", kraken.krakenPair("BTCUSD"))
+		require.Equal(t, "BTC/USD", kraken.symbol("BTCUSD"))
+		for _, name := range []string{"XXBTZUSD", "XBTUSD", "XBT/USD", "BTC/USD"} {
+			require.Equal(t, "BTCUSD", kraken.pair(name))
+		}
+
+		asset, quote := SplitAssetQuote("BTCUSD")
+		require.Equal(t, "BTC", asset)
+		require.Equal(t, "USD", quote)
+	})
+
+	t.Run("quotes and candles", func(t *testing.T) {
+		kraken, _ := newTestKraken(t)
+		quote, err := kraken.LastQuote(context.Background(), "BTCUSD")
+		require.NoError(t, err)
+		require.Equal(t, 101.5, quote)
+
+		candles, err := kraken.CandlesByLimit(context.Background(), "BTCUSD", "1h", 1)
+		require.NoError(t, err)
+		require.Len(t, candles, 1)
+		require.Equal(t, 102.0, candles[0].Close)
+		require.Equal(t, 11.5, candles[0].Volume)
+		require.True(t, candles[0].Complete)
+
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		candles, err = kraken.CandlesByPeriod(context.Background(), "BTCUSD", "1h", start, start.Add(30*time.Minute))
+		require.NoError(t, err)
+		require.Len(t, candles, 1)
+		require.Equal(t, start, candles[0].Time.UTC())
+
+		_, err = kraken.CandlesByLimit(context.Background(), "BTCUSD", "2h", 1)
+		require.Error(t, err)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		kraken, _ := newTestKraken(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		candles, _ := kraken.CandlesSubscription(ctx, "BTCUSD", "1h")
+		require.Equal(t, 101.0, (<-candles).Close)
+		require.Equal(t, 102.0, (<-candles).Close)
+
+		candle := <-candles
+		require.True(t, candle.Complete)
+		require.Equal(t, "BTCUSD", candle.Pair)
+		require.Equal(t, 102.0, candle.Close)
+		require.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), candle.Time.UTC())
+
+		candle = <-candles
+		require.False(t, candle.Complete)
+		require.Equal(t, 103.0, candle.Close)
+	})
+
+	t.Run("ticker subscription", func(t *testing.T) {
+		kraken, _ := newTestKraken(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tickers, _ := kraken.TickerSubscription(ctx, "BTCUSD")
+		require.Equal(t, KrakenTicker{Pair: "BTCUSD", Bid: 101, Ask: 102, Last: 101.5, Volume: 100}, <-tickers)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		kraken, server := newTestKraken(t)
+
+		market, err := kraken.CreateOrderMarket(model.SideTypeBuy, "BTCUSD", 0.5, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, model.SideTypeBuy, market.Side)
+		require.Equal(t, "BTCUSD", market.Pair)
+		require.Equal(t, 101.5, market.Price)
+		require.Equal(t, 0.5, market.Quantity)
+		require.Equal(t, "XBTUSD", server.params[0]["pair"])
+		require.Equal(t, "0.50000000", server.params[0]["volume"])
+
+		limit, err := kraken.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.5, 120.06)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, 120.0, limit.Price)
+
+		stop, err := kraken.CreateOrderStop("BTCUSD", 0.5, 90)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeSell, stop.Side)
+		require.Equal(t, 90.0, *stop.Stop)
+
+		quote, err := kraken.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSD", 203)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, quote.Quantity)
+
+		_, err = kraken.CreateOrderLimit(model.SideTypeSell, "BTCUSD", 0.00001, 120)
+		var orderError *OrderError
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+
+		orders, err := kraken.OpenOrders("BTCUSD")
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+
+		require.NoError(t, kraken.CancelOpenOrders("BTCUSD"))
+		orders, err = kraken.OpenOrders("BTCUSD")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+
+		// a new instance finds the order ids in the closed orders
+		restarted, err := NewKraken(context.Background(), WithKrakenCredentials("key", krakenSecret),
+			WithKrakenEndpoint(server.URL, ""))
+		require.NoError(t, err)
+		order, err := restarted.Order("BTCUSD", stop.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		require.Equal(t, stop.ExchangeID, order.ExchangeID)
+
+		_, err = restarted.Order("BTCUSD", 42)
+		require.Error(t, err)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		kraken, server := newTestKraken(t)
+
+		limit, err := kraken.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 120, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Regexp(t, "^[0-9a-f]{32}$", server.params[0]["cl_ord_id"])
+
+		market, err := kraken.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeBuy,
+			Type: model.OrderTypeMarket, Quantity: 0.5, ClientOrderID: "ninjabot-2"})
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+
+		_, err = kraken.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSD", Side: model.SideTypeBuy,
+			Type: model.OrderTypeStopLoss, Quantity: 0.5, Stop: 130, ClientOrderID: "ninjabot-3"})
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		found, err := kraken.OrderByClientID("BTCUSD", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, limit.ExchangeID, found.ExchangeID)
+		require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+		// closed orders are found too
+		found, err = kraken.OrderByClientID("BTCUSD", "ninjabot-2")
+		require.NoError(t, err)
+		require.Equal(t, market.ExchangeID, found.ExchangeID)
+
+		_, err = kraken.OrderByClientID("BTCUSD", "ninjabot-3")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		kraken, _ := newTestKraken(t)
+		account, err := kraken.Account()
+		require.NoError(t, err)
+		require.Equal(t, []model.Balance{
+			{Asset: "BTC", Free: 0.4, Lock: 0.1},
+			{Asset: "USD", Free: 900, Lock: 100},
+		}, account.Balances)
+
+		asset, quote, err := kraken.Position("BTCUSD")
+		require.NoError(t, err)
+		require.Equal(t, 0.5, asset)
+		require.Equal(t, 1000.0, quote)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		kraken, _ := newTestKraken(t)
+		err := kraken.request(context.Background(), "/0/private/QueryOrders", nil, nil)
+		var krakenError *KrakenError
+		require.ErrorAs(t, err, &krakenError)
+		require.Equal(t, "EOrder", krakenError.Code)
+		require.Equal(t, "Invalid order", krakenError.Message)
+	})
+}
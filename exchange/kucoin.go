@@ -0,0 +1,1133 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	kucoinEndpoint = "https://api.kucoin.com"
+
+	// kucoinCandleLimit is the maximum number of candles returned by a request
+	kucoinCandleLimit = 1500
+
+	kucoinSuccess          = "200000"
+	kucoinErrOrderNotFound = "400100"
+)
+
+// KuCoinError is an error returned by the KuCoin API
+type KuCoinError struct {
+	Code    string
+	Message string
+}
+
+func (e *KuCoinError) Error() string {
+	return fmt.Sprintf("kucoin error %s: %s", e.Code, e.Message)
+}
+
+type kucoinSymbol struct {
+	Symbol         string `json:"symbol"`
+	BaseCurrency   string `json:"baseCurrency"`
+	QuoteCurrency  string `json:"quoteCurrency"`
+	BaseMinSize    string `json:"baseMinSize"`
+	BaseMaxSize    string `json:"baseMaxSize"`
+	BaseIncrement  string `json:"baseIncrement"`
+	QuoteIncrement string `json:"quoteIncrement"`
+	PriceIncrement string `json:"priceIncrement"`
+}
+
+// KuCoin is the KuCoin spot exchange. Pairs keep the ninjabot format, eg: BTCUSDT, and are translated to
+// KuCoin symbols, eg: BTC-USDT. KuCoin order ids are strings, so orders are created with a numeric client
+// order id (clientOid) used as the ninjabot ExchangeID.
+type KuCoin struct {
+	ctx        context.Context
+	client     *http.Client
+	assetsInfo map[string]model.AssetInfo
+	symbols    map[string]string
+	lastID     int64
+	HeikinAshi bool
+
+	APIKey     string
+	APISecret  string
+	Passphrase string
+
+	// Endpoint overrides the REST URL, eg: for a mock server. Websocket URLs are given by the API.
+	Endpoint string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+}
+
+type KuCoinOption func(*KuCoin)
+
+// WithKuCoinCredentials will set the credentials for KuCoin
+func WithKuCoinCredentials(key, secret, passphrase string) KuCoinOption {
+	return func(k *KuCoin) {
+		k.APIKey = key
+		k.APISecret = secret
+		k.Passphrase = passphrase
+	}
+}
+
+// WithKuCoinHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithKuCoinHeikinAshiCandle() KuCoinOption {
+	return func(k *KuCoin) {
+		k.HeikinAshi = true
+	}
+}
+
+// WithKuCoinMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithKuCoinMetadataFetcher(fetcher MetadataFetchers) KuCoinOption {
+	return func(k *KuCoin) {
+		k.MetadataFetchers = append(k.MetadataFetchers, fetcher)
+	}
+}
+
+// WithKuCoinEndpoint overrides the REST endpoint
+func WithKuCoinEndpoint(endpoint string) KuCoinOption {
+	return func(k *KuCoin) {
+		k.Endpoint = endpoint
+	}
+}
+
+// NewKuCoin will create a new KuCoin spot instance
+func NewKuCoin(ctx context.Context, options ...KuCoinOption) (*KuCoin, error) {
+	exchange := &KuCoin{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		Endpoint:        kucoinEndpoint,
+		lastID:          time.Now().UnixNano() / int64(time.Microsecond),
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	// Initialize with orders precision and assets limits
+	if err := exchange.loadSymbols(ctx); err != nil {
+		return nil, fmt.Errorf("kucoin ping fail: %w", err)
+	}
+
+	log.Info("[SETUP] Using KuCoin exchange")
+
+	return exchange, nil
+}
+
+func (k *KuCoin) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(k.APISecret))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// request sends a REST request, GET and DELETE params are sent in the query string, and POST params are
+// sent in a JSON body. Signed requests are authenticated with the HMAC signature of the timestamp, method,
+// path with the query and body.
+func (k *KuCoin) request(ctx context.Context, method, path string, params map[string]interface{},
+	signed bool, result interface{}) error {
+
+	var body []byte
+	requestPath := path
+	if method == http.MethodPost && params != nil {
+		var err error
+		body, err = json.Marshal(params)
+		if err != nil {
+			return err
+		}
+	} else if len(params) > 0 {
+		query := url.Values{}
+		for key, value := range params {
+			query.Set(key, fmt.Sprint(value))
+		}
+		requestPath += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, k.Endpoint+requestPath, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if signed {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		req.Header.Set("KC-API-KEY", k.APIKey)
+		req.Header.Set("KC-API-TIMESTAMP", timestamp)
+		req.Header.Set("KC-API-SIGN", k.sign(timestamp+method+requestPath+string(body)))
+		req.Header.Set("KC-API-PASSPHRASE", k.sign(k.Passphrase))
+		req.Header.Set("KC-API-KEY-VERSION", "2")
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Code string          `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("kucoin %s %s: status %d: %w", method, path, resp.StatusCode, err)
+	}
+
+	if response.Code != kucoinSuccess {
+		return &KuCoinError{Code: response.Code, Message: response.Msg}
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Data, result)
+}
+
+func (k *KuCoin) loadSymbols(ctx context.Context) error {
+	var symbols []kucoinSymbol
+	if err := k.request(ctx, http.MethodGet, "/api/v2/symbols", nil, false, &symbols); err != nil {
+		return err
+	}
+
+	k.assetsInfo = make(map[string]model.AssetInfo)
+	k.symbols = make(map[string]string)
+	for _, symbol := range symbols {
+		info := model.AssetInfo{
+			BaseAsset:  symbol.BaseCurrency,
+			QuoteAsset: symbol.QuoteCurrency,
+			MaxPrice:   math.MaxFloat64,
+		}
+		info.MinQuantity, _ = strconv.ParseFloat(symbol.BaseMinSize, 64)
+		info.MaxQuantity, _ = strconv.ParseFloat(symbol.BaseMaxSize, 64)
+		info.StepSize, _ = strconv.ParseFloat(symbol.BaseIncrement, 64)
+		info.TickSize, _ = strconv.ParseFloat(symbol.PriceIncrement, 64)
+		info.MinPrice = info.TickSize
+		info.BaseAssetPrecision = getDecimalPrecision(info.StepSize)
+		info.PricePrecision = getDecimalPrecision(info.TickSize)
+		quoteIncrement, _ := strconv.ParseFloat(symbol.QuoteIncrement, 64)
+		info.QuotePrecision = getDecimalPrecision(quoteIncrement)
+
+		pair := symbol.BaseCurrency + symbol.QuoteCurrency
+		k.assetsInfo[pair] = info
+		k.symbols[pair] = symbol.Symbol
+		RegisterPair(pair, symbol.BaseCurrency, symbol.QuoteCurrency)
+	}
+
+	return nil
+}
+
+// symbol returns the KuCoin symbol of a pair, eg: BTCUSDT => BTC-USDT
+func (k *KuCoin) symbol(pair string) string {
+	if symbol, ok := k.symbols[pair]; ok {
+		return symbol
+	}
+
+	asset, quote := SplitAssetQuote(pair)
+	return asset + "-" + quote
+}
+
+// pair returns the ninjabot pair of a KuCoin symbol, eg: BTC-USDT => BTCUSDT
+func (k *KuCoin) pair(symbol string) string {
+	return strings.ReplaceAll(symbol, "-", "")
+}
+
+func (k *KuCoin) LastQuote(ctx context.Context, pair string) (float64, error) {
+	var ticker struct {
+		Price string `json:"price"`
+	}
+	err := k.request(ctx, http.MethodGet, "/api/v1/market/orderbook/level1", map[string]interface{}{
+		"symbol": k.symbol(pair),
+	}, false, &ticker)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(ticker.Price, 64)
+}
+
+func (k *KuCoin) AssetsInfo(pair string) model.AssetInfo {
+	return k.assetsInfo[pair]
+}
+
+func (k *KuCoin) validate(pair string, quantity float64) error {
+	info, ok := k.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (k *KuCoin) formatPrice(pair string, value float64) string {
+	return formatStep(value, k.assetsInfo[pair].TickSize)
+}
+
+func (k *KuCoin) formatQuantity(pair string, value float64) string {
+	return formatStep(value, k.assetsInfo[pair].StepSize)
+}
+
+// createOrder places a regular or a stop order with a client order id, a new one when the id is zero, and
+// returns its current state
+func (k *KuCoin) createOrder(path, pair string, id int64, quantity float64,
+	params map[string]interface{}) (model.Order, error) {
+
+	if quantity > 0 {
+		if err := k.validate(pair, quantity); err != nil {
+			return model.Order{}, err
+		}
+		params["size"] = k.formatQuantity(pair, quantity)
+	}
+
+	if id == 0 {
+		id = atomic.AddInt64(&k.lastID, 1)
+	}
+	params["clientOid"] = strconv.FormatInt(id, 10)
+	params["symbol"] = k.symbol(pair)
+
+	if err := k.request(k.ctx, http.MethodPost, path, params, true, nil); err != nil {
+		return model.Order{}, err
+	}
+	return k.Order(pair, id)
+}
+
+func (k *KuCoin) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: kucoin oco", ErrUnsupportedOrder)
+}
+
+func (k *KuCoin) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return k.createOrderLimit(side, pair, quantity, limit, 0)
+}
+
+func (k *KuCoin) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+
+	return k.createOrder("/api/v1/orders", pair, id, quantity, map[string]interface{}{
+		"side":  strings.ToLower(string(side)),
+		"type":  "limit",
+		"price": k.formatPrice(pair, limit),
+	})
+}
+
+func (k *KuCoin) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	_ bool) (model.Order, error) {
+	return k.createOrderMarket(side, pair, quantity, 0)
+}
+
+func (k *KuCoin) createOrderMarket(side model.SideType, pair string, quantity float64,
+	id int64) (model.Order, error) {
+
+	return k.createOrder("/api/v1/orders", pair, id, quantity, map[string]interface{}{
+		"side": strings.ToLower(string(side)),
+		"type": "market",
+	})
+}
+
+func (k *KuCoin) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	return k.createOrderMarketQuote(side, pair, quote, 0)
+}
+
+func (k *KuCoin) createOrderMarketQuote(side model.SideType, pair string, quote float64,
+	id int64) (model.Order, error) {
+	if _, ok := k.assetsInfo[pair]; !ok {
+		return model.Order{}, ErrInvalidAsset
+	}
+
+	return k.createOrder("/api/v1/orders", pair, id, 0, map[string]interface{}{
+		"side":  strings.ToLower(string(side)),
+		"type":  "market",
+		"funds": strconv.FormatFloat(quote, 'f', k.assetsInfo[pair].QuotePrecision, 64),
+	})
+}
+
+// CreateOrderStop places a sell stop market order triggered when the price falls to the limit price
+func (k *KuCoin) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	return k.createOrderStop(pair, quantity, limit, 0)
+}
+
+func (k *KuCoin) createOrderStop(pair string, quantity float64, limit float64, id int64) (model.Order, error) {
+	return k.createOrder("/api/v1/stop-order", pair, id, quantity, map[string]interface{}{
+		"side":      "sell",
+		"type":      "market",
+		"stop":      "loss",
+		"stopPrice": k.formatPrice(pair, limit),
+	})
+}
+
+// TakeProfit places a stop limit order triggered when the price reaches the limit, as a sell above or a buy
+// below the market price
+func (k *KuCoin) TakeProfit(side model.SideType, pair string, quantity float64, limit float64) (model.Order, error) {
+	return k.takeProfit(side, pair, quantity, limit, 0)
+}
+
+func (k *KuCoin) takeProfit(side model.SideType, pair string, quantity float64, limit float64,
+	id int64) (model.Order, error) {
+	stop := "entry"
+	if side == model.SideTypeBuy {
+		stop = "loss"
+	}
+
+	return k.createOrder("/api/v1/stop-order", pair, id, quantity, map[string]interface{}{
+		"side":      strings.ToLower(string(side)),
+		"type":      "limit",
+		"price":     k.formatPrice(pair, limit),
+		"stop":      stop,
+		"stopPrice": k.formatPrice(pair, limit),
+	})
+}
+
+// CreateOrderRequest places an order with the client order ID of the request. The clientOid of the order,
+// its ExchangeID, is a number derived from the client order ID.
+func (k *KuCoin) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	id := clientOrderNumber(request.ClientOrderID)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: kucoin time in force %s", ErrUnsupportedOrder, request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: kucoin iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = k.createOrderLimit(request.Side, request.Pair, request.Quantity, request.Price, id)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			order, err = k.createOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity, id)
+		} else {
+			order, err = k.createOrderMarket(request.Side, request.Pair, request.Quantity, id)
+		}
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		if request.Side == model.SideTypeBuy {
+			return model.Order{}, fmt.Errorf("%w: kucoin buy stop", ErrUnsupportedOrder)
+		}
+		order, err = k.createOrderStop(request.Pair, request.Quantity, request.Stop, id)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = k.takeProfit(request.Side, request.Pair, request.Quantity, request.Stop, id)
+	default:
+		return model.Order{}, fmt.Errorf("%w: kucoin %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns the order of a client order ID, or ErrOrderNotFound
+func (k *KuCoin) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	order, err := k.findOrder(pair, clientOrderNumber(clientOrderID))
+	if err != nil {
+		return model.Order{}, err
+	}
+	if order == nil {
+		return model.Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, clientOrderID)
+	}
+
+	order.ClientOrderID = clientOrderID
+	return *order, nil
+}
+
+func isKuCoinStopOrder(order model.Order) bool {
+	return order.Stop != nil
+}
+
+func (k *KuCoin) Cancel(order model.Order) error {
+	id := strconv.FormatInt(order.ExchangeID, 10)
+	if isKuCoinStopOrder(order) && order.Status == model.OrderStatusTypeNew {
+		return k.request(k.ctx, http.MethodDelete, "/api/v1/stop-order/cancelOrderByClientOid",
+			map[string]interface{}{"clientOid": id, "symbol": k.symbol(order.Pair)}, true, nil)
+	}
+	return k.request(k.ctx, http.MethodDelete, "/api/v1/order/client-order/"+id, nil, true, nil)
+}
+
+func (k *KuCoin) CancelOpenOrders(pair string) error {
+	params := map[string]interface{}{"symbol": k.symbol(pair)}
+	if err := k.request(k.ctx, http.MethodDelete, "/api/v1/orders", params, true, nil); err != nil {
+		return err
+	}
+	return k.request(k.ctx, http.MethodDelete, "/api/v1/stop-order/cancel", params, true, nil)
+}
+
+// pages requests all pages of a paginated list of orders
+func (k *KuCoin) pages(path string, params map[string]interface{}) ([]kucoinOrder, error) {
+	orders := make([]kucoinOrder, 0)
+	for page := 1; ; page++ {
+		params["currentPage"] = page
+		var result struct {
+			TotalPage int           `json:"totalPage"`
+			Items     []kucoinOrder `json:"items"`
+		}
+		if err := k.request(k.ctx, http.MethodGet, path, params, true, &result); err != nil {
+			return nil, err
+		}
+
+		orders = append(orders, result.Items...)
+		if page >= result.TotalPage || len(result.Items) == 0 {
+			return orders, nil
+		}
+	}
+}
+
+func (k *KuCoin) OpenOrders(pair string) ([]model.Order, error) {
+	active, err := k.pages("/api/v1/orders", map[string]interface{}{
+		"status": "active",
+		"symbol": k.symbol(pair),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stops, err := k.pages("/api/v1/stop-order", map[string]interface{}{
+		"symbol": k.symbol(pair),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(active)+len(stops))
+	for _, order := range active {
+		orders = append(orders, k.order(order))
+	}
+	for _, order := range stops {
+		orders = append(orders, k.stopOrder(order))
+	}
+	return orders, nil
+}
+
+// Order returns an order by its client order id, a stop order is returned while it is not triggered, and
+// then the order created by the trigger
+func (k *KuCoin) Order(pair string, id int64) (model.Order, error) {
+	order, err := k.findOrder(pair, id)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if order == nil {
+		return model.Order{}, fmt.Errorf("kucoin order %d not found", id)
+	}
+	return *order, nil
+}
+
+// findOrder returns an order by its client order id, nil when it is not found
+func (k *KuCoin) findOrder(pair string, id int64) (*model.Order, error) {
+	clientOid := strconv.FormatInt(id, 10)
+
+	var order kucoinOrder
+	err := k.request(k.ctx, http.MethodGet, "/api/v1/order/client-order/"+clientOid, nil, true, &order)
+	var apiError *KuCoinError
+	if err != nil && (!errors.As(err, &apiError) || apiError.Code != kucoinErrOrderNotFound) {
+		return nil, err
+	}
+	if err == nil && order.ID != "" {
+		result := k.order(order)
+		return &result, nil
+	}
+
+	var stops []kucoinOrder
+	err = k.request(k.ctx, http.MethodGet, "/api/v1/stop-order/queryOrderByClientOid", map[string]interface{}{
+		"clientOid": clientOid,
+		"symbol":    k.symbol(pair),
+	}, true, &stops)
+	if err != nil {
+		return nil, err
+	}
+	if len(stops) == 0 {
+		return nil, nil
+	}
+	result := k.stopOrder(stops[0])
+	return &result, nil
+}
+
+type kucoinOrder struct {
+	ID          string `json:"id"`
+	ClientOid   string `json:"clientOid"`
+	Symbol      string `json:"symbol"`
+	Type        string `json:"type"`
+	Side        string `json:"side"`
+	Price       string `json:"price"`
+	Size        string `json:"size"`
+	DealFunds   string `json:"dealFunds"`
+	DealSize    string `json:"dealSize"`
+	Stop        string `json:"stop"`
+	StopPrice   string `json:"stopPrice"`
+	Status      string `json:"status"`
+	IsActive    bool   `json:"isActive"`
+	CancelExist bool   `json:"cancelExist"`
+	CreatedAt   int64  `json:"createdAt"`
+}
+
+func kucoinTime(milliseconds int64) time.Time {
+	return time.Unix(0, milliseconds*int64(time.Millisecond))
+}
+
+// kucoinStopType returns the type of a stop order, by the stop direction and the order side
+func kucoinStopType(stop, side, orderType string) model.OrderType {
+	takeProfit := (stop == "entry") == (side == "sell")
+	switch {
+	case takeProfit && orderType == "limit":
+		return model.OrderTypeTakeProfitLimit
+	case takeProfit:
+		return model.OrderTypeTakeProfit
+	case orderType == "limit":
+		return model.OrderTypeStopLossLimit
+	}
+	return model.OrderTypeStopLoss
+}
+
+func (k *KuCoin) order(order kucoinOrder) model.Order {
+	id, _ := strconv.ParseInt(order.ClientOid, 10, 64)
+	result := model.Order{
+		ExchangeID: id,
+		Pair:       k.pair(order.Symbol),
+		Side:       model.SideType(strings.ToUpper(order.Side)),
+		Type:       model.OrderTypeLimit,
+		CreatedAt:  kucoinTime(order.CreatedAt),
+		UpdatedAt:  kucoinTime(order.CreatedAt),
+	}
+	if order.Type == "market" {
+		result.Type = model.OrderTypeMarket
+	}
+	if order.Stop != "" {
+		result.Type = kucoinStopType(order.Stop, order.Side, order.Type)
+		stop, _ := strconv.ParseFloat(order.StopPrice, 64)
+		result.Stop = &stop
+	}
+
+	filled, _ := strconv.ParseFloat(order.DealSize, 64)
+	funds, _ := strconv.ParseFloat(order.DealFunds, 64)
+	result.Price, _ = strconv.ParseFloat(order.Price, 64)
+	result.Quantity, _ = strconv.ParseFloat(order.Size, 64)
+	if filled > 0 {
+		result.Price = funds / filled
+	}
+
+	switch {
+	case order.IsActive && filled > 0:
+		result.Status = model.OrderStatusTypePartiallyFilled
+	case order.IsActive:
+		result.Status = model.OrderStatusTypeNew
+	case order.CancelExist:
+		result.Status = model.OrderStatusTypeCanceled
+	default:
+		result.Status = model.OrderStatusTypeFilled
+		result.Quantity = filled
+	}
+
+	return result
+}
+
+func (k *KuCoin) stopOrder(order kucoinOrder) model.Order {
+	result := k.order(order)
+	result.Type = kucoinStopType(order.Stop, order.Side, order.Type)
+	stop, _ := strconv.ParseFloat(order.StopPrice, 64)
+	result.Stop = &stop
+	if result.Price == 0 {
+		result.Price = stop
+	}
+
+	// the stop order is replaced by a regular order when it is triggered
+	result.Status = model.OrderStatusTypeNew
+	if order.Status == "TRIGGERED" {
+		result.Status = model.OrderStatusTypeFilled
+	}
+	return result
+}
+
+func (k *KuCoin) Account() (model.Account, error) {
+	var accounts []struct {
+		Currency  string `json:"currency"`
+		Available string `json:"available"`
+		Holds     string `json:"holds"`
+	}
+	err := k.request(k.ctx, http.MethodGet, "/api/v1/accounts", map[string]interface{}{"type": "trade"},
+		true, &accounts)
+	if err != nil {
+		return model.Account{}, err
+	}
+
+	balances := make([]model.Balance, 0, len(accounts))
+	for _, account := range accounts {
+		free, err := strconv.ParseFloat(account.Available, 64)
+		if err != nil {
+			return model.Account{}, err
+		}
+		lock, _ := strconv.ParseFloat(account.Holds, 64)
+
+		if free == 0 && lock == 0 {
+			continue
+		}
+
+		balances = append(balances, model.Balance{
+			Asset: account.Currency,
+			Free:  free,
+			Lock:  lock,
+		})
+	}
+
+	return model.Account{Balances: balances}, nil
+}
+
+func (k *KuCoin) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	acc, err := k.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
+
+// PositionRisk returns the size of the position, KuCoin does not provide position details
+func (k *KuCoin) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(k, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, KuCoin does not support amending orders
+func (k *KuCoin) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(k, order, price, quantity)
+}
+
+// kucoinCandleType converts a ninjabot timeframe into a KuCoin candle type, eg: 1h => 1hour
+func kucoinCandleType(period string) (string, error) {
+	if len(period) < 2 {
+		return "", fmt.Errorf("invalid kucoin candle type %s", period)
+	}
+
+	value, unit := period[:len(period)-1], period[len(period)-1:]
+	switch period {
+	case "1m", "3m", "5m", "15m", "30m":
+		unit = "min"
+	case "1h", "2h", "4h", "6h", "8h", "12h":
+		unit = "hour"
+	case "1d":
+		unit = "day"
+	case "1w":
+		unit = "week"
+	default:
+		return "", fmt.Errorf("invalid kucoin candle type %s", period)
+	}
+	return value + unit, nil
+}
+
+// kucoinCandle converts a KuCoin candle: start time, open, close, high, low, volume and turnover
+func kucoinCandle(pair string, data []string) (model.Candle, error) {
+	if len(data) < 6 {
+		return model.Candle{}, fmt.Errorf("invalid kucoin candle: %v", data)
+	}
+
+	start, err := strconv.ParseInt(data[0], 10, 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+
+	t := time.Unix(start, 0)
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Metadata: make(map[string]float64)}
+	for i, target := range []*float64{&candle.Open, &candle.Close, &candle.High, &candle.Low, &candle.Volume} {
+		*target, err = strconv.ParseFloat(data[i+1], 64)
+		if err != nil {
+			return model.Candle{}, err
+		}
+	}
+	return candle, nil
+}
+
+// candles requests the candles of a period, up to kucoinCandleLimit, and returns the complete ones in
+// chronological order
+func (k *KuCoin) candles(ctx context.Context, pair, period string, start, end time.Time) ([]model.Candle, error) {
+	candleType, err := kucoinCandleType(period)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	var data [][]string
+	err = k.request(ctx, http.MethodGet, "/api/v1/market/candles", map[string]interface{}{
+		"symbol":  k.symbol(pair),
+		"type":    candleType,
+		"startAt": start.Unix(),
+		"endAt":   end.Unix(),
+	}, false, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	candles := make([]model.Candle, 0, len(data))
+	for _, item := range data {
+		candle, err := kucoinCandle(pair, item)
+		if err != nil {
+			return nil, err
+		}
+
+		// the last candle is in progress until the end of its period
+		if candle.Time.Add(duration).After(now) {
+			continue
+		}
+		candle.Complete = true
+		candles = append(candles, candle)
+	}
+
+	// kucoin returns the newest candles first
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return candles, nil
+}
+
+func (k *KuCoin) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	size := limit + 1
+	if size > kucoinCandleLimit {
+		size = kucoinCandleLimit
+	}
+
+	end := time.Now()
+	candles, err := k.candles(ctx, pair, period, end.Add(-time.Duration(size)*duration), end)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	if k.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// CandlesByPeriod returns the candles of a period, requested in pages of kucoinCandleLimit candles
+func (k *KuCoin) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	duration, err := str2duration.ParseDuration(period)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0)
+	for from := start; from.Before(end); from = from.Add(kucoinCandleLimit * duration) {
+		to := from.Add(kucoinCandleLimit * duration)
+		if to.After(end) {
+			to = end
+		}
+
+		data, err := k.candles(ctx, pair, period, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, candle := range data {
+			if candle.Time.Before(to) || (to.Equal(end) && !candle.Time.After(end)) {
+				candles = append(candles, candle)
+			}
+		}
+	}
+
+	if k.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// kucoinMessage is a message of the websocket API
+type kucoinMessage struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Topic   string          `json:"topic"`
+	Subject string          `json:"subject"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// stream connects to the websocket API and sends the messages of a topic to the handler, it reconnects
+// until the context is done. Each connection requests a token and a server from the REST API, and the
+// topic is subscribed after the welcome message of the server.
+func (k *KuCoin) stream(ctx context.Context, topic string, private bool, handler func(kucoinMessage),
+	cerr chan error) {
+
+	ba := &backoff.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 5 * time.Second,
+	}
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	path := "/api/v1/bullet-public"
+	if private {
+		path = "/api/v1/bullet-private"
+	}
+
+	for {
+		var bullet struct {
+			Token           string `json:"token"`
+			InstanceServers []struct {
+				Endpoint string `json:"endpoint"`
+			} `json:"instanceServers"`
+		}
+		err := k.request(ctx, http.MethodPost, path, nil, private, &bullet)
+		if err == nil && len(bullet.InstanceServers) == 0 {
+			err = errors.New("kucoin websocket server not found")
+		}
+
+		var done, stop chan struct{}
+		if err == nil {
+			connectID := strconv.FormatInt(time.Now().UnixNano(), 10)
+			endpoint := fmt.Sprintf("%s?token=%s&connectId=%s", bullet.InstanceServers[0].Endpoint,
+				url.QueryEscape(bullet.Token), connectID)
+			subscribe := map[string]interface{}{
+				"id":             connectID,
+				"type":           "subscribe",
+				"topic":          topic,
+				"privateChannel": private,
+				"response":       true,
+			}
+			ping := map[string]string{"id": connectID, "type": "ping"}
+
+			done, stop, err = wsConnect(endpoint, nil, ping, func(conn *wsConn, data []byte) {
+				var message kucoinMessage
+				if err := json.Unmarshal(data, &message); err != nil {
+					return
+				}
+
+				switch message.Type {
+				case "welcome":
+					if err := conn.send(subscribe); err != nil {
+						sendErr(err)
+					}
+				case "error":
+					sendErr(&KuCoinError{Code: "stream", Message: string(message.Data)})
+				case "message":
+					if message.Topic == topic {
+						ba.Reset()
+						handler(message)
+					}
+				}
+			}, sendErr)
+		}
+		if err != nil {
+			sendErr(err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ba.Duration()):
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			// wait for the stream handlers before closing the channels
+			close(stop)
+			<-done
+			return
+		case <-done:
+			time.Sleep(ba.Duration())
+		}
+	}
+}
+
+// CandlesSubscription streams the candles of a pair. KuCoin sends the current candle on each trade, so
+// the previous candle is complete when a trade of the next period happens.
+func (k *KuCoin) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		defer close(cerr)
+		defer close(ccandle)
+
+		candleType, err := kucoinCandleType(period)
+		if err != nil {
+			cerr <- err
+			return
+		}
+
+		var last *model.Candle
+		topic := fmt.Sprintf("/market/candles:%s_%s", k.symbol(pair), candleType)
+		k.stream(ctx, topic, false, func(message kucoinMessage) {
+			var data struct {
+				Candles []string `json:"candles"`
+				Time    int64    `json:"time"`
+			}
+			if err := json.Unmarshal(message.Data, &data); err != nil {
+				log.Warn(err)
+				return
+			}
+
+			candle, err := kucoinCandle(pair, data.Candles)
+			if err != nil {
+				log.Warn(err)
+				return
+			}
+			candle.UpdatedAt = time.Unix(0, data.Time)
+
+			candles := []model.Candle{candle}
+			if last != nil && candle.Time.After(last.Time) {
+				complete := *last
+				complete.Complete = true
+				if k.HeikinAshi {
+					complete = complete.ToHeikinAshi(ha)
+				}
+				// fetch aditional data if needed
+				fetchMetadata(ctx, k.MetadataFetchers, k.MetadataTimeout, &k.metadataKeys, &complete)
+				candles = []model.Candle{complete, candle}
+			}
+			if last == nil || !candle.Time.Before(last.Time) {
+				last = &candle
+			}
+
+			for _, candle := range candles {
+				select {
+				case ccandle <- candle:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}, cerr)
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (k *KuCoin) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("kucoin")
+}
+
+type kucoinOrderUpdate struct {
+	Symbol     string `json:"symbol"`
+	OrderType  string `json:"orderType"`
+	Side       string `json:"side"`
+	Type       string `json:"type"`
+	OrderTime  int64  `json:"orderTime"`
+	Size       string `json:"size"`
+	FilledSize string `json:"filledSize"`
+	Price      string `json:"price"`
+	ClientOid  string `json:"clientOid"`
+	Ts         int64  `json:"ts"`
+}
+
+// orderUpdate converts an order event, the final state of filled and canceled orders is requested to the
+// REST API for their average price
+func (k *KuCoin) orderUpdate(update kucoinOrderUpdate) model.Order {
+	id, _ := strconv.ParseInt(update.ClientOid, 10, 64)
+	pair := k.pair(update.Symbol)
+	if update.Type == "filled" || update.Type == "canceled" {
+		order, err := k.Order(pair, id)
+		if err == nil {
+			return order
+		}
+		log.Warnf("kucoin: order %d: %v", id, err)
+	}
+
+	filled, _ := strconv.ParseFloat(update.FilledSize, 64)
+	order := model.Order{
+		ExchangeID: id,
+		Pair:       pair,
+		Side:       model.SideType(strings.ToUpper(update.Side)),
+		Type:       model.OrderTypeLimit,
+		Status:     model.OrderStatusTypeNew,
+		CreatedAt:  time.Unix(0, update.OrderTime),
+		UpdatedAt:  time.Unix(0, update.Ts),
+	}
+	if update.OrderType == "market" {
+		order.Type = model.OrderTypeMarket
+	}
+	order.Price, _ = strconv.ParseFloat(update.Price, 64)
+	order.Quantity, _ = strconv.ParseFloat(update.Size, 64)
+
+	switch {
+	case update.Type == "filled":
+		order.Status, order.Quantity = model.OrderStatusTypeFilled, filled
+	case update.Type == "canceled":
+		order.Status = model.OrderStatusTypeCanceled
+	case filled > 0:
+		order.Status = model.OrderStatusTypePartiallyFilled
+	}
+	return order
+}
+
+// AccountSubscription streams the order updates of the private order channel, it reconnects until the
+// context is done
+func (k *KuCoin) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cerr)
+		defer close(corder)
+
+		k.stream(ctx, "/spotMarket/tradeOrdersV2", true, func(message kucoinMessage) {
+			var update kucoinOrderUpdate
+			if err := json.Unmarshal(message.Data, &update); err != nil {
+				log.Warn(err)
+				return
+			}
+
+			select {
+			case corder <- k.orderUpdate(update):
+			case <-ctx.Done():
+			}
+		}, cerr)
+	}()
+
+	return corder, cerr
+}
@@ -0,0 +1,494 @@
+package exchange
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// kucoinServer emulates the subset of the KuCoin API used by the KuCoin exchange
+type kucoinServer struct {
+	*httptest.Server
+	mtx    sync.Mutex
+	orders map[string]kucoinOrder
+	stops  map[string]kucoinOrder
+	params []map[string]interface{}
+}
+
+func newKuCoinServer(t *testing.T) *kucoinServer {
+	s := &kucoinServer{orders: make(map[string]kucoinOrder), stops: make(map[string]kucoinOrder)}
+
+	reply := func(w http.ResponseWriter, data interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": kucoinSuccess, "data": data})
+	}
+	mux := http.NewServeMux()
+	handle := func(path string, handler func(w http.ResponseWriter, r *http.Request, params map[string]interface{})) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			// verify the signature of private requests
+			sign := func(payload string) string {
+				mac := hmac.New(sha256.New, []byte("secret"))
+				mac.Write([]byte(payload))
+				return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+			}
+			payload := r.Header.Get("KC-API-TIMESTAMP") + r.Method + r.URL.RequestURI() + string(body)
+			require.Equal(t, sign(payload), r.Header.Get("KC-API-SIGN"))
+			require.Equal(t, sign("passphrase"), r.Header.Get("KC-API-PASSPHRASE"))
+			require.Equal(t, "key", r.Header.Get("KC-API-KEY"))
+			require.Equal(t, "2", r.Header.Get("KC-API-KEY-VERSION"))
+
+			params := make(map[string]interface{})
+			if len(body) > 0 {
+				require.NoError(t, json.Unmarshal(body, &params))
+			}
+
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			s.params = append(s.params, params)
+			handler(w, r, params)
+		})
+	}
+
+	mux.HandleFunc("/api/v2/symbols", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, []kucoinSymbol{{Symbol: "BTC-USDT", BaseCurrency: "BTC", QuoteCurrency: "USDT",
+			BaseMinSize: "0.00001", BaseMaxSize: "10000", BaseIncrement: "0.00000001", QuoteIncrement: "0.000001",
+			PriceIncrement: "0.1"}})
+	})
+	mux.HandleFunc("/api/v1/market/orderbook/level1", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTC-USDT", r.URL.Query().Get("symbol"))
+		reply(w, map[string]string{"price": "101.5"})
+	})
+	mux.HandleFunc("/api/v1/market/candles", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "BTC-USDT", r.URL.Query().Get("symbol"))
+		require.Equal(t, "1hour", r.URL.Query().Get("type"))
+		startAt, _ := strconv.ParseInt(r.URL.Query().Get("startAt"), 10, 64)
+		endAt, _ := strconv.ParseInt(r.URL.Query().Get("endAt"), 10, 64)
+
+		// two complete candles and the candle in progress, the newest first
+		current := time.Now().Truncate(time.Hour)
+		rows := [][]string{
+			{strconv.FormatInt(current.Unix(), 10), "102", "103", "104", "101", "12.5", "1250"},
+			{strconv.FormatInt(current.Add(-time.Hour).Unix(), 10), "101", "102", "103", "100", "11.5", "1150"},
+			{"1640998800", "101", "102", "103", "100", "11.5", "1150"},
+			{"1640995200", "100", "101", "102", "99", "10.5", "1050"},
+		}
+		result := make([][]string, 0)
+		for _, row := range rows {
+			start, _ := strconv.ParseInt(row[0], 10, 64)
+			if start >= startAt && start <= endAt {
+				result = append(result, row)
+			}
+		}
+		reply(w, result)
+	})
+
+	handle("/api/v1/orders", func(w http.ResponseWriter, r *http.Request, params map[string]interface{}) {
+		switch r.Method {
+		case http.MethodPost:
+			order := kucoinOrder{ID: "id" + params["clientOid"].(string), ClientOid: params["clientOid"].(string),
+				Symbol: params["symbol"].(string), Type: params["type"].(string), Side: params["side"].(string),
+				IsActive: true, CreatedAt: 1640995200000}
+			order.Size, _ = params["size"].(string)
+			order.Price, _ = params["price"].(string)
+			if order.Type == "market" {
+				order.IsActive, order.DealFunds, order.DealSize = false, "50.75", "0.5"
+				if funds, ok := params["funds"].(string); ok {
+					order.DealFunds, order.DealSize = funds, "2"
+				}
+			}
+			s.orders[order.ClientOid] = order
+			reply(w, map[string]string{"orderId": order.ID})
+		case http.MethodGet:
+			require.Equal(t, "active", r.URL.Query().Get("status"))
+			page, _ := strconv.Atoi(r.URL.Query().Get("currentPage"))
+			items := make([]kucoinOrder, 0)
+			for _, order := range s.orders {
+				if order.IsActive {
+					items = append(items, order)
+				}
+			}
+			// pages of one order
+			result := make([]kucoinOrder, 0)
+			if page <= len(items) {
+				result = append(result, items[page-1])
+			}
+			reply(w, map[string]interface{}{"totalPage": len(items), "items": result})
+		case http.MethodDelete:
+			for id, order := range s.orders {
+				if order.IsActive {
+					order.IsActive, order.CancelExist = false, true
+					s.orders[id] = order
+				}
+			}
+			reply(w, nil)
+		}
+	})
+	handle("/api/v1/order/client-order/", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		order, ok := s.orders[strings.TrimPrefix(r.URL.Path, "/api/v1/order/client-order/")]
+		if !ok {
+			_ = json.NewEncoder(w).Encode(map[string]string{"code": kucoinErrOrderNotFound, "msg": "order not exist."})
+			return
+		}
+		if r.Method == http.MethodDelete {
+			order.IsActive, order.CancelExist = false, true
+			s.orders[order.ClientOid] = order
+		}
+		reply(w, order)
+	})
+	handle("/api/v1/stop-order", func(w http.ResponseWriter, r *http.Request, params map[string]interface{}) {
+		if r.Method == http.MethodGet {
+			items := make([]kucoinOrder, 0)
+			for _, order := range s.stops {
+				items = append(items, order)
+			}
+			reply(w, map[string]interface{}{"totalPage": 1, "items": items})
+			return
+		}
+		order := kucoinOrder{ID: "stop" + params["clientOid"].(string), ClientOid: params["clientOid"].(string),
+			Symbol: params["symbol"].(string), Type: params["type"].(string), Side: params["side"].(string),
+			Stop: params["stop"].(string), StopPrice: params["stopPrice"].(string), Size: params["size"].(string),
+			Status: "NEW", IsActive: true, CreatedAt: 1640995200000}
+		order.Price, _ = params["price"].(string)
+		s.stops[order.ClientOid] = order
+		reply(w, map[string]string{"orderId": order.ID})
+	})
+	handle("/api/v1/stop-order/queryOrderByClientOid", func(w http.ResponseWriter, r *http.Request,
+		_ map[string]interface{}) {
+		require.Equal(t, "BTC-USDT", r.URL.Query().Get("symbol"))
+		result := make([]kucoinOrder, 0)
+		if order, ok := s.stops[r.URL.Query().Get("clientOid")]; ok {
+			result = append(result, order)
+		}
+		reply(w, result)
+	})
+	handle("/api/v1/stop-order/cancelOrderByClientOid", func(w http.ResponseWriter, r *http.Request,
+		_ map[string]interface{}) {
+		require.Equal(t, http.MethodDelete, r.Method)
+		delete(s.stops, r.URL.Query().Get("clientOid"))
+		reply(w, nil)
+	})
+	handle("/api/v1/stop-order/cancel", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		require.Equal(t, http.MethodDelete, r.Method)
+		s.stops = make(map[string]kucoinOrder)
+		reply(w, nil)
+	})
+	handle("/api/v1/accounts", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		require.Equal(t, "trade", r.URL.Query().Get("type"))
+		reply(w, []map[string]string{
+			{"currency": "BTC", "available": "0.4", "holds": "0.1"},
+			{"currency": "USDT", "available": "900", "holds": "100"},
+			{"currency": "ETH", "available": "0", "holds": "0"},
+		})
+	})
+
+	bullet := func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		reply(w, map[string]interface{}{
+			"token":           "token" + r.URL.Path,
+			"instanceServers": []map[string]string{{"endpoint": "ws" + strings.TrimPrefix(s.URL, "http") + "/ws"}},
+		})
+	}
+	mux.HandleFunc("/api/v1/bullet-public", bullet)
+	handle("/api/v1/bullet-private", func(w http.ResponseWriter, r *http.Request, _ map[string]interface{}) {
+		bullet(w, r)
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		private := r.URL.Query().Get("token") == "token/api/v1/bullet-private"
+		require.NotEmpty(t, r.URL.Query().Get("connectId"))
+		require.NoError(t, conn.WriteJSON(map[string]string{"id": r.URL.Query().Get("connectId"), "type": "welcome"}))
+
+		var subscribe struct {
+			ID             string `json:"id"`
+			Type           string `json:"type"`
+			Topic          string `json:"topic"`
+			PrivateChannel bool   `json:"privateChannel"`
+		}
+		require.NoError(t, conn.ReadJSON(&subscribe))
+		require.Equal(t, "subscribe", subscribe.Type)
+		require.Equal(t, private, subscribe.PrivateChannel)
+		_ = conn.WriteJSON(map[string]string{"id": subscribe.ID, "type": "ack"})
+
+		switch subscribe.Topic {
+		case "/market/candles:BTC-USDT_1hour":
+			for _, update := range []struct {
+				start string
+				close string
+			}{
+				{"1640995200", "101"},
+				{"1640995200", "102"},
+				{"1640998800", "103"},
+			} {
+				_ = conn.WriteJSON(map[string]interface{}{
+					"type": "message", "topic": subscribe.Topic, "subject": "trade.candles.update",
+					"data": map[string]interface{}{
+						"symbol":  "BTC-USDT",
+						"candles": []string{update.start, "100", update.close, "104", "99", "10", "1000"},
+						"time":    int64(1640995200000000000),
+					},
+				})
+			}
+		case "/spotMarket/tradeOrdersV2":
+			for _, update := range []map[string]interface{}{
+				{"type": "match", "filledSize": "0.2"},
+				{"type": "filled", "filledSize": "0.5"},
+			} {
+				update["symbol"], update["side"], update["orderType"] = "BTC-USDT", "buy", "limit"
+				update["clientOid"], update["size"], update["price"] = "1", "0.5", "100"
+				update["orderTime"], update["ts"] = int64(1640995200000000000), int64(1640995201000000000)
+				_ = conn.WriteJSON(map[string]interface{}{
+					"type": "message", "topic": subscribe.Topic, "subject": "orderChange", "data": update,
+				})
+			}
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Server.Close)
+	return s
+}
+
+func newTestKuCoin(t *testing.T) (*KuCoin, *kucoinServer) {
+	server := newKuCoinServer(t)
+	kucoin, err := NewKuCoin(context.Background(),
+		WithKuCoinCredentials("key", "secret", "passphrase"),
+		WithKuCoinEndpoint(server.URL),
+	)
+	require.NoError(t, err)
+	return kucoin, server
+}
+
+func TestKuCoin(t *testing.T) {
+	t.Run("symbols", func(t *testing.T) {
+		kucoin, _ := newTestKuCoin(t)
+		info := kucoin.AssetsInfo("BTCUSDT")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USDT", info.QuoteAsset)
+		require.Equal(t, 0.00001, info.MinQuantity)
+		require.Equal(t, 0.00000001, info.StepSize)
+		require.Equal(t, 0.1, info.TickSize)
+		require.Equal(t, 8, info.BaseAssetPrecision)
+		require.Equal(t, 6, info.QuotePrecision)
+
+		require.Equal(t, "BTC-USDT", kucoin.symbol("BTCUSDT"))
+		require.Equal(t, "BTCUSDT", kucoin.pair("BTC-USDT"))
+	})
+
+	t.Run("candle types", func(t *testing.T) {
+		for period, expected := range map[string]string{"1m": "1min", "4h": "4hour", "1d": "1day", "1w": "1week"} {
+			candleType, err := kucoinCandleType(period)
+			require.NoError(t, err)
+			require.Equal(t, expected, candleType)
+		}
+
+		_, err := kucoinCandleType("2m")
+		require.Error(t, err)
+	})
+
+	t.Run("quotes and candles", func(t *testing.T) {
+		kucoin, _ := newTestKuCoin(t)
+		quote, err := kucoin.LastQuote(context.Background(), "BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 101.5, quote)
+
+		candles, err := kucoin.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 1)
+		require.NoError(t, err)
+		require.Len(t, candles, 1)
+		require.Equal(t, 102.0, candles[0].Close)
+		require.Equal(t, 103.0, candles[0].High)
+		require.Equal(t, 11.5, candles[0].Volume)
+		require.True(t, candles[0].Complete)
+
+		start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		candles, err = kucoin.CandlesByPeriod(context.Background(), "BTCUSDT", "1h", start, start.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, start, candles[0].Time.UTC())
+		require.Equal(t, 101.0, candles[0].Close)
+		require.Equal(t, 102.0, candles[1].Close)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		kucoin, _ := newTestKuCoin(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		candles, _ := kucoin.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		require.Equal(t, 101.0, (<-candles).Close)
+		require.Equal(t, 102.0, (<-candles).Close)
+
+		candle := <-candles
+		require.True(t, candle.Complete)
+		require.Equal(t, "BTCUSDT", candle.Pair)
+		require.Equal(t, 102.0, candle.Close)
+		require.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), candle.Time.UTC())
+
+		candle = <-candles
+		require.False(t, candle.Complete)
+		require.Equal(t, 103.0, candle.Close)
+	})
+
+	t.Run("orders", func(t *testing.T) {
+		kucoin, server := newTestKuCoin(t)
+
+		market, err := kucoin.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.5, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, model.SideTypeBuy, market.Side)
+		require.Equal(t, "BTCUSDT", market.Pair)
+		require.Equal(t, 101.5, market.Price)
+		require.Equal(t, 0.5, market.Quantity)
+		require.Equal(t, "BTC-USDT", server.params[0]["symbol"])
+		require.Equal(t, "0.50000000", server.params[0]["size"])
+		require.Equal(t, "buy", server.params[0]["side"])
+
+		limit, err := kucoin.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.5, 120.06)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, 120.0, limit.Price)
+		require.Greater(t, limit.ExchangeID, market.ExchangeID)
+
+		stop, err := kucoin.CreateOrderStop("BTCUSDT", 0.5, 90)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeSell, stop.Side)
+		require.Equal(t, model.OrderStatusTypeNew, stop.Status)
+		require.Equal(t, 90.0, *stop.Stop)
+
+		takeProfit, err := kucoin.TakeProfit(model.SideTypeSell, "BTCUSDT", 0.5, 150)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfitLimit, takeProfit.Type)
+		require.Equal(t, 150.0, takeProfit.Price)
+
+		quote, err := kucoin.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 203)
+		require.NoError(t, err)
+		require.Equal(t, 2.0, quote.Quantity)
+		require.Equal(t, 101.5, quote.Price)
+
+		_, err = kucoin.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.000001, 120)
+		var orderError *OrderError
+		require.ErrorAs(t, err, &orderError)
+		require.ErrorIs(t, orderError.Err, ErrInvalidQuantity)
+
+		_, err = kucoin.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 1, 1, 1)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		orders, err := kucoin.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 3)
+
+		require.NoError(t, kucoin.Cancel(stop))
+		require.NoError(t, kucoin.Cancel(limit))
+		order, err := kucoin.Order("BTCUSDT", limit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+		_, err = kucoin.Order("BTCUSDT", stop.ExchangeID)
+		require.Error(t, err)
+
+		require.NoError(t, kucoin.CancelOpenOrders("BTCUSDT"))
+		orders, err = kucoin.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		kucoin, server := newTestKuCoin(t)
+
+		limit, err := kucoin.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 120, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Equal(t, clientOrderNumber("ninjabot-1"), limit.ExchangeID)
+		require.Equal(t, strconv.FormatInt(limit.ExchangeID, 10), server.params[0]["clientOid"])
+
+		stop, err := kucoin.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeStopLoss, Quantity: 0.5, Stop: 90, ClientOrderID: "ninjabot-2"})
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+
+		_, err = kucoin.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Type: model.OrderTypeStopLoss, Quantity: 0.5, Stop: 130, ClientOrderID: "ninjabot-3"})
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+
+		found, err := kucoin.OrderByClientID("BTCUSDT", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, limit.ExchangeID, found.ExchangeID)
+		require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+		found, err = kucoin.OrderByClientID("BTCUSDT", "ninjabot-2")
+		require.NoError(t, err)
+		require.Equal(t, stop.ExchangeID, found.ExchangeID)
+
+		_, err = kucoin.OrderByClientID("BTCUSDT", "ninjabot-3")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		kucoin, _ := newTestKuCoin(t)
+		account, err := kucoin.Account()
+		require.NoError(t, err)
+		require.Equal(t, []model.Balance{
+			{Asset: "BTC", Free: 0.4, Lock: 0.1},
+			{Asset: "USDT", Free: 900, Lock: 100},
+		}, account.Balances)
+
+		asset, quote, err := kucoin.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.5, asset)
+		require.Equal(t, 1000.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		kucoin, server := newTestKuCoin(t)
+		server.orders["1"] = kucoinOrder{ClientOid: "1", ID: "id1", Symbol: "BTC-USDT", Type: "limit", Side: "buy",
+			Price: "100", Size: "0.5", DealSize: "0.5", DealFunds: "49.9", CreatedAt: 1640995200000}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		updates, _ := kucoin.AccountSubscription(ctx)
+		order := <-updates
+		require.Equal(t, int64(1), order.ExchangeID)
+		require.Equal(t, "BTCUSDT", order.Pair)
+		require.Equal(t, model.OrderStatusTypePartiallyFilled, order.Status)
+		require.Equal(t, 100.0, order.Price)
+
+		// the final state is requested for the average price
+		order = <-updates
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 99.8, order.Price)
+		require.Equal(t, 0.5, order.Quantity)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		kucoin, _ := newTestKuCoin(t)
+		err := kucoin.request(context.Background(), http.MethodGet, "/api/v1/order/client-order/42", nil, true, nil)
+		var kucoinError *KuCoinError
+		require.ErrorAs(t, err, &kucoinError)
+		require.Equal(t, kucoinErrOrderNotFound, kucoinError.Code)
+	})
+}
@@ -0,0 +1,263 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/clock"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const defaultMetadataTimeout = 2 * time.Second
+
+var ErrMetadataUnavailable = errors.New("metadata unavailable")
+
+// MetadataFetchers fetches additional information to be included in candle's metadata.
+// The metadata key must be returned even on errors, so the missing value can be flagged in the candle.
+type MetadataFetchers func(ctx context.Context, pair string, t time.Time) (string, float64, error)
+
+type metadataResult struct {
+	key   string
+	value float64
+	err   error
+}
+
+// metadataKeys are the keys of the metadata fetchers of an exchange, by fetcher index. Keys are learned from
+// the results of the fetchers, late results included, to flag the values of late fetchers.
+type metadataKeys struct {
+	mtx  sync.Mutex
+	keys map[int]string
+}
+
+func (m *metadataKeys) set(i int, key string) {
+	if key == "" {
+		return
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.keys == nil {
+		m.keys = make(map[int]string)
+	}
+	m.keys[i] = key
+}
+
+func (m *metadataKeys) get(i int) string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.keys[i]
+}
+
+// fetchMetadata executes the fetchers concurrently, each one with its own deadline. Failed or late
+// fetchers are flagged with NaN, instead of blocking the candle or keeping a stale value. Late fetchers are
+// flagged once their key is known, from a previous result.
+func fetchMetadata(ctx context.Context, fetchers []MetadataFetchers, timeout time.Duration, keys *metadataKeys,
+	candle *model.Candle) {
+	if len(fetchers) == 0 {
+		return
+	}
+
+	if candle.Metadata == nil {
+		candle.Metadata = make(map[string]float64)
+	}
+
+	pair, t := candle.Pair, candle.Time
+	results := make([]chan metadataResult, len(fetchers))
+	for i, fetcher := range fetchers {
+		results[i] = make(chan metadataResult, 1)
+		go func(i int, fetcher MetadataFetchers, result chan<- metadataResult) {
+			fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			done := make(chan metadataResult, 1)
+			go func() {
+				key, value, err := fetcher(fetchCtx, pair, t)
+				keys.set(i, key)
+				done <- metadataResult{key: key, value: value, err: err}
+			}()
+
+			select {
+			case r := <-done:
+				result <- r
+			case <-fetchCtx.Done():
+				result <- metadataResult{key: keys.get(i), err: fetchCtx.Err()}
+			}
+		}(i, fetcher, results[i])
+	}
+
+	for i, result := range results {
+		r := <-result
+		if r.err != nil {
+			log.Warnf("metadata fetcher #%d %s (%s): %v", i, candle.Pair, r.key, r.err)
+			if r.key != "" {
+				candle.Metadata[r.key] = math.NaN()
+			}
+			continue
+		}
+		candle.Metadata[r.key] = r.value
+	}
+}
+
+// MetadataSource fetches an external value for a pair at a given time, eg: sentiment indexes or news scores
+type MetadataSource interface {
+	// Name is the metadata key used in candle's metadata
+	Name() string
+	// Fetch returns the value of the source for a pair
+	Fetch(ctx context.Context, pair string, t time.Time) (float64, error)
+}
+
+type metadataValue struct {
+	value     float64
+	fetchedAt time.Time
+}
+
+// AsyncMetadataFetcher executes a metadata source in background, with a timeout and a cache.
+// The candle stream always reads the last cached value, so slow sources never stall new candles.
+type AsyncMetadataFetcher struct {
+	mtx     sync.Mutex
+	source  MetadataSource
+	timeout time.Duration
+	ttl     time.Duration
+	onError func(source, pair string, err error)
+	clock   clock.Clock
+	cache   map[string]metadataValue
+	pending map[string]bool
+}
+
+type AsyncMetadataOption func(*AsyncMetadataFetcher)
+
+// WithAsyncMetadataTimeout sets the maximum duration of a single fetch, default: 5s
+func WithAsyncMetadataTimeout(timeout time.Duration) AsyncMetadataOption {
+	return func(fetcher *AsyncMetadataFetcher) {
+		fetcher.timeout = timeout
+	}
+}
+
+// WithAsyncMetadataTTL sets how long a cached value is considered fresh, default: 1 minute
+func WithAsyncMetadataTTL(ttl time.Duration) AsyncMetadataOption {
+	return func(fetcher *AsyncMetadataFetcher) {
+		fetcher.ttl = ttl
+	}
+}
+
+// WithAsyncMetadataErrorHandler sets a function to report fetch errors, by default errors are logged
+func WithAsyncMetadataErrorHandler(handler func(source, pair string, err error)) AsyncMetadataOption {
+	return func(fetcher *AsyncMetadataFetcher) {
+		fetcher.onError = handler
+	}
+}
+
+// WithAsyncMetadataClock sets the clock used to expire cached values, default: wall clock
+func WithAsyncMetadataClock(clock clock.Clock) AsyncMetadataOption {
+	return func(fetcher *AsyncMetadataFetcher) {
+		fetcher.clock = clock
+	}
+}
+
+// NewAsyncMetadataFetcher creates a background fetcher for a given metadata source
+func NewAsyncMetadataFetcher(source MetadataSource, options ...AsyncMetadataOption) *AsyncMetadataFetcher {
+	fetcher := &AsyncMetadataFetcher{
+		source:  source,
+		timeout: 5 * time.Second,
+		ttl:     time.Minute,
+		clock:   clock.Wall(),
+		cache:   make(map[string]metadataValue),
+		pending: make(map[string]bool),
+		onError: func(source, pair string, err error) {
+			log.Warnf("metadata/%s %s: %v", source, pair, err)
+		},
+	}
+
+	for _, option := range options {
+		option(fetcher)
+	}
+
+	return fetcher
+}
+
+// Value returns the last cached value of a pair and the time it was fetched
+func (a *AsyncMetadataFetcher) Value(pair string) (float64, time.Time, bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	value, ok := a.cache[pair]
+	return value.value, value.fetchedAt, ok
+}
+
+// Refresh fetches a new value for a pair and blocks until it is done or the timeout is reached
+func (a *AsyncMetadataFetcher) Refresh(ctx context.Context, pair string, t time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	value, err := a.source.Fetch(ctx, pair, t)
+	if err != nil {
+		a.onError(a.source.Name(), pair, err)
+		return err
+	}
+
+	a.mtx.Lock()
+	a.cache[pair] = metadataValue{value: value, fetchedAt: a.clock.Now()}
+	a.mtx.Unlock()
+	return nil
+}
+
+func (a *AsyncMetadataFetcher) refreshAsync(pair string, t time.Time) {
+	a.mtx.Lock()
+	if a.pending[pair] {
+		a.mtx.Unlock()
+		return
+	}
+	a.pending[pair] = true
+	a.mtx.Unlock()
+
+	go func() {
+		defer func() {
+			a.mtx.Lock()
+			delete(a.pending, pair)
+			a.mtx.Unlock()
+		}()
+
+		_ = a.Refresh(context.Background(), pair, t)
+	}()
+}
+
+// Start refreshes the values of the given pairs periodically, until the context is canceled
+func (a *AsyncMetadataFetcher) Start(ctx context.Context, interval time.Duration, pairs ...string) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, pair := range pairs {
+				a.refreshAsync(pair, time.Now())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Fetcher returns a non-blocking fetcher to be used with `WithMetadataFetcher`. It returns the cached value
+// and schedules a refresh in background when the value is expired. If no value was fetched yet,
+// ErrMetadataUnavailable is returned.
+func (a *AsyncMetadataFetcher) Fetcher() MetadataFetchers {
+	return func(_ context.Context, pair string, t time.Time) (string, float64, error) {
+		value, fetchedAt, ok := a.Value(pair)
+		if !ok || clock.Since(a.clock, fetchedAt) > a.ttl {
+			a.refreshAsync(pair, t)
+		}
+
+		if !ok {
+			return a.source.Name(), 0, ErrMetadataUnavailable
+		}
+
+		return a.source.Name(), value, nil
+	}
+}
@@ -0,0 +1,139 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPMetadataSource fetches a metadata value from a JSON HTTP API
+type HTTPMetadataSource struct {
+	Key     string
+	Client  *http.Client
+	Headers map[string]string
+	// URL builds the endpoint for a given pair and time
+	URL func(pair string, t time.Time) string
+	// Extract parses the response body into the metadata value
+	Extract func(body []byte) (float64, error)
+}
+
+func (h HTTPMetadataSource) Name() string {
+	return h.Key
+}
+
+func (h HTTPMetadataSource) Fetch(ctx context.Context, pair string, t time.Time) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL(pair, t), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for key, value := range h.Headers {
+		req.Header.Set(key, value)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("metadata/%s: unexpected status %d: %s", h.Key, resp.StatusCode, body)
+	}
+
+	return h.Extract(body)
+}
+
+func parseJSONFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("invalid numeric value: %v", value)
+}
+
+// FearGreedIndexSource returns the crypto fear & greed index (0 - 100) from alternative.me
+// The index is global, so the same value is used for all pairs.
+func FearGreedIndexSource() HTTPMetadataSource {
+	return HTTPMetadataSource{
+		Key: "fear_greed",
+		URL: func(_ string, _ time.Time) string {
+			return "https://api.alternative.me/fng/?limit=1"
+		},
+		Extract: func(body []byte) (float64, error) {
+			var response struct {
+				Data []struct {
+					Value string `json:"value"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(body, &response); err != nil {
+				return 0, err
+			}
+			if len(response.Data) == 0 {
+				return 0, ErrInsufficientData
+			}
+			return strconv.ParseFloat(response.Data[0].Value, 64)
+		},
+	}
+}
+
+// FundingRateSource returns the last funding rate of a Binance Futures pair
+func FundingRateSource() HTTPMetadataSource {
+	return HTTPMetadataSource{
+		Key: "funding_rate",
+		URL: func(pair string, _ time.Time) string {
+			return "https://fapi.binance.com/fapi/v1/premiumIndex?symbol=" + strings.ToUpper(pair)
+		},
+		Extract: func(body []byte) (float64, error) {
+			var response struct {
+				LastFundingRate string `json:"lastFundingRate"`
+			}
+			if err := json.Unmarshal(body, &response); err != nil {
+				return 0, err
+			}
+			return strconv.ParseFloat(response.LastFundingRate, 64)
+		},
+	}
+}
+
+// SocialVolumeSource returns the social interactions of the last 24h from LunarCrush, it requires an API key
+func SocialVolumeSource(apiKey string) HTTPMetadataSource {
+	return HTTPMetadataSource{
+		Key:     "social_volume",
+		Headers: map[string]string{"Authorization": "Bearer " + apiKey},
+		URL: func(pair string, _ time.Time) string {
+			asset, _ := SplitAssetQuote(pair)
+			return fmt.Sprintf("https://lunarcrush.com/api4/public/coins/%s/v1", strings.ToLower(asset))
+		},
+		Extract: func(body []byte) (float64, error) {
+			var response struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := json.Unmarshal(body, &response); err != nil {
+				return 0, err
+			}
+			value, ok := response.Data["interactions_24h"]
+			if !ok {
+				return 0, ErrInsufficientData
+			}
+			return parseJSONFloat(value)
+		},
+	}
+}
@@ -0,0 +1,125 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+type fakeMetadataSource struct {
+	calls int64
+	delay time.Duration
+	err   error
+}
+
+func (f *fakeMetadataSource) Name() string {
+	return "fake"
+}
+
+func (f *fakeMetadataSource) Fetch(ctx context.Context, _ string, _ time.Time) (float64, error) {
+	atomic.AddInt64(&f.calls, 1)
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	return 42, f.err
+}
+
+func TestAsyncMetadataFetcher(t *testing.T) {
+	t.Run("cache value", func(t *testing.T) {
+		source := &fakeMetadataSource{}
+		fetcher := NewAsyncMetadataFetcher(source, WithAsyncMetadataTTL(time.Hour)).Fetcher()
+
+		key, _, err := fetcher(context.Background(), "BTCUSDT", time.Now())
+		require.Equal(t, "fake", key)
+		require.ErrorIs(t, err, ErrMetadataUnavailable)
+
+		require.Eventually(t, func() bool {
+			_, value, err := fetcher(context.Background(), "BTCUSDT", time.Now())
+			return err == nil && value == 42
+		}, time.Second, 10*time.Millisecond)
+		require.Equal(t, int64(1), atomic.LoadInt64(&source.calls))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		var reported error
+		source := &fakeMetadataSource{delay: time.Second}
+		fetcher := NewAsyncMetadataFetcher(source,
+			WithAsyncMetadataTimeout(10*time.Millisecond),
+			WithAsyncMetadataErrorHandler(func(_, _ string, err error) {
+				reported = err
+			}),
+		)
+
+		err := fetcher.Refresh(context.Background(), "BTCUSDT", time.Now())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorIs(t, reported, context.DeadlineExceeded)
+
+		_, _, ok := fetcher.Value("BTCUSDT")
+		require.False(t, ok)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		source := &fakeMetadataSource{err: errors.New("fail")}
+		fetcher := NewAsyncMetadataFetcher(source, WithAsyncMetadataErrorHandler(func(_, _ string, _ error) {}))
+		require.EqualError(t, fetcher.Refresh(context.Background(), "BTCUSDT", time.Now()), "fail")
+	})
+}
+
+func TestFetchMetadata(t *testing.T) {
+	fetchers := []MetadataFetchers{
+		func(_ context.Context, _ string, _ time.Time) (string, float64, error) {
+			return "ok", 1, nil
+		},
+		func(_ context.Context, _ string, _ time.Time) (string, float64, error) {
+			return "fail", 0, errors.New("fail")
+		},
+		func(_ context.Context, _ string, _ time.Time) (string, float64, error) {
+			time.Sleep(200 * time.Millisecond) // ignores context
+			return "slow", 3, nil
+		},
+	}
+
+	var keys metadataKeys
+	candle := model.Candle{Pair: "BTCUSDT", Time: time.Now()}
+	start := time.Now()
+	fetchMetadata(context.Background(), fetchers, 50*time.Millisecond, &keys, &candle)
+	require.Less(t, time.Since(start), 150*time.Millisecond)
+
+	require.Equal(t, 1.0, candle.Metadata["ok"])
+	require.True(t, math.IsNaN(candle.Metadata["fail"]))
+	require.NotContains(t, candle.Metadata, "slow") // the key of the late fetcher is unknown yet
+
+	// the key is learned from the late result, and the next late fetches are flagged
+	require.Eventually(t, func() bool { return keys.get(2) == "slow" }, time.Second, 10*time.Millisecond)
+	candle = model.Candle{Pair: "BTCUSDT", Time: time.Now()}
+	fetchMetadata(context.Background(), fetchers, 50*time.Millisecond, &keys, &candle)
+	require.True(t, math.IsNaN(candle.Metadata["slow"]))
+}
+
+func TestHTTPMetadataSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":[{"value":"25","value_classification":"Extreme Fear"}]}`))
+	}))
+	defer server.Close()
+
+	source := FearGreedIndexSource()
+	source.URL = func(_ string, _ time.Time) string {
+		return server.URL
+	}
+
+	value, err := source.Fetch(context.Background(), "BTCUSDT", time.Now())
+	require.NoError(t, err)
+	require.Equal(t, 25.0, value)
+	require.Equal(t, "fear_greed", source.Name())
+}
@@ -0,0 +1,1110 @@
+// Package mock provides a simulated Binance-compatible REST and websocket server for integration tests.
+// It serves canned klines, accepts and matches orders against the last price, and emits user data events,
+// so exchange integrations and reconnect logic can be tested without hitting real or testnet APIs.
+//
+//	server := mock.NewServer(
+//		mock.WithSymbol("BTCUSDT", "BTC", "USDT"),
+//		mock.WithBalance("USDT", 10000),
+//		mock.WithKlines("BTCUSDT", "1h", candles...),
+//	)
+//	defer server.Close()
+//
+//	binance, err := exchange.NewBinance(ctx, exchange.WithBinanceEndpoint(server.URL(), server.StreamURL()))
+package mock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/gorilla/websocket"
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// Binance error codes returned by the server
+const (
+	ErrCodeUnknownOrder        = -2013
+	ErrCodeInsufficientBalance = -2010
+	ErrCodeOrderRejected       = -2010
+	ErrCodeInvalidSymbol       = -1121
+	ErrCodeInvalidParameter    = -1100
+)
+
+type balance struct {
+	free     float64
+	locked   float64
+	borrowed float64
+}
+
+type order struct {
+	binance.Order
+	stopPrice  float64
+	price      float64
+	quantity   float64
+	lockAsset  string
+	lockAmount float64
+	sideEffect binance.SideEffectType
+}
+
+type stream struct {
+	conn *websocket.Conn
+	name string
+	mtx  sync.Mutex
+}
+
+func (s *stream) send(message interface{}) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	_ = s.conn.WriteJSON(message)
+}
+
+// Server is a simulated Binance spot exchange
+type Server struct {
+	mtx      sync.Mutex
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	symbols  map[string]binance.Symbol
+	klines   map[string][]model.Candle
+	prices   map[string]float64
+	balances map[string]*balance
+	orders   map[int64]*order
+	orderID  int64
+	listID   int64
+	streams  map[*stream]struct{}
+	keys     map[string]struct{}
+	keyID    int
+}
+
+type Option func(*Server)
+
+// WithSymbol registers a trading symbol, with permissive price and lot size filters
+func WithSymbol(symbol, base, quote string) Option {
+	return func(s *Server) {
+		s.symbols[symbol] = binance.Symbol{
+			Symbol:             symbol,
+			Status:             "TRADING",
+			BaseAsset:          base,
+			BaseAssetPrecision: 8,
+			QuoteAsset:         quote,
+			QuotePrecision:     8,
+			OcoAllowed:         true,
+			Filters: []map[string]interface{}{
+				{
+					"filterType": string(binance.SymbolFilterTypeLotSize),
+					"minQty":     "0.00000100",
+					"maxQty":     "9000000.00000000",
+					"stepSize":   "0.00000100",
+				},
+				{
+					"filterType": string(binance.SymbolFilterTypePriceFilter),
+					"minPrice":   "0.00000100",
+					"maxPrice":   "9000000.00000000",
+					"tickSize":   "0.00000100",
+				},
+			},
+		}
+	}
+}
+
+// WithBalance sets the initial free balance of an asset
+func WithBalance(asset string, free float64) Option {
+	return func(s *Server) {
+		s.balances[asset] = &balance{free: free}
+	}
+}
+
+// WithKlines sets the canned klines of a symbol and interval, the last close is used as the market price
+func WithKlines(symbol, interval string, candles ...model.Candle) Option {
+	return func(s *Server) {
+		s.klines[klineKey(symbol, interval)] = candles
+		if len(candles) > 0 {
+			s.prices[symbol] = candles[len(candles)-1].Close
+		}
+	}
+}
+
+// NewServer starts a new mock server, it must be closed after use
+func NewServer(options ...Option) *Server {
+	s := &Server{
+		symbols:  make(map[string]binance.Symbol),
+		klines:   make(map[string][]model.Candle),
+		prices:   make(map[string]float64),
+		balances: make(map[string]*balance),
+		orders:   make(map[int64]*order),
+		streams:  make(map[*stream]struct{}),
+		keys:     make(map[string]struct{}),
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/ping", s.handlePing)
+	mux.HandleFunc("/api/v3/time", s.handleTime)
+	mux.HandleFunc("/api/v3/exchangeInfo", s.handleExchangeInfo)
+	mux.HandleFunc("/api/v3/klines", s.handleKlines)
+	mux.HandleFunc("/api/v3/order", s.handleOrder)
+	mux.HandleFunc("/api/v3/order/oco", s.handleOCO)
+	mux.HandleFunc("/api/v3/openOrders", s.handleOpenOrders)
+	mux.HandleFunc("/api/v3/allOrders", s.handleAllOrders)
+	mux.HandleFunc("/api/v3/account", s.handleAccount)
+	mux.HandleFunc("/api/v3/userDataStream", s.handleUserDataStream)
+	mux.HandleFunc("/sapi/v1/margin/order", s.handleOrder)
+	mux.HandleFunc("/sapi/v1/margin/order/oco", s.handleOCO)
+	mux.HandleFunc("/sapi/v1/margin/openOrders", s.handleOpenOrders)
+	mux.HandleFunc("/sapi/v1/margin/allOrders", s.handleAllOrders)
+	mux.HandleFunc("/sapi/v1/margin/loan", s.handleLoan)
+	mux.HandleFunc("/sapi/v1/margin/repay", s.handleRepay)
+	mux.HandleFunc("/sapi/v1/margin/account", s.handleMarginAccount)
+	mux.HandleFunc("/sapi/v1/margin/isolated/account", s.handleIsolatedMarginAccount)
+	mux.HandleFunc("/ws/", s.handleStream)
+	s.server = httptest.NewServer(mux)
+
+	return s
+}
+
+// URL returns the REST endpoint of the server
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// StreamURL returns the websocket endpoint of the server
+func (s *Server) StreamURL() string {
+	return "ws" + strings.TrimPrefix(s.server.URL, "http") + "/ws"
+}
+
+// Close disconnects all streams and stops the server
+func (s *Server) Close() {
+	s.DisconnectStreams()
+	s.server.Close()
+}
+
+// DisconnectStreams closes all websocket connections, eg: to test reconnect logic
+func (s *Server) DisconnectStreams() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for stream := range s.streams {
+		stream.conn.Close()
+		delete(s.streams, stream)
+	}
+}
+
+// Streams returns the number of connected websocket streams
+func (s *Server) Streams() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.streams)
+}
+
+// PushKline updates the klines of a symbol and interval and sends the kline to stream subscribers.
+// Candles with the same time of the last kline replace it. Open orders are matched with the candle range.
+func (s *Server) PushKline(symbol, interval string, candle model.Candle) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	key := klineKey(symbol, interval)
+	klines := s.klines[key]
+	if last := len(klines) - 1; last >= 0 && klines[last].Time.Equal(candle.Time) {
+		klines[last] = candle
+	} else {
+		s.klines[key] = append(klines, candle)
+	}
+
+	duration, _ := str2duration.ParseDuration(interval)
+	event := binance.WsKlineEvent{
+		Event:  "kline",
+		Time:   time.Now().UnixMilli(),
+		Symbol: symbol,
+		Kline: binance.WsKline{
+			StartTime: candle.Time.UnixMilli(),
+			EndTime:   candle.Time.Add(duration).UnixMilli() - 1,
+			Symbol:    symbol,
+			Interval:  interval,
+			Open:      formatFloat(candle.Open),
+			Close:     formatFloat(candle.Close),
+			High:      formatFloat(candle.High),
+			Low:       formatFloat(candle.Low),
+			Volume:    formatFloat(candle.Volume),
+			IsFinal:   candle.Complete,
+		},
+	}
+
+	name := fmt.Sprintf("%s@kline_%s", strings.ToLower(symbol), interval)
+	for stream := range s.streams {
+		if stream.name == name {
+			stream.send(event)
+		}
+	}
+
+	s.match(symbol, candle.Low, candle.High, candle.Close)
+}
+
+// SetPrice sets the market price of a symbol and matches open orders
+func (s *Server) SetPrice(symbol string, price float64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.match(symbol, price, price, price)
+}
+
+// Orders returns all orders of a symbol, sorted by ID
+func (s *Server) Orders(symbol string) []binance.Order {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	orders := make([]binance.Order, 0)
+	for _, o := range s.sortedOrders(symbol) {
+		orders = append(orders, o.Order)
+	}
+	return orders
+}
+
+// Balance returns the free and locked balance of an asset
+func (s *Server) Balance(asset string) (free, locked float64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	b := s.balance(asset)
+	return b.free, b.locked
+}
+
+// Borrowed returns the margin debt of an asset
+func (s *Server) Borrowed(asset string) float64 {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.balance(asset).borrowed
+}
+
+func klineKey(symbol, interval string) string {
+	return symbol + "--" + interval
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (s *Server) balance(asset string) *balance {
+	b, ok := s.balances[asset]
+	if !ok {
+		b = &balance{}
+		s.balances[asset] = b
+	}
+	return b
+}
+
+func (s *Server) sortedOrders(symbol string) []*order {
+	orders := make([]*order, 0)
+	for _, o := range s.orders {
+		if symbol == "" || o.Symbol == symbol {
+			orders = append(orders, o)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].OrderID < orders[j].OrderID
+	})
+	return orders
+}
+
+// match fills open orders triggered by a price range
+func (s *Server) match(symbol string, low, high, last float64) {
+	s.prices[symbol] = last
+	for _, o := range s.sortedOrders(symbol) {
+		if o.Status != binance.OrderStatusTypeNew {
+			continue
+		}
+
+		buy := o.Side == binance.SideTypeBuy
+		switch o.Type {
+		case binance.OrderTypeLimit, binance.OrderTypeLimitMaker:
+			if buy && low <= o.price || !buy && high >= o.price {
+				s.fill(o, o.price)
+			}
+		case binance.OrderTypeStopLoss, binance.OrderTypeStopLossLimit:
+			if buy && high >= o.stopPrice || !buy && low <= o.stopPrice {
+				s.fill(o, o.price)
+			}
+		case binance.OrderTypeTakeProfit, binance.OrderTypeTakeProfitLimit:
+			if buy && low <= o.stopPrice || !buy && high >= o.stopPrice {
+				s.fill(o, o.price)
+			}
+		}
+	}
+}
+
+// release unlocks the funds reserved by an order
+func (s *Server) release(o *order) {
+	if o.lockAmount > 0 {
+		b := s.balance(o.lockAsset)
+		b.locked -= o.lockAmount
+		b.free += o.lockAmount
+		o.lockAmount = 0
+	}
+}
+
+// list returns the orders of the same OCO group
+func (s *Server) list(o *order) []*order {
+	if o.OrderListId < 0 {
+		return []*order{o}
+	}
+
+	orders := make([]*order, 0, 2)
+	for _, item := range s.sortedOrders(o.Symbol) {
+		if item.OrderListId == o.OrderListId {
+			orders = append(orders, item)
+		}
+	}
+	return orders
+}
+
+// fill executes an order at a given price, canceling the remaining OCO orders
+func (s *Server) fill(o *order, price float64) {
+	info := s.symbols[o.Symbol]
+	for _, item := range s.list(o) {
+		s.release(item)
+		if item != o {
+			s.update(item, binance.OrderStatusTypeCanceled, 0, 0)
+		}
+	}
+
+	base, quote := s.balance(info.BaseAsset), s.balance(info.QuoteAsset)
+	if o.Side == binance.SideTypeBuy {
+		base.free += o.quantity
+		quote.free -= o.quantity * price
+	} else {
+		base.free -= o.quantity
+		quote.free += o.quantity * price
+	}
+
+	if o.sideEffect == binance.SideEffectTypeAutoRepay {
+		s.repay(base, base.borrowed)
+	}
+
+	s.update(o, binance.OrderStatusTypeFilled, o.quantity, price)
+}
+
+func (s *Server) update(o *order, status binance.OrderStatusType, quantity, price float64) {
+	o.Status = status
+	o.UpdateTime = time.Now().UnixMilli()
+	o.IsWorking = status == binance.OrderStatusTypeNew
+	executionType := "NEW"
+	switch status {
+	case binance.OrderStatusTypeFilled:
+		o.ExecutedQuantity = formatFloat(quantity)
+		o.CummulativeQuoteQuantity = formatFloat(quantity * price)
+		executionType = "TRADE"
+	case binance.OrderStatusTypeCanceled:
+		executionType = "CANCELED"
+	}
+	s.emitOrder(o, executionType, quantity, price)
+}
+
+// emitOrder sends the execution report and the account position of an order to user data streams
+func (s *Server) emitOrder(o *order, executionType string, quantity, price float64) {
+	now := time.Now().UnixMilli()
+	report := binance.WsOrderUpdate{
+		Symbol:            o.Symbol,
+		ClientOrderId:     o.ClientOrderID,
+		Side:              string(o.Side),
+		Type:              string(o.Type),
+		TimeInForce:       o.TimeInForce,
+		Volume:            o.OrigQuantity,
+		Price:             o.Price,
+		StopPrice:         o.StopPrice,
+		OrderListId:       o.OrderListId,
+		ExecutionType:     executionType,
+		Status:            string(o.Status),
+		Id:                o.OrderID,
+		LatestVolume:      formatFloat(quantity),
+		FilledVolume:      o.ExecutedQuantity,
+		LatestPrice:       formatFloat(price),
+		FeeCost:           "0",
+		TransactionTime:   now,
+		IsInOrderBook:     o.IsWorking,
+		CreateTime:        o.Time,
+		FilledQuoteVolume: o.CummulativeQuoteQuantity,
+		LatestQuoteVolume: formatFloat(quantity * price),
+	}
+
+	info := s.symbols[o.Symbol]
+	position := map[string]interface{}{
+		"e": "outboundAccountPosition",
+		"E": now,
+		"u": now,
+		"B": []binance.WsAccountUpdate{
+			s.accountUpdate(info.BaseAsset),
+			s.accountUpdate(info.QuoteAsset),
+		},
+	}
+
+	s.emit(withEvent(report, "executionReport", now))
+	s.emit(position)
+}
+
+func (s *Server) accountUpdate(asset string) binance.WsAccountUpdate {
+	b := s.balance(asset)
+	return binance.WsAccountUpdate{Asset: asset, Free: formatFloat(b.free), Locked: formatFloat(b.locked)}
+}
+
+// withEvent includes the event type and time in a user data payload
+func withEvent(payload interface{}, event string, now int64) map[string]interface{} {
+	data, _ := json.Marshal(payload)
+	message := make(map[string]interface{})
+	_ = json.Unmarshal(data, &message)
+	message["e"] = event
+	message["E"] = now
+	return message
+}
+
+func (s *Server) emit(message interface{}) {
+	for stream := range s.streams {
+		if _, ok := s.keys[stream.name]; ok {
+			stream.send(message)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(data)
+}
+
+func writeError(w http.ResponseWriter, status int, code int64, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "msg": message})
+}
+
+// params returns the query and form parameters of a request, including the body of DELETE requests
+func params(r *http.Request) url.Values {
+	values := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return values
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return values
+	}
+
+	for key, items := range form {
+		values[key] = append(values[key], items...)
+	}
+	return values
+}
+
+func floatParam(values url.Values, key string) float64 {
+	value, _ := strconv.ParseFloat(values.Get(key), 64)
+	return value
+}
+
+func (s *Server) handlePing(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, struct{}{})
+}
+
+func (s *Server) handleTime(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]int64{"serverTime": time.Now().UnixMilli()})
+}
+
+func (s *Server) handleExchangeInfo(w http.ResponseWriter, _ *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	symbols := make([]binance.Symbol, 0, len(s.symbols))
+	for _, symbol := range s.symbols {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Symbol < symbols[j].Symbol
+	})
+
+	writeJSON(w, binance.ExchangeInfo{Timezone: "UTC", ServerTime: time.Now().UnixMilli(), Symbols: symbols})
+}
+
+func (s *Server) handleKlines(w http.ResponseWriter, r *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	values := r.URL.Query()
+	symbol, interval := values.Get("symbol"), values.Get("interval")
+	if _, ok := s.symbols[symbol]; !ok {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidSymbol, "Invalid symbol.")
+		return
+	}
+
+	duration, err := str2duration.ParseDuration(interval)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "Invalid interval.")
+		return
+	}
+
+	limit := 500
+	if value, err := strconv.Atoi(values.Get("limit")); err == nil && value > 0 {
+		limit = value
+	}
+
+	start, _ := strconv.ParseInt(values.Get("startTime"), 10, 64)
+	end, _ := strconv.ParseInt(values.Get("endTime"), 10, 64)
+
+	klines := make([][]interface{}, 0)
+	for _, candle := range s.klines[klineKey(symbol, interval)] {
+		openTime := candle.Time.UnixMilli()
+		if start > 0 && openTime < start || end > 0 && openTime > end {
+			continue
+		}
+
+		klines = append(klines, []interface{}{
+			openTime,
+			formatFloat(candle.Open),
+			formatFloat(candle.High),
+			formatFloat(candle.Low),
+			formatFloat(candle.Close),
+			formatFloat(candle.Volume),
+			candle.Time.Add(duration).UnixMilli() - 1,
+			formatFloat(candle.Volume * candle.Close),
+			0, "0", "0", "0",
+		})
+	}
+
+	if len(klines) > limit {
+		if start > 0 {
+			klines = klines[:limit]
+		} else {
+			klines = klines[len(klines)-limit:]
+		}
+	}
+
+	writeJSON(w, klines)
+}
+
+func (s *Server) handleOrder(w http.ResponseWriter, r *http.Request) {
+	values := params(r)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		o, code, err := s.createOrder(values, -1)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, code, err.Error())
+			return
+		}
+
+		writeJSON(w, binance.CreateOrderResponse{
+			Symbol:                   o.Symbol,
+			OrderID:                  o.OrderID,
+			ClientOrderID:            o.ClientOrderID,
+			TransactTime:             o.Time,
+			Price:                    o.Price,
+			OrigQuantity:             o.OrigQuantity,
+			ExecutedQuantity:         o.ExecutedQuantity,
+			CummulativeQuoteQuantity: o.CummulativeQuoteQuantity,
+			Status:                   o.Status,
+			TimeInForce:              o.TimeInForce,
+			Type:                     o.Type,
+			Side:                     o.Side,
+		})
+	case http.MethodGet:
+		o, ok := s.findOrder(values)
+		if !ok {
+			writeError(w, http.StatusBadRequest, ErrCodeUnknownOrder, "Order does not exist.")
+			return
+		}
+		writeJSON(w, o.Order)
+	case http.MethodDelete:
+		o, ok := s.findOrder(values)
+		if !ok || o.Status != binance.OrderStatusTypeNew {
+			writeError(w, http.StatusBadRequest, ErrCodeUnknownOrder, "Unknown order sent.")
+			return
+		}
+		s.cancel(o)
+		writeJSON(w, o.Order)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) findOrder(values url.Values) (*order, bool) {
+	if clientOrderID := values.Get("origClientOrderId"); clientOrderID != "" {
+		for _, o := range s.orders {
+			if o.ClientOrderID == clientOrderID && o.Symbol == values.Get("symbol") {
+				return o, true
+			}
+		}
+		return nil, false
+	}
+
+	id, _ := strconv.ParseInt(values.Get("orderId"), 10, 64)
+	o, ok := s.orders[id]
+	if !ok || o.Symbol != values.Get("symbol") {
+		return nil, false
+	}
+	return o, true
+}
+
+func (s *Server) cancel(o *order) {
+	for _, item := range s.list(o) {
+		s.release(item)
+		s.update(item, binance.OrderStatusTypeCanceled, 0, 0)
+	}
+}
+
+// createOrder validates, locks funds and executes market orders
+func (s *Server) createOrder(values url.Values, listID int64) (*order, int64, error) {
+	symbol := values.Get("symbol")
+	info, ok := s.symbols[symbol]
+	if !ok {
+		return nil, ErrCodeInvalidSymbol, errors.New("invalid symbol")
+	}
+
+	side := binance.SideType(values.Get("side"))
+	orderType := binance.OrderType(values.Get("type"))
+	quantity := floatParam(values, "quantity")
+	price := floatParam(values, "price")
+	stopPrice := floatParam(values, "stopPrice")
+	market := s.prices[symbol]
+
+	if orderType == binance.OrderTypeMarket {
+		if market == 0 {
+			return nil, ErrCodeInvalidParameter, fmt.Errorf("no market price for %s", symbol)
+		}
+		price = market
+		if quote := floatParam(values, "quoteOrderQty"); quote > 0 {
+			quantity = quote / market
+		}
+	}
+
+	// stop orders without stop price are triggered by the order price
+	if stopPrice == 0 {
+		stopPrice = price
+	}
+	if orderType == binance.OrderTypeStopLoss || orderType == binance.OrderTypeTakeProfit {
+		price = stopPrice
+	}
+
+	if quantity <= 0 || price <= 0 {
+		return nil, ErrCodeInvalidParameter, errors.New("invalid quantity or price")
+	}
+
+	// limit maker orders are rejected when they would take liquidity
+	if orderType == binance.OrderTypeLimitMaker && listID < 0 && market > 0 &&
+		((side == binance.SideTypeBuy && price >= market) || (side == binance.SideTypeSell && price <= market)) {
+		return nil, ErrCodeOrderRejected, errors.New("order would immediately match and take")
+	}
+
+	lockAsset, lockAmount := info.BaseAsset, quantity
+	if side == binance.SideTypeBuy {
+		lockAsset, lockAmount = info.QuoteAsset, quantity*price
+	}
+
+	// margin orders borrow the missing funds
+	sideEffect := binance.SideEffectType(values.Get("sideEffectType"))
+	if b := s.balance(lockAsset); sideEffect == binance.SideEffectTypeMarginBuy && b.free < lockAmount {
+		b.borrowed += lockAmount - b.free
+		b.free = lockAmount
+	}
+
+	// OCO orders share the funds locked by the first order
+	if listID < 0 || len(s.list(&order{Order: binance.Order{Symbol: symbol, OrderListId: listID}})) == 0 {
+		if b := s.balance(lockAsset); b.free < lockAmount-1e-9 {
+			return nil, ErrCodeInsufficientBalance, errors.New("account has insufficient balance for requested action")
+		}
+	} else {
+		lockAmount = 0
+	}
+
+	now := time.Now().UnixMilli()
+	s.orderID++
+	o := &order{
+		Order: binance.Order{
+			Symbol:                   symbol,
+			OrderID:                  s.orderID,
+			OrderListId:              listID,
+			ClientOrderID:            values.Get("newClientOrderId"),
+			Price:                    formatFloat(price),
+			OrigQuantity:             formatFloat(quantity),
+			ExecutedQuantity:         "0",
+			CummulativeQuoteQuantity: "0",
+			Status:                   binance.OrderStatusTypeNew,
+			TimeInForce:              binance.TimeInForceType(values.Get("timeInForce")),
+			IcebergQuantity:          values.Get("icebergQty"),
+			Type:                     orderType,
+			Side:                     side,
+			StopPrice:                formatFloat(stopPrice),
+			Time:                     now,
+			UpdateTime:               now,
+			IsWorking:                true,
+		},
+		price:      price,
+		stopPrice:  stopPrice,
+		quantity:   quantity,
+		sideEffect: sideEffect,
+	}
+	if o.ClientOrderID == "" {
+		o.ClientOrderID = fmt.Sprintf("mock-%d", o.OrderID)
+	}
+	s.orders[o.OrderID] = o
+
+	if orderType == binance.OrderTypeMarket {
+		s.emitOrder(o, "NEW", 0, 0)
+		s.fill(o, price)
+		return o, 0, nil
+	}
+
+	o.lockAsset, o.lockAmount = lockAsset, lockAmount
+	b := s.balance(lockAsset)
+	b.free -= lockAmount
+	b.locked += lockAmount
+	s.emitOrder(o, "NEW", 0, 0)
+
+	return o, 0, nil
+}
+
+func (s *Server) handleOCO(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := params(r)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.listID++
+	listID := s.listID
+
+	limit := url.Values{
+		"symbol":         {values.Get("symbol")},
+		"side":           {values.Get("side")},
+		"type":           {string(binance.OrderTypeLimitMaker)},
+		"quantity":       {values.Get("quantity")},
+		"price":          {values.Get("price")},
+		"sideEffectType": {values.Get("sideEffectType")},
+	}
+	stop := url.Values{
+		"symbol":         {values.Get("symbol")},
+		"side":           {values.Get("side")},
+		"type":           {string(binance.OrderTypeStopLossLimit)},
+		"quantity":       {values.Get("quantity")},
+		"price":          {values.Get("stopLimitPrice")},
+		"stopPrice":      {values.Get("stopPrice")},
+		"timeInForce":    {values.Get("stopLimitTimeInForce")},
+		"sideEffectType": {values.Get("sideEffectType")},
+	}
+
+	response := binance.CreateOCOResponse{
+		OrderListID:     listID,
+		ContingencyType: "OCO",
+		ListStatusType:  "EXEC_STARTED",
+		ListOrderStatus: "EXECUTING",
+		TransactionTime: time.Now().UnixMilli(),
+		Symbol:          values.Get("symbol"),
+	}
+
+	for _, params := range []url.Values{stop, limit} {
+		o, code, err := s.createOrder(params, listID)
+		if err != nil {
+			for _, item := range response.Orders {
+				s.cancel(s.orders[item.OrderID])
+			}
+			writeError(w, http.StatusBadRequest, code, err.Error())
+			return
+		}
+
+		response.Orders = append(response.Orders, &binance.OCOOrder{
+			Symbol:        o.Symbol,
+			OrderID:       o.OrderID,
+			ClientOrderID: o.ClientOrderID,
+		})
+		response.OrderReports = append(response.OrderReports, &binance.OCOOrderReport{
+			Symbol:                   o.Symbol,
+			OrderID:                  o.OrderID,
+			OrderListID:              listID,
+			ClientOrderID:            o.ClientOrderID,
+			TransactionTime:          o.Time,
+			Price:                    o.Price,
+			OrigQuantity:             o.OrigQuantity,
+			ExecutedQuantity:         o.ExecutedQuantity,
+			CummulativeQuoteQuantity: o.CummulativeQuoteQuantity,
+			Status:                   o.Status,
+			TimeInForce:              o.TimeInForce,
+			Type:                     o.Type,
+			Side:                     o.Side,
+			StopPrice:                o.StopPrice,
+		})
+	}
+
+	writeJSON(w, response)
+}
+
+func (s *Server) handleOpenOrders(w http.ResponseWriter, r *http.Request) {
+	values := params(r)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	orders := make([]binance.Order, 0)
+	for _, o := range s.sortedOrders(values.Get("symbol")) {
+		if o.Status != binance.OrderStatusTypeNew {
+			continue
+		}
+		if r.Method == http.MethodDelete {
+			s.cancel(o)
+		}
+		orders = append(orders, o.Order)
+	}
+
+	writeJSON(w, orders)
+}
+
+func (s *Server) handleAllOrders(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	orders := make([]binance.Order, 0)
+	for _, o := range s.sortedOrders(values.Get("symbol")) {
+		orders = append(orders, o.Order)
+	}
+
+	if limit, err := strconv.Atoi(values.Get("limit")); err == nil && limit > 0 && len(orders) > limit {
+		orders = orders[len(orders)-limit:]
+	}
+
+	writeJSON(w, orders)
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, _ *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	assets := make([]string, 0, len(s.balances))
+	for asset := range s.balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	account := binance.Account{
+		CanTrade:    true,
+		AccountType: "SPOT",
+		UpdateTime:  uint64(time.Now().UnixMilli()),
+		Permissions: []string{"SPOT"},
+	}
+	for _, asset := range assets {
+		b := s.balances[asset]
+		account.Balances = append(account.Balances, binance.Balance{
+			Asset:  asset,
+			Free:   formatFloat(math.Max(b.free, 0)),
+			Locked: formatFloat(b.locked),
+		})
+	}
+
+	writeJSON(w, account)
+}
+
+// repay pays a debt with the free balance of the asset
+func (s *Server) repay(b *balance, amount float64) {
+	amount = math.Min(amount, math.Min(b.borrowed, math.Max(b.free, 0)))
+	b.free -= amount
+	b.borrowed -= amount
+}
+
+func (s *Server) handleLoan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := params(r)
+	amount := floatParam(values, "amount")
+	if amount <= 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidParameter, "invalid amount")
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	b := s.balance(values.Get("asset"))
+	b.free += amount
+	b.borrowed += amount
+	s.listID++
+	writeJSON(w, binance.TransactionResponse{TranID: s.listID})
+}
+
+func (s *Server) handleRepay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := params(r)
+	amount := floatParam(values, "amount")
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	b := s.balance(values.Get("asset"))
+	if amount <= 0 || amount > b.free+1e-9 {
+		writeError(w, http.StatusBadRequest, ErrCodeInsufficientBalance,
+			"account has insufficient balance for requested action")
+		return
+	}
+
+	s.repay(b, amount)
+	s.listID++
+	writeJSON(w, binance.TransactionResponse{TranID: s.listID})
+}
+
+func (s *Server) userAsset(asset string) binance.UserAsset {
+	b := s.balance(asset)
+	return binance.UserAsset{
+		Asset:    asset,
+		Borrowed: formatFloat(b.borrowed),
+		Free:     formatFloat(b.free),
+		Interest: "0",
+		Locked:   formatFloat(b.locked),
+		NetAsset: formatFloat(b.free + b.locked - b.borrowed),
+	}
+}
+
+func (s *Server) handleMarginAccount(w http.ResponseWriter, _ *http.Request) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	assets := make([]string, 0, len(s.balances))
+	for asset := range s.balances {
+		assets = append(assets, asset)
+	}
+	sort.Strings(assets)
+
+	account := binance.MarginAccount{BorrowEnabled: true, TradeEnabled: true, TransferEnabled: true}
+	for _, asset := range assets {
+		account.UserAssets = append(account.UserAssets, s.userAsset(asset))
+	}
+
+	writeJSON(w, account)
+}
+
+// handleIsolatedMarginAccount returns the isolated accounts of the requested symbols, which share the
+// balances of the cross margin account
+func (s *Server) handleIsolatedMarginAccount(w http.ResponseWriter, r *http.Request) {
+	values := params(r)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	symbols := make([]string, 0)
+	if value := values.Get("symbols"); value != "" {
+		symbols = strings.Split(value, ",")
+	} else {
+		for symbol := range s.symbols {
+			symbols = append(symbols, symbol)
+		}
+		sort.Strings(symbols)
+	}
+
+	isolated := func(asset string) binance.IsolatedUserAsset {
+		item := s.userAsset(asset)
+		return binance.IsolatedUserAsset{
+			Asset:         item.Asset,
+			Borrowed:      item.Borrowed,
+			Free:          item.Free,
+			Interest:      item.Interest,
+			Locked:        item.Locked,
+			NetAsset:      item.NetAsset,
+			BorrowEnabled: true,
+			RepayEnabled:  true,
+		}
+	}
+
+	account := binance.IsolatedMarginAccount{}
+	for _, symbol := range symbols {
+		info, ok := s.symbols[symbol]
+		if !ok {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidSymbol, "invalid symbol")
+			return
+		}
+
+		account.Assets = append(account.Assets, binance.IsolatedMarginAsset{
+			Symbol:          symbol,
+			BaseAsset:       isolated(info.BaseAsset),
+			QuoteAsset:      isolated(info.QuoteAsset),
+			IsolatedCreated: true,
+			Enabled:         true,
+			TradeEnabled:    true,
+		})
+	}
+
+	writeJSON(w, account)
+}
+
+func (s *Server) handleUserDataStream(w http.ResponseWriter, r *http.Request) {
+	values := params(r)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		s.keyID++
+		key := fmt.Sprintf("listenkey%d", s.keyID)
+		s.keys[key] = struct{}{}
+		writeJSON(w, map[string]string{"listenKey": key})
+	case http.MethodPut:
+		if _, ok := s.keys[values.Get("listenKey")]; !ok {
+			writeError(w, http.StatusBadRequest, -1125, "This listenKey does not exist.")
+			return
+		}
+		writeJSON(w, struct{}{})
+	case http.MethodDelete:
+		delete(s.keys, values.Get("listenKey"))
+		writeJSON(w, struct{}{})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleStream accepts websocket connections of kline streams (eg: /ws/btcusdt@kline_1m)
+// and user data streams (eg: /ws/<listenKey>)
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/ws/")
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	current := &stream{conn: conn, name: name}
+	s.mtx.Lock()
+	s.streams[current] = struct{}{}
+	s.mtx.Unlock()
+
+	// discard client messages until the connection is closed
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	s.mtx.Lock()
+	delete(s.streams, current)
+	s.mtx.Unlock()
+	conn.Close()
+}
@@ -0,0 +1,298 @@
+package mock_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/exchange/mock"
+	"github.com/bengalm/ninjabot/model"
+)
+
+func candles(start time.Time, closes ...float64) []model.Candle {
+	result := make([]model.Candle, 0, len(closes))
+	for i, value := range closes {
+		result = append(result, model.Candle{
+			Pair:     "BTCUSDT",
+			Time:     start.Add(time.Duration(i) * time.Hour),
+			Open:     value,
+			Close:    value,
+			High:     value,
+			Low:      value,
+			Volume:   1,
+			Complete: true,
+		})
+	}
+	return result
+}
+
+func newExchange(t *testing.T, options ...exchange.BinanceOption) (*mock.Server, *exchange.Binance) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	server := mock.NewServer(
+		mock.WithSymbol("BTCUSDT", "BTC", "USDT"),
+		mock.WithBalance("USDT", 10000),
+		mock.WithKlines("BTCUSDT", "1h", candles(start, 1000, 1100, 1200)...),
+	)
+	t.Cleanup(server.Close)
+
+	options = append(options, exchange.WithBinanceEndpoint(server.URL(), server.StreamURL()))
+	binance, err := exchange.NewBinance(context.Background(), options...)
+	require.NoError(t, err)
+	return server, binance
+}
+
+func TestServer_Klines(t *testing.T) {
+	_, binance := newExchange(t)
+
+	result, err := binance.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 2)
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	require.Equal(t, 1000.0, result[0].Close)
+	require.Equal(t, 1100.0, result[1].Close)
+
+	info := binance.AssetsInfo("BTCUSDT")
+	require.Equal(t, "BTC", info.BaseAsset)
+	require.Equal(t, "USDT", info.QuoteAsset)
+}
+
+func TestServer_CandlesByPeriod(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	klines := make([]model.Candle, 2500)
+	for i := range klines {
+		klines[i] = model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(i) * time.Minute), Close: float64(i)}
+	}
+	server := mock.NewServer(
+		mock.WithSymbol("BTCUSDT", "BTC", "USDT"),
+		mock.WithKlines("BTCUSDT", "1m", klines...),
+	)
+	t.Cleanup(server.Close)
+
+	binance, err := exchange.NewBinance(context.Background(),
+		exchange.WithBinanceEndpoint(server.URL(), server.StreamURL()))
+	require.NoError(t, err)
+
+	// the period is paginated, since each request returns up to 1000 candles
+	result, err := binance.CandlesByPeriod(context.Background(), "BTCUSDT", "1m", start, start.Add(time.Hour*48))
+	require.NoError(t, err)
+	require.Len(t, result, 2500)
+	for i, candle := range result {
+		require.Equal(t, float64(i), candle.Close)
+	}
+
+	result, err = binance.CandlesByPeriod(context.Background(), "BTCUSDT", "1m", start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+}
+
+func TestServer_Orders(t *testing.T) {
+	server, binance := newExchange(t)
+
+	order, err := binance.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2, false)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.Equal(t, 1200.0, order.Price)
+
+	asset, quote, err := binance.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, asset)
+	require.Equal(t, 7600.0, quote)
+
+	// limit order is filled when the price crosses the limit
+	order, err = binance.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 1300)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+	free, locked := server.Balance("BTC")
+	require.Equal(t, 1.0, free)
+	require.Equal(t, 1.0, locked)
+
+	server.SetPrice("BTCUSDT", 1310)
+	order, err = binance.Order("BTCUSDT", order.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.Equal(t, 1300.0, order.Price)
+
+	// one leg of OCO cancels the other
+	orders, err := binance.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 1500, 1000, 990)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+
+	server.SetPrice("BTCUSDT", 995)
+	statuses := make(map[model.OrderType]model.OrderStatusType)
+	for _, item := range orders {
+		order, err := binance.Order("BTCUSDT", item.ExchangeID)
+		require.NoError(t, err)
+		statuses[order.Type] = order.Status
+	}
+	require.Equal(t, model.OrderStatusTypeFilled, statuses[model.OrderTypeStopLossLimit])
+	require.Equal(t, model.OrderStatusTypeCanceled, statuses[model.OrderTypeLimitMaker])
+
+	_, err = binance.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 10, false)
+	require.Error(t, err)
+}
+
+func TestServer_ClientOrderID(t *testing.T) {
+	_, binance := newExchange(t)
+
+	order, err := binance.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+		Type: model.OrderTypeLimit, Quantity: 1, Price: 1100, ClientOrderID: "ninjabot-1"})
+	require.NoError(t, err)
+	require.Equal(t, "ninjabot-1", order.ClientOrderID)
+	require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+	found, err := binance.OrderByClientID("BTCUSDT", "ninjabot-1")
+	require.NoError(t, err)
+	require.Equal(t, order.ExchangeID, found.ExchangeID)
+	require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+	_, err = binance.OrderByClientID("BTCUSDT", "ninjabot-2")
+	require.ErrorIs(t, err, exchange.ErrOrderNotFound)
+
+	order, err = binance.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+		Type: model.OrderTypeMarket, QuoteQuantity: 1200, ClientOrderID: "ninjabot-3"})
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.Equal(t, 1.0, order.Quantity)
+	require.Equal(t, 1200.0, order.Price)
+}
+
+func TestServer_OrderOptions(t *testing.T) {
+	server, binance := newExchange(t)
+
+	order, err := binance.CreateOrderLimitOptions(model.SideTypeBuy, "BTCUSDT", 2, 1100,
+		model.OrderOptions{IcebergQuantity: 0.5})
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeNew, order.Status)
+	orders := server.Orders("BTCUSDT")
+	require.Equal(t, "0.5", orders[len(orders)-1].IcebergQuantity)
+
+	_, err = binance.CreateOrderLimitOptions(model.SideTypeBuy, "BTCUSDT", 2, 1100,
+		model.OrderOptions{IcebergQuantity: 2})
+	require.ErrorIs(t, err, exchange.ErrInvalidQuantity)
+
+	// post only orders crossing the price are rejected
+	order, err = binance.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 1100, model.TimeInForceGTX)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderTypeLimitMaker, order.Type)
+
+	_, err = binance.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 1250, model.TimeInForceGTX)
+	require.ErrorIs(t, err, exchange.ErrPostOnlyRejected)
+}
+
+func TestServer_Margin(t *testing.T) {
+	t.Run("short", func(t *testing.T) {
+		server, binance := newExchange(t, exchange.WithBinanceMargin(false))
+
+		// selling without base asset borrows it
+		order, err := binance.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 2, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 2.0, server.Borrowed("BTC"))
+
+		asset, quote, err := binance.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -2.0, asset)
+		require.Equal(t, 12400.0, quote)
+
+		// buying back repays the debt
+		server.SetPrice("BTCUSDT", 1000)
+		_, err = binance.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2, false)
+		require.NoError(t, err)
+		require.Equal(t, 0.0, server.Borrowed("BTC"))
+
+		asset, quote, err = binance.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.0, asset)
+		require.Equal(t, 10400.0, quote)
+
+		orders, err := binance.Orders("BTCUSDT", 10)
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+	})
+
+	t.Run("isolated borrow and repay", func(t *testing.T) {
+		server, binance := newExchange(t, exchange.WithBinanceMargin(true))
+
+		require.NoError(t, binance.Borrow("BTCUSDT", "BTC", 1))
+		require.Equal(t, 1.0, server.Borrowed("BTC"))
+
+		asset, _, err := binance.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.0, asset)
+
+		require.NoError(t, binance.Repay("BTCUSDT", "BTC", 1))
+		require.Equal(t, 0.0, server.Borrowed("BTC"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		_, binance := newExchange(t)
+		require.ErrorIs(t, binance.Borrow("BTCUSDT", "BTC", 1), exchange.ErrBinanceMarginDisabled)
+	})
+}
+
+func TestServer_CandlesSubscription(t *testing.T) {
+	server, binance := newExchange(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Date(2022, 1, 1, 3, 0, 0, 0, time.UTC)
+	ccandle, cerr := binance.CandlesSubscription(ctx, "BTCUSDT", "1h")
+	go func() {
+		for range cerr {
+		}
+	}()
+	require.Eventually(t, func() bool { return server.Streams() == 1 }, time.Second, 10*time.Millisecond)
+
+	server.PushKline("BTCUSDT", "1h", candles(start, 1300)[0])
+	candle := <-ccandle
+	require.Equal(t, 1300.0, candle.Close)
+	require.True(t, candle.Complete)
+
+	// the subscription reconnects after a disconnection
+	server.DisconnectStreams()
+	require.Eventually(t, func() bool { return server.Streams() == 1 }, 2*time.Second, 10*time.Millisecond)
+
+	server.PushKline("BTCUSDT", "1h", candles(start.Add(time.Hour), 1400)[0])
+	candle = <-ccandle
+	require.Equal(t, 1400.0, candle.Close)
+}
+
+func TestServer_UserDataStream(t *testing.T) {
+	server, _ := newExchange(t)
+
+	client := binance.NewClient("", "")
+	client.SetApiEndpoint(server.URL())
+	listenKey, err := client.NewStartUserStreamService().Do(context.Background())
+	require.NoError(t, err)
+
+	conn, _, err := websocket.DefaultDialer.Dial(server.StreamURL()+"/"+listenKey, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool { return server.Streams() == 1 }, time.Second, 10*time.Millisecond)
+
+	_, err = client.NewCreateOrderService().Symbol("BTCUSDT").Side(binance.SideTypeBuy).
+		Type(binance.OrderTypeMarket).Quantity("1").Do(context.Background())
+	require.NoError(t, err)
+
+	var events []string
+	for len(events) < 4 {
+		_, message, err := conn.ReadMessage()
+		require.NoError(t, err)
+
+		event := new(binance.WsUserDataEvent)
+		require.NoError(t, json.Unmarshal(message, event))
+		events = append(events, string(event.Event))
+	}
+
+	require.Equal(t, []string{
+		"executionReport", "outboundAccountPosition",
+		"executionReport", "outboundAccountPosition",
+	}, events)
+}
@@ -0,0 +1,1417 @@
+package exchange
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/jpillora/backoff"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+const (
+	okxEndpoint              = "https://www.okx.com"
+	okxStreamEndpoint        = "wss://ws.okx.com:8443/ws/v5/business"
+	okxPrivateStreamEndpoint = "wss://ws.okx.com:8443/ws/v5/private"
+
+	okxDemoStreamEndpoint        = "wss://wspap.okx.com:8443/ws/v5/business"
+	okxDemoPrivateStreamEndpoint = "wss://wspap.okx.com:8443/ws/v5/private"
+
+	// okxCandleLimit and okxHistoryCandleLimit are the maximum number of candles returned by a request
+	okxCandleLimit        = 300
+	okxHistoryCandleLimit = 100
+
+	okxErrOrderNotFound = "51603"
+)
+
+// OKXInstrumentType is the market of an OKX exchange instance
+type OKXInstrumentType string
+
+var (
+	OKXSpot OKXInstrumentType = "SPOT"
+	OKXSwap OKXInstrumentType = "SWAP"
+)
+
+// OKXError is an error returned by the OKX API
+type OKXError struct {
+	Code    string
+	Message string
+}
+
+func (e *OKXError) Error() string {
+	return fmt.Sprintf("okx error %s: %s", e.Code, e.Message)
+}
+
+type okxInstrument struct {
+	InstID   string `json:"instId"`
+	BaseCcy  string `json:"baseCcy"`
+	QuoteCcy string `json:"quoteCcy"`
+	Uly      string `json:"uly"`
+	CtVal    string `json:"ctVal"`
+	LotSz    string `json:"lotSz"`
+	MinSz    string `json:"minSz"`
+	MaxLmtSz string `json:"maxLmtSz"`
+	TickSz   string `json:"tickSz"`
+
+	// contractValue is the size of a contract in the base asset, 1 for spot
+	contractValue float64
+	lotSize       float64
+}
+
+// OKX is the OKX exchange, for spot or perpetual swap markets. Pairs keep the ninjabot format, eg: BTCUSDT,
+// and are translated to OKX instruments, eg: BTC-USDT or BTC-USDT-SWAP. Swap quantities are also given in the
+// base asset and converted to contracts.
+type OKX struct {
+	ctx            context.Context
+	client         *http.Client
+	assetsInfo     map[string]model.AssetInfo
+	instruments    map[string]okxInstrument
+	pairs          map[string]string
+	InstrumentType OKXInstrumentType
+	HeikinAshi     bool
+	Demo           bool
+
+	APIKey     string
+	APISecret  string
+	Passphrase string
+
+	// Endpoint, StreamEndpoint and PrivateStreamEndpoint override the REST, candles and private
+	// websocket URLs, eg: for a mock server
+	Endpoint              string
+	StreamEndpoint        string
+	PrivateStreamEndpoint string
+
+	MetadataFetchers []MetadataFetchers
+	MetadataTimeout  time.Duration
+	metadataKeys     metadataKeys
+	PairOptions      []PairOption
+}
+
+type OKXOption func(*OKX)
+
+// WithOKXCredentials will set the credentials for OKX
+func WithOKXCredentials(key, secret, passphrase string) OKXOption {
+	return func(o *OKX) {
+		o.APIKey = key
+		o.APISecret = secret
+		o.Passphrase = passphrase
+	}
+}
+
+// WithOKXSwap will trade perpetual swaps instead of spot
+func WithOKXSwap() OKXOption {
+	return func(o *OKX) {
+		o.InstrumentType = OKXSwap
+	}
+}
+
+// WithOKXDemo will use the OKX demo trading environment
+func WithOKXDemo() OKXOption {
+	return func(o *OKX) {
+		o.Demo = true
+	}
+}
+
+// WithOKXHeikinAshiCandle will use Heikin Ashi candle instead of regular candle
+func WithOKXHeikinAshiCandle() OKXOption {
+	return func(o *OKX) {
+		o.HeikinAshi = true
+	}
+}
+
+// WithOKXMetadataFetcher will execute a function after receive a new candle and include additional
+// information to candle's metadata
+func WithOKXMetadataFetcher(fetcher MetadataFetchers) OKXOption {
+	return func(o *OKX) {
+		o.MetadataFetchers = append(o.MetadataFetchers, fetcher)
+	}
+}
+
+// WithOKXLeverage will set the leverage and margin type of a swap pair
+func WithOKXLeverage(pair string, leverage int, marginType MarginType) OKXOption {
+	return func(o *OKX) {
+		o.PairOptions = append(o.PairOptions, PairOption{
+			Pair:       strings.ToUpper(pair),
+			Leverage:   leverage,
+			MarginType: marginType,
+		})
+	}
+}
+
+// WithOKXEndpoint overrides the REST, candles and private websocket endpoints
+func WithOKXEndpoint(endpoint, streamEndpoint, privateStreamEndpoint string) OKXOption {
+	return func(o *OKX) {
+		o.Endpoint = endpoint
+		o.StreamEndpoint = streamEndpoint
+		o.PrivateStreamEndpoint = privateStreamEndpoint
+	}
+}
+
+// NewOKX will create a new OKX instance, for spot markets by default
+func NewOKX(ctx context.Context, options ...OKXOption) (*OKX, error) {
+	exchange := &OKX{
+		ctx:             ctx,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		InstrumentType:  OKXSpot,
+		MetadataTimeout: defaultMetadataTimeout,
+	}
+	for _, option := range options {
+		option(exchange)
+	}
+
+	if exchange.Endpoint == "" {
+		exchange.Endpoint, exchange.StreamEndpoint, exchange.PrivateStreamEndpoint =
+			okxEndpoint, okxStreamEndpoint, okxPrivateStreamEndpoint
+		if exchange.Demo {
+			exchange.StreamEndpoint, exchange.PrivateStreamEndpoint = okxDemoStreamEndpoint, okxDemoPrivateStreamEndpoint
+		}
+	}
+
+	err := exchange.request(ctx, http.MethodGet, "/api/v5/public/time", nil, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("okx ping fail: %w", err)
+	}
+
+	// Initialize with orders precision and assets limits
+	if err := exchange.loadInstruments(ctx); err != nil {
+		return nil, err
+	}
+
+	// Set leverage and margin type
+	for _, option := range exchange.PairOptions {
+		err := exchange.request(ctx, http.MethodPost, "/api/v5/account/set-leverage", map[string]interface{}{
+			"instId":  exchange.instID(option.Pair),
+			"lever":   strconv.Itoa(option.Leverage),
+			"mgnMode": exchange.marginMode(option.Pair),
+		}, true, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Infof("[SETUP] Using OKX exchange (%s)", exchange.InstrumentType)
+
+	return exchange, nil
+}
+
+// request sends a REST request, GET params must be a map sent in the query string, and POST params are sent
+// in a JSON body. Signed requests are authenticated with the HMAC signature of the timestamp, method,
+// path and body.
+func (o *OKX) request(ctx context.Context, method, path string, params interface{},
+	signed bool, result interface{}) error {
+
+	var body []byte
+	requestPath := path
+	if method == http.MethodGet {
+		query := url.Values{}
+		if values, ok := params.(map[string]interface{}); ok {
+			for key, value := range values {
+				query.Set(key, fmt.Sprint(value))
+			}
+		}
+		if len(query) > 0 {
+			requestPath += "?" + query.Encode()
+		}
+	} else {
+		var err error
+		body, err = json.Marshal(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, o.Endpoint+requestPath, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.Demo {
+		req.Header.Set("x-simulated-trading", "1")
+	}
+
+	if signed {
+		timestamp := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+		req.Header.Set("OK-ACCESS-KEY", o.APIKey)
+		req.Header.Set("OK-ACCESS-PASSPHRASE", o.Passphrase)
+		req.Header.Set("OK-ACCESS-TIMESTAMP", timestamp)
+		req.Header.Set("OK-ACCESS-SIGN", o.sign(timestamp+method+requestPath+string(body)))
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Code string          `json:"code"`
+		Msg  string          `json:"msg"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("okx %s %s: status %d: %w", method, path, resp.StatusCode, err)
+	}
+
+	if response.Code != "0" {
+		// order errors are detailed in the data items
+		var items []struct {
+			SCode string `json:"sCode"`
+			SMsg  string `json:"sMsg"`
+		}
+		if json.Unmarshal(response.Data, &items) == nil && len(items) > 0 && items[0].SCode != "" {
+			return &OKXError{Code: items[0].SCode, Message: items[0].SMsg}
+		}
+		return &OKXError{Code: response.Code, Message: response.Msg}
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(response.Data, result)
+}
+
+func (o *OKX) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(o.APISecret))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (o *OKX) loadInstruments(ctx context.Context) error {
+	var instruments []okxInstrument
+	err := o.request(ctx, http.MethodGet, "/api/v5/public/instruments", map[string]interface{}{
+		"instType": string(o.InstrumentType),
+	}, false, &instruments)
+	if err != nil {
+		return err
+	}
+
+	o.assetsInfo = make(map[string]model.AssetInfo)
+	o.instruments = make(map[string]okxInstrument)
+	o.pairs = make(map[string]string)
+	for _, instrument := range instruments {
+		base, quote := instrument.BaseCcy, instrument.QuoteCcy
+		if o.InstrumentType == OKXSwap {
+			// swap instruments are named by the underlying index, eg: BTC-USDT-SWAP
+			parts := strings.Split(instrument.Uly, "-")
+			if len(parts) != 2 {
+				continue
+			}
+			base, quote = parts[0], parts[1]
+		}
+
+		instrument.contractValue = 1
+		if value, err := strconv.ParseFloat(instrument.CtVal, 64); err == nil && value > 0 {
+			instrument.contractValue = value
+		}
+
+		instrument.lotSize, _ = strconv.ParseFloat(instrument.LotSz, 64)
+
+		info := model.AssetInfo{BaseAsset: base, QuoteAsset: quote}
+		info.StepSize = instrument.lotSize
+		info.MinQuantity, _ = strconv.ParseFloat(instrument.MinSz, 64)
+		info.MaxQuantity, _ = strconv.ParseFloat(instrument.MaxLmtSz, 64)
+		info.TickSize, _ = strconv.ParseFloat(instrument.TickSz, 64)
+		info.StepSize *= instrument.contractValue
+		info.MinQuantity *= instrument.contractValue
+		info.MaxQuantity *= instrument.contractValue
+		info.BaseAssetPrecision = getDecimalPrecision(info.StepSize)
+		info.QuotePrecision = getDecimalPrecision(info.TickSize)
+		info.PricePrecision = info.QuotePrecision
+
+		pair := base + quote
+		o.assetsInfo[pair] = info
+		RegisterPair(pair, info.BaseAsset, info.QuoteAsset)
+		o.instruments[pair] = instrument
+		o.pairs[instrument.InstID] = pair
+	}
+
+	return nil
+}
+
+// instID returns the OKX instrument of a pair, eg: BTCUSDT => BTC-USDT-SWAP
+func (o *OKX) instID(pair string) string {
+	if instrument, ok := o.instruments[pair]; ok {
+		return instrument.InstID
+	}
+
+	asset, quote := SplitAssetQuote(pair)
+	if o.InstrumentType == OKXSwap {
+		return fmt.Sprintf("%s-%s-SWAP", asset, quote)
+	}
+	return fmt.Sprintf("%s-%s", asset, quote)
+}
+
+// pair returns the ninjabot pair of an OKX instrument, eg: BTC-USDT-SWAP => BTCUSDT
+func (o *OKX) pair(instID string) string {
+	if pair, ok := o.pairs[instID]; ok {
+		return pair
+	}
+	parts := strings.Split(instID, "-")
+	if len(parts) < 2 {
+		return instID
+	}
+	return parts[0] + parts[1]
+}
+
+func (o *OKX) contractValue(pair string) float64 {
+	if instrument, ok := o.instruments[pair]; ok {
+		return instrument.contractValue
+	}
+	return 1
+}
+
+// marginMode returns the trade mode of orders, cash for spot and the configured margin type for swaps
+func (o *OKX) marginMode(pair string) string {
+	if o.InstrumentType == OKXSpot {
+		return "cash"
+	}
+	for _, option := range o.PairOptions {
+		if option.Pair == pair && option.MarginType == MarginTypeIsolated {
+			return "isolated"
+		}
+	}
+	return "cross"
+}
+
+func (o *OKX) LastQuote(ctx context.Context, pair string) (float64, error) {
+	candles, err := o.CandlesByLimit(ctx, pair, "1m", 1)
+	if err != nil || len(candles) < 1 {
+		return 0, err
+	}
+	return candles[0].Close, nil
+}
+
+func (o *OKX) AssetsInfo(pair string) model.AssetInfo {
+	return o.assetsInfo[pair]
+}
+
+func (o *OKX) validate(pair string, quantity float64) error {
+	info, ok := o.assetsInfo[pair]
+	if !ok {
+		return ErrInvalidAsset
+	}
+
+	if quantity > info.MaxQuantity || quantity < info.MinQuantity {
+		return &OrderError{
+			Err:      fmt.Errorf("%w: min: %f max: %f", ErrInvalidQuantity, info.MinQuantity, info.MaxQuantity),
+			Pair:     pair,
+			Quantity: quantity,
+		}
+	}
+
+	return nil
+}
+
+func (o *OKX) formatPrice(pair string, value float64) string {
+	if info, ok := o.assetsInfo[pair]; ok {
+		value = common.AmountToLotSize(info.TickSize, info.QuotePrecision, value)
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// formatQuantity returns the order size of a quantity of the base asset, in contracts for swaps
+func (o *OKX) formatQuantity(pair string, value float64) string {
+	return formatStep(value/o.contractValue(pair), o.instruments[pair].lotSize)
+}
+
+func okxSide(side model.SideType) string {
+	return strings.ToLower(string(side))
+}
+
+// createOrder places an order and returns its current state
+func (o *OKX) createOrder(pair, clientOrderID string, params map[string]interface{}) (model.Order, error) {
+	params["instId"] = o.instID(pair)
+	params["tdMode"] = o.marginMode(pair)
+	if clientOrderID != "" {
+		params["clOrdId"] = strconv.FormatInt(clientOrderNumber(clientOrderID), 10)
+	}
+
+	var result []struct {
+		OrdID string `json:"ordId"`
+	}
+	if err := o.request(o.ctx, http.MethodPost, "/api/v5/trade/order", params, true, &result); err != nil {
+		return model.Order{}, err
+	}
+	if len(result) == 0 {
+		return model.Order{}, fmt.Errorf("okx order without id")
+	}
+
+	id, err := strconv.ParseInt(result[0].OrdID, 10, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return o.Order(pair, id)
+}
+
+// createAlgoOrder places a conditional order and returns its current state
+func (o *OKX) createAlgoOrder(pair, clientOrderID string, quantity float64,
+	params map[string]interface{}) (model.Order, error) {
+	params["instId"] = o.instID(pair)
+	params["tdMode"] = o.marginMode(pair)
+	params["ordType"] = "conditional"
+	if clientOrderID != "" {
+		params["algoClOrdId"] = strconv.FormatInt(clientOrderNumber(clientOrderID), 10)
+	}
+	if quantity > 0 {
+		if err := o.validate(pair, quantity); err != nil {
+			return model.Order{}, err
+		}
+		params["sz"] = o.formatQuantity(pair, quantity)
+	} else {
+		if o.InstrumentType == OKXSpot {
+			return model.Order{}, ErrInvalidQuantity
+		}
+		params["closeFraction"] = "1"
+		params["reduceOnly"] = true
+	}
+
+	var result []struct {
+		AlgoID string `json:"algoId"`
+	}
+	if err := o.request(o.ctx, http.MethodPost, "/api/v5/trade/order-algo", params, true, &result); err != nil {
+		return model.Order{}, err
+	}
+	if len(result) == 0 {
+		return model.Order{}, fmt.Errorf("okx algo order without id")
+	}
+
+	id, err := strconv.ParseInt(result[0].AlgoID, 10, 64)
+	if err != nil {
+		return model.Order{}, err
+	}
+	return o.Order(pair, id)
+}
+
+func (o *OKX) CreateOrderOCO(_ model.SideType, _ string, _, _, _, _ float64) ([]model.Order, error) {
+	return nil, fmt.Errorf("%w: okx oco", ErrUnsupportedOrder)
+}
+
+func (o *OKX) CreateOrderLimit(side model.SideType, pair string,
+	quantity float64, limit float64) (model.Order, error) {
+	return o.createOrderLimit(side, pair, quantity, limit, "")
+}
+
+func (o *OKX) createOrderLimit(side model.SideType, pair string, quantity float64, limit float64,
+	clientOrderID string) (model.Order, error) {
+
+	err := o.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	return o.createOrder(pair, clientOrderID, map[string]interface{}{
+		"side":    okxSide(side),
+		"ordType": "limit",
+		"sz":      o.formatQuantity(pair, quantity),
+		"px":      o.formatPrice(pair, limit),
+	})
+}
+
+func (o *OKX) CreateOrderMarket(side model.SideType, pair string, quantity float64,
+	reduceOnly bool) (model.Order, error) {
+	return o.createOrderMarket(side, pair, quantity, reduceOnly, "")
+}
+
+func (o *OKX) createOrderMarket(side model.SideType, pair string, quantity float64, reduceOnly bool,
+	clientOrderID string) (model.Order, error) {
+
+	err := o.validate(pair, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	params := map[string]interface{}{
+		"side":    okxSide(side),
+		"ordType": "market",
+		"sz":      o.formatQuantity(pair, quantity),
+	}
+	if o.InstrumentType == OKXSpot {
+		// spot market buys are sized in the quote currency by default
+		params["tgtCcy"] = "base_ccy"
+	} else if reduceOnly {
+		params["reduceOnly"] = true
+	}
+
+	return o.createOrder(pair, clientOrderID, params)
+}
+
+func (o *OKX) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	return o.createOrderMarketQuote(side, pair, quote, "")
+}
+
+func (o *OKX) createOrderMarketQuote(side model.SideType, pair string, quote float64,
+	clientOrderID string) (model.Order, error) {
+	if o.InstrumentType != OKXSpot {
+		return model.Order{}, fmt.Errorf("%w: okx swap market order by quote", ErrUnsupportedOrder)
+	}
+
+	return o.createOrder(pair, clientOrderID, map[string]interface{}{
+		"side":    okxSide(side),
+		"ordType": "market",
+		"sz":      strconv.FormatFloat(quote, 'f', o.assetsInfo[pair].QuotePrecision, 64),
+		"tgtCcy":  "quote_ccy",
+	})
+}
+
+// CreateOrderStop places a conditional market order triggered at the limit price. As in BinanceFuture,
+// a negative limit creates a buy stop, and a zero quantity closes the whole swap position.
+func (o *OKX) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	side := model.SideTypeSell
+	if limit < 0 {
+		side = model.SideTypeBuy
+		limit = -limit
+	}
+	return o.createOrderStop(side, pair, quantity, limit, "")
+}
+
+func (o *OKX) createOrderStop(side model.SideType, pair string, quantity float64, limit float64,
+	clientOrderID string) (model.Order, error) {
+	return o.createAlgoOrder(pair, clientOrderID, quantity, map[string]interface{}{
+		"side":        okxSide(side),
+		"slTriggerPx": o.formatPrice(pair, limit),
+		"slOrdPx":     "-1",
+	})
+}
+
+// TakeProfit places a conditional order triggered at the limit price, a limit order for a given quantity
+// or a market order closing the whole swap position when the quantity is zero
+func (o *OKX) TakeProfit(side model.SideType, pair string, quantity float64, limit float64) (model.Order, error) {
+	return o.takeProfit(side, pair, quantity, limit, "")
+}
+
+func (o *OKX) takeProfit(side model.SideType, pair string, quantity float64, limit float64,
+	clientOrderID string) (model.Order, error) {
+	price := o.formatPrice(pair, limit)
+	if quantity == 0 {
+		price = "-1"
+	}
+
+	return o.createAlgoOrder(pair, clientOrderID, quantity, map[string]interface{}{
+		"side":        okxSide(side),
+		"tpTriggerPx": o.formatPrice(pair, limit),
+		"tpOrdPx":     price,
+	})
+}
+
+// CreateOrderRequest places an order with the client order ID of the request. OKX only accepts alphanumeric
+// client order IDs, so a number derived from the client order ID is sent as clOrdId, or algoClOrdId for
+// conditional orders.
+func (o *OKX) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	var (
+		order model.Order
+		err   error
+	)
+	switch request.Type {
+	case model.OrderTypeLimit:
+		if request.TimeInForce != "" && request.TimeInForce != model.TimeInForceGTC {
+			return model.Order{}, fmt.Errorf("%w: okx time in force %s", ErrUnsupportedOrder, request.TimeInForce)
+		}
+		if request.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: okx iceberg order", ErrUnsupportedOrder)
+		}
+		order, err = o.createOrderLimit(request.Side, request.Pair, request.Quantity, request.Price,
+			request.ClientOrderID)
+	case model.OrderTypeMarket:
+		if request.QuoteQuantity > 0 {
+			order, err = o.createOrderMarketQuote(request.Side, request.Pair, request.QuoteQuantity,
+				request.ClientOrderID)
+		} else {
+			order, err = o.createOrderMarket(request.Side, request.Pair, request.Quantity, request.ReduceOnly,
+				request.ClientOrderID)
+		}
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		order, err = o.createOrderStop(request.Side, request.Pair, request.Quantity, request.Stop,
+			request.ClientOrderID)
+	case model.OrderTypeTakeProfit, model.OrderTypeTakeProfitLimit:
+		order, err = o.takeProfit(request.Side, request.Pair, request.Quantity, request.Stop, request.ClientOrderID)
+	default:
+		return model.Order{}, fmt.Errorf("%w: okx %s", ErrUnsupportedOrder, request.Type)
+	}
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// OrderByClientID returns a regular or conditional order by its client order ID, or ErrOrderNotFound
+func (o *OKX) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	var orders []okxOrder
+	err := o.request(o.ctx, http.MethodGet, "/api/v5/trade/order", map[string]interface{}{
+		"instId":  o.instID(pair),
+		"clOrdId": strconv.FormatInt(clientOrderNumber(clientOrderID), 10),
+	}, true, &orders)
+	var apiError *OKXError
+	if err != nil && (!errors.As(err, &apiError) || apiError.Code != okxErrOrderNotFound) {
+		return model.Order{}, err
+	}
+	if err == nil && len(orders) > 0 {
+		order := o.order(orders[0])
+		order.ClientOrderID = clientOrderID
+		return order, nil
+	}
+
+	var algos []okxAlgoOrder
+	err = o.request(o.ctx, http.MethodGet, "/api/v5/trade/order-algo", map[string]interface{}{
+		"algoClOrdId": strconv.FormatInt(clientOrderNumber(clientOrderID), 10),
+	}, true, &algos)
+	if err != nil && (!errors.As(err, &apiError) || apiError.Code != okxErrOrderNotFound) {
+		return model.Order{}, err
+	}
+	if err != nil || len(algos) == 0 {
+		return model.Order{}, fmt.Errorf("%w: %s", ErrOrderNotFound, clientOrderID)
+	}
+
+	order := o.algoOrder(algos[0])
+	order.ClientOrderID = clientOrderID
+	return order, nil
+}
+
+func isOKXAlgoOrder(order model.Order) bool {
+	switch order.Type {
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit, model.OrderTypeTakeProfit,
+		model.OrderTypeTakeProfitLimit:
+		return true
+	}
+	return false
+}
+
+func (o *OKX) Cancel(order model.Order) error {
+	id := strconv.FormatInt(order.ExchangeID, 10)
+	if isOKXAlgoOrder(order) {
+		return o.request(o.ctx, http.MethodPost, "/api/v5/trade/cancel-algos", []map[string]interface{}{
+			{"algoId": id, "instId": o.instID(order.Pair)},
+		}, true, nil)
+	}
+
+	return o.request(o.ctx, http.MethodPost, "/api/v5/trade/cancel-order", map[string]interface{}{
+		"instId": o.instID(order.Pair),
+		"ordId":  id,
+	}, true, nil)
+}
+
+func (o *OKX) CancelOpenOrders(pair string) error {
+	orders, err := o.OpenOrders(pair)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		if err := o.Cancel(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *OKX) OpenOrders(pair string) ([]model.Order, error) {
+	var pending []okxOrder
+	err := o.request(o.ctx, http.MethodGet, "/api/v5/trade/orders-pending", map[string]interface{}{
+		"instType": string(o.InstrumentType),
+		"instId":   o.instID(pair),
+	}, true, &pending)
+	if err != nil {
+		return nil, err
+	}
+
+	var algos []okxAlgoOrder
+	err = o.request(o.ctx, http.MethodGet, "/api/v5/trade/orders-algo-pending", map[string]interface{}{
+		"instType": string(o.InstrumentType),
+		"instId":   o.instID(pair),
+		"ordType":  "conditional",
+	}, true, &algos)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(pending)+len(algos))
+	for _, order := range pending {
+		orders = append(orders, o.order(order))
+	}
+	for _, order := range algos {
+		orders = append(orders, o.algoOrder(order))
+	}
+	return orders, nil
+}
+
+func (o *OKX) Orders(pair string, limit int) ([]model.Order, error) {
+	var result []okxOrder
+	err := o.request(o.ctx, http.MethodGet, "/api/v5/trade/orders-history", map[string]interface{}{
+		"instType": string(o.InstrumentType),
+		"instId":   o.instID(pair),
+		"limit":    limit,
+	}, true, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]model.Order, 0, len(result))
+	for _, order := range result {
+		orders = append(orders, o.order(order))
+	}
+	return orders, nil
+}
+
+// Order returns a regular order by its id, or a conditional order by its algo id
+func (o *OKX) Order(pair string, id int64) (model.Order, error) {
+	var orders []okxOrder
+	err := o.request(o.ctx, http.MethodGet, "/api/v5/trade/order", map[string]interface{}{
+		"instId": o.instID(pair),
+		"ordId":  strconv.FormatInt(id, 10),
+	}, true, &orders)
+	var apiError *OKXError
+	if err != nil && (!errors.As(err, &apiError) || apiError.Code != okxErrOrderNotFound) {
+		return model.Order{}, err
+	}
+	if err == nil && len(orders) > 0 {
+		return o.order(orders[0]), nil
+	}
+
+	var algos []okxAlgoOrder
+	err = o.request(o.ctx, http.MethodGet, "/api/v5/trade/order-algo", map[string]interface{}{
+		"algoId": strconv.FormatInt(id, 10),
+	}, true, &algos)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if len(algos) == 0 {
+		return model.Order{}, fmt.Errorf("okx order %d not found", id)
+	}
+	return o.algoOrder(algos[0]), nil
+}
+
+type okxOrder struct {
+	InstID    string `json:"instId"`
+	OrdID     string `json:"ordId"`
+	ClOrdID   string `json:"clOrdId"`
+	Side      string `json:"side"`
+	OrdType   string `json:"ordType"`
+	State     string `json:"state"`
+	Px        string `json:"px"`
+	Sz        string `json:"sz"`
+	AvgPx     string `json:"avgPx"`
+	AccFillSz string `json:"accFillSz"`
+	CTime     string `json:"cTime"`
+	UTime     string `json:"uTime"`
+}
+
+type okxAlgoOrder struct {
+	InstID      string `json:"instId"`
+	AlgoID      string `json:"algoId"`
+	AlgoClOrdID string `json:"algoClOrdId"`
+	Side        string `json:"side"`
+	State       string `json:"state"`
+	Sz          string `json:"sz"`
+	SlTriggerPx string `json:"slTriggerPx"`
+	SlOrdPx     string `json:"slOrdPx"`
+	TpTriggerPx string `json:"tpTriggerPx"`
+	TpOrdPx     string `json:"tpOrdPx"`
+	CTime       string `json:"cTime"`
+	UTime       string `json:"uTime"`
+}
+
+func okxTime(value string) time.Time {
+	milliseconds, _ := strconv.ParseInt(value, 10, 64)
+	return time.Unix(0, milliseconds*int64(time.Millisecond))
+}
+
+func (o *OKX) order(order okxOrder) model.Order {
+	pair := o.pair(order.InstID)
+	id, _ := strconv.ParseInt(order.OrdID, 10, 64)
+
+	result := model.Order{
+		ExchangeID: id,
+		Pair:       pair,
+		Side:       model.SideType(strings.ToUpper(order.Side)),
+		Type:       model.OrderTypeLimit,
+		CreatedAt:  okxTime(order.CTime),
+		UpdatedAt:  okxTime(order.UTime),
+	}
+
+	switch order.OrdType {
+	case "market":
+		result.Type = model.OrderTypeMarket
+	case "post_only":
+		result.Type = model.OrderTypeLimitMaker
+	}
+
+	switch order.State {
+	case "partially_filled":
+		result.Status = model.OrderStatusTypePartiallyFilled
+	case "filled":
+		result.Status = model.OrderStatusTypeFilled
+	case "canceled", "mmp_canceled":
+		result.Status = model.OrderStatusTypeCanceled
+	default:
+		result.Status = model.OrderStatusTypeNew
+	}
+
+	var err error
+	filled, _ := strconv.ParseFloat(order.AccFillSz, 64)
+	average, _ := strconv.ParseFloat(order.AvgPx, 64)
+	if filled > 0 && average > 0 {
+		result.Price, result.Quantity = average, filled
+	} else {
+		result.Price, err = strconv.ParseFloat(order.Px, 64)
+		log.CheckErr(log.WarnLevel, err)
+		result.Quantity, err = strconv.ParseFloat(order.Sz, 64)
+		log.CheckErr(log.WarnLevel, err)
+	}
+	result.Quantity *= o.contractValue(pair)
+
+	return result
+}
+
+func (o *OKX) algoOrder(order okxAlgoOrder) model.Order {
+	pair := o.pair(order.InstID)
+	id, _ := strconv.ParseInt(order.AlgoID, 10, 64)
+
+	result := model.Order{
+		ExchangeID: id,
+		Pair:       pair,
+		Side:       model.SideType(strings.ToUpper(order.Side)),
+		CreatedAt:  okxTime(order.CTime),
+		UpdatedAt:  okxTime(order.UTime),
+	}
+	if order.UTime == "" {
+		result.UpdatedAt = result.CreatedAt
+	}
+
+	trigger, price := order.TpTriggerPx, order.TpOrdPx
+	result.Type = model.OrderTypeTakeProfit
+	if order.SlTriggerPx != "" {
+		trigger, price = order.SlTriggerPx, order.SlOrdPx
+		result.Type = model.OrderTypeStopLoss
+	}
+
+	stop, _ := strconv.ParseFloat(trigger, 64)
+	result.Stop = &stop
+	result.Price = stop
+	if limit, err := strconv.ParseFloat(price, 64); err == nil && limit > 0 {
+		result.Price = limit
+		if result.Type == model.OrderTypeStopLoss {
+			result.Type = model.OrderTypeStopLossLimit
+		} else {
+			result.Type = model.OrderTypeTakeProfitLimit
+		}
+	}
+
+	// triggered algo orders are executed as regular orders
+	switch order.State {
+	case "effective":
+		result.Status = model.OrderStatusTypeFilled
+	case "partially_effective":
+		result.Status = model.OrderStatusTypePartiallyFilled
+	case "canceled":
+		result.Status = model.OrderStatusTypeCanceled
+	case "order_failed":
+		result.Status = model.OrderStatusTypeRejected
+	default:
+		result.Status = model.OrderStatusTypeNew
+	}
+
+	quantity, _ := strconv.ParseFloat(order.Sz, 64)
+	result.Quantity = quantity * o.contractValue(pair)
+	return result
+}
+
+func (o *OKX) Account() (model.Account, error) {
+	balances := make([]model.Balance, 0)
+
+	if o.InstrumentType == OKXSwap {
+		var positions []struct {
+			InstID  string `json:"instId"`
+			Pos     string `json:"pos"`
+			PosSide string `json:"posSide"`
+			Lever   string `json:"lever"`
+		}
+		err := o.request(o.ctx, http.MethodGet, "/api/v5/account/positions", map[string]interface{}{
+			"instType": string(OKXSwap),
+		}, true, &positions)
+		if err != nil {
+			return model.Account{}, err
+		}
+
+		for _, position := range positions {
+			contracts, err := strconv.ParseFloat(position.Pos, 64)
+			if err != nil {
+				return model.Account{}, err
+			}
+
+			if contracts == 0 {
+				continue
+			}
+
+			leverage, err := strconv.ParseFloat(position.Lever, 64)
+			if err != nil {
+				return model.Account{}, err
+			}
+
+			if position.PosSide == "short" {
+				contracts = -contracts
+			}
+
+			pair := o.pair(position.InstID)
+			asset, _ := SplitAssetQuote(pair)
+			balances = append(balances, model.Balance{
+				Asset:    asset,
+				Free:     contracts * o.contractValue(pair),
+				Leverage: leverage,
+			})
+		}
+	}
+
+	var result []struct {
+		AvailEq string `json:"availEq"`
+		Details []struct {
+			Ccy       string `json:"ccy"`
+			AvailBal  string `json:"availBal"`
+			FrozenBal string `json:"frozenBal"`
+		} `json:"details"`
+	}
+	if err := o.request(o.ctx, http.MethodGet, "/api/v5/account/balance", nil, true, &result); err != nil {
+		return model.Account{}, err
+	}
+
+	account := model.Account{}
+	for _, item := range result {
+		for _, detail := range item.Details {
+			free, err := strconv.ParseFloat(detail.AvailBal, 64)
+			if err != nil {
+				return model.Account{}, err
+			}
+			lock, _ := strconv.ParseFloat(detail.FrozenBal, 64)
+
+			if free == 0 && lock == 0 {
+				continue
+			}
+
+			balances = append(balances, model.Balance{
+				Asset: detail.Ccy,
+				Free:  free,
+				Lock:  lock,
+			})
+		}
+
+		if available, err := strconv.ParseFloat(item.AvailEq, 64); err == nil {
+			account.Available += available
+		}
+	}
+
+	account.Balances = balances
+	return account, nil
+}
+
+func (o *OKX) Position(pair string) (asset, quote float64, err error) {
+	assetTick, quoteTick := SplitAssetQuote(pair)
+	acc, err := o.Account()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	assetBalance, quoteBalance := acc.Balance(assetTick, quoteTick)
+	if o.InstrumentType == OKXSwap {
+		return assetBalance.Free + assetBalance.Lock, quoteBalance.Free, nil
+	}
+	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
+}
+
+// PositionRisk returns the size of the position, OKX does not provide position details
+func (o *OKX) PositionRisk(pair string) (model.PositionRisk, error) {
+	return positionRisk(o, pair)
+}
+
+// ModifyOrder cancels and replaces an open order, OKX does not support amending orders
+func (o *OKX) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(o, order, price, quantity)
+}
+
+// okxBar converts a ninjabot timeframe into an OKX candle bar, aligned to UTC, eg: 1h => 1H, 1d => 1Dutc
+func okxBar(period string) (string, error) {
+	switch period {
+	case "1m", "3m", "5m", "15m", "30m":
+		return period, nil
+	case "1h", "2h", "4h":
+		return strings.ToUpper(period), nil
+	case "6h", "12h", "1d", "1w":
+		return strings.ToUpper(period) + "utc", nil
+	case "1M":
+		return "1Mutc", nil
+	}
+	return "", fmt.Errorf("invalid okx bar %s", period)
+}
+
+// candle converts an OKX candle: start time, open, high, low, close, volume in contracts,
+// volume in the base currency, volume in the quote currency and confirmation
+func (o *OKX) candle(pair string, data []string) (model.Candle, error) {
+	if len(data) < 9 {
+		return model.Candle{}, fmt.Errorf("invalid okx candle: %v", data)
+	}
+
+	t := okxTime(data[0])
+	candle := model.Candle{Pair: pair, Time: t, UpdatedAt: t, Complete: data[8] == "1",
+		Metadata: make(map[string]float64)}
+
+	volume := data[5]
+	if o.InstrumentType == OKXSwap {
+		volume = data[6]
+	}
+
+	var err error
+	candle.Open, err = strconv.ParseFloat(data[1], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+	candle.High, err = strconv.ParseFloat(data[2], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+	candle.Low, err = strconv.ParseFloat(data[3], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+	candle.Close, err = strconv.ParseFloat(data[4], 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+	candle.Volume, err = strconv.ParseFloat(volume, 64)
+	if err != nil {
+		return model.Candle{}, err
+	}
+	return candle, nil
+}
+
+// candles requests candles and returns the complete ones in chronological order
+func (o *OKX) candles(ctx context.Context, path, pair, period string,
+	params map[string]interface{}) ([]model.Candle, error) {
+
+	bar, err := okxBar(period)
+	if err != nil {
+		return nil, err
+	}
+	params["instId"] = o.instID(pair)
+	params["bar"] = bar
+
+	var data [][]string
+	if err := o.request(ctx, http.MethodGet, path, params, false, &data); err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0, len(data))
+	for _, item := range data {
+		candle, err := o.candle(pair, item)
+		if err != nil {
+			return nil, err
+		}
+		if candle.Complete {
+			candles = append(candles, candle)
+		}
+	}
+
+	// okx returns the newest candles first
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Time.Before(candles[j].Time)
+	})
+	return candles, nil
+}
+
+func (o *OKX) CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error) {
+	size := limit + 1
+	if size > okxCandleLimit {
+		size = okxCandleLimit
+	}
+
+	candles, err := o.candles(ctx, "/api/v5/market/candles", pair, period, map[string]interface{}{"limit": size})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+
+	if o.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+// CandlesByPeriod returns the candles of a period, the history is requested backwards from the end time
+func (o *OKX) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	candles := make([]model.Candle, 0)
+	after := end.Add(time.Millisecond)
+	for {
+		data, err := o.candles(ctx, "/api/v5/market/history-candles", pair, period, map[string]interface{}{
+			"after":  after.UnixNano() / int64(time.Millisecond),
+			"before": start.Add(-time.Millisecond).UnixNano() / int64(time.Millisecond),
+			"limit":  okxHistoryCandleLimit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		candles = append(data, candles...)
+		if len(data) < okxHistoryCandleLimit || !data[0].Time.After(start) {
+			break
+		}
+		after = data[0].Time
+	}
+
+	if o.HeikinAshi {
+		ha := model.NewHeikinAshi()
+		for i := range candles {
+			candles[i] = candles[i].ToHeikinAshi(ha)
+		}
+	}
+
+	return candles, nil
+}
+
+func (o *OKX) CandlesSubscription(ctx context.Context, pair, period string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	ha := model.NewHeikinAshi()
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 1 * time.Second,
+		}
+
+		bar, err := okxBar(period)
+		if err != nil {
+			cerr <- err
+			close(cerr)
+			close(ccandle)
+			return
+		}
+
+		channel := "candle" + bar
+		subscribe := map[string]interface{}{
+			"op":   "subscribe",
+			"args": []map[string]string{{"channel": channel, "instId": o.instID(pair)}},
+		}
+
+		for {
+			done, stop, err := wsServeJSON(o.StreamEndpoint, []interface{}{subscribe}, "ping", func(message []byte) {
+				var event struct {
+					Arg struct {
+						Channel string `json:"channel"`
+					} `json:"arg"`
+					Data [][]string `json:"data"`
+				}
+				if err := json.Unmarshal(message, &event); err != nil || event.Arg.Channel != channel {
+					return
+				}
+
+				ba.Reset()
+				for _, data := range event.Data {
+					candle, err := o.candle(pair, data)
+					if err != nil {
+						log.Warn(err)
+						continue
+					}
+
+					if candle.Complete && o.HeikinAshi {
+						candle = candle.ToHeikinAshi(ha)
+					}
+
+					if candle.Complete {
+						// fetch aditional data if needed
+						fetchMetadata(ctx, o.MetadataFetchers, o.MetadataTimeout, &o.metadataKeys, &candle)
+					}
+
+					select {
+					case ccandle <- candle:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}, func(err error) {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+				}
+			})
+			if err != nil {
+				cerr <- err
+				close(cerr)
+				close(ccandle)
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				// wait for the stream handlers before closing the channels
+				close(stop)
+				<-done
+				close(cerr)
+				close(ccandle)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
+
+// DepthSubscription is not supported, the error channel returns ErrUnsupportedFeed
+func (o *OKX) DepthSubscription(_ context.Context, _ string, _ int) (chan model.OrderBook, chan error) {
+	return depthUnsupported("okx")
+}
+
+// AccountSubscription streams the updates of regular and conditional orders, it reconnects until the
+// context is done
+func (o *OKX) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	corder := make(chan model.Order)
+	cerr := make(chan error)
+
+	sendErr := func(err error) {
+		select {
+		case cerr <- err:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		ba := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 5 * time.Second,
+		}
+
+		subscribe := map[string]interface{}{
+			"op": "subscribe",
+			"args": []map[string]string{
+				{"channel": "orders", "instType": string(o.InstrumentType)},
+				{"channel": "orders-algo", "instType": string(o.InstrumentType)},
+			},
+		}
+
+		for {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			login := map[string]interface{}{
+				"op": "login",
+				"args": []map[string]string{{
+					"apiKey":     o.APIKey,
+					"passphrase": o.Passphrase,
+					"timestamp":  timestamp,
+					"sign":       o.sign(timestamp + "GET/users/self/verify"),
+				}},
+			}
+
+			done, stop, err := wsConnect(o.PrivateStreamEndpoint, []interface{}{login}, "ping",
+				func(conn *wsConn, message []byte) {
+					var event struct {
+						Event string `json:"event"`
+						Code  string `json:"code"`
+						Msg   string `json:"msg"`
+						Arg   struct {
+							Channel string `json:"channel"`
+						} `json:"arg"`
+						Data json.RawMessage `json:"data"`
+					}
+					if err := json.Unmarshal(message, &event); err != nil {
+						return
+					}
+
+					switch {
+					case event.Event == "login" && event.Code == "0":
+						// private channels are available after the login
+						if err := conn.send(subscribe); err != nil {
+							sendErr(err)
+						}
+						return
+					case event.Event == "error":
+						sendErr(&OKXError{Code: event.Code, Message: event.Msg})
+						return
+					}
+
+					orders := make([]model.Order, 0)
+					switch event.Arg.Channel {
+					case "orders":
+						var data []okxOrder
+						if err := json.Unmarshal(event.Data, &data); err != nil {
+							sendErr(err)
+							return
+						}
+						for _, order := range data {
+							orders = append(orders, o.order(order))
+						}
+					case "orders-algo":
+						var data []okxAlgoOrder
+						if err := json.Unmarshal(event.Data, &data); err != nil {
+							sendErr(err)
+							return
+						}
+						for _, order := range data {
+							orders = append(orders, o.algoOrder(order))
+						}
+					default:
+						return
+					}
+
+					ba.Reset()
+					for _, order := range orders {
+						select {
+						case corder <- order:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}, sendErr)
+			if err != nil {
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					close(cerr)
+					close(corder)
+					return
+				}
+				time.Sleep(ba.Duration())
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				close(stop)
+				<-done
+				close(cerr)
+				close(corder)
+				return
+			case <-done:
+				time.Sleep(ba.Duration())
+			}
+		}
+	}()
+
+	return corder, cerr
+}
@@ -0,0 +1,487 @@
+package exchange
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// okxServer emulates the subset of the OKX V5 API used by the OKX exchange
+type okxServer struct {
+	*httptest.Server
+	mtx     sync.Mutex
+	lastID  int64
+	orders  map[string]okxOrder
+	algos   map[string]okxAlgoOrder
+	params  []map[string]interface{}
+	updates chan okxOrder
+}
+
+func newOKXServer(t *testing.T) *okxServer {
+	s := &okxServer{
+		lastID:  1000,
+		orders:  make(map[string]okxOrder),
+		algos:   make(map[string]okxAlgoOrder),
+		updates: make(chan okxOrder),
+	}
+
+	reply := func(w http.ResponseWriter, data interface{}) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": "0", "msg": "", "data": data})
+	}
+	decode := func(r *http.Request) map[string]interface{} {
+		var params map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		s.mtx.Lock()
+		s.params = append(s.params, params)
+		s.mtx.Unlock()
+		return params
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v5/public/time", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, []map[string]string{{"ts": "1640995200000"}})
+	})
+	mux.HandleFunc("/api/v5/public/instruments", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("instType") == "SWAP" {
+			reply(w, []map[string]string{{"instId": "BTC-USDT-SWAP", "uly": "BTC-USDT", "ctVal": "0.01",
+				"lotSz": "1", "minSz": "1", "maxLmtSz": "100000", "tickSz": "0.1"}})
+			return
+		}
+		reply(w, []map[string]string{{"instId": "BTC-USDT", "baseCcy": "BTC", "quoteCcy": "USDT",
+			"lotSz": "0.00001", "minSz": "0.00001", "maxLmtSz": "100", "tickSz": "0.1"}})
+	})
+	mux.HandleFunc("/api/v5/account/set-leverage", func(w http.ResponseWriter, r *http.Request) {
+		decode(r)
+		reply(w, []map[string]string{})
+	})
+	candles := func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "1H", r.URL.Query().Get("bar"))
+		// newest first, the current candle is not confirmed
+		reply(w, [][]string{
+			{"1641002400000", "102", "104", "101", "103", "12", "0.12", "12", "0"},
+			{"1640998800000", "101", "103", "100", "102", "11", "0.11", "11", "1"},
+			{"1640995200000", "100", "102", "99", "101", "10", "0.10", "10", "1"},
+		})
+	}
+	mux.HandleFunc("/api/v5/market/candles", candles)
+	mux.HandleFunc("/api/v5/market/history-candles", candles)
+	mux.HandleFunc("/api/v5/trade/order", func(w http.ResponseWriter, r *http.Request) {
+		require.NotEmpty(t, r.Header.Get("OK-ACCESS-SIGN"))
+		s.mtx.Lock()
+		defer func() { s.mtx.Unlock() }()
+
+		if r.Method == http.MethodGet {
+			order, ok := s.orders[r.URL.Query().Get("ordId")]
+			for _, placed := range s.orders {
+				if clientID := r.URL.Query().Get("clOrdId"); clientID != "" && placed.ClOrdID == clientID {
+					order, ok = placed, true
+				}
+			}
+			if !ok {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": "51603", "msg": "order does not exist"})
+				return
+			}
+			reply(w, []okxOrder{order})
+			return
+		}
+
+		s.mtx.Unlock()
+		params := decode(r)
+		s.mtx.Lock()
+		s.lastID++
+		order := okxOrder{
+			InstID: params["instId"].(string), OrdID: strconv.FormatInt(s.lastID, 10),
+			Side: params["side"].(string), OrdType: params["ordType"].(string), State: "live",
+			Sz: params["sz"].(string), CTime: "1640995200000", UTime: "1640995200000",
+		}
+		if price, ok := params["px"]; ok {
+			order.Px = price.(string)
+		}
+		if clientID, ok := params["clOrdId"]; ok {
+			order.ClOrdID = clientID.(string)
+		}
+		if order.OrdType == "market" {
+			order.State, order.AvgPx, order.AccFillSz = "filled", "101.5", order.Sz
+		}
+		s.orders[order.OrdID] = order
+		reply(w, []map[string]string{{"ordId": order.OrdID, "sCode": "0"}})
+	})
+	mux.HandleFunc("/api/v5/trade/order-algo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			order, ok := s.algos[r.URL.Query().Get("algoId")]
+			for _, placed := range s.algos {
+				if clientID := r.URL.Query().Get("algoClOrdId"); clientID != "" && placed.AlgoClOrdID == clientID {
+					order, ok = placed, true
+				}
+			}
+			if !ok {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": "51603", "msg": "order does not exist"})
+				return
+			}
+			reply(w, []okxAlgoOrder{order})
+			return
+		}
+
+		params := decode(r)
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		s.lastID++
+		order := okxAlgoOrder{
+			InstID: params["instId"].(string), AlgoID: strconv.FormatInt(s.lastID, 10),
+			Side: params["side"].(string), State: "live", CTime: "1640995200000",
+		}
+		if size, ok := params["sz"]; ok {
+			order.Sz = size.(string)
+		}
+		if clientID, ok := params["algoClOrdId"]; ok {
+			order.AlgoClOrdID = clientID.(string)
+		}
+		if trigger, ok := params["slTriggerPx"]; ok {
+			order.SlTriggerPx, order.SlOrdPx = trigger.(string), params["slOrdPx"].(string)
+		}
+		if trigger, ok := params["tpTriggerPx"]; ok {
+			order.TpTriggerPx, order.TpOrdPx = trigger.(string), params["tpOrdPx"].(string)
+		}
+		s.algos[order.AlgoID] = order
+		reply(w, []map[string]string{{"algoId": order.AlgoID, "sCode": "0"}})
+	})
+	mux.HandleFunc("/api/v5/trade/cancel-order", func(w http.ResponseWriter, r *http.Request) {
+		params := decode(r)
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		order := s.orders[params["ordId"].(string)]
+		order.State = "canceled"
+		s.orders[order.OrdID] = order
+		reply(w, []map[string]string{{"ordId": order.OrdID, "sCode": "0"}})
+	})
+	mux.HandleFunc("/api/v5/trade/cancel-algos", func(w http.ResponseWriter, r *http.Request) {
+		var params []map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&params))
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		order := s.algos[params[0]["algoId"]]
+		order.State = "canceled"
+		s.algos[order.AlgoID] = order
+		reply(w, []map[string]string{{"algoId": order.AlgoID, "sCode": "0"}})
+	})
+	mux.HandleFunc("/api/v5/trade/orders-pending", func(w http.ResponseWriter, r *http.Request) {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		orders := make([]okxOrder, 0)
+		for _, order := range s.orders {
+			if order.State == "live" {
+				orders = append(orders, order)
+			}
+		}
+		reply(w, orders)
+	})
+	mux.HandleFunc("/api/v5/trade/orders-algo-pending", func(w http.ResponseWriter, r *http.Request) {
+		s.mtx.Lock()
+		defer s.mtx.Unlock()
+		orders := make([]okxAlgoOrder, 0)
+		for _, order := range s.algos {
+			if order.State == "live" {
+				orders = append(orders, order)
+			}
+		}
+		reply(w, orders)
+	})
+	mux.HandleFunc("/api/v5/account/positions", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, []map[string]string{
+			{"instId": "BTC-USDT-SWAP", "pos": "-50", "posSide": "net", "lever": "3"},
+		})
+	})
+	mux.HandleFunc("/api/v5/account/balance", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, []map[string]interface{}{{
+			"availEq": "950",
+			"details": []map[string]string{
+				{"ccy": "USDT", "availBal": "950", "frozenBal": "50"},
+				{"ccy": "BTC", "availBal": "0.2", "frozenBal": "0"},
+			},
+		}})
+	})
+
+	upgrader := websocket.Upgrader{}
+	mux.HandleFunc("/ws/v5/business", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var subscribe struct {
+			Op   string              `json:"op"`
+			Args []map[string]string `json:"args"`
+		}
+		require.NoError(t, conn.ReadJSON(&subscribe))
+		require.Equal(t, "candle1H", subscribe.Args[0]["channel"])
+		require.Equal(t, "BTC-USDT", subscribe.Args[0]["instId"])
+
+		_ = conn.WriteJSON(map[string]interface{}{"event": "subscribe", "arg": subscribe.Args[0]})
+		for _, confirm := range []string{"0", "1"} {
+			_ = conn.WriteJSON(map[string]interface{}{
+				"arg":  subscribe.Args[0],
+				"data": [][]string{{"1640995200000", "100", "102", "99", "101", "10", "0.1", "10", confirm}},
+			})
+		}
+		_, _, _ = conn.ReadMessage()
+	})
+	mux.HandleFunc("/ws/v5/private", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		var login struct {
+			Op   string              `json:"op"`
+			Args []map[string]string `json:"args"`
+		}
+		require.NoError(t, conn.ReadJSON(&login))
+		require.Equal(t, "login", login.Op)
+		require.Equal(t, "pass", login.Args[0]["passphrase"])
+		_ = conn.WriteJSON(map[string]string{"event": "login", "code": "0"})
+
+		var subscribe struct {
+			Op   string              `json:"op"`
+			Args []map[string]string `json:"args"`
+		}
+		require.NoError(t, conn.ReadJSON(&subscribe))
+		require.Equal(t, "subscribe", subscribe.Op)
+
+		for order := range s.updates {
+			_ = conn.WriteJSON(map[string]interface{}{
+				"arg":  map[string]string{"channel": "orders", "instType": "SPOT"},
+				"data": []okxOrder{order},
+			})
+		}
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		close(s.updates)
+		s.Server.Close()
+	})
+	return s
+}
+
+func newTestOKX(t *testing.T, options ...OKXOption) (*OKX, *okxServer) {
+	server := newOKXServer(t)
+	stream := "ws" + strings.TrimPrefix(server.URL, "http")
+	options = append([]OKXOption{
+		WithOKXCredentials("key", "secret", "pass"),
+		WithOKXEndpoint(server.URL, stream+"/ws/v5/business", stream+"/ws/v5/private"),
+	}, options...)
+
+	okx, err := NewOKX(context.Background(), options...)
+	require.NoError(t, err)
+	return okx, server
+}
+
+func TestOKX(t *testing.T) {
+	t.Run("pair translation", func(t *testing.T) {
+		spot, _ := newTestOKX(t)
+		require.Equal(t, "BTC-USDT", spot.instID("BTCUSDT"))
+		require.Equal(t, "BTCUSDT", spot.pair("BTC-USDT"))
+		require.Equal(t, "ETH-USDT", spot.instID("ETHUSDT"))
+
+		swap, server := newTestOKX(t, WithOKXSwap(), WithOKXLeverage("btcusdt", 3, MarginTypeIsolated))
+		require.Equal(t, "BTC-USDT-SWAP", swap.instID("BTCUSDT"))
+		require.Equal(t, "BTCUSDT", swap.pair("BTC-USDT-SWAP"))
+		require.Equal(t, map[string]interface{}{"instId": "BTC-USDT-SWAP", "lever": "3", "mgnMode": "isolated"},
+			server.params[0])
+	})
+
+	t.Run("assets info in base asset", func(t *testing.T) {
+		swap, _ := newTestOKX(t, WithOKXSwap())
+		info := swap.AssetsInfo("BTCUSDT")
+		require.Equal(t, "BTC", info.BaseAsset)
+		require.Equal(t, "USDT", info.QuoteAsset)
+		require.Equal(t, 0.01, info.MinQuantity)
+		require.Equal(t, 0.01, info.StepSize)
+		require.Equal(t, "50", swap.formatQuantity("BTCUSDT", 0.5))
+		require.Equal(t, "50", swap.formatQuantity("BTCUSDT", 0.509))
+	})
+
+	t.Run("candles", func(t *testing.T) {
+		okx, _ := newTestOKX(t)
+
+		candles, err := okx.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, 101.0, candles[0].Close)
+		require.Equal(t, 102.0, candles[1].Close)
+		require.True(t, candles[1].Complete)
+
+		start := time.Unix(1640995200, 0)
+		candles, err = okx.CandlesByPeriod(context.Background(), "BTCUSDT", "1h", start, start.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+
+		swap, _ := newTestOKX(t, WithOKXSwap())
+		candles, err = swap.CandlesByLimit(context.Background(), "BTCUSDT", "1h", 1)
+		require.NoError(t, err)
+		require.Len(t, candles, 1)
+		require.Equal(t, 0.11, candles[0].Volume)
+	})
+
+	t.Run("candles subscription", func(t *testing.T) {
+		okx, _ := newTestOKX(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		candles, _ := okx.CandlesSubscription(ctx, "BTCUSDT", "1h")
+		require.False(t, (<-candles).Complete)
+
+		candle := <-candles
+		require.True(t, candle.Complete)
+		require.Equal(t, "BTCUSDT", candle.Pair)
+		require.Equal(t, 101.0, candle.Close)
+	})
+
+	t.Run("spot orders", func(t *testing.T) {
+		okx, server := newTestOKX(t)
+
+		market, err := okx.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 0.5, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, market.Status)
+		require.Equal(t, model.OrderTypeMarket, market.Type)
+		require.Equal(t, "BTCUSDT", market.Pair)
+		require.Equal(t, 101.5, market.Price)
+		require.Equal(t, 0.5, market.Quantity)
+		require.Equal(t, "base_ccy", server.params[0]["tgtCcy"])
+		require.Equal(t, "cash", server.params[0]["tdMode"])
+
+		limit, err := okx.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 0.5, 120)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, limit.Status)
+		require.Equal(t, model.OrderTypeLimit, limit.Type)
+		require.Equal(t, 120.0, limit.Price)
+
+		stop, err := okx.CreateOrderStop("BTCUSDT", 0.5, 90)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, model.SideTypeSell, stop.Side)
+		require.Equal(t, 90.0, *stop.Stop)
+
+		orders, err := okx.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+
+		require.NoError(t, okx.CancelOpenOrders("BTCUSDT"))
+		limit, err = okx.Order("BTCUSDT", limit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, limit.Status)
+		stop, err = okx.Order("BTCUSDT", stop.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, stop.Status)
+
+		_, err = okx.CreateOrderStop("BTCUSDT", 0, 90)
+		require.ErrorIs(t, err, ErrInvalidQuantity)
+	})
+
+	t.Run("swap orders", func(t *testing.T) {
+		swap, server := newTestOKX(t, WithOKXSwap())
+
+		market, err := swap.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5, true)
+		require.NoError(t, err)
+		require.Equal(t, "50", server.params[0]["sz"])
+		require.Equal(t, "cross", server.params[0]["tdMode"])
+		require.Equal(t, true, server.params[0]["reduceOnly"])
+		require.Equal(t, 0.5, market.Quantity)
+
+		takeProfit, err := swap.TakeProfit(model.SideTypeSell, "BTCUSDT", 0, 130)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeTakeProfit, takeProfit.Type)
+		require.Equal(t, "1", server.params[1]["closeFraction"])
+
+		_, err = swap.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 100)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+	})
+
+	t.Run("client order ids", func(t *testing.T) {
+		okx, server := newTestOKX(t)
+
+		limit, err := okx.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeLimit, Quantity: 0.5, Price: 120, ClientOrderID: "ninjabot-1"})
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", limit.ClientOrderID)
+		require.Equal(t, 120.0, limit.Price)
+		require.Regexp(t, "^[0-9]+$", server.params[0]["clOrdId"])
+
+		stop, err := okx.CreateOrderRequest(model.OrderRequest{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Type: model.OrderTypeStopLoss, Quantity: 0.5, Stop: 90, ClientOrderID: "ninjabot-2"})
+		require.NoError(t, err)
+		require.Equal(t, model.OrderTypeStopLoss, stop.Type)
+		require.Equal(t, "ninjabot-2", stop.ClientOrderID)
+		require.NotEmpty(t, server.params[1]["algoClOrdId"])
+
+		found, err := okx.OrderByClientID("BTCUSDT", "ninjabot-1")
+		require.NoError(t, err)
+		require.Equal(t, limit.ExchangeID, found.ExchangeID)
+		require.Equal(t, "ninjabot-1", found.ClientOrderID)
+
+		found, err = okx.OrderByClientID("BTCUSDT", "ninjabot-2")
+		require.NoError(t, err)
+		require.Equal(t, stop.ExchangeID, found.ExchangeID)
+
+		_, err = okx.OrderByClientID("BTCUSDT", "ninjabot-3")
+		require.ErrorIs(t, err, ErrOrderNotFound)
+	})
+
+	t.Run("account", func(t *testing.T) {
+		swap, _ := newTestOKX(t, WithOKXSwap())
+		account, err := swap.Account()
+		require.NoError(t, err)
+		require.Equal(t, 950.0, account.Available)
+
+		asset, quote, err := swap.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, -0.5, asset)
+		require.Equal(t, 950.0, quote)
+
+		spot, _ := newTestOKX(t)
+		asset, quote, err = spot.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.2, asset)
+		require.Equal(t, 1000.0, quote)
+	})
+
+	t.Run("account subscription", func(t *testing.T) {
+		okx, server := newTestOKX(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		orders, _ := okx.AccountSubscription(ctx)
+		server.updates <- okxOrder{InstID: "BTC-USDT", OrdID: "42", Side: "buy", OrdType: "limit", State: "filled",
+			Px: "100", Sz: "1", AvgPx: "99.9", AccFillSz: "1"}
+
+		order := <-orders
+		require.Equal(t, int64(42), order.ExchangeID)
+		require.Equal(t, "BTCUSDT", order.Pair)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 99.9, order.Price)
+	})
+}
+
+func TestOKXBar(t *testing.T) {
+	tt := map[string]string{"1m": "1m", "15m": "15m", "1h": "1H", "4h": "4H", "6h": "6Hutc", "1d": "1Dutc",
+		"1w": "1Wutc", "1M": "1Mutc"}
+	for period, expected := range tt {
+		bar, err := okxBar(period)
+		require.NoError(t, err)
+		require.Equal(t, expected, bar)
+	}
+
+	_, err := okxBar("2d")
+	require.Error(t, err)
+}
@@ -6,7 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/adshao/go-binance/v2"
 	"github.com/adshao/go-binance/v2/futures"
@@ -19,27 +21,108 @@ type AssetQuote struct {
 
 var (
 	//go:embed pairs.json
-	pairs             []byte
-	pairAssetQuoteMap = make(map[string]AssetQuote)
+	pairs []byte
+
+	// DefaultQuotes are the quote assets used to split pairs unknown by the registry, by suffix
+	DefaultQuotes = []string{"USDT", "USDC", "FDUSD", "BUSD", "TUSD", "DAI", "USD", "EUR", "GBP", "TRY", "BRL",
+		"BTC", "ETH", "BNB"}
+
+	// Pairs is the registry used by SplitAssetQuote, with the pairs of Binance and the pairs registered by
+	// the exchanges in use, from their exchange info
+	Pairs = NewPairRegistry(DefaultQuotes...)
 )
 
 func init() {
-	err := json.Unmarshal(pairs, &pairAssetQuoteMap)
+	known := make(map[string]AssetQuote)
+	err := json.Unmarshal(pairs, &known)
 	if err != nil {
 		panic(err)
 	}
+
+	for pair, data := range known {
+		Pairs.Register(pair, data.Asset, data.Quote)
+	}
 }
 
-func SplitAssetQuote(pair string) (asset string, quote string) {
-	data, ok := pairAssetQuoteMap[pair]
-	if !ok {
-		if strings.Contains(pair, "USDT") {
-			quoteNow := pair[len(pair)-4:]
-			assetNow := pair[:len(pair)-len(quote)]
-			return assetNow, quoteNow
+// PairRegistry resolves the asset and quote of pairs. Pairs are registered from the exchange info of the
+// exchanges, while unknown pairs are split by a separator, eg: BTC-USDT, or by the longest quote asset of
+// a fallback list that ends the pair.
+type PairRegistry struct {
+	mtx      sync.RWMutex
+	pairs    map[string]AssetQuote
+	fallback []string
+}
+
+// NewPairRegistry creates an empty registry, with a fallback list of quote assets
+func NewPairRegistry(fallback ...string) *PairRegistry {
+	registry := &PairRegistry{pairs: make(map[string]AssetQuote)}
+	registry.SetFallback(fallback...)
+	return registry
+}
+
+// Register adds a pair to the registry, pairs already known are kept
+func (r *PairRegistry) Register(pair, asset, quote string) {
+	if pair == "" || asset == "" || quote == "" {
+		return
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.pairs[pair]; !ok {
+		r.pairs[pair] = AssetQuote{Asset: asset, Quote: quote}
+	}
+}
+
+// SetFallback replaces the quote assets used to split unknown pairs
+func (r *PairRegistry) SetFallback(quotes ...string) {
+	fallback := make([]string, len(quotes))
+	copy(fallback, quotes)
+
+	// longer quotes first, eg: USDT before USD
+	sort.SliceStable(fallback, func(i, j int) bool {
+		return len(fallback[i]) > len(fallback[j])
+	})
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.fallback = fallback
+}
+
+// Split returns the asset and quote of a pair, false when the pair is unknown and cannot be split
+func (r *PairRegistry) Split(pair string) (asset, quote string, ok bool) {
+	r.mtx.RLock()
+	data, known := r.pairs[pair]
+	fallback := r.fallback
+	r.mtx.RUnlock()
+
+	if known {
+		return data.Asset, data.Quote, true
+	}
+
+	if index := strings.IndexAny(pair, "-/_:"); index > 0 && index < len(pair)-1 {
+		return pair[:index], pair[index+1:], true
+	}
+
+	for _, quote := range fallback {
+		if len(pair) > len(quote) && strings.HasSuffix(pair, quote) {
+			return pair[:len(pair)-len(quote)], quote, true
 		}
 	}
-	return data.Asset, data.Quote
+	return "", "", false
+}
+
+// RegisterPair adds a pair to the pairs known by SplitAssetQuote, eg: pairs of exchanges other than Binance.
+// Pairs already known are kept.
+func RegisterPair(pair, asset, quote string) {
+	Pairs.Register(pair, asset, quote)
+}
+
+// SplitAssetQuote returns the asset and quote of a pair, from the registered pairs or the fallback quotes of
+// the registry. Unknown pairs return empty values.
+func SplitAssetQuote(pair string) (asset string, quote string) {
+	asset, quote, _ = Pairs.Split(pair)
+	return asset, quote
 }
 
 func updateParisFile() error {
@@ -55,23 +138,24 @@ func updateParisFile() error {
 		return fmt.Errorf("failed to get exchange info: %v", err)
 	}
 
+	known := make(map[string]AssetQuote)
 	for _, info := range sportInfo.Symbols {
-		pairAssetQuoteMap[info.Symbol] = AssetQuote{
+		known[info.Symbol] = AssetQuote{
 			Quote: info.QuoteAsset,
 			Asset: info.BaseAsset,
 		}
 	}
 
 	for _, info := range futureInfo.Symbols {
-		pairAssetQuoteMap[info.Symbol] = AssetQuote{
+		known[info.Symbol] = AssetQuote{
 			Quote: info.QuoteAsset,
 			Asset: info.BaseAsset,
 		}
 	}
 
-	fmt.Printf("Total pairs: %d\n", len(pairAssetQuoteMap))
+	fmt.Printf("Total pairs: %d\n", len(known))
 
-	content, err := json.Marshal(pairAssetQuoteMap)
+	content, err := json.Marshal(known)
 	if err != nil {
 		return fmt.Errorf("failed to marshal pairs: %v", err)
 	}
@@ -27,6 +27,57 @@ func TestSplitAssetQuote(t *testing.T) {
 	}
 }
 
+func TestRegisterPair(t *testing.T) {
+	RegisterPair("XBTTESTUSD", "XBTTEST", "USD")
+	asset, quote := SplitAssetQuote("XBTTESTUSD")
+	require.Equal(t, "XBTTEST", asset)
+	require.Equal(t, "USD", quote)
+
+	// known pairs are kept
+	RegisterPair("ETHBTC", "ET", "HBTC")
+	asset, quote = SplitAssetQuote("ETHBTC")
+	require.Equal(t, "ETH", asset)
+	require.Equal(t, "BTC", quote)
+}
+
+func TestPairRegistry(t *testing.T) {
+	registry := NewPairRegistry("USD", "USDT", "EUR")
+	registry.Register("XYZABC", "XY", "ZABC")
+
+	tt := []struct {
+		Pair  string
+		Asset string
+		Quote string
+		Ok    bool
+	}{
+		{"XYZABC", "XY", "ZABC", true},
+		{"BTCUSDT", "BTC", "USDT", true},
+		{"SOLUSD", "SOL", "USD", true},
+		{"ETH-BRL", "ETH", "BRL", true},
+		{"ETH/EUR", "ETH", "EUR", true},
+		{"ETHBRL", "", "", false},
+		{"USD", "", "", false},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.Pair, func(t *testing.T) {
+			asset, quote, ok := registry.Split(tc.Pair)
+			require.Equal(t, tc.Ok, ok)
+			require.Equal(t, tc.Asset, asset)
+			require.Equal(t, tc.Quote, quote)
+		})
+	}
+
+	registry.SetFallback("BRL")
+	asset, quote, ok := registry.Split("ETHBRL")
+	require.True(t, ok)
+	require.Equal(t, "ETH", asset)
+	require.Equal(t, "BRL", quote)
+
+	_, _, ok = registry.Split("SOLUSD")
+	require.False(t, ok)
+}
+
 func TestUpdatePairFile(t *testing.T) {
 	t.Skip() // it is not a test, just utility function to update pairs list
 	err := updateParisFile()
@@ -2,7 +2,6 @@ package exchange
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"math"
 	"strings"
@@ -44,6 +43,38 @@ type PaperWallet struct {
 	fistCandle    map[string]model.Candle
 	assetValues   map[string][]AssetValue
 	equityValues  []AssetValue
+	// icebergs are the visible quantities of iceberg orders, and participation the share of the candle
+	// volume filled by limit orders, see WithPaperParticipation
+	icebergs      map[int64]float64
+	participation float64
+	// trailing are the trailing stop orders, see CreateOrderTrailingStop
+	trailing map[int64]*trailingStop
+	// candlePath decides the executed leg of OCO orders, see WithPaperCandlePath
+	candlePath CandlePath
+	// latency delays the orders until their acknowledgment time, see WithPaperLatency
+	latency      time.Duration
+	acknowledged map[int64]time.Time
+	// leverage of pairs traded with isolated margin, with the margin of their positions and open orders
+	leverage          map[string]float64
+	margins           map[string]float64
+	reserves          map[int64]*marginReserve
+	maintenanceMargin float64
+	// subscribers receive the order fills and liquidations, see AccountSubscription
+	subscribers []chan model.Order
+	// fundingRates are the pending funding rates of perpetual pairs, and funding the net funding by pair
+	fundingRates map[string][]model.FundingRate
+	funding      map[string]float64
+	// slippage models of market and stop orders by pair, see WithPaperSlippage
+	slippage        map[string]SlippageModel
+	defaultSlippage SlippageModel
+	// fees paid by pair, in the quote asset, and the asset used to pay them, see WithPaperFeeAsset
+	fees     map[string]float64
+	feeAsset string
+	// snapshots of the account by candle time and orders rejected by insufficient funds, see Portfolio
+	snapshots []portfolioSnapshot
+	rejected  map[string]int
+	// config is the initial settings of the wallet, see Config
+	config PaperWalletConfig
 }
 
 func (p *PaperWallet) AssetsInfo(pair string) model.AssetInfo {
@@ -71,6 +102,8 @@ func WithPaperAsset(pair string, amount float64) PaperWalletOption {
 	}
 }
 
+// WithPaperFee sets the fee rates of orders, eg: 0.001 = 0.1%. Limit orders filled from the book pay the
+// maker rate, while market, stop and take profit orders pay the taker rate.
 func WithPaperFee(maker, taker float64) PaperWalletOption {
 	return func(wallet *PaperWallet) {
 		wallet.makerFee = maker
@@ -86,17 +119,29 @@ func WithDataFeed(feeder service.Feeder) PaperWalletOption {
 
 func NewPaperWallet(ctx context.Context, baseCoin string, options ...PaperWalletOption) *PaperWallet {
 	wallet := PaperWallet{
-		ctx:           ctx,
-		baseCoin:      baseCoin,
-		orders:        make([]model.Order, 0),
-		assets:        make(map[string]*assetInfo),
-		fistCandle:    make(map[string]model.Candle),
-		lastCandle:    make(map[string]model.Candle),
-		avgShortPrice: make(map[string]float64),
-		avgLongPrice:  make(map[string]float64),
-		volume:        make(map[string]float64),
-		assetValues:   make(map[string][]AssetValue),
-		equityValues:  make([]AssetValue, 0),
+		ctx:               ctx,
+		baseCoin:          baseCoin,
+		orders:            make([]model.Order, 0),
+		assets:            make(map[string]*assetInfo),
+		fistCandle:        make(map[string]model.Candle),
+		lastCandle:        make(map[string]model.Candle),
+		avgShortPrice:     make(map[string]float64),
+		avgLongPrice:      make(map[string]float64),
+		volume:            make(map[string]float64),
+		assetValues:       make(map[string][]AssetValue),
+		equityValues:      make([]AssetValue, 0),
+		icebergs:          make(map[int64]float64),
+		trailing:          make(map[int64]*trailingStop),
+		acknowledged:      make(map[int64]time.Time),
+		leverage:          make(map[string]float64),
+		margins:           make(map[string]float64),
+		reserves:          make(map[int64]*marginReserve),
+		maintenanceMargin: defaultMaintenanceMargin,
+		fundingRates:      make(map[string][]model.FundingRate),
+		funding:           make(map[string]float64),
+		slippage:          make(map[string]SlippageModel),
+		fees:              make(map[string]float64),
+		rejected:          make(map[string]int),
 	}
 
 	for _, option := range options {
@@ -104,6 +149,7 @@ func NewPaperWallet(ctx context.Context, baseCoin string, options ...PaperWallet
 	}
 
 	wallet.initialValue = wallet.assets[wallet.baseCoin].Free
+	wallet.config = wallet.initialConfig()
 	log.Info("[SETUP] Using paper wallet")
 	log.Infof("[SETUP] Initial Portfolio = %f %s", wallet.initialValue, wallet.baseCoin)
 
@@ -190,12 +236,7 @@ func (p *PaperWallet) Summary() {
 		}
 
 		quantity := assetInfo.Free + assetInfo.Lock
-		value := quantity * p.lastCandle[pair].Close
-		if quantity < 0 {
-			totalShort := 2.0*p.avgShortPrice[pair]*quantity - p.lastCandle[pair].Close*quantity
-			value = math.Abs(totalShort)
-		}
-		total += value
+		total += p.positionValue(pair, quantity, p.lastCandle[pair].Close)
 		marketChange += (p.lastCandle[pair].Close - p.fistCandle[pair].Close) / p.fistCandle[pair].Close
 		fmt.Printf("%.4f %s = %.4f %s\n", quantity, asset, total, quote)
 	}
@@ -221,10 +262,54 @@ func (p *PaperWallet) Summary() {
 		fmt.Printf("%s         = %.2f %s\n", pair, vol, p.baseCoin)
 	}
 	fmt.Printf("TOTAL           = %.2f %s\n", volume, p.baseCoin)
+	if len(p.funding) > 0 {
+		fmt.Println()
+		fmt.Println("------ FUNDING ----")
+		for pair, funding := range p.funding {
+			fmt.Printf("%s         = %.2f %s\n", pair, funding, p.baseCoin)
+		}
+	}
+	if len(p.fees) > 0 {
+		var fees float64
+		fmt.Println()
+		fmt.Println("------- FEES ------")
+		for pair, fee := range p.fees {
+			fees += fee
+			fmt.Printf("%s         = %.2f %s\n", pair, fee, p.baseCoin)
+		}
+		fmt.Printf("TOTAL           = %.2f %s\n", fees, p.baseCoin)
+	}
+	if len(p.lastCandle) > 1 {
+		p.summaryPortfolio()
+	}
 	fmt.Println("-------------------")
 }
 
-func (p *PaperWallet) validateFunds(side model.SideType, pair string, amount, value float64, fill bool) error {
+// positionValue returns the value of a position at a price. Short positions are worth their collateral and
+// profit, while the margin of leveraged positions is locked in the quote asset, so they are worth their profit.
+func (p *PaperWallet) positionValue(pair string, quantity, price float64) float64 {
+	if _, ok := p.leveraged(pair); ok {
+		return quantity * (price - p.entryPrice(pair, quantity))
+	}
+
+	if quantity < 0 {
+		v := math.Abs(quantity)
+		return 2*v*p.avgShortPrice[pair] - v*price
+	}
+	return quantity * price
+}
+
+func (p *PaperWallet) validateFunds(side model.SideType, pair string, amount, value float64,
+	fill bool) (err error) {
+
+	defer func() {
+		p.contend(pair, err)
+	}()
+
+	if leverage, ok := p.leveraged(pair); ok {
+		return p.validateMargin(side, pair, amount, value, leverage, fill)
+	}
+
 	asset, quote := SplitAssetQuote(pair)
 	if _, ok := p.assets[asset]; !ok {
 		p.assets[asset] = &assetInfo{}
@@ -373,13 +458,15 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 	p.Lock()
 	defer p.Unlock()
 
+	p.settleFunding(candle)
 	p.lastCandle[candle.Pair] = candle
 	if _, ok := p.fistCandle[candle.Pair]; !ok {
 		p.fistCandle[candle.Pair] = candle
 	}
 
 	for i, order := range p.orders {
-		if order.Pair != candle.Pair || order.Status != model.OrderStatusTypeNew {
+		if order.Pair != candle.Pair ||
+			(order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled) {
 			continue
 		}
 
@@ -387,79 +474,66 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 			p.volume[candle.Pair] = 0
 		}
 
-		asset, quote := SplitAssetQuote(order.Pair)
-		if order.Side == model.SideTypeBuy && order.Price >= candle.Close {
-			if _, ok := p.assets[asset]; !ok {
-				p.assets[asset] = &assetInfo{}
-			}
-
-			p.volume[candle.Pair] += order.Price * order.Quantity
-			p.orders[i].UpdatedAt = candle.Time
-			p.orders[i].Status = model.OrderStatusTypeFilled
-
-			// update assets size
-			p.updateAveragePrice(order.Side, order.Pair, order.Quantity, order.Price)
-			p.assets[asset].Free = p.assets[asset].Free + order.Quantity
-			p.assets[quote].Lock = p.assets[quote].Lock - order.Price*order.Quantity
-		}
-
-		if order.Side == model.SideTypeSell {
-			var orderPrice float64
-			if (order.Type == model.OrderTypeLimit ||
-				order.Type == model.OrderTypeLimitMaker ||
-				order.Type == model.OrderTypeTakeProfit ||
-				order.Type == model.OrderTypeTakeProfitLimit) &&
-				candle.High >= order.Price {
-				orderPrice = order.Price
-			} else if (order.Type == model.OrderTypeStopLossLimit ||
-				order.Type == model.OrderTypeStopLoss) &&
-				candle.Low <= *order.Stop {
-				orderPrice = *order.Stop
-			} else {
-				continue
-			}
-
-			// Cancel other orders from same group
-			if order.GroupID != nil {
-				for j, groupOrder := range p.orders {
-					if groupOrder.GroupID != nil && *groupOrder.GroupID == *order.GroupID &&
-						groupOrder.ExchangeID != order.ExchangeID {
-						p.orders[j].Status = model.OrderStatusTypeCanceled
-						p.orders[j].UpdatedAt = candle.Time
-						break
-					}
-				}
-			}
+		if p.pending(order, candle) {
+			continue
+		}
 
-			if _, ok := p.assets[quote]; !ok {
-				p.assets[quote] = &assetInfo{}
-			}
+		orderPrice, ok := p.triggerPrice(order, candle)
+		if !ok || !p.reachedFirst(order, orderPrice, candle) {
+			continue
+		}
+		p.cancelGroup(order, candle)
 
-			orderVolume := order.Quantity * orderPrice
+		asset, quote := SplitAssetQuote(order.Pair)
+		if _, ok := p.assets[asset]; !ok {
+			p.assets[asset] = &assetInfo{}
+		}
+		if _, ok := p.assets[quote]; !ok {
+			p.assets[quote] = &assetInfo{}
+		}
 
-			p.volume[candle.Pair] += orderVolume
-			p.orders[i].UpdatedAt = candle.Time
-			p.orders[i].Status = model.OrderStatusTypeFilled
+		quantity, status := p.fill(order, candle)
+		if status == model.OrderStatusTypeFilled {
+			delete(p.acknowledged, order.ExchangeID)
+		}
+		if stopOrder(order) || order.Type == model.OrderTypeMarket {
+			orderPrice = p.executionPrice(order.Side, order.Pair, orderPrice, quantity)
+		}
+		p.volume[candle.Pair] += orderPrice * quantity
+		p.orders[i].UpdatedAt = candle.Time
+		p.orders[i].Status = status
+		p.orders[i].Executed += quantity
+		p.orders[i].Fee += p.chargeFee(order.Pair, quantity, orderPrice, makerOrder(order))
+		p.publish(p.orders[i])
+
+		if _, ok := p.leveraged(order.Pair); ok {
+			p.releaseMargin(order, quantity)
+			p.fillMargin(order.Side, order.Pair, quantity, orderPrice)
+			continue
+		}
 
-			// update assets size
-			p.updateAveragePrice(order.Side, order.Pair, order.Quantity, orderPrice)
-			p.assets[asset].Lock = p.assets[asset].Lock - order.Quantity
-			p.assets[quote].Free = p.assets[quote].Free + order.Quantity*orderPrice
+		// update assets size
+		p.updateAveragePrice(order.Side, order.Pair, quantity, orderPrice)
+		if order.Side == model.SideTypeBuy {
+			// funds are locked at the order price, the difference of the execution price is returned
+			p.assets[asset].Free = p.assets[asset].Free + quantity
+			p.assets[quote].Lock = p.assets[quote].Lock - order.Price*quantity
+			p.assets[quote].Free = p.assets[quote].Free + (order.Price-orderPrice)*quantity
+		} else {
+			p.assets[asset].Lock = p.assets[asset].Lock - quantity
+			p.assets[quote].Free = p.assets[quote].Free + quantity*orderPrice
 		}
 	}
 
+	p.stepTrailingStops(candle)
+	p.liquidate(candle)
+
 	if candle.Complete {
 		var total float64
 		for asset, info := range p.assets {
 			amount := info.Free + info.Lock
 			pair := strings.ToUpper(asset + p.baseCoin)
-			if amount < 0 {
-				v := math.Abs(amount)
-				liquid := 2*v*p.avgShortPrice[pair] - v*p.lastCandle[pair].Close
-				total += liquid
-			} else {
-				total += amount * p.lastCandle[pair].Close
-			}
+			total += p.positionValue(pair, amount, p.lastCandle[pair].Close)
 
 			p.assetValues[asset] = append(p.assetValues[asset], AssetValue{
 				Time:  candle.Time,
@@ -472,16 +546,88 @@ func (p *PaperWallet) OnCandle(candle model.Candle) {
 			Time:  candle.Time,
 			Value: total + baseCoinInfo.Lock + baseCoinInfo.Free,
 		})
+		p.recordPortfolio(candle.Time, total+baseCoinInfo.Lock+baseCoinInfo.Free)
+	}
+}
+
+// stopOrder returns true for the orders triggered by a stop price, which are filled with slippage
+func stopOrder(order model.Order) bool {
+	return order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit ||
+		order.Type == model.OrderTypeTrailingStop
+}
+
+// triggerPrice returns the price of an open order reached by a candle, before slippage: the stop of stop
+// orders and the limit of other orders
+func (p *PaperWallet) triggerPrice(order model.Order, candle model.Candle) (float64, bool) {
+	switch {
+	case order.Type == model.OrderTypeMarket:
+		return p.marketPrice(order, candle), true
+	case order.Type == model.OrderTypeTrailingStop:
+		if !p.trailingTriggered(order, candle) {
+			return 0, false
+		}
+		return *order.Stop, true
+	case stopOrder(order):
+		if order.Stop == nil {
+			return 0, false
+		}
+		// candles without high and low are reached at the close
+		high, low := candle.High, candle.Low
+		if high == 0 {
+			high = candle.Close
+		}
+		if low == 0 {
+			low = candle.Close
+		}
+		if (order.Side == model.SideTypeSell && low <= *order.Stop) ||
+			(order.Side == model.SideTypeBuy && high >= *order.Stop) {
+			return *order.Stop, true
+		}
+	case order.Side == model.SideTypeBuy:
+		if order.Price >= candle.Close {
+			return order.Price, true
+		}
+	case candle.High >= order.Price:
+		return order.Price, true
+	}
+	return 0, false
+}
+
+// fill executes an order, returning the filled quantity and the new order status. Iceberg orders are
+// filled by their visible quantity on each candle, and limit orders by their share of the candle volume,
+// as repeated partial fills.
+func (p *PaperWallet) fill(order model.Order, candle model.Candle) (float64, model.OrderStatusType) {
+	remaining := order.Quantity - order.Executed
+	quantity := remaining
+	if visible, ok := p.icebergs[order.ExchangeID]; ok {
+		quantity = math.Min(quantity, visible)
+	}
+	if p.participation > 0 && candle.Volume > 0 && makerOrder(order) {
+		quantity = math.Min(quantity, p.participation*candle.Volume)
+	}
+
+	if quantity < remaining {
+		return quantity, model.OrderStatusTypePartiallyFilled
 	}
+
+	delete(p.icebergs, order.ExchangeID)
+	return remaining, model.OrderStatusTypeFilled
 }
 
 func (p *PaperWallet) Account() (model.Account, error) {
+	leverage := make(map[string]float64)
+	for pair, value := range p.leverage {
+		asset, _ := SplitAssetQuote(pair)
+		leverage[asset] = value
+	}
+
 	balances := make([]model.Balance, 0)
-	for pair, info := range p.assets {
+	for asset, info := range p.assets {
 		balances = append(balances, model.Balance{
-			Asset: pair,
-			Free:  info.Free,
-			Lock:  info.Lock,
+			Asset:    asset,
+			Free:     info.Free,
+			Lock:     info.Lock,
+			Leverage: leverage[asset],
 		})
 	}
 
@@ -505,6 +651,38 @@ func (p *PaperWallet) Position(pair string) (asset, quote float64, err error) {
 	return assetBalance.Free + assetBalance.Lock, quoteBalance.Free + quoteBalance.Lock, nil
 }
 
+// PositionRisk returns the position with its average entry price, valued at the last candle close
+func (p *PaperWallet) PositionRisk(pair string) (model.PositionRisk, error) {
+	asset, _, err := p.Position(pair)
+	if err != nil {
+		return model.PositionRisk{}, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	risk := model.PositionRisk{Pair: pair, Size: asset, MarkPrice: p.lastCandle[pair].Close, Leverage: 1}
+	if asset > 0 {
+		risk.EntryPrice = p.avgLongPrice[pair]
+	} else if asset < 0 {
+		risk.EntryPrice = p.avgShortPrice[pair]
+	}
+	if risk.EntryPrice > 0 && risk.MarkPrice > 0 {
+		risk.UnrealizedPnL = (risk.MarkPrice - risk.EntryPrice) * asset
+	}
+	if leverage, ok := p.leveraged(pair); ok {
+		risk.Leverage = leverage
+		risk.Margin = p.margins[pair]
+		risk.LiquidationPrice = p.liquidationPrice(pair, asset)
+	}
+	return risk, nil
+}
+
+// ModifyOrder cancels and replaces an open order of the simulation
+func (p *PaperWallet) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return modifyOrder(p, order, price, quantity)
+}
+
 func (p *PaperWallet) CreateOrderOCO(side model.SideType, pair string,
 	size, price, stop, stopLimit float64) ([]model.Order, error) {
 	p.Lock()
@@ -549,6 +727,9 @@ func (p *PaperWallet) CreateOrderOCO(side model.SideType, pair string,
 		RefPrice:   p.lastCandle[pair].Close,
 	}
 	p.orders = append(p.orders, limitMaker, stopOrder)
+	p.delay(limitMaker)
+	p.delay(stopOrder)
+	p.reserveMargin(groupID, side, pair, size, price)
 
 	return []model.Order{limitMaker, stopOrder}, nil
 }
@@ -579,6 +760,83 @@ func (p *PaperWallet) CreateOrderLimit(side model.SideType, pair string,
 		Quantity:   size,
 	}
 	p.orders = append(p.orders, order)
+	p.reserveMargin(order.ExchangeID, side, pair, size, limit)
+	p.delay(order)
+	return order, nil
+}
+
+// CreateOrderLimitTIF simulates a limit order with a time in force, based on the last close price:
+// IOC and FOK orders are filled when the limit crosses the price, and expired otherwise, while post only
+// orders that would cross the price are rejected with ErrPostOnlyRejected.
+func (p *PaperWallet) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForceType) (model.Order, error) {
+	if timeInForce == model.TimeInForceGTC || timeInForce == "" {
+		return p.CreateOrderLimit(side, pair, size, limit)
+	}
+
+	p.Lock()
+	price := p.lastCandle[pair].Close
+	crosses := (side == model.SideTypeBuy && limit >= price) || (side == model.SideTypeSell && limit <= price)
+	p.Unlock()
+
+	switch timeInForce {
+	case model.TimeInForceGTX:
+		if crosses {
+			return model.Order{}, &OrderError{Err: ErrPostOnlyRejected, Pair: pair, Quantity: size}
+		}
+		return p.CreateOrderLimit(side, pair, size, limit)
+	case model.TimeInForceIOC, model.TimeInForceFOK:
+		p.Lock()
+		defer p.Unlock()
+
+		if !crosses {
+			order := model.Order{
+				ExchangeID: p.ID(),
+				CreatedAt:  p.lastCandle[pair].Time,
+				UpdatedAt:  p.lastCandle[pair].Time,
+				Pair:       pair,
+				Side:       side,
+				Type:       model.OrderTypeLimit,
+				Status:     model.OrderStatusTypeExpired,
+				Price:      limit,
+				Quantity:   size,
+			}
+			p.orders = append(p.orders, order)
+			return order, nil
+		}
+
+		order, err := p.createOrderMarket(side, pair, size)
+		if err != nil {
+			return model.Order{}, err
+		}
+		order.Type = model.OrderTypeLimit
+		p.orders[len(p.orders)-1] = order
+		return order, nil
+	default:
+		return model.Order{}, fmt.Errorf("%w: time in force %s", ErrUnsupportedOrder, timeInForce)
+	}
+}
+
+// CreateOrderLimitOptions simulates a limit order with a time in force and an iceberg quantity,
+// iceberg orders are filled by their visible quantity on each candle that reaches the limit price
+func (p *PaperWallet) CreateOrderLimitOptions(side model.SideType, pair string, size, limit float64,
+	options model.OrderOptions) (model.Order, error) {
+	if options.IcebergQuantity > 0 {
+		if err := validateIceberg(pair, size, options); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	order, err := p.CreateOrderLimitTIF(side, pair, size, limit, options.TimeInForce)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	if options.IcebergQuantity > 0 && order.Status == model.OrderStatusTypeNew {
+		p.Lock()
+		p.icebergs[order.ExchangeID] = options.IcebergQuantity
+		p.Unlock()
+	}
 	return order, nil
 }
 
@@ -586,6 +844,9 @@ func (p *PaperWallet) CreateOrderMarket(side model.SideType, pair string, size f
 	p.Lock()
 	defer p.Unlock()
 
+	if p.latency > 0 {
+		return p.submitOrderMarket(side, pair, size)
+	}
 	return p.createOrderMarket(side, pair, size)
 }
 
@@ -619,6 +880,8 @@ func (p *PaperWallet) CreateOrderStop(pair string, size float64, limit float64)
 		Quantity:   size,
 	}
 	p.orders = append(p.orders, order)
+	p.reserveMargin(order.ExchangeID, model.SideTypeSell, pair, size, limit)
+	p.delay(order)
 	return order, nil
 }
 func (p *PaperWallet) TakeProfit(side model.SideType, pair string, quantity float64, limit float64) (model.Order, error) {
@@ -629,7 +892,13 @@ func (p *PaperWallet) TakeProfit(side model.SideType, pair string, quantity floa
 		return model.Order{}, ErrInvalidQuantity
 	}
 
-	err := p.validateFunds(model.SideTypeSell, pair, quantity, limit, false)
+	// leveraged pairs take profit of long and short positions
+	validateSide := model.SideTypeSell
+	if _, ok := p.leveraged(pair); ok {
+		validateSide = side
+	}
+
+	err := p.validateFunds(validateSide, pair, quantity, limit, false)
 	if err != nil {
 		return model.Order{}, err
 	}
@@ -647,6 +916,8 @@ func (p *PaperWallet) TakeProfit(side model.SideType, pair string, quantity floa
 		Quantity:   quantity,
 	}
 	p.orders = append(p.orders, order)
+	p.reserveMargin(order.ExchangeID, side, pair, quantity, limit)
+	p.delay(order)
 	return order, nil
 }
 
@@ -655,7 +926,8 @@ func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size f
 		return model.Order{}, ErrInvalidQuantity
 	}
 
-	err := p.validateFunds(side, pair, size, p.lastCandle[pair].Close, true)
+	price := p.executionPrice(side, pair, p.lastCandle[pair].Close, size)
+	err := p.validateFunds(side, pair, size, price, true)
 	if err != nil {
 		return model.Order{}, err
 	}
@@ -664,7 +936,8 @@ func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size f
 		p.volume[pair] = 0
 	}
 
-	p.volume[pair] += p.lastCandle[pair].Close * size
+	p.volume[pair] += price * size
+	fee := p.chargeFee(pair, size, price, false)
 
 	order := model.Order{
 		ExchangeID: p.ID(),
@@ -674,8 +947,10 @@ func (p *PaperWallet) createOrderMarket(side model.SideType, pair string, size f
 		Side:       side,
 		Type:       model.OrderTypeMarket,
 		Status:     model.OrderStatusTypeFilled,
-		Price:      p.lastCandle[pair].Close,
+		Price:      price,
 		Quantity:   size,
+		Executed:   size,
+		Fee:        fee,
 	}
 
 	p.orders = append(p.orders, order)
@@ -690,6 +965,9 @@ func (p *PaperWallet) CreateOrderMarketQuote(side model.SideType, pair string,
 
 	info := p.AssetsInfo(pair)
 	quantity := common.AmountToLotSize(info.StepSize, info.BaseAssetPrecision, quoteQuantity/p.lastCandle[pair].Close)
+	if p.latency > 0 {
+		return p.submitOrderMarket(side, pair, quantity)
+	}
 	return p.createOrderMarket(side, pair, quantity)
 }
 
@@ -700,15 +978,29 @@ func (p *PaperWallet) Cancel(order model.Order) error {
 	for i, o := range p.orders {
 		if o.ExchangeID == order.ExchangeID {
 			p.orders[i].Status = model.OrderStatusTypeCanceled
+			p.releaseMargin(o, 0)
 		}
 	}
+	delete(p.icebergs, order.ExchangeID)
+	delete(p.trailing, order.ExchangeID)
+	delete(p.acknowledged, order.ExchangeID)
 	return nil
 }
 func (p *PaperWallet) CancelOpenOrders(pair string) error {
 	return nil
 }
 func (p *PaperWallet) OpenOrders(pair string) ([]model.Order, error) {
-	return nil, nil
+	p.Lock()
+	defer p.Unlock()
+
+	orders := make([]model.Order, 0)
+	for _, order := range p.orders {
+		if order.Pair == pair && (order.Status == model.OrderStatusTypeNew ||
+			order.Status == model.OrderStatusTypePartiallyFilled) {
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
 }
 
 func (p *PaperWallet) Order(_ string, id int64) (model.Order, error) {
@@ -717,7 +1009,60 @@ func (p *PaperWallet) Order(_ string, id int64) (model.Order, error) {
 			return order, nil
 		}
 	}
-	return model.Order{}, errors.New("order not found")
+	return model.Order{}, ErrOrderNotFound
+}
+
+// CreateOrderRequest simulates an order request, keeping its client order ID in the order
+func (p *PaperWallet) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	order, err := placeRequest(p, request)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	for i := range p.orders {
+		if p.orders[i].ExchangeID == order.ExchangeID {
+			p.orders[i].ClientOrderID = request.ClientOrderID
+		}
+	}
+	order.ClientOrderID = request.ClientOrderID
+	return order, nil
+}
+
+// CreateOrderOCORequest simulates an OCO order, keeping the client order IDs of the limit and stop legs
+func (p *PaperWallet) CreateOrderOCORequest(limit, stop model.OrderRequest) ([]model.Order, error) {
+	orders, err := placeOCORequest(p, limit, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	clientOrderIDs := map[int64]string{orders[0].ExchangeID: limit.ClientOrderID,
+		orders[1].ExchangeID: stop.ClientOrderID}
+	for i := range p.orders {
+		if clientOrderID, ok := clientOrderIDs[p.orders[i].ExchangeID]; ok {
+			p.orders[i].ClientOrderID = clientOrderID
+		}
+	}
+	for i := range orders {
+		orders[i].ClientOrderID = clientOrderIDs[orders[i].ExchangeID]
+	}
+	return orders, nil
+}
+
+// OrderByClientID returns the order of a client order ID, or ErrOrderNotFound
+func (p *PaperWallet) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	for _, order := range p.orders {
+		if order.Pair == pair && order.ClientOrderID == clientOrderID && clientOrderID != "" {
+			return order, nil
+		}
+	}
+	return model.Order{}, ErrOrderNotFound
 }
 
 func (p *PaperWallet) CandlesByPeriod(ctx context.Context, pair, period string,
@@ -732,3 +1077,8 @@ func (p *PaperWallet) CandlesByLimit(ctx context.Context, pair, period string, l
 func (p *PaperWallet) CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle, chan error) {
 	return p.feeder.CandlesSubscription(ctx, pair, timeframe)
 }
+
+func (p *PaperWallet) DepthSubscription(ctx context.Context, pair string,
+	levels int) (chan model.OrderBook, chan error) {
+	return p.feeder.DepthSubscription(ctx, pair, levels)
+}
@@ -0,0 +1,72 @@
+package exchange
+
+import "fmt"
+
+// PaperWalletConfig is the simulation settings of a paper wallet, which decide the result of a backtest
+// together with the data and the strategy
+type PaperWalletConfig struct {
+	BaseCoin string             `json:"base_coin"`
+	Assets   map[string]float64 `json:"assets"`
+	MakerFee float64            `json:"maker_fee"`
+	TakerFee float64            `json:"taker_fee"`
+	FeeAsset string             `json:"fee_asset,omitempty"`
+	// Slippage describes the slippage models by pair, with the default model in the "*" key
+	Slippage          map[string]string  `json:"slippage,omitempty"`
+	Participation     float64            `json:"participation,omitempty"`
+	CandlePath        CandlePath         `json:"candle_path,omitempty"`
+	Latency           string             `json:"latency,omitempty"`
+	Leverage          map[string]float64 `json:"leverage,omitempty"`
+	MaintenanceMargin float64            `json:"maintenance_margin,omitempty"`
+	// Funding is the number of funding rates by pair
+	Funding map[string]int `json:"funding,omitempty"`
+}
+
+// Config returns the initial balances and the simulation settings of the wallet, as created
+func (p *PaperWallet) Config() PaperWalletConfig {
+	return p.config
+}
+
+// initialConfig returns the settings of a new wallet, before any candle
+func (p *PaperWallet) initialConfig() PaperWalletConfig {
+	config := PaperWalletConfig{
+		BaseCoin:          p.baseCoin,
+		Assets:            make(map[string]float64, len(p.assets)),
+		MakerFee:          p.makerFee,
+		TakerFee:          p.takerFee,
+		FeeAsset:          p.feeAsset,
+		Participation:     p.participation,
+		CandlePath:        p.candlePath,
+		MaintenanceMargin: p.maintenanceMargin,
+	}
+	for asset, info := range p.assets {
+		config.Assets[asset] = info.Free
+	}
+	if p.latency > 0 {
+		config.Latency = p.latency.String()
+	}
+
+	if len(p.slippage) > 0 || p.defaultSlippage != nil {
+		config.Slippage = make(map[string]string, len(p.slippage)+1)
+		for pair, model := range p.slippage {
+			config.Slippage[pair] = fmt.Sprintf("%T%+v", model, model)
+		}
+		if p.defaultSlippage != nil {
+			config.Slippage["*"] = fmt.Sprintf("%T%+v", p.defaultSlippage, p.defaultSlippage)
+		}
+	}
+
+	if len(p.leverage) > 0 {
+		config.Leverage = make(map[string]float64, len(p.leverage))
+		for pair, leverage := range p.leverage {
+			config.Leverage[pair] = leverage
+		}
+	}
+
+	if len(p.fundingRates) > 0 {
+		config.Funding = make(map[string]int, len(p.fundingRates))
+		for pair, rates := range p.fundingRates {
+			config.Funding[pair] = len(rates)
+		}
+	}
+	return config
+}
@@ -0,0 +1,60 @@
+package exchange
+
+import (
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// WithPaperFeeAsset pays the fees with an asset other than the quote, eg: BNB for a discount on Binance.
+// Fees are converted with the last price of the asset in the quote of the pair, and paid in the quote
+// when the price is unknown or the balance of the asset is not enough.
+func WithPaperFeeAsset(asset string) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.feeAsset = asset
+	}
+}
+
+// Fees returns the fees paid on the orders of a pair since the start, in the quote asset
+func (p *PaperWallet) Fees(pair string) float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.fees[pair]
+}
+
+// makerOrder returns true for the orders resting in the book until filled, other orders pay the taker fee
+func makerOrder(order model.Order) bool {
+	return order.Type == model.OrderTypeLimit || order.Type == model.OrderTypeLimitMaker
+}
+
+// chargeFee pays the fee of a fill with the maker or taker rate, and returns the fee in the quote asset
+func (p *PaperWallet) chargeFee(pair string, quantity, price float64, maker bool) float64 {
+	rate := p.takerFee
+	if maker {
+		rate = p.makerFee
+	}
+	if rate == 0 || quantity == 0 {
+		return 0
+	}
+
+	_, quote := SplitAssetQuote(pair)
+	fee := quantity * price * rate
+	p.fees[pair] += fee
+
+	if p.feeAsset != "" && p.feeAsset != quote {
+		if candle, ok := p.lastCandle[p.feeAsset+quote]; ok && candle.Close > 0 {
+			amount := fee / candle.Close
+			if info, ok := p.assets[p.feeAsset]; ok && info.Free >= amount {
+				info.Free -= amount
+				log.Debugf("[PAPER] %s fee: %.8f %s", pair, amount, p.feeAsset)
+				return fee
+			}
+		}
+	}
+
+	if _, ok := p.assets[quote]; !ok {
+		p.assets[quote] = &assetInfo{}
+	}
+	p.assets[quote].Free -= fee
+	log.Debugf("[PAPER] %s fee: %.8f %s", pair, fee, quote)
+	return fee
+}
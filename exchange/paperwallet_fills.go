@@ -0,0 +1,59 @@
+package exchange
+
+import (
+	"context"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// paperSubscriptionBuffer is the number of order updates kept for each account subscriber
+const paperSubscriptionBuffer = 1000
+
+// WithPaperParticipation fills limit orders progressively, up to a rate of the volume of each candle,
+// eg: 0.1 fills at most 10% of the candle volume. Orders larger than the rate are partially filled over
+// multiple candles. Candles without volume fill the whole order.
+func WithPaperParticipation(rate float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.participation = rate
+	}
+}
+
+// publish sends an order update to the account subscribers, without blocking the wallet
+func (p *PaperWallet) publish(order model.Order) {
+	for _, subscriber := range p.subscribers {
+		select {
+		case subscriber <- order:
+		default:
+			log.Warnf("[PAPER] account subscriber is full, update of order %d dropped", order.ExchangeID)
+		}
+	}
+}
+
+// AccountSubscription streams the fills of the wallet orders, including partial fills, and the
+// liquidation orders of leveraged positions
+func (p *PaperWallet) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	orders := make(chan model.Order, paperSubscriptionBuffer)
+	errs := make(chan error)
+
+	p.Lock()
+	p.subscribers = append(p.subscribers, orders)
+	p.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		p.Lock()
+		defer p.Unlock()
+		for i, subscriber := range p.subscribers {
+			if subscriber == orders {
+				p.subscribers = append(p.subscribers[:i], p.subscribers[i+1:]...)
+				break
+			}
+		}
+		close(orders)
+		close(errs)
+	}()
+
+	return orders, errs
+}
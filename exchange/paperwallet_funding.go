@@ -0,0 +1,65 @@
+package exchange
+
+import (
+	"sort"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// WithPaperFunding settles the funding of a perpetual pair with historical rates, eg: from
+// FundingRatesFromCSV. Positive rates are paid by long positions to short positions, valued at the open
+// price of the first candle after the funding time.
+func WithPaperFunding(pair string, rates []model.FundingRate) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		sorted := make([]model.FundingRate, len(rates))
+		copy(sorted, rates)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].Time.Before(sorted[j].Time)
+		})
+		wallet.fundingRates[pair] = sorted
+	}
+}
+
+// Funding returns the net funding of a pair since the start, negative when paid
+func (p *PaperWallet) Funding(pair string) float64 {
+	p.Lock()
+	defer p.Unlock()
+	return p.funding[pair]
+}
+
+// settleFunding pays or receives the funding of the rates up to the open time of a candle, with the position
+// before the candle orders. Rates before the first candle are skipped.
+func (p *PaperWallet) settleFunding(candle model.Candle) {
+	rates := p.fundingRates[candle.Pair]
+	if len(rates) == 0 {
+		return
+	}
+
+	_, started := p.lastCandle[candle.Pair]
+	asset, quote := SplitAssetQuote(candle.Pair)
+	price := candle.Open
+	if price == 0 {
+		price = candle.Close
+	}
+
+	for len(rates) > 0 && !rates[0].Time.After(candle.Time) {
+		rate := rates[0]
+		rates = rates[1:]
+
+		info, ok := p.assets[asset]
+		if !started || !ok || info.Free+info.Lock == 0 {
+			continue
+		}
+
+		if _, ok := p.assets[quote]; !ok {
+			p.assets[quote] = &assetInfo{}
+		}
+
+		payment := -(info.Free + info.Lock) * price * rate.Rate
+		p.assets[quote].Free += payment
+		p.funding[candle.Pair] += payment
+		log.Debugf("[PAPER] %s funding of %.4f%%: %.4f %s", candle.Pair, rate.Rate*100, payment, quote)
+	}
+	p.fundingRates[candle.Pair] = rates
+}
@@ -0,0 +1,90 @@
+package exchange
+
+import (
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// WithPaperLatency delays the acknowledgment of orders by the exchange, eg: 200ms. Orders are created at the
+// close of the last candle, and only filled by candles after the latency. Market orders are filled at the open
+// of the next candle, or later in the candle for longer latencies, instead of the last close.
+func WithPaperLatency(latency time.Duration) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.latency = latency
+	}
+}
+
+// candleClose returns the close time of a candle, given its timeframe
+func candleClose(candle model.Candle) time.Time {
+	if candle.Timeframe != "" {
+		if interval, err := str2duration.ParseDuration(candle.Timeframe); err == nil {
+			return candle.Time.Add(interval)
+		}
+	}
+	if candle.UpdatedAt.After(candle.Time) {
+		return candle.UpdatedAt
+	}
+	return candle.Time
+}
+
+// delay registers the acknowledgment time of a new order, after the latency
+func (p *PaperWallet) delay(order model.Order) {
+	if p.latency > 0 {
+		p.acknowledged[order.ExchangeID] = candleClose(p.lastCandle[order.Pair]).Add(p.latency)
+	}
+}
+
+// pending returns true when an order is not acknowledged before the close of a candle
+func (p *PaperWallet) pending(order model.Order, candle model.Candle) bool {
+	acknowledged, ok := p.acknowledged[order.ExchangeID]
+	return ok && acknowledged.After(candleClose(candle))
+}
+
+// marketPrice returns the price of a delayed market order: the open of the first candle after the latency,
+// or the price interpolated from the open to the close at the end of the latency during the candle
+func (p *PaperWallet) marketPrice(order model.Order, candle model.Candle) float64 {
+	open := candle.Open
+	if open == 0 {
+		open = candle.Close
+	}
+
+	acknowledged, ok := p.acknowledged[order.ExchangeID]
+	end := candleClose(candle)
+	if !ok || !acknowledged.After(candle.Time) || !end.After(candle.Time) {
+		return open
+	}
+
+	elapsed := float64(acknowledged.Sub(candle.Time)) / float64(end.Sub(candle.Time))
+	return open + (candle.Close-open)*elapsed
+}
+
+// submitOrderMarket creates a market order filled after the latency, the funds are locked at the last close
+func (p *PaperWallet) submitOrderMarket(side model.SideType, pair string, size float64) (model.Order, error) {
+	if size == 0 {
+		return model.Order{}, ErrInvalidQuantity
+	}
+
+	price := p.lastCandle[pair].Close
+	if err := p.validateFunds(side, pair, size, price, false); err != nil {
+		return model.Order{}, err
+	}
+
+	order := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  p.lastCandle[pair].Time,
+		UpdatedAt:  p.lastCandle[pair].Time,
+		Pair:       pair,
+		Side:       side,
+		Type:       model.OrderTypeMarket,
+		Status:     model.OrderStatusTypeNew,
+		Price:      price,
+		Quantity:   size,
+	}
+	p.orders = append(p.orders, order)
+	p.reserveMargin(order.ExchangeID, side, pair, size, price)
+	p.delay(order)
+	return order, nil
+}
@@ -0,0 +1,261 @@
+package exchange
+
+import (
+	"math"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// defaultMaintenanceMargin is the rate of the position value required to keep a leveraged position open,
+// the lowest tier of most exchanges
+const defaultMaintenanceMargin = 0.004
+
+// marginReserve is the margin locked by an open order of a leveraged pair, released as the order is filled
+type marginReserve struct {
+	Amount   float64
+	Quantity float64
+}
+
+// WithPaperLeverage trades a pair with isolated margin, like in a futures account. Positions, long or short,
+// lock a fraction of their value from the quote asset as margin, and are liquidated when the losses
+// consume the margin, see WithPaperMaintenanceMargin. The asset balance is the size of the position,
+// negative for short positions.
+func WithPaperLeverage(pair string, leverage int) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.leverage[pair] = math.Max(float64(leverage), 1)
+	}
+}
+
+// WithPaperMaintenanceMargin sets the rate of the position value required to keep leveraged positions open,
+// positions are liquidated when their margin and profit fall below it, default: 0.4%
+func WithPaperMaintenanceMargin(rate float64) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.maintenanceMargin = rate
+	}
+}
+
+// leveraged returns the leverage of a pair, or false when the pair is traded in the spot account
+func (p *PaperWallet) leveraged(pair string) (float64, bool) {
+	leverage, ok := p.leverage[pair]
+	return leverage, ok
+}
+
+// entryPrice returns the average price of a position
+func (p *PaperWallet) entryPrice(pair string, position float64) float64 {
+	if position < 0 {
+		return p.avgShortPrice[pair]
+	}
+	return p.avgLongPrice[pair]
+}
+
+// closeValue returns the margin and the profit released by closing a quantity of a leveraged position
+func (p *PaperWallet) closeValue(pair string, position, quantity, price float64) (margin, profit float64) {
+	if position == 0 {
+		return 0, 0
+	}
+
+	margin = p.margins[pair] * quantity / math.Abs(position)
+	profit = quantity * (price - p.entryPrice(pair, position))
+	if position < 0 {
+		profit = -profit
+	}
+	return margin, profit
+}
+
+// opening returns the quantity of an order that opens or increases a position, instead of reducing it
+func (p *PaperWallet) opening(side model.SideType, pair string, quantity float64) float64 {
+	asset, _ := SplitAssetQuote(pair)
+	position := p.assets[asset].Free
+	if (side == model.SideTypeBuy && position < 0) || (side == model.SideTypeSell && position > 0) {
+		return math.Max(quantity-math.Abs(position), 0)
+	}
+	return quantity
+}
+
+// validateMargin checks the funds of an order of a leveraged pair, the margin of the closed part of a position
+// and its profit can be used to open the reverse position. Filled orders update the position.
+func (p *PaperWallet) validateMargin(side model.SideType, pair string, amount, value, leverage float64,
+	fill bool) error {
+
+	asset, quote := SplitAssetQuote(pair)
+	if _, ok := p.assets[asset]; !ok {
+		p.assets[asset] = &assetInfo{}
+	}
+	if _, ok := p.assets[quote]; !ok {
+		p.assets[quote] = &assetInfo{}
+	}
+
+	opening := p.opening(side, pair, amount)
+	margin, profit := p.closeValue(pair, p.assets[asset].Free, amount-opening, value)
+	if p.assets[quote].Free+margin+profit < opening*value/leverage {
+		return &OrderError{
+			Err:      ErrInsufficientFunds,
+			Pair:     pair,
+			Quantity: amount,
+		}
+	}
+
+	if fill {
+		p.fillMargin(side, pair, amount, value)
+	}
+	return nil
+}
+
+// reserveMargin locks the margin required by an open order of a leveraged pair, orders of the same OCO group
+// share a single reserve
+func (p *PaperWallet) reserveMargin(key int64, side model.SideType, pair string, quantity, price float64) {
+	leverage, ok := p.leveraged(pair)
+	if !ok {
+		return
+	}
+
+	_, quote := SplitAssetQuote(pair)
+	amount := p.opening(side, pair, quantity) * price / leverage
+	p.assets[quote].Free -= amount
+	p.assets[quote].Lock += amount
+	p.reserves[key] = &marginReserve{Amount: amount, Quantity: quantity}
+}
+
+// releaseMargin unlocks the margin reserved for the filled quantity of an order, or all the remaining
+// margin of canceled orders when the quantity is zero
+func (p *PaperWallet) releaseMargin(order model.Order, quantity float64) {
+	key := order.ExchangeID
+	if order.GroupID != nil {
+		key = *order.GroupID
+	}
+
+	reserve, ok := p.reserves[key]
+	if !ok {
+		return
+	}
+
+	amount := reserve.Amount
+	if quantity > 0 && quantity < reserve.Quantity {
+		amount = reserve.Amount * quantity / reserve.Quantity
+		reserve.Amount -= amount
+		reserve.Quantity -= quantity
+	} else {
+		delete(p.reserves, key)
+	}
+
+	_, quote := SplitAssetQuote(order.Pair)
+	p.assets[quote].Free += amount
+	p.assets[quote].Lock -= amount
+}
+
+// fillMargin executes an order of a leveraged pair: the reduced part of the position releases its margin
+// and realizes the profit, while the opened part locks the margin of its value
+func (p *PaperWallet) fillMargin(side model.SideType, pair string, quantity, price float64) {
+	asset, quote := SplitAssetQuote(pair)
+	leverage := p.leverage[pair]
+	position := p.assets[asset].Free
+	direction := 1.0
+	if side == model.SideTypeSell {
+		direction = -1.0
+	}
+
+	opening := p.opening(side, pair, quantity)
+	if closed := quantity - opening; closed > 0 {
+		margin, profit := p.closeValue(pair, position, closed, price)
+		p.margins[pair] -= margin
+		p.assets[quote].Lock -= margin
+		p.assets[quote].Free += margin + profit
+		position += direction * closed
+		log.Infof("PROFIT = %.4f %s (%.2f %%)", profit, quote, profit/margin*100.0)
+	}
+
+	if opening > 0 {
+		margin := opening * price / leverage
+		p.margins[pair] += margin
+		p.assets[quote].Free -= margin
+		p.assets[quote].Lock += margin
+
+		size := math.Abs(position)
+		average := (p.entryPrice(pair, direction)*size + price*opening) / (size + opening)
+		if side == model.SideTypeBuy {
+			p.avgLongPrice[pair] = average
+		} else {
+			p.avgShortPrice[pair] = average
+		}
+		position += direction * opening
+	}
+
+	if position == 0 {
+		p.margins[pair] = 0
+	}
+	p.assets[asset].Free = position
+}
+
+// liquidate closes a leveraged position when its equity, at the worst price of the candle, falls below the
+// maintenance margin. The open orders of the pair are canceled, the margin is lost and a liquidation order is
+// sent to the account subscribers.
+func (p *PaperWallet) liquidate(candle model.Candle) {
+	asset, quote := SplitAssetQuote(candle.Pair)
+	if _, ok := p.leveraged(candle.Pair); !ok || p.assets[asset] == nil || p.assets[asset].Free == 0 {
+		return
+	}
+
+	position := p.assets[asset].Free
+	price := candle.Close
+	if position > 0 && candle.Low > 0 {
+		price = candle.Low
+	} else if position < 0 && candle.High > 0 {
+		price = candle.High
+	}
+
+	margin, profit := p.closeValue(candle.Pair, position, math.Abs(position), price)
+	if margin+profit > math.Abs(position)*price*p.maintenanceMargin {
+		return
+	}
+
+	for i, order := range p.orders {
+		if order.Pair == candle.Pair && (order.Status == model.OrderStatusTypeNew ||
+			order.Status == model.OrderStatusTypePartiallyFilled) {
+			p.orders[i].Status = model.OrderStatusTypeCanceled
+			p.orders[i].UpdatedAt = candle.Time
+			p.releaseMargin(order, 0)
+			delete(p.icebergs, order.ExchangeID)
+			p.publish(p.orders[i])
+		}
+	}
+
+	order := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  candle.Time,
+		UpdatedAt:  candle.Time,
+		Pair:       candle.Pair,
+		Side:       model.SideTypeSell,
+		Type:       model.OrderTypeLiquidation,
+		Status:     model.OrderStatusTypeFilled,
+		Price:      p.liquidationPrice(candle.Pair, position),
+		Quantity:   math.Abs(position),
+		Executed:   math.Abs(position),
+	}
+	if position < 0 {
+		order.Side = model.SideTypeBuy
+	}
+	p.orders = append(p.orders, order)
+
+	log.Warnf("[PAPER] %s position of %f liquidated at %f, margin lost: %.4f %s", candle.Pair, position,
+		order.Price, margin, quote)
+	p.assets[quote].Lock -= margin
+	p.margins[candle.Pair] = 0
+	p.assets[asset].Free = 0
+	p.volume[candle.Pair] += order.Price * order.Quantity
+	p.publish(order)
+}
+
+// liquidationPrice returns the price where the equity of a leveraged position reaches the maintenance margin
+func (p *PaperWallet) liquidationPrice(pair string, position float64) float64 {
+	if position == 0 {
+		return 0
+	}
+
+	direction := 1.0
+	if position < 0 {
+		direction = -1.0
+	}
+	price := (p.entryPrice(pair, position) - p.margins[pair]/position) / (1 - direction*p.maintenanceMargin)
+	return math.Max(price, 0)
+}
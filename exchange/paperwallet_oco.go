@@ -0,0 +1,119 @@
+package exchange
+
+import (
+	"math"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// CandlePath is the assumed path of the price within a candle, which decides the leg of an OCO order
+// executed when a single candle reaches both legs
+type CandlePath string
+
+var (
+	// CandlePathPessimistic executes the stop leg, the worst outcome
+	CandlePathPessimistic CandlePath = "PESSIMISTIC"
+	// CandlePathOptimistic executes the limit leg, the best outcome
+	CandlePathOptimistic CandlePath = "OPTIMISTIC"
+	// CandlePathOHLC assumes the price goes from the open to the high, then to the low and the close
+	CandlePathOHLC CandlePath = "OHLC"
+	// CandlePathOLHC assumes the price goes from the open to the low, then to the high and the close
+	CandlePathOLHC CandlePath = "OLHC"
+	// CandlePathNearest assumes the price goes from the open to the nearest extreme first
+	CandlePathNearest CandlePath = "NEAREST"
+)
+
+// WithPaperCandlePath sets the assumed path of the price within candles that reach both legs of an OCO
+// order, default: CandlePathPessimistic
+func WithPaperCandlePath(path CandlePath) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		wallet.candlePath = path
+	}
+}
+
+// reachedFirst returns false when another leg of the OCO group of an order is also reached by the candle
+// and is executed first, given the candle path
+func (p *PaperWallet) reachedFirst(order model.Order, price float64, candle model.Candle) bool {
+	if order.GroupID == nil {
+		return true
+	}
+
+	for _, leg := range p.orders {
+		if leg.GroupID == nil || *leg.GroupID != *order.GroupID || leg.ExchangeID == order.ExchangeID ||
+			(leg.Status != model.OrderStatusTypeNew && leg.Status != model.OrderStatusTypePartiallyFilled) {
+			continue
+		}
+
+		legPrice, ok := p.triggerPrice(leg, candle)
+		if !ok {
+			continue
+		}
+
+		switch p.candlePath {
+		case CandlePathOptimistic:
+			if stopOrder(order) && !stopOrder(leg) {
+				return false
+			}
+		case CandlePathOHLC, CandlePathOLHC, CandlePathNearest:
+			path := p.pricePath(candle)
+			if pathTime(path, legPrice) < pathTime(path, price) {
+				return false
+			}
+		default:
+			if !stopOrder(order) && stopOrder(leg) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pricePath returns the prices visited by a candle, given the candle path
+func (p *PaperWallet) pricePath(candle model.Candle) []float64 {
+	open := candle.Open
+	if open == 0 {
+		open = candle.Close
+	}
+
+	highFirst := p.candlePath == CandlePathOHLC
+	if p.candlePath == CandlePathNearest {
+		highFirst = candle.High-open <= open-candle.Low
+	}
+	if highFirst {
+		return []float64{open, candle.High, candle.Low, candle.Close}
+	}
+	return []float64{open, candle.Low, candle.High, candle.Close}
+}
+
+// pathTime returns the position where a path reaches a price first, as the index of the segment plus the
+// fraction of the segment, or the length of the path when the price is not reached
+func pathTime(path []float64, price float64) float64 {
+	for i := 1; i < len(path); i++ {
+		from, to := path[i-1], path[i]
+		if price < math.Min(from, to) || price > math.Max(from, to) {
+			continue
+		}
+		if from == to {
+			return float64(i - 1)
+		}
+		return float64(i-1) + (price-from)/(to-from)
+	}
+	return float64(len(path))
+}
+
+// cancelGroup cancels the other legs of the OCO group of an executed order
+func (p *PaperWallet) cancelGroup(order model.Order, candle model.Candle) {
+	if order.GroupID == nil {
+		return
+	}
+
+	for i, leg := range p.orders {
+		if leg.GroupID == nil || *leg.GroupID != *order.GroupID || leg.ExchangeID == order.ExchangeID ||
+			(leg.Status != model.OrderStatusTypeNew && leg.Status != model.OrderStatusTypePartiallyFilled) {
+			continue
+		}
+		p.orders[i].Status = model.OrderStatusTypeCanceled
+		p.orders[i].UpdatedAt = candle.Time
+		p.publish(p.orders[i])
+	}
+}
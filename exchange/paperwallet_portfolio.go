@@ -0,0 +1,192 @@
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gonum.org/v1/gonum/stat"
+)
+
+// portfolioSnapshot is the state of the account at the close of the candles of a time
+type portfolioSnapshot struct {
+	Time     time.Time
+	Equity   float64
+	Close    map[string]float64
+	Exposure map[string]float64
+}
+
+// Portfolio is the combined result of all the pairs of the paper wallet, which draw from the same account.
+// Orders of a pair are rejected when the other pairs hold the funds, the contention for capital.
+type Portfolio struct {
+	// Equity is the combined equity curve, one value by candle time
+	Equity []AssetValue
+	// MaxExposure and AvgExposure are the notional value of the open positions, as a fraction of the equity
+	MaxExposure float64
+	AvgExposure float64
+	// MaxConcurrent and AvgConcurrent are the number of pairs with an open position at the same time
+	MaxConcurrent int
+	AvgConcurrent float64
+	// Rejected is the number of orders rejected by insufficient funds, by pair
+	Rejected map[string]int
+	// Correlation is the correlation of the returns of the positions of two pairs held at the same time, by pairs,
+	// eg: Correlation["BTCUSDT"]["ETHUSDT"]. Highly correlated positions add risk instead of diversifying.
+	Correlation map[string]map[string]float64
+}
+
+// contend counts the orders rejected by insufficient funds
+func (p *PaperWallet) contend(pair string, err error) {
+	if errors.Is(err, ErrInsufficientFunds) {
+		p.rejected[pair]++
+	}
+}
+
+// recordPortfolio updates the snapshot of the account at the time of a complete candle
+func (p *PaperWallet) recordPortfolio(candle time.Time, equity float64) {
+	if len(p.snapshots) == 0 || !p.snapshots[len(p.snapshots)-1].Time.Equal(candle) {
+		p.snapshots = append(p.snapshots, portfolioSnapshot{Time: candle})
+	}
+
+	snapshot := &p.snapshots[len(p.snapshots)-1]
+	snapshot.Equity = equity
+	snapshot.Close = make(map[string]float64, len(p.lastCandle))
+	snapshot.Exposure = make(map[string]float64, len(p.lastCandle))
+	for pair, last := range p.lastCandle {
+		asset, _ := SplitAssetQuote(pair)
+		snapshot.Close[pair] = last.Close
+		if info, ok := p.assets[asset]; ok {
+			snapshot.Exposure[pair] = (info.Free + info.Lock) * last.Close
+		}
+	}
+}
+
+// Portfolio returns the combined equity curve, exposure, contention and correlation of the pairs
+func (p *PaperWallet) Portfolio() Portfolio {
+	p.Lock()
+	defer p.Unlock()
+
+	portfolio := Portfolio{
+		Equity:      make([]AssetValue, 0, len(p.snapshots)),
+		Rejected:    make(map[string]int, len(p.rejected)),
+		Correlation: make(map[string]map[string]float64),
+	}
+	for pair, count := range p.rejected {
+		portfolio.Rejected[pair] = count
+	}
+
+	// returns of the positions by pair and snapshot index, pairs without candles at a time have no return
+	returns := make(map[string]map[int]float64)
+	var concurrent, exposure float64
+	for i, snapshot := range p.snapshots {
+		portfolio.Equity = append(portfolio.Equity, AssetValue{Time: snapshot.Time, Value: snapshot.Equity})
+
+		var (
+			positions int
+			notional  float64
+		)
+		for _, value := range snapshot.Exposure {
+			if value != 0 {
+				positions++
+				notional += math.Abs(value)
+			}
+		}
+		portfolio.MaxConcurrent = int(math.Max(float64(portfolio.MaxConcurrent), float64(positions)))
+		concurrent += float64(positions)
+		if snapshot.Equity > 0 {
+			portfolio.MaxExposure = math.Max(portfolio.MaxExposure, notional/snapshot.Equity)
+			exposure += notional / snapshot.Equity
+		}
+
+		// the return of each position held since the previous snapshot, zero without a position
+		if i > 0 {
+			previous := p.snapshots[i-1]
+			for pair, price := range snapshot.Close {
+				var value float64
+				if last := previous.Close[pair]; last > 0 && previous.Equity > 0 {
+					value = previous.Exposure[pair] / previous.Equity * (price/last - 1)
+				}
+				if returns[pair] == nil {
+					returns[pair] = make(map[int]float64)
+				}
+				returns[pair][i] = value
+			}
+		}
+	}
+
+	if len(p.snapshots) > 0 {
+		portfolio.AvgConcurrent = concurrent / float64(len(p.snapshots))
+		portfolio.AvgExposure = exposure / float64(len(p.snapshots))
+	}
+
+	pairs := make([]string, 0, len(returns))
+	for pair := range returns {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for i, a := range pairs {
+		for _, b := range pairs[i+1:] {
+			var x, y []float64
+			for index, value := range returns[a] {
+				if other, ok := returns[b][index]; ok && value != 0 && other != 0 {
+					x, y = append(x, value), append(y, other)
+				}
+			}
+			if len(x) < 2 {
+				continue
+			}
+
+			correlation := stat.Correlation(x, y, nil)
+			if math.IsNaN(correlation) {
+				continue
+			}
+			if portfolio.Correlation[a] == nil {
+				portfolio.Correlation[a] = make(map[string]float64)
+			}
+			if portfolio.Correlation[b] == nil {
+				portfolio.Correlation[b] = make(map[string]float64)
+			}
+			portfolio.Correlation[a][b] = correlation
+			portfolio.Correlation[b][a] = correlation
+		}
+	}
+	return portfolio
+}
+
+// summaryPortfolio prints the combined result of the pairs
+func (p *PaperWallet) summaryPortfolio() {
+	portfolio := p.Portfolio()
+	if len(portfolio.Equity) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("---- PORTFOLIO ----")
+	first, last := portfolio.Equity[0], portfolio.Equity[len(portfolio.Equity)-1]
+	fmt.Printf("EQUITY          = %.2f -> %.2f %s\n", first.Value, last.Value, p.baseCoin)
+	fmt.Printf("EXPOSURE        = %.2f%% avg, %.2f%% max\n", portfolio.AvgExposure*100, portfolio.MaxExposure*100)
+	fmt.Printf("POSITIONS       = %.2f avg, %d max\n", portfolio.AvgConcurrent, portfolio.MaxConcurrent)
+
+	pairs := make([]string, 0, len(portfolio.Rejected))
+	for pair := range portfolio.Rejected {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for _, pair := range pairs {
+		fmt.Printf("%s REJECTED = %d orders\n", pair, portfolio.Rejected[pair])
+	}
+
+	pairs = pairs[:0]
+	for pair := range portfolio.Correlation {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for i, a := range pairs {
+		for _, b := range pairs[i+1:] {
+			if correlation, ok := portfolio.Correlation[a][b]; ok {
+				fmt.Printf("%s x %s = %.2f correlation\n", a, b, correlation)
+			}
+		}
+	}
+}
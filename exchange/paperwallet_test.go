@@ -2,6 +2,7 @@ package exchange
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
@@ -194,7 +195,7 @@ func TestPaperWallet_OrderLimit(t *testing.T) {
 func TestPaperWallet_OrderMarket(t *testing.T) {
 	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
 	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 50})
-	order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
 	require.NoError(t, err)
 
 	// create buy order
@@ -209,7 +210,7 @@ func TestPaperWallet_OrderMarket(t *testing.T) {
 	require.Equal(t, 50.0, wallet.avgLongPrice["BTCUSDT"])
 
 	// insufficient funds
-	order, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 100)
+	order, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 100, false)
 	require.Equal(t, &OrderError{
 		Err:      ErrInsufficientFunds,
 		Pair:     "BTCUSDT",
@@ -218,7 +219,7 @@ func TestPaperWallet_OrderMarket(t *testing.T) {
 
 	// sell
 	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
-	order, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+	order, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
 	require.NoError(t, err)
 	require.Equal(t, 1.0, order.Quantity)
 	require.Equal(t, 100.0, order.Price)
@@ -232,7 +233,7 @@ func TestPaperWallet_OrderMarket(t *testing.T) {
 func TestPaperWallet_OrderOCO(t *testing.T) {
 	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 50))
 	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 50})
-	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
 	require.NoError(t, err)
 
 	orders, err := wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 100, 40, 39)
@@ -270,7 +271,7 @@ func TestPaperWallet_OrderOCO(t *testing.T) {
 
 func TestPaperWallet_Order(t *testing.T) {
 	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
-	expectOrder, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+	expectOrder, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
 	require.NoError(t, err)
 	require.Equal(t, int64(1), expectOrder.ExchangeID)
 
@@ -370,7 +371,7 @@ func TestPaperWallet_CreateOrderStop(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
 		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
-		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
 		require.NoError(t, err)
 
 		order, err := wallet.CreateOrderStop("BTCUSDT", 1, 50)
@@ -395,6 +396,203 @@ func TestPaperWallet_CreateOrderStop(t *testing.T) {
 	})
 }
 
+func TestPaperWallet_Leverage(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+		WithPaperLeverage("BTCUSDT", 10))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+	// long position locks 10% of its value as margin
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 50, false)
+	require.NoError(t, err)
+	require.Equal(t, 500.0, wallet.assets["USDT"].Free)
+	require.Equal(t, 500.0, wallet.assets["USDT"].Lock)
+	require.Equal(t, 50.0, wallet.assets["BTC"].Free)
+
+	_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 60, false)
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 110, Complete: true})
+	risk, err := wallet.PositionRisk("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 50.0, risk.Size)
+	require.Equal(t, 10.0, risk.Leverage)
+	require.Equal(t, 500.0, risk.Margin)
+	require.Equal(t, 500.0, risk.UnrealizedPnL)
+	require.InDelta(t, 90/(1-defaultMaintenanceMargin), risk.LiquidationPrice, 1e-9)
+	require.Equal(t, 1500.0, wallet.EquityValues()[0].Value)
+
+	// reverse to a short position, with the released margin and profit
+	_, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 100, false)
+	require.NoError(t, err)
+	require.Equal(t, 950.0, wallet.assets["USDT"].Free)
+	require.Equal(t, 550.0, wallet.assets["USDT"].Lock)
+	require.Equal(t, 110.0, wallet.avgShortPrice["BTCUSDT"])
+
+	asset, quote, err := wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, -50.0, asset)
+	require.Equal(t, 1500.0, quote)
+
+	account, err := wallet.Account()
+	require.NoError(t, err)
+	balance, _ := account.Balance("BTC", "USDT")
+	require.Equal(t, -50.0, balance.Free)
+	require.Equal(t, 10.0, balance.Leverage)
+
+	// orders opening a position reserve margin until filled or canceled
+	order, err := wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 10, 120)
+	require.NoError(t, err)
+	require.Equal(t, 830.0, wallet.assets["USDT"].Free)
+	require.NoError(t, wallet.Cancel(order))
+	require.Equal(t, 950.0, wallet.assets["USDT"].Free)
+	require.Equal(t, 550.0, wallet.assets["USDT"].Lock)
+
+	// orders reducing a position do not reserve margin
+	_, err = wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 20, 100)
+	require.NoError(t, err)
+	require.Equal(t, 950.0, wallet.assets["USDT"].Free)
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	require.InDelta(t, 1370.0, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 330.0, wallet.assets["USDT"].Lock, 1e-9)
+	require.Equal(t, -30.0, wallet.assets["BTC"].Free)
+
+	// losses consume the margin of the short position
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 115, High: 121})
+	require.Equal(t, 0.0, wallet.assets["BTC"].Free)
+	require.InDelta(t, 1370.0, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 0.0, wallet.assets["USDT"].Lock, 1e-9)
+}
+
+func TestPaperWallet_LiquidationUpdates(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wallet := NewPaperWallet(ctx, "USDT", WithPaperAsset("USDT", 1000), WithPaperLeverage("BTCUSDT", 10))
+	updates, _ := wallet.AccountSubscription(ctx)
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10, false)
+	require.NoError(t, err)
+	exit, err := wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 10, 150)
+	require.NoError(t, err)
+
+	// the canceled exits are sent to the subscribers with the liquidation
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 90, Low: 89})
+	for {
+		select {
+		case update := <-updates:
+			if update.ExchangeID == exit.ExchangeID {
+				require.Equal(t, model.OrderStatusTypeCanceled, update.Status)
+				return
+			}
+		case <-time.After(time.Second):
+			require.Fail(t, "canceled exit not sent")
+			return
+		}
+	}
+}
+
+func TestPaperWallet_Funding(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+		WithPaperLeverage("BTCUSDT", 5),
+		WithPaperFunding("BTCUSDT", []model.FundingRate{
+			{Time: start, Rate: 0.01},
+			{Time: start.Add(8 * time.Hour), Rate: 0.001},
+			{Time: start.Add(16 * time.Hour), Rate: -0.002},
+		}))
+
+	// the funding before the position is skipped
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Open: 100, Close: 100})
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 10, false)
+	require.NoError(t, err)
+	require.Equal(t, 800.0, wallet.assets["USDT"].Free)
+
+	// long positions pay positive rates, valued at the open price after the funding
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(4 * time.Hour), Open: 100, Close: 110})
+	require.Equal(t, 800.0, wallet.assets["USDT"].Free)
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(8 * time.Hour), Open: 110, Close: 120})
+	require.InDelta(t, 798.9, wallet.assets["USDT"].Free, 1e-9)
+
+	// and receive negative rates
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(24 * time.Hour), Open: 100, Close: 100})
+	require.InDelta(t, 800.9, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 0.9, wallet.Funding("BTCUSDT"), 1e-9)
+}
+
+func TestPaperWallet_ModifyOrder(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100))
+	order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 0.5, 100)
+	require.NoError(t, err)
+
+	// the order is canceled and replaced, keeping the quantity
+	modified, err := wallet.ModifyOrder(order, 80, 0)
+	require.NoError(t, err)
+	require.NotEqual(t, order.ExchangeID, modified.ExchangeID)
+	require.Equal(t, 80.0, modified.Price)
+	require.Equal(t, 0.5, modified.Quantity)
+	require.Equal(t, model.OrderStatusTypeCanceled, wallet.orders[0].Status)
+
+	orders, err := wallet.OpenOrders("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, []model.Order{modified}, orders)
+
+	_, err = wallet.ModifyOrder(model.Order{Pair: "BTCUSDT", Type: model.OrderTypeMarket}, 80, 0)
+	require.ErrorIs(t, err, ErrUnsupportedOrder)
+}
+
+func TestPaperWallet_CreateOrderLimitTIF(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+	t.Run("post only", func(t *testing.T) {
+		_, err := wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 100, model.TimeInForceGTX)
+		require.Equal(t, &OrderError{Err: ErrPostOnlyRejected, Pair: "BTCUSDT", Quantity: 1}, err)
+
+		order, err := wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 90, model.TimeInForceGTX)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+	})
+
+	t.Run("immediate or cancel", func(t *testing.T) {
+		order, err := wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 95, model.TimeInForceIOC)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeExpired, order.Status)
+
+		order, err = wallet.CreateOrderLimitTIF(model.SideTypeBuy, "BTCUSDT", 1, 105, model.TimeInForceFOK)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, model.OrderTypeLimit, order.Type)
+		require.Equal(t, 100.0, order.Price)
+		require.Equal(t, 1.0, wallet.assets["BTC"].Free)
+	})
+}
+
+func TestPaperWallet_Iceberg(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 110})
+
+	order, err := wallet.CreateOrderLimitOptions(model.SideTypeBuy, "BTCUSDT", 2.5, 100,
+		model.OrderOptions{IcebergQuantity: 1})
+	require.NoError(t, err)
+
+	// the visible quantity is filled on each candle
+	for _, expected := range []float64{1, 2, 2.5} {
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		require.Equal(t, expected, wallet.assets["BTC"].Free)
+	}
+
+	order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.Equal(t, 750.0, wallet.assets["USDT"].Free)
+	require.InDelta(t, 0.0, wallet.assets["USDT"].Lock, 1e-9)
+
+	_, err = wallet.CreateOrderLimitOptions(model.SideTypeBuy, "BTCUSDT", 1, 100,
+		model.OrderOptions{IcebergQuantity: 1, TimeInForce: model.TimeInForceIOC})
+	require.ErrorIs(t, err, ErrInvalidQuantity)
+}
+
 func TestUpdateAveragePrice(t *testing.T) {
 	t.Run("long", func(t *testing.T) {
 		wallet := NewPaperWallet(
@@ -552,3 +750,346 @@ func TestUpdateAveragePrice(t *testing.T) {
 	})
 
 }
+
+func TestPaperWallet_Fees(t *testing.T) {
+	t.Run("maker and taker", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperFee(0.001, 0.002))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		// market orders pay the taker fee
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		require.InDelta(t, 0.2, wallet.Fees("BTCUSDT"), 1e-9)
+		require.InDelta(t, 899.8, wallet.assets["USDT"].Free, 1e-9)
+
+		// limit orders pay the maker fee when filled
+		_, err = wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 110)
+		require.NoError(t, err)
+		require.InDelta(t, 0.2, wallet.Fees("BTCUSDT"), 1e-9)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 105, High: 112})
+		require.InDelta(t, 0.31, wallet.Fees("BTCUSDT"), 1e-9)
+		require.InDelta(t, 899.8+110-0.11, wallet.assets["USDT"].Free, 1e-9)
+	})
+
+	t.Run("fee asset", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperAsset("BNB", 1), WithPaperFee(0.001, 0.001), WithPaperFeeAsset("BNB"))
+		wallet.OnCandle(model.Candle{Pair: "BNBUSDT", Close: 10})
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		require.InDelta(t, 0.99, wallet.assets["BNB"].Free, 1e-9)
+		require.InDelta(t, 900.0, wallet.assets["USDT"].Free, 1e-9)
+
+		// without enough balance of the fee asset, fees are paid in the quote
+		wallet.assets["BNB"].Free = 0
+		_, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		require.InDelta(t, 999.9, wallet.assets["USDT"].Free, 1e-9)
+		require.InDelta(t, 0.2, wallet.Fees("BTCUSDT"), 1e-9)
+	})
+}
+
+func TestPaperWallet_Participation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wallet := NewPaperWallet(ctx, "USDT", WithPaperAsset("USDT", 1000), WithPaperParticipation(0.1))
+	updates, _ := wallet.AccountSubscription(ctx)
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 110})
+
+	order, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 2.5, 100)
+	require.NoError(t, err)
+
+	// each candle fills 10% of its volume
+	for _, expected := range []float64{1, 2, 2.5} {
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100, Volume: 10})
+		require.InDelta(t, expected, wallet.assets["BTC"].Free, 1e-9)
+
+		update := <-updates
+		require.Equal(t, order.ExchangeID, update.ExchangeID)
+		require.InDelta(t, expected, update.Executed, 1e-9)
+	}
+
+	order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.InDelta(t, 750.0, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 0.0, wallet.assets["USDT"].Lock, 1e-9)
+
+	// market orders are filled at once
+	order, err = wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 2.5, false)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+	require.Equal(t, 2.5, order.Executed)
+}
+
+func TestPaperWallet_TrailingStop(t *testing.T) {
+	t.Run("sell", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+
+		order, err := wallet.CreateOrderTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 110, 0.1)
+		require.NoError(t, err)
+		require.Nil(t, order.Stop)
+		require.Equal(t, 1.0, wallet.assets["BTC"].Lock)
+
+		// not active below the activation price
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 95, High: 105, Low: 80})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Nil(t, order.Stop)
+
+		// the stop follows the highest high
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 115, High: 120, Low: 109})
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 125, High: 130, Low: 118})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.InDelta(t, 117.0, *order.Stop, 1e-9)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 112, High: 126, Low: 110})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.InDelta(t, 900.0+117.0, wallet.assets["USDT"].Free, 1e-9)
+		require.Equal(t, 0.0, wallet.assets["BTC"].Lock)
+	})
+
+	t.Run("buy", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperLeverage("BTCUSDT", 10))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		_, err := wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+
+		// activated on creation, the stop follows the lowest low
+		order, err := wallet.CreateOrderTrailingStop(model.SideTypeBuy, "BTCUSDT", 1, 0, 0.05)
+		require.NoError(t, err)
+		require.InDelta(t, 105.0, *order.Stop, 1e-9)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 82, High: 98, Low: 80})
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 85, High: 86, Low: 81})
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+
+		asset, quote, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.0, asset)
+		require.InDelta(t, 1016.0, quote, 1e-9)
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+
+		_, err := wallet.CreateOrderTrailingStop(model.SideTypeBuy, "BTCUSDT", 1, 0, 0.05)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+		_, err = wallet.CreateOrderTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 0, 0)
+		require.ErrorIs(t, err, ErrUnsupportedOrder)
+	})
+}
+
+func TestPaperWallet_OrderOCOCandlePath(t *testing.T) {
+	// a candle reaching the target at 110 and the stop at 90
+	candle := model.Candle{Pair: "BTCUSDT", Open: 104, High: 112, Low: 88, Close: 100}
+
+	tt := []struct {
+		path     CandlePath
+		executed model.OrderType
+		free     float64
+	}{
+		{"", model.OrderTypeStopLoss, 90},
+		{CandlePathPessimistic, model.OrderTypeStopLoss, 90},
+		{CandlePathOptimistic, model.OrderTypeLimitMaker, 110},
+		{CandlePathOHLC, model.OrderTypeLimitMaker, 110},
+		{CandlePathOLHC, model.OrderTypeStopLoss, 90},
+		{CandlePathNearest, model.OrderTypeLimitMaker, 110},
+	}
+	for _, tc := range tt {
+		t.Run(string(tc.path), func(t *testing.T) {
+			wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 100),
+				WithPaperCandlePath(tc.path))
+			wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+			_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+			require.NoError(t, err)
+
+			orders, err := wallet.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 110, 90, 89)
+			require.NoError(t, err)
+
+			wallet.OnCandle(candle)
+			for _, order := range orders {
+				order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+				require.NoError(t, err)
+				if order.Type == tc.executed {
+					require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+				} else {
+					require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+				}
+			}
+			require.Equal(t, tc.free, wallet.assets["USDT"].Free)
+			require.Equal(t, 0.0, wallet.assets["BTC"].Lock)
+		})
+	}
+
+	t.Run("buy", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperLeverage("BTCUSDT", 10))
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		_, err := wallet.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+
+		// the stop above the price is not executed until reached
+		orders, err := wallet.CreateOrderOCO(model.SideTypeBuy, "BTCUSDT", 1, 90, 110, 111)
+		require.NoError(t, err)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, High: 105, Low: 95, Close: 100})
+		order, err := wallet.Order("BTCUSDT", orders[1].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Open: 100, High: 112, Low: 99, Close: 108})
+		order, err = wallet.Order("BTCUSDT", orders[1].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		order, err = wallet.Order("BTCUSDT", orders[0].ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeCanceled, order.Status)
+
+		asset, quote, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.0, asset)
+		require.InDelta(t, 990.0, quote, 1e-9)
+	})
+}
+
+func TestPaperWallet_Latency(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hours int, open, close float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Timeframe: "1h", Time: start.Add(time.Duration(hours) * time.Hour),
+			Open: open, Close: close, High: math.Max(open, close), Low: math.Min(open, close), Complete: true}
+	}
+
+	t.Run("near the next open", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperLatency(time.Second))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		require.Equal(t, 100.0, wallet.assets["USDT"].Lock)
+
+		wallet.OnCandle(candle(1, 102, 105))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, 1.0, wallet.assets["BTC"].Free)
+		require.InDelta(t, 898.0, wallet.assets["USDT"].Free, 0.01)
+		require.InDelta(t, 0.0, wallet.assets["USDT"].Lock, 1e-9)
+		require.InDelta(t, 102.0, wallet.avgLongPrice["BTCUSDT"], 0.01)
+	})
+
+	t.Run("longer than a candle", func(t *testing.T) {
+		wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+			WithPaperLatency(90*time.Minute))
+		wallet.OnCandle(candle(0, 100, 100))
+
+		order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		limit, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 101)
+		require.NoError(t, err)
+
+		// orders are not acknowledged before the close of the candle
+		wallet.OnCandle(candle(1, 100, 100))
+		for _, id := range []int64{order.ExchangeID, limit.ExchangeID} {
+			order, err := wallet.Order("BTCUSDT", id)
+			require.NoError(t, err)
+			require.Equal(t, model.OrderStatusTypeNew, order.Status)
+		}
+
+		// the latency ends in the middle of the candle, between the open and the close
+		wallet.OnCandle(candle(2, 100, 98))
+		order, err = wallet.Order("BTCUSDT", order.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		limit, err = wallet.Order("BTCUSDT", limit.ExchangeID)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, limit.Status)
+		require.InDelta(t, 2.0, wallet.assets["BTC"].Free, 1e-9)
+		require.InDelta(t, 1000-99.0-101.0, wallet.assets["USDT"].Free, 1e-9)
+	})
+}
+
+func TestPaperWallet_Portfolio(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := func(hours int, btc, eth float64) []model.Candle {
+		at := start.Add(time.Duration(hours) * time.Hour)
+		return []model.Candle{
+			{Pair: "BTCUSDT", Time: at, Open: btc, Close: btc, Low: btc, High: btc, Complete: true},
+			{Pair: "ETHUSDT", Time: at, Open: eth, Close: eth, Low: eth, High: eth, Complete: true},
+		}
+	}
+
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	for _, candle := range candles(0, 100, 10) {
+		wallet.OnCandle(candle)
+	}
+
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 6, false)
+	require.NoError(t, err)
+
+	// the pairs share the account, the second position is limited by the funds of the first
+	_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 50, false)
+	require.ErrorIs(t, err, ErrInsufficientFunds)
+	_, err = wallet.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 30, false)
+	require.NoError(t, err)
+
+	for hours, prices := range [][2]float64{{110, 11}, {99, 10.5}, {108.9, 11.2}} {
+		for _, candle := range candles(hours+1, prices[0], prices[1]) {
+			wallet.OnCandle(candle)
+		}
+	}
+
+	portfolio := wallet.Portfolio()
+	require.Len(t, portfolio.Equity, 4)
+	require.Equal(t, start.Add(3*time.Hour), portfolio.Equity[3].Time)
+	require.InDelta(t, 100+6*108.9+30*11.2, portfolio.Equity[3].Value, 1e-9)
+	require.Equal(t, map[string]int{"ETHUSDT": 1}, portfolio.Rejected)
+	require.Equal(t, 2, portfolio.MaxConcurrent)
+	require.InDelta(t, 1.5, portfolio.AvgConcurrent, 1e-9)
+	require.Greater(t, portfolio.MaxExposure, 0.9)
+	require.Greater(t, portfolio.Correlation["BTCUSDT"]["ETHUSDT"], 0.8)
+	require.Equal(t, portfolio.Correlation["BTCUSDT"]["ETHUSDT"], portfolio.Correlation["ETHUSDT"]["BTCUSDT"])
+}
+
+func TestPaperWallet_Config(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT",
+		WithPaperAsset("USDT", 1000),
+		WithPaperFee(0.001, 0.002),
+		WithPaperSlippage(FixedSlippage{BPS: 5}),
+		WithPaperSlippage(VolumeSlippage{Impact: 0.1}, "ETHUSDT"),
+		WithPaperLatency(time.Second),
+		WithPaperLeverage("BTCUSDT", 3),
+	)
+
+	config := wallet.Config()
+	require.Equal(t, "USDT", config.BaseCoin)
+	require.Equal(t, map[string]float64{"USDT": 1000}, config.Assets)
+	require.Equal(t, 0.002, config.TakerFee)
+	require.Equal(t, "exchange.FixedSlippage{BPS:5}", config.Slippage["*"])
+	require.Equal(t, "exchange.VolumeSlippage{Impact:0.1 MaxBPS:0}", config.Slippage["ETHUSDT"])
+	require.Equal(t, "1s", config.Latency)
+	require.Equal(t, 3.0, config.Leverage["BTCUSDT"])
+
+	// the config is the initial state, it does not change with the balances
+	wallet.lastCandle["BTCUSDT"] = model.Candle{Pair: "BTCUSDT", Close: 100}
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+	require.Equal(t, 1000.0, wallet.Config().Assets["USDT"])
+}
@@ -0,0 +1,132 @@
+package exchange
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// trailingStop is the state of a trailing stop order: the best price since its activation, and the stop
+// following it at the callback rate
+type trailingStop struct {
+	Callback float64
+	Extreme  float64
+	Active   bool
+}
+
+// CreateOrderTrailingStop simulates a trailing stop order, like the TRAILING_STOP_MARKET orders of futures
+// exchanges. The order is activated when the price reaches the activation price, or immediately when it is
+// zero, and its stop follows the highest high of sell orders, or the lowest low of buy orders, at the callback
+// rate, eg: 0.01 = 1%. The order is filled at the stop, with slippage, when a later candle crosses it.
+// Buy orders are supported for leveraged pairs, to protect short positions.
+func (p *PaperWallet) CreateOrderTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64) (model.Order, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if quantity <= 0 {
+		return model.Order{}, ErrInvalidQuantity
+	}
+	if callbackRate <= 0 || callbackRate >= 1 {
+		return model.Order{}, fmt.Errorf("%w: trailing stop callback rate %f", ErrUnsupportedOrder, callbackRate)
+	}
+
+	_, leveraged := p.leveraged(pair)
+	if side == model.SideTypeBuy && !leveraged {
+		return model.Order{}, fmt.Errorf("%w: trailing buy stop of spot pair %s", ErrUnsupportedOrder, pair)
+	}
+
+	price := activation
+	if price == 0 {
+		price = p.lastCandle[pair].Close
+	}
+	if err := p.validateFunds(side, pair, quantity, price, false); err != nil {
+		return model.Order{}, err
+	}
+
+	order := model.Order{
+		ExchangeID: p.ID(),
+		CreatedAt:  p.lastCandle[pair].Time,
+		UpdatedAt:  p.lastCandle[pair].Time,
+		Pair:       pair,
+		Side:       side,
+		Type:       model.OrderTypeTrailingStop,
+		Status:     model.OrderStatusTypeNew,
+		Price:      activation,
+		Quantity:   quantity,
+	}
+
+	trailing := &trailingStop{Callback: callbackRate}
+	if activation == 0 {
+		trailing.Active = true
+		trailing.Extreme = p.lastCandle[pair].Close
+		order.Stop = trailing.stop(side)
+	}
+	p.trailing[order.ExchangeID] = trailing
+
+	p.orders = append(p.orders, order)
+	p.reserveMargin(order.ExchangeID, side, pair, quantity, price)
+	p.delay(order)
+	return order, nil
+}
+
+// stop returns the stop price of a trailing stop
+func (t *trailingStop) stop(side model.SideType) *float64 {
+	stop := t.Extreme * (1 - t.Callback)
+	if side == model.SideTypeBuy {
+		stop = t.Extreme * (1 + t.Callback)
+	}
+	return &stop
+}
+
+// trailingTriggered returns true when a candle crosses the stop of an active trailing stop
+func (p *PaperWallet) trailingTriggered(order model.Order, candle model.Candle) bool {
+	trailing, ok := p.trailing[order.ExchangeID]
+	if !ok || !trailing.Active || order.Stop == nil {
+		return false
+	}
+	if order.Side == model.SideTypeBuy {
+		return candle.High >= *order.Stop || candle.Close >= *order.Stop
+	}
+	return (candle.Low > 0 && candle.Low <= *order.Stop) || candle.Close <= *order.Stop
+}
+
+// stepTrailingStops activates the open trailing stops of a pair and moves their stops with the candle,
+// after the candle fills, so a stop is only triggered by the following candles
+func (p *PaperWallet) stepTrailingStops(candle model.Candle) {
+	high, low := candle.High, candle.Low
+	if high == 0 {
+		high = candle.Close
+	}
+	if low == 0 {
+		low = candle.Close
+	}
+
+	for i, order := range p.orders {
+		trailing, ok := p.trailing[order.ExchangeID]
+		if !ok || order.Pair != candle.Pair {
+			continue
+		}
+		if order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled {
+			delete(p.trailing, order.ExchangeID)
+			continue
+		}
+
+		if !trailing.Active {
+			if (order.Side == model.SideTypeSell && high < order.Price) ||
+				(order.Side == model.SideTypeBuy && low > order.Price) {
+				continue
+			}
+			trailing.Active = true
+			trailing.Extreme = order.Price
+		}
+
+		if order.Side == model.SideTypeSell {
+			trailing.Extreme = math.Max(trailing.Extreme, high)
+		} else {
+			trailing.Extreme = math.Min(trailing.Extreme, low)
+		}
+		p.orders[i].Stop = trailing.stop(order.Side)
+	}
+}
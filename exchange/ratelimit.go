@@ -0,0 +1,155 @@
+package exchange
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/tools/clock"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// Default request weight per minute of Binance REST APIs, by IP
+const (
+	binanceWeightLimit       = 6000
+	binanceFutureWeightLimit = 2400
+
+	// rateLimitThreshold is the fraction of the weight limit used before throttling the requests
+	rateLimitThreshold = 0.9
+
+	// rateLimitRetryAfter is the ban duration when a 429/418 response has no Retry-After header
+	rateLimitRetryAfter = time.Minute
+)
+
+// RateLimitUsage is the usage of the API limits, reported by the headers of the last response
+type RateLimitUsage struct {
+	Weight      int
+	WeightLimit int
+	Orders10s   int
+	Orders1m    int
+	Time        time.Time
+
+	// RetryAt is set when the API rejected requests (429) or banned the IP (418)
+	RetryAt time.Time
+}
+
+// RateLimitHook receives the usage of the API limits after each response, eg: to export metrics.
+// It is called synchronously by the HTTP client, so it must not block.
+type RateLimitHook func(usage RateLimitUsage)
+
+// rateLimiter is a http.RoundTripper that tracks the used weight of Binance APIs and delays the requests
+// before reaching the limit of the current minute, avoiding 429 responses and IP bans (418).
+type rateLimiter struct {
+	transport http.RoundTripper
+	clock     clock.Clock
+	sleep     func(req *http.Request, d time.Duration) error
+	limit     int
+	hook      RateLimitHook
+
+	mtx     sync.Mutex
+	weight  int
+	window  time.Time
+	retryAt time.Time
+}
+
+func newRateLimiter(limit int, hook RateLimitHook) *rateLimiter {
+	return &rateLimiter{
+		transport: http.DefaultTransport,
+		clock:     clock.Wall(),
+		sleep:     sleepRequest,
+		limit:     limit,
+		hook:      hook,
+	}
+}
+
+// sleepRequest waits for a duration or until the request is canceled
+func sleepRequest(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// delay returns the time to wait before sending a new request
+func (r *rateLimiter) delay() time.Duration {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	now := r.clock.Now()
+	if now.Before(r.retryAt) {
+		return r.retryAt.Sub(now)
+	}
+
+	window := now.Truncate(time.Minute)
+	if !window.Equal(r.window) {
+		r.window = window
+		r.weight = 0
+	}
+
+	if r.limit > 0 && float64(r.weight) >= float64(r.limit)*rateLimitThreshold {
+		return window.Add(time.Minute).Sub(now)
+	}
+
+	return 0
+}
+
+func (r *rateLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if delay := r.delay(); delay > 0 {
+		log.Warnf("[RATE LIMIT] request weight near the limit, waiting %s", delay)
+		if err := r.sleep(req, delay); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	r.update(response)
+	return response, nil
+}
+
+// RetryAt returns when requests are allowed again after a 429 or 418 response
+func (r *rateLimiter) RetryAt() time.Time {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.retryAt
+}
+
+// update reads the usage headers of a response, the weight is the total of the current minute
+func (r *rateLimiter) update(response *http.Response) {
+	r.mtx.Lock()
+
+	now := r.clock.Now()
+	usage := RateLimitUsage{WeightLimit: r.limit, Time: now}
+	usage.Orders10s, _ = strconv.Atoi(response.Header.Get("X-Mbx-Order-Count-10s"))
+	usage.Orders1m, _ = strconv.Atoi(response.Header.Get("X-Mbx-Order-Count-1m"))
+	if weight, err := strconv.Atoi(response.Header.Get("X-Mbx-Used-Weight-1m")); err == nil {
+		r.window = now.Truncate(time.Minute)
+		r.weight = weight
+	}
+	usage.Weight = r.weight
+
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusTeapot {
+		retryAfter := rateLimitRetryAfter
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			retryAfter = time.Duration(seconds) * time.Second
+		}
+		r.retryAt = now.Add(retryAfter)
+		log.Errorf("[RATE LIMIT] API limit exceeded (%d), retrying after %s", response.StatusCode, retryAfter)
+	}
+	usage.RetryAt = r.retryAt
+
+	r.mtx.Unlock()
+
+	if r.hook != nil {
+		r.hook(usage)
+	}
+}
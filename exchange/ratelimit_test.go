@@ -0,0 +1,82 @@
+package exchange
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/tools/clock"
+)
+
+func TestRateLimiter(t *testing.T) {
+	weight := 0
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		weight += 100
+		w.Header().Set("X-Mbx-Used-Weight-1m", strconv.Itoa(weight))
+		w.Header().Set("X-Mbx-Order-Count-10s", "2")
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "30")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	var usage RateLimitUsage
+	start := time.Date(2022, 1, 1, 0, 0, 10, 0, time.UTC)
+	simulated := clock.NewSimulated(start)
+	var delays []time.Duration
+
+	limiter := newRateLimiter(250, func(u RateLimitUsage) {
+		usage = u
+	})
+	limiter.clock = simulated
+	limiter.sleep = func(_ *http.Request, d time.Duration) error {
+		delays = append(delays, d)
+		simulated.Advance(d)
+		return nil
+	}
+	client := &http.Client{Transport: limiter}
+
+	get := func() {
+		response, err := client.Get(server.URL)
+		require.NoError(t, err)
+		require.NoError(t, response.Body.Close())
+	}
+
+	t.Run("weight tracking", func(t *testing.T) {
+		get()
+		get()
+		require.Empty(t, delays)
+		require.Equal(t, 200, usage.Weight)
+		require.Equal(t, 250, usage.WeightLimit)
+		require.Equal(t, 2, usage.Orders10s)
+	})
+
+	t.Run("throttle near the limit", func(t *testing.T) {
+		// 200 of 250 is below the threshold (225), the next request reaches it
+		get()
+		require.Empty(t, delays)
+
+		weight = 0
+		get()
+		require.Equal(t, []time.Duration{50 * time.Second}, delays)
+		require.Equal(t, 100, usage.Weight)
+		require.Equal(t, start.Add(50*time.Second), usage.Time)
+	})
+
+	t.Run("retry after 429", func(t *testing.T) {
+		delays = nil
+		status = http.StatusTooManyRequests
+		get()
+		require.Equal(t, simulated.Now().Add(30*time.Second), usage.RetryAt)
+
+		status = http.StatusOK
+		get()
+		require.Equal(t, []time.Duration{30 * time.Second}, delays)
+	})
+}
@@ -0,0 +1,257 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/xhit/go-str2duration/v2"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+var ErrInvalidTimeframe = errors.New("invalid timeframe")
+
+// resampleAnchor is the origin of resampled periods, a Monday at midnight UTC, so weekly candles start on
+// Mondays and periods dividing a day start at midnight
+var resampleAnchor = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+// Resampler aggregates the candles of a base timeframe into a higher timeframe, eg: 1m candles into 45m.
+// Partial candles of the base timeframe update the current period, which is complete with its last base candle.
+type Resampler struct {
+	base     time.Duration
+	interval time.Duration
+
+	// period aggregates the complete base candles of the current period
+	period model.Candle
+	closed int
+}
+
+// NewResampler creates a resampler from a base timeframe to a multiple of it, eg: NewResampler("1m", "45m")
+func NewResampler(base, timeframe string) (*Resampler, error) {
+	baseInterval, err := str2duration.ParseDuration(base)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTimeframe, base)
+	}
+
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTimeframe, timeframe)
+	}
+
+	if baseInterval <= 0 || interval <= baseInterval || interval%baseInterval != 0 {
+		return nil, fmt.Errorf("%w: %s is not a multiple of %s", ErrInvalidTimeframe, timeframe, base)
+	}
+
+	return &Resampler{base: baseInterval, interval: interval}, nil
+}
+
+// PeriodStart returns the open time of the period of a given time
+func (r *Resampler) PeriodStart(t time.Time) time.Time {
+	return resampleAnchor.Add(t.Sub(resampleAnchor) / r.interval * r.interval).In(t.Location())
+}
+
+// Update aggregates a candle of the base timeframe and returns the updated candles of the higher timeframe.
+// When the last base candle of a period is missing, the period is returned as complete with the first
+// candle of the next period. Candles before the current period are ignored.
+func (r *Resampler) Update(candle model.Candle) []model.Candle {
+	start := r.PeriodStart(candle.Time)
+	candles := make([]model.Candle, 0, 2)
+
+	if r.closed > 0 {
+		switch {
+		case start.Before(r.period.Time):
+			return nil
+		case start.After(r.period.Time):
+			previous := r.period
+			previous.Complete = true
+			candles = append(candles, previous)
+			r.closed = 0
+		}
+	}
+
+	current := candle
+	current.Time = start
+	if r.closed > 0 {
+		current = mergeCandles(r.period, candle)
+	}
+	current.Complete = candle.Complete && !candle.Time.Add(r.base).Before(start.Add(r.interval))
+
+	switch {
+	case current.Complete:
+		r.closed = 0
+	case candle.Complete:
+		r.period = current
+		r.closed++
+	}
+
+	return append(candles, current)
+}
+
+// mergeCandles updates the candle of a period with a newer candle
+func mergeCandles(period, candle model.Candle) model.Candle {
+	period.UpdatedAt = candle.UpdatedAt
+	period.High = math.Max(period.High, candle.High)
+	period.Low = math.Min(period.Low, candle.Low)
+	period.Close = candle.Close
+	period.Volume += candle.Volume
+	period.Metadata = candle.Metadata
+	return period
+}
+
+// ResampledFeeder is a feeder that builds timeframes not offered by an exchange, eg: 3m, 45m or weekly candles
+// anchored to Monday, aggregating candles of a base timeframe locally. Other timeframes and methods are served
+// by the inner feeder.
+type ResampledFeeder struct {
+	service.Feeder
+	base       string
+	timeframes map[string]bool
+	now        func() time.Time
+}
+
+// NewResampledFeeder wraps a feeder, resampling the given timeframes from a base timeframe,
+// eg: NewResampledFeeder(binance, "1m", "3m", "45m")
+func NewResampledFeeder(inner service.Feeder, base string, timeframes ...string) (*ResampledFeeder, error) {
+	feeder := &ResampledFeeder{
+		Feeder:     inner,
+		base:       base,
+		timeframes: make(map[string]bool),
+		now:        time.Now,
+	}
+
+	for _, timeframe := range timeframes {
+		if _, err := NewResampler(base, timeframe); err != nil {
+			return nil, err
+		}
+		feeder.timeframes[timeframe] = true
+	}
+	return feeder, nil
+}
+
+// resampler returns a new resampler of a timeframe, or false if the timeframe is served by the inner feeder
+func (r *ResampledFeeder) resampler(timeframe string) (*Resampler, bool) {
+	if !r.timeframes[timeframe] {
+		return nil, false
+	}
+	resampler, err := NewResampler(r.base, timeframe)
+	return resampler, err == nil
+}
+
+// resample aggregates base candles, returning a candle per period
+func resample(resampler *Resampler, base []model.Candle) []model.Candle {
+	candles := make([]model.Candle, 0)
+	for _, candle := range base {
+		for _, updated := range resampler.Update(candle) {
+			last := len(candles) - 1
+			if last >= 0 && candles[last].Time.Equal(updated.Time) {
+				candles[last] = updated
+				continue
+			}
+			candles = append(candles, updated)
+		}
+	}
+	return candles
+}
+
+func (r *ResampledFeeder) CandlesByPeriod(ctx context.Context, pair, timeframe string,
+	start, end time.Time) ([]model.Candle, error) {
+
+	resampler, ok := r.resampler(timeframe)
+	if !ok {
+		return r.Feeder.CandlesByPeriod(ctx, pair, timeframe, start, end)
+	}
+
+	base, err := r.Feeder.CandlesByPeriod(ctx, pair, r.base, resampler.PeriodStart(start), end)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0)
+	for _, candle := range resample(resampler, base) {
+		if candle.Time.Before(start) || candle.Time.After(end) {
+			continue
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// CandlesByLimit returns the last complete candles, resampled timeframes are built from the base
+// candles of the period
+func (r *ResampledFeeder) CandlesByLimit(ctx context.Context, pair, timeframe string,
+	limit int) ([]model.Candle, error) {
+
+	resampler, ok := r.resampler(timeframe)
+	if !ok {
+		return r.Feeder.CandlesByLimit(ctx, pair, timeframe, limit)
+	}
+
+	end := r.now()
+	start := resampler.PeriodStart(end).Add(-time.Duration(limit) * resampler.interval)
+	base, err := r.Feeder.CandlesByPeriod(ctx, pair, r.base, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	candles := make([]model.Candle, 0, limit)
+	for _, candle := range resample(resampler, base) {
+		if candle.Complete {
+			candles = append(candles, candle)
+		}
+	}
+	if len(candles) > limit {
+		candles = candles[len(candles)-limit:]
+	}
+	return candles, nil
+}
+
+// CandlesSubscription streams the candles of a timeframe, resampled timeframes are updated with each
+// candle of the base timeframe
+func (r *ResampledFeeder) CandlesSubscription(ctx context.Context, pair,
+	timeframe string) (chan model.Candle, chan error) {
+
+	resampler, ok := r.resampler(timeframe)
+	if !ok {
+		return r.Feeder.CandlesSubscription(ctx, pair, timeframe)
+	}
+
+	base, errs := r.Feeder.CandlesSubscription(ctx, pair, r.base)
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cerr)
+		defer close(ccandle)
+
+		for {
+			select {
+			case candle, ok := <-base:
+				if !ok {
+					return
+				}
+				for _, updated := range resampler.Update(candle) {
+					select {
+					case ccandle <- updated:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				select {
+				case cerr <- err:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ccandle, cerr
+}
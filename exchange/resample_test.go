@@ -0,0 +1,165 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+// streamFeeder streams a fixed list of candles
+type streamFeeder struct {
+	service.Feeder
+	candles []model.Candle
+}
+
+func (s streamFeeder) CandlesSubscription(_ context.Context, _, _ string) (chan model.Candle, chan error) {
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	go func() {
+		defer close(cerr)
+		defer close(ccandle)
+		for _, candle := range s.candles {
+			ccandle <- candle
+		}
+	}()
+	return ccandle, cerr
+}
+
+func minuteCandles(start time.Time, closes ...float64) []model.Candle {
+	candles := make([]model.Candle, 0, len(closes))
+	for i, price := range closes {
+		t := start.Add(time.Duration(i) * time.Minute)
+		candles = append(candles, model.Candle{Pair: "BTCUSDT", Time: t, UpdatedAt: t, Open: price, Close: price,
+			High: price + 1, Low: price - 1, Volume: 1, Complete: true})
+	}
+	return candles
+}
+
+func TestNewResampler(t *testing.T) {
+	_, err := NewResampler("1m", "45m")
+	require.NoError(t, err)
+
+	_, err = NewResampler("1m", "1m")
+	require.ErrorIs(t, err, ErrInvalidTimeframe)
+
+	_, err = NewResampler("2m", "45m")
+	require.ErrorIs(t, err, ErrInvalidTimeframe)
+
+	_, err = NewResampler("1m", "invalid")
+	require.ErrorIs(t, err, ErrInvalidTimeframe)
+
+	// weekly candles start on Monday
+	resampler, err := NewResampler("1h", "1w")
+	require.NoError(t, err)
+	sunday := time.Date(2022, 1, 9, 23, 0, 0, 0, time.UTC)
+	require.Equal(t, time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC), resampler.PeriodStart(sunday))
+	require.Equal(t, time.Monday, resampler.PeriodStart(sunday).Weekday())
+
+	resampler, err = NewResampler("1m", "45m")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 1, 1, 0, 45, 0, 0, time.UTC),
+		resampler.PeriodStart(time.Date(2022, 1, 1, 1, 29, 0, 0, time.UTC)))
+}
+
+func TestResampler_Update(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	resampler, err := NewResampler("1m", "3m")
+	require.NoError(t, err)
+
+	candles := minuteCandles(start, 10, 11, 12, 13, 14)
+	updated := resampler.Update(candles[0])
+	require.Len(t, updated, 1)
+	require.False(t, updated[0].Complete)
+
+	// partial base candles update the period without changing it
+	partial := candles[1]
+	partial.Complete = false
+	partial.Close = 20
+	partial.High = 25
+	updated = resampler.Update(partial)
+	require.Equal(t, 20.0, updated[0].Close)
+	require.Equal(t, 25.0, updated[0].High)
+	require.False(t, updated[0].Complete)
+
+	resampler.Update(candles[1])
+	updated = resampler.Update(candles[2])
+	require.Equal(t, []model.Candle{{Pair: "BTCUSDT", Time: start, UpdatedAt: candles[2].Time, Open: 10, Close: 12,
+		High: 13, Low: 9, Volume: 3, Complete: true}}, updated)
+
+	// the period without its last candle is completed by the next period
+	resampler.Update(candles[3])
+	updated = resampler.Update(minuteCandles(start.Add(6*time.Minute), 16)[0])
+	require.Len(t, updated, 2)
+	require.Equal(t, start.Add(3*time.Minute), updated[0].Time)
+	require.True(t, updated[0].Complete)
+	require.Equal(t, 13.0, updated[0].Close)
+	require.Equal(t, start.Add(6*time.Minute), updated[1].Time)
+	require.False(t, updated[1].Complete)
+
+	// late candles are ignored
+	require.Empty(t, resampler.Update(candles[4]))
+}
+
+func TestResampledFeeder(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	base := minuteCandles(start, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10)
+	source := CandleSourceFunc(func(_ context.Context, _, timeframe string, from, to time.Time) ([]model.Candle,
+		error) {
+		require.Equal(t, "1m", timeframe)
+		candles := make([]model.Candle, 0)
+		for _, candle := range base {
+			if !candle.Time.Before(from) && !candle.Time.After(to) {
+				candles = append(candles, candle)
+			}
+		}
+		return candles, nil
+	})
+
+	_, err := NewResampledFeeder(NewCustomFeed(source), "1m", "7s")
+	require.ErrorIs(t, err, ErrInvalidTimeframe)
+
+	feeder, err := NewResampledFeeder(streamFeeder{Feeder: NewCustomFeed(source), candles: base}, "1m", "3m")
+	require.NoError(t, err)
+	feeder.now = func() time.Time {
+		return start.Add(10 * time.Minute)
+	}
+
+	t.Run("by period", func(t *testing.T) {
+		candles, err := feeder.CandlesByPeriod(context.Background(), "BTCUSDT", "3m", start.Add(time.Minute),
+			start.Add(9*time.Minute))
+		require.NoError(t, err)
+		require.Len(t, candles, 3)
+		require.Equal(t, start.Add(3*time.Minute), candles[0].Time)
+		require.Equal(t, 4.0, candles[0].Open)
+		require.Equal(t, 6.0, candles[0].Close)
+		require.Equal(t, 10.0, candles[2].Close)
+		require.False(t, candles[2].Complete)
+	})
+
+	t.Run("by limit", func(t *testing.T) {
+		candles, err := feeder.CandlesByLimit(context.Background(), "BTCUSDT", "3m", 2)
+		require.NoError(t, err)
+		require.Len(t, candles, 2)
+		require.Equal(t, start.Add(3*time.Minute), candles[0].Time)
+		require.Equal(t, 9.0, candles[1].Close)
+		require.True(t, candles[1].Complete)
+	})
+
+	t.Run("subscription", func(t *testing.T) {
+		candles, errs := feeder.CandlesSubscription(context.Background(), "BTCUSDT", "3m")
+		complete := make([]float64, 0)
+		for candle := range candles {
+			if candle.Complete {
+				complete = append(complete, candle.Close)
+			}
+		}
+		require.Equal(t, []float64{3, 6, 9}, complete)
+		for range errs {
+		}
+	})
+}
@@ -0,0 +1,494 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/tools/clock"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// Binance error codes of rate limits: too many requests or IP banned, and too many new orders
+const (
+	ErrTooManyRequests int64 = -1003
+	ErrTooManyOrders   int64 = -1015
+)
+
+// defaultCoolDown is the cool-down duration when the exchange does not inform when requests are allowed again
+const defaultCoolDown = time.Minute
+
+var (
+	// ErrRateLimited can be wrapped by exchanges to signal a rate limit or ban, starting a cool-down
+	ErrRateLimited = errors.New("exchange rate limit exceeded")
+	// ErrCoolDown is returned by account queries during a cool-down, without sending requests to the exchange
+	ErrCoolDown = errors.New("exchange in cool-down")
+
+	binanceBannedUntil = regexp.MustCompile(`banned until (\d+)`)
+)
+
+// RateLimitClassifier returns the duration of the cool-down required by an error, or false when the error
+// is not a rate limit
+type RateLimitClassifier func(err error) (time.Duration, bool)
+
+// retryScheduler is an exchange that knows when requests are allowed again, eg: from Retry-After headers
+type retryScheduler interface {
+	RetryAt() time.Time
+}
+
+// Resilient is an exchange that survives rate limits and IP bans (eg: Binance -1003 and -1015 errors).
+// When a ban is detected, it enters a cool-down state until the Retry-After window: new orders and
+// cancellations are queued and sent after the cool-down, candle requests are paused, and account queries
+// fail with ErrCoolDown without extending the ban. The notifier is alerted when the cool-down starts and ends.
+type Resilient struct {
+	service.Exchange
+	ctx      context.Context
+	clock    clock.Clock
+	classify RateLimitClassifier
+	sleep    func(ctx context.Context, d time.Duration) error
+
+	mtx      sync.Mutex
+	until    time.Time
+	notifier service.Notifier
+
+	// queue serializes order requests, so pending orders are sent in sequence after a cool-down
+	queue sync.Mutex
+}
+
+type ResilientOption func(*Resilient)
+
+// WithRateLimitClassifier sets the detection of rate limit errors, by default Binance bans
+// and errors wrapping ErrRateLimited are detected
+func WithRateLimitClassifier(classify RateLimitClassifier) ResilientOption {
+	return func(r *Resilient) {
+		r.classify = classify
+	}
+}
+
+// WithResilientNotifier sets the notifier of cool-down alerts
+func WithResilientNotifier(notifier service.Notifier) ResilientOption {
+	return func(r *Resilient) {
+		r.notifier = notifier
+	}
+}
+
+// NewResilient wraps an exchange with the cool-down of rate limits, until the context is done
+func NewResilient(ctx context.Context, exchange service.Exchange, options ...ResilientOption) *Resilient {
+	resilient := &Resilient{
+		Exchange: exchange,
+		ctx:      ctx,
+		clock:    clock.Wall(),
+		classify: rateLimitDuration,
+		sleep:    sleepContext,
+	}
+
+	for _, option := range options {
+		option(resilient)
+	}
+
+	return resilient
+}
+
+// SetNotifier sets the notifier of cool-down alerts, it may be called after the exchange is in use
+func (r *Resilient) SetNotifier(notifier service.Notifier) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.notifier = notifier
+}
+
+// CoolingDown returns the end of the current cool-down, or false when requests are allowed
+func (r *Resilient) CoolingDown() (time.Time, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.until, r.clock.Now().Before(r.until)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimitDuration detects Binance rate limits and bans, which inform the end of the ban in the message,
+// and errors wrapping ErrRateLimited
+func rateLimitDuration(err error) (time.Duration, bool) {
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) && (apiErr.Code == ErrTooManyRequests || apiErr.Code == ErrTooManyOrders) {
+		if match := binanceBannedUntil.FindStringSubmatch(apiErr.Message); match != nil {
+			until, _ := strconv.ParseInt(match[1], 10, 64)
+			return time.Until(time.UnixMilli(until)), true
+		}
+		return defaultCoolDown, true
+	}
+
+	if errors.Is(err, ErrRateLimited) {
+		return defaultCoolDown, true
+	}
+
+	return 0, false
+}
+
+func (r *Resilient) notify(message string) {
+	r.mtx.Lock()
+	notifier := r.notifier
+	r.mtx.Unlock()
+
+	log.Warn(message)
+	if notifier != nil {
+		notifier.Notify(message)
+	}
+}
+
+// check starts a cool-down when the error is a rate limit, returning true
+func (r *Resilient) check(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	duration, ok := r.classify(err)
+	if !ok {
+		return false
+	}
+
+	// the Retry-After header has priority over the default duration
+	if scheduler, ok := r.Exchange.(retryScheduler); ok {
+		if retry := clock.Since(r.clock, scheduler.RetryAt()); retry < 0 && -retry > duration {
+			duration = -retry
+		}
+	}
+	if duration < time.Second {
+		duration = time.Second
+	}
+
+	r.mtx.Lock()
+	until := r.clock.Now().Add(duration)
+	started := !r.clock.Now().Before(r.until)
+	if until.After(r.until) {
+		r.until = until
+	}
+	until = r.until
+	r.mtx.Unlock()
+
+	if started {
+		r.notify(fmt.Sprintf("[COOL DOWN] rate limit exceeded: %v, requests paused until %s",
+			err, until.Format(time.RFC3339)))
+	}
+	return true
+}
+
+// wait blocks until the end of the cool-down, notifying the resume once
+func (r *Resilient) wait(ctx context.Context) error {
+	waited := false
+	for {
+		until, cooling := r.CoolingDown()
+		if !cooling {
+			break
+		}
+
+		waited = true
+		if err := r.sleep(ctx, until.Sub(r.clock.Now())); err != nil {
+			return err
+		}
+	}
+
+	if waited {
+		r.mtx.Lock()
+		// only the first waiting request notifies the resume
+		resumed := !r.until.IsZero()
+		r.until = time.Time{}
+		r.mtx.Unlock()
+
+		if resumed {
+			r.notify("[COOL DOWN] rate limit cool-down finished, requests resumed")
+		}
+	}
+	return nil
+}
+
+// retry executes a request after the cool-down, and again after each rate limit error
+func (r *Resilient) retry(ctx context.Context, request func() error) error {
+	for {
+		if err := r.wait(ctx); err != nil {
+			return err
+		}
+
+		err := request()
+		if !r.check(err) {
+			return err
+		}
+	}
+}
+
+// order queues an order request until the end of the cool-down
+func (r *Resilient) order(request func() error) error {
+	r.queue.Lock()
+	defer r.queue.Unlock()
+	return r.retry(r.ctx, request)
+}
+
+// query fails fast during a cool-down, since queries are usually repeated by polling
+func (r *Resilient) query(request func() error) error {
+	if until, cooling := r.CoolingDown(); cooling {
+		return fmt.Errorf("%w: until %s", ErrCoolDown, until.Format(time.RFC3339))
+	}
+
+	err := request()
+	r.check(err)
+	return err
+}
+
+func (r *Resilient) Account() (account model.Account, err error) {
+	err = r.query(func() error {
+		account, err = r.Exchange.Account()
+		return err
+	})
+	return account, err
+}
+
+func (r *Resilient) Position(pair string) (asset, quote float64, err error) {
+	err = r.query(func() error {
+		asset, quote, err = r.Exchange.Position(pair)
+		return err
+	})
+	return asset, quote, err
+}
+
+func (r *Resilient) PositionRisk(pair string) (risk model.PositionRisk, err error) {
+	err = r.query(func() error {
+		risk, err = r.Exchange.PositionRisk(pair)
+		return err
+	})
+	return risk, err
+}
+
+func (r *Resilient) Order(pair string, id int64) (order model.Order, err error) {
+	err = r.query(func() error {
+		order, err = r.Exchange.Order(pair, id)
+		return err
+	})
+	return order, err
+}
+
+func (r *Resilient) OpenOrders(pair string) (orders []model.Order, err error) {
+	err = r.query(func() error {
+		orders, err = r.Exchange.OpenOrders(pair)
+		return err
+	})
+	return orders, err
+}
+
+func (r *Resilient) CreateOrderOCO(side model.SideType, pair string,
+	size, price, stop, stopLimit float64) (orders []model.Order, err error) {
+	err = r.order(func() error {
+		orders, err = r.Exchange.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+		return err
+	})
+	return orders, err
+}
+
+// CreateOrderOCORequest queues an OCO order, with the client order IDs of its legs when supported by the exchange
+func (r *Resilient) CreateOrderOCORequest(limit, stop model.OrderRequest) (orders []model.Order, err error) {
+	err = r.order(func() error {
+		if broker, ok := r.Exchange.(service.ClientOCOBroker); ok {
+			orders, err = broker.CreateOrderOCORequest(limit, stop)
+		} else {
+			orders, err = placeOCORequest(r.Exchange, limit, stop)
+		}
+		return err
+	})
+	return orders, err
+}
+
+// EmulatedOCO checks if the wrapped exchange emulates OCO orders
+func (r *Resilient) EmulatedOCO(pair string) bool {
+	broker, ok := r.Exchange.(service.EmulatedOCOBroker)
+	return ok && broker.EmulatedOCO(pair)
+}
+
+func (r *Resilient) CreateOrderLimit(side model.SideType, pair string, size float64,
+	limit float64) (order model.Order, err error) {
+	err = r.order(func() error {
+		order, err = r.Exchange.CreateOrderLimit(side, pair, size, limit)
+		return err
+	})
+	return order, err
+}
+
+// CreateOrderLimitTIF creates a limit order with a time in force, GTC orders are accepted by any exchange
+func (r *Resilient) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForceType) (order model.Order, err error) {
+	broker, ok := r.Exchange.(service.TimeInForceBroker)
+	if !ok {
+		if timeInForce == "" || timeInForce == model.TimeInForceGTC {
+			return r.CreateOrderLimit(side, pair, size, limit)
+		}
+		return model.Order{}, fmt.Errorf("%w: time in force %s", ErrUnsupportedOrder, timeInForce)
+	}
+
+	err = r.order(func() error {
+		order, err = broker.CreateOrderLimitTIF(side, pair, size, limit, timeInForce)
+		return err
+	})
+	return order, err
+}
+
+// CreateOrderLimitOptions creates a limit order with advanced options, when supported by the exchange
+func (r *Resilient) CreateOrderLimitOptions(side model.SideType, pair string, size, limit float64,
+	options model.OrderOptions) (order model.Order, err error) {
+	broker, ok := r.Exchange.(service.OrderOptionsBroker)
+	if !ok {
+		if options.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: iceberg order", ErrUnsupportedOrder)
+		}
+		return r.CreateOrderLimitTIF(side, pair, size, limit, options.TimeInForce)
+	}
+
+	err = r.order(func() error {
+		order, err = broker.CreateOrderLimitOptions(side, pair, size, limit, options)
+		return err
+	})
+	return order, err
+}
+
+// CreateOrderRequest queues an order request, with its client order ID when supported by the exchange
+func (r *Resilient) CreateOrderRequest(request model.OrderRequest) (order model.Order, err error) {
+	err = r.order(func() error {
+		if broker, ok := r.Exchange.(service.ClientOrderBroker); ok {
+			order, err = broker.CreateOrderRequest(request)
+		} else {
+			order, err = placeRequest(r.Exchange, request)
+		}
+		return err
+	})
+	return order, err
+}
+
+// OrderByClientID finds an order by its client order ID, when supported by the exchange
+func (r *Resilient) OrderByClientID(pair, clientOrderID string) (order model.Order, err error) {
+	broker, ok := r.Exchange.(service.ClientOrderBroker)
+	if !ok {
+		return model.Order{}, fmt.Errorf("%w: client order ID", ErrUnsupportedOrder)
+	}
+
+	err = r.query(func() error {
+		order, err = broker.OrderByClientID(pair, clientOrderID)
+		return err
+	})
+	return order, err
+}
+
+func (r *Resilient) CreateOrderMarket(side model.SideType, pair string, size float64,
+	reduceOnly bool) (order model.Order, err error) {
+	err = r.order(func() error {
+		order, err = r.Exchange.CreateOrderMarket(side, pair, size, reduceOnly)
+		return err
+	})
+	return order, err
+}
+
+func (r *Resilient) CreateOrderMarketQuote(side model.SideType, pair string,
+	quote float64) (order model.Order, err error) {
+	err = r.order(func() error {
+		order, err = r.Exchange.CreateOrderMarketQuote(side, pair, quote)
+		return err
+	})
+	return order, err
+}
+
+func (r *Resilient) CreateOrderStop(pair string, quantity float64, limit float64) (order model.Order, err error) {
+	err = r.order(func() error {
+		order, err = r.Exchange.CreateOrderStop(pair, quantity, limit)
+		return err
+	})
+	return order, err
+}
+
+// CreateOrderTrailingStop creates a trailing stop order, when supported by the exchange
+func (r *Resilient) CreateOrderTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64) (order model.Order, err error) {
+	broker, ok := r.Exchange.(service.TrailingStopBroker)
+	if !ok {
+		return model.Order{}, fmt.Errorf("%w: trailing stop", ErrUnsupportedOrder)
+	}
+
+	err = r.order(func() error {
+		order, err = broker.CreateOrderTrailingStop(side, pair, quantity, activation, callbackRate)
+		return err
+	})
+	return order, err
+}
+
+func (r *Resilient) Cancel(order model.Order) error {
+	return r.order(func() error {
+		return r.Exchange.Cancel(order)
+	})
+}
+
+// Amends checks if the wrapped exchange amends the order in place
+func (r *Resilient) Amends(order model.Order) bool {
+	broker, ok := r.Exchange.(service.AmendBroker)
+	return ok && broker.Amends(order)
+}
+
+func (r *Resilient) ModifyOrder(order model.Order, price, quantity float64) (modified model.Order, err error) {
+	err = r.order(func() error {
+		modified, err = r.Exchange.ModifyOrder(order, price, quantity)
+		return err
+	})
+	return modified, err
+}
+
+func (r *Resilient) CancelOpenOrders(pair string) error {
+	return r.order(func() error {
+		return r.Exchange.CancelOpenOrders(pair)
+	})
+}
+
+func (r *Resilient) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (order model.Order, err error) {
+	err = r.order(func() error {
+		order, err = r.Exchange.TakeProfit(side, pair, quantity, limit)
+		return err
+	})
+	return order, err
+}
+
+func (r *Resilient) LastQuote(ctx context.Context, pair string) (quote float64, err error) {
+	err = r.retry(ctx, func() error {
+		quote, err = r.Exchange.LastQuote(ctx, pair)
+		return err
+	})
+	return quote, err
+}
+
+func (r *Resilient) CandlesByPeriod(ctx context.Context, pair, period string,
+	start, end time.Time) (candles []model.Candle, err error) {
+	err = r.retry(ctx, func() error {
+		candles, err = r.Exchange.CandlesByPeriod(ctx, pair, period, start, end)
+		return err
+	})
+	return candles, err
+}
+
+func (r *Resilient) CandlesByLimit(ctx context.Context, pair, period string,
+	limit int) (candles []model.Candle, err error) {
+	err = r.retry(ctx, func() error {
+		candles, err = r.Exchange.CandlesByLimit(ctx, pair, period, limit)
+		return err
+	})
+	return candles, err
+}
@@ -0,0 +1,128 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/clock"
+)
+
+type bannedWallet struct {
+	*PaperWallet
+	err      error
+	failures int
+}
+
+func (b *bannedWallet) CreateOrderMarket(side model.SideType, pair string, size float64,
+	reduceOnly bool) (model.Order, error) {
+	if b.failures > 0 {
+		b.failures--
+		return model.Order{}, b.err
+	}
+	return b.PaperWallet.CreateOrderMarket(side, pair, size, reduceOnly)
+}
+
+func (b *bannedWallet) Account() (model.Account, error) {
+	if b.failures > 0 {
+		b.failures--
+		return model.Account{}, b.err
+	}
+	return b.PaperWallet.Account()
+}
+
+type messageNotifier struct {
+	messages []string
+}
+
+func (n *messageNotifier) Notify(message string) {
+	n.messages = append(n.messages, message)
+}
+
+func (n *messageNotifier) OnOrder(model.Order) {}
+
+func (n *messageNotifier) OnError(error) {}
+
+func TestRateLimitDuration(t *testing.T) {
+	until := time.Now().Add(10 * time.Minute)
+	duration, ok := rateLimitDuration(&common.APIError{
+		Code:    ErrTooManyRequests,
+		Message: fmt.Sprintf("Way too many requests; IP banned until %d.", until.UnixMilli()),
+	})
+	require.True(t, ok)
+	require.InDelta(t, 10*time.Minute, duration, float64(time.Second))
+
+	duration, ok = rateLimitDuration(&common.APIError{Code: ErrTooManyOrders, Message: "Too many new orders"})
+	require.True(t, ok)
+	require.Equal(t, defaultCoolDown, duration)
+
+	_, ok = rateLimitDuration(fmt.Errorf("order: %w", ErrRateLimited))
+	require.True(t, ok)
+
+	_, ok = rateLimitDuration(&common.APIError{Code: -2010, Message: "insufficient balance"})
+	require.False(t, ok)
+}
+
+func TestResilient(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	banned := &bannedWallet{PaperWallet: wallet, err: &common.APIError{Code: ErrTooManyOrders}}
+
+	notifier := &messageNotifier{}
+	simulated := clock.NewSimulated(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	var sleeps []time.Duration
+
+	resilient := NewResilient(context.Background(), banned, WithResilientNotifier(notifier))
+	resilient.clock = simulated
+	resilient.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		simulated.Advance(d)
+		return nil
+	}
+
+	t.Run("order queued after cool-down", func(t *testing.T) {
+		banned.failures = 1
+		order, err := resilient.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, []time.Duration{defaultCoolDown}, sleeps)
+		require.Len(t, notifier.messages, 2)
+		require.Contains(t, notifier.messages[0], "requests paused")
+		require.Contains(t, notifier.messages[1], "requests resumed")
+	})
+
+	t.Run("queries fail fast", func(t *testing.T) {
+		banned.failures = 1
+		_, err := resilient.Account()
+		require.ErrorIs(t, err, banned.err)
+
+		_, cooling := resilient.CoolingDown()
+		require.True(t, cooling)
+
+		_, err = resilient.Account()
+		require.ErrorIs(t, err, ErrCoolDown)
+
+		simulated.Advance(defaultCoolDown)
+		account, err := resilient.Account()
+		require.NoError(t, err)
+		_, quote := account.Balance("BTC", "USDT")
+		require.Equal(t, 900.0, quote.Free)
+	})
+
+	t.Run("canceled wait", func(t *testing.T) {
+		banned.failures = 1
+		_, err := resilient.Account()
+		require.Error(t, err)
+
+		resilient.sleep = sleepContext
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = resilient.CandlesByLimit(ctx, "BTCUSDT", "1m", 1)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
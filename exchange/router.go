@@ -0,0 +1,186 @@
+package exchange
+
+import (
+	"fmt"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+// PairRouter is an exchange that sends the orders of each pair to a given broker, eg: new pairs or
+// strategy variants to a paper wallet, while other pairs are executed in the real exchange.
+// Market data and account information are always provided by the default exchange.
+type PairRouter struct {
+	service.Exchange
+	brokers map[string]service.Broker
+}
+
+type PairRouterOption func(*PairRouter)
+
+// WithPairBroker routes the orders of the given pairs to a broker
+func WithPairBroker(broker service.Broker, pairs ...string) PairRouterOption {
+	return func(router *PairRouter) {
+		for _, pair := range pairs {
+			router.brokers[pair] = broker
+		}
+	}
+}
+
+// NewPairRouter creates a router with a default exchange, used for all pairs without a specific broker
+func NewPairRouter(defaultExchange service.Exchange, options ...PairRouterOption) *PairRouter {
+	router := &PairRouter{
+		Exchange: defaultExchange,
+		brokers:  make(map[string]service.Broker),
+	}
+
+	for _, option := range options {
+		option(router)
+	}
+
+	return router
+}
+
+// Broker returns the broker used to execute orders of a given pair
+func (r *PairRouter) Broker(pair string) service.Broker {
+	if broker, ok := r.brokers[pair]; ok {
+		return broker
+	}
+	return r.Exchange
+}
+
+// Routed returns true if the pair is executed by a specific broker, instead of the default exchange
+func (r *PairRouter) Routed(pair string) bool {
+	_, ok := r.brokers[pair]
+	return ok
+}
+
+func (r *PairRouter) Position(pair string) (asset, quote float64, err error) {
+	return r.Broker(pair).Position(pair)
+}
+
+func (r *PairRouter) PositionRisk(pair string) (model.PositionRisk, error) {
+	return r.Broker(pair).PositionRisk(pair)
+}
+
+func (r *PairRouter) Order(pair string, id int64) (model.Order, error) {
+	return r.Broker(pair).Order(pair, id)
+}
+
+func (r *PairRouter) CreateOrderOCO(side model.SideType, pair string,
+	size, price, stop, stopLimit float64) ([]model.Order, error) {
+	return r.Broker(pair).CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+}
+
+// CreateOrderOCORequest routes an OCO order, the client order IDs are ignored by brokers without them
+func (r *PairRouter) CreateOrderOCORequest(limit, stop model.OrderRequest) ([]model.Order, error) {
+	broker, ok := r.Broker(limit.Pair).(service.ClientOCOBroker)
+	if !ok {
+		return placeOCORequest(r.Broker(limit.Pair), limit, stop)
+	}
+	return broker.CreateOrderOCORequest(limit, stop)
+}
+
+// EmulatedOCO checks if the broker of the pair emulates OCO orders
+func (r *PairRouter) EmulatedOCO(pair string) bool {
+	broker, ok := r.Broker(pair).(service.EmulatedOCOBroker)
+	return ok && broker.EmulatedOCO(pair)
+}
+
+func (r *PairRouter) CreateOrderLimit(side model.SideType, pair string, size float64,
+	limit float64) (model.Order, error) {
+	return r.Broker(pair).CreateOrderLimit(side, pair, size, limit)
+}
+
+// CreateOrderLimitTIF routes a limit order with a time in force, GTC orders are accepted by any broker
+func (r *PairRouter) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForceType) (model.Order, error) {
+	broker, ok := r.Broker(pair).(service.TimeInForceBroker)
+	if !ok {
+		if timeInForce == "" || timeInForce == model.TimeInForceGTC {
+			return r.Broker(pair).CreateOrderLimit(side, pair, size, limit)
+		}
+		return model.Order{}, fmt.Errorf("%w: time in force %s", ErrUnsupportedOrder, timeInForce)
+	}
+	return broker.CreateOrderLimitTIF(side, pair, size, limit, timeInForce)
+}
+
+// CreateOrderLimitOptions routes a limit order with advanced options to a broker that supports them
+func (r *PairRouter) CreateOrderLimitOptions(side model.SideType, pair string, size, limit float64,
+	options model.OrderOptions) (model.Order, error) {
+	broker, ok := r.Broker(pair).(service.OrderOptionsBroker)
+	if !ok {
+		if options.IcebergQuantity > 0 {
+			return model.Order{}, fmt.Errorf("%w: iceberg order", ErrUnsupportedOrder)
+		}
+		return r.CreateOrderLimitTIF(side, pair, size, limit, options.TimeInForce)
+	}
+	return broker.CreateOrderLimitOptions(side, pair, size, limit, options)
+}
+
+func (r *PairRouter) CreateOrderMarket(side model.SideType, pair string, size float64,
+	reduceOnly bool) (model.Order, error) {
+	return r.Broker(pair).CreateOrderMarket(side, pair, size, reduceOnly)
+}
+
+func (r *PairRouter) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	return r.Broker(pair).CreateOrderMarketQuote(side, pair, quote)
+}
+
+func (r *PairRouter) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	return r.Broker(pair).CreateOrderStop(pair, quantity, limit)
+}
+
+// CreateOrderTrailingStop routes a trailing stop order to a broker that supports it
+func (r *PairRouter) CreateOrderTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64) (model.Order, error) {
+	broker, ok := r.Broker(pair).(service.TrailingStopBroker)
+	if !ok {
+		return model.Order{}, fmt.Errorf("%w: trailing stop", ErrUnsupportedOrder)
+	}
+	return broker.CreateOrderTrailingStop(side, pair, quantity, activation, callbackRate)
+}
+
+// CreateOrderRequest routes an order request, the client order ID is ignored by brokers without them
+func (r *PairRouter) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	broker, ok := r.Broker(request.Pair).(service.ClientOrderBroker)
+	if !ok {
+		return placeRequest(r.Broker(request.Pair), request)
+	}
+	return broker.CreateOrderRequest(request)
+}
+
+// OrderByClientID finds an order by its client order ID in the broker of the pair
+func (r *PairRouter) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	broker, ok := r.Broker(pair).(service.ClientOrderBroker)
+	if !ok {
+		return model.Order{}, fmt.Errorf("%w: client order ID", ErrUnsupportedOrder)
+	}
+	return broker.OrderByClientID(pair, clientOrderID)
+}
+
+func (r *PairRouter) Cancel(order model.Order) error {
+	return r.Broker(order.Pair).Cancel(order)
+}
+
+// Amends checks if the broker of the pair amends the order in place
+func (r *PairRouter) Amends(order model.Order) bool {
+	broker, ok := r.Broker(order.Pair).(service.AmendBroker)
+	return ok && broker.Amends(order)
+}
+
+func (r *PairRouter) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	return r.Broker(order.Pair).ModifyOrder(order, price, quantity)
+}
+
+func (r *PairRouter) CancelOpenOrders(pair string) error {
+	return r.Broker(pair).CancelOpenOrders(pair)
+}
+
+func (r *PairRouter) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (model.Order, error) {
+	return r.Broker(pair).TakeProfit(side, pair, quantity, limit)
+}
+
+func (r *PairRouter) OpenOrders(pair string) ([]model.Order, error) {
+	return r.Broker(pair).OpenOrders(pair)
+}
@@ -0,0 +1,42 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestPairRouter(t *testing.T) {
+	ctx := context.Background()
+	live := NewPaperWallet(ctx, "USDT", WithPaperAsset("USDT", 1000))
+	simulated := NewPaperWallet(ctx, "USDT", WithPaperAsset("USDT", 1000))
+
+	router := NewPairRouter(live, WithPairBroker(simulated, "ETHUSDT"))
+	require.True(t, router.Routed("ETHUSDT"))
+	require.False(t, router.Routed("BTCUSDT"))
+
+	for _, wallet := range []*PaperWallet{live, simulated} {
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+		wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 10})
+	}
+
+	_, err := router.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+	_, err = router.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 2, false)
+	require.NoError(t, err)
+
+	asset, _, err := live.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 1.0, asset)
+
+	asset, _, err = live.Position("ETHUSDT")
+	require.NoError(t, err)
+	require.Zero(t, asset)
+
+	asset, _, err = router.Position("ETHUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, asset)
+}
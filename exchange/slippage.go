@@ -0,0 +1,93 @@
+package exchange
+
+import (
+	"math"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// SlippageModel estimates the execution price of market and stop orders in the paper wallet, so backtests
+// reflect execution costs instead of filling at the reference price, see WithPaperSlippage
+type SlippageModel interface {
+	// Price returns the execution price of an order of a quantity, given the reference price:
+	// the candle close for market orders and the stop price for stop orders
+	Price(side model.SideType, price, quantity float64, candle model.Candle) float64
+}
+
+// slip moves a price against the side of an order by a number of basis points
+func slip(side model.SideType, price, bps float64) float64 {
+	if side == model.SideTypeSell {
+		return price * (1 - bps/10000)
+	}
+	return price * (1 + bps/10000)
+}
+
+// FixedSlippage fills orders at a fixed number of basis points from the reference price, eg: 5 = 0.05%
+type FixedSlippage struct {
+	BPS float64
+}
+
+func (s FixedSlippage) Price(side model.SideType, price, _ float64, _ model.Candle) float64 {
+	return slip(side, price, s.BPS)
+}
+
+// VolumeSlippage fills orders with a price impact proportional to their share of the candle volume,
+// eg: with an Impact of 0.1 an order of 1% of the volume slips 0.1%. Impact is limited by MaxBPS, when set,
+// and candles without volume have no impact.
+type VolumeSlippage struct {
+	Impact float64
+	MaxBPS float64
+}
+
+func (s VolumeSlippage) Price(side model.SideType, price, quantity float64, candle model.Candle) float64 {
+	if candle.Volume <= 0 {
+		return price
+	}
+
+	bps := s.Impact * quantity / candle.Volume * 10000
+	if s.MaxBPS > 0 {
+		bps = math.Min(bps, s.MaxBPS)
+	}
+	return slip(side, price, bps)
+}
+
+// SpreadSlippage fills orders crossing half of the bid-ask spread, given in basis points. When the spread
+// is zero, it is estimated as a fraction of the candle range, given by RangeRatio.
+type SpreadSlippage struct {
+	BPS        float64
+	RangeRatio float64
+}
+
+func (s SpreadSlippage) Price(side model.SideType, price, _ float64, candle model.Candle) float64 {
+	spread := s.BPS
+	if spread == 0 && candle.Close > 0 {
+		spread = s.RangeRatio * (candle.High - candle.Low) / candle.Close * 10000
+	}
+	return slip(side, price, spread/2)
+}
+
+// WithPaperSlippage fills the market and stop orders of pairs with a slippage model, or the orders of all
+// pairs without a model when no pair is given, eg: WithPaperSlippage(FixedSlippage{BPS: 5})
+func WithPaperSlippage(slippage SlippageModel, pairs ...string) PaperWalletOption {
+	return func(wallet *PaperWallet) {
+		if len(pairs) == 0 {
+			wallet.defaultSlippage = slippage
+			return
+		}
+		for _, pair := range pairs {
+			wallet.slippage[pair] = slippage
+		}
+	}
+}
+
+// executionPrice returns the price of a market or stop order after the slippage of its pair
+func (p *PaperWallet) executionPrice(side model.SideType, pair string, price, quantity float64) float64 {
+	slippage, ok := p.slippage[pair]
+	if !ok {
+		slippage = p.defaultSlippage
+	}
+	if slippage == nil {
+		return price
+	}
+	return slippage.Price(side, price, quantity, p.lastCandle[pair])
+}
@@ -0,0 +1,60 @@
+package exchange
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestSlippageModel(t *testing.T) {
+	candle := model.Candle{Pair: "BTCUSDT", Close: 100, High: 110, Low: 90, Volume: 1000}
+
+	t.Run("fixed", func(t *testing.T) {
+		slippage := FixedSlippage{BPS: 10}
+		require.InDelta(t, 100.1, slippage.Price(model.SideTypeBuy, 100, 1, candle), 1e-9)
+		require.InDelta(t, 99.9, slippage.Price(model.SideTypeSell, 100, 1, candle), 1e-9)
+	})
+
+	t.Run("volume", func(t *testing.T) {
+		slippage := VolumeSlippage{Impact: 0.1, MaxBPS: 50}
+		require.InDelta(t, 100.1, slippage.Price(model.SideTypeBuy, 100, 10, candle), 1e-9)
+		require.InDelta(t, 99.5, slippage.Price(model.SideTypeSell, 100, 500, candle), 1e-9)
+		require.Equal(t, 100.0, slippage.Price(model.SideTypeBuy, 100, 10, model.Candle{Close: 100}))
+	})
+
+	t.Run("spread", func(t *testing.T) {
+		slippage := SpreadSlippage{BPS: 20}
+		require.InDelta(t, 100.1, slippage.Price(model.SideTypeBuy, 100, 1, candle), 1e-9)
+
+		slippage = SpreadSlippage{RangeRatio: 0.01}
+		require.InDelta(t, 99.9, slippage.Price(model.SideTypeSell, 100, 1, candle), 1e-9)
+	})
+}
+
+func TestPaperWallet_Slippage(t *testing.T) {
+	wallet := NewPaperWallet(context.Background(), "USDT", WithPaperAsset("USDT", 1000),
+		WithPaperSlippage(FixedSlippage{BPS: 100}, "BTCUSDT"))
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	order, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+	require.InDelta(t, 101.0, order.Price, 1e-9)
+	require.InDelta(t, 899.0, wallet.assets["USDT"].Free, 1e-9)
+	require.InDelta(t, 101.0, wallet.avgLongPrice["BTCUSDT"], 1e-9)
+
+	// stop orders slip from the stop price
+	_, err = wallet.CreateOrderStop("BTCUSDT", 1, 90)
+	require.NoError(t, err)
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 85, Low: 85, High: 95})
+	require.Equal(t, model.OrderStatusTypeFilled, wallet.orders[1].Status)
+	require.InDelta(t, 899.0+89.1, wallet.assets["USDT"].Free, 1e-9)
+
+	// pairs without a model are filled at the close
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 10})
+	order, err = wallet.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 1, false)
+	require.NoError(t, err)
+	require.Equal(t, 10.0, order.Price)
+}
@@ -0,0 +1,51 @@
+package exchange
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/adshao/go-binance/v2/common"
+)
+
+// Binance error codes of transient failures, where the request may succeed when sent again
+const (
+	ErrDisconnected     int64 = -1001
+	ErrUnknownResponse  int64 = -1006
+	ErrBackendTimeout   int64 = -1007
+	ErrServerOverloaded int64 = -1008
+)
+
+// ErrTransient can be wrapped by exchanges to signal a temporary failure, eg: a timeout or a 5xx response
+var ErrTransient = errors.New("transient exchange error")
+
+// IsTransient returns if a request failed by a temporary condition and can be retried, eg: timeouts,
+// dropped connections, Binance -1001 and -1007 errors, and 5xx responses without an API error.
+// Permanent errors, such as insufficient balance or filter failures, are not transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, ErrTransient) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var apiErr *common.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		// responses with an error status and no API error in the body, eg: 502 pages of a gateway
+		case 0, ErrDisconnected, ErrUnknownResponse, ErrBackendTimeout, ErrServerOverloaded:
+			return true
+		}
+	}
+	return false
+}
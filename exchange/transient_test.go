@@ -0,0 +1,23 @@
+package exchange
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/adshao/go-binance/v2/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransient(t *testing.T) {
+	require.True(t, IsTransient(&common.APIError{Code: ErrDisconnected, Message: "Internal error"}))
+	require.True(t, IsTransient(&common.APIError{Code: ErrBackendTimeout, Message: "Timeout waiting for response"}))
+	require.True(t, IsTransient(&common.APIError{}))
+	require.True(t, IsTransient(fmt.Errorf("order: %w", context.DeadlineExceeded)))
+	require.True(t, IsTransient(fmt.Errorf("order: %w", ErrTransient)))
+
+	require.False(t, IsTransient(nil))
+	require.False(t, IsTransient(&common.APIError{Code: -2010, Message: "insufficient balance"}))
+	require.False(t, IsTransient(&common.APIError{Code: -1013, Message: "Filter failure: LOT_SIZE"}))
+	require.False(t, IsTransient(ErrInsufficientFunds))
+}
@@ -0,0 +1,74 @@
+package exchange
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/tools/supervisor"
+	"github.com/bengalm/ninjabot/tools/watchdog"
+)
+
+// hangingFeeder has a first subscription without messages, until it is canceled
+type hangingFeeder struct {
+	service.Feeder
+	mtx           sync.Mutex
+	subscriptions int
+}
+
+func (h *hangingFeeder) CandlesSubscription(ctx context.Context, pair, _ string) (chan model.Candle, chan error) {
+	h.mtx.Lock()
+	h.subscriptions++
+	first := h.subscriptions == 1
+	h.mtx.Unlock()
+
+	ccandle := make(chan model.Candle)
+	cerr := make(chan error)
+	go func() {
+		defer close(cerr)
+		defer close(ccandle)
+		if !first {
+			select {
+			case ccandle <- model.Candle{Pair: pair, Time: time.Now(), Close: 1, Complete: true}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return ccandle, cerr
+}
+
+func TestDataFeedSubscription_Watchdog(t *testing.T) {
+	feeder := &hangingFeeder{}
+	feed := NewDataFeed(feeder)
+	feed.SetSupervisor(supervisor.New(supervisor.WithBackoff(time.Millisecond, time.Millisecond)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dog := watchdog.New(watchdog.WithInterval(10 * time.Millisecond))
+	dog.Start(ctx)
+	feed.SetWatchdog(dog, 2)
+
+	received := make(chan model.Candle, 1)
+	feed.Subscribe("BTCUSDT", "50ms", func(candle model.Candle) {
+		received <- candle
+	}, true)
+	feed.Start(false)
+
+	select {
+	case candle := <-received:
+		require.Equal(t, 1.0, candle.Close)
+	case <-time.After(2 * time.Second):
+		require.Fail(t, "stale feed not reconnected")
+	}
+
+	feeder.mtx.Lock()
+	defer feeder.mtx.Unlock()
+	require.GreaterOrEqual(t, feeder.subscriptions, 2)
+}
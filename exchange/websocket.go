@@ -0,0 +1,127 @@
+package exchange
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsPingInterval is the interval of the keepalive messages sent by streams that require them
+var wsPingInterval = 20 * time.Second
+
+// wsConn is a websocket connection that accepts messages from stream handlers, eg: to subscribe to
+// private topics after an authentication response
+type wsConn struct {
+	mtx  sync.Mutex
+	conn *websocket.Conn
+}
+
+// send writes a message, strings are sent as text and other values are encoded as JSON
+func (c *wsConn) send(message interface{}) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if text, ok := message.(string); ok {
+		return c.conn.WriteMessage(websocket.TextMessage, []byte(text))
+	}
+	return c.conn.WriteJSON(message)
+}
+
+// wsServe connects to a websocket endpoint and sends each message to the handler, until the connection
+// is closed or stopped. It follows the same contract as the Binance client streams.
+func wsServe(endpoint string, handler func(message []byte),
+	errHandler func(err error)) (doneC, stopC chan struct{}, err error) {
+	return wsServeJSON(endpoint, nil, nil, handler, errHandler)
+}
+
+// wsServeDialer works as wsServe, connecting with a custom dialer, eg: through a proxy
+func wsServeDialer(dialer *websocket.Dialer, endpoint string, handler func(message []byte),
+	errHandler func(err error)) (doneC, stopC chan struct{}, err error) {
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	return wsDial(dialer, endpoint, nil, nil, func(_ *wsConn, message []byte) {
+		handler(message)
+	}, errHandler)
+}
+
+// wsServeJSON connects to a websocket endpoint and sends the given requests, eg: authentication and
+// topic subscriptions, before reading messages as in wsServe. When ping is not nil, it is sent
+// periodically to keep the connection alive.
+func wsServeJSON(endpoint string, requests []interface{}, ping interface{}, handler func(message []byte),
+	errHandler func(err error)) (doneC, stopC chan struct{}, err error) {
+	return wsConnect(endpoint, requests, ping, func(_ *wsConn, message []byte) {
+		handler(message)
+	}, errHandler)
+}
+
+// wsConnect works as wsServeJSON, giving the connection to the handler to reply messages
+func wsConnect(endpoint string, requests []interface{}, ping interface{}, handler func(conn *wsConn, message []byte),
+	errHandler func(err error)) (doneC, stopC chan struct{}, err error) {
+	return wsDial(websocket.DefaultDialer, endpoint, requests, ping, handler, errHandler)
+}
+
+// wsDial works as wsConnect, with a custom dialer
+func wsDial(dialer *websocket.Dialer, endpoint string, requests []interface{}, ping interface{},
+	handler func(conn *wsConn, message []byte), errHandler func(err error)) (doneC, stopC chan struct{}, err error) {
+
+	conn, _, err := dialer.Dial(endpoint, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ws := &wsConn{conn: conn}
+	for _, request := range requests {
+		if err := ws.send(request); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	doneC = make(chan struct{})
+	stopC = make(chan struct{})
+	go func() {
+		defer close(doneC)
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				select {
+				case <-stopC:
+				default:
+					errHandler(err)
+				}
+				return
+			}
+			handler(ws, message)
+		}
+	}()
+
+	go func() {
+		var tick <-chan time.Time
+		if ping != nil {
+			ticker := time.NewTicker(wsPingInterval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-stopC:
+				conn.Close()
+				return
+			case <-doneC:
+				conn.Close()
+				return
+			case <-tick:
+				// the read loop is notified when the connection is closed
+				if err := ws.send(ping); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	return doneC, stopC, nil
+}
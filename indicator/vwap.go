@@ -0,0 +1,38 @@
+package indicator
+
+import (
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// SessionVWAP - volume weighted average price, anchored at the start of each trading day of the session
+func SessionVWAP(high, low, close, volume []float64, times []time.Time, session model.Session) []float64 {
+	vwap := make([]float64, len(close))
+
+	var (
+		cumulativeVolume float64
+		cumulativeValue  float64
+		currentDay       time.Time
+	)
+
+	for i := range close {
+		if day := session.Day(times[i]); !day.Equal(currentDay) {
+			currentDay = day
+			cumulativeVolume = 0
+			cumulativeValue = 0
+		}
+
+		typicalPrice := (high[i] + low[i] + close[i]) / 3
+		cumulativeValue += typicalPrice * volume[i]
+		cumulativeVolume += volume[i]
+
+		if cumulativeVolume == 0 {
+			vwap[i] = typicalPrice
+			continue
+		}
+		vwap[i] = cumulativeValue / cumulativeVolume
+	}
+
+	return vwap
+}
@@ -0,0 +1,241 @@
+package ninjabot
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/strategy"
+)
+
+const manifestVersion = 1
+
+// ErrManifestMismatch is returned by a verified backtest that does not reproduce the result of its manifest
+var ErrManifestMismatch = errors.New("backtest does not match the manifest")
+
+// StrategyManifest identifies a strategy and its parameters, the exported fields of the strategy
+type StrategyManifest struct {
+	Name   string          `json:"name,omitempty"`
+	Type   string          `json:"type"`
+	Pairs  []string        `json:"pairs"`
+	Params json.RawMessage `json:"params"`
+}
+
+// ManifestResult is the outcome of a backtest, compared by a verification
+type ManifestResult struct {
+	Orders      int     `json:"orders"`
+	OrdersHash  string  `json:"orders_hash"`
+	FinalEquity float64 `json:"final_equity"`
+}
+
+// Manifest describes a backtest run with everything needed to reproduce it: the data, the strategies,
+// the simulation settings of the wallet and the random seed, and its result
+type Manifest struct {
+	Version    int                         `json:"version"`
+	CreatedAt  time.Time                   `json:"created_at"`
+	Pairs      []string                    `json:"pairs"`
+	Seed       int64                       `json:"seed"`
+	DataHash   string                      `json:"data_hash"`
+	Candles    int                         `json:"candles"`
+	Strategies []StrategyManifest          `json:"strategies"`
+	Wallet     *exchange.PaperWalletConfig `json:"wallet,omitempty"`
+	Result     ManifestResult              `json:"result"`
+}
+
+// LoadManifest reads a manifest saved by a backtest, eg: to verify a run with WithVerifyManifest
+func LoadManifest(path string) (*Manifest, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := new(Manifest)
+	if err := json.Unmarshal(content, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// Save writes the manifest as JSON
+func (m Manifest) Save(path string) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0600)
+}
+
+// Diff returns the fields of the manifest that differ from another run, except the creation time
+func (m Manifest) Diff(other Manifest) []string {
+	var fields []string
+	if m.Version != other.Version {
+		fields = append(fields, "version")
+	}
+	if m.Seed != other.Seed {
+		fields = append(fields, "seed")
+	}
+	if m.DataHash != other.DataHash || m.Candles != other.Candles {
+		fields = append(fields, "data")
+	}
+	if !equalJSON(m.Pairs, other.Pairs) {
+		fields = append(fields, "pairs")
+	}
+	if !equalJSON(m.Strategies, other.Strategies) {
+		fields = append(fields, "strategies")
+	}
+	if !equalJSON(m.Wallet, other.Wallet) {
+		fields = append(fields, "wallet")
+	}
+	if m.Result.Orders != other.Result.Orders || m.Result.OrdersHash != other.Result.OrdersHash {
+		fields = append(fields, "orders")
+	}
+	if math.Abs(m.Result.FinalEquity-other.Result.FinalEquity) > 1e-9 {
+		fields = append(fields, "final equity")
+	}
+	return fields
+}
+
+func equalJSON(a, b interface{}) bool {
+	first, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	second, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(first) == string(second)
+}
+
+// WithSeed sets the seed of the random source of the bot, `NinjaBot.Rand`, and of the Monte Carlo simulations,
+// default: a random seed in backtests, recorded in the manifest
+func WithSeed(seed int64) Option {
+	return func(bot *NinjaBot) {
+		bot.seed = seed
+	}
+}
+
+// WithManifest saves the manifest of a backtest in a JSON file, after the run
+func WithManifest(path string) Option {
+	return func(bot *NinjaBot) {
+		bot.manifestPath = path
+	}
+}
+
+// WithVerifyManifest verifies that a backtest reproduces a manifest: the backtest runs with the seed of the
+// manifest and fails with ErrManifestMismatch when the data, the strategies, the wallet settings or the result
+// differ. The data, strategies and wallet recorded in the manifest are not applied, they must be configured
+// as in the recorded run.
+func WithVerifyManifest(manifest *Manifest) Option {
+	return func(bot *NinjaBot) {
+		bot.verify = manifest
+		bot.seed = manifest.Seed
+	}
+}
+
+// hashCandle adds a processed candle to the hash of the backtest data
+func (n *NinjaBot) hashCandle(candle model.Candle) {
+	if n.dataHash == nil {
+		n.dataHash = sha256.New()
+	}
+	n.candles++
+	_, _ = fmt.Fprintf(n.dataHash, "%s|%s|%d|%g|%g|%g|%g|%g|%t\n", candle.Pair, candle.Timeframe,
+		candle.Time.UnixNano(), candle.Open, candle.High, candle.Low, candle.Close, candle.Volume, candle.Complete)
+}
+
+// Manifest returns the description of the backtest and its result, after the run
+func (n *NinjaBot) Manifest() (Manifest, error) {
+	manifest := Manifest{
+		Version:   manifestVersion,
+		CreatedAt: time.Now().UTC(),
+		Pairs:     n.settings.Pairs,
+		Seed:      n.seed,
+		Candles:   n.candles,
+	}
+	if n.dataHash != nil {
+		manifest.DataHash = hex.EncodeToString(n.dataHash.Sum(nil))
+	}
+
+	manifest.Strategies = append(manifest.Strategies, strategyManifest("", n.strategy, n.strategyPairs))
+	for _, str := range n.strategies {
+		manifest.Strategies = append(manifest.Strategies, strategyManifest(str.name, str.strategy, str.pairs))
+	}
+
+	if n.paperWallet != nil {
+		config := n.paperWallet.Config()
+		manifest.Wallet = &config
+		if values := n.paperWallet.EquityValues(); len(values) > 0 {
+			manifest.Result.FinalEquity = values[len(values)-1].Value
+		}
+	}
+
+	orders, err := n.storage.Orders()
+	if err != nil {
+		return manifest, err
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].ID < orders[j].ID
+	})
+
+	ordersHash := sha256.New()
+	for _, order := range orders {
+		_, _ = fmt.Fprintf(ordersHash, "%s|%s|%s|%s|%g|%g|%d\n", order.Pair, order.Side, order.Type, order.Status,
+			order.Price, order.Quantity, order.UpdatedAt.UnixNano())
+	}
+	manifest.Result.Orders = len(orders)
+	manifest.Result.OrdersHash = hex.EncodeToString(ordersHash.Sum(nil))
+	return manifest, nil
+}
+
+// finishBacktest exports the results, saves the manifest of the run and compares it with the verified manifest
+func (n *NinjaBot) finishBacktest() error {
+	if n.exportDir != "" {
+		if err := n.Export(n.exportDir, n.exportFormat); err != nil {
+			return err
+		}
+	}
+
+	if n.manifestPath == "" && n.verify == nil {
+		return nil
+	}
+
+	manifest, err := n.Manifest()
+	if err != nil {
+		return err
+	}
+
+	if n.manifestPath != "" {
+		if err := manifest.Save(n.manifestPath); err != nil {
+			return err
+		}
+	}
+
+	if n.verify != nil {
+		if fields := n.verify.Diff(manifest); len(fields) > 0 {
+			return fmt.Errorf("%w: %v", ErrManifestMismatch, fields)
+		}
+	}
+	return nil
+}
+
+func strategyManifest(name string, str strategy.Strategy, pairs []string) StrategyManifest {
+	params, err := json.Marshal(str)
+	if err != nil {
+		// strategies with fields that are not serializable are described by their values
+		params, _ = json.Marshal(fmt.Sprintf("%+v", str))
+	}
+	return StrategyManifest{
+		Name:   name,
+		Type:   fmt.Sprintf("%T", str),
+		Pairs:  pairs,
+		Params: params,
+	}
+}
@@ -16,6 +16,8 @@ type TelegramSettings struct {
 type Settings struct {
 	Pairs    []string
 	Telegram TelegramSettings
+	// Session defines the timezone and day boundaries of daily operations, default: UTC
+	Session Session
 }
 
 type Balance struct {
@@ -25,6 +27,40 @@ type Balance struct {
 	Leverage float64
 }
 
+// PositionRisk is the exposure of a position in a pair. Details unknown to the exchange, eg: the
+// liquidation price of spot positions, are zero.
+type PositionRisk struct {
+	Pair string
+	// Size is the net position, negative for short positions
+	Size             float64
+	EntryPrice       float64
+	MarkPrice        float64
+	LiquidationPrice float64
+	UnrealizedPnL    float64
+	Margin           float64
+	Leverage         float64
+}
+
+// PositionPnL is a position aggregated from the fills of the bot, with its profit and fees in the quote asset.
+// The realized profit and the fees are accumulated since the start, including closed positions of the pair.
+type PositionPnL struct {
+	Pair string `json:"pair"`
+	// Size is the net position, negative for short positions
+	Size          float64   `json:"size"`
+	AvgPrice      float64   `json:"avg_price"`
+	MarkPrice     float64   `json:"mark_price"`
+	RealizedPnL   float64   `json:"realized_pnl"`
+	UnrealizedPnL float64   `json:"unrealized_pnl"`
+	Fees          float64   `json:"fees"`
+	OpenedAt      time.Time `json:"opened_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NetPnL returns the realized and unrealized profit, after fees
+func (p PositionPnL) NetPnL() float64 {
+	return p.RealizedPnL + p.UnrealizedPnL - p.Fees
+}
+
 type AssetInfo struct {
 	BaseAsset  string
 	QuoteAsset string
@@ -41,6 +77,111 @@ type AssetInfo struct {
 	BaseAssetPrecision int
 }
 
+// FundingRate is the funding of a perpetual futures pair, paid periodically between long and short positions.
+// Positive rates are paid by longs to shorts.
+type FundingRate struct {
+	Pair string
+	// Rate is the last settled rate, at Time
+	Rate float64
+	Time time.Time
+	// PredictedRate is the estimated rate of the next funding, at NextFundingTime
+	PredictedRate   float64
+	NextFundingTime time.Time
+	MarkPrice       float64
+}
+
+// MarkPrice is the fair price of a futures pair, derived from the index price of spot markets.
+// Futures exchanges trigger stops and liquidations with the mark price, instead of the last trade price.
+type MarkPrice struct {
+	Pair  string
+	Time  time.Time
+	Mark  float64
+	Index float64
+}
+
+// BookLevel is a price level of an order book, with the total quantity of the orders at the price
+type BookLevel struct {
+	Price    float64
+	Quantity float64
+}
+
+// OrderBook is a snapshot of the best levels of an order book. Bids are sorted by descending price
+// and asks by ascending price, so the first levels are the best prices.
+type OrderBook struct {
+	Pair     string
+	Time     time.Time
+	UpdateID int64
+	Bids     []BookLevel
+	Asks     []BookLevel
+}
+
+// Mid returns the average between the best bid and ask, or zero for empty books
+func (o OrderBook) Mid() float64 {
+	if len(o.Bids) == 0 || len(o.Asks) == 0 {
+		return 0
+	}
+	return (o.Bids[0].Price + o.Asks[0].Price) / 2
+}
+
+// Spread returns the difference between the best ask and bid, or zero for empty books
+func (o OrderBook) Spread() float64 {
+	if len(o.Bids) == 0 || len(o.Asks) == 0 {
+		return 0
+	}
+	return o.Asks[0].Price - o.Bids[0].Price
+}
+
+// Liquidity returns the quantity of the bids and asks within a price distance of the mid price,
+// eg: Liquidity(0.01) is the depth within 1%
+func (o OrderBook) Liquidity(distance float64) (bids, asks float64) {
+	mid := o.Mid()
+	for _, level := range o.Bids {
+		if level.Price < mid*(1-distance) {
+			break
+		}
+		bids += level.Quantity
+	}
+	for _, level := range o.Asks {
+		if level.Price > mid*(1+distance) {
+			break
+		}
+		asks += level.Quantity
+	}
+	return bids, asks
+}
+
+// Quote is the best bid and ask of a pair, with the quantities at each price
+type Quote struct {
+	Pair        string
+	Time        time.Time
+	UpdateID    int64
+	Bid         float64
+	BidQuantity float64
+	Ask         float64
+	AskQuantity float64
+}
+
+// Mid returns the average between the best bid and ask
+func (q Quote) Mid() float64 {
+	return (q.Bid + q.Ask) / 2
+}
+
+// Spread returns the difference between the best ask and bid
+func (q Quote) Spread() float64 {
+	return q.Ask - q.Bid
+}
+
+// Trade is an aggregated trade of a pair, with the fills of a taker order at the same price
+type Trade struct {
+	ID       int64
+	Pair     string
+	Time     time.Time
+	Price    float64
+	Quantity float64
+	// Side is the side of the taker order, sell trades are filled against buy orders of the book
+	Side SideType
+}
+
 type Dataframe struct {
 	Pair string
 
@@ -55,6 +196,10 @@ type Dataframe struct {
 
 	// Custom user metadata
 	Metadata map[string]Series[float64]
+
+	// Timeframes are the dataframes of the additional timeframes of the pair, by timeframe,
+	// eg: df.Timeframes["4h"] for a trend filter. See strategy.MultiTimeframeStrategy.
+	Timeframes map[string]*Dataframe
 }
 
 func (df Dataframe) Sample(positions int) Dataframe {
@@ -74,6 +219,7 @@ func (df Dataframe) Sample(positions int) Dataframe {
 		Time:       df.Time[start:],
 		LastUpdate: df.LastUpdate,
 		Metadata:   make(map[string]Series[float64]),
+		Timeframes: df.Timeframes,
 	}
 
 	for key := range df.Metadata {
@@ -93,6 +239,11 @@ type Candle struct {
 	High      float64
 	Volume    float64
 	Complete  bool
+	// Timeframe of the data feed that delivered the candle, empty for candles outside the data feed
+	Timeframe string
+	// Repaired is set on a closed candle delivered again by the exchange with different values, which replaces
+	// the bar already delivered with the same open time
+	Repaired bool
 
 	// Aditional collums from CSV inputs
 	Metadata map[string]float64
@@ -139,3 +139,25 @@ func TestDataframe_Sample(t *testing.T) {
 	sample.Metadata["test"] = []float64{10, 11, 12, 13, 14}
 	require.Equal(t, df.Metadata["test"], Series[float64]([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9}))
 }
+
+func TestOrderBook(t *testing.T) {
+	book := OrderBook{
+		Bids: []BookLevel{{Price: 99, Quantity: 1}, {Price: 98, Quantity: 2}, {Price: 90, Quantity: 5}},
+		Asks: []BookLevel{{Price: 101, Quantity: 3}, {Price: 110, Quantity: 4}},
+	}
+	require.Equal(t, 100.0, book.Mid())
+	require.Equal(t, 2.0, book.Spread())
+
+	bids, asks := book.Liquidity(0.05)
+	require.Equal(t, 3.0, bids)
+	require.Equal(t, 3.0, asks)
+
+	require.Zero(t, OrderBook{Bids: book.Bids}.Mid())
+	require.Zero(t, OrderBook{}.Spread())
+}
+
+func TestQuote(t *testing.T) {
+	quote := Quote{Bid: 99, Ask: 101}
+	require.Equal(t, 100.0, quote.Mid())
+	require.Equal(t, 2.0, quote.Spread())
+}
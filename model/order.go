@@ -8,6 +8,13 @@ import (
 type SideType string
 type OrderType string
 type OrderStatusType string
+type PositionSideType string
+
+// TimeInForceType defines how long a limit order remains open in the book
+type TimeInForceType string
+
+// PricingType defines how the price of a limit order is set from the live best bid and ask
+type PricingType string
 
 var (
 	SideTypeBuy  SideType = "BUY"
@@ -20,6 +27,10 @@ var (
 	OrderTypeStopLossLimit   OrderType = "STOP_LOSS_LIMIT"
 	OrderTypeTakeProfit      OrderType = "TAKE_PROFIT"
 	OrderTypeTakeProfitLimit OrderType = "TAKE_PROFIT_LIMIT"
+	// OrderTypeTrailingStop is a stop market order following the price at a callback rate
+	OrderTypeTrailingStop OrderType = "TRAILING_STOP_MARKET"
+	// OrderTypeLiquidation is a forced close of a leveraged position by the exchange
+	OrderTypeLiquidation OrderType = "LIQUIDATION"
 
 	OrderStatusTypeNew             OrderStatusType = "NEW"
 	OrderStatusTypePartiallyFilled OrderStatusType = "PARTIALLY_FILLED"
@@ -28,6 +39,27 @@ var (
 	OrderStatusTypePendingCancel   OrderStatusType = "PENDING_CANCEL"
 	OrderStatusTypeRejected        OrderStatusType = "REJECTED"
 	OrderStatusTypeExpired         OrderStatusType = "EXPIRED"
+	// OrderStatusTypePendingNew is an order persisted before its submission to the exchange, eg: an order
+	// submitted when the bot crashed, which is reconciled by its client order ID
+	OrderStatusTypePendingNew OrderStatusType = "PENDING_NEW"
+
+	PositionSideTypeBoth  PositionSideType = "BOTH"
+	PositionSideTypeLong  PositionSideType = "LONG"
+	PositionSideTypeShort PositionSideType = "SHORT"
+
+	// TimeInForceGTC keeps the order open until it is filled or canceled
+	TimeInForceGTC TimeInForceType = "GTC"
+	// TimeInForceIOC fills the order immediately, as much as possible, and cancels the remaining quantity
+	TimeInForceIOC TimeInForceType = "IOC"
+	// TimeInForceFOK fills the whole order immediately or cancels it
+	TimeInForceFOK TimeInForceType = "FOK"
+	// TimeInForceGTX is a post only order, rejected when it would take liquidity from the book
+	TimeInForceGTX TimeInForceType = "GTX"
+
+	// PricingJoin places buy orders at the best bid and sell orders at the best ask, waiting in the book
+	PricingJoin PricingType = "JOIN"
+	// PricingCross places buy orders at the best ask and sell orders at the best bid, crossing the spread
+	PricingCross PricingType = "CROSS"
 )
 
 type Order struct {
@@ -39,6 +71,16 @@ type Order struct {
 	Status     OrderStatusType `db:"status" json:"status"`
 	Price      float64         `db:"price" json:"price"`
 	Quantity   float64         `db:"quantity" json:"quantity"`
+	// Executed is the filled quantity of the order, updated by partial fills when reported by the exchange
+	Executed float64 `db:"executed" json:"executed"`
+	// Fee is the commission of the fills of the order in the quote asset, zero when not reported by the exchange
+	Fee float64 `db:"fee" json:"fee"`
+
+	// ClientOrderID is the ID of the order chosen by the bot on submission, when supported by the exchange
+	ClientOrderID string `db:"client_order_id" json:"client_order_id"`
+
+	// PositionSide is the position leg of futures orders in hedge mode, empty or BOTH in one-way mode
+	PositionSide PositionSideType `db:"position_side" json:"position_side"`
 
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
@@ -54,6 +96,80 @@ type Order struct {
 	Candle      Candle  `json:"-" gorm:"-"`
 }
 
+// OrderRequest is an order to be placed, eg: in a batch of orders
+type OrderRequest struct {
+	Pair     string
+	Side     SideType
+	Type     OrderType
+	Quantity float64
+	// Price is the limit price of limit orders
+	Price float64
+	// Stop is the trigger price of stop loss and take profit orders, and the activation price of trailing stops
+	Stop       float64
+	ReduceOnly bool
+	// CallbackRate is the distance of trailing stops from the best price, eg: 0.01 = 1%
+	CallbackRate float64
+	// TimeInForce of limit orders, GTC when empty
+	TimeInForce TimeInForceType
+	// QuoteQuantity is the size of market orders in the quote asset, used instead of Quantity when not zero
+	QuoteQuantity float64
+	// IcebergQuantity is the visible quantity of iceberg limit orders
+	IcebergQuantity float64
+	// ClientOrderID identifies the order in the exchange, eg: to find it after a crash before its persistence
+	ClientOrderID string
+}
+
+// OrderOptions are the advanced parameters of limit orders
+type OrderOptions struct {
+	// TimeInForce of the order, GTC when empty
+	TimeInForce TimeInForceType
+	// IcebergQuantity is the visible quantity of iceberg orders, which hide the rest of their size
+	IcebergQuantity float64
+	// Pricing replaces the limit price by the live best bid or ask, when available. The given limit,
+	// eg: the last candle close, is used without a live quote.
+	Pricing PricingType
+}
+
+// ExpireAction is the handling of limit orders unfilled after their time to live
+type ExpireAction string
+
+const (
+	// ExpireCancel cancels the order
+	ExpireCancel ExpireAction = "CANCEL"
+	// ExpireMarket cancels the order and places a market order with the unfilled quantity
+	ExpireMarket ExpireAction = "MARKET"
+)
+
+// OrderTTL is the time to live of unfilled limit orders, so entries do not linger at stale prices.
+// The longest of Candles, in the strategy timeframe, and Duration is used. Zero values disable it.
+type OrderTTL struct {
+	Candles  int
+	Duration time.Duration
+	// Action on expired orders, default: ExpireCancel
+	Action ExpireAction
+}
+
+// Lifetime returns the time to live of orders for a given candle interval
+func (t OrderTTL) Lifetime(interval time.Duration) time.Duration {
+	lifetime := time.Duration(t.Candles) * interval
+	if t.Duration > lifetime {
+		lifetime = t.Duration
+	}
+	return lifetime
+}
+
+// BreakEven moves the stop of a position to its entry price once the price reaches a gain, so a winning
+// position is not closed at a loss. The stop is moved when any of the enabled gains is reached.
+type BreakEven struct {
+	// RMultiple is the gain as a multiple of the initial risk, the distance from the entry to the stop, eg: 1
+	RMultiple float64
+	// Percent is the gain as a fraction of the entry price, eg: 0.02 for 2%
+	Percent float64
+	// Buffer is the distance of the stop beyond the entry, as a fraction of the entry, to cover the fees,
+	// default: twice the fee rate of the controller
+	Buffer float64
+}
+
 func (o Order) String() string {
 	return fmt.Sprintf("[%s] %s %s | ID: %d, Type: %s, %f x $%f (~$%.f)",
 		o.Status, o.Side, o.Pair, o.ID, o.Type, o.Quantity, o.Price, o.Quantity*o.Price)
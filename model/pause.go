@@ -0,0 +1,36 @@
+package model
+
+import "fmt"
+
+// PauseMode defines which orders are blocked while a pair or strategy is paused
+type PauseMode int
+
+const (
+	// PauseNone means trading is active
+	PauseNone PauseMode = iota
+	// PauseEntries blocks orders that open or increase positions, exits and protections are still allowed
+	PauseEntries
+	// PauseAll blocks all new orders, including the management of open positions
+	PauseAll
+)
+
+func (p PauseMode) String() string {
+	switch p {
+	case PauseNone:
+		return "active"
+	case PauseEntries:
+		return "entries paused"
+	case PauseAll:
+		return "paused"
+	}
+	return fmt.Sprintf("PauseMode(%d)", int(p))
+}
+
+// IsEntry returns true if an order with the given side opens or increases a position,
+// given the current position size (negative for short positions)
+func IsEntry(side SideType, position float64) bool {
+	if side == SideTypeBuy {
+		return position >= 0
+	}
+	return position <= 0
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+)
+
+// Session defines the timezone and the start of the trading day, used in daily aggregations,
+// daily limits and session anchored indicators. The zero value represents a UTC day starting at 00:00.
+type Session struct {
+	// Location is the timezone of the session, default: UTC
+	Location *time.Location
+	// DayStart is the offset from midnight when the trading day starts, eg: 8h for 08:00
+	DayStart time.Duration
+}
+
+// NewSession creates a session given an IANA timezone name (eg: America/Sao_Paulo) and the day start offset
+func NewSession(timezone string, dayStart time.Duration) (Session, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return Session{Location: location, DayStart: dayStart}, nil
+}
+
+func (s Session) location() *time.Location {
+	if s.Location == nil {
+		return time.UTC
+	}
+	return s.Location
+}
+
+// SessionTime converts a time to the session clock, represented in UTC. In the session clock,
+// the trading day always starts at 00:00, so daily boundaries can be computed as regular UTC days.
+func (s Session) SessionTime(t time.Time) time.Time {
+	local := t.In(s.location())
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(),
+		local.Nanosecond(), time.UTC).Add(-s.DayStart)
+}
+
+// Day returns the start of the trading day of a given time
+func (s Session) Day(t time.Time) time.Time {
+	local := t.In(s.location()).Add(-s.DayStart)
+	start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.location())
+	return start.Add(s.DayStart)
+}
+
+// NextDay returns the start of the next trading day of a given time
+func (s Session) NextDay(t time.Time) time.Time {
+	day := s.Day(t)
+	local := day.In(s.location())
+	next := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, s.location())
+	return next.Add(s.DayStart)
+}
+
+// SameDay returns true if both times belong to the same trading day
+func (s Session) SameDay(a, b time.Time) bool {
+	return s.Day(a).Equal(s.Day(b))
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	t.Run("default UTC", func(t *testing.T) {
+		session := Session{}
+		now := time.Date(2021, 1, 1, 23, 30, 0, 0, time.UTC)
+		require.Equal(t, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), session.Day(now))
+		require.Equal(t, time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), session.NextDay(now).UTC())
+		require.Equal(t, now, session.SessionTime(now))
+	})
+
+	t.Run("custom timezone and day start", func(t *testing.T) {
+		session, err := NewSession("America/Sao_Paulo", 8*time.Hour) // UTC-3
+		require.NoError(t, err)
+
+		// 10:00 UTC = 07:00 local, still in previous trading day
+		before := time.Date(2021, 1, 2, 10, 0, 0, 0, time.UTC)
+		after := time.Date(2021, 1, 2, 11, 0, 0, 0, time.UTC)
+
+		require.Equal(t, time.Date(2021, 1, 1, 11, 0, 0, 0, time.UTC), session.Day(before).UTC())
+		require.Equal(t, time.Date(2021, 1, 2, 11, 0, 0, 0, time.UTC), session.Day(after).UTC())
+		require.Equal(t, time.Date(2021, 1, 3, 11, 0, 0, 0, time.UTC), session.NextDay(after).UTC())
+		require.False(t, session.SameDay(before, after))
+		require.Equal(t, time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC), session.SessionTime(after))
+	})
+
+	t.Run("invalid timezone", func(t *testing.T) {
+		_, err := NewSession("invalid", 0)
+		require.Error(t, err)
+	})
+}
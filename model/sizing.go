@@ -0,0 +1,19 @@
+package model
+
+// SizeRequest is the context of a position size. The broker sets the price and the equity when they are zero.
+type SizeRequest struct {
+	Pair string
+	// Price is the entry price, default: the last price of the pair
+	Price float64
+	// Equity is the capital of the strategy in the quote of the pair, default: the account equity or the
+	// capital of the strategy allocation
+	Equity float64
+	// ATR is the volatility of the pair, eg: `indicator.ATR(df.High, df.Low, df.Close, 14).Last(0)`
+	ATR float64
+}
+
+// Sizer returns the quantity of a new position, in the base asset of the pair, before lot size rounding,
+// eg: the sizers of the `tools/sizing` package
+type Sizer interface {
+	Size(request SizeRequest) float64
+}
@@ -4,11 +4,19 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"hash"
+	"io"
+	"math/rand"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aybabtme/uniplot/histogram"
 
+	"github.com/bengalm/ninjabot/calendar"
+	"github.com/bengalm/ninjabot/event"
 	"github.com/bengalm/ninjabot/exchange"
 	"github.com/bengalm/ninjabot/model"
 	"github.com/bengalm/ninjabot/notification"
@@ -16,11 +24,19 @@ import (
 	"github.com/bengalm/ninjabot/service"
 	"github.com/bengalm/ninjabot/storage"
 	"github.com/bengalm/ninjabot/strategy"
+	"github.com/bengalm/ninjabot/tools/clock"
+	"github.com/bengalm/ninjabot/tools/debugger"
+	"github.com/bengalm/ninjabot/tools/export"
 	"github.com/bengalm/ninjabot/tools/log"
 	"github.com/bengalm/ninjabot/tools/metrics"
+	"github.com/bengalm/ninjabot/tools/risk"
+	"github.com/bengalm/ninjabot/tools/supervisor"
+	"github.com/bengalm/ninjabot/tools/watchdog"
 
 	"github.com/olekukonko/tablewriter"
+	"github.com/samber/lo"
 	"github.com/schollz/progressbar/v3"
+	"github.com/xhit/go-str2duration/v2"
 )
 
 const defaultDatabase = "ninjabot.db"
@@ -44,22 +60,115 @@ type NinjaBot struct {
 	storage  storage.Storage
 	settings model.Settings
 	exchange service.Exchange
+	feeder   service.Feeder
 	strategy strategy.Strategy
 	notifier service.Notifier
 	telegram service.Telegram
+	calendar *calendar.Calendar
+	bus      *event.Bus
+	clock    clock.Clock
+
+	supervisor *supervisor.Supervisor
+
+	watchdog       *watchdog.Watchdog
+	staleCandles   int
+	accountTimeout time.Duration
+
+	debugger        *debugger.Debugger
+	executionReport time.Duration
+	executionFee    float64
+	liveQuotes      bool
+	fillTimeframe   string
+	clientPrefix    string
+	orderRetry      *order.RetryPolicy
+	exposure        order.ExposureLimits
+	maxDrawdown     float64
+	drawdown        *risk.DrawdownGuard
+	dailyLossLimit  *risk.DailyLossLimit
+	dailyLoss       *risk.DailyLossGuard
 
 	orderController       *order.Controller
 	priorityQueueCandle   *model.PriorityQueue
 	strategiesControllers map[string]*strategy.Controller
+	strategyPairs         []string
+	strategies            []*botStrategy
+	feedControllers       map[string][]*strategy.Controller
+	walletTimeframes      map[string]string
 	orderFeed             *order.Feed
 	dataFeed              *exchange.DataFeedSubscription
 	paperWallet           *exchange.PaperWallet
 
-	backtest bool
+	backtest     bool
+	seed         int64
+	random       *rand.Rand
+	dataHash     hash.Hash
+	candles      int
+	manifestPath string
+	verify       *Manifest
+	exportDir    string
+	exportFormat export.Format
+
+	candleStore     storage.CandleStore
+	storeIndicators bool
 }
 
 type Option func(*NinjaBot)
 
+// botStrategy is an additional strategy, with its own pairs and capital allocation
+type botStrategy struct {
+	name        string
+	strategy    strategy.Strategy
+	pairs       []string
+	allocation  order.Allocation
+	controllers map[string]*strategy.Controller
+}
+
+// feedCandle is a candle of a given timeframe, since strategies with different timeframes may share a pair
+type feedCandle struct {
+	model.Candle
+	timeframe string
+	interval  time.Duration
+	// fill candles update the paper wallet, see WithFillTimeframe
+	fill bool
+}
+
+// Less orders candles by the time they are known, complete candles by their close time. In backtests,
+// a candle of a higher timeframe is processed after the candles of lower timeframes it contains.
+func (f feedCandle) Less(j model.Item) bool {
+	other := j.(feedCandle)
+	if known, otherKnown := f.known(), other.known(); !known.Equal(otherKnown) {
+		return known.Before(otherKnown)
+	}
+
+	// fills are resolved before the strategies trade on candles closed at the same time
+	if f.fill != other.fill {
+		return f.fill
+	}
+
+	// candles closed at the same time are processed from the higher timeframe, to be available to the
+	// strategies of lower timeframes
+	if f.Complete && other.Complete && f.interval != other.interval {
+		return f.interval > other.interval
+	}
+	return f.Candle.Less(other.Candle)
+}
+
+func (f feedCandle) known() time.Time {
+	if f.Complete {
+		return f.Time.Add(f.interval)
+	}
+	return f.Time
+}
+
+func feedKey(pair, timeframe string) string {
+	return fmt.Sprintf("%s--%s", pair, timeframe)
+}
+
+func splitFeedKey(key string) (pair, timeframe string) {
+	parts := strings.SplitN(key, "--", 2)
+	return parts[0], parts[1]
+}
+
 func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange, str strategy.Strategy,
 	options ...Option) (*NinjaBot, error) {
 
@@ -70,7 +179,12 @@ func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange,
 		orderFeed:             order.NewOrderFeed(),
 		dataFeed:              exchange.NewDataFeed(exch),
 		strategiesControllers: make(map[string]*strategy.Controller),
+		strategyPairs:         settings.Pairs,
+		feedControllers:       make(map[string][]*strategy.Controller),
+		walletTimeframes:      make(map[string]string),
 		priorityQueueCandle:   model.NewPriorityQueue(nil),
+		bus:                   event.NewBus(),
+		supervisor:            supervisor.New(),
 	}
 
 	for _, pair := range settings.Pairs {
@@ -84,6 +198,32 @@ func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange,
 		option(bot)
 	}
 
+	// additional strategies pairs are included in settings, to receive orders notifications
+	for _, str := range bot.strategies {
+		for _, pair := range str.pairs {
+			if !lo.Contains(bot.settings.Pairs, pair) {
+				bot.settings.Pairs = append(bot.settings.Pairs, pair)
+			}
+		}
+	}
+
+	// backtests are reproducible by the seed of the bot random source, recorded in the manifest
+	if bot.backtest && bot.seed == 0 {
+		bot.seed = time.Now().UnixNano()
+	}
+	if bot.seed != 0 {
+		bot.random = rand.New(rand.NewSource(bot.seed))
+	} else {
+		bot.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+
+	if bot.clock == nil {
+		bot.clock = clock.Wall()
+		if bot.backtest {
+			bot.clock = clock.NewSimulated(time.Time{})
+		}
+	}
+
 	var err error
 	if bot.storage == nil {
 		bot.storage, err = storage.FromFile(defaultDatabase)
@@ -92,7 +232,18 @@ func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange,
 		}
 	}
 
-	bot.orderController = order.NewController(ctx, exch, bot.storage, bot.orderFeed)
+	bot.orderController = order.NewController(ctx, bot.exchange, bot.storage, bot.orderFeed)
+	bot.orderController.SetEventBus(bot.bus)
+	bot.orderController.SetClock(bot.clock)
+	bot.orderController.SetFeeRate(bot.executionFee)
+	bot.orderController.SetExecutionReport(bot.executionReport)
+	if bot.clientPrefix != "" {
+		bot.orderController.SetClientOrderPrefix(bot.clientPrefix)
+	}
+	if bot.orderRetry != nil {
+		bot.orderController.SetRetryPolicy(*bot.orderRetry)
+	}
+	bot.orderController.SetExposureLimits(bot.exposure)
 
 	if settings.Telegram.Enabled {
 		bot.telegram, err = notification.NewTelegram(bot.orderController, settings)
@@ -103,6 +254,21 @@ func NewBot(ctx context.Context, settings model.Settings, exch service.Exchange,
 		WithNotifier(bot.telegram)(bot)
 	}
 
+	if bot.maxDrawdown > 0 {
+		bot.drawdown = risk.NewDrawdownGuard(bot.orderController, bot.maxDrawdown,
+			risk.WithNotifier(bot.notifier), risk.WithEventBus(bot.bus))
+	}
+	if bot.dailyLossLimit != nil {
+		// the days of the limit follow the session of the settings, unless the limit has its own session
+		limit := *bot.dailyLossLimit
+		if limit.Session == (model.Session{}) {
+			limit.Session = settings.Session
+		}
+		bot.dailyLoss = risk.NewDailyLossGuard(bot.orderController, limit,
+			risk.WithNotifier(bot.notifier), risk.WithEventBus(bot.bus))
+		event.Subscribe(bot.bus, event.Positions, bot.dailyLoss.OnPosition)
+	}
+
 	return bot, nil
 }
 
@@ -123,6 +289,15 @@ func WithStorage(storage storage.Storage) Option {
 	}
 }
 
+// WithExport writes the orders, the closed trades and the equity to files of a format in a directory after
+// a backtest, eg: WithExport("results", export.Parquet)
+func WithExport(outputDir string, format export.Format) Option {
+	return func(bot *NinjaBot) {
+		bot.exportDir = outputDir
+		bot.exportFormat = format
+	}
+}
+
 // WithLogLevel sets the log level. eg: log.DebugLevel, log.InfoLevel, log.WarnLevel, log.ErrorLevel, log.FatalLevel
 func WithLogLevel(level log.Level) Option {
 	return func(bot *NinjaBot) {
@@ -136,6 +311,158 @@ func WithNotifier(notifier service.Notifier) Option {
 		bot.notifier = notifier
 		bot.orderController.SetNotifier(notifier)
 		bot.SubscribeOrder(notifier)
+		if resilient, ok := bot.exchange.(*exchange.Resilient); ok {
+			resilient.SetNotifier(notifier)
+		}
+	}
+}
+
+// WithFeeder sets a custom candle source for the bot, eg: a registered feeder from `exchange.NewFeeder`
+// or a `exchange.CustomFeed`. Orders are still sent to the exchange given in `NewBot`.
+func WithFeeder(feeder service.Feeder) Option {
+	return func(bot *NinjaBot) {
+		bot.feeder = feeder
+		bot.dataFeed.SetFeeder(feeder)
+	}
+}
+
+// WithCalendar sets a calendar of scheduled events (eg: CPI, FOMC, token unlocks). Strategies stand down during
+// the blackout window of events, and strategies implementing `strategy.EventStrategy` are notified to flatten.
+func WithCalendar(cal *calendar.Calendar) Option {
+	return func(bot *NinjaBot) {
+		bot.calendar = cal
+	}
+}
+
+// WithEventBus sets the event bus used to publish candles, orders, fills, errors and equity updates.
+// By default, a new bus is created and can be accessed with `bot.EventBus()`.
+func WithEventBus(bus *event.Bus) Option {
+	return func(bot *NinjaBot) {
+		bot.bus = bus
+	}
+}
+
+// WithClock sets the clock used by the bot controllers. By default, the wall clock is used in live trading,
+// and a simulated clock driven by candle times is used in backtests.
+func WithClock(c clock.Clock) Option {
+	return func(bot *NinjaBot) {
+		bot.clock = c
+	}
+}
+
+// WithSimulatedPairs executes the orders of the given pairs in a paper wallet, while the remaining pairs
+// are executed in the exchange given in `NewBot`. Market data is still provided by the exchange.
+func WithSimulatedPairs(wallet *exchange.PaperWallet, pairs ...string) Option {
+	return func(bot *NinjaBot) {
+		bot.paperWallet = wallet
+		bot.exchange = exchange.NewPairRouter(bot.exchange, exchange.WithPairBroker(wallet, pairs...))
+	}
+}
+
+// WithStrategy attaches an additional strategy to the bot, with its own pairs and capital allocation.
+// The controller enforces the allocation, and the strategy broker reports only its own positions and
+// available capital. The strategy given in `NewBot` runs in settings pairs, without allocation limits.
+func WithStrategy(name string, str strategy.Strategy, allocation order.Allocation, pairs ...string) Option {
+	return func(bot *NinjaBot) {
+		bot.strategies = append(bot.strategies, &botStrategy{
+			name:        name,
+			strategy:    str,
+			pairs:       pairs,
+			allocation:  allocation,
+			controllers: make(map[string]*strategy.Controller),
+		})
+	}
+}
+
+// WithExecutionReport sends a periodic report comparing live fills with the prices expected by the strategy,
+// with slippage, missed fills and fee drag per pair. The fee rate is used to estimate fees, eg: 0.001 for 0.1%.
+// The report is also available with `bot.Controller().ExecutionReport()`.
+func WithExecutionReport(interval time.Duration, feeRate float64) Option {
+	return func(bot *NinjaBot) {
+		bot.executionReport = interval
+		bot.executionFee = feeRate
+	}
+}
+
+// WithClientOrderPrefix sets the prefix of the client order IDs of the orders, default: ninjabot-. Bots
+// sharing an exchange account should use different prefixes, since the IDs are derived from their storages.
+func WithClientOrderPrefix(prefix string) Option {
+	return func(bot *NinjaBot) {
+		bot.clientPrefix = prefix
+	}
+}
+
+// WithOrderRetry sets the resubmission of orders failed by transient errors, eg: timeouts or 5xx responses,
+// default: order.DefaultRetryPolicy. Use order.NoRetry() to disable it.
+func WithOrderRetry(policy order.RetryPolicy) Option {
+	return func(bot *NinjaBot) {
+		bot.orderRetry = &policy
+	}
+}
+
+// WithExposureLimits rejects the entry orders exceeding a maximum notional by pair, a maximum total notional
+// or a maximum number of concurrent positions, eg: order.ExposureLimits{PairNotional: 1000, Positions: 3}.
+// Rejections are returned to the strategy as order.ErrExposureLimit and sent to the notifier.
+func WithExposureLimits(limits order.ExposureLimits) Option {
+	return func(bot *NinjaBot) {
+		bot.exposure = limits
+	}
+}
+
+// WithLiveQuotes streams the best bid and ask of the bot pairs, so limit orders can be priced off the live
+// spread with model.OrderOptions.Pricing, instead of the last candle close. The exchange must implement
+// service.QuoteFeeder, eg: Binance. It is ignored in backtest mode.
+func WithLiveQuotes() Option {
+	return func(bot *NinjaBot) {
+		bot.liveQuotes = true
+	}
+}
+
+// WithFillTimeframe fills the orders of the paper wallet with the candles of a lower timeframe, eg: 1s, while
+// the strategies receive the candles of their timeframes, so the order of stops and take profits reached by
+// the same strategy candle is resolved by the finer series instead of guessed. The data feed must provide the
+// timeframe, eg: a CSV feed of 1s candles or of trade ticks, see exchange.PairFeed.
+func WithFillTimeframe(timeframe string) Option {
+	return func(bot *NinjaBot) {
+		bot.fillTimeframe = timeframe
+	}
+}
+
+// WithWatchdog monitors the live streams, reconnecting candle feeds without messages within a number of
+// candles of their timeframe, eg: 3, and the account stream without messages within the account timeout,
+// zero to disable, since accounts without activity have no messages. The notifier is alerted when a stream
+// stays stale after reconnecting.
+func WithWatchdog(candles int, accountTimeout time.Duration, options ...watchdog.Option) Option {
+	return func(bot *NinjaBot) {
+		bot.watchdog = watchdog.New(options...)
+		bot.staleCandles = candles
+		bot.accountTimeout = accountTimeout
+	}
+}
+
+// WithMaxDrawdown halts the bot when the drawdown of the account equity from its peak reaches a fraction,
+// eg: 0.2 for 20%. The positions are flattened, open orders are canceled and new entries are paused until
+// `bot.DrawdownGuard().Resume()` is called.
+func WithMaxDrawdown(maxDrawdown float64) Option {
+	return func(bot *NinjaBot) {
+		bot.maxDrawdown = maxDrawdown
+	}
+}
+
+// WithDailyLossLimit stops opening positions for the rest of the day when the realized loss of the day
+// reaches an amount or a percentage of the equity, eg: risk.DailyLossLimit{Percent: 0.05}. Entries are
+// resumed automatically at the start of the next day, in the session of the settings by default.
+func WithDailyLossLimit(limit risk.DailyLossLimit) Option {
+	return func(bot *NinjaBot) {
+		bot.dailyLossLimit = &limit
+	}
+}
+
+// WithDebugger controls the backtest with a debugger, to pause, step candle-by-candle and inspect the
+// strategy dataframes, pending orders and wallet between candles. It is only used in backtest mode.
+func WithDebugger(d *debugger.Debugger) Option {
+	return func(bot *NinjaBot) {
+		bot.debugger = d
 	}
 }
 
@@ -179,6 +506,101 @@ func (n *NinjaBot) Controller() *order.Controller {
 	return n.orderController
 }
 
+// PauseStrategy pauses the strategy execution of a pair at runtime, or of all pairs when no pair is given.
+// To block all orders of a pair, including manual orders, use `bot.Controller().Pause`.
+func (n *NinjaBot) PauseStrategy(mode model.PauseMode, pairs ...string) {
+	if len(pairs) == 0 {
+		pairs = n.settings.Pairs
+	}
+
+	for _, pair := range pairs {
+		if controller, ok := n.strategiesControllers[pair]; ok {
+			controller.Pause(mode)
+		}
+	}
+}
+
+// ResumeStrategy resumes the strategy execution of a pair, or of all pairs when no pair is given
+func (n *NinjaBot) ResumeStrategy(pairs ...string) {
+	n.PauseStrategy(model.PauseNone, pairs...)
+}
+
+// SwapStrategy replaces the strategy of a pair at runtime, or of all pairs when no pair is given.
+// Positions and open orders are kept, and handed over to the new strategy, see `strategy.HandoverStrategy`.
+func (n *NinjaBot) SwapStrategy(str strategy.Strategy, pairs ...string) error {
+	all := len(pairs) == 0
+	if all {
+		pairs = n.settings.Pairs
+	}
+
+	for _, pair := range pairs {
+		controller, ok := n.strategiesControllers[pair]
+		if !ok {
+			return fmt.Errorf("strategy not found for pair: %s", pair)
+		}
+
+		if err := controller.Swap(str); err != nil {
+			return err
+		}
+	}
+
+	if all {
+		n.strategy = str
+	}
+
+	return nil
+}
+
+// Watchdog returns the watchdog of the live streams, nil without `WithWatchdog`
+func (n *NinjaBot) Watchdog() *watchdog.Watchdog {
+	return n.watchdog
+}
+
+// DrawdownGuard returns the kill switch of the maximum drawdown, nil without `WithMaxDrawdown`
+func (n *NinjaBot) DrawdownGuard() *risk.DrawdownGuard {
+	return n.drawdown
+}
+
+// DailyLossGuard returns the guard of the daily loss, nil without `WithDailyLossLimit`
+func (n *NinjaBot) DailyLossGuard() *risk.DailyLossGuard {
+	return n.dailyLoss
+}
+
+// Supervisor returns the supervisor of the bot goroutines, eg: to check restarts with `Status`
+func (n *NinjaBot) Supervisor() *supervisor.Supervisor {
+	return n.supervisor
+}
+
+// Clock returns the bot clock, it follows the candle times in backtests
+func (n *NinjaBot) Clock() clock.Clock {
+	return n.clock
+}
+
+// Session returns the timezone and day boundaries of the daily operations of the bot, see `model.Settings`
+func (n *NinjaBot) Session() model.Session {
+	return n.settings.Session
+}
+
+// EventBus returns the bus with bot events, eg: `event.Subscribe(bot.EventBus(), event.Fills, handler)`
+func (n *NinjaBot) EventBus() *event.Bus {
+	return n.bus
+}
+
+// publishCandle publishes a candle and, in simulation, the equity of the paper wallet after complete candles
+func (n *NinjaBot) publishCandle(candle model.Candle) {
+	if subscriber, ok := n.clock.(CandleSubscriber); ok {
+		subscriber.OnCandle(candle)
+	}
+
+	event.Publish(n.bus, event.Candles, candle)
+	if n.paperWallet != nil && candle.Complete {
+		if values := n.paperWallet.EquityValues(); len(values) > 0 {
+			last := values[len(values)-1]
+			event.Publish(n.bus, event.Equities, event.Equity{Time: last.Time, Value: last.Value})
+		}
+	}
+}
+
 // Summary function displays all trades, accuracy and some bot metrics in stdout
 // To access the raw data, you may access `bot.Controller().Results`
 func (n *NinjaBot) Summary() {
@@ -267,12 +689,57 @@ func (n *NinjaBot) Summary() {
 
 	fmt.Println()
 
+	fmt.Println("------ PERFORMANCE -------")
+	fmt.Println(n.Performance())
+
 	if n.paperWallet != nil {
 		n.paperWallet.Summary()
 	}
 
 }
 
+// Performance returns the risk and return metrics of the closed trades of all pairs, with the equity curve of
+// the paper wallet when available
+func (n *NinjaBot) Performance() metrics.PerformanceResult {
+	trades := make([]metrics.Trade, 0)
+	for _, summary := range n.orderController.Results {
+		trades = append(trades, summary.Trades...)
+	}
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].End.Before(trades[j].End)
+	})
+
+	var equity []metrics.EquityPoint
+	if n.paperWallet != nil {
+		for _, value := range n.paperWallet.EquityValues() {
+			equity = append(equity, metrics.EquityPoint{Time: value.Time, Value: value.Value})
+		}
+	}
+	return metrics.Performance(trades, equity)
+}
+
+// MonteCarlo resamples the sequence of closed trades of each pair, eg: after a backtest, and returns the
+// distributions of the final equity and the maximum drawdown starting from an initial equity, by pair. The
+// resampling uses the seed of the bot by default, see `WithSeed`.
+func (n *NinjaBot) MonteCarlo(initialEquity float64,
+	options ...metrics.MonteCarloOption) map[string]metrics.MonteCarloResult {
+	if n.seed != 0 {
+		options = append([]metrics.MonteCarloOption{metrics.WithMonteCarloSeed(n.seed)}, options...)
+	}
+
+	results := make(map[string]metrics.MonteCarloResult, len(n.orderController.Results))
+	for pair, summary := range n.orderController.Results {
+		results[pair] = metrics.MonteCarlo(summary.Profits, initialEquity, options...)
+	}
+	return results
+}
+
+// Rand returns the random source of the bot, seeded with the seed of the backtest, so strategies with random
+// decisions are reproducible by the manifest. It is not safe for concurrent use.
+func (n *NinjaBot) Rand() *rand.Rand {
+	return n.random
+}
+
 func (n NinjaBot) SaveReturns(outputDir string) error {
 	for _, summary := range n.orderController.Results {
 		outputFile := fmt.Sprintf("%s/%s.csv", outputDir, summary.Pair)
@@ -283,26 +750,158 @@ func (n NinjaBot) SaveReturns(outputDir string) error {
 	return nil
 }
 
-func (n *NinjaBot) onCandle(candle model.Candle) {
-	n.priorityQueueCandle.Push(candle)
-}
+// Export writes all the orders, the closed trades and the equity of the paper wallet to files of a format in
+// a directory: orders, trades and equity, eg: orders.csv. It is called after a backtest with WithExport, or on
+// demand in live mode.
+func (n *NinjaBot) Export(outputDir string, format export.Format) error {
+	orders, err := n.storage.Orders()
+	if err != nil {
+		return err
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].ID < orders[j].ID
+	})
+
+	trades := make([]export.Trade, 0)
+	for _, summary := range n.orderController.Results {
+		for _, trade := range summary.Trades {
+			trades = append(trades, export.Trade{
+				Pair:   summary.Pair,
+				Start:  trade.Start,
+				End:    trade.End,
+				Profit: trade.Profit,
+				MAE:    trade.MAE,
+				MFE:    trade.MFE,
+			})
+		}
+	}
+	sort.SliceStable(trades, func(i, j int) bool {
+		if trades[i].End.Equal(trades[j].End) {
+			return trades[i].Pair < trades[j].Pair
+		}
+		return trades[i].End.Before(trades[j].End)
+	})
 
-func (n *NinjaBot) processCandle(candle model.Candle) {
+	var equity []export.EquityPoint
 	if n.paperWallet != nil {
+		for _, value := range n.paperWallet.EquityValues() {
+			equity = append(equity, export.EquityPoint{Time: value.Time, Value: value.Value})
+		}
+	}
+
+	err = export.File(outputDir, "orders", format, func(w io.Writer) error {
+		return export.Orders(w, format, orders)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = export.File(outputDir, "trades", format, func(w io.Writer) error {
+		return export.Trades(w, format, trades)
+	})
+	if err != nil {
+		return err
+	}
+
+	return export.File(outputDir, "equity", format, func(w io.Writer) error {
+		return export.Equity(w, format, equity)
+	})
+}
+
+// SaveTrades writes the closed trades of each pair in a CSV file of the output directory, eg: BTCUSDT-trades.csv,
+// with the maximum adverse and favorable excursion of the price during each trade
+func (n NinjaBot) SaveTrades(outputDir string) error {
+	for _, summary := range n.orderController.Results {
+		outputFile := fmt.Sprintf("%s/%s-trades.csv", outputDir, summary.Pair)
+		if err := summary.SaveTrades(outputFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *NinjaBot) onCandle(timeframe string) func(candle model.Candle) {
+	interval, err := str2duration.ParseDuration(timeframe)
+	if err != nil {
+		log.Warnf("candles of timeframe %s are ordered by open time: %v", timeframe, err)
+	}
+
+	return func(candle model.Candle) {
+		n.priorityQueueCandle.Push(feedCandle{
+			Candle:    candle,
+			timeframe: timeframe,
+			interval:  interval,
+			fill:      n.fillTimeframe != "" && timeframe == n.fillTimeframe,
+		})
+	}
+}
+
+// processCandle executes a candle in the paper wallet, order controller and strategies. Warmup candles are
+// historical, so they are not evaluated by the risk guards, which value the live account.
+func (n *NinjaBot) processCandle(candle model.Candle, timeframe string, warmup bool) {
+	candle.Timeframe = timeframe
+	if n.backtest {
+		n.hashCandle(candle)
+	}
+
+	// repaired candles only replace the bar in the dataframes of the strategies, it was already executed
+	if candle.Repaired {
+		for _, controller := range n.feedControllers[feedKey(candle.Pair, timeframe)] {
+			controller.OnCandle(candle)
+		}
+		return
+	}
+
+	if n.paperWallet != nil && n.walletTimeframes[candle.Pair] == timeframe {
 		n.paperWallet.OnCandle(candle)
 	}
 
-	n.strategiesControllers[candle.Pair].OnPartialCandle(candle)
+	// candles of the fill timeframe only advance the clock, they are not published to the chart
+	if _, ok := n.feedControllers[feedKey(candle.Pair, timeframe)]; !ok && timeframe == n.fillTimeframe {
+		if subscriber, ok := n.clock.(CandleSubscriber); ok {
+			subscriber.OnCandle(candle)
+		}
+	} else {
+		n.publishCandle(candle)
+	}
+
 	if candle.Complete {
-		n.strategiesControllers[candle.Pair].OnCandle(candle)
 		n.orderController.OnCandle(candle)
+		if n.drawdown != nil && !warmup {
+			n.drawdown.OnCandle(candle)
+		}
+		if n.dailyLoss != nil && !warmup {
+			n.dailyLoss.OnCandle(candle)
+		}
+	}
+
+	for _, controller := range n.feedControllers[feedKey(candle.Pair, timeframe)] {
+		controller.OnPartialCandle(candle)
+		if candle.Complete {
+			controller.OnCandle(candle)
+		}
 	}
 }
 
-// Process pending candles in buffer
-func (n *NinjaBot) processCandles() {
-	for item := range n.priorityQueueCandle.PopLock() {
-		n.processCandle(item.(model.Candle))
+// Process pending candles in buffer, the processing is restarted by the supervisor on panics
+func (n *NinjaBot) processCandles(ctx context.Context) {
+	items := n.priorityQueueCandle.PopLock()
+	done := make(chan struct{})
+	n.supervisor.Go(ctx, "candles", func(_ context.Context) error {
+		for item := range items {
+			candle := item.(feedCandle)
+			n.processCandle(candle.Candle, candle.timeframe, false)
+			if candle.Complete && n.candleStore != nil {
+				n.storeCandle(candle.Candle, candle.timeframe, candle.interval)
+			}
+		}
+		close(done)
+		return nil
+	})
+
+	select {
+	case <-done:
+	case <-ctx.Done():
 	}
 }
 
@@ -311,18 +910,23 @@ func (n *NinjaBot) processCandles() {
 func (n *NinjaBot) backtestCandles() {
 	log.Info("[SETUP] Starting backtesting")
 
+	if n.debugger != nil {
+		defer n.debugger.Finish()
+	}
+
 	progressBar := progressbar.Default(int64(n.priorityQueueCandle.Len()))
 	for n.priorityQueueCandle.Len() > 0 {
 		item := n.priorityQueueCandle.Pop()
 
-		candle := item.(model.Candle)
-		if n.paperWallet != nil {
-			n.paperWallet.OnCandle(candle)
+		candle := item.(feedCandle)
+		if n.debugger != nil {
+			n.debugger.Wait()
 		}
 
-		n.strategiesControllers[candle.Pair].OnPartialCandle(candle)
-		if candle.Complete {
-			n.strategiesControllers[candle.Pair].OnCandle(candle)
+		n.processCandle(candle.Candle, candle.timeframe, false)
+
+		if n.debugger != nil {
+			n.debugger.Record(n.debugFrame(candle))
 		}
 
 		if err := progressBar.Add(1); err != nil {
@@ -331,48 +935,247 @@ func (n *NinjaBot) backtestCandles() {
 	}
 }
 
+// debugFrame returns the state of the backtest after a candle is processed
+func (n *NinjaBot) debugFrame(candle feedCandle) debugger.Frame {
+	frame := debugger.Frame{Candle: candle.Candle, Timeframe: candle.timeframe}
+
+	for key, controllers := range n.feedControllers {
+		pair, timeframe := splitFeedKey(key)
+		if pair != candle.Pair {
+			continue
+		}
+		for _, controller := range controllers {
+			if controller.Timeframe() != timeframe {
+				continue
+			}
+			if df, ok := controller.Dataframe(); ok {
+				frame.Dataframes = append(frame.Dataframes, debugger.NewDataframeView(df, timeframe, n.debugger.Rows()))
+			}
+		}
+	}
+
+	orders, err := n.storage.Orders(storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+	))
+	if err != nil {
+		log.Errorf("debugger: %v", err)
+	}
+	for _, order := range orders {
+		frame.Orders = append(frame.Orders, *order)
+	}
+
+	frame.Account, err = n.orderController.Account()
+	if err != nil {
+		log.Errorf("debugger: %v", err)
+	}
+
+	return frame
+}
+
 // Before Ninjabot start, we need to load the necessary data to fill strategy indicators
 // Then, we need to get the time frame and warmup period to fetch the necessary candles
-func (n *NinjaBot) preload(ctx context.Context, pair string) error {
+func (n *NinjaBot) preload(ctx context.Context, pair, timeframe string, warmup int) error {
 	if n.backtest {
 		return nil
 	}
 
-	candles, err := n.exchange.CandlesByLimit(ctx, pair, n.strategy.Timeframe(), n.strategy.WarmupPeriod())
-	if err != nil {
-		return err
+	feeder := service.Feeder(n.exchange)
+	if n.feeder != nil {
+		feeder = n.feeder
+	}
+
+	candles, ok := n.storedCandles(pair, timeframe, warmup)
+	if !ok {
+		var err error
+		candles, err = feeder.CandlesByLimit(ctx, pair, timeframe, warmup)
+		if err != nil {
+			return err
+		}
+		n.saveCandles(pair, timeframe, candles)
 	}
 
 	for _, candle := range candles {
-		n.processCandle(candle)
+		n.processCandle(candle, timeframe, true)
+	}
+
+	n.dataFeed.Preload(pair, timeframe, candles)
+
+	return nil
+}
+
+// addController registers a strategy controller in the data feed of its pair and timeframe
+func (n *NinjaBot) addController(pair string, str strategy.Strategy, broker service.Broker) *strategy.Controller {
+	controller := strategy.NewStrategyController(pair, str, broker)
+	if n.calendar != nil {
+		controller.SetCalendar(n.calendar)
 	}
 
-	n.dataFeed.Preload(pair, n.strategy.Timeframe(), candles)
+	// order updates and closed positions of the pair drive the lifecycle callbacks of the strategy
+	n.orderFeed.Subscribe(pair, controller.OnOrder, false)
+	event.Subscribe(n.bus, event.ClosedPositions, controller.OnPositionClosed)
 
+	// additional timeframes share the controller, only candles of the main timeframe execute the strategy
+	for _, timeframe := range append([]string{str.Timeframe()}, strategy.Timeframes(str)...) {
+		key := feedKey(pair, timeframe)
+		n.feedControllers[key] = append(n.feedControllers[key], controller)
+	}
+
+	// the paper wallet is updated by the fill timeframe or the first timeframe of each pair
+	if _, ok := n.walletTimeframes[pair]; !ok {
+		n.walletTimeframes[pair] = str.Timeframe()
+		if n.fillTimeframe != "" {
+			n.walletTimeframes[pair] = n.fillTimeframe
+		}
+	}
+
+	return controller
+}
+
+// orderExpirer is a broker that expires stale limit orders, eg: the order controller or an allocated broker
+type orderExpirer interface {
+	SetOrderTTL(lifetime time.Duration, action model.ExpireAction, callback order.ExpireFunc)
+}
+
+// setOrderTTL applies the order TTL of a strategy implementing strategy.ExpiringOrdersStrategy to its broker.
+// Strategies without allocation share the order controller, so the TTL of the last one is used.
+func setOrderTTL(str strategy.Strategy, broker service.Broker) error {
+	expiring, ok := str.(strategy.ExpiringOrdersStrategy)
+	if !ok {
+		return nil
+	}
+	expirer, ok := broker.(orderExpirer)
+	if !ok {
+		return nil
+	}
+
+	interval, err := str2duration.ParseDuration(str.Timeframe())
+	if err != nil {
+		return err
+	}
+
+	ttl := expiring.OrderTTL()
+	expirer.SetOrderTTL(ttl.Lifetime(interval), ttl.Action, func(expired model.Order, replacement *model.Order) {
+		expiring.OnOrderExpired(expired, replacement, broker)
+	})
 	return nil
 }
 
+// setPositionRules applies the break-even stops and the maximum entries of a strategy implementing
+// strategy.BreakEvenStrategy or strategy.PyramidingStrategy to its pairs
+func (n *NinjaBot) setPositionRules(str strategy.Strategy, pairs []string) {
+	if breakEven, ok := str.(strategy.BreakEvenStrategy); ok {
+		for _, pair := range pairs {
+			n.orderController.SetBreakEven(pair, breakEven.BreakEven())
+		}
+	}
+	if pyramiding, ok := str.(strategy.PyramidingStrategy); ok {
+		for _, pair := range pairs {
+			n.orderController.SetMaxEntries(pair, pyramiding.MaxEntries())
+		}
+	}
+}
+
 // Run will initialize the strategy controller, order controller, preload data and start the bot
 func (n *NinjaBot) Run(ctx context.Context) error {
-	for _, pair := range n.settings.Pairs {
-		// setup and subscribe strategy to data feed (candles)
-		n.strategiesControllers[pair] = strategy.NewStrategyController(pair, n.strategy, n.orderController)
+	// setup strategies controllers
+	for _, pair := range n.strategyPairs {
+		n.strategiesControllers[pair] = n.addController(pair, n.strategy, n.orderController)
+	}
+	if len(n.strategyPairs) > 0 {
+		if err := setOrderTTL(n.strategy, n.orderController); err != nil {
+			return err
+		}
+		n.setPositionRules(n.strategy, n.strategyPairs)
+	}
+
+	for _, str := range n.strategies {
+		var broker service.Broker = n.orderController
+		if str.allocation.Fixed > 0 || str.allocation.Percent > 0 {
+			broker = n.orderController.Allocate(str.name, str.allocation)
+		}
+		if err := setOrderTTL(str.strategy, broker); err != nil {
+			return err
+		}
+		n.setPositionRules(str.strategy, str.pairs)
+
+		for _, pair := range str.pairs {
+			str.controllers[pair] = n.addController(pair, str.strategy, broker)
+		}
+	}
+
+	// preload candles for warmup period, once per data feed
+	for key, controllers := range n.feedControllers {
+		pair, timeframe := splitFeedKey(key)
+		warmup := 0
+		for _, controller := range controllers {
+			if controller.WarmupPeriod() > warmup {
+				warmup = controller.WarmupPeriod()
+			}
+		}
 
-		// preload candles for warmup period
-		err := n.preload(ctx, pair)
+		err := n.preload(ctx, pair, timeframe, warmup)
 		if err != nil {
 			return err
 		}
 
 		// link to ninja bot controller
-		n.dataFeed.Subscribe(pair, n.strategy.Timeframe(), n.onCandle, false)
+		n.dataFeed.Subscribe(pair, timeframe, n.onCandle(timeframe), false)
 
-		// start strategy controller
-		n.strategiesControllers[pair].Start()
+		// start strategy controllers
+		for _, controller := range controllers {
+			controller.Start()
+		}
+	}
+
+	// the paper wallet is updated by the fill timeframe, which has no strategies
+	if n.fillTimeframe != "" {
+		for pair := range n.walletTimeframes {
+			if _, ok := n.feedControllers[feedKey(pair, n.fillTimeframe)]; !ok {
+				n.dataFeed.Subscribe(pair, n.fillTimeframe, n.onCandle(n.fillTimeframe), false)
+			}
+		}
+	}
+
+	// live goroutines are monitored and restarted on failures
+	if !n.backtest {
+		n.supervisor.SetNotifier(n.notifier)
+		n.orderFeed.SetSupervisor(n.supervisor)
+		n.dataFeed.SetSupervisor(n.supervisor)
+
+		// stale streams are reconnected by the watchdog
+		if n.watchdog != nil {
+			n.watchdog.SetNotifier(n.notifier)
+			n.dataFeed.SetWatchdog(n.watchdog, n.staleCandles)
+			n.orderController.SetWatchdog(n.watchdog, n.accountTimeout)
+			n.watchdog.Start(ctx)
+		}
 	}
 
 	// start order feed and controller
 	n.orderFeed.Start()
+
+	// restore runtime state after a restart, reconciling orders with the exchange
+	if !n.backtest {
+		pairs := make([]string, 0, len(n.walletTimeframes))
+		for pair := range n.walletTimeframes {
+			pairs = append(pairs, pair)
+		}
+		if err := n.orderController.Restore(pairs...); err != nil {
+			return err
+		}
+	}
+
+	if n.liveQuotes && !n.backtest {
+		pairs := make([]string, 0, len(n.walletTimeframes))
+		for pair := range n.walletTimeframes {
+			pairs = append(pairs, pair)
+		}
+		if err := n.orderController.SubscribeQuotes(pairs...); err != nil {
+			return err
+		}
+	}
+
 	n.orderController.Start()
 	defer n.orderController.Stop()
 	if n.telegram != nil {
@@ -385,9 +1188,9 @@ func (n *NinjaBot) Run(ctx context.Context) error {
 	// start processing new candles for production or backtesting environment
 	if n.backtest {
 		n.backtestCandles()
-	} else {
-		n.processCandles()
+		return n.finishBacktest()
 	}
 
+	n.processCandles(ctx)
 	return nil
 }
@@ -2,7 +2,11 @@ package ninjabot
 
 import (
 	"context"
+	"math/rand"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bengalm/ninjabot/strategy"
 
@@ -11,8 +15,11 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/order"
 	"github.com/bengalm/ninjabot/service"
 	"github.com/bengalm/ninjabot/storage"
+	"github.com/bengalm/ninjabot/tools/export"
 )
 
 type fakeStrategy struct{}
@@ -114,3 +121,348 @@ func TestMarketOrder(t *testing.T) {
 
 	bot.Summary()
 }
+
+func TestMultipleStrategies(t *testing.T) {
+	ctx := context.Background()
+
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	csvFeed, err := exchange.NewCSVFeed(
+		"1d",
+		exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		},
+		exchange.PairFeed{
+			Pair:      "ETHUSDT",
+			File:      "testdata/eth-1h.csv",
+			Timeframe: "1h",
+		},
+	)
+	require.NoError(t, err)
+
+	paperWallet := exchange.NewPaperWallet(
+		ctx,
+		"USDT",
+		exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithDataFeed(csvFeed),
+	)
+
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}},
+		paperWallet,
+		new(fakeStrategy),
+		WithStrategy("eth", new(fakeStrategy), order.Allocation{Fixed: 1000}, "ETHUSDT"),
+		WithStorage(storage),
+		WithBacktest(paperWallet),
+		WithLogLevel(log.ErrorLevel),
+	)
+	require.NoError(t, err)
+	require.Equal(t, []string{"BTCUSDT", "ETHUSDT"}, bot.settings.Pairs)
+	require.NoError(t, bot.Run(ctx))
+
+	require.NotEmpty(t, bot.orderController.Results["BTCUSDT"].Win())
+	require.NotEmpty(t, bot.orderController.Results["ETHUSDT"].Win())
+
+	// ETH strategy is limited by its allocation
+	for _, result := range bot.orderController.Results["ETHUSDT"].Win() {
+		require.Less(t, result, 1000.0)
+	}
+}
+
+// trendStrategy is an hourly strategy with a daily trend filter
+type trendStrategy struct {
+	executions int
+	lookahead  int
+	trend      int
+}
+
+func (e trendStrategy) Timeframe() string {
+	return "1h"
+}
+
+func (e trendStrategy) Timeframes() []string {
+	return []string{"1d"}
+}
+
+func (e trendStrategy) WarmupPeriod() int {
+	return 10
+}
+
+func (e trendStrategy) Indicators(_ *Dataframe) []strategy.ChartIndicator {
+	return nil
+}
+
+func (e *trendStrategy) OnCandle(df *Dataframe, _ service.Broker) {
+	e.executions++
+	daily := df.Timeframes["1d"]
+	if len(daily.Time) == 0 {
+		return
+	}
+	e.trend = len(daily.Close)
+
+	// the last daily candle must be closed before the hourly candle
+	if daily.Time[len(daily.Time)-1].Add(24 * time.Hour).After(df.Time[len(df.Time)-1].Add(time.Hour)) {
+		e.lookahead++
+	}
+}
+
+func TestMultipleTimeframes(t *testing.T) {
+	ctx := context.Background()
+
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	csvFeed, err := exchange.NewCSVFeed(
+		"1d",
+		exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		},
+	)
+	require.NoError(t, err)
+
+	paperWallet := exchange.NewPaperWallet(
+		ctx,
+		"USDT",
+		exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithDataFeed(csvFeed),
+	)
+
+	str := new(trendStrategy)
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}},
+		paperWallet,
+		str,
+		WithStorage(storage),
+		WithBacktest(paperWallet),
+		WithLogLevel(log.ErrorLevel),
+	)
+	require.NoError(t, err)
+	require.NoError(t, bot.Run(ctx))
+
+	// the strategy is executed on hourly candles only, with up to the warmup period of daily candles
+	require.Positive(t, str.executions)
+	require.Less(t, str.executions, len(csvFeed.CandlePairTimeFrame["BTCUSDT--1h"]))
+	require.Equal(t, str.WarmupPeriod(), str.trend)
+	require.Zero(t, str.lookahead)
+}
+
+func TestFillTimeframe(t *testing.T) {
+	ctx := context.Background()
+
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	csvFeed, err := exchange.NewCSVFeed(
+		"1d",
+		exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		},
+	)
+	require.NoError(t, err)
+	days := len(csvFeed.CandlePairTimeFrame["BTCUSDT--1d"]) / 24
+
+	paperWallet := exchange.NewPaperWallet(
+		ctx,
+		"USDT",
+		exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithDataFeed(csvFeed),
+	)
+
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}},
+		paperWallet,
+		&fakeStrategy{},
+		WithStorage(storage),
+		WithBacktest(paperWallet),
+		WithFillTimeframe("1h"),
+		WithLogLevel(log.ErrorLevel),
+	)
+	require.NoError(t, err)
+	require.NoError(t, bot.Run(ctx))
+
+	// the daily strategy trades, while the wallet is updated by the hourly candles
+	require.Greater(t, len(paperWallet.EquityValues()), 23*days)
+	orders, err := storage.Orders()
+	require.NoError(t, err)
+	require.NotEmpty(t, orders)
+}
+
+func TestFeedCandle_Less(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	daily := feedCandle{
+		Candle:   model.Candle{Pair: "BTCUSDT", Time: start, Complete: true},
+		interval: 24 * time.Hour,
+	}
+	fill := feedCandle{
+		Candle:   model.Candle{Pair: "BTCUSDT", Time: start.Add(23 * time.Hour), Complete: true},
+		interval: time.Hour,
+		fill:     true,
+	}
+	hourly := fill
+	hourly.fill = false
+
+	// candles closed at the same time are processed from the higher timeframe, except fills
+	require.True(t, daily.Less(hourly))
+	require.True(t, fill.Less(daily))
+	require.False(t, daily.Less(fill))
+}
+
+// backtestBTC runs the fake strategy in the hourly BTCUSDT candles, with a daily timeframe
+func backtestBTC(t *testing.T, options ...Option) (*NinjaBot, error) {
+	ctx := context.Background()
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	csvFeed, err := exchange.NewCSVFeed(
+		"1d",
+		exchange.PairFeed{
+			Pair:      "BTCUSDT",
+			File:      "testdata/btc-1h.csv",
+			Timeframe: "1h",
+		},
+	)
+	require.NoError(t, err)
+
+	paperWallet := exchange.NewPaperWallet(
+		ctx,
+		"USDT",
+		exchange.WithPaperAsset("USDT", 10000),
+		exchange.WithPaperFee(0.001, 0.001),
+		exchange.WithDataFeed(csvFeed),
+	)
+
+	options = append(options, WithStorage(storage), WithBacktest(paperWallet), WithLogLevel(log.ErrorLevel))
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, paperWallet, &fakeStrategy{}, options...)
+	require.NoError(t, err)
+	return bot, bot.Run(ctx)
+}
+
+func TestManifest(t *testing.T) {
+	backtest := func(options ...Option) (*NinjaBot, error) {
+		return backtestBTC(t, options...)
+	}
+
+	path := t.TempDir() + "/manifest.json"
+	bot, err := backtest(WithSeed(42), WithManifest(path))
+	require.NoError(t, err)
+
+	manifest, err := LoadManifest(path)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), manifest.Seed)
+	require.NotEmpty(t, manifest.DataHash)
+	require.Greater(t, manifest.Candles, 0)
+	require.Greater(t, manifest.Result.Orders, 0)
+	require.Equal(t, "*ninjabot.fakeStrategy", manifest.Strategies[0].Type)
+	require.Equal(t, 0.001, manifest.Wallet.TakerFee)
+	require.Equal(t, 10000.0, manifest.Wallet.Assets["USDT"])
+
+	current, err := bot.Manifest()
+	require.NoError(t, err)
+	require.Empty(t, manifest.Diff(current))
+
+	t.Run("random source", func(t *testing.T) {
+		other, err := backtest(WithSeed(42))
+		require.NoError(t, err)
+		require.Equal(t, rand.New(rand.NewSource(42)).Int63(), other.Rand().Int63())
+	})
+
+	t.Run("verify", func(t *testing.T) {
+		_, err := backtest(WithVerifyManifest(manifest))
+		require.NoError(t, err)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		changed := *manifest
+		changed.Result.FinalEquity++
+		changed.DataHash = "other"
+
+		_, err := backtest(WithVerifyManifest(&changed))
+		require.ErrorIs(t, err, ErrManifestMismatch)
+		require.Contains(t, err.Error(), "data")
+		require.Contains(t, err.Error(), "final equity")
+	})
+}
+
+func TestExport(t *testing.T) {
+	dir := t.TempDir()
+	bot, err := backtestBTC(t, WithExport(dir, export.CSV))
+	require.NoError(t, err)
+
+	orders, err := os.ReadFile(dir + "/orders.csv")
+	require.NoError(t, err)
+	stored, err := bot.storage.Orders()
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(string(orders)), "\n"), len(stored)+1)
+
+	equity, err := os.ReadFile(dir + "/equity.csv")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(equity), "time,value\n"))
+
+	trades, err := os.ReadFile(dir + "/trades.csv")
+	require.NoError(t, err)
+	require.Contains(t, string(trades), "BTCUSDT")
+
+	// on demand, eg: live mode
+	require.NoError(t, bot.Export(dir, export.Parquet))
+	_, err = os.Stat(dir + "/trades.parquet")
+	require.NoError(t, err)
+}
+
+// warmupFeeder returns the same candles for any warmup request
+type warmupFeeder struct {
+	service.Feeder
+	candles []model.Candle
+}
+
+func (f warmupFeeder) CandlesByLimit(_ context.Context, _, _ string, _ int) ([]model.Candle, error) {
+	return f.candles, nil
+}
+
+func TestPreload_RiskGuards(t *testing.T) {
+	ctx := context.Background()
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := make([]model.Candle, 0)
+	for i := 0; i < 10; i++ {
+		candles = append(candles, model.Candle{
+			Pair:     "BTCUSDT",
+			Time:     start.Add(time.Duration(i) * 24 * time.Hour),
+			Close:    float64(100 - 5*i),
+			Complete: true,
+		})
+	}
+
+	feeder := warmupFeeder{candles: candles}
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 0),
+		exchange.WithPaperAsset("BTC", 1), exchange.WithDataFeed(feeder))
+	bot, err := NewBot(ctx, Settings{Pairs: []string{"BTCUSDT"}}, wallet, &fakeStrategy{},
+		WithStorage(storage),
+		WithPaperWallet(wallet),
+		WithFeeder(feeder),
+		WithMaxDrawdown(0.2),
+		WithLogLevel(log.ErrorLevel),
+	)
+	require.NoError(t, err)
+
+	// the holdings are not valued with the closes of the warmup, which fall 45%
+	require.NoError(t, bot.preload(ctx, "BTCUSDT", "1d", 10))
+	require.False(t, bot.DrawdownGuard().Halted())
+	require.Zero(t, bot.DrawdownGuard().Drawdown())
+
+	// live candles are evaluated from the first one
+	live := candles[9]
+	live.Time = live.Time.Add(24 * time.Hour)
+	bot.processCandle(live, "1d", false)
+	require.Zero(t, bot.DrawdownGuard().Drawdown())
+
+	live.Time = live.Time.Add(24 * time.Hour)
+	live.Close = 40
+	bot.processCandle(live, "1d", false)
+	require.True(t, bot.DrawdownGuard().Halted())
+}
@@ -15,11 +15,14 @@ import (
 	"github.com/bengalm/ninjabot/model"
 	"github.com/bengalm/ninjabot/order"
 	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/tools/metrics"
 )
 
 var (
-	buyRegexp  = regexp.MustCompile(`/buy\s+(?P<pair>\w+)\s+(?P<amount>\d+(?:\.\d+)?)(?P<percent>%)?`)
-	sellRegexp = regexp.MustCompile(`/sell\s+(?P<pair>\w+)\s+(?P<amount>\d+(?:\.\d+)?)(?P<percent>%)?`)
+	buyRegexp    = regexp.MustCompile(`/buy\s+(?P<pair>\w+)\s+(?P<amount>\d+(?:\.\d+)?)(?P<percent>%)?`)
+	sellRegexp   = regexp.MustCompile(`/sell\s+(?P<pair>\w+)\s+(?P<amount>\d+(?:\.\d+)?)(?P<percent>%)?`)
+	pauseRegexp  = regexp.MustCompile(`/pause\s+(?P<pair>\w+)(?:\s+(?P<mode>entries|all))?`)
+	resumeRegexp = regexp.MustCompile(`/resume\s+(?P<pair>\w+)`)
 )
 
 type telegram struct {
@@ -77,8 +80,11 @@ func NewTelegram(controller *order.Controller, settings model.Settings, options
 		{Text: "/status", Description: "Check bot status"},
 		{Text: "/balance", Description: "Wallet balance"},
 		{Text: "/profit", Description: "Summary of last trade results"},
+		{Text: "/position", Description: "Exposure of open positions"},
 		{Text: "/buy", Description: "open a buy order"},
 		{Text: "/sell", Description: "open a sell order"},
+		{Text: "/pause", Description: "pause entries (or all orders) of a pair"},
+		{Text: "/resume", Description: "resume orders of a pair"},
 	})
 	if err != nil {
 		return nil, err
@@ -106,8 +112,11 @@ func NewTelegram(controller *order.Controller, settings model.Settings, options
 	client.Handle("/status", bot.StatusHandle)
 	client.Handle("/balance", bot.BalanceHandle)
 	client.Handle("/profit", bot.ProfitHandle)
+	client.Handle("/position", bot.PositionHandle)
 	client.Handle("/buy", bot.BuyHandle)
 	client.Handle("/sell", bot.SellHandle)
+	client.Handle("/pause", bot.PauseHandle)
+	client.Handle("/resume", bot.ResumeHandle)
 
 	return bot, nil
 }
@@ -176,6 +185,43 @@ func (t telegram) BalanceHandle(m *tb.Message) {
 	}
 }
 
+func (t telegram) PositionHandle(m *tb.Message) {
+	message := "*POSITIONS*\n"
+	open := 0
+	for _, pair := range t.settings.Pairs {
+		risk, err := t.orderController.PositionRisk(pair)
+		if err != nil {
+			log.Error(err)
+			t.OnError(err)
+			return
+		}
+
+		if risk.Size == 0 {
+			continue
+		}
+
+		open++
+		message += fmt.Sprintf("%s: `%.4f` @ `%.4f`, mark: `%.4f`, PnL: `%.2f`", pair, risk.Size,
+			risk.EntryPrice, risk.MarkPrice, risk.UnrealizedPnL)
+		if risk.LiquidationPrice > 0 {
+			message += fmt.Sprintf(", liquidation: `%.4f`", risk.LiquidationPrice)
+		}
+		if risk.Margin > 0 {
+			message += fmt.Sprintf(", margin: `%.2f`", risk.Margin)
+		}
+		message += "\n"
+	}
+
+	if open == 0 {
+		message = "No open positions."
+	}
+
+	_, err := t.client.Send(m.Sender, message)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
 func (t telegram) HelpHandle(m *tb.Message) {
 	commands, err := t.client.GetCommands()
 	if err != nil {
@@ -205,7 +251,9 @@ func (t telegram) ProfitHandle(m *tb.Message) {
 	}
 
 	for pair, summary := range t.orderController.Results {
-		_, err := t.client.Send(m.Sender, fmt.Sprintf("*PAIR*: `%s`\n`%s`", pair, summary.String()))
+		performance := metrics.Performance(summary.Trades, nil)
+		_, err := t.client.Send(m.Sender, fmt.Sprintf("*PAIR*: `%s`\n`%s`\n`%s`", pair, summary.String(),
+			performance.String()))
 		if err != nil {
 			log.Error(err)
 		}
@@ -316,7 +364,53 @@ func (t telegram) SellHandle(m *tb.Message) {
 
 func (t telegram) StatusHandle(m *tb.Message) {
 	status := t.orderController.Status()
-	_, err := t.client.Send(m.Sender, fmt.Sprintf("Status: `%s`", status))
+	message := fmt.Sprintf("Status: `%s`", status)
+	for pair, mode := range t.orderController.PausedPairs() {
+		message += fmt.Sprintf("\n%s: `%s`", pair, mode)
+	}
+
+	_, err := t.client.Send(m.Sender, message)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func (t telegram) PauseHandle(m *tb.Message) {
+	match := pauseRegexp.FindStringSubmatch(m.Text)
+	if len(match) == 0 {
+		_, err := t.client.Send(m.Sender, "Invalid command.\nExamples of usage:\n`/pause BTCUSDT`\n\n`/pause BTCUSDT all`")
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	pair := strings.ToUpper(match[1])
+	mode := model.PauseEntries
+	if match[2] == "all" {
+		mode = model.PauseAll
+	}
+
+	t.orderController.Pause(pair, mode)
+	_, err := t.client.Send(m.Sender, fmt.Sprintf("%s: `%s`", pair, mode), t.defaultMenu)
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func (t telegram) ResumeHandle(m *tb.Message) {
+	match := resumeRegexp.FindStringSubmatch(m.Text)
+	if len(match) == 0 {
+		_, err := t.client.Send(m.Sender, "Invalid command.\nExample of usage:\n`/resume BTCUSDT`")
+		if err != nil {
+			log.Error(err)
+		}
+		return
+	}
+
+	pair := strings.ToUpper(match[1])
+	t.orderController.Resume(pair)
+	_, err := t.client.Send(m.Sender, fmt.Sprintf("%s: `%s`", pair, model.PauseNone), t.defaultMenu)
 	if err != nil {
 		log.Error(err)
 	}
@@ -0,0 +1,476 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+)
+
+var ErrInsufficientAllocation = errors.New("insufficient strategy allocation")
+
+// Allocation defines the capital budget of a strategy, in the quote currency of its pairs
+type Allocation struct {
+	// Fixed is a fixed amount of capital, eg: 1000 USDT. Realized profits and losses are added to the budget.
+	Fixed float64
+	// Percent is a fraction of the account equity, between 0 and 1
+	Percent float64
+}
+
+// AllocatedBroker is a broker with an isolated capital budget. Positions and available capital are
+// tracked per strategy, so strategies sharing an account do not see or use each other's funds.
+type AllocatedBroker struct {
+	*Controller
+	name       string
+	allocation Allocation
+
+	mtx      sync.Mutex
+	quantity map[string]float64
+	cost     map[string]float64
+	realized float64
+	ttl      *orderTTL
+}
+
+// Allocate creates a broker for a strategy with a given capital allocation
+func (c *Controller) Allocate(name string, allocation Allocation) *AllocatedBroker {
+	return &AllocatedBroker{
+		Controller: c,
+		name:       name,
+		allocation: allocation,
+		quantity:   make(map[string]float64),
+		cost:       make(map[string]float64),
+	}
+}
+
+func (c *Controller) ownerKey(pair string, id int64) string {
+	return fmt.Sprintf("%s-%d", pair, id)
+}
+
+// ownedOrder is an order created by a strategy with an allocation, with the executed quantity already applied
+// to the allocation
+type ownedOrder struct {
+	owner    *AllocatedBroker
+	executed float64
+}
+
+func (c *Controller) registerOwner(order model.Order, owner *AllocatedBroker) {
+	c.ownersMtx.Lock()
+	defer c.ownersMtx.Unlock()
+
+	// modified orders keep the executed quantity already applied
+	key := c.ownerKey(order.Pair, order.ExchangeID)
+	if _, ok := c.owners[key]; !ok {
+		c.owners[key] = &ownedOrder{owner: owner}
+	}
+}
+
+// trackOwner registers an order placed by the controller on behalf of a strategy, eg: the exits of a bracket,
+// applying the quantity already executed. Orders without an owner are ignored.
+func (c *Controller) trackOwner(order model.Order, owner *AllocatedBroker) {
+	if owner == nil {
+		return
+	}
+	c.registerOwner(order, owner)
+	c.notifyOwner(order)
+}
+
+// notifyOwner updates the allocation of the strategy that created an order with its new executed quantity,
+// partial fills included. The owner is dropped when the order is closed.
+func (c *Controller) notifyOwner(order model.Order) {
+	executed := order.Executed
+	if executed == 0 && order.Status == model.OrderStatusTypeFilled {
+		executed = order.Quantity
+	}
+
+	c.ownersMtx.Lock()
+	key := c.ownerKey(order.Pair, order.ExchangeID)
+	owned, ok := c.owners[key]
+	if !ok {
+		c.ownersMtx.Unlock()
+		return
+	}
+	quantity := executed - owned.executed
+	owned.executed = math.Max(executed, owned.executed)
+	switch order.Status {
+	case model.OrderStatusTypeFilled, model.OrderStatusTypeCanceled, model.OrderStatusTypeRejected,
+		model.OrderStatusTypeExpired:
+		delete(c.owners, key)
+	}
+	c.ownersMtx.Unlock()
+
+	if quantity > 0 {
+		owned.owner.onFill(order, quantity)
+	}
+}
+
+// equity returns the account value in a given quote currency, using the last known prices
+func (c *Controller) equity(quote string) (float64, error) {
+	account, err := c.exchange.Account()
+	if err != nil {
+		return 0, err
+	}
+
+	var total float64
+	for _, balance := range account.Balances {
+		amount := balance.Free + balance.Lock
+		if balance.Asset == quote {
+			total += amount
+			continue
+		}
+
+		if amount == 0 {
+			continue
+		}
+
+		price, err := c.price(balance.Asset + quote)
+		if err != nil {
+			continue
+		}
+		total += amount * price
+	}
+	return total, nil
+}
+
+func (c *Controller) price(pair string) (float64, error) {
+	if price, ok := c.lastPrice[pair]; ok && price > 0 {
+		return price, nil
+	}
+	return c.exchange.LastQuote(c.ctx, pair)
+}
+
+// Name returns the strategy name of the allocation
+func (a *AllocatedBroker) Name() string {
+	return a.name
+}
+
+// Capital returns the total budget of the strategy, including the capital in open positions
+func (a *AllocatedBroker) Capital(pair string) (float64, error) {
+	if a.allocation.Percent > 0 {
+		_, quote := exchange.SplitAssetQuote(pair)
+		equity, err := a.Controller.equity(quote)
+		if err != nil {
+			return 0, err
+		}
+		return equity * a.allocation.Percent, nil
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.allocation.Fixed + a.realized, nil
+}
+
+// Available returns the capital not used by open positions of the strategy
+func (a *AllocatedBroker) Available(pair string) (float64, error) {
+	capital, err := a.Capital(pair)
+	if err != nil {
+		return 0, err
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	used := 0.0
+	for _, cost := range a.cost {
+		used += cost
+	}
+	return math.Max(capital-used, 0), nil
+}
+
+// Position returns the position of the strategy and its available capital, instead of the account balance
+func (a *AllocatedBroker) Position(pair string) (asset, quote float64, err error) {
+	quote, err = a.Available(pair)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.quantity[pair], quote, nil
+}
+
+// PositionRisk returns the position of the strategy, with the entry price of its own fills. Account details,
+// eg: the liquidation price, are kept and unrealized PnL is computed from the mark price when available.
+func (a *AllocatedBroker) PositionRisk(pair string) (model.PositionRisk, error) {
+	risk, err := a.Controller.PositionRisk(pair)
+	if err != nil {
+		return model.PositionRisk{}, err
+	}
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	risk.Size = a.quantity[pair]
+	risk.EntryPrice = 0
+	risk.UnrealizedPnL = 0
+	if risk.Size != 0 {
+		risk.EntryPrice = a.cost[pair] / math.Abs(risk.Size)
+		if risk.MarkPrice > 0 {
+			risk.UnrealizedPnL = (risk.MarkPrice - risk.EntryPrice) * risk.Size
+		}
+	}
+	return risk, nil
+}
+
+func (a *AllocatedBroker) checkEntry(side model.SideType, pair string, size, price float64) error {
+	a.mtx.Lock()
+	quantity := a.quantity[pair]
+	a.mtx.Unlock()
+
+	if !model.IsEntry(side, quantity) {
+		return nil
+	}
+
+	if price == 0 {
+		var err error
+		price, err = a.Controller.price(pair)
+		if err != nil {
+			return err
+		}
+	}
+
+	available, err := a.Available(pair)
+	if err != nil {
+		return err
+	}
+
+	if size*price > available {
+		return fmt.Errorf("%w: %s requires %.4f, available %.4f", ErrInsufficientAllocation, a.name,
+			size*price, available)
+	}
+	return nil
+}
+
+// track updates the allocation with the executed quantity of a new order, and registers it to be updated
+// with its fills
+func (a *AllocatedBroker) track(order model.Order) {
+	a.Controller.trackOwner(order, a)
+}
+
+// expireLater registers a limit order of the strategy with its TTL, or the TTL of the controller
+func (a *AllocatedBroker) expireLater(order model.Order) {
+	a.mtx.Lock()
+	ttl := a.ttl
+	a.mtx.Unlock()
+
+	if ttl == nil {
+		ttl = a.Controller.defaultTTL()
+	}
+	a.Controller.expireLater(order, ttl, a)
+}
+
+// onFill applies a quantity executed by an order of the strategy to its allocation
+func (a *AllocatedBroker) onFill(order model.Order, executed float64) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	price := order.Price
+	if order.Stop != nil && (order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit) {
+		price = *order.Stop
+	}
+
+	direction := 1.0
+	if order.Side == model.SideTypeSell {
+		direction = -1.0
+	}
+
+	quantity := a.quantity[order.Pair]
+	remaining := executed
+	if !model.IsEntry(order.Side, quantity) {
+		closed := math.Min(math.Abs(quantity), remaining)
+		avgPrice := a.cost[order.Pair] / math.Abs(quantity)
+		// direction is opposite to the position, so the profit of a long position is (price - avg)
+		a.realized += (price - avgPrice) * closed * -direction
+		a.cost[order.Pair] -= avgPrice * closed
+		a.quantity[order.Pair] += closed * direction
+		remaining -= closed
+	}
+
+	if remaining > 0 {
+		a.cost[order.Pair] += remaining * price
+		a.quantity[order.Pair] += remaining * direction
+	}
+
+	if a.quantity[order.Pair] == 0 {
+		delete(a.quantity, order.Pair)
+		delete(a.cost, order.Pair)
+	}
+}
+
+func (a *AllocatedBroker) CreateOrderLimit(side model.SideType, pair string, size, limit float64) (model.Order, error) {
+	if err := a.checkEntry(side, pair, size, limit); err != nil {
+		return model.Order{}, err
+	}
+
+	order, err := a.Controller.CreateOrderLimit(side, pair, size, limit)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(order)
+	a.expireLater(order)
+	return order, nil
+}
+
+func (a *AllocatedBroker) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForceType) (model.Order, error) {
+	if err := a.checkEntry(side, pair, size, limit); err != nil {
+		return model.Order{}, err
+	}
+
+	order, err := a.Controller.CreateOrderLimitTIF(side, pair, size, limit, timeInForce)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(order)
+	a.expireLater(order)
+	return order, nil
+}
+
+func (a *AllocatedBroker) CreateOrderLimitOptions(side model.SideType, pair string, size, limit float64,
+	options model.OrderOptions) (model.Order, error) {
+	if err := a.checkEntry(side, pair, size, limit); err != nil {
+		return model.Order{}, err
+	}
+
+	order, err := a.Controller.CreateOrderLimitOptions(side, pair, size, limit, options)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(order)
+	a.expireLater(order)
+	return order, nil
+}
+
+func (a *AllocatedBroker) CreateOrderMarket(side model.SideType, pair string, size float64,
+	reduceOnly bool) (model.Order, error) {
+	if !reduceOnly {
+		if err := a.checkEntry(side, pair, size, 0); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	order, err := a.Controller.CreateOrderMarket(side, pair, size, reduceOnly)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(order)
+	return order, nil
+}
+
+func (a *AllocatedBroker) CreateOrderMarketQuote(side model.SideType, pair string,
+	amount float64) (model.Order, error) {
+	a.mtx.Lock()
+	quantity := a.quantity[pair]
+	a.mtx.Unlock()
+
+	if model.IsEntry(side, quantity) {
+		available, err := a.Available(pair)
+		if err != nil {
+			return model.Order{}, err
+		}
+		if amount > available {
+			return model.Order{}, fmt.Errorf("%w: %s requires %.4f, available %.4f", ErrInsufficientAllocation,
+				a.name, amount, available)
+		}
+	}
+
+	order, err := a.Controller.CreateOrderMarketQuote(side, pair, amount)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(order)
+	return order, nil
+}
+
+func (a *AllocatedBroker) CreateOrderOCO(side model.SideType, pair string, size, price, stop,
+	stopLimit float64) ([]model.Order, error) {
+	orders, err := a.Controller.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range orders {
+		a.track(order)
+	}
+	return orders, nil
+}
+
+func (a *AllocatedBroker) CreateOrderStop(pair string, size float64, limit float64) (model.Order, error) {
+	order, err := a.Controller.CreateOrderStop(pair, size, limit)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(order)
+	return order, nil
+}
+
+func (a *AllocatedBroker) CreateOrderTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64) (model.Order, error) {
+	order, err := a.Controller.CreateOrderTrailingStop(side, pair, quantity, activation, callbackRate)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(order)
+	return order, nil
+}
+
+func (a *AllocatedBroker) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	if quantity > order.Quantity {
+		if price <= 0 {
+			price = order.Price
+		}
+		if err := a.checkEntry(order.Side, order.Pair, quantity-order.Quantity, price); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	modified, err := a.Controller.ModifyOrder(order, price, quantity)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(modified)
+	return modified, nil
+}
+
+func (a *AllocatedBroker) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (model.Order, error) {
+	order, err := a.Controller.TakeProfit(side, pair, quantity, limit)
+	if err != nil {
+		return model.Order{}, err
+	}
+	a.track(order)
+	return order, nil
+}
+
+func (a *AllocatedBroker) CreateBracket(side model.SideType, pair string, quantity, entry, stop,
+	target float64) (Bracket, error) {
+	if err := a.checkEntry(side, pair, quantity, entry); err != nil {
+		return Bracket{}, err
+	}
+	return a.Controller.createBracket(a, side, pair, quantity, entry, stop, target)
+}
+
+func (a *AllocatedBroker) CreateLadder(side model.SideType, pair string, basePrice, quantity float64,
+	rungs []LadderRung, takeProfit float64) (Ladder, error) {
+	// the rungs are checked together, as all of them may fill
+	var size, cost float64
+	for _, rung := range rungs {
+		size += rung.size(quantity)
+		cost += rung.size(quantity) * rung.price(side, basePrice)
+	}
+	if size > 0 {
+		if err := a.checkEntry(side, pair, size, cost/size); err != nil {
+			return Ladder{}, err
+		}
+	}
+	return a.Controller.createLadder(a, side, pair, basePrice, quantity, rungs, takeProfit)
+}
+
+func (a *AllocatedBroker) CreateSoftTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64, exit TrailingExit) (TrailingStop, error) {
+	if err := a.checkEntry(side, pair, quantity, activation); err != nil {
+		return TrailingStop{}, err
+	}
+	return a.Controller.createSoftTrailingStop(a, side, pair, quantity, activation, callbackRate, exit)
+}
@@ -0,0 +1,161 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestAllocatedBroker(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	t.Run("fixed allocation", func(t *testing.T) {
+		broker := controller.Allocate("trend", Allocation{Fixed: 2000})
+
+		asset, quote, err := broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+		require.Equal(t, 2000.0, quote)
+
+		_, err = broker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 3, false)
+		require.ErrorIs(t, err, ErrInsufficientAllocation)
+
+		_, err = broker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1.5, false)
+		require.NoError(t, err)
+
+		asset, quote, err = broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.5, asset)
+		require.Equal(t, 500.0, quote)
+
+		// sell with profit, realized profit is added to the budget
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1200})
+		controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1200})
+		_, err = broker.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1.5, false)
+		require.NoError(t, err)
+
+		asset, quote, err = broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+		require.InDelta(t, 2300.0, quote, 1e-6)
+	})
+
+	t.Run("percent allocation", func(t *testing.T) {
+		broker := controller.Allocate("mean-reversion", Allocation{Percent: 0.1})
+		_, quote, err := broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.InDelta(t, 1030.0, quote, 1e-6) // 10% of 10300 USDT
+	})
+
+	t.Run("position risk", func(t *testing.T) {
+		broker := controller.Allocate("breakout", Allocation{Fixed: 2000})
+		_, err := broker.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+
+		// another strategy buys at a higher price
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1300})
+		controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1300})
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+
+		risk, err := controller.PositionRisk("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 3.0, risk.Size)
+		require.InDelta(t, 1233.33, risk.EntryPrice, 0.01)
+		require.Equal(t, 1300.0, risk.MarkPrice)
+		require.InDelta(t, 200.0, risk.UnrealizedPnL, 1e-6)
+
+		risk, err = broker.PositionRisk("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, risk.Size)
+		require.Equal(t, 1200.0, risk.EntryPrice)
+		require.InDelta(t, 100.0, risk.UnrealizedPnL, 1e-6)
+	})
+}
+
+func TestAllocatedBroker_Fills(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	t.Run("partial fills", func(t *testing.T) {
+		broker := controller.Allocate("dca", Allocation{Fixed: 2000})
+		order := model.Order{ExchangeID: 100, Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeLimit,
+			Status: model.OrderStatusTypeNew, Price: 1000, Quantity: 1}
+		broker.track(order)
+
+		order.Status = model.OrderStatusTypePartiallyFilled
+		order.Executed = 0.4
+		controller.processTrade(&order)
+		controller.processTrade(&order)
+
+		asset, quote, err := broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.4, asset)
+		require.Equal(t, 1600.0, quote)
+
+		// the fills before the cancel are kept, and the owner is dropped
+		order.Status = model.OrderStatusTypeCanceled
+		order.Executed = 0.6
+		controller.processTrade(&order)
+
+		asset, _, err = broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.6, asset)
+		require.Empty(t, controller.owners)
+
+		rejected := model.Order{ExchangeID: 101, Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Type: model.OrderTypeLimit, Status: model.OrderStatusTypeNew, Price: 1000, Quantity: 1}
+		broker.track(rejected)
+		rejected.Status = model.OrderStatusTypeRejected
+		controller.processTrade(&rejected)
+		require.Empty(t, controller.owners)
+	})
+
+	t.Run("brackets, ladders and trailing stops", func(t *testing.T) {
+		broker := controller.Allocate("swing", Allocation{Fixed: 2000})
+
+		_, err := broker.CreateBracket(model.SideTypeBuy, "BTCUSDT", 3, 0, 900, 1200)
+		require.ErrorIs(t, err, ErrInsufficientAllocation)
+		_, err = broker.CreateLadder(model.SideTypeBuy, "BTCUSDT", 1000, 1,
+			[]LadderRung{{Offset: 0}, {Offset: 0.1, Multiplier: 2}}, 0.05)
+		require.ErrorIs(t, err, ErrInsufficientAllocation)
+		_, err = broker.CreateSoftTrailingStop(model.SideTypeSell, "BTCUSDT", 3, 0, 0.02, TrailingExitMarket)
+		require.ErrorIs(t, err, ErrInsufficientAllocation)
+
+		_, err = broker.CreateBracket(model.SideTypeBuy, "BTCUSDT", 1, 0, 900, 1200)
+		require.NoError(t, err)
+		asset, quote, err := broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, asset)
+		require.Equal(t, 1000.0, quote)
+
+		// the exits of the bracket close the position of the strategy
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1200, High: 1250, Low: 1100, Complete: true})
+		controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1200, High: 1250, Low: 1100, Complete: true})
+		controller.updateOrders()
+
+		asset, quote, err = broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+		require.InDelta(t, 2200.0, quote, 1e-6)
+		require.Empty(t, controller.owners)
+	})
+}
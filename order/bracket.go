@@ -0,0 +1,274 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+const bracketStateKey = "brackets"
+
+// ErrInvalidBracket is returned for brackets with the stop or the target on the wrong side of the entry
+var ErrInvalidBracket = errors.New("invalid bracket")
+
+// BracketStatus is the stage of a bracket order
+type BracketStatus string
+
+const (
+	// BracketPending waits for the fill of the entry order
+	BracketPending BracketStatus = "PENDING"
+	// BracketActive protects the position of the entry with stop and take profit orders
+	BracketActive BracketStatus = "ACTIVE"
+	// BracketClosed is a bracket whose position was closed
+	BracketClosed BracketStatus = "CLOSED"
+	// BracketCanceled is a bracket whose entry was canceled without fills
+	BracketCanceled BracketStatus = "CANCELED"
+)
+
+// Bracket is an entry order protected by a stop and a take profit order, armed when the entry fills
+type Bracket struct {
+	Pair     string         `json:"pair"`
+	Side     model.SideType `json:"side"`
+	Quantity float64        `json:"quantity"`
+	Entry    float64        `json:"entry"`
+	Stop     float64        `json:"stop"`
+	Target   float64        `json:"target"`
+	Status   BracketStatus  `json:"status"`
+	// EntryID and ExitIDs are the exchange IDs of the entry, and of the stop and take profit orders
+	EntryID int64   `json:"entry_id"`
+	ExitIDs []int64 `json:"exit_ids"`
+	// owner is the strategy allocation of the bracket orders, if any
+	owner *AllocatedBroker
+}
+
+// bracketBook keeps the open brackets, by pair and exchange ID of the entry
+type bracketBook struct {
+	mtx     sync.Mutex
+	entries map[string]*Bracket
+}
+
+func (b *bracketBook) SaveState() ([]byte, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return json.Marshal(b.entries)
+}
+
+func (b *bracketBook) RestoreState(data []byte) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	entries := make(map[string]*Bracket)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	if entries != nil {
+		b.entries = entries
+	}
+	return nil
+}
+
+// CreateBracket places an entry order, a limit order or a market order when the entry price is zero. When the
+// entry fills, the position is protected with an OCO order of stop and take profit, and the surviving orders
+// are canceled when the position is closed. Fills are followed with the order updates of the exchange, and
+// open brackets are persisted with the controller state.
+func (c *Controller) CreateBracket(side model.SideType, pair string, quantity, entry, stop,
+	target float64) (Bracket, error) {
+	return c.createBracket(nil, side, pair, quantity, entry, stop, target)
+}
+
+// createBracket places a bracket, tracking its orders in the allocation of the owner, if any
+func (c *Controller) createBracket(owner *AllocatedBroker, side model.SideType, pair string, quantity, entry,
+	stop, target float64) (Bracket, error) {
+	price := entry
+	if price <= 0 {
+		var err error
+		if price, err = c.price(pair); err != nil {
+			return Bracket{}, err
+		}
+	}
+	if (side == model.SideTypeBuy && (stop >= price || target <= price)) ||
+		(side == model.SideTypeSell && (stop <= price || target >= price)) {
+		return Bracket{}, fmt.Errorf("%w: %s at %f with stop %f and target %f", ErrInvalidBracket, side, price,
+			stop, target)
+	}
+
+	var order model.Order
+	var err error
+	if entry > 0 {
+		order, err = c.CreateOrderLimit(side, pair, quantity, entry)
+	} else {
+		order, err = c.CreateOrderMarket(side, pair, quantity, false)
+	}
+	if err != nil {
+		return Bracket{}, err
+	}
+	c.trackOwner(order, owner)
+
+	bracket := &Bracket{
+		Pair:     pair,
+		Side:     side,
+		Quantity: quantity,
+		Entry:    entry,
+		Stop:     stop,
+		Target:   target,
+		Status:   BracketPending,
+		EntryID:  order.ExchangeID,
+		owner:    owner,
+	}
+	c.brackets.mtx.Lock()
+	c.brackets.entries[c.ownerKey(pair, order.ExchangeID)] = bracket
+	c.brackets.mtx.Unlock()
+
+	// the entry may be filled before the registration of the bracket, eg: market orders
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	stored, err := c.storage.Orders(storage.WithPair(pair), storage.WithExchangeID(order.ExchangeID))
+	if err == nil && len(stored) > 0 {
+		c.updateBrackets(*stored[0])
+	}
+
+	c.brackets.mtx.Lock()
+	defer c.brackets.mtx.Unlock()
+	return *bracket, nil
+}
+
+// Brackets returns the open brackets of a pair
+func (c *Controller) Brackets(pair string) []Bracket {
+	c.brackets.mtx.Lock()
+	defer c.brackets.mtx.Unlock()
+
+	brackets := make([]Bracket, 0)
+	for _, bracket := range c.brackets.entries {
+		if bracket.Pair == pair {
+			brackets = append(brackets, *bracket)
+		}
+	}
+	return brackets
+}
+
+// updateBrackets arms, closes or cancels the brackets of the pair of an updated order, the caller must hold
+// the controller lock
+func (c *Controller) updateBrackets(order model.Order) {
+	c.brackets.mtx.Lock()
+	defer c.brackets.mtx.Unlock()
+
+	for key, bracket := range c.brackets.entries {
+		if bracket.Pair != order.Pair {
+			continue
+		}
+
+		switch {
+		case bracket.Status == BracketPending && order.ExchangeID == bracket.EntryID:
+			c.armBracket(bracket, order)
+		case bracket.Status == BracketActive && contains(bracket.ExitIDs, order.ExchangeID):
+			if order.Status == model.OrderStatusTypeFilled {
+				c.closeBracket(bracket, order.ExchangeID)
+			}
+		case bracket.Status == BracketActive && order.Status == model.OrderStatusTypeFilled:
+			// the position was closed by another order
+			if _, ok := c.positions.open(order.Pair); !ok {
+				c.closeBracket(bracket, 0)
+			}
+		}
+
+		if bracket.Status == BracketClosed || bracket.Status == BracketCanceled {
+			delete(c.brackets.entries, key)
+		}
+	}
+}
+
+// armBracket places the stop and take profit orders of a bracket when its entry fills
+func (c *Controller) armBracket(bracket *Bracket, entry model.Order) {
+	quantity := entry.Executed
+	switch entry.Status {
+	case model.OrderStatusTypeFilled:
+		if quantity == 0 {
+			quantity = entry.Quantity
+		}
+	case model.OrderStatusTypeCanceled, model.OrderStatusTypeExpired, model.OrderStatusTypeRejected:
+		// partially filled entries are protected with the executed quantity
+		if quantity == 0 {
+			bracket.Status = BracketCanceled
+			log.Infof("[BRACKET CANCELED] %s entry %d", bracket.Pair, bracket.EntryID)
+			return
+		}
+	default:
+		return
+	}
+
+	side := model.SideTypeSell
+	if bracket.Side == model.SideTypeSell {
+		side = model.SideTypeBuy
+	}
+
+	orders, err := c.placeOCO(side, bracket.Pair, quantity, bracket.Target, bracket.Stop, bracket.Stop)
+	if err != nil {
+		bracket.Status = BracketClosed
+		c.notify(fmt.Sprintf("[BRACKET] %s: position of %f not protected: %v\n", bracket.Pair, quantity, err))
+		return
+	}
+
+	bracket.Status = BracketActive
+	bracket.Quantity = quantity
+	for _, order := range orders {
+		bracket.ExitIDs = append(bracket.ExitIDs, order.ExchangeID)
+		c.trackOwner(order, bracket.owner)
+	}
+	log.Infof("[BRACKET ARMED] %s %f with stop %f and target %f", bracket.Pair, quantity, bracket.Stop,
+		bracket.Target)
+}
+
+// closeBracket cancels the open exit orders of a bracket, except a filled one
+func (c *Controller) closeBracket(bracket *Bracket, filledID int64) {
+	bracket.Status = BracketClosed
+	for _, id := range bracket.ExitIDs {
+		if id != filledID {
+			// exits grouped by the exchange are canceled with the fill of the other leg
+			c.cancelExit(bracket.Pair, id)
+		}
+	}
+	log.Infof("[BRACKET CLOSED] %s entry %d", bracket.Pair, bracket.EntryID)
+}
+
+// cancelExit cancels an open exit order, marking the stored order as pending cancel. It returns false when
+// the order is not open or not canceled. The caller must hold the controller lock.
+func (c *Controller) cancelExit(pair string, id int64) bool {
+	order, err := c.exchange.Order(pair, id)
+	if err != nil {
+		c.notifyError(err)
+		return false
+	}
+	if order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled {
+		return false
+	}
+
+	if err := c.exchange.Cancel(order); err != nil {
+		c.notifyError(err)
+		return false
+	}
+
+	stored, err := c.storage.Orders(storage.WithPair(pair), storage.WithExchangeID(id))
+	if err != nil || len(stored) == 0 {
+		return true
+	}
+	stored[0].Status = model.OrderStatusTypePendingCancel
+	if err := c.storage.UpdateOrder(stored[0]); err != nil {
+		c.notifyError(err)
+	}
+	return true
+}
+
+func contains(values []int64, value int64) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_Bracket(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newController := func(t *testing.T) (*Controller, *exchange.PaperWallet) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		first := model.Candle{Time: start, Pair: "BTCUSDT", Close: 100, Low: 100, High: 100}
+		wallet.OnCandle(first)
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		controller.OnCandle(first)
+		return controller, wallet
+	}
+
+	candle := func(wallet *exchange.PaperWallet, minutes int, low, close, high float64) {
+		wallet.OnCandle(model.Candle{Time: start.Add(time.Duration(minutes) * time.Minute), Pair: "BTCUSDT",
+			Open: close, Low: low, Close: close, High: high, Complete: true})
+	}
+
+	t.Run("limit entry", func(t *testing.T) {
+		controller, wallet := newController(t)
+
+		bracket, err := controller.CreateBracket(model.SideTypeBuy, "BTCUSDT", 1, 95, 90, 110)
+		require.NoError(t, err)
+		require.Equal(t, BracketPending, bracket.Status)
+
+		// entry filled: the stop and take profit are armed
+		candle(wallet, 1, 94, 95, 96)
+		controller.updateOrders()
+		brackets := controller.Brackets("BTCUSDT")
+		require.Len(t, brackets, 1)
+		require.Equal(t, BracketActive, brackets[0].Status)
+		require.Len(t, brackets[0].ExitIDs, 2)
+
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+
+		// take profit filled: the stop is canceled and the bracket closed
+		candle(wallet, 2, 105, 111, 112)
+		controller.updateOrders()
+		require.Empty(t, controller.Brackets("BTCUSDT"))
+
+		orders, err = wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 0.0, asset)
+	})
+
+	t.Run("market entry", func(t *testing.T) {
+		controller, wallet := newController(t)
+
+		bracket, err := controller.CreateBracket(model.SideTypeBuy, "BTCUSDT", 1, 0, 90, 110)
+		require.NoError(t, err)
+		require.Equal(t, BracketActive, bracket.Status)
+
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+	})
+
+	t.Run("canceled entry", func(t *testing.T) {
+		controller, _ := newController(t)
+
+		bracket, err := controller.CreateBracket(model.SideTypeBuy, "BTCUSDT", 1, 95, 90, 110)
+		require.NoError(t, err)
+
+		orders, err := controller.storage.Orders(storage.WithExchangeID(bracket.EntryID))
+		require.NoError(t, err)
+		require.NoError(t, controller.Cancel(*orders[0]))
+		controller.updateOrders()
+		require.Empty(t, controller.Brackets("BTCUSDT"))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		controller, _ := newController(t)
+
+		_, err := controller.CreateBracket(model.SideTypeBuy, "BTCUSDT", 1, 95, 96, 110)
+		require.ErrorIs(t, err, ErrInvalidBracket)
+		_, err = controller.CreateBracket(model.SideTypeSell, "BTCUSDT", 1, 95, 90, 80)
+		require.ErrorIs(t, err, ErrInvalidBracket)
+	})
+}
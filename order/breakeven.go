@@ -0,0 +1,95 @@
+package order
+
+import (
+	"fmt"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+// SetBreakEven moves the stop orders of the positions of a pair to the entry price, plus a fee buffer, once the
+// price reaches a gain, see `model.BreakEven`. Prices are checked with each complete candle. Stops of OCO
+// orders are not moved, since replacing a leg cancels the whole group. A zero value disables it.
+func (c *Controller) SetBreakEven(pair string, breakEven model.BreakEven) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if breakEven.RMultiple <= 0 && breakEven.Percent <= 0 {
+		delete(c.breakEven, pair)
+		return
+	}
+	c.breakEven[pair] = breakEven
+}
+
+// adjustBreakEven moves the stops of the position of the candle pair to break-even, the caller must hold the
+// controller lock
+func (c *Controller) adjustBreakEven(candle model.Candle) {
+	config, ok := c.breakEven[candle.Pair]
+	if !ok {
+		return
+	}
+	position, ok := c.positions.open(candle.Pair)
+	if !ok || position.AvgPrice <= 0 {
+		return
+	}
+
+	buffer := config.Buffer
+	if buffer <= 0 {
+		c.execution.mtx.Lock()
+		buffer = 2 * c.execution.feeRate
+		c.execution.mtx.Unlock()
+	}
+
+	long := position.Size > 0
+	exitSide, gain := model.SideTypeSell, candle.High-position.AvgPrice
+	breakEven := position.AvgPrice * (1 + buffer)
+	if !long {
+		exitSide, gain = model.SideTypeBuy, position.AvgPrice-candle.Low
+		breakEven = position.AvgPrice * (1 - buffer)
+	}
+
+	// a stop beyond the current price would be triggered immediately
+	if (long && candle.Close <= breakEven) || (!long && candle.Close >= breakEven) {
+		return
+	}
+
+	orders, err := c.storage.Orders(storage.WithPair(candle.Pair), storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+	))
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+
+	for _, order := range orders {
+		if order.Type != model.OrderTypeStopLoss && order.Type != model.OrderTypeStopLossLimit {
+			continue
+		}
+		if order.Side != exitSide || order.Stop == nil || order.GroupID != nil {
+			continue
+		}
+
+		// stops already at or beyond break-even are kept
+		stop := *order.Stop
+		if (long && stop >= breakEven) || (!long && stop <= breakEven) {
+			continue
+		}
+
+		risk := position.AvgPrice - stop
+		if !long {
+			risk = stop - position.AvgPrice
+		}
+
+		reached := (config.Percent > 0 && gain >= config.Percent*position.AvgPrice) ||
+			(config.RMultiple > 0 && risk > 0 && gain >= config.RMultiple*risk)
+		if !reached {
+			continue
+		}
+
+		if _, err := c.replaceOrder(*order, breakEven, 0); err != nil {
+			continue
+		}
+		c.notify(fmt.Sprintf("[BREAK EVEN] %s stop moved from %f to %f\n", candle.Pair, stop, breakEven))
+	}
+}
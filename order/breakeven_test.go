@@ -0,0 +1,88 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_BreakEven(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newController := func(t *testing.T, breakEven model.BreakEven) (*Controller, *exchange.PaperWallet) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		first := model.Candle{Time: start, Pair: "BTCUSDT", Close: 100, Low: 100, High: 100}
+		wallet.OnCandle(first)
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		controller.OnCandle(first)
+		controller.SetBreakEven("BTCUSDT", breakEven)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderStop("BTCUSDT", 1, 95)
+		require.NoError(t, err)
+		return controller, wallet
+	}
+
+	candle := func(controller *Controller, wallet *exchange.PaperWallet, minutes int, low, close, high float64) {
+		candle := model.Candle{Time: start.Add(time.Duration(minutes) * time.Minute), Pair: "BTCUSDT",
+			Open: close, Low: low, Close: close, High: high, Complete: true}
+		wallet.OnCandle(candle)
+		controller.OnCandle(candle)
+	}
+
+	stop := func(t *testing.T, wallet *exchange.PaperWallet) float64 {
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		return *orders[0].Stop
+	}
+
+	t.Run("r multiple", func(t *testing.T) {
+		controller, wallet := newController(t, model.BreakEven{RMultiple: 1, Buffer: 0.001})
+
+		candle(controller, wallet, 1, 100, 102, 103)
+		require.Equal(t, 95.0, stop(t, wallet))
+
+		// the gain reached the initial risk of 5
+		candle(controller, wallet, 2, 101, 105, 106)
+		require.InDelta(t, 100.1, stop(t, wallet), 1e-9)
+
+		stored, err := controller.storage.Orders(storage.WithPair("BTCUSDT"), storage.WithStatus(model.OrderStatusTypeNew))
+		require.NoError(t, err)
+		require.Len(t, stored, 1)
+		require.InDelta(t, 100.1, *stored[0].Stop, 1e-9)
+
+		// stops at break-even are kept
+		candle(controller, wallet, 3, 104, 110, 111)
+		require.InDelta(t, 100.1, stop(t, wallet), 1e-9)
+	})
+
+	t.Run("percent", func(t *testing.T) {
+		controller, wallet := newController(t, model.BreakEven{Percent: 0.08})
+		controller.SetFeeRate(0.001)
+
+		candle(controller, wallet, 1, 101, 105, 107)
+		require.Equal(t, 95.0, stop(t, wallet))
+
+		candle(controller, wallet, 2, 104, 106, 108)
+		require.InDelta(t, 100.2, stop(t, wallet), 1e-9)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		controller, wallet := newController(t, model.BreakEven{RMultiple: 1})
+		controller.SetBreakEven("BTCUSDT", model.BreakEven{})
+
+		candle(controller, wallet, 1, 101, 110, 112)
+		require.Equal(t, 95.0, stop(t, wallet))
+	})
+}
@@ -2,6 +2,8 @@ package order
 
 import (
 	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"math"
 	"os"
@@ -10,10 +12,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/bengalm/ninjabot/event"
 	"github.com/bengalm/ninjabot/exchange"
 	"github.com/bengalm/ninjabot/model"
 	"github.com/bengalm/ninjabot/service"
 	"github.com/bengalm/ninjabot/storage"
+	"github.com/bengalm/ninjabot/tools/clock"
+	"github.com/bengalm/ninjabot/tools/metrics"
+	"github.com/bengalm/ninjabot/tools/watchdog"
 
 	"github.com/olekukonko/tablewriter"
 	log "github.com/sirupsen/logrus"
@@ -29,7 +35,11 @@ type summary struct {
 	LoseLongPercent  []float64
 	LoseShort        []float64
 	LoseShortPercent []float64
-	Volume           float64
+	// Profits are the profit values of the closed trades, in order
+	Profits []float64
+	// Trades are the closed trades, in order
+	Trades []metrics.Trade
+	Volume float64
 }
 
 func (s summary) Win() []float64 {
@@ -154,6 +164,34 @@ func (s summary) SaveReturns(filename string) error {
 	return nil
 }
 
+// SaveTrades writes the closed trades in a CSV file, with their maximum adverse and favorable excursion
+func (s summary) SaveTrades(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err := writer.Write([]string{"start", "end", "profit", "mae", "mfe"}); err != nil {
+		return err
+	}
+	for _, trade := range s.Trades {
+		err := writer.Write([]string{
+			trade.Start.UTC().Format(time.RFC3339),
+			trade.End.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(trade.Profit, 'f', -1, 64),
+			fmt.Sprintf("%.4f", trade.MAE),
+			fmt.Sprintf("%.4f", trade.MFE),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
 type Status string
 
 const (
@@ -162,6 +200,12 @@ const (
 	StatusError   Status = "error"
 )
 
+// quoteMaxAge is the age of a live quote after which it is no longer used to price orders
+const quoteMaxAge = time.Minute
+
+// defaultClientOrderPrefix prefixes the client order IDs, which are unique among the open orders of a pair
+const defaultClientOrderPrefix = "ninjabot-"
+
 type Result struct {
 	Pair          string
 	ProfitPercent float64
@@ -169,53 +213,10 @@ type Result struct {
 	Side          model.SideType
 	Duration      time.Duration
 	CreatedAt     time.Time
-}
-
-type Position struct {
-	Side      model.SideType
-	AvgPrice  float64
-	Quantity  float64
-	CreatedAt time.Time
-}
-
-func (p *Position) Update(order *model.Order) (result *Result, finished bool) {
-	price := order.Price
-	if order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit {
-		price = *order.Stop
-	}
-
-	if p.Side == order.Side {
-		p.AvgPrice = (p.AvgPrice*p.Quantity + price*order.Quantity) / (p.Quantity + order.Quantity)
-		p.Quantity += order.Quantity
-	} else {
-		if p.Quantity == order.Quantity {
-			finished = true
-		} else if p.Quantity > order.Quantity {
-			p.Quantity -= order.Quantity
-		} else {
-			p.Quantity = order.Quantity - p.Quantity
-			p.Side = order.Side
-			p.CreatedAt = order.CreatedAt
-			p.AvgPrice = price
-		}
-
-		quantity := math.Min(p.Quantity, order.Quantity)
-		order.Profit = (price - p.AvgPrice) / p.AvgPrice
-		order.ProfitValue = (price - p.AvgPrice) * quantity
-
-		result = &Result{
-			CreatedAt:     order.CreatedAt,
-			Pair:          order.Pair,
-			Duration:      order.CreatedAt.Sub(p.CreatedAt),
-			ProfitPercent: order.Profit,
-			ProfitValue:   order.ProfitValue,
-			Side:          p.Side,
-		}
-
-		return result, finished
-	}
-
-	return nil, false
+	// MAE and MFE are the maximum adverse and favorable excursion of the price during the trade, as a fraction
+	// of the average price of the position, eg: 0.02 = the price moved 2% against the position
+	MAE float64
+	MFE float64
 }
 
 type Controller struct {
@@ -225,28 +226,99 @@ type Controller struct {
 	storage        storage.Storage
 	orderFeed      *Feed
 	notifier       service.Notifier
+	bus            *event.Bus
+	clock          clock.Clock
 	Results        map[string]*summary
 	lastPrice      map[string]float64
+	quoteMtx       sync.RWMutex
+	quotes         map[string]model.Quote
 	tickerInterval time.Duration
 	finish         chan bool
+	stopAccount    context.CancelFunc
+	watchdog       *watchdog.Watchdog
+	accountTimeout time.Duration
 	status         Status
 
-	position map[string]*Position
+	pauseMtx sync.RWMutex
+	paused   map[string]model.PauseMode
+	// holds are the pauses held by the risk guards, by pair and owner
+	holds map[string]map[string]model.PauseMode
+
+	ownersMtx sync.Mutex
+	owners    map[string]*ownedOrder
+
+	stateMtx sync.Mutex
+	stateful map[string]Stateful
+
+	execution execution
+
+	// clientOrderPrefix prefixes the client order IDs derived from the storage IDs of the orders
+	clientOrderPrefix string
+
+	// retry resubmits orders failed by transient errors, waiting with sleep between attempts
+	retry RetryPolicy
+	sleep func(ctx context.Context, d time.Duration) error
+
+	// expirations are the open limit orders with a time to live, by pair and exchange ID
+	expireMtx   sync.Mutex
+	ttl         *orderTTL
+	expirations map[string]*expiration
+
+	brackets  *bracketBook
+	positions *positionBook
+	trailing  *trailingBook
+	ladders   *ladderBook
+
+	// exposure bounds the positions opened by entry orders
+	exposure ExposureLimits
+	// breakEven are the break-even stop adjustments, by pair
+	breakEven map[string]model.BreakEven
+	// maxEntries are the maximum entries of the positions, by pair
+	maxEntries map[string]int
 }
 
 func NewController(ctx context.Context, exchange service.Exchange, storage storage.Storage,
 	orderFeed *Feed) *Controller {
 
+	brackets := &bracketBook{entries: make(map[string]*Bracket)}
+	positions := newPositionBook()
+	trailing := &trailingBook{stops: make(map[int64]*TrailingStop)}
+	ladders := &ladderBook{ladders: make(map[int64]*Ladder)}
+	stateful := map[string]Stateful{
+		bracketStateKey:  brackets,
+		positionStateKey: positions,
+		trailingStateKey: trailing,
+		ladderStateKey:   ladders,
+	}
 	return &Controller{
-		ctx:            ctx,
-		storage:        storage,
-		exchange:       exchange,
-		orderFeed:      orderFeed,
-		lastPrice:      make(map[string]float64),
-		Results:        make(map[string]*summary),
-		tickerInterval: time.Second,
-		finish:         make(chan bool),
-		position:       make(map[string]*Position),
+		ctx:               ctx,
+		storage:           storage,
+		exchange:          exchange,
+		orderFeed:         orderFeed,
+		lastPrice:         make(map[string]float64),
+		quotes:            make(map[string]model.Quote),
+		Results:           make(map[string]*summary),
+		tickerInterval:    time.Second,
+		finish:            make(chan bool),
+		paused:            make(map[string]model.PauseMode),
+		holds:             make(map[string]map[string]model.PauseMode),
+		owners:            make(map[string]*ownedOrder),
+		stateful:          stateful,
+		brackets:          brackets,
+		positions:         positions,
+		trailing:          trailing,
+		ladders:           ladders,
+		breakEven:         make(map[string]model.BreakEven),
+		maxEntries:        make(map[string]int),
+		expirations:       make(map[string]*expiration),
+		clock:             clock.Wall(),
+		clientOrderPrefix: defaultClientOrderPrefix,
+		retry:             DefaultRetryPolicy(),
+		sleep:             sleepContext,
+		execution: execution{
+			expected: make(map[string]float64),
+			stats:    make(map[string]*ExecutionStats),
+		},
 	}
 }
 
@@ -254,57 +326,173 @@ func (c *Controller) SetNotifier(notifier service.Notifier) {
 	c.notifier = notifier
 }
 
+// SetClock sets the clock used for time-dependent logic, eg: a simulated clock in backtests
+func (c *Controller) SetClock(clock clock.Clock) {
+	c.clock = clock
+}
+
+// SetWatchdog monitors the account stream, the stream is reconnected without messages within the timeout.
+// Accounts without activity have no messages, so the timeout should be longer than the usual order activity.
+func (c *Controller) SetWatchdog(watchdog *watchdog.Watchdog, timeout time.Duration) {
+	c.watchdog = watchdog
+	c.accountTimeout = timeout
+}
+
+// SetClientOrderPrefix sets the prefix of the client order IDs, eg: to tell apart the orders of bots
+// sharing an account, default: ninjabot-
+func (c *Controller) SetClientOrderPrefix(prefix string) {
+	c.clientOrderPrefix = prefix
+}
+
+// SetEventBus sets the bus used to publish orders, fills and errors
+func (c *Controller) SetEventBus(bus *event.Bus) {
+	c.bus = bus
+}
+
+func (c *Controller) publishOrder(order model.Order, newOrder bool) {
+	event.Publish(c.bus, event.Orders, order)
+	if order.Status == model.OrderStatusTypeFilled {
+		event.Publish(c.bus, event.Fills, order)
+	}
+	c.orderFeed.Publish(order, newOrder)
+}
+
 func (c *Controller) OnCandle(candle model.Candle) {
 	c.lastPrice[candle.Pair] = candle.Close
+
+	c.positions.onCandle(candle)
+
+	c.mtx.Lock()
+	c.updateTrailingStops(candle)
+	c.adjustBreakEven(candle)
+	c.mtx.Unlock()
+
+	c.expireOrders(candle.Pair)
 }
 
-func (c *Controller) updatePosition(o *model.Order) {
-	// get filled orders before the current order
-	position, ok := c.position[o.Pair]
+// OnQuote updates the live best bid and ask of a pair
+func (c *Controller) OnQuote(quote model.Quote) {
+	c.quoteMtx.Lock()
+	defer c.quoteMtx.Unlock()
+	c.quotes[quote.Pair] = quote
+}
+
+// Quote returns the live best bid and ask of a pair, false without a quote or when the quote is
+// older than quoteMaxAge
+func (c *Controller) Quote(pair string) (model.Quote, bool) {
+	c.quoteMtx.RLock()
+	defer c.quoteMtx.RUnlock()
+	quote, ok := c.quotes[pair]
+	if !ok || c.clock.Now().Sub(quote.Time) > quoteMaxAge {
+		return model.Quote{}, false
+	}
+	return quote, true
+}
+
+// SubscribeQuotes streams the best bid and ask of the pairs, used to price limit orders with
+// OrderOptions.Pricing and as the expected price of market orders, instead of the last candle close
+func (c *Controller) SubscribeQuotes(pairs ...string) error {
+	feeder, ok := c.exchange.(service.QuoteFeeder)
 	if !ok {
-		c.position[o.Pair] = &Position{
-			AvgPrice:  o.Price,
-			Quantity:  o.Quantity,
-			CreatedAt: o.CreatedAt,
-			Side:      o.Side,
-		}
-		return
+		return fmt.Errorf("%w: quotes", exchange.ErrUnsupportedFeed)
 	}
 
-	result, closed := position.Update(o)
-	if closed {
-		delete(c.position, o.Pair)
+	for _, pair := range pairs {
+		quotes, errs := feeder.QuoteSubscription(c.ctx, pair)
+		go c.subscribeQuotes(pair, quotes, errs)
 	}
+	return nil
+}
 
-	if result != nil {
-		// TODO: replace by a slice of Result
-		if result.ProfitPercent >= 0 {
-			if result.Side == model.SideTypeBuy {
-				c.Results[o.Pair].WinLong = append(c.Results[o.Pair].WinLong, result.ProfitValue)
-				c.Results[o.Pair].WinLongPercent = append(c.Results[o.Pair].WinLongPercent, result.ProfitPercent)
-			} else {
-				c.Results[o.Pair].WinShort = append(c.Results[o.Pair].WinShort, result.ProfitValue)
-				c.Results[o.Pair].WinShortPercent = append(c.Results[o.Pair].WinShortPercent, result.ProfitPercent)
+func (c *Controller) subscribeQuotes(pair string, quotes chan model.Quote, errs chan error) {
+	for {
+		select {
+		case quote, ok := <-quotes:
+			if !ok {
+				return
 			}
-		} else {
-			if result.Side == model.SideTypeBuy {
-				c.Results[o.Pair].LoseLong = append(c.Results[o.Pair].LoseLong, result.ProfitValue)
-				c.Results[o.Pair].LoseLongPercent = append(c.Results[o.Pair].LoseLongPercent, result.ProfitPercent)
-			} else {
-				c.Results[o.Pair].LoseShort = append(c.Results[o.Pair].LoseShort, result.ProfitValue)
-				c.Results[o.Pair].LoseShortPercent = append(c.Results[o.Pair].LoseShortPercent, result.ProfitPercent)
+			c.OnQuote(quote)
+		case err, ok := <-errs:
+			if !ok {
+				return
 			}
+			log.Warnf("orderController/quotes %s: %v", pair, err)
 		}
+	}
+}
+
+// quotePrice returns the price of a limit order with the given pricing, the limit is kept without
+// pricing or live quote
+func (c *Controller) quotePrice(side model.SideType, pair string, limit float64,
+	pricing model.PricingType) (float64, error) {
+
+	if pricing == "" {
+		return limit, nil
+	}
+	if pricing != model.PricingJoin && pricing != model.PricingCross {
+		return 0, fmt.Errorf("%w: pricing %s", exchange.ErrUnsupportedOrder, pricing)
+	}
+
+	quote, ok := c.Quote(pair)
+	if !ok {
+		log.Warnf("[ORDER] no live quote for %s, using limit price %f", pair, limit)
+		return limit, nil
+	}
+
+	// joining the book buys at the bid, crossing the spread buys at the ask
+	if (side == model.SideTypeBuy) == (pricing == model.PricingJoin) {
+		return quote.Bid, nil
+	}
+	return quote.Ask, nil
+}
+
+// recordResult adds the trade of a fill that reduced a position to the results of the pair
+func (c *Controller) recordResult(o *model.Order, result *Result) {
+	o.Profit = result.ProfitPercent
+	o.ProfitValue = result.ProfitValue
+	if _, ok := c.Results[o.Pair]; !ok {
+		c.Results[o.Pair] = &summary{Pair: o.Pair}
+	}
 
-		_, quote := exchange.SplitAssetQuote(o.Pair)
-		c.notify(fmt.Sprintf(
-			"[PROFIT] %f %s (%f %%)\n`%s`",
-			result.ProfitValue,
-			quote,
-			result.ProfitPercent*100,
-			c.Results[o.Pair].String(),
-		))
+	c.Results[o.Pair].Profits = append(c.Results[o.Pair].Profits, result.ProfitValue)
+	c.Results[o.Pair].Trades = append(c.Results[o.Pair].Trades, metrics.Trade{
+		Start:  result.CreatedAt.Add(-result.Duration),
+		End:    result.CreatedAt,
+		Profit: result.ProfitValue,
+		MAE:    result.MAE,
+		MFE:    result.MFE,
+	})
+
+	// TODO: replace by a slice of Result
+	if result.ProfitPercent >= 0 {
+		if result.Side == model.SideTypeBuy {
+			c.Results[o.Pair].WinLong = append(c.Results[o.Pair].WinLong, result.ProfitValue)
+			c.Results[o.Pair].WinLongPercent = append(c.Results[o.Pair].WinLongPercent, result.ProfitPercent)
+		} else {
+			c.Results[o.Pair].WinShort = append(c.Results[o.Pair].WinShort, result.ProfitValue)
+			c.Results[o.Pair].WinShortPercent = append(c.Results[o.Pair].WinShortPercent, result.ProfitPercent)
+		}
+	} else {
+		if result.Side == model.SideTypeBuy {
+			c.Results[o.Pair].LoseLong = append(c.Results[o.Pair].LoseLong, result.ProfitValue)
+			c.Results[o.Pair].LoseLongPercent = append(c.Results[o.Pair].LoseLongPercent, result.ProfitPercent)
+		} else {
+			c.Results[o.Pair].LoseShort = append(c.Results[o.Pair].LoseShort, result.ProfitValue)
+			c.Results[o.Pair].LoseShortPercent = append(c.Results[o.Pair].LoseShortPercent, result.ProfitPercent)
+		}
 	}
+
+	_, quote := exchange.SplitAssetQuote(o.Pair)
+	position, _ := c.PositionPnL(o.Pair)
+	c.notify(fmt.Sprintf(
+		"[PROFIT] %f %s (%f %%), fees of the pair: %f %s\n`%s`",
+		result.ProfitValue,
+		quote,
+		result.ProfitPercent*100,
+		position.Fees,
+		quote,
+		c.Results[o.Pair].String(),
+	))
 }
 
 func (c *Controller) notify(message string) {
@@ -316,12 +504,20 @@ func (c *Controller) notify(message string) {
 
 func (c *Controller) notifyError(err error) {
 	log.Error(err)
+	event.Publish(c.bus, event.Errors, event.Error{Time: c.clock.Now(), Source: "order", Err: err})
 	if c.notifier != nil {
 		c.notifier.OnError(err)
 	}
 }
 
 func (c *Controller) processTrade(order *model.Order) {
+	c.recordExecution(*order)
+	c.forgetExpiration(*order)
+	c.updatePositionPnL(order)
+
+	// update strategy allocation
+	c.notifyOwner(*order)
+
 	if order.Status != model.OrderStatusTypeFilled {
 		return
 	}
@@ -334,8 +530,28 @@ func (c *Controller) processTrade(order *model.Order) {
 	// register order volume
 	c.Results[order.Pair].Volume += order.Price * order.Quantity
 
-	// update position size / avg price
-	c.updatePosition(order)
+	c.resizeExits(*order)
+}
+
+// updatePositionPnL applies the fills of an order to the positions of the bot, recording the trade of a reduced
+// position and publishing the updated position and the position closed by the fills, if any
+func (c *Controller) updatePositionPnL(order *model.Order) {
+	c.execution.mtx.Lock()
+	feeRate := c.execution.feeRate
+	c.execution.mtx.Unlock()
+
+	key := c.ownerKey(order.Pair, order.ExchangeID)
+	update, ok := c.positions.onFill(key, *order, feeRate, c.clock.Now())
+	if !ok {
+		return
+	}
+	if update.result != nil {
+		c.recordResult(order, update.result)
+	}
+	event.Publish(c.bus, event.Positions, update.position)
+	if update.closed != nil {
+		event.Publish(c.bus, event.ClosedPositions, *update.closed)
+	}
 }
 
 func (c *Controller) updateOrders() {
@@ -350,7 +566,6 @@ func (c *Controller) updateOrders() {
 	))
 	if err != nil {
 		c.notifyError(err)
-		c.mtx.Unlock()
 		return
 	}
 
@@ -363,12 +578,18 @@ func (c *Controller) updateOrders() {
 			continue
 		}
 
-		// no status change
-		if excOrder.Status == order.Status {
+		// no status change or new partial fill
+		if excOrder.Status == order.Status && excOrder.Executed == order.Executed {
 			continue
 		}
 
 		excOrder.ID = order.ID
+		if excOrder.GroupID == nil {
+			excOrder.GroupID = order.GroupID
+		}
+		if excOrder.ClientOrderID == "" {
+			excOrder.ClientOrderID = order.ClientOrderID
+		}
 		err = c.storage.UpdateOrder(&excOrder)
 		if err != nil {
 			c.notifyError(err)
@@ -381,10 +602,155 @@ func (c *Controller) updateOrders() {
 
 	for _, processOrder := range updatedOrders {
 		c.processTrade(&processOrder)
-		c.orderFeed.Publish(processOrder, false)
+		c.publishOrder(processOrder, false)
+		c.cancelGroup(processOrder)
+		c.updateBrackets(processOrder)
+		c.updateTrailingOrders(processOrder)
+		c.updateLadders(processOrder)
 	}
 }
 
+// cancelGroup cancels the open legs of an emulated OCO order when one of them is filled, exchanges with
+// native OCO orders cancel them by themselves
+func (c *Controller) cancelGroup(order model.Order) {
+	if order.Status != model.OrderStatusTypeFilled || order.GroupID == nil {
+		return
+	}
+	if broker, ok := c.exchange.(service.EmulatedOCOBroker); !ok || !broker.EmulatedOCO(order.Pair) {
+		return
+	}
+
+	orders, err := c.storage.Orders(storage.WithPair(order.Pair), storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+	))
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+
+	for _, leg := range orders {
+		if leg.GroupID == nil || *leg.GroupID != *order.GroupID || leg.ExchangeID == order.ExchangeID {
+			continue
+		}
+
+		if err := c.exchange.Cancel(*leg); err != nil {
+			c.notifyError(err)
+			continue
+		}
+
+		leg.Status = model.OrderStatusTypePendingCancel
+		if err := c.storage.UpdateOrder(leg); err != nil {
+			c.notifyError(err)
+			continue
+		}
+		log.Infof("[ORDER CANCELED] OCO leg %s", leg)
+	}
+}
+
+// subscribeAccount processes the order updates of the exchange user data stream. With a watchdog, the
+// stream is subscribed again when it is stale.
+func (c *Controller) subscribeAccount(ctx context.Context, subscriber service.AccountSubscriber) {
+	for {
+		streamCtx, cancel := context.WithCancel(ctx)
+		if c.watchdog != nil && c.accountTimeout > 0 {
+			c.watchdog.Watch("account", c.accountTimeout, cancel)
+		}
+
+		c.consumeAccount(streamCtx, subscriber)
+		stale := streamCtx.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		// streams closed by the exchange or the controller are not subscribed again
+		if !stale {
+			if c.watchdog != nil {
+				c.watchdog.Remove("account")
+			}
+			return
+		}
+		log.Warn("orderController/account: reconnecting account stream")
+	}
+}
+
+func (c *Controller) consumeAccount(ctx context.Context, subscriber service.AccountSubscriber) {
+	orders, errs := subscriber.AccountSubscription(ctx)
+	for {
+		select {
+		case order, ok := <-orders:
+			if !ok {
+				return
+			}
+			if c.watchdog != nil {
+				c.watchdog.Beat("account")
+			}
+			c.onOrderUpdate(order)
+		case err, ok := <-errs:
+			if !ok {
+				return
+			}
+			log.Warnf("orderController/account: %v", err)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// onOrderUpdate stores an order update received from the exchange and processes the trade, updates of
+// unknown orders or without status change or new partial fill are ignored, except liquidations
+func (c *Controller) onOrderUpdate(update model.Order) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	orders, err := c.storage.Orders(storage.WithPair(update.Pair), storage.WithExchangeID(update.ExchangeID))
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+
+	if len(orders) == 0 && update.Type == model.OrderTypeLiquidation {
+		c.onLiquidation(update)
+		return
+	}
+
+	if len(orders) == 0 || (orders[0].Status == update.Status && orders[0].Executed == update.Executed) {
+		return
+	}
+
+	update.ID = orders[0].ID
+	if update.GroupID == nil {
+		update.GroupID = orders[0].GroupID
+	}
+	if update.ClientOrderID == "" {
+		update.ClientOrderID = orders[0].ClientOrderID
+	}
+	if err := c.storage.UpdateOrder(&update); err != nil {
+		c.notifyError(err)
+		return
+	}
+
+	log.Infof("[ORDER %s] %s", update.Status, update)
+	c.processTrade(&update)
+	c.publishOrder(update, false)
+	c.cancelGroup(update)
+	c.updateBrackets(update)
+	c.updateTrailingOrders(update)
+	c.updateLadders(update)
+}
+
+// onLiquidation stores a forced close of a position by the exchange, which is processed as a trade
+// and published to the order subscribers, eg: strategies and notifications
+func (c *Controller) onLiquidation(order model.Order) {
+	if err := c.storage.CreateOrder(&order); err != nil {
+		c.notifyError(err)
+		return
+	}
+
+	log.Warnf("[ORDER %s] %s", order.Type, order)
+	c.notify(fmt.Sprintf("[LIQUIDATION] %s: %s %f at %f\n", order.Pair, order.Side, order.Quantity, order.Price))
+	c.processTrade(&order)
+	c.publishOrder(order, false)
+}
+
 func (c *Controller) Status() Status {
 	return c.status
 }
@@ -398,12 +764,20 @@ func (c *Controller) Start() {
 				select {
 				case <-ticker.C:
 					c.updateOrders()
+					c.saveState()
+					c.reportExecution()
 				case <-c.finish:
 					ticker.Stop()
 					return
 				}
 			}
 		}()
+
+		if subscriber, ok := c.exchange.(service.AccountSubscriber); ok {
+			ctx, cancel := context.WithCancel(c.ctx)
+			c.stopAccount = cancel
+			go c.subscribeAccount(ctx, subscriber)
+		}
 		log.Info("Bot started.")
 	}
 }
@@ -411,7 +785,11 @@ func (c *Controller) Start() {
 func (c *Controller) Stop() {
 	if c.status == StatusRunning {
 		c.status = StatusStopped
+		if c.stopAccount != nil {
+			c.stopAccount()
+		}
 		c.updateOrders()
+		c.saveState()
 		c.finish <- true
 		log.Info("Bot stopped.")
 	}
@@ -425,6 +803,11 @@ func (c *Controller) Position(pair string) (asset, quote float64, err error) {
 	return c.exchange.Position(pair)
 }
 
+// PositionRisk returns the exposure of the account position in a pair, eg: entry and liquidation prices
+func (c *Controller) PositionRisk(pair string) (model.PositionRisk, error) {
+	return c.exchange.PositionRisk(pair)
+}
+
 func (c *Controller) LastQuote(pair string) (float64, error) {
 	return c.exchange.LastQuote(c.ctx, pair)
 }
@@ -441,25 +824,230 @@ func (c *Controller) Order(pair string, id int64) (model.Order, error) {
 	return c.exchange.Order(pair, id)
 }
 
+// ClientOrderID returns the client order ID of an order, derived from its storage ID
+func (c *Controller) ClientOrderID(id int64) string {
+	return c.clientOrderPrefix + strconv.FormatInt(id, 10)
+}
+
+// placeOrder submits and stores an order. With exchanges that support client order IDs, the order is stored
+// as pending before the submission, with a client order ID derived from its storage ID, so an order placed
+// right before a crash is found in the exchange instead of being placed again.
+func (c *Controller) placeOrder(request model.OrderRequest, create func() (model.Order, error)) (model.Order,
+	error) {
+	broker, ok := c.exchange.(service.ClientOrderBroker)
+	if !ok {
+		order, err := create()
+		if err != nil {
+			return model.Order{}, err
+		}
+		return order, c.storage.CreateOrder(&order)
+	}
+
+	orders, err := c.placeClientOrders(broker, []model.OrderRequest{request},
+		func(requests []model.OrderRequest) ([]model.Order, error) {
+			order, err := broker.CreateOrderRequest(requests[0])
+			if err != nil {
+				return nil, err
+			}
+			return []model.Order{order}, nil
+		})
+	if err != nil {
+		return model.Order{}, err
+	}
+	return orders[0], nil
+}
+
+// placeOCOOrders submits and stores the legs of an OCO order, a limit and a stop loss limit request, with
+// client order IDs as placeOrder when the exchange supports them
+func (c *Controller) placeOCOOrders(limit, stop model.OrderRequest, create func() ([]model.Order, error)) (
+	[]model.Order, error) {
+	broker, ok := c.exchange.(service.ClientOrderBroker)
+	ocoBroker, ocoOK := c.exchange.(service.ClientOCOBroker)
+	if !ok || !ocoOK {
+		orders, err := create()
+		if err != nil {
+			return nil, err
+		}
+		for i := range orders {
+			if err := c.storage.CreateOrder(&orders[i]); err != nil {
+				return nil, err
+			}
+		}
+		return orders, nil
+	}
+
+	return c.placeClientOrders(broker, []model.OrderRequest{limit, stop},
+		func(requests []model.OrderRequest) ([]model.Order, error) {
+			return ocoBroker.CreateOrderOCORequest(requests[0], requests[1])
+		})
+}
+
+// placeClientOrders stores the requests as pending orders with client order IDs, and submits them together
+func (c *Controller) placeClientOrders(broker service.ClientOrderBroker, requests []model.OrderRequest,
+	submit func(requests []model.OrderRequest) ([]model.Order, error)) ([]model.Order, error) {
+	pending := make([]*model.Order, 0, len(requests))
+	for i := range requests {
+		order, err := c.storePending(requests[i])
+		if err != nil {
+			return nil, err
+		}
+		requests[i].ClientOrderID = order.ClientOrderID
+		pending = append(pending, order)
+	}
+
+	orders, err := c.submitOrders(broker, requests, pending, submit)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range orders {
+		// orders are matched to the pending orders by client order ID, or by their position
+		stored := pendingOrder(pending, orders[i], i)
+		if stored == nil {
+			if err := c.storage.CreateOrder(&orders[i]); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		orders[i].ID = stored.ID
+		if orders[i].ClientOrderID == "" {
+			orders[i].ClientOrderID = stored.ClientOrderID
+		}
+		if err := c.storage.UpdateOrder(&orders[i]); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// storePending stores a request as a pending order, with a client order ID derived from its storage ID
+func (c *Controller) storePending(request model.OrderRequest) (*model.Order, error) {
+	now := c.clock.Now()
+	pending := &model.Order{
+		Pair:      request.Pair,
+		Side:      request.Side,
+		Type:      request.Type,
+		Status:    model.OrderStatusTypePendingNew,
+		Price:     request.Price,
+		Quantity:  request.Quantity,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if request.Stop > 0 {
+		stop := request.Stop
+		pending.Stop = &stop
+	}
+	if err := c.storage.CreateOrder(pending); err != nil {
+		return nil, err
+	}
+	pending.ClientOrderID = c.ClientOrderID(pending.ID)
+	if err := c.storage.UpdateOrder(pending); err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// pendingOrder returns the pending order of a placed order, nil when it is not found
+func pendingOrder(pending []*model.Order, order model.Order, position int) *model.Order {
+	for _, stored := range pending {
+		if order.ClientOrderID != "" && stored.ClientOrderID == order.ClientOrderID {
+			return stored
+		}
+	}
+	if position < len(pending) {
+		return pending[position]
+	}
+	return nil
+}
+
+// submitOrders sends order requests, resubmitting them with the same client order IDs after transient errors.
+// The orders may be placed despite an error, eg: a timeout, so they are looked up by their client order IDs
+// before a new attempt. Pending orders unknown by the exchange, or that can not be looked up, are rejected,
+// and they stay pending when the lookup fails, to be resolved on the next startup.
+func (c *Controller) submitOrders(broker service.ClientOrderBroker, requests []model.OrderRequest,
+	pending []*model.Order, submit func(requests []model.OrderRequest) ([]model.Order, error)) ([]model.Order,
+	error) {
+
+	ba := c.newBackoff()
+	for attempt := 1; ; attempt++ {
+		orders, err := submit(requests)
+		if err == nil {
+			return orders, nil
+		}
+
+		placed, findErr := findOrders(broker, requests)
+		if findErr == nil {
+			return placed, nil
+		}
+
+		// wrappers of exchanges without client order IDs can not find an order placed despite the error,
+		// so it is not submitted again
+		unsupported := errors.Is(findErr, exchange.ErrUnsupportedOrder)
+		if delay, ok := c.retryAfter(ba, attempt, err); ok && !unsupported {
+			log.WithField("client_order_id", requests[0].ClientOrderID).
+				Warnf("order/retry: attempt %d failed, retrying in %s: %v", attempt, delay, err)
+			if sleepErr := c.sleep(c.ctx, delay); sleepErr == nil {
+				continue
+			}
+		}
+
+		if unsupported || errors.Is(findErr, exchange.ErrOrderNotFound) {
+			for _, order := range pending {
+				order.Status = model.OrderStatusTypeRejected
+				order.UpdatedAt = c.clock.Now()
+				if updateErr := c.storage.UpdateOrder(order); updateErr != nil {
+					c.notifyError(updateErr)
+				}
+			}
+		}
+		return nil, err
+	}
+}
+
+// findOrders looks up the orders of requests by their client order IDs
+func findOrders(broker service.ClientOrderBroker, requests []model.OrderRequest) ([]model.Order, error) {
+	orders := make([]model.Order, 0, len(requests))
+	for _, request := range requests {
+		order, err := broker.OrderByClientID(request.Pair, request.ClientOrderID)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+}
+
 func (c *Controller) CreateOrderOCO(side model.SideType, pair string, size, price, stop,
 	stopLimit float64) ([]model.Order, error) {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	if err := c.checkPause(side, pair, true); err != nil {
+		return nil, err
+	}
+
+	return c.placeOCO(side, pair, size, price, stop, stopLimit)
+}
+
+// placeOCO creates and stores the legs of an OCO order, the caller must hold the controller lock
+func (c *Controller) placeOCO(side model.SideType, pair string, size, price, stop,
+	stopLimit float64) ([]model.Order, error) {
 	log.Infof("[ORDER] Creating OCO order for %s", pair)
-	orders, err := c.exchange.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+	limit := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeLimit, Quantity: size, Price: price}
+	stopLoss := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeStopLossLimit, Quantity: size,
+		Price: stopLimit, Stop: stop}
+	orders, err := c.placeOCOOrders(limit, stopLoss, func() ([]model.Order, error) {
+		return c.exchange.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return nil, err
 	}
 
 	for i := range orders {
-		err := c.storage.CreateOrder(&orders[i])
-		if err != nil {
-			c.notifyError(err)
-			return nil, err
-		}
-		go c.orderFeed.Publish(orders[i], true)
+		c.expect(orders[i])
+		go c.publishOrder(orders[i], true)
 	}
 
 	return orders, nil
@@ -469,19 +1057,109 @@ func (c *Controller) CreateOrderLimit(side model.SideType, pair string, size, li
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	if err := c.checkPause(side, pair, false); err != nil {
+		return model.Order{}, err
+	}
+	if err := c.checkEntry(side, pair, size, limit); err != nil {
+		return model.Order{}, err
+	}
+
+	order, err := c.placeLimit(side, pair, size, limit)
+	if err != nil {
+		return model.Order{}, err
+	}
+	c.expireLater(order, c.defaultTTL(), c)
+	return order, nil
+}
+
+// placeLimit creates and stores a limit order, the caller must hold the controller lock
+func (c *Controller) placeLimit(side model.SideType, pair string, size, limit float64) (model.Order, error) {
 	log.Infof("[ORDER] Creating LIMIT %s order for %s", side, pair)
-	order, err := c.exchange.CreateOrderLimit(side, pair, size, limit)
+	request := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeLimit, Quantity: size, Price: limit}
+	order, err := c.placeOrder(request, func() (model.Order, error) {
+		return c.exchange.CreateOrderLimit(side, pair, size, limit)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
+	c.expect(order)
+	go c.publishOrder(order, true)
+	log.Infof("[ORDER CREATED] %s", order)
+	return order, nil
+}
+
+// CreateOrderLimitTIF creates a limit order with a time in force, if the exchange supports it. IOC and
+// FOK orders are resolved on creation, and processed as market orders.
+func (c *Controller) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForceType) (model.Order, error) {
+	return c.CreateOrderLimitOptions(side, pair, size, limit, model.OrderOptions{TimeInForce: timeInForce})
+}
+
+// limitOrderCreator returns the function to create limit orders with the given options in the exchange
+func (c *Controller) limitOrderCreator(options model.OrderOptions) (
+	func(side model.SideType, pair string, size, limit float64) (model.Order, error), error) {
+	if broker, ok := c.exchange.(service.OrderOptionsBroker); ok {
+		return func(side model.SideType, pair string, size, limit float64) (model.Order, error) {
+			return broker.CreateOrderLimitOptions(side, pair, size, limit, options)
+		}, nil
+	}
 
-	err = c.storage.CreateOrder(&order)
+	if options.IcebergQuantity > 0 {
+		return nil, fmt.Errorf("%w: iceberg order", exchange.ErrUnsupportedOrder)
+	}
+	if broker, ok := c.exchange.(service.TimeInForceBroker); ok {
+		return func(side model.SideType, pair string, size, limit float64) (model.Order, error) {
+			return broker.CreateOrderLimitTIF(side, pair, size, limit, options.TimeInForce)
+		}, nil
+	}
+	if options.TimeInForce == "" || options.TimeInForce == model.TimeInForceGTC {
+		return c.exchange.CreateOrderLimit, nil
+	}
+	return nil, fmt.Errorf("%w: time in force %s", exchange.ErrUnsupportedOrder, options.TimeInForce)
+}
+
+// CreateOrderLimitOptions creates a limit order with advanced options, if the exchange supports them.
+// Orders resolved on creation, eg: IOC orders, are processed as market orders.
+func (c *Controller) CreateOrderLimitOptions(side model.SideType, pair string, size, limit float64,
+	options model.OrderOptions) (model.Order, error) {
+	create, err := c.limitOrderCreator(options)
+	if err != nil {
+		return model.Order{}, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.checkPause(side, pair, false); err != nil {
+		return model.Order{}, err
+	}
+
+	limit, err = c.quotePrice(side, pair, limit, options.Pricing)
+	if err != nil {
+		return model.Order{}, err
+	}
+	if err := c.checkEntry(side, pair, size, limit); err != nil {
+		return model.Order{}, err
+	}
+
+	log.Infof("[ORDER] Creating LIMIT %s order for %s with %+v", side, pair, options)
+	request := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeLimit, Quantity: size, Price: limit,
+		TimeInForce: options.TimeInForce, IcebergQuantity: options.IcebergQuantity}
+	order, err := c.placeOrder(request, func() (model.Order, error) {
+		return create(side, pair, size, limit)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
-	go c.orderFeed.Publish(order, true)
+	c.expect(order)
+	c.expireLater(order, c.defaultTTL(), c)
+
+	if order.Status != model.OrderStatusTypeNew {
+		c.processTrade(&order)
+	}
+	go c.publishOrder(order, true)
 	log.Infof("[ORDER CREATED] %s", order)
 	return order, nil
 }
@@ -490,22 +1168,27 @@ func (c *Controller) CreateOrderMarketQuote(side model.SideType, pair string, am
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	log.Infof("[ORDER] Creating MARKET %s order for %s", side, pair)
-	order, err := c.exchange.CreateOrderMarketQuote(side, pair, amount)
-	if err != nil {
-		c.notifyError(err)
+	if err := c.checkPause(side, pair, false); err != nil {
+		return model.Order{}, err
+	}
+	if err := c.checkEntryNotional(side, pair, amount); err != nil {
 		return model.Order{}, err
 	}
 
-	err = c.storage.CreateOrder(&order)
+	log.Infof("[ORDER] Creating MARKET %s order for %s", side, pair)
+	request := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeMarket, QuoteQuantity: amount}
+	order, err := c.placeOrder(request, func() (model.Order, error) {
+		return c.exchange.CreateOrderMarketQuote(side, pair, amount)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
+	c.expect(order)
 
 	// calculate profit
 	c.processTrade(&order)
-	go c.orderFeed.Publish(order, true)
+	go c.publishOrder(order, true)
 	log.Infof("[ORDER CREATED] %s", order)
 	return order, err
 }
@@ -514,22 +1197,36 @@ func (c *Controller) CreateOrderMarket(side model.SideType, pair string, size fl
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
-	log.Infof("[ORDER] Creating MARKET %s order for %s size %f", side, pair, size)
-	order, err := c.exchange.CreateOrderMarket(side, pair, size, reduceOnly)
-	if err != nil {
-		c.notifyError(err)
+	if err := c.checkPause(side, pair, reduceOnly); err != nil {
 		return model.Order{}, err
 	}
+	if !reduceOnly {
+		if err := c.checkEntry(side, pair, size, 0); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	return c.placeMarket(side, pair, size, reduceOnly)
+}
 
-	err = c.storage.CreateOrder(&order)
+// placeMarket creates and processes a market order, the caller must hold the controller lock
+func (c *Controller) placeMarket(side model.SideType, pair string, size float64,
+	reduceOnly bool) (model.Order, error) {
+	log.Infof("[ORDER] Creating MARKET %s order for %s size %f", side, pair, size)
+	request := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeMarket, Quantity: size,
+		ReduceOnly: reduceOnly}
+	order, err := c.placeOrder(request, func() (model.Order, error) {
+		return c.exchange.CreateOrderMarket(side, pair, size, reduceOnly)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
+	c.expect(order)
 
 	// calculate profit
 	c.processTrade(&order)
-	go c.orderFeed.Publish(order, true)
+	go c.publishOrder(order, true)
 	log.Infof("[ORDER CREATED] %s", order)
 	return order, err
 }
@@ -538,19 +1235,61 @@ func (c *Controller) CreateOrderStop(pair string, size float64, limit float64) (
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	if err := c.checkPause(model.SideTypeSell, pair, true); err != nil {
+		return model.Order{}, err
+	}
+	return c.placeStop(pair, size, limit)
+}
+
+// placeStop creates and stores a stop order, the caller must hold the controller lock
+func (c *Controller) placeStop(pair string, size float64, limit float64) (model.Order, error) {
 	log.Infof("[ORDER] Creating STOP order for %s", pair)
-	order, err := c.exchange.CreateOrderStop(pair, size, limit)
+	// negative limits are buy stops, as in futures exchanges
+	side, stop := model.SideTypeSell, limit
+	if limit < 0 {
+		side, stop = model.SideTypeBuy, -limit
+	}
+	request := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeStopLossLimit,
+		Quantity: size, Price: stop, Stop: stop}
+	order, err := c.placeOrder(request, func() (model.Order, error) {
+		return c.exchange.CreateOrderStop(pair, size, limit)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
+	c.expect(order)
+	go c.publishOrder(order, true)
+	log.Infof("[ORDER CREATED] %s", order)
+	return order, nil
+}
+
+// CreateOrderTrailingStop creates a trailing stop order, if the exchange supports it
+func (c *Controller) CreateOrderTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64) (model.Order, error) {
+	broker, ok := c.exchange.(service.TrailingStopBroker)
+	if !ok {
+		return model.Order{}, fmt.Errorf("%w: trailing stop", exchange.ErrUnsupportedOrder)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.checkPause(side, pair, true); err != nil {
+		return model.Order{}, err
+	}
 
-	err = c.storage.CreateOrder(&order)
+	log.Infof("[ORDER] Creating TRAILING STOP %s order for %s", side, pair)
+	request := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeTrailingStop, Quantity: quantity,
+		Stop: activation, CallbackRate: callbackRate}
+	order, err := c.placeOrder(request, func() (model.Order, error) {
+		return broker.CreateOrderTrailingStop(side, pair, quantity, activation, callbackRate)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
-	go c.orderFeed.Publish(order, true)
+	go c.publishOrder(order, true)
 	log.Infof("[ORDER CREATED] %s", order)
 	return order, nil
 }
@@ -559,19 +1298,26 @@ func (c *Controller) TakeProfit(side model.SideType, pair string, quantity float
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
 
+	if err := c.checkPause(side, pair, true); err != nil {
+		return model.Order{}, err
+	}
+
 	log.Infof("[ORDER] Creating TakeProfit order for %s", pair)
-	order, err := c.exchange.TakeProfit(side, pair, quantity, limit)
+	request := model.OrderRequest{Pair: pair, Side: side, Type: model.OrderTypeTakeProfitLimit, Quantity: quantity,
+		Price: limit, Stop: limit}
+	if quantity == 0 {
+		// take profits without quantity close the whole position with a market order
+		request.Type = model.OrderTypeTakeProfit
+	}
+	order, err := c.placeOrder(request, func() (model.Order, error) {
+		return c.exchange.TakeProfit(side, pair, quantity, limit)
+	})
 	if err != nil {
 		c.notifyError(err)
 		return model.Order{}, err
 	}
-	//
-	//err = c.storage.CreateOrder(&order)
-	//if err != nil {
-	//	c.notifyError(err)
-	//	return model.Order{}, err
-	//}
-	//go c.orderFeed.Publish(order, true)
+	c.expect(order)
+	go c.publishOrder(order, true)
 	log.Infof("[ORDER CREATED] %s", order)
 	return order, nil
 }
@@ -595,6 +1341,96 @@ func (c *Controller) Cancel(order model.Order) error {
 	log.Infof("[ORDER CANCELED] %s", order)
 	return nil
 }
+
+// ModifyOrder amends the price and quantity of an open order. When the exchange replaces the order,
+// the original order is marked as pending cancel and the new one is stored.
+func (c *Controller) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if quantity > order.Quantity {
+		if err := c.checkPause(order.Side, order.Pair, false); err != nil {
+			return model.Order{}, err
+		}
+		if err := c.checkEntry(order.Side, order.Pair, quantity-order.Quantity, price); err != nil {
+			return model.Order{}, err
+		}
+	}
+
+	return c.replaceOrder(order, price, quantity)
+}
+
+// replaceOrder amends an open order in the exchange and in the storage, the caller must hold the controller lock
+func (c *Controller) replaceOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	log.Infof("[ORDER] Modifying %s order %d for %s price %f size %f", order.Type, order.ExchangeID, order.Pair,
+		price, quantity)
+	if _, ok := c.exchange.(service.ClientOrderBroker); ok && !c.amends(order) {
+		return c.cancelReplace(order, price, quantity)
+	}
+
+	modified, err := c.exchange.ModifyOrder(order, price, quantity)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	if modified.ExchangeID == order.ExchangeID {
+		modified.ID = order.ID
+		err = c.storage.UpdateOrder(&modified)
+	} else {
+		order.Status = model.OrderStatusTypePendingCancel
+		err = c.storage.UpdateOrder(&order)
+		if err == nil {
+			err = c.storage.CreateOrder(&modified)
+		}
+	}
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+	c.expect(modified)
+	go c.publishOrder(modified, true)
+	log.Infof("[ORDER MODIFIED] %s", modified)
+	return modified, nil
+}
+
+// amends returns true if the exchange amends the order in place, keeping its ID
+func (c *Controller) amends(order model.Order) bool {
+	broker, ok := c.exchange.(service.AmendBroker)
+	return ok && broker.Amends(order)
+}
+
+// cancelReplace cancels an open order and places the replacement with a client order ID, the caller must hold
+// the controller lock
+func (c *Controller) cancelReplace(order model.Order, price, quantity float64) (model.Order, error) {
+	request, err := exchange.ReplaceRequest(order, price, quantity)
+	if err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	if err := c.exchange.Cancel(order); err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+	order.Status = model.OrderStatusTypePendingCancel
+	if err := c.storage.UpdateOrder(&order); err != nil {
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+
+	modified, err := c.placeOrder(request, nil)
+	if err != nil {
+		err = fmt.Errorf("order %d canceled, replacement failed: %w", order.ExchangeID, err)
+		c.notifyError(err)
+		return model.Order{}, err
+	}
+	c.expect(modified)
+	go c.publishOrder(modified, true)
+	log.Infof("[ORDER MODIFIED] %s", modified)
+	return modified, nil
+}
+
 func (c *Controller) CancelOpenOrders(pair string) error {
 	c.mtx.Lock()
 	defer c.mtx.Unlock()
@@ -2,6 +2,10 @@ package order
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -11,9 +15,10 @@ import (
 	"github.com/bengalm/ninjabot/exchange"
 	"github.com/bengalm/ninjabot/model"
 	"github.com/bengalm/ninjabot/storage"
+	"github.com/bengalm/ninjabot/tools/watchdog"
 )
 
-func TestController_updatePosition(t *testing.T) {
+func TestController_processTrade(t *testing.T) {
 	t.Run("market orders", func(t *testing.T) {
 		storage, err := storage.FromMemory()
 		require.NoError(t, err)
@@ -22,37 +27,37 @@ func TestController_updatePosition(t *testing.T) {
 		controller := NewController(ctx, wallet, storage, NewOrderFeed())
 
 		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
-		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
 		require.NoError(t, err)
 
-		require.Equal(t, 1000.0, controller.position["BTCUSDT"].AvgPrice)
-		require.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
-		assert.Equal(t, model.SideTypeBuy, controller.position["BTCUSDT"].Side)
+		require.Equal(t, 1000.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+		require.Equal(t, 1.0, controller.positions.size("BTCUSDT"))
+		assert.Equal(t, model.SideTypeBuy, controller.positions.positions["BTCUSDT"].side())
 
 		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 2000})
-		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
 		require.NoError(t, err)
 
-		require.Equal(t, 1500.0, controller.position["BTCUSDT"].AvgPrice)
-		require.Equal(t, 2.0, controller.position["BTCUSDT"].Quantity)
+		require.Equal(t, 1500.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+		require.Equal(t, 2.0, controller.positions.size("BTCUSDT"))
 
 		// close half position 1BTC with 100% of profit
 		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 3000})
-		order, err := controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		order, err := controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
 		require.NoError(t, err)
 
-		assert.Equal(t, 1500.0, controller.position["BTCUSDT"].AvgPrice)
-		assert.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+		assert.Equal(t, 1500.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+		assert.Equal(t, 1.0, controller.positions.size("BTCUSDT"))
 
 		assert.Equal(t, 1500.0, order.ProfitValue)
 		assert.Equal(t, 1.0, order.Profit)
 
 		// sell remaining BTC, 50% of loss
 		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 750})
-		order, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		order, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
 		require.NoError(t, err)
 
-		assert.Nil(t, controller.position["BTCUSDT"]) // close position
+		assert.Zero(t, controller.positions.size("BTCUSDT")) // close position
 		assert.Equal(t, -750.0, order.ProfitValue)
 		assert.Equal(t, -0.5, order.Profit)
 	})
@@ -72,8 +77,8 @@ func TestController_updatePosition(t *testing.T) {
 		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", High: 1000, Close: 1000})
 		controller.updateOrders()
 
-		require.Equal(t, 1000.0, controller.position["BTCUSDT"].AvgPrice)
-		require.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+		require.Equal(t, 1000.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+		require.Equal(t, 1.0, controller.positions.size("BTCUSDT"))
 
 		_, err = controller.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 2000)
 		require.NoError(t, err)
@@ -82,7 +87,7 @@ func TestController_updatePosition(t *testing.T) {
 		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", High: 2000, Close: 2000})
 		controller.updateOrders()
 
-		require.Nil(t, controller.position["BTCUSDT"])
+		require.Zero(t, controller.positions.size("BTCUSDT"))
 		require.Len(t, controller.Results["BTCUSDT"].WinLong, 1)
 		require.Equal(t, 1000.0, controller.Results["BTCUSDT"].WinLong[0])
 		require.Len(t, controller.Results["BTCUSDT"].WinLongPercent, 1)
@@ -111,7 +116,7 @@ func TestController_updatePosition(t *testing.T) {
 		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", High: 2000, Close: 2000})
 		controller.updateOrders()
 
-		require.Nil(t, controller.position["BTCUSDT"])
+		require.Zero(t, controller.positions.size("BTCUSDT"))
 		require.Len(t, controller.Results["BTCUSDT"].WinLong, 1)
 		require.Equal(t, 1000.0, controller.Results["BTCUSDT"].WinLong[0])
 		require.Len(t, controller.Results["BTCUSDT"].WinLongPercent, 1)
@@ -136,14 +141,14 @@ func TestController_updatePosition(t *testing.T) {
 		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 1000, Low: 1000})
 		controller.updateOrders()
 
-		assert.Equal(t, 1000.0, controller.position["BTCUSDT"].AvgPrice)
-		assert.Equal(t, 2.0, controller.position["BTCUSDT"].Quantity)
+		assert.Equal(t, 1000.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+		assert.Equal(t, 2.0, controller.positions.size("BTCUSDT"))
 
-		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1.0)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1.0, false)
 		require.NoError(t, err)
 
-		assert.Equal(t, 1000.0, controller.position["BTCUSDT"].AvgPrice)
-		assert.Equal(t, 3.0, controller.position["BTCUSDT"].Quantity)
+		assert.Equal(t, 1000.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+		assert.Equal(t, 3.0, controller.positions.size("BTCUSDT"))
 
 		_, err = controller.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 2000, 500, 500)
 		require.NoError(t, err)
@@ -152,13 +157,17 @@ func TestController_updatePosition(t *testing.T) {
 		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 400, Low: 400})
 		controller.updateOrders()
 
-		assert.Equal(t, 1000.0, controller.position["BTCUSDT"].AvgPrice)
-		assert.Equal(t, 2.0, controller.position["BTCUSDT"].Quantity)
+		assert.Equal(t, 1000.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+		assert.Equal(t, 2.0, controller.positions.size("BTCUSDT"))
 
 		require.Len(t, controller.Results["BTCUSDT"].LoseLong, 1)
 		require.Equal(t, -500.0, controller.Results["BTCUSDT"].LoseLong[0])
 		require.Len(t, controller.Results["BTCUSDT"].LoseLongPercent, 1)
 		require.Equal(t, -0.5, controller.Results["BTCUSDT"].LoseLongPercent[0])
+		require.Equal(t, []float64{-500}, controller.Results["BTCUSDT"].Profits)
+		require.Len(t, controller.Results["BTCUSDT"].Trades, 1)
+		require.Equal(t, -500.0, controller.Results["BTCUSDT"].Trades[0].Profit)
+		require.False(t, controller.Results["BTCUSDT"].Trades[0].End.Before(controller.Results["BTCUSDT"].Trades[0].Start))
 	})
 
 	t.Run("short market", func(t *testing.T) {
@@ -171,15 +180,57 @@ func TestController_updatePosition(t *testing.T) {
 		controller := NewController(ctx, wallet, storage, NewOrderFeed())
 		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 1500, Low: 1500})
 
-		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1)
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
 		require.NoError(t, err)
 
-		assert.Equal(t, model.SideTypeSell, controller.position["BTCUSDT"].Side)
-		assert.Equal(t, 1500.0, controller.position["BTCUSDT"].AvgPrice)
-		assert.Equal(t, 1.0, controller.position["BTCUSDT"].Quantity)
+		assert.Equal(t, model.SideTypeSell, controller.positions.positions["BTCUSDT"].side())
+		assert.Equal(t, 1500.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+		assert.Equal(t, -1.0, controller.positions.size("BTCUSDT"))
 	})
 }
 
+func TestController_Excursion(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := []model.Candle{
+		{Time: start, Pair: "BTCUSDT", High: 1300, Low: 700, Close: 1000},
+		{Time: start.Add(time.Hour), Pair: "BTCUSDT", High: 1200, Low: 950, Close: 1100},
+		{Time: start.Add(2 * time.Hour), Pair: "BTCUSDT", High: 1150, Low: 900, Close: 1100},
+	}
+
+	wallet.OnCandle(candles[0])
+	controller.OnCandle(candles[0])
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+
+	// the candle of the entry is not included, its range happened before the order
+	controller.OnCandle(candles[0])
+	for _, candle := range candles[1:] {
+		wallet.OnCandle(candle)
+		controller.OnCandle(candle)
+	}
+
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+
+	trades := controller.Results["BTCUSDT"].Trades
+	require.Len(t, trades, 1)
+	require.InDelta(t, 0.1, trades[0].MAE, 1e-9)
+	require.InDelta(t, 0.2, trades[0].MFE, 1e-9)
+
+	file := t.TempDir() + "/trades.csv"
+	require.NoError(t, controller.Results["BTCUSDT"].SaveTrades(file))
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	require.Equal(t, "start,end,profit,mae,mfe\n"+
+		"2022-01-01T00:00:00Z,2022-01-01T02:00:00Z,100,0.1000,0.2000\n", string(content))
+}
+
 func TestController_PositionValue(t *testing.T) {
 	storage, err := storage.FromMemory()
 	require.NoError(t, err)
@@ -193,7 +244,7 @@ func TestController_PositionValue(t *testing.T) {
 	wallet.OnCandle(lastCandle)
 	controller.OnCandle(lastCandle)
 
-	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1.0)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1.0, false)
 	require.NoError(t, err)
 
 	value, err := controller.PositionValue("BTCUSDT")
@@ -214,7 +265,7 @@ func TestController_Position(t *testing.T) {
 	wallet.OnCandle(lastCandle)
 	controller.OnCandle(lastCandle)
 
-	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1.0)
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1.0, false)
 	require.NoError(t, err)
 
 	asset, quote, err := controller.Position("BTCUSDT")
@@ -222,3 +273,517 @@ func TestController_Position(t *testing.T) {
 	assert.Equal(t, 1.0, asset)
 	assert.Equal(t, 1500.0, quote)
 }
+
+func TestController_Pause(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+
+	controller.Pause("BTCUSDT", model.PauseEntries)
+	require.Equal(t, map[string]model.PauseMode{"BTCUSDT": model.PauseEntries}, controller.PausedPairs())
+
+	// entries are blocked, exits are allowed
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.ErrorIs(t, err, ErrPaused)
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5, false)
+	require.NoError(t, err)
+
+	controller.Pause("BTCUSDT", model.PauseAll)
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5, false)
+	require.ErrorIs(t, err, ErrPaused)
+
+	controller.Resume("BTCUSDT")
+	require.Empty(t, controller.PausedPairs())
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 0.5, false)
+	require.NoError(t, err)
+}
+
+func TestController_Hold(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+
+	// the strongest of the pause and the holds applies
+	controller.Pause("BTCUSDT", model.PauseAll)
+	controller.Hold("BTCUSDT", "drawdown", model.PauseEntries)
+	controller.Hold("BTCUSDT", "daily_loss", model.PauseEntries)
+	require.Equal(t, model.PauseAll, controller.PauseMode("BTCUSDT"))
+
+	controller.Pause("BTCUSDT", model.PauseNone)
+	require.Equal(t, model.PauseEntries, controller.PauseMode("BTCUSDT"))
+
+	// releasing a hold keeps the holds of other owners
+	controller.Release("BTCUSDT", "daily_loss")
+	require.Equal(t, map[string]model.PauseMode{"BTCUSDT": model.PauseEntries}, controller.PausedPairs())
+	controller.Release("BTCUSDT", "drawdown")
+	require.Empty(t, controller.PausedPairs())
+
+	// resuming a pair releases all holds
+	controller.Hold("BTCUSDT", "drawdown", model.PauseEntries)
+	controller.Resume("BTCUSDT")
+	require.Equal(t, model.PauseNone, controller.PauseMode("BTCUSDT"))
+}
+
+func TestController_ModifyOrder(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 900)
+	require.NoError(t, err)
+
+	modified, err := controller.ModifyOrder(order, 950, 0)
+	require.NoError(t, err)
+	require.Equal(t, 950.0, modified.Price)
+	require.NotZero(t, modified.ID)
+
+	// the replaced order is pending cancel and the new order is stored
+	orders, err := db.Orders(storage.WithExchangeID(order.ExchangeID))
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, model.OrderStatusTypePendingCancel, orders[0].Status)
+
+	orders, err = db.Orders(storage.WithExchangeID(modified.ExchangeID))
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, 950.0, orders[0].Price)
+
+	// increasing an order is an entry, blocked by the pause
+	controller.Pause("BTCUSDT", model.PauseEntries)
+	_, err = controller.ModifyOrder(modified, 0, 2)
+	require.ErrorIs(t, err, ErrPaused)
+	_, err = controller.ModifyOrder(modified, 960, 0)
+	require.NoError(t, err)
+}
+
+// streamWallet is a paper wallet with a user data stream
+type streamWallet struct {
+	*exchange.PaperWallet
+	updates chan model.Order
+}
+
+func (s streamWallet) AccountSubscription(_ context.Context) (chan model.Order, chan error) {
+	return s.updates, make(chan error)
+}
+
+func TestController_AccountSubscription(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := streamWallet{
+		PaperWallet: exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000)),
+		updates:     make(chan model.Order),
+	}
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	controller.tickerInterval = time.Hour
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 900)
+	require.NoError(t, err)
+
+	controller.Start()
+	defer controller.Stop()
+
+	// updates of unknown orders are ignored
+	wallet.updates <- model.Order{ExchangeID: order.ExchangeID + 1, Pair: "BTCUSDT",
+		Status: model.OrderStatusTypeFilled}
+
+	filled := order
+	filled.Status = model.OrderStatusTypeFilled
+	wallet.updates <- filled
+
+	require.Eventually(t, func() bool {
+		controller.mtx.Lock()
+		defer controller.mtx.Unlock()
+		return controller.positions.size("BTCUSDT") != 0
+	}, time.Second, 10*time.Millisecond)
+
+	stored, err := storage.Orders()
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.Equal(t, model.OrderStatusTypeFilled, stored[0].Status)
+	require.Equal(t, 900.0, controller.positions.positions["BTCUSDT"].AvgPrice)
+}
+
+// emulatedOCOWallet is a paper wallet where the controller cancels the legs of OCO orders
+type emulatedOCOWallet struct {
+	*exchange.PaperWallet
+}
+
+func (emulatedOCOWallet) EmulatedOCO(_ string) bool {
+	return true
+}
+
+func TestController_EmulatedOCO(t *testing.T) {
+	db, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := emulatedOCOWallet{exchange.NewPaperWallet(ctx, "USDT",
+		exchange.WithPaperAsset("USDT", 0), exchange.WithPaperAsset("BTC", 1))}
+	controller := NewController(ctx, wallet, db, NewOrderFeed())
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	orders, err := controller.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 1100, 900, 890)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+
+	// order updates without group keep the stored group
+	filled := orders[0]
+	filled.GroupID = nil
+	filled.Status = model.OrderStatusTypeFilled
+	controller.onOrderUpdate(filled)
+
+	stored, err := db.Orders(storage.WithExchangeID(orders[0].ExchangeID))
+	require.NoError(t, err)
+	require.Equal(t, orders[0].GroupID, stored[0].GroupID)
+
+	stored, err = db.Orders(storage.WithExchangeID(orders[1].ExchangeID))
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypePendingCancel, stored[0].Status)
+
+	leg, err := wallet.Order("BTCUSDT", orders[1].ExchangeID)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeCanceled, leg.Status)
+}
+
+// quoteWallet is a paper wallet with a stream of best bid and ask
+type quoteWallet struct {
+	*exchange.PaperWallet
+	quotes chan model.Quote
+}
+
+func (q quoteWallet) QuoteSubscription(_ context.Context, _ string) (chan model.Quote, chan error) {
+	return q.quotes, make(chan error)
+}
+
+func TestController_Quotes(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := quoteWallet{
+		PaperWallet: exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000)),
+		quotes:      make(chan model.Quote),
+	}
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	wallet.OnCandle(model.Candle{Pair: "ETHUSDT", Close: 100})
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+
+	err = NewController(ctx, wallet.PaperWallet, storage, NewOrderFeed()).SubscribeQuotes("BTCUSDT")
+	require.ErrorIs(t, err, exchange.ErrUnsupportedFeed)
+
+	require.NoError(t, controller.SubscribeQuotes("BTCUSDT"))
+	wallet.quotes <- model.Quote{Pair: "BTCUSDT", Time: time.Now(), Bid: 990, Ask: 995}
+	require.Eventually(t, func() bool {
+		_, ok := controller.Quote("BTCUSDT")
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	t.Run("join the book", func(t *testing.T) {
+		order, err := controller.CreateOrderLimitOptions(model.SideTypeBuy, "BTCUSDT", 1, 1000,
+			model.OrderOptions{Pricing: model.PricingJoin})
+		require.NoError(t, err)
+		require.Equal(t, 990.0, order.Price)
+	})
+
+	t.Run("cross the spread", func(t *testing.T) {
+		order, err := controller.CreateOrderLimitOptions(model.SideTypeBuy, "BTCUSDT", 1, 1000,
+			model.OrderOptions{Pricing: model.PricingCross})
+		require.NoError(t, err)
+		require.Equal(t, 995.0, order.Price)
+	})
+
+	t.Run("limit without live quote", func(t *testing.T) {
+		order, err := controller.CreateOrderLimitOptions(model.SideTypeBuy, "ETHUSDT", 1, 90,
+			model.OrderOptions{Pricing: model.PricingJoin})
+		require.NoError(t, err)
+		require.Equal(t, 90.0, order.Price)
+
+		controller.OnQuote(model.Quote{Pair: "ETHUSDT", Time: time.Now().Add(-time.Hour), Bid: 99, Ask: 101})
+		_, ok := controller.Quote("ETHUSDT")
+		require.False(t, ok)
+	})
+
+	t.Run("unknown pricing", func(t *testing.T) {
+		_, err := controller.CreateOrderLimitOptions(model.SideTypeBuy, "BTCUSDT", 1, 1000,
+			model.OrderOptions{Pricing: "BEST"})
+		require.ErrorIs(t, err, exchange.ErrUnsupportedOrder)
+	})
+
+	t.Run("expected price of market orders", func(t *testing.T) {
+		require.Equal(t, 995.0, controller.expectedPrice(model.Order{Pair: "BTCUSDT",
+			Side: model.SideTypeBuy, Type: model.OrderTypeMarket}))
+		require.Equal(t, 990.0, controller.expectedPrice(model.Order{Pair: "BTCUSDT",
+			Side: model.SideTypeSell, Type: model.OrderTypeMarket}))
+	})
+}
+
+// countingStreamWallet is a paper wallet with a user data stream without messages
+type countingStreamWallet struct {
+	*exchange.PaperWallet
+	subscriptions int64
+}
+
+func (c *countingStreamWallet) AccountSubscription(_ context.Context) (chan model.Order, chan error) {
+	atomic.AddInt64(&c.subscriptions, 1)
+	return make(chan model.Order), make(chan error)
+}
+
+func TestController_AccountWatchdog(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wallet := &countingStreamWallet{
+		PaperWallet: exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000)),
+	}
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	controller.tickerInterval = time.Hour
+
+	dog := watchdog.New(watchdog.WithInterval(10 * time.Millisecond))
+	dog.Start(ctx)
+	controller.SetWatchdog(dog, 50*time.Millisecond)
+
+	controller.Start()
+	defer controller.Stop()
+
+	// the stale stream is subscribed again
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&wallet.subscriptions) >= 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+// subscribedWallet is a paper wallet that signals the subscription of its user data stream
+type subscribedWallet struct {
+	*exchange.PaperWallet
+	subscribed chan struct{}
+}
+
+func (s *subscribedWallet) AccountSubscription(ctx context.Context) (chan model.Order, chan error) {
+	orders, errs := s.PaperWallet.AccountSubscription(ctx)
+	close(s.subscribed)
+	return orders, errs
+}
+
+func TestController_Liquidation(t *testing.T) {
+	store, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wallet := &subscribedWallet{
+		PaperWallet: exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000),
+			exchange.WithPaperLeverage("BTCUSDT", 10)),
+		subscribed: make(chan struct{}),
+	}
+	feed := NewOrderFeed()
+	orders := make(chan model.Order, 10)
+	feed.Subscribe("BTCUSDT", func(order model.Order) {
+		orders <- order
+	}, false)
+	feed.Start()
+
+	controller := NewController(ctx, wallet, store, feed)
+	controller.tickerInterval = time.Hour
+	controller.Start()
+	defer controller.Stop()
+	<-wallet.subscribed
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 50, false)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderTypeMarket, (<-orders).Type)
+
+	// the wallet liquidates the long position and the controller closes it
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 95, Low: 89})
+	select {
+	case order := <-orders:
+		require.Equal(t, model.OrderTypeLiquidation, order.Type)
+		require.Equal(t, model.SideTypeSell, order.Side)
+		require.Equal(t, 50.0, order.Quantity)
+	case <-time.After(time.Second):
+		require.Fail(t, "liquidation order not published")
+	}
+
+	stored, err := store.Orders(storage.WithPair("BTCUSDT"))
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	require.Equal(t, model.OrderTypeLiquidation, stored[1].Type)
+
+	asset, _, err := controller.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 0.0, asset)
+}
+
+func TestController_PartialFills(t *testing.T) {
+	store, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wallet := &subscribedWallet{
+		PaperWallet: exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000),
+			exchange.WithPaperParticipation(0.1)),
+		subscribed: make(chan struct{}),
+	}
+	feed := NewOrderFeed()
+	orders := make(chan model.Order, 10)
+	feed.Subscribe("BTCUSDT", func(order model.Order) {
+		orders <- order
+	}, false)
+	feed.Start()
+
+	controller := NewController(ctx, wallet, store, feed)
+	controller.tickerInterval = time.Hour
+	controller.Start()
+	defer controller.Stop()
+	<-wallet.subscribed
+
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 110})
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 110})
+	_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 2, 100)
+	require.NoError(t, err)
+	require.Equal(t, model.OrderStatusTypeNew, (<-orders).Status)
+
+	// each partial fill is published
+	for _, expected := range []struct {
+		status   model.OrderStatusType
+		executed float64
+	}{
+		{model.OrderStatusTypePartiallyFilled, 1},
+		{model.OrderStatusTypeFilled, 2},
+	} {
+		wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 100, Volume: 10})
+		select {
+		case order := <-orders:
+			require.Equal(t, expected.status, order.Status)
+			require.InDelta(t, expected.executed, order.Executed, 1e-9)
+		case <-time.After(time.Second):
+			require.Fail(t, "order update not published")
+		}
+	}
+
+	stored, err := store.Orders(storage.WithPair("BTCUSDT"))
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.Equal(t, model.OrderStatusTypeFilled, stored[0].Status)
+
+	asset, _, err := controller.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Equal(t, 2.0, asset)
+}
+
+// lostResponseWallet places orders but fails as if the response was lost, eg: by a timeout
+type lostResponseWallet struct {
+	*exchange.PaperWallet
+}
+
+func (w lostResponseWallet) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	if _, err := w.PaperWallet.CreateOrderRequest(request); err != nil {
+		return model.Order{}, err
+	}
+	return model.Order{}, errors.New("request timeout")
+}
+
+func TestController_ClientOrderID(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("persisted before submission", func(t *testing.T) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		controller.SetClientOrderPrefix("bot1-")
+		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 100})
+
+		order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+		require.NoError(t, err)
+		require.Equal(t, "bot1-1", order.ClientOrderID)
+		require.Equal(t, model.OrderStatusTypeNew, order.Status)
+
+		placed, err := wallet.OrderByClientID("BTCUSDT", "bot1-1")
+		require.NoError(t, err)
+		require.Equal(t, order.ExchangeID, placed.ExchangeID)
+
+		// rejected orders are kept with their client order ID
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 100, false)
+		require.Error(t, err)
+
+		orders, err := store.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		require.Equal(t, order.ExchangeID, orders[0].ExchangeID)
+		require.Equal(t, "bot1-1", orders[0].ClientOrderID)
+		require.Equal(t, model.OrderStatusTypeRejected, orders[1].Status)
+		require.Equal(t, "bot1-2", orders[1].ClientOrderID)
+	})
+
+	t.Run("lost response", func(t *testing.T) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		controller := NewController(ctx, lostResponseWallet{wallet}, store, NewOrderFeed())
+		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 100})
+
+		// the placed order is found by its client order ID instead of being placed again
+		order, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		require.Equal(t, "ninjabot-1", order.ClientOrderID)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+
+		orders, err := store.Orders()
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, order.ExchangeID, orders[0].ExchangeID)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, asset)
+	})
+
+	t.Run("all placements", func(t *testing.T) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000),
+			exchange.WithPaperAsset("BTC", 3))
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 100})
+
+		legs, err := controller.CreateOrderOCO(model.SideTypeSell, "BTCUSDT", 1, 120, 90, 89)
+		require.NoError(t, err)
+		require.Len(t, legs, 2)
+		trailing, err := controller.CreateOrderTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 0, 0.01)
+		require.NoError(t, err)
+		takeProfit, err := controller.TakeProfit(model.SideTypeSell, "BTCUSDT", 1, 130)
+		require.NoError(t, err)
+		replaced, err := controller.ModifyOrder(takeProfit, 140, 0)
+		require.NoError(t, err)
+
+		for i, order := range []model.Order{legs[0], legs[1], trailing, takeProfit, replaced} {
+			clientOrderID := fmt.Sprintf("ninjabot-%d", i+1)
+			require.Equal(t, clientOrderID, order.ClientOrderID)
+
+			placed, err := wallet.OrderByClientID("BTCUSDT", clientOrderID)
+			require.NoError(t, err)
+			require.Equal(t, order.ExchangeID, placed.ExchangeID)
+
+			stored, err := store.Orders(storage.WithExchangeID(order.ExchangeID))
+			require.NoError(t, err)
+			require.Len(t, stored, 1)
+			require.Equal(t, clientOrderID, stored[0].ClientOrderID)
+		}
+		require.Equal(t, 140.0, replaced.Price)
+	})
+}
@@ -0,0 +1,253 @@
+package order
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/clock"
+)
+
+// ExecutionStats compares the live fills of a pair with the prices expected by the strategy.
+// The expected price of market and limit orders is the last candle close when the order was created,
+// and the trigger price for stop orders. Slippage is a fraction of the expected price, positive when adverse.
+type ExecutionStats struct {
+	Pair     string
+	Orders   int
+	Filled   int
+	Missed   int
+	Volume   float64
+	Fees     float64
+	Slippage []float64
+
+	// SlippageCost is the value lost (or gained, when negative) to slippage, in the quote currency
+	SlippageCost float64
+}
+
+// FillRate returns the fraction of tracked orders that were filled
+func (s ExecutionStats) FillRate() float64 {
+	if s.Filled+s.Missed == 0 {
+		return 0
+	}
+	return float64(s.Filled) / float64(s.Filled+s.Missed)
+}
+
+// AvgSlippage returns the average slippage of filled orders, as a fraction of the expected price
+func (s ExecutionStats) AvgSlippage() float64 {
+	if len(s.Slippage) == 0 {
+		return 0
+	}
+
+	total := 0.0
+	for _, slippage := range s.Slippage {
+		total += slippage
+	}
+	return total / float64(len(s.Slippage))
+}
+
+// MaxSlippage returns the worst slippage of filled orders, as a fraction of the expected price
+func (s ExecutionStats) MaxSlippage() float64 {
+	if len(s.Slippage) == 0 {
+		return 0
+	}
+
+	worst := math.Inf(-1)
+	for _, slippage := range s.Slippage {
+		worst = math.Max(worst, slippage)
+	}
+	return worst
+}
+
+// FeeDrag returns the paid fees as a fraction of the traded volume
+func (s ExecutionStats) FeeDrag() float64 {
+	if s.Volume == 0 {
+		return 0
+	}
+	return s.Fees / s.Volume
+}
+
+func (s ExecutionStats) String() string {
+	tableString := &strings.Builder{}
+	table := tablewriter.NewWriter(tableString)
+	_, quote := exchange.SplitAssetQuote(s.Pair)
+	data := [][]string{
+		{"Coin", s.Pair},
+		{"Orders", strconv.Itoa(s.Orders)},
+		{"Filled", strconv.Itoa(s.Filled)},
+		{"Missed", strconv.Itoa(s.Missed)},
+		{"% Fill", fmt.Sprintf("%.1f", s.FillRate()*100)},
+		{"Avg. Slip.", fmt.Sprintf("%.4f %%", s.AvgSlippage()*100)},
+		{"Max. Slip.", fmt.Sprintf("%.4f %%", s.MaxSlippage()*100)},
+		{"Slip. Cost", fmt.Sprintf("%.4f %s", s.SlippageCost, quote)},
+		{"Fees", fmt.Sprintf("%.4f %s", s.Fees, quote)},
+		{"Fee Drag", fmt.Sprintf("%.4f %%", s.FeeDrag()*100)},
+	}
+	table.AppendBulk(data)
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
+	table.Render()
+	return tableString.String()
+}
+
+// ExecutionReport is the execution quality of all traded pairs
+type ExecutionReport struct {
+	Time  time.Time
+	Pairs []ExecutionStats
+}
+
+func (r ExecutionReport) String() string {
+	report := &strings.Builder{}
+	fmt.Fprintf(report, "[EXECUTION REPORT] %s\n", r.Time.Format(time.RFC3339))
+	for _, stats := range r.Pairs {
+		report.WriteString(stats.String())
+	}
+	return report.String()
+}
+
+type execution struct {
+	mtx      sync.Mutex
+	feeRate  float64
+	interval time.Duration
+	lastSent time.Time
+	expected map[string]float64
+	stats    map[string]*ExecutionStats
+}
+
+// SetFeeRate sets the fee rate used to estimate fees in the execution report, eg: 0.001 for 0.1%
+func (c *Controller) SetFeeRate(rate float64) {
+	c.execution.mtx.Lock()
+	defer c.execution.mtx.Unlock()
+	c.execution.feeRate = rate
+}
+
+// SetExecutionReport sends the execution report to the notifier periodically, disabled by default
+func (c *Controller) SetExecutionReport(interval time.Duration) {
+	c.execution.mtx.Lock()
+	defer c.execution.mtx.Unlock()
+	c.execution.interval = interval
+	c.execution.lastSent = c.clock.Now()
+}
+
+// ExecutionReport returns the execution quality of live fills, per pair
+func (c *Controller) ExecutionReport() ExecutionReport {
+	c.execution.mtx.Lock()
+	defer c.execution.mtx.Unlock()
+
+	report := ExecutionReport{Time: c.clock.Now()}
+	for _, stats := range c.execution.stats {
+		pairStats := *stats
+		pairStats.Slippage = append([]float64(nil), stats.Slippage...)
+		report.Pairs = append(report.Pairs, pairStats)
+	}
+
+	sort.Slice(report.Pairs, func(i, j int) bool {
+		return report.Pairs[i].Pair < report.Pairs[j].Pair
+	})
+	return report
+}
+
+func (c *Controller) executionStats(pair string) *ExecutionStats {
+	stats, ok := c.execution.stats[pair]
+	if !ok {
+		stats = &ExecutionStats{Pair: pair}
+		c.execution.stats[pair] = stats
+	}
+	return stats
+}
+
+// expectedPrice returns the price assumed by a backtest for a given order, or the side of the live quote
+// crossed by market orders, when available
+func (c *Controller) expectedPrice(order model.Order) float64 {
+	switch order.Type {
+	case model.OrderTypeStopLoss, model.OrderTypeStopLossLimit:
+		if order.Stop != nil {
+			return *order.Stop
+		}
+		return order.Price
+	case model.OrderTypeMarket:
+		if quote, ok := c.Quote(order.Pair); ok {
+			if order.Side == model.SideTypeBuy {
+				return quote.Ask
+			}
+			return quote.Bid
+		}
+		return c.lastPrice[order.Pair]
+	default:
+		return c.lastPrice[order.Pair]
+	}
+}
+
+// expect registers the expected price of a new order, it must be called before the order is processed
+func (c *Controller) expect(order model.Order) {
+	expected := c.expectedPrice(order)
+	if expected <= 0 {
+		return
+	}
+
+	c.execution.mtx.Lock()
+	defer c.execution.mtx.Unlock()
+	c.execution.expected[c.ownerKey(order.Pair, order.ExchangeID)] = expected
+	c.executionStats(order.Pair).Orders++
+}
+
+// recordExecution compares a filled order with its expected price, or registers a missed fill
+func (c *Controller) recordExecution(order model.Order) {
+	switch order.Status {
+	case model.OrderStatusTypeFilled, model.OrderStatusTypeCanceled, model.OrderStatusTypeExpired,
+		model.OrderStatusTypeRejected:
+	default:
+		return
+	}
+
+	c.execution.mtx.Lock()
+	defer c.execution.mtx.Unlock()
+
+	key := c.ownerKey(order.Pair, order.ExchangeID)
+	expected, ok := c.execution.expected[key]
+	if !ok {
+		return
+	}
+	delete(c.execution.expected, key)
+
+	stats := c.executionStats(order.Pair)
+	if order.Status != model.OrderStatusTypeFilled {
+		// canceled OCO legs are expected, the other leg was executed
+		if order.GroupID == nil {
+			stats.Missed++
+		}
+		return
+	}
+
+	slippage := (order.Price - expected) / expected
+	if order.Side == model.SideTypeSell {
+		slippage = -slippage
+	}
+
+	stats.Filled++
+	stats.Slippage = append(stats.Slippage, slippage)
+	stats.SlippageCost += slippage * expected * order.Quantity
+	stats.Volume += order.Price * order.Quantity
+	stats.Fees += order.Price * order.Quantity * c.execution.feeRate
+}
+
+// reportExecution notifies the execution report when the configured interval is elapsed
+func (c *Controller) reportExecution() {
+	c.execution.mtx.Lock()
+	interval := c.execution.interval
+	due := interval > 0 && clock.Since(c.clock, c.execution.lastSent) >= interval
+	if due {
+		c.execution.lastSent = c.clock.Now()
+	}
+	c.execution.mtx.Unlock()
+
+	if due {
+		c.notify(c.ExecutionReport().String())
+	}
+}
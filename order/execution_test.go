@@ -0,0 +1,54 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_ExecutionReport(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	controller.SetFeeRate(0.001)
+
+	// strategy expects 1000, but the order is filled at 1010
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1010, High: 1010, Low: 1010})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+
+	// sell expected at 1100, filled at 1089
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1100})
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1089, High: 1089, Low: 1089})
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+
+	// limit order never filled
+	order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 500)
+	require.NoError(t, err)
+	order.Status = model.OrderStatusTypeCanceled
+	controller.processTrade(&order)
+
+	report := controller.ExecutionReport()
+	require.Len(t, report.Pairs, 1)
+
+	stats := report.Pairs[0]
+	require.Equal(t, "BTCUSDT", stats.Pair)
+	require.Equal(t, 3, stats.Orders)
+	require.Equal(t, 2, stats.Filled)
+	require.Equal(t, 1, stats.Missed)
+	require.InDelta(t, 2.0/3.0, stats.FillRate(), 1e-9)
+	require.InDelta(t, 0.01, stats.AvgSlippage(), 1e-9)
+	require.InDelta(t, 0.01, stats.MaxSlippage(), 1e-9)
+	require.InDelta(t, 21.0, stats.SlippageCost, 1e-9)
+	require.InDelta(t, 0.001, stats.FeeDrag(), 1e-9)
+	require.Contains(t, report.String(), "BTCUSDT")
+}
@@ -0,0 +1,147 @@
+package order
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+// ExpireFunc is called after an expired limit order is canceled, with the market order that replaced
+// its unfilled quantity, if any
+type ExpireFunc func(expired model.Order, replacement *model.Order)
+
+// orderTTL is the time to live of the limit orders of a broker
+type orderTTL struct {
+	lifetime time.Duration
+	action   model.ExpireAction
+	callback ExpireFunc
+}
+
+// expiration is an open limit order to be expired at a deadline
+type expiration struct {
+	order    model.Order
+	deadline time.Time
+	ttl      *orderTTL
+	// broker places the market replacement, eg: the allocated broker of the strategy that created the order
+	broker service.Broker
+}
+
+func newOrderTTL(lifetime time.Duration, action model.ExpireAction, callback ExpireFunc) *orderTTL {
+	if lifetime <= 0 {
+		return nil
+	}
+	if action == "" {
+		action = model.ExpireCancel
+	}
+	return &orderTTL{lifetime: lifetime, action: action, callback: callback}
+}
+
+// SetOrderTTL expires the limit orders unfilled after a lifetime, canceling them or replacing them with
+// market orders. The callback is called after the expiration, eg: to notify the strategy. The TTL is checked
+// on each complete candle, and a zero lifetime disables it.
+func (c *Controller) SetOrderTTL(lifetime time.Duration, action model.ExpireAction, callback ExpireFunc) {
+	c.expireMtx.Lock()
+	defer c.expireMtx.Unlock()
+	c.ttl = newOrderTTL(lifetime, action, callback)
+}
+
+// SetOrderTTL expires the limit orders of the strategy unfilled after a lifetime, overriding the TTL of the
+// controller, see `Controller.SetOrderTTL`. Market replacements are placed with the strategy allocation.
+func (a *AllocatedBroker) SetOrderTTL(lifetime time.Duration, action model.ExpireAction, callback ExpireFunc) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.ttl = newOrderTTL(lifetime, action, callback)
+}
+
+// expireLater registers an open limit order to be expired by a TTL
+func (c *Controller) expireLater(order model.Order, ttl *orderTTL, broker service.Broker) {
+	if ttl == nil || (order.Type != model.OrderTypeLimit && order.Type != model.OrderTypeLimitMaker) {
+		return
+	}
+	if order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled {
+		return
+	}
+
+	c.expireMtx.Lock()
+	defer c.expireMtx.Unlock()
+	c.expirations[c.ownerKey(order.Pair, order.ExchangeID)] = &expiration{
+		order:    order,
+		deadline: c.clock.Now().Add(ttl.lifetime),
+		ttl:      ttl,
+		broker:   broker,
+	}
+}
+
+// defaultTTL returns the TTL of the orders created with the controller
+func (c *Controller) defaultTTL() *orderTTL {
+	c.expireMtx.Lock()
+	defer c.expireMtx.Unlock()
+	return c.ttl
+}
+
+// forgetExpiration removes a closed order from the expirations
+func (c *Controller) forgetExpiration(order model.Order) {
+	if order.Status == model.OrderStatusTypeNew || order.Status == model.OrderStatusTypePartiallyFilled {
+		return
+	}
+
+	c.expireMtx.Lock()
+	defer c.expireMtx.Unlock()
+	delete(c.expirations, c.ownerKey(order.Pair, order.ExchangeID))
+}
+
+// expireOrders cancels the open limit orders of a pair past their deadline
+func (c *Controller) expireOrders(pair string) {
+	now := c.clock.Now()
+
+	c.expireMtx.Lock()
+	expired := make([]*expiration, 0)
+	for key, item := range c.expirations {
+		if item.order.Pair == pair && !now.Before(item.deadline) {
+			expired = append(expired, item)
+			delete(c.expirations, key)
+		}
+	}
+	c.expireMtx.Unlock()
+
+	for _, item := range expired {
+		c.expire(item)
+	}
+}
+
+func (c *Controller) expire(item *expiration) {
+	order, err := c.exchange.Order(item.order.Pair, item.order.ExchangeID)
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+	if order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled {
+		return
+	}
+	order.ID = item.order.ID
+	order.ClientOrderID = item.order.ClientOrderID
+
+	if err := c.Cancel(order); err != nil {
+		c.notifyError(err)
+		return
+	}
+	log.Infof("[ORDER EXPIRED] %s", order)
+
+	var replacement *model.Order
+	remaining := order.Quantity - order.Executed
+	if item.ttl.action == model.ExpireMarket && remaining > 0 {
+		placed, err := item.broker.CreateOrderMarket(order.Side, order.Pair, remaining, false)
+		if err != nil {
+			c.notifyError(err)
+		} else {
+			replacement = &placed
+		}
+	}
+
+	if item.ttl.callback != nil {
+		item.ttl.callback(order, replacement)
+	}
+}
@@ -0,0 +1,124 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+	"github.com/bengalm/ninjabot/tools/clock"
+)
+
+func TestController_OrderTTL(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newController := func(t *testing.T) (*Controller, *exchange.PaperWallet, *clock.Simulated) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Time: start, Pair: "BTCUSDT", Close: 100, Low: 100, High: 100})
+
+		simulated := clock.NewSimulated(start)
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		controller.SetClock(simulated)
+		return controller, wallet, simulated
+	}
+
+	candle := func(simulated *clock.Simulated, wallet *exchange.PaperWallet, controller *Controller, d time.Duration) {
+		simulated.Advance(d)
+		candle := model.Candle{Time: simulated.Now(), Pair: "BTCUSDT", Close: 100, Low: 99, High: 101,
+			Complete: true}
+		wallet.OnCandle(candle)
+		controller.OnCandle(candle)
+	}
+
+	t.Run("cancel", func(t *testing.T) {
+		controller, wallet, simulated := newController(t)
+		var expired []model.Order
+		controller.SetOrderTTL(time.Hour, model.ExpireCancel, func(order model.Order, replacement *model.Order) {
+			require.Nil(t, replacement)
+			expired = append(expired, order)
+		})
+
+		order, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+		require.NoError(t, err)
+
+		candle(simulated, wallet, controller, 30*time.Minute)
+		require.Empty(t, expired)
+
+		candle(simulated, wallet, controller, 30*time.Minute)
+		require.Len(t, expired, 1)
+		require.Equal(t, order.ExchangeID, expired[0].ExchangeID)
+
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, orders)
+
+		// expired orders are not expired again
+		candle(simulated, wallet, controller, time.Hour)
+		require.Len(t, expired, 1)
+	})
+
+	t.Run("market replacement", func(t *testing.T) {
+		controller, wallet, simulated := newController(t)
+		var replaced *model.Order
+		controller.SetOrderTTL(time.Hour, model.ExpireMarket, func(_ model.Order, replacement *model.Order) {
+			replaced = replacement
+		})
+
+		_, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+		require.NoError(t, err)
+
+		candle(simulated, wallet, controller, time.Hour)
+		require.NotNil(t, replaced)
+		require.Equal(t, model.OrderTypeMarket, replaced.Type)
+		require.Equal(t, model.OrderStatusTypeFilled, replaced.Status)
+		require.Equal(t, 1.0, replaced.Quantity)
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, asset)
+	})
+
+	t.Run("filled orders", func(t *testing.T) {
+		controller, wallet, simulated := newController(t)
+		expired := false
+		controller.SetOrderTTL(time.Hour, model.ExpireCancel, func(model.Order, *model.Order) {
+			expired = true
+		})
+
+		_, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 100)
+		require.NoError(t, err)
+
+		candle(simulated, wallet, controller, time.Hour)
+		require.False(t, expired)
+	})
+
+	t.Run("allocated broker", func(t *testing.T) {
+		controller, wallet, simulated := newController(t)
+		broker := controller.Allocate("scalper", Allocation{Fixed: 500})
+		var replaced *model.Order
+		broker.SetOrderTTL(2*time.Hour, model.ExpireMarket, func(_ model.Order, replacement *model.Order) {
+			replaced = replacement
+		})
+
+		_, err := broker.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+		require.NoError(t, err)
+
+		candle(simulated, wallet, controller, time.Hour)
+		require.Nil(t, replaced)
+
+		candle(simulated, wallet, controller, time.Hour)
+		require.NotNil(t, replaced)
+
+		// the replacement is tracked by the strategy allocation
+		asset, _, err := broker.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, asset)
+	})
+}
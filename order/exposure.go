@@ -0,0 +1,136 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+// ErrExposureLimit is returned for entry orders that exceed the exposure limits of the controller
+var ErrExposureLimit = errors.New("exposure limit")
+
+// ExposureLimits bound the positions opened by the bot, zero values disable a limit. Notionals are valued
+// with the last price of the pairs, in their quote, so the total is meaningful for pairs of a single quote.
+type ExposureLimits struct {
+	// PairNotional is the maximum notional of the position of a pair, including its open entry orders
+	PairNotional float64
+	// TotalNotional is the maximum notional of the positions of all pairs
+	TotalNotional float64
+	// Positions is the maximum number of concurrent open positions
+	Positions int
+}
+
+// SetExposureLimits rejects entry orders, ie: orders that open or increase a position, that would exceed
+// the limits. Exits and protection orders are not limited.
+func (c *Controller) SetExposureLimits(limits ExposureLimits) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.exposure = limits
+}
+
+// checkExposure validates if an entry order of a quantity at a price is within the exposure limits, the
+// caller must hold the controller lock. Rejections are notified, and returned to the strategy.
+func (c *Controller) checkExposure(side model.SideType, pair string, quantity, price float64) error {
+	if c.exposure == (ExposureLimits{}) || !model.IsEntry(side, c.signedPosition(pair)) {
+		return nil
+	}
+
+	if price <= 0 {
+		var err error
+		if price, err = c.price(pair); err != nil {
+			return err
+		}
+	}
+
+	return c.checkExposureNotional(side, pair, quantity*price)
+}
+
+// checkExposureNotional validates the notional of an entry order in the quote, eg: market orders by quote
+// amount, with the exposure limits
+func (c *Controller) checkExposureNotional(side model.SideType, pair string, notional float64) error {
+	if c.exposure == (ExposureLimits{}) || !model.IsEntry(side, c.signedPosition(pair)) {
+		return nil
+	}
+
+	err := c.exceedsExposure(side, pair, notional)
+	if err != nil {
+		c.notifyError(err)
+	}
+	return err
+}
+
+func (c *Controller) exceedsExposure(side model.SideType, pair string, notional float64) error {
+	pairNotional, err := c.pairExposure(side, pair)
+	if err != nil {
+		return err
+	}
+
+	if limit := c.exposure.PairNotional; limit > 0 && pairNotional+notional > limit {
+		return fmt.Errorf("%w: %s notional of %.2f exceeds %.2f", ErrExposureLimit, pair,
+			pairNotional+notional, limit)
+	}
+
+	if c.exposure.TotalNotional > 0 {
+		total := pairNotional + notional
+		for _, other := range c.positions.openPairs() {
+			if other == pair {
+				continue
+			}
+			exposure, err := c.pairExposure(side, other)
+			if err != nil {
+				return err
+			}
+			total += exposure
+		}
+		if total > c.exposure.TotalNotional {
+			return fmt.Errorf("%w: total notional of %.2f exceeds %.2f", ErrExposureLimit, total,
+				c.exposure.TotalNotional)
+		}
+	}
+
+	if limit := c.exposure.Positions; limit > 0 && c.signedPosition(pair) == 0 {
+		open := len(c.positions.openPairs())
+		if open >= limit {
+			return fmt.Errorf("%w: %d open positions, new position of %s not allowed", ErrExposureLimit, open,
+				pair)
+		}
+	}
+	return nil
+}
+
+// pairExposure returns the notional of the position of a pair, and of its open limit orders of the side
+// of the entry
+func (c *Controller) pairExposure(side model.SideType, pair string) (float64, error) {
+	var notional float64
+	if position, ok := c.positions.open(pair); ok {
+		price, err := c.price(pair)
+		if err != nil {
+			price = position.AvgPrice
+		}
+		notional = math.Abs(position.Size) * price
+		side = position.side()
+	}
+
+	orders, err := c.storage.Orders(storage.WithPair(pair), storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+	))
+	if err != nil {
+		return 0, err
+	}
+	for _, order := range orders {
+		if order.Side != side || (order.Type != model.OrderTypeLimit && order.Type != model.OrderTypeLimitMaker) {
+			continue
+		}
+		notional += math.Max(order.Quantity-order.Executed, 0) * order.Price
+	}
+	return notional, nil
+}
+
+// signedPosition returns the size of the position of a pair, negative for short positions
+func (c *Controller) signedPosition(pair string) float64 {
+	return c.positions.size(pair)
+}
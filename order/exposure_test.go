@@ -0,0 +1,90 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/event"
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_ExposureLimits(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newController := func(t *testing.T, limits ExposureLimits) (*Controller, *[]error) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 10000))
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		for _, pair := range []string{"BTCUSDT", "ETHUSDT"} {
+			candle := model.Candle{Time: start, Pair: pair, Close: 100, Low: 100, High: 100}
+			wallet.OnCandle(candle)
+			controller.OnCandle(candle)
+		}
+		controller.SetExposureLimits(limits)
+
+		bus := event.NewBus()
+		errs := make([]error, 0)
+		event.Subscribe(bus, event.Errors, func(e event.Error) {
+			errs = append(errs, e.Err)
+		})
+		controller.SetEventBus(bus)
+		return controller, &errs
+	}
+
+	t.Run("pair notional", func(t *testing.T) {
+		controller, errs := newController(t, ExposureLimits{PairNotional: 500})
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 4, false)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 99)
+		require.NoError(t, err)
+
+		// open entry orders are included in the notional of the pair
+		_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 99)
+		require.ErrorIs(t, err, ErrExposureLimit)
+		_, err = controller.CreateOrderMarketQuote(model.SideTypeBuy, "BTCUSDT", 150)
+		require.ErrorIs(t, err, ErrExposureLimit)
+		require.Len(t, *errs, 2)
+
+		// exits are not limited
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 2, false)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 5, false)
+		require.NoError(t, err)
+	})
+
+	t.Run("total notional", func(t *testing.T) {
+		controller, _ := newController(t, ExposureLimits{TotalNotional: 600})
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 4, false)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 3, false)
+		require.ErrorIs(t, err, ErrExposureLimit)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 2, false)
+		require.NoError(t, err)
+	})
+
+	t.Run("positions", func(t *testing.T) {
+		controller, _ := newController(t, ExposureLimits{Positions: 1})
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 1, false)
+		require.ErrorIs(t, err, ErrExposureLimit)
+
+		// a closed position releases its slot
+		_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 2, false)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "ETHUSDT", 1, false)
+		require.NoError(t, err)
+	})
+}
@@ -1,7 +1,10 @@
 package order
 
 import (
+	"context"
+
 	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/supervisor"
 )
 
 type DataFeed struct {
@@ -14,6 +17,7 @@ type FeedConsumer func(order model.Order)
 type Feed struct {
 	OrderFeeds            map[string]*DataFeed
 	SubscriptionsBySymbol map[string][]Subscription
+	supervisor            *supervisor.Supervisor
 }
 
 type Subscription struct {
@@ -48,14 +52,30 @@ func (d *Feed) Publish(order model.Order, _ bool) {
 	}
 }
 
+// SetSupervisor enables the supervision of order workers, panicking subscribers are restarted
+func (d *Feed) SetSupervisor(supervisor *supervisor.Supervisor) {
+	d.supervisor = supervisor
+}
+
+func (d *Feed) consume(pair string, feed *DataFeed) {
+	for order := range feed.Data {
+		for _, subscription := range d.SubscriptionsBySymbol[pair] {
+			subscription.consumer(order)
+		}
+	}
+}
+
 func (d *Feed) Start() {
 	for pair := range d.OrderFeeds {
-		go func(pair string, feed *DataFeed) {
-			for order := range feed.Data {
-				for _, subscription := range d.SubscriptionsBySymbol[pair] {
-					subscription.consumer(order)
-				}
-			}
-		}(pair, d.OrderFeeds[pair])
+		if d.supervisor != nil {
+			pair, feed := pair, d.OrderFeeds[pair]
+			d.supervisor.Go(context.Background(), "orders/"+pair, func(_ context.Context) error {
+				d.consume(pair, feed)
+				return nil
+			})
+			continue
+		}
+
+		go d.consume(pair, d.OrderFeeds[pair])
 	}
 }
@@ -0,0 +1,61 @@
+package order
+
+import (
+	"math"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+// Equity returns the account value in a given quote asset, with the last known prices of the assets
+func (c *Controller) Equity(quote string) (float64, error) {
+	return c.equity(quote)
+}
+
+// Flatten cancels the open orders of a pair and closes the position of the bot with a reduce only market
+// order, eg: by a kill switch. Long spot positions are limited to the balance of the asset in the exchange.
+// The position is closed even when an order is not canceled, and the first error is returned.
+func (c *Controller) Flatten(pair string) error {
+	var firstErr error
+	fail := func(err error) {
+		c.notifyError(err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	orders, err := c.storage.Orders(storage.WithPair(pair), storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+	))
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if err := c.Cancel(*order); err != nil {
+			fail(err)
+		}
+	}
+
+	side, quantity := model.SideTypeSell, c.positions.size(pair)
+	if quantity < 0 {
+		side, quantity = model.SideTypeBuy, -quantity
+	}
+
+	if quantity > 0 && side == model.SideTypeSell {
+		// fees paid with the asset reduce the balance of long spot positions
+		if asset, _, err := c.exchange.Position(pair); err == nil && asset > 0 {
+			quantity = math.Min(quantity, asset)
+		}
+	}
+
+	if quantity > 0 {
+		log.Infof("[FLATTEN] %s %s %f", pair, side, quantity)
+		if _, err := c.CreateOrderMarket(side, pair, quantity, true); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,47 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_Flatten(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.FromMemory()
+	require.NoError(t, err)
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	candle := model.Candle{Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), Pair: "BTCUSDT", Close: 100,
+		Low: 100, High: 100}
+	wallet.OnCandle(candle)
+	controller := NewController(ctx, wallet, store, NewOrderFeed())
+	controller.OnCandle(candle)
+
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 2, false)
+	require.NoError(t, err)
+	_, err = controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+	require.NoError(t, err)
+
+	equity, err := controller.Equity("USDT")
+	require.NoError(t, err)
+	require.InDelta(t, 1000.0, equity, 1e-6)
+
+	require.NoError(t, controller.Flatten("BTCUSDT"))
+
+	orders, err := wallet.OpenOrders("BTCUSDT")
+	require.NoError(t, err)
+	require.Empty(t, orders)
+
+	asset, _, err := wallet.Position("BTCUSDT")
+	require.NoError(t, err)
+	require.Zero(t, asset)
+
+	// flat pairs have nothing to close
+	require.NoError(t, controller.Flatten("BTCUSDT"))
+}
@@ -0,0 +1,306 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+const ladderStateKey = "ladders"
+
+// ErrInvalidLadder is returned for ladders without rungs, quantity or take profit
+var ErrInvalidLadder = errors.New("invalid ladder")
+
+// LadderStatus is the stage of a DCA ladder
+type LadderStatus string
+
+const (
+	// LadderOpen has open rungs or an open position
+	LadderOpen LadderStatus = "OPEN"
+	// LadderClosed is a ladder whose take profit was filled
+	LadderClosed LadderStatus = "CLOSED"
+	// LadderCanceled is a ladder canceled, or whose rungs were canceled without fills
+	LadderCanceled LadderStatus = "CANCELED"
+)
+
+// LadderRung is a limit order of a ladder, at an offset from the base price, eg: 0.02 for 2% below the base
+// price of buy ladders, with a quantity multiplier of the base quantity, eg: 1.5
+type LadderRung struct {
+	Offset     float64
+	Multiplier float64
+}
+
+// price returns the limit price of the rung for a base price
+func (r LadderRung) price(side model.SideType, basePrice float64) float64 {
+	if side == model.SideTypeSell {
+		return basePrice * (1 + r.Offset)
+	}
+	return basePrice * (1 - r.Offset)
+}
+
+// size returns the quantity of the rung for a base quantity
+func (r LadderRung) size(quantity float64) float64 {
+	if r.Multiplier <= 0 {
+		return quantity
+	}
+	return quantity * r.Multiplier
+}
+
+// LadderOrder is the limit order of a rung, with its filled quantity
+type LadderOrder struct {
+	Price    float64 `json:"price"`
+	Quantity float64 `json:"quantity"`
+	Executed float64 `json:"executed"`
+	// OrderID is the exchange ID of the rung order, and Done is true when the order is closed
+	OrderID int64 `json:"order_id"`
+	Done    bool  `json:"done"`
+}
+
+// Ladder is a ladder of limit orders accumulating a position, closed by a single take profit order on the
+// average price of the filled rungs
+type Ladder struct {
+	ID         int64          `json:"id"`
+	Pair       string         `json:"pair"`
+	Side       model.SideType `json:"side"`
+	TakeProfit float64        `json:"take_profit"`
+	Status     LadderStatus   `json:"status"`
+	Rungs      []LadderOrder  `json:"rungs"`
+	// TakeProfitID is the exchange ID of the take profit order, placed after the first fill
+	TakeProfitID    int64   `json:"take_profit_id"`
+	TakeProfitPrice float64 `json:"take_profit_price"`
+	// owner is the strategy allocation of the ladder orders, if any
+	owner *AllocatedBroker
+}
+
+// Filled returns the filled quantity of the ladder and its average price
+func (l Ladder) Filled() (quantity, price float64) {
+	var cost float64
+	for _, rung := range l.Rungs {
+		quantity += rung.Executed
+		cost += rung.Executed * rung.Price
+	}
+	if quantity > 0 {
+		price = cost / quantity
+	}
+	return quantity, price
+}
+
+// ladderBook keeps the open ladders, by ID
+type ladderBook struct {
+	mtx     sync.Mutex
+	seq     int64
+	ladders map[int64]*Ladder
+}
+
+type ladderBookState struct {
+	Seq     int64             `json:"seq"`
+	Ladders map[int64]*Ladder `json:"ladders"`
+}
+
+func (b *ladderBook) SaveState() ([]byte, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return json.Marshal(ladderBookState{Seq: b.seq, Ladders: b.ladders})
+}
+
+func (b *ladderBook) RestoreState(data []byte) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	var state ladderBookState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	b.seq = state.Seq
+	if state.Ladders != nil {
+		b.ladders = state.Ladders
+	}
+	return nil
+}
+
+// CreateLadder places a DCA ladder of limit orders, one by rung, from a base price and a base quantity. When
+// rungs fill, a single take profit order is placed, or replaced, at a fraction of the average price of the
+// filled rungs, eg: 0.03 for 3% above the average price of buy ladders. The open rungs are canceled when the
+// take profit fills. Fills are followed with the order updates, and open ladders are persisted with the
+// controller state.
+func (c *Controller) CreateLadder(side model.SideType, pair string, basePrice, quantity float64,
+	rungs []LadderRung, takeProfit float64) (Ladder, error) {
+	return c.createLadder(nil, side, pair, basePrice, quantity, rungs, takeProfit)
+}
+
+// createLadder places a ladder, tracking its orders in the allocation of the owner, if any
+func (c *Controller) createLadder(owner *AllocatedBroker, side model.SideType, pair string, basePrice,
+	quantity float64, rungs []LadderRung, takeProfit float64) (Ladder, error) {
+	if basePrice <= 0 || quantity <= 0 || len(rungs) == 0 || takeProfit <= 0 {
+		return Ladder{}, fmt.Errorf("%w: %d rungs of %f from %f with take profit %f", ErrInvalidLadder,
+			len(rungs), quantity, basePrice, takeProfit)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.checkPause(side, pair, false); err != nil {
+		return Ladder{}, err
+	}
+
+	ladder := &Ladder{Pair: pair, Side: side, TakeProfit: takeProfit, Status: LadderOpen, owner: owner}
+	for _, rung := range rungs {
+		if rung.Offset < 0 || rung.Offset >= 1 {
+			c.cancelLadder(ladder)
+			return Ladder{}, fmt.Errorf("%w: offset %f", ErrInvalidLadder, rung.Offset)
+		}
+
+		price, size := rung.price(side, basePrice), rung.size(quantity)
+		if err := c.checkEntry(side, pair, size, price); err != nil {
+			c.cancelLadder(ladder)
+			return Ladder{}, err
+		}
+		order, err := c.placeLimit(side, pair, size, price)
+		if err != nil {
+			c.cancelLadder(ladder)
+			return Ladder{}, err
+		}
+		c.trackOwner(order, owner)
+		ladder.Rungs = append(ladder.Rungs, LadderOrder{Price: price, Quantity: size, OrderID: order.ExchangeID})
+	}
+
+	c.ladders.mtx.Lock()
+	defer c.ladders.mtx.Unlock()
+	c.ladders.seq++
+	ladder.ID = c.ladders.seq
+	c.ladders.ladders[ladder.ID] = ladder
+	log.Infof("[LADDER] %s %s with %d rungs from %f", pair, side, len(ladder.Rungs), basePrice)
+	return *ladder, nil
+}
+
+// Ladders returns the open ladders of a pair, sorted by ID
+func (c *Controller) Ladders(pair string) []Ladder {
+	c.ladders.mtx.Lock()
+	defer c.ladders.mtx.Unlock()
+
+	ladders := make([]Ladder, 0)
+	for _, ladder := range c.ladders.ladders {
+		if ladder.Pair == pair {
+			ladder := *ladder
+			ladder.Rungs = append([]LadderOrder(nil), ladder.Rungs...)
+			ladders = append(ladders, ladder)
+		}
+	}
+	sort.Slice(ladders, func(i, j int) bool {
+		return ladders[i].ID < ladders[j].ID
+	})
+	return ladders
+}
+
+// CancelLadder cancels the open rungs and the take profit of a ladder, filled rungs are kept in the position
+func (c *Controller) CancelLadder(id int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.ladders.mtx.Lock()
+	defer c.ladders.mtx.Unlock()
+
+	if ladder, ok := c.ladders.ladders[id]; ok {
+		c.cancelLadder(ladder)
+		ladder.Status = LadderCanceled
+		delete(c.ladders.ladders, id)
+	}
+}
+
+// cancelLadder cancels the open orders of a ladder
+func (c *Controller) cancelLadder(ladder *Ladder) {
+	for i := range ladder.Rungs {
+		if !ladder.Rungs[i].Done {
+			c.cancelExit(ladder.Pair, ladder.Rungs[i].OrderID)
+			ladder.Rungs[i].Done = true
+		}
+	}
+	if ladder.TakeProfitID > 0 {
+		c.cancelExit(ladder.Pair, ladder.TakeProfitID)
+	}
+}
+
+// updateLadders follows the fills of the rungs and the take profit of the ladders of the pair of an updated
+// order, the caller must hold the controller lock
+func (c *Controller) updateLadders(order model.Order) {
+	c.ladders.mtx.Lock()
+	defer c.ladders.mtx.Unlock()
+
+	for id, ladder := range c.ladders.ladders {
+		if ladder.Pair != order.Pair {
+			continue
+		}
+
+		if order.ExchangeID == ladder.TakeProfitID && ladder.TakeProfitID > 0 {
+			if order.Status == model.OrderStatusTypeFilled {
+				ladder.TakeProfitID = 0
+				c.cancelLadder(ladder)
+				ladder.Status = LadderClosed
+				delete(c.ladders.ladders, id)
+				log.Infof("[LADDER CLOSED] %s %d", ladder.Pair, ladder.ID)
+			}
+			continue
+		}
+
+		for i := range ladder.Rungs {
+			if ladder.Rungs[i].OrderID == order.ExchangeID {
+				c.updateRung(ladder, &ladder.Rungs[i], order)
+			}
+		}
+
+		// a ladder without open rungs, fills or take profit was canceled
+		if quantity, _ := ladder.Filled(); quantity == 0 && ladder.done() {
+			ladder.Status = LadderCanceled
+			delete(c.ladders.ladders, id)
+		}
+	}
+}
+
+func (l Ladder) done() bool {
+	for _, rung := range l.Rungs {
+		if !rung.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// updateRung records the executed quantity of a rung, and replaces the take profit with the new average price
+func (c *Controller) updateRung(ladder *Ladder, rung *LadderOrder, order model.Order) {
+	executed := order.Executed
+	if executed == 0 && order.Status == model.OrderStatusTypeFilled {
+		executed = order.Quantity
+	}
+	if order.Status != model.OrderStatusTypeNew && order.Status != model.OrderStatusTypePartiallyFilled {
+		rung.Done = true
+	}
+	if executed <= rung.Executed {
+		return
+	}
+	rung.Executed = executed
+
+	quantity, price := ladder.Filled()
+	side, target := model.SideTypeSell, price*(1+ladder.TakeProfit)
+	if ladder.Side == model.SideTypeSell {
+		side, target = model.SideTypeBuy, price*(1-ladder.TakeProfit)
+	}
+
+	if ladder.TakeProfitID > 0 {
+		c.cancelExit(ladder.Pair, ladder.TakeProfitID)
+		ladder.TakeProfitID = 0
+	}
+	takeProfit, err := c.placeLimit(side, ladder.Pair, quantity, target)
+	if err != nil {
+		c.notify(fmt.Sprintf("[LADDER] %s: take profit of %f not placed: %v\n", ladder.Pair, quantity, err))
+		return
+	}
+	c.trackOwner(takeProfit, ladder.owner)
+	ladder.TakeProfitID = takeProfit.ExchangeID
+	ladder.TakeProfitPrice = target
+	log.Infof("[LADDER] %s %f filled at %f, take profit at %f", ladder.Pair, quantity, price, target)
+}
@@ -0,0 +1,122 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_Ladder(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newController := func(t *testing.T) (*Controller, *exchange.PaperWallet) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		first := model.Candle{Time: start, Pair: "BTCUSDT", Close: 100, Low: 100, High: 100}
+		wallet.OnCandle(first)
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		controller.OnCandle(first)
+		return controller, wallet
+	}
+
+	candle := func(controller *Controller, wallet *exchange.PaperWallet, minutes int, close float64) {
+		candle := model.Candle{Time: start.Add(time.Duration(minutes) * time.Minute), Pair: "BTCUSDT",
+			Open: close, Low: close, Close: close, High: close, Complete: true}
+		wallet.OnCandle(candle)
+		controller.updateOrders()
+		controller.OnCandle(candle)
+	}
+
+	rungs := []LadderRung{{Offset: 0.05}, {Offset: 0.1, Multiplier: 2}}
+
+	t.Run("invalid", func(t *testing.T) {
+		controller, _ := newController(t)
+		_, err := controller.CreateLadder(model.SideTypeBuy, "BTCUSDT", 100, 1, nil, 0.03)
+		require.ErrorIs(t, err, ErrInvalidLadder)
+		_, err = controller.CreateLadder(model.SideTypeBuy, "BTCUSDT", 100, 1, []LadderRung{{Offset: 1}}, 0.03)
+		require.ErrorIs(t, err, ErrInvalidLadder)
+		require.Empty(t, controller.Ladders("BTCUSDT"))
+	})
+
+	t.Run("take profit", func(t *testing.T) {
+		controller, wallet := newController(t)
+
+		ladder, err := controller.CreateLadder(model.SideTypeBuy, "BTCUSDT", 100, 1, rungs, 0.03)
+		require.NoError(t, err)
+		require.Len(t, ladder.Rungs, 2)
+		require.InDelta(t, 95, ladder.Rungs[0].Price, 1e-9)
+		require.InDelta(t, 90, ladder.Rungs[1].Price, 1e-9)
+		require.Equal(t, 2.0, ladder.Rungs[1].Quantity)
+		require.Zero(t, ladder.TakeProfitID)
+
+		candle(controller, wallet, 1, 95)
+		ladder = controller.Ladders("BTCUSDT")[0]
+		quantity, price := ladder.Filled()
+		require.Equal(t, 1.0, quantity)
+		require.InDelta(t, 95, price, 1e-9)
+		require.NotZero(t, ladder.TakeProfitID)
+		require.InDelta(t, 95*1.03, ladder.TakeProfitPrice, 1e-9)
+
+		// the take profit is replaced with the average price of both rungs
+		first := ladder.TakeProfitID
+		candle(controller, wallet, 2, 90)
+		ladder = controller.Ladders("BTCUSDT")[0]
+		quantity, price = ladder.Filled()
+		require.Equal(t, 3.0, quantity)
+		require.InDelta(t, 275.0/3, price, 1e-9)
+		require.NotEqual(t, first, ladder.TakeProfitID)
+		require.InDelta(t, 275.0/3*1.03, ladder.TakeProfitPrice, 1e-9)
+
+		orders, err := controller.storage.Orders(storage.WithExchangeID(first))
+		require.NoError(t, err)
+		require.NotEqual(t, model.OrderStatusTypeNew, orders[0].Status)
+
+		candle(controller, wallet, 3, 95)
+		require.Empty(t, controller.Ladders("BTCUSDT"))
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		controller, wallet := newController(t)
+
+		ladder, err := controller.CreateLadder(model.SideTypeBuy, "BTCUSDT", 100, 1, rungs, 0.03)
+		require.NoError(t, err)
+		candle(controller, wallet, 1, 95)
+
+		controller.CancelLadder(ladder.ID)
+		require.Empty(t, controller.Ladders("BTCUSDT"))
+
+		orders, err := controller.storage.Orders(storage.WithStatus(model.OrderStatusTypeNew))
+		require.NoError(t, err)
+		require.Empty(t, orders)
+
+		// the filled rung is kept in the position
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Equal(t, 1.0, asset)
+	})
+
+	t.Run("state", func(t *testing.T) {
+		controller, _ := newController(t)
+		_, err := controller.CreateLadder(model.SideTypeBuy, "BTCUSDT", 100, 1, rungs, 0.03)
+		require.NoError(t, err)
+
+		data, err := controller.ladders.SaveState()
+		require.NoError(t, err)
+		restored := &ladderBook{ladders: make(map[int64]*Ladder)}
+		require.NoError(t, restored.RestoreState(data))
+		require.Len(t, restored.ladders, 1)
+		require.Len(t, restored.ladders[1].Rungs, 2)
+	})
+}
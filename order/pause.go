@@ -0,0 +1,123 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bengalm/ninjabot/event"
+	"github.com/bengalm/ninjabot/model"
+)
+
+var ErrPaused = errors.New("trading paused")
+
+// Pause blocks new orders of a pair at runtime, given a pause mode. Pauses held by the risk guards, see
+// `Hold`, are kept, and the strongest mode applies.
+func (c *Controller) Pause(pair string, mode model.PauseMode) {
+	c.pauseMtx.Lock()
+	if mode == model.PauseNone {
+		delete(c.paused, pair)
+	} else {
+		c.paused[pair] = mode
+	}
+	c.pauseMtx.Unlock()
+
+	c.publishPause(pair)
+}
+
+// Resume enables all orders of a pair, releasing the pauses held by the risk guards
+func (c *Controller) Resume(pair string) {
+	c.pauseMtx.Lock()
+	delete(c.holds, pair)
+	c.pauseMtx.Unlock()
+
+	c.Pause(pair, model.PauseNone)
+}
+
+// Hold pauses a pair on behalf of an owner, eg: a risk guard, until the owner releases it. Holds of several
+// owners and the pause set with `Pause` are independent, the strongest mode applies, so a hold never
+// weakens an existing pause, and releasing it does not lift the pauses of others.
+func (c *Controller) Hold(pair, owner string, mode model.PauseMode) {
+	c.pauseMtx.Lock()
+	if c.holds[pair] == nil {
+		c.holds[pair] = make(map[string]model.PauseMode)
+	}
+	c.holds[pair][owner] = mode
+	c.pauseMtx.Unlock()
+
+	c.publishPause(pair)
+}
+
+// Release removes the hold of an owner on a pair
+func (c *Controller) Release(pair, owner string) {
+	c.pauseMtx.Lock()
+	if _, ok := c.holds[pair][owner]; !ok {
+		c.pauseMtx.Unlock()
+		return
+	}
+	delete(c.holds[pair], owner)
+	if len(c.holds[pair]) == 0 {
+		delete(c.holds, pair)
+	}
+	c.pauseMtx.Unlock()
+
+	c.publishPause(pair)
+}
+
+func (c *Controller) publishPause(pair string) {
+	event.Publish(c.bus, event.Risks, event.RiskEvent{
+		Time:    c.clock.Now(),
+		Pair:    pair,
+		Kind:    "pause",
+		Message: c.PauseMode(pair).String(),
+	})
+}
+
+// PauseMode returns the pause mode of a pair, the strongest of its pause and holds
+func (c *Controller) PauseMode(pair string) model.PauseMode {
+	c.pauseMtx.RLock()
+	defer c.pauseMtx.RUnlock()
+	return c.pauseMode(pair)
+}
+
+func (c *Controller) pauseMode(pair string) model.PauseMode {
+	mode := c.paused[pair]
+	for _, hold := range c.holds[pair] {
+		if hold > mode {
+			mode = hold
+		}
+	}
+	return mode
+}
+
+// PausedPairs returns all paused pairs and their pause mode
+func (c *Controller) PausedPairs() map[string]model.PauseMode {
+	c.pauseMtx.RLock()
+	defer c.pauseMtx.RUnlock()
+
+	paused := make(map[string]model.PauseMode, len(c.paused))
+	for pair := range c.paused {
+		paused[pair] = c.pauseMode(pair)
+	}
+	for pair := range c.holds {
+		paused[pair] = c.pauseMode(pair)
+	}
+	return paused
+}
+
+// checkPause validates if an order is allowed by the pause mode of a pair.
+// Protection orders (stop, OCO and take profit) are only blocked by PauseAll.
+func (c *Controller) checkPause(side model.SideType, pair string, protection bool) error {
+	switch c.PauseMode(pair) {
+	case model.PauseAll:
+		return fmt.Errorf("%w: %s", ErrPaused, pair)
+	case model.PauseEntries:
+		if protection {
+			return nil
+		}
+
+		if model.IsEntry(side, c.signedPosition(pair)) {
+			return fmt.Errorf("%w: %s entries", ErrPaused, pair)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package order
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+const positionStateKey = "positions"
+
+// positionBook aggregates the fills of the bot into positions by pair, with the average price, realized and
+// unrealized profit and fees. Partial fills are applied as they are reported, once per executed quantity.
+type positionBook struct {
+	mtx       sync.Mutex
+	positions map[string]*bookPosition
+	// applied are the executed quantity and fee already applied of the open orders, by pair and exchange ID
+	applied map[string]appliedFill
+}
+
+// bookPosition is the position of a pair, with the price excursion and entries of the open position
+type bookPosition struct {
+	model.PositionPnL
+	// High and Low are the extreme prices since the position was opened
+	High float64 `json:"high"`
+	Low  float64 `json:"low"`
+	// Entries is the number of orders that opened or increased the position
+	Entries int `json:"entries"`
+	// Start are the realized profit and fees of the pair when the position was opened, to report the profit
+	// and fees of the position when it is closed
+	Start positionStart `json:"start"`
+}
+
+type positionStart struct {
+	RealizedPnL float64 `json:"realized_pnl"`
+	Fees        float64 `json:"fees"`
+}
+
+// side returns the side of the entries of the position
+func (p *bookPosition) side() model.SideType {
+	if p.Size < 0 {
+		return model.SideTypeSell
+	}
+	return model.SideTypeBuy
+}
+
+// open starts a new position with the first fill
+func (p *bookPosition) open(size, price float64, now time.Time) {
+	p.Start = positionStart{RealizedPnL: p.RealizedPnL, Fees: p.Fees}
+	p.Size = size
+	p.AvgPrice = price
+	p.OpenedAt = now
+	p.High, p.Low = price, price
+	p.Entries = 1
+}
+
+// excursion returns the maximum adverse and favorable excursion of the position until an exit price
+func (p *bookPosition) excursion(price float64) (mae, mfe float64) {
+	if p.AvgPrice == 0 {
+		return 0, 0
+	}
+
+	high, low := math.Max(p.High, price), math.Min(p.Low, price)
+	if p.Low == 0 {
+		low = price
+	}
+	up, down := math.Max(high-p.AvgPrice, 0)/p.AvgPrice, math.Max(p.AvgPrice-low, 0)/p.AvgPrice
+	if p.Size < 0 {
+		return up, down
+	}
+	return down, up
+}
+
+type appliedFill struct {
+	Quantity float64 `json:"quantity"`
+	Fee      float64 `json:"fee"`
+}
+
+type positionBookState struct {
+	Positions map[string]*bookPosition `json:"positions"`
+	Applied   map[string]appliedFill   `json:"applied"`
+}
+
+// positionUpdate is a fill applied to the position of a pair
+type positionUpdate struct {
+	// position is the updated position
+	position model.PositionPnL
+	// closed is the position closed by the fill, if any
+	closed *model.PositionPnL
+	// result is the trade of the quantity reduced by the fill, if any
+	result *Result
+}
+
+func newPositionBook() *positionBook {
+	return &positionBook{
+		positions: make(map[string]*bookPosition),
+		applied:   make(map[string]appliedFill),
+	}
+}
+
+func (b *positionBook) SaveState() ([]byte, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return json.Marshal(positionBookState{Positions: b.positions, Applied: b.applied})
+}
+
+func (b *positionBook) RestoreState(data []byte) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	var state positionBookState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if state.Positions != nil {
+		b.positions = state.Positions
+	}
+	if state.Applied != nil {
+		b.applied = state.Applied
+	}
+	return nil
+}
+
+// onFill applies the new executed quantity of an order, returning the updated position, the position it closed
+// and the trade of the reduced quantity. The fee is the one reported by the exchange, or estimated with the fee
+// rate, and the time of the fill is the update time of the order, or now when it is unknown. Reversals close
+// the position and open a new one with the remaining quantity.
+func (b *positionBook) onFill(key string, order model.Order, feeRate float64, now time.Time) (positionUpdate,
+	bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if !order.UpdatedAt.IsZero() {
+		now = order.UpdatedAt
+	}
+
+	executed := order.Executed
+	if executed == 0 && order.Status == model.OrderStatusTypeFilled {
+		executed = order.Quantity
+	}
+
+	applied := b.applied[key]
+	if order.Status == model.OrderStatusTypeNew || order.Status == model.OrderStatusTypePartiallyFilled {
+		b.applied[key] = appliedFill{Quantity: math.Max(executed, applied.Quantity),
+			Fee: math.Max(order.Fee, applied.Fee)}
+	} else {
+		delete(b.applied, key)
+	}
+
+	quantity := executed - applied.Quantity
+	if quantity <= 0 {
+		return positionUpdate{}, false
+	}
+
+	price := order.Price
+	if order.Stop != nil && (order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit) {
+		price = *order.Stop
+	}
+
+	fee := order.Fee - applied.Fee
+	if order.Fee == 0 {
+		fee = price * quantity * feeRate
+	}
+
+	current, found := b.positions[order.Pair]
+	if !found {
+		current = &bookPosition{PositionPnL: model.PositionPnL{Pair: order.Pair}}
+		b.positions[order.Pair] = current
+	}
+
+	signed := quantity
+	if order.Side == model.SideTypeSell {
+		signed = -quantity
+	}
+
+	var update positionUpdate
+	switch {
+	case current.Size == 0:
+		current.open(signed, price, now)
+	case (current.Size > 0) == (signed > 0):
+		size := math.Abs(current.Size)
+		current.AvgPrice = (current.AvgPrice*size + price*quantity) / (size + quantity)
+		current.Size += signed
+		// partial fills of an order are a single entry
+		if applied.Quantity == 0 {
+			current.Entries++
+		}
+	default:
+		closing := math.Min(math.Abs(current.Size), quantity)
+		percent := (price - current.AvgPrice) / current.AvgPrice
+		if current.Size < 0 {
+			percent = -percent
+		}
+		profit := percent * current.AvgPrice * closing
+		current.RealizedPnL += profit
+
+		mae, mfe := current.excursion(price)
+		update.result = &Result{
+			Pair:          order.Pair,
+			ProfitPercent: percent,
+			ProfitValue:   profit,
+			Side:          current.side(),
+			Duration:      now.Sub(current.OpenedAt),
+			CreatedAt:     now,
+			MAE:           mae,
+			MFE:           mfe,
+		}
+
+		reversed := quantity > math.Abs(current.Size)
+		size := current.Size
+		current.Size += signed
+		remaining := math.Abs(current.Size) >= 1e-12
+		if remaining && !reversed {
+			break
+		}
+
+		fees := current.Fees + fee*closing/quantity
+		update.closed = &model.PositionPnL{
+			Pair:        order.Pair,
+			Size:        size,
+			AvgPrice:    current.AvgPrice,
+			MarkPrice:   price,
+			RealizedPnL: current.RealizedPnL - current.Start.RealizedPnL,
+			Fees:        fees - current.Start.Fees,
+			OpenedAt:    current.OpenedAt,
+			UpdatedAt:   now,
+		}
+
+		if reversed && remaining {
+			current.open(current.Size, price, now)
+			current.Start.Fees = fees
+		} else {
+			current.Size = 0
+			current.AvgPrice = 0
+			current.High, current.Low = 0, 0
+			current.Entries = 0
+		}
+	}
+
+	current.Fees += fee
+	current.UpdatedAt = now
+	if current.MarkPrice == 0 {
+		current.MarkPrice = price
+	}
+	current.UnrealizedPnL = (current.MarkPrice - current.AvgPrice) * current.Size
+	update.position = current.PositionPnL
+	return update, true
+}
+
+// onCandle updates the unrealized profit of the position of the candle pair with the close price, and the
+// extreme prices of the open position with the candles after its opening
+func (b *positionBook) onCandle(candle model.Candle) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	position, ok := b.positions[candle.Pair]
+	if !ok {
+		return
+	}
+
+	if candle.Close > 0 {
+		position.MarkPrice = candle.Close
+		position.UnrealizedPnL = (candle.Close - position.AvgPrice) * position.Size
+	}
+	if position.Size != 0 && candle.Time.After(position.OpenedAt) {
+		position.High = math.Max(position.High, candle.High)
+		if position.Low == 0 || candle.Low < position.Low {
+			position.Low = candle.Low
+		}
+	}
+}
+
+// open returns the open position of a pair
+func (b *positionBook) open(pair string) (bookPosition, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	position, ok := b.positions[pair]
+	if !ok || position.Size == 0 {
+		return bookPosition{}, false
+	}
+	return *position, true
+}
+
+// size returns the size of the position of a pair, negative for short positions
+func (b *positionBook) size(pair string) float64 {
+	position, _ := b.open(pair)
+	return position.Size
+}
+
+// openPairs returns the pairs with open positions, sorted
+func (b *positionBook) openPairs() []string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	pairs := make([]string, 0, len(b.positions))
+	for pair, position := range b.positions {
+		if position.Size != 0 {
+			pairs = append(pairs, pair)
+		}
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// PositionPnL returns the position of a pair aggregated from the fills of the bot, with its average price,
+// profit and fees. Closed positions keep the realized profit and fees, with a zero size.
+func (c *Controller) PositionPnL(pair string) (model.PositionPnL, bool) {
+	c.positions.mtx.Lock()
+	defer c.positions.mtx.Unlock()
+
+	position, ok := c.positions.positions[pair]
+	if !ok {
+		return model.PositionPnL{}, false
+	}
+	return position.PositionPnL, true
+}
+
+// Positions returns the positions of all pairs traded by the bot, sorted by pair
+func (c *Controller) Positions() []model.PositionPnL {
+	c.positions.mtx.Lock()
+	defer c.positions.mtx.Unlock()
+
+	positions := make([]model.PositionPnL, 0, len(c.positions.positions))
+	for _, position := range c.positions.positions {
+		positions = append(positions, position.PositionPnL)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Pair < positions[j].Pair
+	})
+	return positions
+}
@@ -0,0 +1,187 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/event"
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestPositionBook(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("partial fills", func(t *testing.T) {
+		book := newPositionBook()
+		buy := model.Order{Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeMarket,
+			Status: model.OrderStatusTypeFilled, Price: 100, Quantity: 2, Executed: 2, Fee: 0.2}
+		update, ok := book.onFill("BTCUSDT-1", buy, 0, now)
+		require.True(t, ok)
+		require.Nil(t, update.closed)
+		require.Nil(t, update.result)
+		require.Equal(t, 2.0, update.position.Size)
+		require.Equal(t, 100.0, update.position.AvgPrice)
+
+		sell := model.Order{Pair: "BTCUSDT", Side: model.SideTypeSell, Type: model.OrderTypeLimit,
+			Status: model.OrderStatusTypePartiallyFilled, Price: 110, Quantity: 2, Executed: 0.5, Fee: 0.05}
+		update, ok = book.onFill("BTCUSDT-2", sell, 0, now.Add(time.Hour))
+		require.True(t, ok)
+		require.Nil(t, update.closed)
+		require.InDelta(t, 1.5, update.position.Size, 1e-9)
+		require.InDelta(t, 5.0, update.position.RealizedPnL, 1e-9)
+		require.InDelta(t, 5.0, update.result.ProfitValue, 1e-9)
+		require.InDelta(t, 0.1, update.result.ProfitPercent, 1e-9)
+		require.Equal(t, time.Hour, update.result.Duration)
+
+		// the same update is applied once
+		_, ok = book.onFill("BTCUSDT-2", sell, 0, now)
+		require.False(t, ok)
+
+		sell.Status = model.OrderStatusTypeFilled
+		sell.Executed = 2
+		sell.Fee = 0.2
+		update, ok = book.onFill("BTCUSDT-2", sell, 0, now)
+		require.True(t, ok)
+		require.Equal(t, 0.0, update.position.Size)
+		require.InDelta(t, 20.0, update.position.RealizedPnL, 1e-9)
+		require.InDelta(t, 0.4, update.position.Fees, 1e-9)
+		require.InDelta(t, 19.6, update.position.NetPnL(), 1e-9)
+		require.InDelta(t, 15.0, update.result.ProfitValue, 1e-9)
+		require.Empty(t, book.applied)
+
+		// the closed position has the size before the last fill and the exit price as mark price
+		closed := update.closed
+		require.NotNil(t, closed)
+		require.InDelta(t, 1.5, closed.Size, 1e-9)
+		require.Equal(t, 100.0, closed.AvgPrice)
+		require.Equal(t, 110.0, closed.MarkPrice)
+		require.InDelta(t, 20.0, closed.RealizedPnL, 1e-9)
+		require.InDelta(t, 0.4, closed.Fees, 1e-9)
+
+		// the next position reports only its own profit and fees
+		book.onFill("BTCUSDT-3", model.Order{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Status: model.OrderStatusTypeFilled, Price: 100, Quantity: 1, Fee: 0.1}, 0, now)
+		update, _ = book.onFill("BTCUSDT-4", model.Order{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Status: model.OrderStatusTypeFilled, Price: 90, Quantity: 1, Fee: 0.1}, 0, now)
+		require.NotNil(t, update.closed)
+		require.InDelta(t, -10.0, update.closed.RealizedPnL, 1e-9)
+		require.InDelta(t, 0.2, update.closed.Fees, 1e-9)
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		book := newPositionBook()
+		entry := model.Order{Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeLimit,
+			Status: model.OrderStatusTypePartiallyFilled, Price: 100, Quantity: 2, Executed: 1}
+		book.onFill("BTCUSDT-1", entry, 0, now)
+		book.onFill("BTCUSDT-2", entry, 0, now)
+
+		// partial fills of an order are a single entry
+		entry.Status, entry.Executed = model.OrderStatusTypeFilled, 2
+		book.onFill("BTCUSDT-2", entry, 0, now)
+		position, ok := book.open("BTCUSDT")
+		require.True(t, ok)
+		require.Equal(t, 2, position.Entries)
+		require.Equal(t, 3.0, position.Size)
+
+		book.onCandle(model.Candle{Time: now.Add(time.Minute), Pair: "BTCUSDT", High: 120, Low: 95, Close: 110})
+		position, _ = book.open("BTCUSDT")
+		require.Equal(t, 120.0, position.High)
+		require.Equal(t, 95.0, position.Low)
+		require.InDelta(t, 30.0, position.UnrealizedPnL, 1e-9)
+	})
+
+	t.Run("short and reversal", func(t *testing.T) {
+		book := newPositionBook()
+		_, ok := book.onFill("BTCUSDT-1", model.Order{Pair: "BTCUSDT", Side: model.SideTypeSell,
+			Status: model.OrderStatusTypeFilled, Price: 100, Quantity: 2}, 0.001, now)
+		require.True(t, ok)
+
+		// short positions profit when the price drops
+		book.onCandle(model.Candle{Time: now.Add(time.Minute), Pair: "BTCUSDT", High: 100, Low: 90, Close: 90})
+		update, ok := book.onFill("BTCUSDT-2", model.Order{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Status: model.OrderStatusTypeFilled, Price: 90, Quantity: 1}, 0.001, now)
+		require.True(t, ok)
+		require.Nil(t, update.closed)
+		require.InDelta(t, 10, update.result.ProfitValue, 1e-9)
+		require.InDelta(t, 0.1, update.result.ProfitPercent, 1e-9)
+		require.Equal(t, model.SideTypeSell, update.result.Side)
+		require.InDelta(t, 0.1, update.result.MFE, 1e-9)
+
+		// reversed positions realize the profit of the closed quantity
+		update, ok = book.onFill("BTCUSDT-3", model.Order{Pair: "BTCUSDT", Side: model.SideTypeBuy,
+			Status: model.OrderStatusTypeFilled, Price: 80, Quantity: 3}, 0.001, now)
+		require.True(t, ok)
+		require.InDelta(t, 20, update.result.ProfitValue, 1e-9)
+		require.Equal(t, model.SideTypeSell, update.result.Side)
+		require.Equal(t, 2.0, update.position.Size)
+		require.Equal(t, 80.0, update.position.AvgPrice)
+		require.InDelta(t, 30.0, update.position.RealizedPnL, 1e-9)
+		// estimated with the fee rate
+		require.InDelta(t, 0.2+0.09+0.24, update.position.Fees, 1e-9)
+
+		require.Equal(t, -1.0, update.closed.Size)
+		require.InDelta(t, 30.0, update.closed.RealizedPnL, 1e-9)
+		require.InDelta(t, 0.2+0.09+0.08, update.closed.Fees, 1e-9)
+
+		position, _ := book.open("BTCUSDT")
+		require.Equal(t, 1, position.Entries)
+		require.Equal(t, model.SideTypeBuy, position.side())
+
+		book.onCandle(model.Candle{Time: now.Add(time.Hour), Pair: "BTCUSDT", High: 85, Low: 85, Close: 85})
+		require.InDelta(t, 10.0, book.positions["BTCUSDT"].UnrealizedPnL, 1e-9)
+	})
+}
+
+func TestController_Positions(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.FromMemory()
+	require.NoError(t, err)
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000),
+		exchange.WithPaperFee(0.001, 0.001))
+	first := model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 100, Low: 100, High: 100}
+	wallet.OnCandle(first)
+
+	bus := event.NewBus()
+	updates := make([]model.PositionPnL, 0)
+	event.Subscribe(bus, event.Positions, func(position model.PositionPnL) {
+		updates = append(updates, position)
+	})
+	closed := make([]model.PositionPnL, 0)
+	event.Subscribe(bus, event.ClosedPositions, func(position model.PositionPnL) {
+		closed = append(closed, position)
+	})
+
+	controller := NewController(ctx, wallet, store, NewOrderFeed())
+	controller.SetEventBus(bus)
+	controller.OnCandle(first)
+
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+
+	position, ok := controller.PositionPnL("BTCUSDT")
+	require.True(t, ok)
+	require.Equal(t, 1.0, position.Size)
+	require.InDelta(t, 0.1, position.Fees, 1e-9)
+	require.Len(t, updates, 1)
+
+	candle := model.Candle{Time: first.Time.Add(time.Minute), Pair: "BTCUSDT", Close: 120, Low: 120, High: 120}
+	wallet.OnCandle(candle)
+	controller.OnCandle(candle)
+
+	positions := controller.Positions()
+	require.Len(t, positions, 1)
+	require.InDelta(t, 20.0, positions[0].UnrealizedPnL, 1e-9)
+	require.Empty(t, closed)
+
+	_, err = controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+	require.Len(t, closed, 1)
+	require.Equal(t, 1.0, closed[0].Size)
+	require.Equal(t, 120.0, closed[0].MarkPrice)
+	require.InDelta(t, 20.0, closed[0].RealizedPnL, 1e-9)
+}
@@ -0,0 +1,206 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+// ErrMaxEntries is returned for entry orders that add to a position with the maximum number of entries
+var ErrMaxEntries = errors.New("maximum position entries")
+
+// SetMaxEntries allows adding to the positions of a pair up to a number of entries, including the first one
+// and the open limit orders of the position side, zero for no limit. When an entry fills, the single stop
+// order, bracket or software trailing stop protecting the position is resized to the new quantity.
+func (c *Controller) SetMaxEntries(pair string, entries int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if entries <= 0 {
+		delete(c.maxEntries, pair)
+		return
+	}
+	c.maxEntries[pair] = entries
+}
+
+// checkEntry validates an entry order with the exposure limits and the maximum entries of the pair, the
+// caller must hold the controller lock
+func (c *Controller) checkEntry(side model.SideType, pair string, quantity, price float64) error {
+	if err := c.checkEntries(side, pair); err != nil {
+		c.notifyError(err)
+		return err
+	}
+	return c.checkExposure(side, pair, quantity, price)
+}
+
+// checkEntryNotional validates an entry order by notional in the quote, see `checkEntry`
+func (c *Controller) checkEntryNotional(side model.SideType, pair string, notional float64) error {
+	if err := c.checkEntries(side, pair); err != nil {
+		c.notifyError(err)
+		return err
+	}
+	return c.checkExposureNotional(side, pair, notional)
+}
+
+func (c *Controller) checkEntries(side model.SideType, pair string) error {
+	limit, ok := c.maxEntries[pair]
+	if !ok || !model.IsEntry(side, c.signedPosition(pair)) {
+		return nil
+	}
+
+	var entries int
+	if position, ok := c.positions.open(pair); ok {
+		// positions restored from older states have no entries
+		entries = position.Entries
+		if entries == 0 {
+			entries = 1
+		}
+	}
+
+	orders, err := c.storage.Orders(storage.WithPair(pair), storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+	))
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		if order.Side == side && order.GroupID == nil &&
+			(order.Type == model.OrderTypeLimit || order.Type == model.OrderTypeLimitMaker) {
+			entries++
+		}
+	}
+
+	if entries >= limit {
+		return fmt.Errorf("%w: %s with %d of %d entries", ErrMaxEntries, pair, entries, limit)
+	}
+	return nil
+}
+
+// resizeExits resizes the exits of a position increased by an entry, the caller must hold the controller lock.
+// Exits are resized only when a single exit of a kind protects the position, since positions protected by
+// several exits, eg: a bracket by entry, are managed by the strategy.
+func (c *Controller) resizeExits(entry model.Order) {
+	position, ok := c.positions.open(entry.Pair)
+	if !ok || position.side() != entry.Side || position.Entries < 2 {
+		return
+	}
+
+	exitSide := model.SideTypeSell
+	if position.Size < 0 {
+		exitSide = model.SideTypeBuy
+	}
+
+	quantity := math.Abs(position.Size)
+	skip := c.resizeTrailingStop(entry.Pair, exitSide, quantity)
+	c.resizeBracket(entry, exitSide, quantity)
+
+	orders, err := c.storage.Orders(storage.WithPair(entry.Pair), storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+	))
+	if err != nil {
+		c.notifyError(err)
+		return
+	}
+
+	stops := make([]*model.Order, 0)
+	for _, order := range orders {
+		if order.Type != model.OrderTypeStopLoss && order.Type != model.OrderTypeStopLossLimit {
+			continue
+		}
+		if order.Side == exitSide && order.GroupID == nil && order.ExchangeID != skip {
+			stops = append(stops, order)
+		}
+	}
+	if len(stops) != 1 || stops[0].Quantity == quantity {
+		return
+	}
+
+	if _, err := c.replaceOrder(*stops[0], 0, quantity); err == nil {
+		log.Infof("[PYRAMIDING] %s stop resized to %f", entry.Pair, quantity)
+	}
+}
+
+// resizeTrailingStop resizes the single software trailing stop of a pair, returning the exchange ID of its
+// replaced stop order
+func (c *Controller) resizeTrailingStop(pair string, exitSide model.SideType, quantity float64) int64 {
+	c.trailing.mtx.Lock()
+	defer c.trailing.mtx.Unlock()
+
+	var stop *TrailingStop
+	for _, current := range c.trailing.stops {
+		if current.Pair != pair || current.Side != exitSide {
+			continue
+		}
+		if stop != nil {
+			return 0
+		}
+		stop = current
+	}
+	if stop == nil || stop.Quantity == quantity {
+		return 0
+	}
+
+	stop.Quantity = quantity
+	if stop.OrderID == 0 {
+		return 0
+	}
+
+	orders, err := c.storage.Orders(storage.WithPair(pair), storage.WithExchangeID(stop.OrderID))
+	if err != nil || len(orders) == 0 {
+		return stop.OrderID
+	}
+	replaced, err := c.replaceOrder(*orders[0], 0, quantity)
+	if err != nil {
+		return stop.OrderID
+	}
+	stop.OrderID = replaced.ExchangeID
+	log.Infof("[PYRAMIDING] %s trailing stop resized to %f", pair, quantity)
+	return replaced.ExchangeID
+}
+
+// resizeBracket replaces the exits of the single active bracket of a pair with an OCO order of a quantity,
+// unless the entry is the entry of a bracket
+func (c *Controller) resizeBracket(entry model.Order, exitSide model.SideType, quantity float64) {
+	c.brackets.mtx.Lock()
+	defer c.brackets.mtx.Unlock()
+
+	var bracket *Bracket
+	var brackets int
+	for _, current := range c.brackets.entries {
+		if current.Pair != entry.Pair {
+			continue
+		}
+		if current.EntryID == entry.ExchangeID {
+			return
+		}
+		bracket = current
+		brackets++
+	}
+	if brackets != 1 || bracket.Status != BracketActive || bracket.Quantity == quantity {
+		return
+	}
+
+	for _, id := range bracket.ExitIDs {
+		c.cancelExit(bracket.Pair, id)
+	}
+	orders, err := c.placeOCO(exitSide, bracket.Pair, quantity, bracket.Target, bracket.Stop, bracket.Stop)
+	if err != nil {
+		bracket.Status = BracketClosed
+		c.notify(fmt.Sprintf("[BRACKET] %s: position of %f not protected: %v\n", bracket.Pair, quantity, err))
+		return
+	}
+
+	bracket.Quantity = quantity
+	bracket.ExitIDs = make([]int64, 0, len(orders))
+	for _, order := range orders {
+		bracket.ExitIDs = append(bracket.ExitIDs, order.ExchangeID)
+	}
+	log.Infof("[PYRAMIDING] %s bracket resized to %f", bracket.Pair, quantity)
+}
@@ -0,0 +1,113 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_Pyramiding(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newController := func(t *testing.T) (*Controller, *exchange.PaperWallet) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		first := model.Candle{Time: start, Pair: "BTCUSDT", Close: 100, Low: 100, High: 100}
+		wallet.OnCandle(first)
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		controller.OnCandle(first)
+		return controller, wallet
+	}
+
+	price := func(controller *Controller, wallet *exchange.PaperWallet, minutes int, close float64) {
+		candle := model.Candle{Time: start.Add(time.Duration(minutes) * time.Minute), Pair: "BTCUSDT",
+			Open: close, Low: close, Close: close, High: close, Complete: true}
+		wallet.OnCandle(candle)
+		controller.OnCandle(candle)
+	}
+
+	t.Run("max entries", func(t *testing.T) {
+		controller, wallet := newController(t)
+		controller.SetMaxEntries("BTCUSDT", 2)
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+
+		// open limit orders are pending entries
+		limit, err := controller.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.ErrorIs(t, err, ErrMaxEntries)
+		require.NoError(t, controller.Cancel(limit))
+
+		price(controller, wallet, 1, 110)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		require.Equal(t, 2, controller.positions.positions["BTCUSDT"].Entries)
+		require.InDelta(t, 105, controller.positions.positions["BTCUSDT"].AvgPrice, 1e-9)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.ErrorIs(t, err, ErrMaxEntries)
+
+		// the profit of the closed quantity uses the average price of the entries
+		price(controller, wallet, 2, 120)
+		order, err := controller.CreateOrderMarket(model.SideTypeSell, "BTCUSDT", 2, false)
+		require.NoError(t, err)
+		require.InDelta(t, 30, order.ProfitValue, 1e-9)
+
+		position, ok := controller.PositionPnL("BTCUSDT")
+		require.True(t, ok)
+		require.InDelta(t, 30, position.RealizedPnL, 1e-9)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+	})
+
+	t.Run("stop resized", func(t *testing.T) {
+		controller, wallet := newController(t)
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderStop("BTCUSDT", 1, 95)
+		require.NoError(t, err)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, 2.0, orders[0].Quantity)
+		require.Equal(t, 95.0, *orders[0].Stop)
+	})
+
+	t.Run("bracket resized", func(t *testing.T) {
+		controller, wallet := newController(t)
+
+		_, err := controller.CreateBracket(model.SideTypeBuy, "BTCUSDT", 1, 0, 90, 120)
+		require.NoError(t, err)
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+
+		brackets := controller.Brackets("BTCUSDT")
+		require.Len(t, brackets, 1)
+		require.Equal(t, BracketActive, brackets[0].Status)
+		require.Equal(t, 2.0, brackets[0].Quantity)
+
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 2)
+		for _, order := range orders {
+			require.Equal(t, 2.0, order.Quantity)
+			require.Contains(t, brackets[0].ExitIDs, order.ExchangeID)
+		}
+	})
+}
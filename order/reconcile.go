@@ -0,0 +1,221 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+// Reconciliation is the result of the matching of the stored orders and positions with the exchange
+type Reconciliation struct {
+	// Recovered are the pending orders found in the exchange by their client order ID
+	Recovered []model.Order
+	// Rejected are the pending orders that were never placed in the exchange
+	Rejected []model.Order
+	// Adopted are the open orders of the exchange unknown by the storage, eg: orders placed manually
+	Adopted []model.Order
+	// Mismatches describe the differences that were not fixed, eg: a position that differs from the exchange
+	Mismatches []string
+}
+
+func (r Reconciliation) String() string {
+	lines := []string{fmt.Sprintf("[RECONCILE] %d recovered, %d rejected and %d adopted orders, %d mismatches",
+		len(r.Recovered), len(r.Rejected), len(r.Adopted), len(r.Mismatches))}
+	lines = append(lines, r.Mismatches...)
+	return strings.Join(lines, "\n")
+}
+
+// Reconcile matches the stored state with the exchange, instead of assuming a clean slate after a restart.
+// Pending orders are resolved by their client order ID, stored open orders are updated, open orders of the
+// exchange unknown by the storage are adopted, and positions that differ from the exchange are reported as
+// mismatches. The pairs of stored orders and positions are reconciled, in addition to the given pairs.
+func (c *Controller) Reconcile(pairs ...string) (Reconciliation, error) {
+	var result Reconciliation
+
+	if err := c.reconcilePending(&result); err != nil {
+		return result, err
+	}
+
+	// orders updated while the bot was offline
+	c.updateOrders()
+
+	open, err := c.storage.Orders(storage.WithStatusIn(
+		model.OrderStatusTypeNew,
+		model.OrderStatusTypePartiallyFilled,
+		model.OrderStatusTypePendingCancel,
+	))
+	if err != nil {
+		return result, err
+	}
+
+	c.mtx.Lock()
+	unique := make(map[string]bool)
+	for _, pair := range pairs {
+		unique[pair] = true
+	}
+	for _, order := range open {
+		unique[order.Pair] = true
+	}
+	for _, pair := range c.positions.openPairs() {
+		unique[pair] = true
+	}
+	c.mtx.Unlock()
+
+	sortedPairs := make([]string, 0, len(unique))
+	for pair := range unique {
+		sortedPairs = append(sortedPairs, pair)
+	}
+	sort.Strings(sortedPairs)
+
+	for _, pair := range sortedPairs {
+		if err := c.reconcileOrders(pair, open, &result); err != nil {
+			return result, err
+		}
+		if err := c.reconcilePosition(pair, &result); err != nil {
+			return result, err
+		}
+	}
+
+	if len(result.Recovered)+len(result.Rejected)+len(result.Adopted)+len(result.Mismatches) > 0 {
+		c.notify(result.String())
+	} else {
+		log.Info("[SETUP] orders and positions reconciled with the exchange")
+	}
+	return result, nil
+}
+
+// reconcilePending resolves the orders stored before a submission that was not confirmed, eg: by a crash
+func (c *Controller) reconcilePending(result *Reconciliation) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	pending, err := c.storage.Orders(storage.WithStatus(model.OrderStatusTypePendingNew))
+	if err != nil {
+		return err
+	}
+
+	broker, ok := c.exchange.(service.ClientOrderBroker)
+	for _, order := range pending {
+		if !ok || order.ClientOrderID == "" {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("%s: pending order %d without client order ID",
+				order.Pair, order.ID))
+			continue
+		}
+
+		placed, err := broker.OrderByClientID(order.Pair, order.ClientOrderID)
+		if errors.Is(err, exchange.ErrOrderNotFound) {
+			order.Status = model.OrderStatusTypeRejected
+			order.UpdatedAt = c.clock.Now()
+			if err := c.storage.UpdateOrder(order); err != nil {
+				return err
+			}
+			result.Rejected = append(result.Rejected, *order)
+			continue
+		}
+		if err != nil {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("%s: pending order %s: %v",
+				order.Pair, order.ClientOrderID, err))
+			continue
+		}
+
+		placed.ID = order.ID
+		placed.ClientOrderID = order.ClientOrderID
+		if err := c.storage.UpdateOrder(&placed); err != nil {
+			return err
+		}
+		log.Infof("[ORDER RECOVERED] %s", placed)
+		result.Recovered = append(result.Recovered, placed)
+
+		if placed.Status != model.OrderStatusTypeNew {
+			c.processTrade(&placed)
+		}
+		go c.publishOrder(placed, false)
+	}
+	return nil
+}
+
+// reconcileOrders adopts the open orders of a pair unknown by the storage, and reports stored open orders
+// that are not open in the exchange
+func (c *Controller) reconcileOrders(pair string, stored []*model.Order, result *Reconciliation) error {
+	orders, err := c.exchange.OpenOrders(pair)
+	if err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	known := make(map[int64]bool)
+	for _, order := range stored {
+		if order.Pair == pair {
+			known[order.ExchangeID] = true
+		}
+	}
+
+	exchangeOrders := make(map[int64]bool)
+	for _, order := range orders {
+		exchangeOrders[order.ExchangeID] = true
+		if known[order.ExchangeID] {
+			continue
+		}
+
+		// orders closed while the bot was offline are known but no longer open in the storage
+		existing, err := c.storage.Orders(storage.WithPair(pair), storage.WithExchangeID(order.ExchangeID))
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			continue
+		}
+
+		adopted := order
+		if err := c.storage.CreateOrder(&adopted); err != nil {
+			return err
+		}
+		log.Infof("[ORDER ADOPTED] %s", adopted)
+		result.Adopted = append(result.Adopted, adopted)
+	}
+
+	// exchanges without the list of open orders, eg: partial implementations, return no orders
+	if len(orders) == 0 {
+		return nil
+	}
+	for _, order := range stored {
+		if order.Pair == pair && !exchangeOrders[order.ExchangeID] {
+			result.Mismatches = append(result.Mismatches, fmt.Sprintf("%s: order %d is %s but not open in the exchange",
+				pair, order.ExchangeID, order.Status))
+		}
+	}
+	return nil
+}
+
+// reconcilePosition reports a position of the controller that differs from the position in the exchange
+func (c *Controller) reconcilePosition(pair string, result *Reconciliation) error {
+	asset, _, err := c.exchange.Position(pair)
+	if err != nil {
+		return err
+	}
+
+	c.mtx.Lock()
+	expected := c.signedPosition(pair)
+	c.mtx.Unlock()
+
+	tolerance := c.exchange.AssetsInfo(pair).StepSize / 2
+	if tolerance <= 0 {
+		tolerance = 1e-8
+	}
+	if math.Abs(asset-expected) > tolerance {
+		result.Mismatches = append(result.Mismatches, fmt.Sprintf("%s: position of %f in the exchange, %f expected",
+			pair, asset, expected))
+	}
+	return nil
+}
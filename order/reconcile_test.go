@@ -0,0 +1,101 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_Reconcile(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("adopt unknown orders", func(t *testing.T) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 100})
+
+		// order placed outside the bot
+		placed, err := wallet.CreateOrderLimit(model.SideTypeBuy, "BTCUSDT", 1, 90)
+		require.NoError(t, err)
+
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		result, err := controller.Reconcile("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, result.Adopted, 1)
+		require.Empty(t, result.Mismatches)
+
+		orders, err := store.Orders(storage.WithExchangeID(placed.ExchangeID))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, model.OrderStatusTypeNew, orders[0].Status)
+
+		// adopted orders are not adopted again
+		result, err = controller.Reconcile("BTCUSDT")
+		require.NoError(t, err)
+		require.Empty(t, result.Adopted)
+	})
+
+	t.Run("resolve pending orders", func(t *testing.T) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 100})
+
+		// crash after the submission of the first order, and before the submission of the second one
+		for _, id := range []string{"ninjabot-1", "ninjabot-2"} {
+			require.NoError(t, store.CreateOrder(&model.Order{
+				Pair:          "BTCUSDT",
+				Side:          model.SideTypeBuy,
+				Type:          model.OrderTypeMarket,
+				Status:        model.OrderStatusTypePendingNew,
+				Quantity:      1,
+				ClientOrderID: id,
+			}))
+		}
+		_, err = wallet.CreateOrderRequest(model.OrderRequest{
+			Pair:          "BTCUSDT",
+			Side:          model.SideTypeBuy,
+			Type:          model.OrderTypeMarket,
+			Quantity:      1,
+			ClientOrderID: "ninjabot-1",
+		})
+		require.NoError(t, err)
+
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		result, err := controller.Reconcile()
+		require.NoError(t, err)
+		require.Len(t, result.Recovered, 1)
+		require.Equal(t, "ninjabot-1", result.Recovered[0].ClientOrderID)
+		require.Len(t, result.Rejected, 1)
+		require.Equal(t, "ninjabot-2", result.Rejected[0].ClientOrderID)
+		require.Empty(t, result.Mismatches)
+
+		// the filled order opens the position of the controller
+		require.Equal(t, 1.0, controller.positions.size("BTCUSDT"))
+
+		orders, err := store.Orders(storage.WithStatus(model.OrderStatusTypeRejected))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+	})
+
+	t.Run("position mismatch", func(t *testing.T) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT",
+			exchange.WithPaperAsset("USDT", 1000), exchange.WithPaperAsset("BTC", 0.5))
+		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 100})
+
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		result, err := controller.Reconcile("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, result.Mismatches, 1)
+		require.Contains(t, result.Mismatches[0], "BTCUSDT")
+	})
+}
@@ -0,0 +1,79 @@
+package order
+
+import (
+	"context"
+	"time"
+
+	"github.com/jpillora/backoff"
+
+	"github.com/bengalm/ninjabot/exchange"
+)
+
+// RetryPolicy is the resubmission of orders failed by transient errors, with exponential backoff.
+// Orders are resubmitted with the same client order ID, so an order placed despite the error is found
+// instead of placed twice. Retries require an exchange implementing service.ClientOrderBroker, and orders
+// are not resubmitted when the lookup by client order ID is not supported, eg: by a wrapped exchange.
+type RetryPolicy struct {
+	// Attempts is the maximum number of submissions of an order, one or less disables retries
+	Attempts int
+	// Min and Max bound the delay between attempts, which grows by Factor after each attempt
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+	// Transient returns if an error can be retried, default: exchange.IsTransient. Permanent errors,
+	// eg: insufficient balance, are returned immediately.
+	Transient func(err error) bool
+}
+
+// DefaultRetryPolicy submits orders up to 3 times, waiting 500ms and 1s between attempts
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  3,
+		Min:       500 * time.Millisecond,
+		Max:       5 * time.Second,
+		Factor:    2,
+		Transient: exchange.IsTransient,
+	}
+}
+
+// NoRetry submits orders only once
+func NoRetry() RetryPolicy {
+	return RetryPolicy{Attempts: 1}
+}
+
+// SetRetryPolicy sets the resubmission of orders failed by transient errors, default: DefaultRetryPolicy
+func (c *Controller) SetRetryPolicy(policy RetryPolicy) {
+	if policy.Transient == nil {
+		policy.Transient = exchange.IsTransient
+	}
+	c.retry = policy
+}
+
+// retryAfter returns the backoff of the next attempt, or false when a failed attempt is not retried
+func (c *Controller) retryAfter(ba *backoff.Backoff, attempt int, err error) (time.Duration, bool) {
+	if attempt >= c.retry.Attempts || c.retry.Transient == nil || !c.retry.Transient(err) {
+		return 0, false
+	}
+	return ba.Duration(), true
+}
+
+// newBackoff returns the backoff of the attempts of an order
+func (c *Controller) newBackoff() *backoff.Backoff {
+	return &backoff.Backoff{
+		Min:    c.retry.Min,
+		Max:    c.retry.Max,
+		Factor: c.retry.Factor,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package order
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+// flakyWallet fails the first order requests without placing them
+type flakyWallet struct {
+	*exchange.PaperWallet
+	err      error
+	failures int
+	attempts int
+	// lookupErr fails the lookups by client order ID, eg: a wrapper of an exchange without them
+	lookupErr error
+}
+
+func (w *flakyWallet) CreateOrderRequest(request model.OrderRequest) (model.Order, error) {
+	w.attempts++
+	if w.failures > 0 {
+		w.failures--
+		return model.Order{}, w.err
+	}
+	return w.PaperWallet.CreateOrderRequest(request)
+}
+
+func (w *flakyWallet) OrderByClientID(pair, clientOrderID string) (model.Order, error) {
+	if w.lookupErr != nil {
+		return model.Order{}, w.lookupErr
+	}
+	return w.PaperWallet.OrderByClientID(pair, clientOrderID)
+}
+
+func TestController_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	newController := func(wallet *flakyWallet) (*Controller, *[]time.Duration) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		delays := make([]time.Duration, 0)
+		controller.sleep = func(_ context.Context, d time.Duration) error {
+			delays = append(delays, d)
+			return nil
+		}
+		return controller, &delays
+	}
+
+	newWallet := func(err error, failures int) *flakyWallet {
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		wallet.OnCandle(model.Candle{Time: time.Now(), Pair: "BTCUSDT", Close: 100})
+		return &flakyWallet{PaperWallet: wallet, err: err, failures: failures}
+	}
+
+	t.Run("transient errors", func(t *testing.T) {
+		wallet := newWallet(fmt.Errorf("gateway: %w", exchange.ErrTransient), 2)
+		controller, delays := newController(wallet)
+
+		order, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		require.Equal(t, model.OrderStatusTypeFilled, order.Status)
+		require.Equal(t, "ninjabot-1", order.ClientOrderID)
+		require.Equal(t, 3, wallet.attempts)
+		require.Equal(t, []time.Duration{500 * time.Millisecond, time.Second}, *delays)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		wallet := newWallet(fmt.Errorf("gateway: %w", exchange.ErrTransient), 5)
+		controller, _ := newController(wallet)
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.ErrorIs(t, err, exchange.ErrTransient)
+		require.Equal(t, 3, wallet.attempts)
+
+		orders, err := controller.storage.Orders(storage.WithStatus(model.OrderStatusTypeRejected))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+	})
+
+	t.Run("permanent errors", func(t *testing.T) {
+		wallet := newWallet(exchange.ErrInsufficientFunds, 1)
+		controller, delays := newController(wallet)
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.ErrorIs(t, err, exchange.ErrInsufficientFunds)
+		require.Equal(t, 1, wallet.attempts)
+		require.Empty(t, *delays)
+	})
+
+	t.Run("without client order lookups", func(t *testing.T) {
+		wallet := newWallet(fmt.Errorf("gateway: %w", exchange.ErrTransient), 1)
+		wallet.lookupErr = fmt.Errorf("%w: client order ID", exchange.ErrUnsupportedOrder)
+		controller, delays := newController(wallet)
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.ErrorIs(t, err, exchange.ErrTransient)
+		require.Equal(t, 1, wallet.attempts)
+		require.Empty(t, *delays)
+
+		orders, err := controller.storage.Orders(storage.WithStatus(model.OrderStatusTypeRejected))
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		wallet := newWallet(fmt.Errorf("gateway: %w", exchange.ErrTransient), 1)
+		controller, _ := newController(wallet)
+		controller.SetRetryPolicy(NoRetry())
+
+		_, err := controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.ErrorIs(t, err, exchange.ErrTransient)
+		require.Equal(t, 1, wallet.attempts)
+	})
+}
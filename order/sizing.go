@@ -0,0 +1,45 @@
+package order
+
+import (
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/sizing"
+)
+
+// Size returns the quantity of a new position given by a sizer, rounded to the lot size of the pair. The
+// price and the equity of the request default to the last price of the pair and the account equity.
+func (c *Controller) Size(sizer model.Sizer, request model.SizeRequest) (float64, error) {
+	if request.Equity <= 0 {
+		_, quote := exchange.SplitAssetQuote(request.Pair)
+		equity, err := c.equity(quote)
+		if err != nil {
+			return 0, err
+		}
+		request.Equity = equity
+	}
+	return c.size(sizer, request)
+}
+
+// Size returns the quantity of a new position given by a sizer, see `Controller.Size`. The equity of the
+// request defaults to the capital of the strategy allocation.
+func (a *AllocatedBroker) Size(sizer model.Sizer, request model.SizeRequest) (float64, error) {
+	if request.Equity <= 0 {
+		capital, err := a.Capital(request.Pair)
+		if err != nil {
+			return 0, err
+		}
+		request.Equity = capital
+	}
+	return a.Controller.size(sizer, request)
+}
+
+func (c *Controller) size(sizer model.Sizer, request model.SizeRequest) (float64, error) {
+	if request.Price <= 0 {
+		price, err := c.price(request.Pair)
+		if err != nil {
+			return 0, err
+		}
+		request.Price = price
+	}
+	return sizing.Round(c.exchange.AssetsInfo(request.Pair), sizer.Size(request)), nil
+}
@@ -0,0 +1,42 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+	"github.com/bengalm/ninjabot/tools/sizing"
+)
+
+func TestController_Size(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.FromMemory()
+	require.NoError(t, err)
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+	candle := model.Candle{Time: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), Pair: "BTCUSDT", Close: 30,
+		Low: 30, High: 30}
+	wallet.OnCandle(candle)
+	controller := NewController(ctx, wallet, store, NewOrderFeed())
+	controller.OnCandle(candle)
+
+	// 10% of the equity at the last price, rounded to the lot size
+	size, err := controller.Size(sizing.FixedFraction{Fraction: 0.1}, sizing.Request{Pair: "BTCUSDT"})
+	require.NoError(t, err)
+	require.InDelta(t, 3.3333, size, 1e-4)
+	require.Equal(t, sizing.Round(wallet.AssetsInfo("BTCUSDT"), size), size)
+
+	size, err = controller.Size(sizing.FixedQuote{Amount: 100}, sizing.Request{Pair: "BTCUSDT", Price: 25})
+	require.NoError(t, err)
+	require.InDelta(t, 4, size, 1e-9)
+
+	// allocated brokers size positions with the capital of the strategy
+	broker := controller.Allocate("strategy", Allocation{Fixed: 300})
+	size, err = broker.Size(sizing.FixedFraction{Fraction: 0.5}, sizing.Request{Pair: "BTCUSDT"})
+	require.NoError(t, err)
+	require.InDelta(t, 5, size, 1e-9)
+}
@@ -0,0 +1,141 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+const controllerStateKey = "controller"
+
+// Stateful is a component with runtime state managed by the controller, eg: trailing stops or bracket orders.
+// The state is persisted continuously and restored on startup, after open orders are reconciled.
+type Stateful interface {
+	SaveState() ([]byte, error)
+	RestoreState(data []byte) error
+}
+
+type controllerState struct {
+	Paused map[string]model.PauseMode `json:"paused"`
+}
+
+// RegisterState registers a component to have its state persisted with a given key.
+// Components must be registered before `Restore`, usually before the bot starts.
+func (c *Controller) RegisterState(key string, component Stateful) {
+	c.stateMtx.Lock()
+	defer c.stateMtx.Unlock()
+	c.stateful[key] = component
+}
+
+func (c *Controller) stateStorage() (storage.StateStorage, bool) {
+	stateStorage, ok := c.storage.(storage.StateStorage)
+	return stateStorage, ok
+}
+
+// saveState persists the controller state and all registered components
+func (c *Controller) saveState() {
+	stateStorage, ok := c.stateStorage()
+	if !ok {
+		return
+	}
+
+	c.mtx.Lock()
+	state := controllerState{Paused: c.PausedPairs()}
+	data, err := json.Marshal(state)
+	c.mtx.Unlock()
+	if err != nil {
+		log.Errorf("order/state: %v", err)
+		return
+	}
+
+	if err := stateStorage.SaveState(controllerStateKey, data); err != nil {
+		log.Errorf("order/state: %v", err)
+		return
+	}
+
+	c.stateMtx.Lock()
+	defer c.stateMtx.Unlock()
+	for key, component := range c.stateful {
+		data, err := component.SaveState()
+		if err != nil {
+			log.Errorf("order/state %s: %v", key, err)
+			continue
+		}
+
+		if err := stateStorage.SaveState(key, data); err != nil {
+			log.Errorf("order/state %s: %v", key, err)
+		}
+	}
+}
+
+// Restore loads the persisted state after a restart. The controller state and positions are loaded first, then
+// orders and positions are reconciled with the exchange for the given pairs, see `Reconcile`, and finally
+// the registered components are restored. Reconciliation errors are notified and do not stop the restore.
+func (c *Controller) Restore(pairs ...string) error {
+	stateStorage, ok := c.stateStorage()
+	if ok {
+		data, err := stateStorage.LoadState(controllerStateKey)
+		if err != nil && !errors.Is(err, storage.ErrStateNotFound) {
+			return err
+		}
+
+		if err == nil {
+			var state controllerState
+			if err := json.Unmarshal(data, &state); err != nil {
+				return fmt.Errorf("order/state: %w", err)
+			}
+
+			for pair, mode := range state.Paused {
+				c.Pause(pair, mode)
+			}
+			log.Infof("[SETUP] restored %d paused pairs", len(state.Paused))
+		}
+
+		// positions are reconciled with the exchange
+		if err := c.restoreComponent(stateStorage, positionStateKey, c.positions); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.Reconcile(pairs...); err != nil {
+		c.notifyError(fmt.Errorf("order/reconcile: %w", err))
+	}
+
+	if !ok {
+		return nil
+	}
+
+	c.stateMtx.Lock()
+	defer c.stateMtx.Unlock()
+	for key, component := range c.stateful {
+		if key == positionStateKey {
+			continue
+		}
+		if err := c.restoreComponent(stateStorage, key, component); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreComponent restores the persisted state of a component, if any
+func (c *Controller) restoreComponent(stateStorage storage.StateStorage, key string, component Stateful) error {
+	data, err := stateStorage.LoadState(key)
+	if errors.Is(err, storage.ErrStateNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := component.RestoreState(data); err != nil {
+		return fmt.Errorf("order/state %s: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package order
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+type fakeStateful struct {
+	value string
+}
+
+func (f *fakeStateful) SaveState() ([]byte, error) {
+	return []byte(f.value), nil
+}
+
+func (f *fakeStateful) RestoreState(data []byte) error {
+	f.value = string(data)
+	return nil
+}
+
+func TestController_State(t *testing.T) {
+	storage, err := storage.FromMemory()
+	require.NoError(t, err)
+	ctx := context.Background()
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	controller := NewController(ctx, wallet, storage, NewOrderFeed())
+	controller.RegisterState("trailing", &fakeStateful{value: "stop=900"})
+	_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+	controller.Pause("ETHUSDT", model.PauseAll)
+	controller.saveState()
+
+	// new controller after a restart
+	restored := NewController(ctx, wallet, storage, NewOrderFeed())
+	component := &fakeStateful{}
+	restored.RegisterState("trailing", component)
+	require.NoError(t, restored.Restore())
+
+	require.Equal(t, "stop=900", component.value)
+	require.Equal(t, model.PauseAll, restored.PauseMode("ETHUSDT"))
+	require.Equal(t, 1.0, restored.positions.size("BTCUSDT"))
+	require.Equal(t, 1000.0, restored.positions.positions["BTCUSDT"].AvgPrice)
+}
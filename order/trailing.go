@@ -0,0 +1,314 @@
+package order
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+)
+
+const trailingStateKey = "trailing_stops"
+
+// ErrInvalidTrailingStop is returned for trailing stops without quantity or with a callback rate out of (0, 1)
+var ErrInvalidTrailingStop = errors.New("invalid trailing stop")
+
+// TrailingExit is how a software trailing stop closes the position
+type TrailingExit string
+
+const (
+	// TrailingExitStop keeps a stop order in the exchange, moved as the price follows. Only sell stops are
+	// supported, to protect long positions.
+	TrailingExitStop TrailingExit = "STOP"
+	// TrailingExitMarket closes the position with a market order when a candle crosses the stop
+	TrailingExitMarket TrailingExit = "MARKET"
+)
+
+// TrailingStop is a trailing stop managed by the controller, following the price with the candle feed
+type TrailingStop struct {
+	ID   int64  `json:"id"`
+	Pair string `json:"pair"`
+	// Side is the side of the exit, sell to protect long positions
+	Side         model.SideType `json:"side"`
+	Quantity     float64        `json:"quantity"`
+	Activation   float64        `json:"activation"`
+	CallbackRate float64        `json:"callback_rate"`
+	Exit         TrailingExit   `json:"exit"`
+	Active       bool           `json:"active"`
+	// Extreme is the best price since the activation, and Stop the price of the exit
+	Extreme float64 `json:"extreme"`
+	Stop    float64 `json:"stop"`
+	// OrderID is the exchange ID of the stop order of the TrailingExitStop exit
+	OrderID int64 `json:"order_id"`
+	// owner is the strategy allocation of the exit orders, if any
+	owner *AllocatedBroker
+}
+
+// trailingBook keeps the open software trailing stops, by ID
+type trailingBook struct {
+	mtx   sync.Mutex
+	seq   int64
+	stops map[int64]*TrailingStop
+}
+
+type trailingBookState struct {
+	Seq   int64                   `json:"seq"`
+	Stops map[int64]*TrailingStop `json:"stops"`
+}
+
+func (b *trailingBook) SaveState() ([]byte, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return json.Marshal(trailingBookState{Seq: b.seq, Stops: b.stops})
+}
+
+func (b *trailingBook) RestoreState(data []byte) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	var state trailingBookState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	b.seq = state.Seq
+	if state.Stops != nil {
+		b.stops = state.Stops
+	}
+	return nil
+}
+
+// CreateSoftTrailingStop protects a position with a trailing stop managed by the controller, for exchanges
+// without native trailing stops, eg: the paper wallet. The stop follows the best price since the activation
+// price is reached, or since its creation with a zero activation, by a callback rate, eg: 0.02 for 2%. The
+// stop is checked with each complete candle, and persisted with the controller state.
+func (c *Controller) CreateSoftTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64, exit TrailingExit) (TrailingStop, error) {
+	return c.createSoftTrailingStop(nil, side, pair, quantity, activation, callbackRate, exit)
+}
+
+// createSoftTrailingStop creates a trailing stop, tracking its exit orders in the allocation of the owner, if any
+func (c *Controller) createSoftTrailingStop(owner *AllocatedBroker, side model.SideType, pair string, quantity,
+	activation, callbackRate float64, exit TrailingExit) (TrailingStop, error) {
+	if quantity <= 0 || callbackRate <= 0 || callbackRate >= 1 {
+		return TrailingStop{}, fmt.Errorf("%w: quantity %f and callback rate %f", ErrInvalidTrailingStop,
+			quantity, callbackRate)
+	}
+	if exit == "" {
+		exit = TrailingExitMarket
+	}
+	if exit == TrailingExitStop && side != model.SideTypeSell {
+		return TrailingStop{}, fmt.Errorf("%w: %s stop order", exchange.ErrUnsupportedOrder, side)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.checkPause(side, pair, true); err != nil {
+		return TrailingStop{}, err
+	}
+
+	stop := &TrailingStop{
+		Pair:         pair,
+		Side:         side,
+		Quantity:     quantity,
+		Activation:   activation,
+		CallbackRate: callbackRate,
+		Exit:         exit,
+		owner:        owner,
+	}
+	if activation <= 0 {
+		price, err := c.price(pair)
+		if err != nil {
+			return TrailingStop{}, err
+		}
+		if err := c.activateTrailingStop(stop, price); err != nil {
+			return TrailingStop{}, err
+		}
+	}
+
+	c.trailing.mtx.Lock()
+	defer c.trailing.mtx.Unlock()
+	c.trailing.seq++
+	stop.ID = c.trailing.seq
+	c.trailing.stops[stop.ID] = stop
+	log.Infof("[TRAILING STOP] %s %s %f created with stop %f", pair, side, quantity, stop.Stop)
+	return *stop, nil
+}
+
+// TrailingStops returns the open software trailing stops of a pair, sorted by ID
+func (c *Controller) TrailingStops(pair string) []TrailingStop {
+	c.trailing.mtx.Lock()
+	defer c.trailing.mtx.Unlock()
+
+	stops := make([]TrailingStop, 0)
+	for _, stop := range c.trailing.stops {
+		if stop.Pair == pair {
+			stops = append(stops, *stop)
+		}
+	}
+	sort.Slice(stops, func(i, j int) bool {
+		return stops[i].ID < stops[j].ID
+	})
+	return stops
+}
+
+// CancelTrailingStop removes a software trailing stop, canceling its stop order in the exchange
+func (c *Controller) CancelTrailingStop(id int64) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.trailing.mtx.Lock()
+	defer c.trailing.mtx.Unlock()
+
+	if stop, ok := c.trailing.stops[id]; ok {
+		c.closeTrailingStop(stop, 0)
+	}
+}
+
+// activateTrailingStop starts following the price, placing the stop order of the exchange exit
+func (c *Controller) activateTrailingStop(stop *TrailingStop, price float64) error {
+	stop.Active = true
+	stop.Extreme = price
+	stop.Stop = stop.stopPrice()
+	if stop.Exit != TrailingExitStop {
+		return nil
+	}
+
+	order, err := c.placeStop(stop.Pair, stop.Quantity, stop.Stop)
+	if err != nil {
+		return err
+	}
+	c.trackOwner(order, stop.owner)
+	stop.OrderID = order.ExchangeID
+	return nil
+}
+
+// stopPrice returns the stop price of the current extreme
+func (s TrailingStop) stopPrice() float64 {
+	if s.Side == model.SideTypeSell {
+		return s.Extreme * (1 - s.CallbackRate)
+	}
+	return s.Extreme * (1 + s.CallbackRate)
+}
+
+// updateTrailingStops follows the price of a candle with the trailing stops of its pair, the caller must
+// hold the controller lock. The stop is checked with the low or high before the extreme is updated, since
+// the order of the prices within a candle is unknown.
+func (c *Controller) updateTrailingStops(candle model.Candle) {
+	c.trailing.mtx.Lock()
+	defer c.trailing.mtx.Unlock()
+
+	ids := make([]int64, 0, len(c.trailing.stops))
+	for id, stop := range c.trailing.stops {
+		if stop.Pair == candle.Pair {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		stop := c.trailing.stops[id]
+		best, worst := candle.High, candle.Low
+		if stop.Side == model.SideTypeBuy {
+			best, worst = candle.Low, candle.High
+		}
+
+		if !stop.Active {
+			if (stop.Side == model.SideTypeSell && best < stop.Activation) ||
+				(stop.Side == model.SideTypeBuy && best > stop.Activation) {
+				continue
+			}
+			if err := c.activateTrailingStop(stop, best); err != nil {
+				c.notifyError(err)
+			}
+			continue
+		}
+
+		if stop.Exit == TrailingExitMarket && ((stop.Side == model.SideTypeSell && worst <= stop.Stop) ||
+			(stop.Side == model.SideTypeBuy && worst >= stop.Stop)) {
+			log.Infof("[TRAILING STOP] %s triggered at %f", stop.Pair, stop.Stop)
+			order, err := c.placeMarket(stop.Side, stop.Pair, stop.Quantity, true)
+			if err != nil {
+				continue
+			}
+			c.trackOwner(order, stop.owner)
+			delete(c.trailing.stops, id)
+			continue
+		}
+
+		if (stop.Side == model.SideTypeSell && best > stop.Extreme) ||
+			(stop.Side == model.SideTypeBuy && best < stop.Extreme) {
+			stop.Extreme = best
+			c.moveTrailingStop(stop, stop.stopPrice())
+		}
+	}
+}
+
+// moveTrailingStop updates the stop price, replacing the stop order of the exchange when the price moves by
+// at least a tick. When the new order is rejected, the stop falls back to a market exit.
+func (c *Controller) moveTrailingStop(stop *TrailingStop, price float64) {
+	if stop.Exit != TrailingExitStop {
+		stop.Stop = price
+		return
+	}
+	if tick := c.exchange.AssetsInfo(stop.Pair).TickSize; math.Abs(price-stop.Stop) < tick {
+		return
+	}
+
+	stop.Stop = price
+	if stop.OrderID > 0 {
+		if !c.cancelExit(stop.Pair, stop.OrderID) {
+			// the stop order was filled or could not be canceled, it is updated with the order updates
+			return
+		}
+	}
+
+	order, err := c.placeStop(stop.Pair, stop.Quantity, price)
+	if err != nil {
+		stop.Exit = TrailingExitMarket
+		stop.OrderID = 0
+		c.notify(fmt.Sprintf("[TRAILING STOP] %s: stop order not placed, exiting at market: %v\n", stop.Pair, err))
+		return
+	}
+	c.trackOwner(order, stop.owner)
+	stop.OrderID = order.ExchangeID
+	log.Infof("[TRAILING STOP] %s moved to %f", stop.Pair, price)
+}
+
+// updateTrailingOrders closes the trailing stops of a filled stop order, or of a position closed by another
+// order, the caller must hold the controller lock
+func (c *Controller) updateTrailingOrders(order model.Order) {
+	if order.Status != model.OrderStatusTypeFilled {
+		return
+	}
+
+	c.trailing.mtx.Lock()
+	defer c.trailing.mtx.Unlock()
+
+	for _, stop := range c.trailing.stops {
+		if stop.Pair != order.Pair {
+			continue
+		}
+		if order.ExchangeID == stop.OrderID {
+			c.closeTrailingStop(stop, order.ExchangeID)
+			continue
+		}
+		if _, ok := c.positions.open(order.Pair); !ok && stop.Active {
+			c.closeTrailingStop(stop, 0)
+		}
+	}
+}
+
+// closeTrailingStop removes a trailing stop, canceling its open stop order
+func (c *Controller) closeTrailingStop(stop *TrailingStop, filledID int64) {
+	if stop.OrderID > 0 && stop.OrderID != filledID {
+		c.cancelExit(stop.Pair, stop.OrderID)
+	}
+	delete(c.trailing.stops, stop.ID)
+	log.Infof("[TRAILING STOP CLOSED] %s %d", stop.Pair, stop.ID)
+}
@@ -0,0 +1,123 @@
+package order
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/storage"
+)
+
+func TestController_SoftTrailingStop(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newController := func(t *testing.T) (*Controller, *exchange.PaperWallet) {
+		store, err := storage.FromMemory()
+		require.NoError(t, err)
+		wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 1000))
+		first := model.Candle{Time: start, Pair: "BTCUSDT", Close: 100, Low: 100, High: 100}
+		wallet.OnCandle(first)
+		controller := NewController(ctx, wallet, store, NewOrderFeed())
+		controller.OnCandle(first)
+
+		_, err = controller.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+		require.NoError(t, err)
+		return controller, wallet
+	}
+
+	candle := func(controller *Controller, wallet *exchange.PaperWallet, minutes int, low, close, high float64) {
+		candle := model.Candle{Time: start.Add(time.Duration(minutes) * time.Minute), Pair: "BTCUSDT",
+			Open: close, Low: low, Close: close, High: high, Complete: true}
+		wallet.OnCandle(candle)
+		controller.updateOrders()
+		controller.OnCandle(candle)
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		controller, _ := newController(t)
+		_, err := controller.CreateSoftTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 0, 1.5, TrailingExitMarket)
+		require.ErrorIs(t, err, ErrInvalidTrailingStop)
+		_, err = controller.CreateSoftTrailingStop(model.SideTypeBuy, "BTCUSDT", 1, 0, 0.1, TrailingExitStop)
+		require.ErrorIs(t, err, exchange.ErrUnsupportedOrder)
+	})
+
+	t.Run("market exit", func(t *testing.T) {
+		controller, wallet := newController(t)
+
+		stop, err := controller.CreateSoftTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 0, 0.1, "")
+		require.NoError(t, err)
+		require.True(t, stop.Active)
+		require.InDelta(t, 90, stop.Stop, 1e-9)
+
+		candle(controller, wallet, 1, 110, 115, 120)
+		stops := controller.TrailingStops("BTCUSDT")
+		require.Len(t, stops, 1)
+		require.InDelta(t, 108, stops[0].Stop, 1e-9)
+
+		// the stop is checked before the extreme is updated
+		candle(controller, wallet, 2, 107, 110, 125)
+		require.Empty(t, controller.TrailingStops("BTCUSDT"))
+
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+
+	t.Run("exchange stop", func(t *testing.T) {
+		controller, wallet := newController(t)
+
+		stop, err := controller.CreateSoftTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 110, 0.1, TrailingExitStop)
+		require.NoError(t, err)
+		require.False(t, stop.Active)
+
+		candle(controller, wallet, 1, 100, 104, 105)
+		require.False(t, controller.TrailingStops("BTCUSDT")[0].Active)
+
+		// activated with a stop order in the exchange
+		candle(controller, wallet, 2, 105, 108, 110)
+		stops := controller.TrailingStops("BTCUSDT")
+		require.True(t, stops[0].Active)
+		require.InDelta(t, 99, stops[0].Stop, 1e-9)
+		orders, err := wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, stops[0].OrderID, orders[0].ExchangeID)
+
+		// the stop order is replaced as the price follows
+		candle(controller, wallet, 3, 110, 118, 120)
+		stops = controller.TrailingStops("BTCUSDT")
+		require.InDelta(t, 108, stops[0].Stop, 1e-9)
+		orders, err = wallet.OpenOrders("BTCUSDT")
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, stops[0].OrderID, orders[0].ExchangeID)
+		require.InDelta(t, 108, *orders[0].Stop, 1e-9)
+
+		// the fill of the stop order closes the trailing stop
+		candle(controller, wallet, 4, 100, 105, 112)
+		controller.updateOrders()
+		require.Empty(t, controller.TrailingStops("BTCUSDT"))
+		asset, _, err := wallet.Position("BTCUSDT")
+		require.NoError(t, err)
+		require.Zero(t, asset)
+	})
+
+	t.Run("state", func(t *testing.T) {
+		controller, _ := newController(t)
+		_, err := controller.CreateSoftTrailingStop(model.SideTypeSell, "BTCUSDT", 1, 120, 0.05, "")
+		require.NoError(t, err)
+
+		data, err := controller.trailing.SaveState()
+		require.NoError(t, err)
+		restored := &trailingBook{stops: make(map[int64]*TrailingStop)}
+		require.NoError(t, restored.RestoreState(data))
+		require.Len(t, restored.stops, 1)
+		require.Equal(t, int64(1), restored.seq)
+		require.Equal(t, 120.0, restored.stops[1].Activation)
+	})
+}
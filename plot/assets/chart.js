@@ -14,6 +14,10 @@ function unpack(rows, key) {
   });
 }
 
+function standaloneIndicatorsCount(indicators) {
+  return indicators.filter((indicator) => !indicator.overlay).length;
+}
+
 document.addEventListener("DOMContentLoaded", function () {
   const params = new URLSearchParams(window.location.search);
   const pair = params.get("pair") || "";
@@ -42,6 +46,22 @@ document.addEventListener("DOMContentLoaded", function () {
         yaxis: "y1",
       };
 
+      // running drawdown of the equity, in its own panel below the equity
+      const hasDrawdown = data.drawdown_values && data.drawdown_values.length > 0;
+      const drawdownAxis = standaloneIndicatorsCount(data.indicators) + 3;
+      const drawdownData = {
+        name: "Drawdown (%)",
+        x: unpack(data.drawdown_values || [], "time"),
+        y: unpack(data.drawdown_values || [], "value"),
+        mode: "lines",
+        fill: "tozeroy",
+        line: {
+          color: "red",
+        },
+        xaxis: "x1",
+        yaxis: "y" + drawdownAxis,
+      };
+
       const assetData = {
         name: `Position (${data.asset}/${data.quote})`,
         x: unpack(data.asset_values, "time"),
@@ -173,6 +193,41 @@ document.addEventListener("DOMContentLoaded", function () {
         });
       }
 
+      // average price of the open position, with its profit and fees
+      if (data.position && data.position.size !== 0) {
+        const position = data.position;
+        shapes.push({
+          type: "line",
+          xref: "paper",
+          yref: "y2",
+          x0: 0,
+          x1: 1,
+          y0: position.avg_price,
+          y1: position.avg_price,
+          line: {
+            width: 1,
+            dash: "dot",
+            color: position.size > 0 ? "green" : "red",
+          },
+        });
+
+        annotations.push({
+          x: 1,
+          y: position.avg_price,
+          xref: "paper",
+          yref: "y2",
+          xanchor: "right",
+          yanchor: "bottom",
+          text: `${position.size.toPrecision(4)} @ ${position.avg_price.toLocaleString()}
+                <br>PnL: ${(position.realized_pnl + position.unrealized_pnl).toFixed(2)} ${data.quote}
+                | Fees: ${position.fees.toFixed(2)} ${data.quote}`,
+          showarrow: false,
+          font: {
+            size: 11,
+          },
+        });
+      }
+
       const sellPoints = points.filter((p) => p.side === SELL_SIDE);
       const buyPoints = points.filter((p) => p.side === BUY_SIDE);
       const buyData = {
@@ -200,15 +255,8 @@ document.addEventListener("DOMContentLoaded", function () {
         },
       };
 
-      const standaloneIndicators = data.indicators.reduce(
-        (total, indicator) => {
-          if (!indicator.overlay) {
-            return total + 1;
-          }
-          return total;
-        },
-        0
-      );
+      const standaloneIndicators = standaloneIndicatorsCount(data.indicators);
+      const candlesTop = hasDrawdown ? 0.79 : 0.9;
 
       let layout = {
         template: "ggplot2",
@@ -224,7 +272,7 @@ document.addEventListener("DOMContentLoaded", function () {
           anchor: standaloneIndicators > 0 ? "y3" : "y2",
         },
         yaxis2: {
-          domain: standaloneIndicators > 0 ? [0.4, 0.9] : [0, 0.9],
+          domain: standaloneIndicators > 0 ? [0.4, candlesTop] : [0, candlesTop],
           autorange: true,
           mirror: true,
           showline: true,
@@ -250,6 +298,18 @@ document.addEventListener("DOMContentLoaded", function () {
         sellData,
       ];
 
+      if (hasDrawdown) {
+        layout["yaxis" + drawdownAxis] = {
+          title: "Drawdown",
+          domain: [0.8, 0.89],
+          autorange: true,
+          mirror: true,
+          showline: true,
+          gridcolor: "#ddd",
+        };
+        plotData.push(drawdownData);
+      }
+
       const indicatorsHeight = 0.39 / standaloneIndicators;
       let standaloneIndicatorIndex = 0;
       data.indicators.forEach((indicator) => {
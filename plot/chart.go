@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"math"
 	"net/http"
 	"sort"
 	"strings"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/bengalm/ninjabot/exchange"
 	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
 	"github.com/bengalm/ninjabot/strategy"
 
 	"github.com/StudioSol/set"
@@ -37,10 +39,15 @@ type Chart struct {
 	orderByID       map[int64]model.Order
 	indicators      []Indicator
 	paperWallet     *exchange.PaperWallet
+	account         service.Broker
+	positions       service.PositionManager
+	quote           string
+	equity          []assetValue
 	scriptContent   string
 	indexHTML       *template.Template
 	strategy        strategy.Strategy
 	lastUpdate      time.Time
+	handlers        map[string]http.Handler
 }
 
 type Candle struct {
@@ -112,6 +119,18 @@ func (c *Chart) OnOrder(order model.Order) {
 }
 
 func (c *Chart) OnCandle(candle model.Candle) {
+	// the account is requested before locking the chart, it may be a remote call in live mode
+	var (
+		account model.Account
+		err     error
+	)
+	if c.account != nil && candle.Complete {
+		account, err = c.account.Account()
+		if err != nil {
+			log.Errorf("chart: account equity: %v", err)
+		}
+	}
+
 	c.Lock()
 	defer c.Unlock()
 
@@ -148,9 +167,52 @@ func (c *Chart) OnCandle(candle model.Candle) {
 			c.dataframe[candle.Pair].Metadata[k] = append(c.dataframe[candle.Pair].Metadata[k], v)
 		}
 		c.lastUpdate = time.Now()
+
+		if c.account != nil && err == nil {
+			c.recordEquity(candle.Time, account)
+		}
 	}
 }
 
+// recordEquity adds the value of the account in the quote asset at the time of a candle, valuing the other
+// assets by the last close of their pair with the quote. Candles of other pairs at the same time update the value.
+func (c *Chart) recordEquity(candleTime time.Time, account model.Account) {
+	var value float64
+	for _, balance := range account.Balances {
+		total := balance.Free + balance.Lock
+		if balance.Asset == c.quote {
+			value += total
+			continue
+		}
+
+		if candles := c.candles[balance.Asset+c.quote]; len(candles) > 0 {
+			value += total * candles[len(candles)-1].Close
+		}
+	}
+
+	if last := len(c.equity) - 1; last >= 0 && !candleTime.After(c.equity[last].Time) {
+		c.equity[last].Value = value
+		return
+	}
+	c.equity = append(c.equity, assetValue{Time: candleTime, Value: value})
+}
+
+// drawdownValues returns the running drawdown of an equity curve, the percentage below its previous peak
+func drawdownValues(equity []assetValue) []assetValue {
+	values := make([]assetValue, 0, len(equity))
+	var peak float64
+	for _, value := range equity {
+		peak = math.Max(peak, value.Value)
+
+		var drawdown float64
+		if peak > 0 {
+			drawdown = (value.Value - peak) / peak * 100
+		}
+		values = append(values, assetValue{Time: value.Time, Value: drawdown})
+	}
+	return values
+}
+
 func (c *Chart) equityValuesByPair(pair string) (asset []assetValue, quote []assetValue) {
 	assetValues := make([]assetValue, 0)
 	equityValues := make([]assetValue, 0)
@@ -170,6 +232,8 @@ func (c *Chart) equityValuesByPair(pair string) (asset []assetValue, quote []ass
 				Value: value.Value,
 			})
 		}
+	} else if c.account != nil {
+		equityValues = append(equityValues, c.equity...)
 	}
 
 	return assetValues, equityValues
@@ -351,6 +415,9 @@ func (c *Chart) handleData(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-type", "text/json")
 
+	c.Lock()
+	defer c.Unlock()
+
 	var maxDrawdown *drawdown
 	if c.paperWallet != nil {
 		value, start, end := c.paperWallet.MaxDrawdown()
@@ -361,17 +428,26 @@ func (c *Chart) handleData(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var position *model.PositionPnL
+	if c.positions != nil {
+		if pnl, ok := c.positions.PositionPnL(pair); ok {
+			position = &pnl
+		}
+	}
+
 	asset, quote := exchange.SplitAssetQuote(pair)
 	assetValues, equityValues := c.equityValuesByPair(pair)
 	err := json.NewEncoder(w).Encode(map[string]interface{}{
-		"candles":       c.candlesByPair(pair),
-		"indicators":    c.indicatorsByPair(pair),
-		"shapes":        c.shapesByPair(pair),
-		"asset_values":  assetValues,
-		"equity_values": equityValues,
-		"quote":         quote,
-		"asset":         asset,
-		"max_drawdown":  maxDrawdown,
+		"candles":         c.candlesByPair(pair),
+		"indicators":      c.indicatorsByPair(pair),
+		"shapes":          c.shapesByPair(pair),
+		"asset_values":    assetValues,
+		"equity_values":   equityValues,
+		"drawdown_values": drawdownValues(equityValues),
+		"quote":           quote,
+		"asset":           asset,
+		"max_drawdown":    maxDrawdown,
+		"position":        position,
 	})
 	if err != nil {
 		log.Error(err)
@@ -432,6 +508,9 @@ func (c *Chart) Start() error {
 	http.HandleFunc("/history", c.handleTradingHistoryData)
 	http.HandleFunc("/data", c.handleData)
 	http.HandleFunc("/", c.handleIndex)
+	for pattern, handler := range c.handlers {
+		http.Handle(pattern, handler)
+	}
 
 	fmt.Printf("Chart available at http://localhost:%d\n", c.port)
 	return http.ListenAndServe(fmt.Sprintf(":%d", c.port), nil)
@@ -457,6 +536,22 @@ func WithPaperWallet(paperWallet *exchange.PaperWallet) Option {
 	}
 }
 
+// WithAccount plots the equity and drawdown of an account, valued in a quote asset, eg: a live exchange
+// without paper wallet. The account is requested at the close of every candle.
+func WithAccount(account service.Broker, quote string) Option {
+	return func(chart *Chart) {
+		chart.account = account
+		chart.quote = quote
+	}
+}
+
+// WithPositions plots the average price, profit and fees of the positions, eg: `bot.Controller()`
+func WithPositions(positions service.PositionManager) Option {
+	return func(chart *Chart) {
+		chart.positions = positions
+	}
+}
+
 // WithDebug starts chart without compress
 func WithDebug() Option {
 	return func(chart *Chart) {
@@ -470,9 +565,17 @@ func WithCustomIndicators(indicators ...Indicator) Option {
 	}
 }
 
+// WithHandler registers an additional HTTP handler in the chart server, eg: the backtest debugger API
+func WithHandler(pattern string, handler http.Handler) Option {
+	return func(chart *Chart) {
+		chart.handlers[pattern] = handler
+	}
+}
+
 func NewChart(options ...Option) (*Chart, error) {
 	chart := &Chart{
 		port:            8080,
+		handlers:        make(map[string]http.Handler),
 		candles:         make(map[string][]Candle),
 		dataframe:       make(map[string]*model.Dataframe),
 		ordersIDsByPair: make(map[string]*set.LinkedHashSetINT64),
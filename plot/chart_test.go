@@ -1,6 +1,7 @@
 package plot
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -161,6 +162,35 @@ func TestChart_WithPaperWallet(t *testing.T) {
 	require.Equal(t, wallet, c.paperWallet)
 }
 
+func TestChart_WithAccount(t *testing.T) {
+	wallet := exchange.NewPaperWallet(context.Background(), "USDT",
+		exchange.WithPaperAsset("USDT", 1000),
+		exchange.WithPaperAsset("BTC", 1),
+	)
+	c, err := NewChart(WithAccount(wallet, "USDT"))
+	require.NoError(t, err)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, price := range []float64{100, 120, 90, 130} {
+		c.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(i) * time.Hour), Close: price,
+			Complete: true})
+	}
+
+	_, equity := c.equityValuesByPair("BTCUSDT")
+	require.Equal(t, []assetValue{
+		{Time: start, Value: 1100},
+		{Time: start.Add(time.Hour), Value: 1120},
+		{Time: start.Add(2 * time.Hour), Value: 1090},
+		{Time: start.Add(3 * time.Hour), Value: 1130},
+	}, equity)
+
+	drawdown := drawdownValues(equity)
+	require.Len(t, drawdown, 4)
+	require.Zero(t, drawdown[1].Value)
+	require.InDelta(t, -30.0/1120*100, drawdown[2].Value, 1e-9)
+	require.Zero(t, drawdown[3].Value)
+}
+
 func TestChart_WithDebug(t *testing.T) {
 	c, err := NewChart(WithDebug())
 	require.NoErrorf(t, err, "error when initial chart")
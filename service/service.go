@@ -20,11 +20,14 @@ type Feeder interface {
 	CandlesByPeriod(ctx context.Context, pair, period string, start, end time.Time) ([]model.Candle, error)
 	CandlesByLimit(ctx context.Context, pair, period string, limit int) ([]model.Candle, error)
 	CandlesSubscription(ctx context.Context, pair, timeframe string) (chan model.Candle, chan error)
+	// DepthSubscription streams snapshots of the best levels of the order book of a pair
+	DepthSubscription(ctx context.Context, pair string, levels int) (chan model.OrderBook, chan error)
 }
 
 type Broker interface {
 	Account() (model.Account, error)
 	Position(pair string) (asset, quote float64, err error)
+	PositionRisk(pair string) (model.PositionRisk, error)
 	Order(pair string, id int64) (model.Order, error)
 	CreateOrderOCO(side model.SideType, pair string, size, price, stop, stopLimit float64) ([]model.Order, error)
 	CreateOrderLimit(side model.SideType, pair string, size float64, limit float64) (model.Order, error)
@@ -32,11 +35,111 @@ type Broker interface {
 	CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error)
 	CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error)
 	Cancel(model.Order) error
+	// ModifyOrder amends the price and quantity of an open order, zero values keep the current ones
+	ModifyOrder(order model.Order, price, quantity float64) (model.Order, error)
 	CancelOpenOrders(pair string) error
 	TakeProfit(side model.SideType, pair string, quantity float64, limit float64) (model.Order, error)
 	OpenOrders(pair string) ([]model.Order, error)
 }
 
+// TimeInForceBroker is a broker that creates limit orders with a time in force other than GTC,
+// eg: post only orders of market making strategies, which must be filled as maker
+type TimeInForceBroker interface {
+	CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+		timeInForce model.TimeInForceType) (model.Order, error)
+}
+
+// OrderOptionsBroker is a broker that creates limit orders with advanced options, eg: iceberg orders
+// that split large orders to hide their size
+type OrderOptionsBroker interface {
+	CreateOrderLimitOptions(side model.SideType, pair string, size, limit float64,
+		options model.OrderOptions) (model.Order, error)
+}
+
+// TrailingStopBroker is a broker with trailing stop orders, activated at a price, or immediately when it is
+// zero, and following the price at a callback rate, eg: 0.01 = 1%
+type TrailingStopBroker interface {
+	CreateOrderTrailingStop(side model.SideType, pair string, quantity, activation,
+		callbackRate float64) (model.Order, error)
+}
+
+// ClientOrderBroker is a broker that places orders with a client order ID chosen by the caller. The order
+// controller persists the ID before the submission, so an order placed right before a crash is found in the
+// exchange on restart, instead of being placed again.
+type ClientOrderBroker interface {
+	CreateOrderRequest(request model.OrderRequest) (model.Order, error)
+	OrderByClientID(pair, clientOrderID string) (model.Order, error)
+}
+
+// ClientOCOBroker is a broker that places OCO orders with a client order ID for each leg, see ClientOrderBroker.
+// The limit leg is a limit request and the stop leg a stop loss limit request, with the same side and quantity.
+type ClientOCOBroker interface {
+	CreateOrderOCORequest(limit, stop model.OrderRequest) ([]model.Order, error)
+}
+
+// AmendBroker is a broker that amends some open orders in place, keeping their IDs. With client order IDs,
+// the order controller replaces the other orders with a cancel and a new order request.
+type AmendBroker interface {
+	Amends(order model.Order) bool
+}
+
+// EmulatedOCOBroker is a broker without native OCO orders in some pairs, where the legs of OCO orders are
+// independent orders with the same group ID. The order controller cancels the other legs when one is filled.
+type EmulatedOCOBroker interface {
+	EmulatedOCO(pair string) bool
+}
+
+// PositionManager is a broker tracking the positions of the bot from its fills, with the average price,
+// realized and unrealized profit and fees, eg: the order controller. Strategies can assert the broker to it.
+type PositionManager interface {
+	PositionPnL(pair string) (model.PositionPnL, bool)
+	Positions() []model.PositionPnL
+}
+
+// PositionSizer is a broker sizing new positions with a sizer, rounded to the lot size of the pair, eg: the
+// order controller. Strategies can assert the broker to it.
+type PositionSizer interface {
+	Size(sizer model.Sizer, request model.SizeRequest) (float64, error)
+}
+
+// AccountSubscriber is an exchange with a user data stream. The order controller uses it to process
+// order updates as soon as they happen, in addition to the periodic order polling.
+type AccountSubscriber interface {
+	AccountSubscription(ctx context.Context) (chan model.Order, chan error)
+}
+
+// FundingFeeder is a futures exchange with funding rates of perpetual pairs
+type FundingFeeder interface {
+	FundingRate(ctx context.Context, pair string) (model.FundingRate, error)
+}
+
+// FundingHistoryFeeder is a futures exchange with the history of settled funding rates, eg: to simulate the
+// funding of perpetual positions in backtests
+type FundingHistoryFeeder interface {
+	FundingRates(ctx context.Context, pair string, start, end time.Time) ([]model.FundingRate, error)
+}
+
+// MarkPriceHistoryFeeder is a futures exchange with the history of the mark price, eg: to download the price
+// series of liquidations and funding for backtests
+type MarkPriceHistoryFeeder interface {
+	MarkPriceCandlesByPeriod(ctx context.Context, pair, period string, start, end time.Time) ([]model.Candle, error)
+}
+
+// MarkPriceFeeder is a futures exchange with a mark price stream, eg: to trigger stops as the exchange does
+type MarkPriceFeeder interface {
+	MarkPriceSubscription(ctx context.Context, pair string) (chan model.MarkPrice, chan error)
+}
+
+// TradeFeeder is an exchange with a stream of aggregated trades (ticks), eg: for volume delta strategies
+type TradeFeeder interface {
+	TradesSubscription(ctx context.Context, pair string) (chan model.Trade, chan error)
+}
+
+// QuoteFeeder is an exchange with a stream of the best bid and ask, lighter than the order book depth
+type QuoteFeeder interface {
+	QuoteSubscription(ctx context.Context, pair string) (chan model.Quote, chan error)
+}
+
 type Notifier interface {
 	Notify(string)
 	OnOrder(order model.Order)
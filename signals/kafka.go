@@ -0,0 +1,57 @@
+package signals
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSource reads signals from a Kafka topic
+type KafkaSource struct {
+	reader *kafka.Reader
+}
+
+// NewKafkaSource creates a source for a given Kafka reader configuration,
+// a consumer group is recommended to commit the offsets of processed signals
+func NewKafkaSource(config kafka.ReaderConfig) *KafkaSource {
+	return &KafkaSource{
+		reader: kafka.NewReader(config),
+	}
+}
+
+func (k *KafkaSource) Subscribe(ctx context.Context) (chan []byte, chan error) {
+	cmessages := make(chan []byte)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cmessages)
+		defer close(cerr)
+		defer k.reader.Close()
+
+		for {
+			message, err := k.reader.ReadMessage(ctx)
+			if err != nil {
+				if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) ||
+					errors.Is(err, context.DeadlineExceeded) {
+					return
+				}
+				select {
+				case cerr <- err:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case cmessages <- message.Value:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return cmessages, cerr
+}
@@ -0,0 +1,61 @@
+package signals
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSource reads signals from Redis pub/sub channels
+type RedisSource struct {
+	client   *redis.Client
+	channels []string
+}
+
+// NewRedisSource creates a source for the given Redis client and channels
+func NewRedisSource(client *redis.Client, channels ...string) *RedisSource {
+	return &RedisSource{
+		client:   client,
+		channels: channels,
+	}
+}
+
+func (r *RedisSource) Subscribe(ctx context.Context) (chan []byte, chan error) {
+	cmessages := make(chan []byte)
+	cerr := make(chan error)
+
+	go func() {
+		defer close(cmessages)
+		defer close(cerr)
+
+		pubsub := r.client.Subscribe(ctx, r.channels...)
+		defer pubsub.Close()
+
+		if _, err := pubsub.Receive(ctx); err != nil {
+			select {
+			case cerr <- err:
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		channel := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-channel:
+				if !ok {
+					return
+				}
+				select {
+				case cmessages <- []byte(message.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return cmessages, cerr
+}
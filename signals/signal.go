@@ -0,0 +1,236 @@
+package signals
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+var (
+	ErrInvalidSignal  = errors.New("invalid signal")
+	ErrPairNotAllowed = errors.New("pair not allowed")
+)
+
+// Signal is a trade instruction received from an external system, eg: a research pipeline or a ML model.
+//
+// JSON example:
+//
+//	{"id": "1", "pair": "BTCUSDT", "side": "BUY", "size": 0.1, "stop_loss": 19000, "take_profit": 21000}
+type Signal struct {
+	ID   string         `json:"id"`
+	Pair string         `json:"pair"`
+	Side model.SideType `json:"side"`
+	Size float64        `json:"size"`
+	// Price is the limit price of the entry, a market order is used when empty
+	Price      float64   `json:"price,omitempty"`
+	StopLoss   float64   `json:"stop_loss,omitempty"`
+	TakeProfit float64   `json:"take_profit,omitempty"`
+	Time       time.Time `json:"time,omitempty"`
+}
+
+// Parse decodes and validates a JSON signal
+func Parse(data []byte) (Signal, error) {
+	var signal Signal
+	if err := json.Unmarshal(data, &signal); err != nil {
+		return Signal{}, fmt.Errorf("%w: %v", ErrInvalidSignal, err)
+	}
+
+	signal.Pair = strings.ToUpper(signal.Pair)
+	signal.Side = model.SideType(strings.ToUpper(string(signal.Side)))
+	return signal, signal.Validate()
+}
+
+// Validate checks the signal fields and the consistency of stop loss and take profit levels
+func (s Signal) Validate() error {
+	if s.Pair == "" {
+		return fmt.Errorf("%w: empty pair", ErrInvalidSignal)
+	}
+
+	if s.Side != model.SideTypeBuy && s.Side != model.SideTypeSell {
+		return fmt.Errorf("%w: invalid side %s", ErrInvalidSignal, s.Side)
+	}
+
+	if s.Size <= 0 {
+		return fmt.Errorf("%w: invalid size %f", ErrInvalidSignal, s.Size)
+	}
+
+	if s.Price < 0 || s.StopLoss < 0 || s.TakeProfit < 0 {
+		return fmt.Errorf("%w: negative price", ErrInvalidSignal)
+	}
+
+	if s.StopLoss > 0 && s.TakeProfit > 0 {
+		if s.Side == model.SideTypeBuy && s.StopLoss >= s.TakeProfit {
+			return fmt.Errorf("%w: stop loss must be below take profit", ErrInvalidSignal)
+		}
+		if s.Side == model.SideTypeSell && s.StopLoss <= s.TakeProfit {
+			return fmt.Errorf("%w: stop loss must be above take profit", ErrInvalidSignal)
+		}
+	}
+
+	return nil
+}
+
+// Source is a stream of raw signal messages, eg: Redis pub/sub or Kafka topics
+type Source interface {
+	Subscribe(ctx context.Context) (chan []byte, chan error)
+}
+
+// Consumer reads signals from a source and executes them through a broker, usually the order controller
+type Consumer struct {
+	source  Source
+	broker  service.Broker
+	pairs   map[string]bool
+	onError func(err error)
+	onOrder func(signal Signal, orders []model.Order)
+}
+
+type Option func(*Consumer)
+
+// WithPairs restricts the signals to a list of pairs, by default all pairs are accepted
+func WithPairs(pairs ...string) Option {
+	return func(consumer *Consumer) {
+		for _, pair := range pairs {
+			consumer.pairs[strings.ToUpper(pair)] = true
+		}
+	}
+}
+
+// WithErrorHandler sets a function to receive invalid signals and execution errors, by default errors are logged
+func WithErrorHandler(handler func(err error)) Option {
+	return func(consumer *Consumer) {
+		consumer.onError = handler
+	}
+}
+
+// WithOrderHandler sets a function called with the orders created for each executed signal
+func WithOrderHandler(handler func(signal Signal, orders []model.Order)) Option {
+	return func(consumer *Consumer) {
+		consumer.onOrder = handler
+	}
+}
+
+// NewConsumer creates a consumer of a signal source. The broker is usually `bot.Controller()`,
+// so orders are stored, notified and tracked as any other strategy order.
+func NewConsumer(source Source, broker service.Broker, options ...Option) *Consumer {
+	consumer := &Consumer{
+		source: source,
+		broker: broker,
+		pairs:  make(map[string]bool),
+		onError: func(err error) {
+			log.Errorf("signals: %v", err)
+		},
+	}
+
+	for _, option := range options {
+		option(consumer)
+	}
+
+	return consumer
+}
+
+// Start consumes the source in background, until the context is canceled or the source is closed
+func (c *Consumer) Start(ctx context.Context) {
+	messages, errs := c.source.Subscribe(ctx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				c.onError(err)
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				c.Handle(message)
+			}
+		}
+	}()
+}
+
+// Handle parses and executes a raw signal message
+func (c *Consumer) Handle(message []byte) {
+	signal, err := Parse(message)
+	if err != nil {
+		c.onError(err)
+		return
+	}
+
+	orders, err := c.Execute(signal)
+	if err != nil {
+		c.onError(fmt.Errorf("signal %s: %w", signal.ID, err))
+	}
+
+	if c.onOrder != nil && len(orders) > 0 {
+		c.onOrder(signal, orders)
+	}
+}
+
+// Execute sends the entry order of a signal, followed by the protection orders when stop loss or
+// take profit are given. Orders created before a failure are returned along with the error.
+func (c *Consumer) Execute(signal Signal) ([]model.Order, error) {
+	if len(c.pairs) > 0 && !c.pairs[signal.Pair] {
+		return nil, fmt.Errorf("%w: %s", ErrPairNotAllowed, signal.Pair)
+	}
+
+	var (
+		entry model.Order
+		err   error
+	)
+
+	log.Infof("[SIGNAL] %s %s %f %s", signal.ID, signal.Side, signal.Size, signal.Pair)
+	if signal.Price > 0 {
+		entry, err = c.broker.CreateOrderLimit(signal.Side, signal.Pair, signal.Size, signal.Price)
+	} else {
+		entry, err = c.broker.CreateOrderMarket(signal.Side, signal.Pair, signal.Size, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []model.Order{entry}
+	exitSide := model.SideTypeSell
+	if signal.Side == model.SideTypeSell {
+		exitSide = model.SideTypeBuy
+	}
+
+	switch {
+	case signal.StopLoss > 0 && signal.TakeProfit > 0:
+		protection, err := c.broker.CreateOrderOCO(exitSide, signal.Pair, signal.Size, signal.TakeProfit,
+			signal.StopLoss, signal.StopLoss)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, protection...)
+	case signal.StopLoss > 0:
+		stop := signal.StopLoss
+		if exitSide == model.SideTypeBuy {
+			// negative stop price is used by futures brokers for buy stops
+			stop = -stop
+		}
+		protection, err := c.broker.CreateOrderStop(signal.Pair, signal.Size, stop)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, protection)
+	case signal.TakeProfit > 0:
+		protection, err := c.broker.TakeProfit(exitSide, signal.Pair, signal.Size, signal.TakeProfit)
+		if err != nil {
+			return orders, err
+		}
+		orders = append(orders, protection)
+	}
+
+	return orders, nil
+}
@@ -0,0 +1,87 @@
+package signals
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+)
+
+type fakeSource struct {
+	messages chan []byte
+}
+
+func (f fakeSource) Subscribe(_ context.Context) (chan []byte, chan error) {
+	return f.messages, make(chan error)
+}
+
+func TestParse(t *testing.T) {
+	signal, err := Parse([]byte(`{"id":"1","pair":"btcusdt","side":"buy","size":1,"stop_loss":900,"take_profit":1200}`))
+	require.NoError(t, err)
+	require.Equal(t, "BTCUSDT", signal.Pair)
+	require.Equal(t, model.SideTypeBuy, signal.Side)
+
+	_, err = Parse([]byte(`{"pair":"BTCUSDT","side":"BUY","size":0}`))
+	require.ErrorIs(t, err, ErrInvalidSignal)
+
+	_, err = Parse([]byte(`{"pair":"BTCUSDT","side":"BUY","size":1,"stop_loss":1200,"take_profit":900}`))
+	require.ErrorIs(t, err, ErrInvalidSignal)
+
+	_, err = Parse([]byte(`invalid`))
+	require.ErrorIs(t, err, ErrInvalidSignal)
+}
+
+func TestConsumer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wallet := exchange.NewPaperWallet(ctx, "USDT", exchange.WithPaperAsset("USDT", 3000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+
+	t.Run("execute with protection", func(t *testing.T) {
+		consumer := NewConsumer(nil, wallet)
+		orders, err := consumer.Execute(Signal{
+			Pair: "BTCUSDT", Side: model.SideTypeBuy, Size: 1, StopLoss: 900, TakeProfit: 1200,
+		})
+		require.NoError(t, err)
+		require.Len(t, orders, 3)
+		require.Equal(t, model.OrderTypeMarket, orders[0].Type)
+		require.Equal(t, model.SideTypeSell, orders[1].Side)
+	})
+
+	t.Run("pair not allowed", func(t *testing.T) {
+		consumer := NewConsumer(nil, wallet, WithPairs("ETHUSDT"))
+		_, err := consumer.Execute(Signal{Pair: "BTCUSDT", Side: model.SideTypeBuy, Size: 1})
+		require.ErrorIs(t, err, ErrPairNotAllowed)
+	})
+
+	t.Run("consume source", func(t *testing.T) {
+		source := fakeSource{messages: make(chan []byte)}
+		executed := make(chan Signal, 1)
+		errs := make(chan error, 1)
+		consumer := NewConsumer(source, wallet,
+			WithErrorHandler(func(err error) {
+				errs <- err
+			}),
+			WithOrderHandler(func(signal Signal, _ []model.Order) {
+				executed <- signal
+			}),
+		)
+		consumer.Start(ctx)
+
+		source.messages <- []byte(`{"id":"invalid"}`)
+		require.ErrorIs(t, <-errs, ErrInvalidSignal)
+
+		source.messages <- []byte(`{"id":"2","pair":"BTCUSDT","side":"SELL","size":0.5}`)
+		select {
+		case signal := <-executed:
+			require.Equal(t, "2", signal.ID)
+		case <-time.After(time.Second):
+			require.Fail(t, "signal not executed")
+		}
+	})
+}
@@ -2,14 +2,19 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"strconv"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/bengalm/ninjabot/model"
 	"github.com/tidwall/buntdb"
 )
 
+const statePrefix = "state:"
+
 type Bunt struct {
 	lastID int64
 	db     *buntdb.DB
@@ -74,6 +79,10 @@ func (b Bunt) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 	orders := make([]*model.Order, 0)
 	err := b.db.View(func(tx *buntdb.Tx) error {
 		err := tx.Ascend("update_index", func(key, value string) bool {
+			if strings.HasPrefix(key, statePrefix) {
+				return true
+			}
+
 			var order model.Order
 			err := json.Unmarshal([]byte(value), &order)
 			if err != nil {
@@ -98,3 +107,53 @@ func (b Bunt) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 	}
 	return orders, nil
 }
+
+func (b Bunt) SaveState(key string, value []byte) error {
+	return b.db.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(statePrefix+key, string(value), nil)
+		return err
+	})
+}
+
+func (b Bunt) LoadState(key string) ([]byte, error) {
+	var value string
+	err := b.db.View(func(tx *buntdb.Tx) error {
+		var err error
+		value, err = tx.Get(statePrefix + key)
+		return err
+	})
+	if errors.Is(err, buntdb.ErrNotFound) {
+		return nil, ErrStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(value), nil
+}
+
+func (b Bunt) QueryOrders(query OrderQuery) (OrderPage, error) {
+	return pageOrders(b.scan, query)
+}
+
+func (b Bunt) DailyProfits(query OrderQuery) ([]Profit, error) {
+	return dailyProfits(b.scan, query)
+}
+
+// scan iterates the orders by the update index, like Orders
+func (b Bunt) scan(_ time.Time, callback func(order *model.Order)) error {
+	return b.db.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend("update_index", func(key, value string) bool {
+			if strings.HasPrefix(key, statePrefix) {
+				return true
+			}
+
+			var order model.Order
+			if err := json.Unmarshal([]byte(value), &order); err != nil {
+				log.Println(err)
+				return true
+			}
+			callback(&order)
+			return true
+		})
+	})
+}
@@ -23,4 +23,12 @@ func TestNewBunt(t *testing.T) {
 	require.NoError(t, err)
 
 	storageUseCase(repo, t)
+	stateUseCase(repo, t)
+}
+
+func TestBunt_Query(t *testing.T) {
+	repo, err := FromMemory()
+	require.NoError(t, err)
+
+	queryUseCase(repo, t)
 }
@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// CandleRange is a period of candles, with inclusive start and end
+type CandleRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// CandleStore persists the candles of pairs and timeframes, with the periods already fetched,
+// so periods without trades are not fetched again
+type CandleStore interface {
+	// Candles returns the stored candles between start and end, inclusive, sorted by time
+	Candles(pair, timeframe string, start, end time.Time) ([]model.Candle, error)
+	// Ranges returns the fetched periods, merged and sorted by start
+	Ranges(pair, timeframe string) ([]CandleRange, error)
+	// Save stores the candles of a fetched period, candles with the same time are replaced
+	Save(pair, timeframe string, period CandleRange, candles []model.Candle) error
+}
+
+// IndicatorValues are the values of the indicators of a strategy at the time of a candle
+type IndicatorValues struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// IndicatorStore persists the computed indicators of pairs and timeframes, eg: to analyze the decisions of
+// a live strategy with the values it used
+type IndicatorStore interface {
+	// Indicators returns the stored values between start and end, inclusive, sorted by time
+	Indicators(pair, timeframe string, start, end time.Time) ([]IndicatorValues, error)
+	// SaveIndicators stores the values of the indicators, values with the same time are replaced
+	SaveIndicators(pair, timeframe string, values []IndicatorValues) error
+}
+
+// MergeRanges sorts and merges overlapping or contiguous ranges, given the candle interval
+func MergeRanges(ranges []CandleRange, interval time.Duration) []CandleRange {
+	sorted := make([]CandleRange, len(ranges))
+	copy(sorted, ranges)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	merged := make([]CandleRange, 0, len(sorted))
+	for _, period := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && !period.Start.After(merged[last].End.Add(interval)) {
+			if period.End.After(merged[last].End) {
+				merged[last].End = period.End
+			}
+			continue
+		}
+		merged = append(merged, period)
+	}
+	return merged
+}
+
+type candleRecord struct {
+	Pair      string `gorm:"primaryKey"`
+	Timeframe string `gorm:"primaryKey"`
+	Time      int64  `gorm:"primaryKey;autoIncrement:false"`
+	Open      float64
+	Close     float64
+	Low       float64
+	High      float64
+	Volume    float64
+	// Metadata is the JSON of the candle metadata, eg: funding rates
+	Metadata string
+}
+
+type indicatorRecord struct {
+	Pair      string `gorm:"primaryKey"`
+	Timeframe string `gorm:"primaryKey"`
+	Time      int64  `gorm:"primaryKey;autoIncrement:false"`
+	Values    string
+}
+
+type candleRangeRecord struct {
+	ID        uint   `gorm:"primaryKey"`
+	Pair      string `gorm:"index:idx_candle_range"`
+	Timeframe string `gorm:"index:idx_candle_range"`
+	Start     int64
+	End       int64
+}
+
+// SQLCandles is a candle store in a SQL database, eg: a local SQLite file shared by backtests
+type SQLCandles struct {
+	db *gorm.DB
+}
+
+// CandlesFromSQL creates a candle and indicator store in a SQL database, applying the pending migrations of
+// the candles schema. Example of usage:
+//
+//	import "github.com/glebarez/sqlite"
+//	store, err := storage.CandlesFromSQL(sqlite.Open("candles.db"), &gorm.Config{})
+func CandlesFromSQL(dialect gorm.Dialector, opts ...gorm.Option) (*SQLCandles, error) {
+	db, err := gorm.Open(dialect, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(&candleRecord{}, &candleRangeRecord{}, &indicatorRecord{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db, "candles"); err != nil {
+		return nil, err
+	}
+
+	return &SQLCandles{db: db}, nil
+}
+
+func (s *SQLCandles) Candles(pair, timeframe string, start, end time.Time) ([]model.Candle, error) {
+	records := make([]candleRecord, 0)
+	result := s.db.
+		Where("pair = ? AND timeframe = ? AND time >= ? AND time <= ?",
+			pair, timeframe, start.UnixMilli(), end.UnixMilli()).
+		Order("time").
+		Find(&records)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	candles := make([]model.Candle, 0, len(records))
+	for _, record := range records {
+		t := time.UnixMilli(record.Time)
+		candle := model.Candle{
+			Pair:      record.Pair,
+			Time:      t,
+			UpdatedAt: t,
+			Open:      record.Open,
+			Close:     record.Close,
+			Low:       record.Low,
+			High:      record.High,
+			Volume:    record.Volume,
+			Complete:  true,
+		}
+		if record.Metadata != "" {
+			if err := json.Unmarshal([]byte(record.Metadata), &candle.Metadata); err != nil {
+				return nil, err
+			}
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+func (s *SQLCandles) Ranges(pair, timeframe string) ([]CandleRange, error) {
+	records := make([]candleRangeRecord, 0)
+	result := s.db.Where("pair = ? AND timeframe = ?", pair, timeframe).Order("start").Find(&records)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	ranges := make([]CandleRange, 0, len(records))
+	for _, record := range records {
+		ranges = append(ranges, CandleRange{Start: time.UnixMilli(record.Start), End: time.UnixMilli(record.End)})
+	}
+	return ranges, nil
+}
+
+func (s *SQLCandles) Save(pair, timeframe string, period CandleRange, candles []model.Candle) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if len(candles) > 0 {
+			records := make([]candleRecord, 0, len(candles))
+			for _, candle := range candles {
+				metadata, err := encodeValues(candle.Metadata)
+				if err != nil {
+					return err
+				}
+				records = append(records, candleRecord{
+					Pair:      pair,
+					Timeframe: timeframe,
+					Time:      candle.Time.UnixMilli(),
+					Open:      candle.Open,
+					Close:     candle.Close,
+					Low:       candle.Low,
+					High:      candle.High,
+					Volume:    candle.Volume,
+					Metadata:  metadata,
+				})
+			}
+			result := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(records, 500)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		// the fetched periods are merged, keeping a single record per continuous period
+		stored := make([]candleRangeRecord, 0)
+		result := tx.Where("pair = ? AND timeframe = ?", pair, timeframe).Find(&stored)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		ranges := []CandleRange{period}
+		for _, record := range stored {
+			ranges = append(ranges, CandleRange{Start: time.UnixMilli(record.Start), End: time.UnixMilli(record.End)})
+		}
+
+		result = tx.Where("pair = ? AND timeframe = ?", pair, timeframe).Delete(&candleRangeRecord{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		for _, merged := range MergeRanges(ranges, time.Millisecond) {
+			result = tx.Create(&candleRangeRecord{
+				Pair:      pair,
+				Timeframe: timeframe,
+				Start:     merged.Start.UnixMilli(),
+				End:       merged.End.UnixMilli(),
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLCandles) Indicators(pair, timeframe string, start, end time.Time) ([]IndicatorValues, error) {
+	records := make([]indicatorRecord, 0)
+	result := s.db.
+		Where("pair = ? AND timeframe = ? AND time >= ? AND time <= ?",
+			pair, timeframe, start.UnixMilli(), end.UnixMilli()).
+		Order("time").
+		Find(&records)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	values := make([]IndicatorValues, 0, len(records))
+	for _, record := range records {
+		value := IndicatorValues{Time: time.UnixMilli(record.Time), Values: make(map[string]float64)}
+		if err := json.Unmarshal([]byte(record.Values), &value.Values); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (s *SQLCandles) SaveIndicators(pair, timeframe string, values []IndicatorValues) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	records := make([]indicatorRecord, 0, len(values))
+	for _, value := range values {
+		encoded, err := encodeValues(value.Values)
+		if err != nil {
+			return err
+		}
+		records = append(records, indicatorRecord{
+			Pair:      pair,
+			Timeframe: timeframe,
+			Time:      value.Time.UnixMilli(),
+			Values:    encoded,
+		})
+	}
+	return s.db.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(records, 500).Error
+}
+
+// encodeValues returns the JSON of a map of values, without NaN and infinite values that JSON does not support
+func encodeValues(values map[string]float64) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	finite := make(map[string]float64, len(values))
+	for key, value := range values {
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			finite[key] = value
+		}
+	}
+
+	content, err := json.Marshal(finite)
+	return string(content), err
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestMergeRanges(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hours int) time.Time {
+		return start.Add(time.Duration(hours) * time.Hour)
+	}
+
+	merged := MergeRanges([]CandleRange{
+		{Start: at(5), End: at(8)},
+		{Start: at(0), End: at(2)},
+		{Start: at(3), End: at(4)},
+		{Start: at(10), End: at(12)},
+		{Start: at(6), End: at(7)},
+	}, time.Hour)
+	require.Equal(t, []CandleRange{
+		{Start: at(0), End: at(8)},
+		{Start: at(10), End: at(12)},
+	}, merged)
+}
+
+func TestCandlesFromSQL(t *testing.T) {
+	store, err := CandlesFromSQL(sqlite.Open(filepath.Join(t.TempDir(), "candles.db")), &gorm.Config{})
+	require.NoError(t, err)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := make([]model.Candle, 0)
+	for i := 0; i < 3; i++ {
+		candles = append(candles, model.Candle{
+			Pair: "BTCUSDT", Time: start.Add(time.Duration(i) * time.Hour), Close: float64(i), Complete: true,
+		})
+	}
+
+	err = store.Save("BTCUSDT", "1h", CandleRange{Start: start, End: start.Add(2 * time.Hour)}, candles)
+	require.NoError(t, err)
+
+	// overlapped candles are replaced and ranges are merged
+	candles[2].Close = 20
+	err = store.Save("BTCUSDT", "1h", CandleRange{Start: start.Add(2 * time.Hour), End: start.Add(5 * time.Hour)},
+		candles[2:])
+	require.NoError(t, err)
+
+	ranges, err := store.Ranges("BTCUSDT", "1h")
+	require.NoError(t, err)
+	require.Equal(t, []CandleRange{{Start: start.Local(), End: start.Add(5 * time.Hour).Local()}}, ranges)
+
+	result, err := store.Candles("BTCUSDT", "1h", start.Add(time.Hour), start.Add(5*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+	require.Equal(t, 1.0, result[0].Close)
+	require.Equal(t, 20.0, result[1].Close)
+	require.True(t, result[1].Time.Equal(start.Add(2*time.Hour)))
+
+	ranges, err = store.Ranges("ETHUSDT", "1h")
+	require.NoError(t, err)
+	require.Empty(t, ranges)
+}
+
+func TestSQLCandles_Indicators(t *testing.T) {
+	store, err := CandlesFromSQL(sqlite.Open(filepath.Join(t.TempDir(), "candles.db")), &gorm.Config{})
+	require.NoError(t, err)
+
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := model.Candle{Pair: "BTCUSDT", Time: start, Close: 10, Metadata: map[string]float64{"funding": 0.01}}
+	err = store.Save("BTCUSDT", "1h", CandleRange{Start: start, End: start}, []model.Candle{candle})
+	require.NoError(t, err)
+
+	candles, err := store.Candles("BTCUSDT", "1h", start, start)
+	require.NoError(t, err)
+	require.Len(t, candles, 1)
+	require.Equal(t, map[string]float64{"funding": 0.01}, candles[0].Metadata)
+
+	// values are replaced by time, without NaN values
+	err = store.SaveIndicators("BTCUSDT", "1h", []IndicatorValues{
+		{Time: start, Values: map[string]float64{"ema": 1, "rsi": math.NaN()}},
+		{Time: start.Add(time.Hour), Values: map[string]float64{"ema": 2}},
+	})
+	require.NoError(t, err)
+	err = store.SaveIndicators("BTCUSDT", "1h", []IndicatorValues{
+		{Time: start.Add(time.Hour), Values: map[string]float64{"ema": 3, "rsi": 50}},
+	})
+	require.NoError(t, err)
+
+	values, err := store.Indicators("BTCUSDT", "1h", start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, values, 2)
+	require.Equal(t, map[string]float64{"ema": 1}, values[0].Values)
+	require.True(t, values[1].Time.Equal(start.Add(time.Hour)))
+	require.Equal(t, map[string]float64{"ema": 3, "rsi": 50}, values[1].Values)
+}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+var (
+	//go:embed migrations
+	migrationFiles embed.FS
+
+	// ErrInvalidMigration is returned for a migration file without a version, or with a duplicated version
+	ErrInvalidMigration = errors.New("invalid migration")
+)
+
+// Migration is a versioned change of a schema, applied once, in a transaction
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// schemaVersion records the migrations applied to the schemas of a database
+type schemaVersion struct {
+	SchemaName string `gorm:"primaryKey"`
+	Version    int    `gorm:"primaryKey;autoIncrement:false"`
+	Name       string
+	AppliedAt  time.Time
+}
+
+func (schemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// LoadMigrations reads the migrations of a directory, SQL files named <version>_<name>.sql, eg:
+// 0002_fees.sql. A file for a dialect, eg: 0002_fees.postgres.sql, replaces the generic file of the
+// version in databases of the dialect.
+func LoadMigrations(files fs.FS, dir, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[int]Migration)
+	specific := make(map[int]bool)
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		fileDialect := ""
+		if base, suffix, ok := strings.Cut(name, "."); ok {
+			name, fileDialect = base, suffix
+		}
+		if fileDialect != "" && fileDialect != dialect {
+			continue
+		}
+
+		prefix, description, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+		if _, ok := migrations[version]; ok && specific[version] == (fileDialect != "") {
+			return nil, fmt.Errorf("%w: duplicated version %d", ErrInvalidMigration, version)
+		}
+		if specific[version] {
+			continue
+		}
+
+		content, err := fs.ReadFile(files, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations[version] = Migration{Version: version, Name: description, SQL: string(content)}
+		specific[version] = fileDialect != ""
+	}
+
+	result := make([]Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		result = append(result, migration)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+// Migrate applies the migrations of a schema with a version above the last applied version, in order.
+// The applied versions are recorded in the schema_version table of the database.
+func Migrate(db *gorm.DB, schema string, migrations []Migration) error {
+	if err := db.AutoMigrate(&schemaVersion{}); err != nil {
+		return err
+	}
+
+	var current int
+	err := db.Model(&schemaVersion{}).Where("schema_name = ?", schema).
+		Select("COALESCE(MAX(version), 0)").Scan(&current).Error
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, statement := range statements(migration.SQL) {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&schemaVersion{
+				SchemaName: schema,
+				Version:    migration.Version,
+				Name:       migration.Name,
+				AppliedAt:  time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %s %d_%s: %w", schema, migration.Version, migration.Name, err)
+		}
+		log.Infof("[SETUP] Applied migration %s %d_%s", schema, migration.Version, migration.Name)
+	}
+	return nil
+}
+
+// migrate applies the embedded migrations of a schema of the built-in storages
+func migrate(db *gorm.DB, schema string) error {
+	migrations, err := LoadMigrations(migrationFiles, path.Join("migrations", schema), db.Dialector.Name())
+	if err != nil {
+		return err
+	}
+	return Migrate(db, schema, migrations)
+}
+
+// statements splits a SQL script by the semicolons at the end of lines, without comment lines
+func statements(script string) []string {
+	result := make([]string, 0)
+	var statement strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			result = append(result, strings.TrimSpace(statement.String()))
+			statement.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(statement.String()); rest != "" {
+		result = append(result, rest)
+	}
+	return result
+}
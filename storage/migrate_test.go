@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	files := fstest.MapFS{
+		"schema/0002_fees.sql":          {Data: []byte("ALTER TABLE orders ADD COLUMN fee REAL;")},
+		"schema/0002_fees.postgres.sql": {Data: []byte("ALTER TABLE orders ADD COLUMN fee NUMERIC;")},
+		"schema/0001_init.sql":          {Data: []byte("CREATE TABLE orders (id INTEGER);")},
+		"schema/readme.md":              {Data: []byte("ignored")},
+	}
+
+	migrations, err := LoadMigrations(files, "schema", "sqlite")
+	require.NoError(t, err)
+	require.Equal(t, []Migration{
+		{Version: 1, Name: "init", SQL: "CREATE TABLE orders (id INTEGER);"},
+		{Version: 2, Name: "fees", SQL: "ALTER TABLE orders ADD COLUMN fee REAL;"},
+	}, migrations)
+
+	migrations, err = LoadMigrations(files, "schema", "postgres")
+	require.NoError(t, err)
+	require.Equal(t, "ALTER TABLE orders ADD COLUMN fee NUMERIC;", migrations[1].SQL)
+
+	files["schema/0002_other.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	_, err = LoadMigrations(files, "schema", "sqlite")
+	require.ErrorIs(t, err, ErrInvalidMigration)
+
+	_, err = LoadMigrations(fstest.MapFS{"schema/fees.sql": {}}, "schema", "sqlite")
+	require.ErrorIs(t, err, ErrInvalidMigration)
+}
+
+func TestMigrate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "migrate.db")), &gorm.Config{})
+	require.NoError(t, err)
+
+	migrations := []Migration{
+		{Version: 1, Name: "init", SQL: "CREATE TABLE fees (id INTEGER);\n-- comment\nINSERT INTO fees VALUES (1);"},
+		{Version: 2, Name: "value", SQL: "ALTER TABLE fees ADD COLUMN value REAL;"},
+	}
+	require.NoError(t, Migrate(db, "fees", migrations))
+	// applied migrations are not applied again
+	require.NoError(t, Migrate(db, "fees", migrations))
+
+	var versions []schemaVersion
+	require.NoError(t, db.Order("version").Find(&versions).Error)
+	require.Len(t, versions, 2)
+	require.Equal(t, "value", versions[1].Name)
+
+	// a failed migration is rolled back and not recorded
+	migrations = append(migrations, Migration{Version: 3, Name: "broken",
+		SQL: "INSERT INTO fees VALUES (2, 0.1);\nINSERT INTO unknown VALUES (1);"})
+	require.ErrorContains(t, Migrate(db, "fees", migrations), "3_broken")
+
+	var count int64
+	require.NoError(t, db.Table("fees").Count(&count).Error)
+	require.Equal(t, int64(1), count)
+	require.NoError(t, db.Model(&schemaVersion{}).Count(&count).Error)
+	require.Equal(t, int64(2), count)
+}
+
+func TestFromSQL_Migrations(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "orders.db")
+
+	// database of a version without partial fills and hedge mode
+	db, err := gorm.Open(sqlite.Open(file), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec(`CREATE TABLE orders (id INTEGER PRIMARY KEY AUTOINCREMENT, exchange_id INTEGER,
+		pair TEXT, side TEXT, type TEXT, status TEXT, price REAL, quantity REAL, created_at DATETIME,
+		updated_at DATETIME, stop REAL, group_id INTEGER)`).Error)
+	require.NoError(t, db.Exec(`INSERT INTO orders (exchange_id, pair, side, type, status, price, quantity)
+		VALUES (1, 'BTCUSDT', 'BUY', 'LIMIT', 'FILLED', 10, 2), (2, 'BTCUSDT', 'SELL', 'LIMIT', 'NEW', 12, 2)`).Error)
+
+	repo, err := FromSQL(sqlite.Open(file), &gorm.Config{})
+	require.NoError(t, err)
+
+	orders, err := repo.Orders()
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	require.Equal(t, 2.0, orders[0].Executed)
+	require.Zero(t, orders[1].Executed)
+	require.Equal(t, model.PositionSideType(""), orders[1].PositionSide)
+
+	// the database is opened again without applying the migrations twice
+	_, err = FromSQL(sqlite.Open(file), &gorm.Config{})
+	require.NoError(t, err)
+}
@@ -0,0 +1,2 @@
+-- candles stored before candle metadata have no metadata
+UPDATE candle_records SET metadata = '' WHERE metadata IS NULL;
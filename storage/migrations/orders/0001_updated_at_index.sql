@@ -0,0 +1,3 @@
+-- order history queries filter and sort by update time
+CREATE INDEX idx_orders_updated_at ON orders (updated_at);
+CREATE INDEX idx_orders_pair_status ON orders (pair, status);
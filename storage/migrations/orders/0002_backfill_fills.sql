@@ -0,0 +1,4 @@
+-- orders stored before partial fills and hedge mode have no executed quantity and position side
+UPDATE orders SET executed = quantity WHERE status = 'FILLED' AND (executed IS NULL OR executed = 0);
+UPDATE orders SET executed = 0 WHERE executed IS NULL;
+UPDATE orders SET position_side = '' WHERE position_side IS NULL;
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// OrderQuery selects orders by their fields and update time, with pagination. Empty fields do not filter.
+type OrderQuery struct {
+	Pairs    []string
+	Statuses []model.OrderStatusType
+	Side     model.SideType
+	// Since and Until restrict the update time of the orders to [Since, Until)
+	Since time.Time
+	Until time.Time
+	// Offset skips the first orders of the result and Limit restricts the size of a page, zero for no limit
+	Offset int
+	Limit  int
+	// Descending returns the most recent orders first
+	Descending bool
+	// Session defines the days of DailyProfits, default: UTC days starting at 00:00
+	Session model.Session
+}
+
+// OrderPage is a page of the orders of a query and the total of orders matched by the query
+type OrderPage struct {
+	Orders []*model.Order
+	Total  int
+}
+
+// Profit is the realized profit of the trades of a pair closed in a day
+type Profit struct {
+	Day    time.Time
+	Pair   string
+	Value  float64
+	Trades int
+	Wins   int
+}
+
+// QueryStorage answers queries on the history of orders without loading all the orders in memory,
+// eg: for dashboards or "trades closed this week". It is implemented by the built-in storages.
+type QueryStorage interface {
+	QueryOrders(query OrderQuery) (OrderPage, error)
+	// DailyProfits returns the realized profits of filled orders of the query by day of the query session,
+	// and pair.
+	// The average cost of the positions is computed from the first fill, whatever the query period.
+	DailyProfits(query OrderQuery) ([]Profit, error)
+}
+
+// match returns if an order matches the filters of a query, except the time range
+func (q OrderQuery) match(order *model.Order) bool {
+	if len(q.Pairs) > 0 && !contains(q.Pairs, order.Pair) {
+		return false
+	}
+	if len(q.Statuses) > 0 && !contains(q.Statuses, order.Status) {
+		return false
+	}
+	return q.Side == "" || q.Side == order.Side
+}
+
+// inPeriod returns if a time is in the period of a query
+func (q OrderQuery) inPeriod(t time.Time) bool {
+	return (q.Since.IsZero() || !t.Before(q.Since)) && (q.Until.IsZero() || t.Before(q.Until))
+}
+
+func contains[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// orderScan iterates orders in ascending update time. The scan may skip the orders updated after until,
+// when it is not zero.
+type orderScan func(until time.Time, callback func(order *model.Order)) error
+
+// pageOrders runs a query over a scan, keeping only the orders of the page
+func pageOrders(scan orderScan, query OrderQuery) (OrderPage, error) {
+	page := OrderPage{Orders: make([]*model.Order, 0)}
+	window := make([]*model.Order, 0)
+	err := scan(query.Until, func(order *model.Order) {
+		if !query.inPeriod(order.UpdatedAt) || !query.match(order) {
+			return
+		}
+
+		page.Total++
+		if query.Descending {
+			// keep the last orders in a sliding window of offset + limit orders
+			window = append(window, order)
+			if query.Limit > 0 && len(window) > query.Offset+query.Limit {
+				window = window[1:]
+			}
+			return
+		}
+
+		if page.Total > query.Offset && (query.Limit <= 0 || len(page.Orders) < query.Limit) {
+			page.Orders = append(page.Orders, order)
+		}
+	})
+	if err != nil {
+		return page, err
+	}
+
+	if query.Descending {
+		for i := len(window) - 1 - query.Offset; i >= 0; i-- {
+			if query.Limit > 0 && len(page.Orders) == query.Limit {
+				break
+			}
+			page.Orders = append(page.Orders, window[i])
+		}
+	}
+	return page, nil
+}
+
+// position is the average cost of the open position of a pair, negative quantities are short positions
+type position struct {
+	quantity float64
+	avgPrice float64
+}
+
+// dailyProfits replays the filled orders of a scan to compute the realized profits of the query period
+func dailyProfits(scan orderScan, query OrderQuery) ([]Profit, error) {
+	positions := make(map[string]*position)
+	profits := make(map[string]*Profit)
+	err := scan(query.Until, func(order *model.Order) {
+		if order.Status != model.OrderStatusTypeFilled {
+			return
+		}
+		if len(query.Pairs) > 0 && !contains(query.Pairs, order.Pair) {
+			return
+		}
+
+		pos, ok := positions[order.Pair]
+		if !ok {
+			pos = &position{}
+			positions[order.Pair] = pos
+		}
+
+		value, closed := pos.update(order)
+		if closed == 0 || !query.inPeriod(order.UpdatedAt) {
+			return
+		}
+
+		day := query.Session.Day(order.UpdatedAt)
+		key := day.Format("2006-01-02") + order.Pair
+		profit, ok := profits[key]
+		if !ok {
+			profit = &Profit{Day: day, Pair: order.Pair}
+			profits[key] = profit
+		}
+		profit.Value += value
+		profit.Trades++
+		if value >= 0 {
+			profit.Wins++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Profit, 0, len(profits))
+	for _, profit := range profits {
+		result = append(result, *profit)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Day.Equal(result[j].Day) {
+			return result[i].Pair < result[j].Pair
+		}
+		return result[i].Day.Before(result[j].Day)
+	})
+	return result, nil
+}
+
+// update applies a fill to the position and returns the realized profit and the closed quantity
+func (p *position) update(order *model.Order) (profit, closed float64) {
+	price := order.Price
+	if order.Stop != nil && (order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit) {
+		price = *order.Stop
+	}
+
+	quantity := order.Quantity
+	if order.Executed > 0 {
+		quantity = order.Executed
+	}
+	if order.Side == model.SideTypeSell {
+		quantity = -quantity
+	}
+
+	// same direction of the position: increase it with the average price
+	if p.quantity == 0 || (p.quantity > 0) == (quantity > 0) {
+		size := math.Abs(p.quantity)
+		p.avgPrice = (p.avgPrice*size + price*math.Abs(quantity)) / (size + math.Abs(quantity))
+		p.quantity += quantity
+		return 0, 0
+	}
+
+	closed = math.Min(math.Abs(p.quantity), math.Abs(quantity))
+	profit = (price - p.avgPrice) * closed
+	if p.quantity < 0 {
+		profit = -profit
+	}
+
+	p.quantity += quantity
+	if math.Abs(p.quantity) < 1e-12 {
+		p.quantity = 0
+	} else if (p.quantity > 0) == (quantity > 0) {
+		// the fill reversed the position
+		p.avgPrice = price
+	}
+	return profit, closed
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+const defaultRedisPrefix = "ninjabot:"
+
+// Redis stores orders and state in Redis, eg: to share the orders of the bot with other services in real
+// time. Orders are JSON values indexed by update time, and final orders can expire after an archive TTL.
+type Redis struct {
+	ctx    context.Context
+	client *redis.Client
+
+	// Prefix is prepended to all the keys, default: ninjabot:
+	Prefix string
+	// ArchiveTTL expires filled, canceled, rejected and expired orders after a duration, disabled by default
+	ArchiveTTL time.Duration
+	// Channel publishes the JSON of created and updated orders, disabled by default
+	Channel string
+}
+
+type RedisOption func(*Redis)
+
+// WithRedisPrefix prepends a prefix to the keys, eg: to share a database between bots
+func WithRedisPrefix(prefix string) RedisOption {
+	return func(r *Redis) {
+		r.Prefix = prefix
+	}
+}
+
+// WithRedisArchiveTTL expires orders in a final status after the TTL, keeping only recent and open orders
+func WithRedisArchiveTTL(ttl time.Duration) RedisOption {
+	return func(r *Redis) {
+		r.ArchiveTTL = ttl
+	}
+}
+
+// WithRedisNotifications publishes the JSON of created and updated orders to a pub/sub channel
+func WithRedisNotifications(channel string) RedisOption {
+	return func(r *Redis) {
+		r.Channel = channel
+	}
+}
+
+// FromRedis creates a storage in a Redis database. Example of usage:
+//
+//	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	storage, err := storage.FromRedis(client, storage.WithRedisNotifications("orders"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+func FromRedis(client *redis.Client, options ...RedisOption) (Storage, error) {
+	storage := &Redis{
+		ctx:    context.Background(),
+		client: client,
+		Prefix: defaultRedisPrefix,
+	}
+	for _, option := range options {
+		option(storage)
+	}
+
+	if err := client.Ping(storage.ctx).Err(); err != nil {
+		return nil, err
+	}
+	return storage, nil
+}
+
+func (r *Redis) orderKey(id int64) string {
+	return r.Prefix + "order:" + strconv.FormatInt(id, 10)
+}
+
+// indexKey is the sorted set of order IDs by update time
+func (r *Redis) indexKey() string {
+	return r.Prefix + "orders"
+}
+
+func (r *Redis) CreateOrder(order *model.Order) error {
+	id, err := r.client.Incr(r.ctx, r.Prefix+"order:id").Result()
+	if err != nil {
+		return err
+	}
+	order.ID = id
+	return r.save(order)
+}
+
+func (r *Redis) UpdateOrder(order *model.Order) error {
+	return r.save(order)
+}
+
+func (r *Redis) save(order *model.Order) error {
+	content, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	var ttl time.Duration
+	if r.ArchiveTTL > 0 && finalStatus(order.Status) {
+		ttl = r.ArchiveTTL
+	}
+
+	_, err = r.client.TxPipelined(r.ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(r.ctx, r.orderKey(order.ID), content, ttl)
+		pipe.ZAdd(r.ctx, r.indexKey(), redis.Z{
+			Score:  float64(order.UpdatedAt.UnixNano()),
+			Member: order.ID,
+		})
+		if r.Channel != "" {
+			pipe.Publish(r.ctx, r.Channel, content)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *Redis) Orders(filters ...OrderFilter) ([]*model.Order, error) {
+	ids, err := r.client.ZRange(r.ctx, r.indexKey(), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	orders := make([]*model.Order, 0, len(ids))
+	if len(ids) == 0 {
+		return orders, nil
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, r.Prefix+"order:"+id)
+	}
+	values, err := r.client.MGet(r.ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	archived := make([]interface{}, 0)
+	for i, value := range values {
+		content, ok := value.(string)
+		if !ok {
+			// expired by the archive TTL
+			archived = append(archived, ids[i])
+			continue
+		}
+
+		var order model.Order
+		if err := json.Unmarshal([]byte(content), &order); err != nil {
+			return nil, err
+		}
+
+		if matchFilters(order, filters) {
+			orders = append(orders, &order)
+		}
+	}
+
+	if len(archived) > 0 {
+		if err := r.client.ZRem(r.ctx, r.indexKey(), archived...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+func (r *Redis) QueryOrders(query OrderQuery) (OrderPage, error) {
+	return pageOrders(r.scan, query)
+}
+
+func (r *Redis) DailyProfits(query OrderQuery) ([]Profit, error) {
+	return dailyProfits(r.scan, query)
+}
+
+// scan reads the orders updated before until from the index in chunks, skipping the archived orders
+func (r *Redis) scan(until time.Time, callback func(order *model.Order)) error {
+	max := "+inf"
+	if !until.IsZero() {
+		max = "(" + strconv.FormatInt(until.UnixNano(), 10)
+	}
+
+	const chunk = 500
+	for offset := int64(0); ; offset += chunk {
+		ids, err := r.client.ZRangeByScore(r.ctx, r.indexKey(), &redis.ZRangeBy{
+			Min: "-inf", Max: max, Offset: offset, Count: chunk,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		keys := make([]string, 0, len(ids))
+		for _, id := range ids {
+			keys = append(keys, r.Prefix+"order:"+id)
+		}
+		values, err := r.client.MGet(r.ctx, keys...).Result()
+		if err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			content, ok := value.(string)
+			if !ok {
+				continue
+			}
+
+			var order model.Order
+			if err := json.Unmarshal([]byte(content), &order); err != nil {
+				return err
+			}
+			callback(&order)
+		}
+
+		if len(ids) < chunk {
+			return nil
+		}
+	}
+}
+
+func (r *Redis) SaveState(key string, value []byte) error {
+	return r.client.Set(r.ctx, r.Prefix+statePrefix+key, value, 0).Err()
+}
+
+func (r *Redis) LoadState(key string) ([]byte, error) {
+	value, err := r.client.Get(r.ctx, r.Prefix+statePrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrStateNotFound
+	}
+	return value, err
+}
+
+func matchFilters(order model.Order, filters []OrderFilter) bool {
+	for _, filter := range filters {
+		if !filter(order) {
+			return false
+		}
+	}
+	return true
+}
+
+// finalStatus returns if an order can not change anymore
+func finalStatus(status model.OrderStatusType) bool {
+	switch status {
+	case model.OrderStatusTypeFilled, model.OrderStatusTypeCanceled, model.OrderStatusTypeRejected,
+		model.OrderStatusTypeExpired:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func newTestRedis(t *testing.T, options ...RedisOption) (Storage, *miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	repo, err := FromRedis(client, options...)
+	require.NoError(t, err)
+	return repo, server, client
+}
+
+func TestFromRedis(t *testing.T) {
+	repo, _, _ := newTestRedis(t)
+
+	storageUseCase(repo, t)
+	stateUseCase(repo, t)
+}
+
+func TestRedis_ArchiveTTL(t *testing.T) {
+	repo, server, _ := newTestRedis(t, WithRedisPrefix("bot:"), WithRedisArchiveTTL(time.Hour))
+
+	now := time.Now()
+	open := &model.Order{Pair: "BTCUSDT", Status: model.OrderStatusTypeNew, UpdatedAt: now}
+	filled := &model.Order{Pair: "BTCUSDT", Status: model.OrderStatusTypeNew, UpdatedAt: now}
+	require.NoError(t, repo.CreateOrder(open))
+	require.NoError(t, repo.CreateOrder(filled))
+
+	filled.Status = model.OrderStatusTypeFilled
+	filled.UpdatedAt = now.Add(time.Minute)
+	require.NoError(t, repo.UpdateOrder(filled))
+	require.True(t, server.Exists("bot:order:2"))
+	require.Equal(t, time.Hour, server.TTL("bot:order:2"))
+	require.Zero(t, server.TTL("bot:order:1"))
+
+	// final orders are archived after the TTL
+	server.FastForward(time.Hour)
+	orders, err := repo.Orders()
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, open.ID, orders[0].ID)
+
+	members, err := server.ZMembers("bot:orders")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1"}, members)
+}
+
+func TestRedis_Notifications(t *testing.T) {
+	repo, _, client := newTestRedis(t, WithRedisNotifications("orders"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	subscription := client.Subscribe(ctx, "orders")
+	defer subscription.Close()
+	_, err := subscription.Receive(ctx)
+	require.NoError(t, err)
+
+	order := &model.Order{Pair: "BTCUSDT", Status: model.OrderStatusTypeNew, Price: 10}
+	require.NoError(t, repo.CreateOrder(order))
+	order.Status = model.OrderStatusTypeFilled
+	require.NoError(t, repo.UpdateOrder(order))
+
+	for _, status := range []model.OrderStatusType{model.OrderStatusTypeNew, model.OrderStatusTypeFilled} {
+		message, err := subscription.ReceiveMessage(ctx)
+		require.NoError(t, err)
+
+		var published model.Order
+		require.NoError(t, json.Unmarshal([]byte(message.Payload), &published))
+		require.Equal(t, order.ID, published.ID)
+		require.Equal(t, status, published.Status)
+	}
+}
+
+func TestRedis_Query(t *testing.T) {
+	repo, _, _ := newTestRedis(t)
+
+	queryUseCase(repo, t)
+}
@@ -13,7 +13,15 @@ type SQL struct {
 	db *gorm.DB
 }
 
-// FromSQL creates a new SQL connections for orders storage. Example of usage:
+// stateRecord is a key-value entry of the bot runtime state
+type stateRecord struct {
+	Key       string `gorm:"primaryKey"`
+	Value     []byte
+	UpdatedAt time.Time
+}
+
+// FromSQL creates a new SQL connections for orders storage. The tables are created or updated, and the
+// pending migrations of the orders schema are applied. Example of usage:
 //
 //	import "github.com/glebarez/sqlite"
 //	storage, err := storage.FromSQL(sqlite.Open("sqlite.db"), &gorm.Config{})
@@ -35,11 +43,15 @@ func FromSQL(dialect gorm.Dialector, opts ...gorm.Option) (Storage, error) {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
-	err = db.AutoMigrate(&model.Order{})
+	err = db.AutoMigrate(&model.Order{}, &stateRecord{})
 	if err != nil {
 		return nil, err
 	}
 
+	if err := migrate(db, "orders"); err != nil {
+		return nil, err
+	}
+
 	return &SQL{
 		db: db,
 	}, nil
@@ -78,3 +90,82 @@ func (s *SQL) Orders(filters ...OrderFilter) ([]*model.Order, error) {
 		return true
 	}), nil
 }
+
+// SaveState creates or replaces a state entry
+func (s *SQL) SaveState(key string, value []byte) error {
+	return s.db.Save(&stateRecord{Key: key, Value: value, UpdatedAt: time.Now()}).Error
+}
+
+// LoadState returns a state entry, or ErrStateNotFound
+func (s *SQL) LoadState(key string) ([]byte, error) {
+	var record stateRecord
+	result := s.db.Where(&stateRecord{Key: key}).Limit(1).Find(&record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrStateNotFound
+	}
+	return record.Value, nil
+}
+
+// QueryOrders runs a query in the database, with the pagination of the page
+func (s *SQL) QueryOrders(query OrderQuery) (OrderPage, error) {
+	page := OrderPage{Orders: make([]*model.Order, 0)}
+
+	var total int64
+	if err := s.where(query).Model(&model.Order{}).Count(&total).Error; err != nil {
+		return page, err
+	}
+	page.Total = int(total)
+
+	order := "updated_at, id"
+	if query.Descending {
+		order = "updated_at desc, id desc"
+	}
+	find := s.where(query).Order(order).Offset(query.Offset)
+	if query.Limit > 0 {
+		find = find.Limit(query.Limit)
+	}
+	if err := find.Find(&page.Orders).Error; err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+// DailyProfits replays the filled orders in batches to compute the realized profits of the query period
+func (s *SQL) DailyProfits(query OrderQuery) ([]Profit, error) {
+	return dailyProfits(func(until time.Time, callback func(order *model.Order)) error {
+		filled := OrderQuery{Pairs: query.Pairs, Statuses: []model.OrderStatusType{model.OrderStatusTypeFilled},
+			Until: until}
+
+		var orders []*model.Order
+		return s.where(filled).Order("updated_at, id").FindInBatches(&orders, 500, func(*gorm.DB, int) error {
+			for _, order := range orders {
+				callback(order)
+			}
+			return nil
+		}).Error
+	}, query)
+}
+
+// where returns a session with the filters of a query
+func (s *SQL) where(query OrderQuery) *gorm.DB {
+	db := s.db.Session(&gorm.Session{NewDB: true})
+	if len(query.Pairs) > 0 {
+		db = db.Where("pair IN ?", query.Pairs)
+	}
+	if len(query.Statuses) > 0 {
+		db = db.Where("status IN ?", query.Statuses)
+	}
+	if query.Side != "" {
+		db = db.Where("side = ?", query.Side)
+	}
+	if !query.Since.IsZero() {
+		db = db.Where("updated_at >= ?", query.Since)
+	}
+	if !query.Until.IsZero() {
+		db = db.Where("updated_at < ?", query.Until)
+	}
+	return db
+}
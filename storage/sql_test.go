@@ -2,6 +2,7 @@ package storage
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"gorm.io/gorm"
@@ -21,4 +22,12 @@ func TestFromSQL(t *testing.T) {
 	require.NoError(t, err)
 
 	storageUseCase(repo, t)
+	stateUseCase(repo, t)
+}
+
+func TestSQL_Query(t *testing.T) {
+	repo, err := FromSQL(sqlite.Open(filepath.Join(t.TempDir(), "query.db")), &gorm.Config{})
+	require.NoError(t, err)
+
+	queryUseCase(repo, t)
 }
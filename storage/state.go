@@ -0,0 +1,12 @@
+package storage
+
+import "errors"
+
+var ErrStateNotFound = errors.New("state not found")
+
+// StateStorage persists runtime state of the bot, eg: trailing stop levels or paused pairs, so the state
+// can be restored after a crash or redeploy. It is implemented by the built-in storages.
+type StateStorage interface {
+	SaveState(key string, value []byte) error
+	LoadState(key string) ([]byte, error)
+}
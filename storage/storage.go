@@ -37,6 +37,12 @@ func WithPair(pair string) OrderFilter {
 	}
 }
 
+func WithExchangeID(id int64) OrderFilter {
+	return func(order model.Order) bool {
+		return order.ExchangeID == id
+	}
+}
+
 func WithUpdateAtBeforeOrEqual(time time.Time) OrderFilter {
 	return func(order model.Order) bool {
 		return !order.UpdatedAt.After(time)
@@ -82,3 +82,111 @@ func storageUseCase(repo Storage, t *testing.T) {
 		require.Equal(t, firstOrder.Quantity, orders[0].Quantity)
 	})
 }
+
+func stateUseCase(repo Storage, t *testing.T) {
+	t.Helper()
+	state, ok := repo.(StateStorage)
+	require.True(t, ok)
+
+	_, err := state.LoadState("controller")
+	require.ErrorIs(t, err, ErrStateNotFound)
+
+	require.NoError(t, state.SaveState("controller", []byte(`{"paused":true}`)))
+	require.NoError(t, state.SaveState("controller", []byte(`{"paused":false}`)))
+
+	value, err := state.LoadState("controller")
+	require.NoError(t, err)
+	require.Equal(t, `{"paused":false}`, string(value))
+
+	// state entries are not listed as orders
+	orders, err := repo.Orders()
+	require.NoError(t, err)
+	for _, order := range orders {
+		require.NotZero(t, order.ID)
+	}
+}
+
+func queryUseCase(repo Storage, t *testing.T) {
+	t.Helper()
+	query, ok := repo.(QueryStorage)
+	require.True(t, ok)
+
+	day := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	orders := []*model.Order{
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Status: model.OrderStatusTypeFilled, Price: 10, Quantity: 1,
+			UpdatedAt: day},
+		{Pair: "BTCUSDT", Side: model.SideTypeSell, Status: model.OrderStatusTypeFilled, Price: 15, Quantity: 1,
+			UpdatedAt: day.Add(12 * time.Hour)},
+		{Pair: "ETHUSDT", Side: model.SideTypeSell, Status: model.OrderStatusTypeFilled, Price: 100, Quantity: 2,
+			UpdatedAt: day.Add(13 * time.Hour)},
+		{Pair: "ETHUSDT", Side: model.SideTypeBuy, Status: model.OrderStatusTypeFilled, Price: 110, Quantity: 2,
+			UpdatedAt: day.Add(25 * time.Hour)},
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Status: model.OrderStatusTypeCanceled, Price: 20, Quantity: 1,
+			UpdatedAt: day.Add(26 * time.Hour)},
+		{Pair: "BTCUSDT", Side: model.SideTypeBuy, Status: model.OrderStatusTypeFilled, Price: 10, Quantity: 2,
+			UpdatedAt: day.Add(27 * time.Hour)},
+		{Pair: "BTCUSDT", Side: model.SideTypeSell, Status: model.OrderStatusTypeFilled, Price: 12, Quantity: 2,
+			Executed: 1, UpdatedAt: day.Add(28 * time.Hour)},
+	}
+	for _, order := range orders {
+		order.CreatedAt = order.UpdatedAt
+		require.NoError(t, repo.CreateOrder(order))
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		page, err := query.QueryOrders(OrderQuery{Pairs: []string{"BTCUSDT"}, Offset: 1, Limit: 2})
+		require.NoError(t, err)
+		require.Equal(t, 5, page.Total)
+		require.Len(t, page.Orders, 2)
+		require.Equal(t, orders[1].ID, page.Orders[0].ID)
+		require.Equal(t, orders[4].ID, page.Orders[1].ID)
+
+		page, err = query.QueryOrders(OrderQuery{Pairs: []string{"BTCUSDT"}, Limit: 2, Descending: true})
+		require.NoError(t, err)
+		require.Equal(t, 5, page.Total)
+		require.Len(t, page.Orders, 2)
+		require.Equal(t, orders[6].ID, page.Orders[0].ID)
+		require.Equal(t, orders[5].ID, page.Orders[1].ID)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		page, err := query.QueryOrders(OrderQuery{
+			Statuses: []model.OrderStatusType{model.OrderStatusTypeFilled},
+			Side:     model.SideTypeBuy,
+			Since:    day.Add(24 * time.Hour),
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, page.Total)
+		require.Equal(t, orders[3].ID, page.Orders[0].ID)
+		require.Equal(t, orders[5].ID, page.Orders[1].ID)
+
+		page, err = query.QueryOrders(OrderQuery{Until: day.Add(12 * time.Hour)})
+		require.NoError(t, err)
+		require.Equal(t, 1, page.Total)
+		require.Equal(t, orders[0].ID, page.Orders[0].ID)
+	})
+
+	t.Run("daily profits", func(t *testing.T) {
+		profits, err := query.DailyProfits(OrderQuery{})
+		require.NoError(t, err)
+		require.Equal(t, []Profit{
+			{Day: day, Pair: "BTCUSDT", Value: 5, Trades: 1, Wins: 1},
+			{Day: day.Add(24 * time.Hour), Pair: "BTCUSDT", Value: 2, Trades: 1, Wins: 1},
+			{Day: day.Add(24 * time.Hour), Pair: "ETHUSDT", Value: -20, Trades: 1},
+		}, profits)
+
+		// the short position of the first day is closed in the period
+		profits, err = query.DailyProfits(OrderQuery{Pairs: []string{"ETHUSDT"}, Since: day.Add(24 * time.Hour)})
+		require.NoError(t, err)
+		require.Equal(t, []Profit{{Day: day.Add(24 * time.Hour), Pair: "ETHUSDT", Value: -20, Trades: 1}}, profits)
+
+		// days starting at 13:00
+		profits, err = query.DailyProfits(OrderQuery{Session: model.Session{DayStart: 13 * time.Hour}})
+		require.NoError(t, err)
+		require.Equal(t, []Profit{
+			{Day: day.Add(-11 * time.Hour), Pair: "BTCUSDT", Value: 5, Trades: 1, Wins: 1},
+			{Day: day.Add(13 * time.Hour), Pair: "BTCUSDT", Value: 2, Trades: 1, Wins: 1},
+			{Day: day.Add(13 * time.Hour), Pair: "ETHUSDT", Value: -20, Trades: 1},
+		}, profits)
+	})
+}
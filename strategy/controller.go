@@ -1,17 +1,29 @@
 package strategy
 
 import (
+	"math"
+	"sync"
+
 	log "github.com/sirupsen/logrus"
 
+	"github.com/bengalm/ninjabot/calendar"
 	"github.com/bengalm/ninjabot/model"
 	"github.com/bengalm/ninjabot/service"
 )
 
 type Controller struct {
+	mtx       sync.Mutex
 	strategy  Strategy
 	dataframe *model.Dataframe
+	frames    map[string]*model.Dataframe
+	last      *model.Dataframe
 	broker    service.Broker
 	started   bool
+	calendar  *calendar.Calendar
+	lastEvent string
+	pauseMtx  sync.RWMutex
+	pause     model.PauseMode
+	updates   *updateQueue
 }
 
 func NewStrategyController(pair string, strategy Strategy, broker service.Broker) *Controller {
@@ -20,66 +32,261 @@ func NewStrategyController(pair string, strategy Strategy, broker service.Broker
 		Metadata: make(map[string]model.Series[float64]),
 	}
 
+	frames := make(map[string]*model.Dataframe)
+	for _, timeframe := range Timeframes(strategy) {
+		frames[timeframe] = &model.Dataframe{
+			Pair:     pair,
+			Metadata: make(map[string]model.Series[float64]),
+		}
+	}
+	if len(frames) > 0 {
+		dataframe.Timeframes = frames
+	}
+
 	return &Controller{
 		dataframe: dataframe,
+		frames:    frames,
 		strategy:  strategy,
 		broker:    broker,
+		updates:   newUpdateQueue(),
+	}
+}
+
+// Timeframes returns the additional timeframes of a strategy, without the main timeframe
+func Timeframes(strategy Strategy) []string {
+	str, ok := strategy.(MultiTimeframeStrategy)
+	if !ok {
+		return nil
+	}
+
+	timeframes := make([]string, 0)
+	for _, timeframe := range str.Timeframes() {
+		if timeframe != strategy.Timeframe() {
+			timeframes = append(timeframes, timeframe)
+		}
+	}
+	return timeframes
+}
+
+// Timeframe returns the main timeframe of the current strategy
+func (s *Controller) Timeframe() string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.strategy.Timeframe()
+}
+
+// WarmupPeriod returns the warmup period of the current strategy
+func (s *Controller) WarmupPeriod() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.strategy.WarmupPeriod()
+}
+
+// Dataframe returns the last dataframe given to the strategy, with indicator values.
+// It returns false while the strategy is in the warmup period.
+func (s *Controller) Dataframe() (model.Dataframe, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.last == nil {
+		return model.Dataframe{}, false
 	}
+	return *s.last, true
 }
 
 func (s *Controller) Start() {
 	s.started = true
+	s.updates.start.Do(func() {
+		go s.dispatchUpdates()
+	})
+}
+
+// Pause stops the strategy at runtime. With PauseEntries, the strategy keeps running but orders that open
+// or increase positions are rejected. With PauseAll, the strategy is not executed, only indicators are updated.
+func (s *Controller) Pause(mode model.PauseMode) {
+	s.pauseMtx.Lock()
+	defer s.pauseMtx.Unlock()
+	s.pause = mode
+}
+
+// Resume enables the strategy execution
+func (s *Controller) Resume() {
+	s.Pause(model.PauseNone)
+}
+
+// PauseMode returns the current pause mode of the strategy
+func (s *Controller) PauseMode() model.PauseMode {
+	s.pauseMtx.RLock()
+	defer s.pauseMtx.RUnlock()
+	return s.pause
+}
+
+// activeBroker returns the broker given to the strategy, or false when the strategy is paused
+func (s *Controller) activeBroker() (service.Broker, bool) {
+	switch s.PauseMode() {
+	case model.PauseAll:
+		return nil, false
+	case model.PauseEntries:
+		return exitOnlyBroker{s.broker}, true
+	}
+	return s.broker, true
+}
+
+// SetCalendar sets an event calendar, the strategy stands down during the blackout window of events
+func (s *Controller) SetCalendar(cal *calendar.Calendar) {
+	s.calendar = cal
+}
+
+// blackout checks if the candle is in an event blackout, notifying the strategy when a new event starts
+func (s *Controller) blackout(candle model.Candle, df *model.Dataframe) bool {
+	if s.calendar == nil {
+		return false
+	}
+
+	event, ok := s.calendar.Blackout(candle.Pair, candle.Time)
+	if !ok {
+		return false
+	}
+
+	if event.ID != s.lastEvent {
+		s.lastEvent = event.ID
+		log.Infof("[CALENDAR] %s: standing down for %s at %s", candle.Pair, event.Name, event.Time)
+		if str, ok := s.strategy.(EventStrategy); ok && s.started {
+			str.OnEvent(event, df, s.broker)
+		}
+	}
+
+	return true
 }
 
 func (s *Controller) OnPartialCandle(candle model.Candle) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.mainTimeframe(candle) {
+		return
+	}
+
 	if !candle.Complete && len(s.dataframe.Close) >= s.strategy.WarmupPeriod() {
 		if str, ok := s.strategy.(HighFrequencyStrategy); ok {
-			s.updateDataFrame(candle)
+			updateDataFrame(s.dataframe, candle)
 			str.Indicators(s.dataframe)
-			str.OnPartialCandle(s.dataframe, s.broker)
+			if s.blackout(candle, s.dataframe) {
+				return
+			}
+			if broker, ok := s.activeBroker(); ok {
+				str.OnPartialCandle(s.dataframe, broker)
+			}
 		}
 	}
 }
 
-func (s *Controller) updateDataFrame(candle model.Candle) {
-	if len(s.dataframe.Time) > 0 && candle.Time.Equal(s.dataframe.Time[len(s.dataframe.Time)-1]) {
-		last := len(s.dataframe.Time) - 1
-		s.dataframe.Close[last] = candle.Close
-		s.dataframe.Open[last] = candle.Open
-		s.dataframe.High[last] = candle.High
-		s.dataframe.Low[last] = candle.Low
-		s.dataframe.Volume[last] = candle.Volume
-		s.dataframe.Time[last] = candle.Time
+// mainTimeframe checks if a candle is from the main timeframe of the strategy, candles without timeframe
+// are from the main timeframe
+func (s *Controller) mainTimeframe(candle model.Candle) bool {
+	return candle.Timeframe == "" || candle.Timeframe == s.strategy.Timeframe()
+}
+
+// onTimeframeCandle updates the dataframe of an additional timeframe with a complete candle
+func (s *Controller) onTimeframeCandle(candle model.Candle) {
+	df, ok := s.frames[candle.Timeframe]
+	if !ok {
+		return
+	}
+
+	if len(df.Time) > 0 && candle.Time.Before(df.Time[len(df.Time)-1]) {
+		log.Errorf("late candle received: %#v", candle)
+		return
+	}
+	updateDataFrame(df, candle)
+}
+
+// sampleTimeframes returns the last candles of the additional timeframes, up to the warmup period
+func (s *Controller) sampleTimeframes() map[string]*model.Dataframe {
+	if len(s.frames) == 0 {
+		return nil
+	}
+
+	frames := make(map[string]*model.Dataframe, len(s.frames))
+	for timeframe, df := range s.frames {
+		sample := df.Sample(s.strategy.WarmupPeriod())
+		frames[timeframe] = &sample
+	}
+	return frames
+}
+
+func updateDataFrame(df *model.Dataframe, candle model.Candle) {
+	if len(df.Time) > 0 && candle.Time.Equal(df.Time[len(df.Time)-1]) {
+		last := len(df.Time) - 1
+		df.Close[last] = candle.Close
+		df.Open[last] = candle.Open
+		df.High[last] = candle.High
+		df.Low[last] = candle.Low
+		df.Volume[last] = candle.Volume
+		df.Time[last] = candle.Time
 		for k, v := range candle.Metadata {
-			s.dataframe.Metadata[k][last] = v
+			padMetadata(df, k, len(df.Time))
+			df.Metadata[k][last] = v
 		}
 	} else {
-		s.dataframe.Close = append(s.dataframe.Close, candle.Close)
-		s.dataframe.Open = append(s.dataframe.Open, candle.Open)
-		s.dataframe.High = append(s.dataframe.High, candle.High)
-		s.dataframe.Low = append(s.dataframe.Low, candle.Low)
-		s.dataframe.Volume = append(s.dataframe.Volume, candle.Volume)
-		s.dataframe.Time = append(s.dataframe.Time, candle.Time)
-		s.dataframe.LastUpdate = candle.Time
+		df.Close = append(df.Close, candle.Close)
+		df.Open = append(df.Open, candle.Open)
+		df.High = append(df.High, candle.High)
+		df.Low = append(df.Low, candle.Low)
+		df.Volume = append(df.Volume, candle.Volume)
+		df.Time = append(df.Time, candle.Time)
+		df.LastUpdate = candle.Time
 		for k, v := range candle.Metadata {
-			s.dataframe.Metadata[k] = append(s.dataframe.Metadata[k], v)
+			padMetadata(df, k, len(df.Time)-1)
+			df.Metadata[k] = append(df.Metadata[k], v)
+		}
+
+		// flag missing metadata, keeping all series aligned with candles
+		for k := range df.Metadata {
+			if _, ok := candle.Metadata[k]; !ok && len(df.Metadata[k]) < len(df.Time) {
+				df.Metadata[k] = append(df.Metadata[k], math.NaN())
+			}
 		}
 	}
 }
 
+// padMetadata flags the missing values of a metadata key with NaN up to a length, so keys first seen in the
+// middle of a run, eg: from async fetchers, stay aligned with the candles
+func padMetadata(df *model.Dataframe, key string, length int) {
+	for len(df.Metadata[key]) < length {
+		df.Metadata[key] = append(df.Metadata[key], math.NaN())
+	}
+}
+
 func (s *Controller) OnCandle(candle model.Candle) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if !s.mainTimeframe(candle) {
+		s.onTimeframeCandle(candle)
+		return
+	}
+
 	if len(s.dataframe.Time) > 0 && candle.Time.Before(s.dataframe.Time[len(s.dataframe.Time)-1]) {
 		log.Errorf("late candle received: %#v", candle)
 		return
 	}
 
-	s.updateDataFrame(candle)
+	updateDataFrame(s.dataframe, candle)
 
 	if len(s.dataframe.Close) >= s.strategy.WarmupPeriod() {
 		sample := s.dataframe.Sample(s.strategy.WarmupPeriod())
+		sample.Timeframes = s.sampleTimeframes()
 		s.strategy.Indicators(&sample)
-		if s.started {
-			s.strategy.OnCandle(&sample, s.broker)
+		s.last = &sample
+		// a repaired bar replaces the last bar, the strategy was already executed with it
+		if candle.Repaired {
+			return
+		}
+		if s.blackout(candle, &sample) {
+			return
+		}
+		if broker, ok := s.activeBroker(); ok && s.started {
+			s.strategy.OnCandle(&sample, broker)
 		}
 	}
 }
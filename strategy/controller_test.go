@@ -0,0 +1,76 @@
+package strategy
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+type countingStrategy struct {
+	fakeStrategy
+	executions int
+}
+
+func (c *countingStrategy) OnCandle(_ *model.Dataframe, _ service.Broker) {
+	c.executions++
+}
+
+func TestController_OnCandleRepaired(t *testing.T) {
+	str := &countingStrategy{fakeStrategy: fakeStrategy{timeframe: "1h"}}
+	controller := NewStrategyController("BTCUSDT", str, nil)
+	controller.Start()
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start, Close: 1, Complete: true})
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Close: 2, Complete: true})
+	require.Equal(t, 2, str.executions)
+
+	// the repaired bar replaces the last bar without executing the strategy again
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Hour), Close: 3, Complete: true,
+		Repaired: true})
+	require.Equal(t, 2, str.executions)
+
+	require.Len(t, controller.dataframe.Close, 2)
+	df, ok := controller.Dataframe()
+	require.True(t, ok)
+	require.Equal(t, 3.0, df.Close.Last(0))
+}
+
+func TestUpdateDataFrame_NewMetadata(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(i int, complete bool, metadata map[string]float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(i) * time.Hour), Close: float64(i),
+			Complete: complete, Metadata: metadata}
+	}
+
+	t.Run("complete candle", func(t *testing.T) {
+		df := &model.Dataframe{Pair: "BTCUSDT", Metadata: make(map[string]model.Series[float64])}
+		updateDataFrame(df, candle(0, true, nil))
+		updateDataFrame(df, candle(1, true, nil))
+		updateDataFrame(df, candle(2, true, map[string]float64{"sentiment": 0.5}))
+		updateDataFrame(df, candle(3, true, nil))
+
+		require.Len(t, df.Metadata["sentiment"], 4)
+		require.True(t, math.IsNaN(df.Metadata["sentiment"][0]))
+		require.True(t, math.IsNaN(df.Metadata["sentiment"][1]))
+		require.Equal(t, 0.5, df.Metadata["sentiment"][2])
+		require.True(t, math.IsNaN(df.Metadata["sentiment"][3]))
+	})
+
+	t.Run("partial candle", func(t *testing.T) {
+		df := &model.Dataframe{Pair: "BTCUSDT", Metadata: make(map[string]model.Series[float64])}
+		updateDataFrame(df, candle(0, true, nil))
+		updateDataFrame(df, candle(1, false, nil))
+		updateDataFrame(df, candle(1, false, map[string]float64{"sentiment": 0.5}))
+		updateDataFrame(df, candle(1, true, map[string]float64{"sentiment": 0.7}))
+
+		require.Len(t, df.Metadata["sentiment"], 2)
+		require.True(t, math.IsNaN(df.Metadata["sentiment"][0]))
+		require.Equal(t, 0.7, df.Metadata["sentiment"][1])
+	})
+}
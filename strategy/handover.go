@@ -0,0 +1,91 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+var ErrTimeframeMismatch = errors.New("strategy timeframe mismatch")
+
+// Handover contains the state transferred from a replaced strategy to the new one.
+// Positions and orders are kept open in the exchange, the new strategy is responsible to manage them.
+type Handover struct {
+	Pair string
+	// Asset and Quote are the current position of the pair
+	Asset float64
+	Quote float64
+	// OpenOrders are the pending orders of the pair, eg: stop loss or take profit of the position
+	OpenOrders []model.Order
+	// State is the custom state returned by the old strategy in `Drain`
+	State map[string]interface{}
+}
+
+type DrainStrategy interface {
+	Strategy
+
+	// Drain will be executed once before the strategy is replaced at runtime. The strategy should stop
+	// creating new orders and return any internal state needed to manage open positions, eg: trailing levels.
+	Drain(df *model.Dataframe, broker service.Broker) map[string]interface{}
+}
+
+type HandoverStrategy interface {
+	Strategy
+
+	// OnHandover will be executed once after the strategy replaces another one at runtime, before the next candle.
+	OnHandover(handover Handover, df *model.Dataframe, broker service.Broker)
+}
+
+// Swap replaces the strategy at runtime, keeping the dataframe, positions and orders of the pair.
+// The new strategy must have the same timeframes, since it continues on the same data feeds.
+func (s *Controller) Swap(strategy Strategy) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if strategy.Timeframe() != s.strategy.Timeframe() {
+		return fmt.Errorf("%w: %s != %s", ErrTimeframeMismatch, strategy.Timeframe(), s.strategy.Timeframe())
+	}
+	next, current := strings.Join(Timeframes(strategy), ","), strings.Join(Timeframes(s.strategy), ",")
+	if next != current {
+		return fmt.Errorf("%w: [%s] != [%s]", ErrTimeframeMismatch, next, current)
+	}
+
+	handover := Handover{Pair: s.dataframe.Pair}
+
+	var err error
+	handover.Asset, handover.Quote, err = s.broker.Position(s.dataframe.Pair)
+	if err != nil {
+		return err
+	}
+
+	handover.OpenOrders, err = s.broker.OpenOrders(s.dataframe.Pair)
+	if err != nil {
+		return err
+	}
+
+	if old, ok := s.strategy.(DrainStrategy); ok {
+		handover.State = old.Drain(s.dataframe, s.broker)
+	}
+
+	log.Infof("[STRATEGY] %s: replacing strategy, position %f with %d open orders",
+		s.dataframe.Pair, handover.Asset, len(handover.OpenOrders))
+
+	s.strategy = strategy
+	if len(s.dataframe.Close) >= s.strategy.WarmupPeriod() {
+		sample := s.dataframe.Sample(s.strategy.WarmupPeriod())
+		sample.Timeframes = s.sampleTimeframes()
+		s.strategy.Indicators(&sample)
+		if str, ok := s.strategy.(HandoverStrategy); ok {
+			str.OnHandover(handover, &sample, s.broker)
+		}
+	} else if str, ok := s.strategy.(HandoverStrategy); ok {
+		str.OnHandover(handover, s.dataframe, s.broker)
+	}
+
+	return nil
+}
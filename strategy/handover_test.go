@@ -0,0 +1,92 @@
+package strategy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+type fakeStrategy struct {
+	timeframe string
+	handover  *Handover
+}
+
+func (f *fakeStrategy) Timeframe() string {
+	return f.timeframe
+}
+
+func (f *fakeStrategy) WarmupPeriod() int {
+	return 1
+}
+
+func (f *fakeStrategy) Indicators(_ *model.Dataframe) []ChartIndicator {
+	return nil
+}
+
+func (f *fakeStrategy) OnCandle(_ *model.Dataframe, _ service.Broker) {}
+
+func (f *fakeStrategy) Drain(_ *model.Dataframe, _ service.Broker) map[string]interface{} {
+	return map[string]interface{}{"stop": 900.0}
+}
+
+func (f *fakeStrategy) OnHandover(handover Handover, _ *model.Dataframe, _ service.Broker) {
+	f.handover = &handover
+}
+
+func TestController_Swap(t *testing.T) {
+	wallet := exchange.NewPaperWallet(context.Background(), "USDT", exchange.WithPaperAsset("USDT", 3000))
+	wallet.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000})
+	_, err := wallet.CreateOrderMarket(model.SideTypeBuy, "BTCUSDT", 1, false)
+	require.NoError(t, err)
+	_, err = wallet.CreateOrderLimit(model.SideTypeSell, "BTCUSDT", 1, 1500)
+	require.NoError(t, err)
+
+	controller := NewStrategyController("BTCUSDT", &fakeStrategy{timeframe: "1h"}, wallet)
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000, Complete: true})
+
+	err = controller.Swap(&fakeStrategy{timeframe: "1d"})
+	require.ErrorIs(t, err, ErrTimeframeMismatch)
+
+	next := &fakeStrategy{timeframe: "1h"}
+	require.NoError(t, controller.Swap(next))
+	require.NotNil(t, next.handover)
+	require.Equal(t, 1.0, next.handover.Asset)
+	require.Len(t, next.handover.OpenOrders, 1)
+	require.Equal(t, 900.0, next.handover.State["stop"])
+}
+
+type fakeTrendStrategy struct {
+	fakeStrategy
+	timeframes []string
+}
+
+func (f *fakeTrendStrategy) Timeframes() []string {
+	return f.timeframes
+}
+
+func TestController_SwapTimeframes(t *testing.T) {
+	wallet := exchange.NewPaperWallet(context.Background(), "USDT", exchange.WithPaperAsset("USDT", 3000))
+	current := &fakeTrendStrategy{fakeStrategy: fakeStrategy{timeframe: "1h"}, timeframes: []string{"1h", "4h"}}
+	require.Equal(t, []string{"4h"}, Timeframes(current))
+
+	controller := NewStrategyController("BTCUSDT", current, wallet)
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1000, Timeframe: "4h", Complete: true})
+	_, ok := controller.Dataframe()
+	require.False(t, ok)
+
+	controller.OnCandle(model.Candle{Pair: "BTCUSDT", Close: 1100, Timeframe: "1h", Complete: true})
+	df, ok := controller.Dataframe()
+	require.True(t, ok)
+	require.Equal(t, 1100.0, df.Close.Last(0))
+	require.Equal(t, 1000.0, df.Timeframes["4h"].Close.Last(0))
+
+	err := controller.Swap(&fakeStrategy{timeframe: "1h"})
+	require.ErrorIs(t, err, ErrTimeframeMismatch)
+	require.NoError(t, controller.Swap(&fakeTrendStrategy{fakeStrategy: fakeStrategy{timeframe: "1h"},
+		timeframes: []string{"4h"}}))
+}
@@ -0,0 +1,106 @@
+package strategy
+
+import (
+	"sync"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// update is an order update or a closed position, dispatched to the lifecycle callbacks of the strategy
+type update struct {
+	order  model.Order
+	closed *model.PositionPnL
+}
+
+// updateQueue keeps the order updates received from the order feed, and the positions closed by the position
+// manager, until they are dispatched to the strategy. The feeds are not blocked by the strategy, so strategies
+// can place orders from the callbacks.
+type updateQueue struct {
+	mtx     sync.Mutex
+	pending []update
+	signal  chan struct{}
+	start   sync.Once
+}
+
+func newUpdateQueue() *updateQueue {
+	return &updateQueue{signal: make(chan struct{}, 1)}
+}
+
+func (q *updateQueue) push(item update) {
+	q.mtx.Lock()
+	q.pending = append(q.pending, item)
+	q.mtx.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *updateQueue) pop() []update {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	updates := q.pending
+	q.pending = nil
+	return updates
+}
+
+// OnOrder receives the order updates of the pair from the order feed, eg: `feed.Subscribe(pair, c.OnOrder, false)`.
+// Updates are dispatched to the strategy callbacks after the controller is started, in the order they are received.
+func (s *Controller) OnOrder(order model.Order) {
+	s.updates.push(update{order: order})
+}
+
+// OnPositionClosed receives the positions closed by the position manager, eg: subscribed to
+// `event.ClosedPositions`. Positions of other pairs are ignored.
+func (s *Controller) OnPositionClosed(position model.PositionPnL) {
+	if position.Pair == s.dataframe.Pair {
+		s.updates.push(update{closed: &position})
+	}
+}
+
+// dispatchUpdates executes the strategy callbacks of the queued updates
+func (s *Controller) dispatchUpdates() {
+	for range s.updates.signal {
+		for _, item := range s.updates.pop() {
+			s.mtx.Lock()
+			if item.closed != nil {
+				s.onPositionClosed(*item.closed)
+			} else {
+				s.onOrder(item.order)
+			}
+			s.mtx.Unlock()
+		}
+	}
+}
+
+// onPositionClosed executes the strategy callback of a closed position, the caller must hold the controller
+// lock. Paused strategies are not notified.
+func (s *Controller) onPositionClosed(position model.PositionPnL) {
+	str, implemented := s.strategy.(PositionClosedStrategy)
+	if !implemented {
+		return
+	}
+	if broker, active := s.activeBroker(); active {
+		str.OnPositionClosed(position, broker)
+	}
+}
+
+// onOrder executes the strategy callbacks of an order update, the caller must hold the controller lock.
+// Paused strategies are not notified.
+func (s *Controller) onOrder(order model.Order) {
+	switch order.Status {
+	case model.OrderStatusTypeFilled:
+		if str, implemented := s.strategy.(OrderFilledStrategy); implemented {
+			if broker, active := s.activeBroker(); active {
+				str.OnOrderFilled(order, broker)
+			}
+		}
+	case model.OrderStatusTypeCanceled, model.OrderStatusTypeExpired:
+		if str, implemented := s.strategy.(OrderCanceledStrategy); implemented {
+			if broker, active := s.activeBroker(); active {
+				str.OnOrderCanceled(order, broker)
+			}
+		}
+	}
+}
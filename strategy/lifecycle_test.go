@@ -0,0 +1,93 @@
+package strategy
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+type fakeLifecycleStrategy struct {
+	fakeStrategy
+	mtx      sync.Mutex
+	filled   []model.Order
+	canceled []model.Order
+	closed   []model.PositionPnL
+}
+
+func (f *fakeLifecycleStrategy) OnOrderFilled(order model.Order, _ service.Broker) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.filled = append(f.filled, order)
+}
+
+func (f *fakeLifecycleStrategy) OnOrderCanceled(order model.Order, _ service.Broker) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.canceled = append(f.canceled, order)
+}
+
+func (f *fakeLifecycleStrategy) OnPositionClosed(position model.PositionPnL, _ service.Broker) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.closed = append(f.closed, position)
+}
+
+func TestController_OnOrder(t *testing.T) {
+	fill := func(id int64, side model.SideType, quantity, price float64) model.Order {
+		return model.Order{ExchangeID: id, Pair: "BTCUSDT", Side: side, Type: model.OrderTypeMarket,
+			Status: model.OrderStatusTypeFilled, Quantity: quantity, Price: price, Fee: 1}
+	}
+
+	t.Run("callbacks", func(t *testing.T) {
+		wallet := exchange.NewPaperWallet(context.Background(), "USDT", exchange.WithPaperAsset("USDT", 1000))
+		str := &fakeLifecycleStrategy{fakeStrategy: fakeStrategy{timeframe: "1h"}}
+		controller := NewStrategyController("BTCUSDT", str, wallet)
+
+		// updates are queued until the controller is started
+		controller.OnOrder(fill(1, model.SideTypeBuy, 1, 100))
+		controller.OnOrder(fill(2, model.SideTypeBuy, 1, 200))
+		controller.OnOrder(model.Order{ExchangeID: 3, Pair: "BTCUSDT", Status: model.OrderStatusTypeCanceled})
+		controller.OnOrder(model.Order{ExchangeID: 4, Pair: "BTCUSDT", Status: model.OrderStatusTypeNew})
+		controller.OnOrder(fill(5, model.SideTypeSell, 2, 180))
+		controller.OnPositionClosed(model.PositionPnL{Pair: "BTCUSDT", Size: 2, AvgPrice: 150, MarkPrice: 180,
+			RealizedPnL: 60, Fees: 3})
+		// positions of other pairs are ignored
+		controller.OnPositionClosed(model.PositionPnL{Pair: "ETHUSDT", Size: 1})
+		controller.Start()
+
+		require.Eventually(t, func() bool {
+			str.mtx.Lock()
+			defer str.mtx.Unlock()
+			return len(str.closed) == 1
+		}, time.Second, time.Millisecond)
+
+		str.mtx.Lock()
+		defer str.mtx.Unlock()
+		require.Len(t, str.filled, 3)
+		require.Len(t, str.canceled, 1)
+		require.Equal(t, int64(3), str.canceled[0].ExchangeID)
+
+		closed := str.closed[0]
+		require.Equal(t, "BTCUSDT", closed.Pair)
+		require.Equal(t, 2.0, closed.Size)
+		require.Equal(t, 60.0, closed.RealizedPnL)
+	})
+
+	t.Run("paused", func(t *testing.T) {
+		str := &fakeLifecycleStrategy{fakeStrategy: fakeStrategy{timeframe: "1h"}}
+		controller := NewStrategyController("BTCUSDT", str, nil)
+		controller.Pause(model.PauseAll)
+
+		controller.onOrder(fill(1, model.SideTypeBuy, 1, 100))
+		controller.onPositionClosed(model.PositionPnL{Pair: "BTCUSDT", Size: 1})
+		require.Empty(t, str.filled)
+		require.Empty(t, str.closed)
+	})
+}
@@ -0,0 +1,97 @@
+package strategy
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+)
+
+var ErrEntriesPaused = errors.New("strategy entries paused")
+
+// exitOnlyBroker rejects orders that open or increase positions
+type exitOnlyBroker struct {
+	service.Broker
+}
+
+func (b exitOnlyBroker) checkEntry(side model.SideType, pair string) error {
+	asset, _, err := b.Position(pair)
+	if err != nil {
+		return err
+	}
+	if model.IsEntry(side, asset) {
+		return fmt.Errorf("%w: %s %s", ErrEntriesPaused, side, pair)
+	}
+	return nil
+}
+
+func (b exitOnlyBroker) CreateOrderLimit(side model.SideType, pair string, size float64,
+	limit float64) (model.Order, error) {
+	if err := b.checkEntry(side, pair); err != nil {
+		return model.Order{}, err
+	}
+	return b.Broker.CreateOrderLimit(side, pair, size, limit)
+}
+
+func (b exitOnlyBroker) CreateOrderMarket(side model.SideType, pair string, size float64,
+	reduceOnly bool) (model.Order, error) {
+	if !reduceOnly {
+		if err := b.checkEntry(side, pair); err != nil {
+			return model.Order{}, err
+		}
+	}
+	return b.Broker.CreateOrderMarket(side, pair, size, reduceOnly)
+}
+
+func (b exitOnlyBroker) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	if err := b.checkEntry(side, pair); err != nil {
+		return model.Order{}, err
+	}
+	return b.Broker.CreateOrderMarketQuote(side, pair, quote)
+}
+
+func (b exitOnlyBroker) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	if quantity > order.Quantity {
+		if err := b.checkEntry(order.Side, order.Pair); err != nil {
+			return model.Order{}, err
+		}
+	}
+	return b.Broker.ModifyOrder(order, price, quantity)
+}
+
+func (b exitOnlyBroker) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForceType) (model.Order, error) {
+	if err := b.checkEntry(side, pair); err != nil {
+		return model.Order{}, err
+	}
+	broker, ok := b.Broker.(service.TimeInForceBroker)
+	if !ok {
+		return model.Order{}, fmt.Errorf("time in force %s not supported by the broker", timeInForce)
+	}
+	return broker.CreateOrderLimitTIF(side, pair, size, limit, timeInForce)
+}
+
+func (b exitOnlyBroker) CreateOrderTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64) (model.Order, error) {
+	if err := b.checkEntry(side, pair); err != nil {
+		return model.Order{}, err
+	}
+	broker, ok := b.Broker.(service.TrailingStopBroker)
+	if !ok {
+		return model.Order{}, fmt.Errorf("trailing stop not supported by the broker")
+	}
+	return broker.CreateOrderTrailingStop(side, pair, quantity, activation, callbackRate)
+}
+
+func (b exitOnlyBroker) CreateOrderLimitOptions(side model.SideType, pair string, size, limit float64,
+	options model.OrderOptions) (model.Order, error) {
+	if err := b.checkEntry(side, pair); err != nil {
+		return model.Order{}, err
+	}
+	broker, ok := b.Broker.(service.OrderOptionsBroker)
+	if !ok {
+		return model.Order{}, fmt.Errorf("order options %+v not supported by the broker", options)
+	}
+	return broker.CreateOrderLimitOptions(side, pair, size, limit, options)
+}
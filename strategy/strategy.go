@@ -1,6 +1,7 @@
 package strategy
 
 import (
+	"github.com/bengalm/ninjabot/calendar"
 	"github.com/bengalm/ninjabot/model"
 	"github.com/bengalm/ninjabot/service"
 )
@@ -24,3 +25,72 @@ type HighFrequencyStrategy interface {
 	// OnPartialCandle will be executed for each new partial candle, after indicators are filled.
 	OnPartialCandle(df *model.Dataframe, broker service.Broker)
 }
+
+type MultiTimeframeStrategy interface {
+	Strategy
+
+	// Timeframes are the additional time intervals of the pair, eg: a 4h trend filter for 15m signals. Their
+	// complete candles are available in `df.Timeframes`, with up to `WarmupPeriod` candles of each timeframe.
+	// The strategy is still executed only on candles of the main `Timeframe`.
+	Timeframes() []string
+}
+
+type EventStrategy interface {
+	Strategy
+
+	// OnEvent will be executed once when the blackout window of a scheduled event starts, eg: to flatten positions.
+	// During the blackout, `OnCandle` and `OnPartialCandle` are not executed.
+	OnEvent(event calendar.Event, df *model.Dataframe, broker service.Broker)
+}
+
+// BreakEvenStrategy moves the stops of the positions of the strategy to the entry price once they reach a gain,
+// eg: model.BreakEven{RMultiple: 1}. The stops are adjusted by the order controller.
+type BreakEvenStrategy interface {
+	Strategy
+
+	BreakEven() model.BreakEven
+}
+
+// PyramidingStrategy adds to the positions of the strategy up to a number of entries, including the first one.
+// Further entries are rejected with order.ErrMaxEntries, and the single exit protecting a position is resized
+// when an entry fills.
+type PyramidingStrategy interface {
+	Strategy
+
+	MaxEntries() int
+}
+
+type ExpiringOrdersStrategy interface {
+	Strategy
+
+	// OrderTTL is the time to live of the unfilled limit orders of the strategy, eg: 3 candles. Expired orders
+	// are canceled, or replaced by market orders with their unfilled quantity.
+	OrderTTL() model.OrderTTL
+	// OnOrderExpired will be executed after an expired order is canceled, with its market replacement, if any.
+	OnOrderExpired(expired model.Order, replacement *model.Order, broker service.Broker)
+}
+
+// OrderFilledStrategy is notified of the filled orders of its pairs, from the order feed
+type OrderFilledStrategy interface {
+	Strategy
+
+	// OnOrderFilled will be executed after an order of the pair is filled, eg: to place the exits of an entry.
+	OnOrderFilled(order model.Order, broker service.Broker)
+}
+
+// OrderCanceledStrategy is notified of the canceled orders of its pairs, from the order feed
+type OrderCanceledStrategy interface {
+	Strategy
+
+	// OnOrderCanceled will be executed after an order of the pair is canceled or expired by the exchange.
+	OnOrderCanceled(order model.Order, broker service.Broker)
+}
+
+// PositionClosedStrategy is notified when the position of its pairs is closed, from the positions of the bot
+type PositionClosedStrategy interface {
+	Strategy
+
+	// OnPositionClosed will be executed after a fill closes the position of the pair, with the closed size,
+	// the average entry price, the exit price as mark price, and the realized profit and fees of the position.
+	OnPositionClosed(position model.PositionPnL, broker service.Broker)
+}
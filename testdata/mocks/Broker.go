@@ -336,6 +336,52 @@ func (_c *Broker_CreateOrderStop_Call) Return(_a0 model.Order, _a1 error) *Broke
 	return _c
 }
 
+// ModifyOrder provides a mock function with given fields: order, price, quantity
+func (_m *Broker) ModifyOrder(order model.Order, price float64, quantity float64) (model.Order, error) {
+	ret := _m.Called(order, price, quantity)
+
+	var r0 model.Order
+	if rf, ok := ret.Get(0).(func(model.Order, float64, float64) model.Order); ok {
+		r0 = rf(order, price, quantity)
+	} else {
+		r0 = ret.Get(0).(model.Order)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Order, float64, float64) error); ok {
+		r1 = rf(order, price, quantity)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Broker_ModifyOrder_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ModifyOrder'
+type Broker_ModifyOrder_Call struct {
+	*mock.Call
+}
+
+// ModifyOrder is a helper method to define mock.On call
+//   - order model.Order
+//   - price float64
+//   - quantity float64
+func (_e *Broker_Expecter) ModifyOrder(order interface{}, price interface{}, quantity interface{}) *Broker_ModifyOrder_Call {
+	return &Broker_ModifyOrder_Call{Call: _e.mock.On("ModifyOrder", order, price, quantity)}
+}
+
+func (_c *Broker_ModifyOrder_Call) Run(run func(order model.Order, price float64, quantity float64)) *Broker_ModifyOrder_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(model.Order), args[1].(float64), args[2].(float64))
+	})
+	return _c
+}
+
+func (_c *Broker_ModifyOrder_Call) Return(_a0 model.Order, _a1 error) *Broker_ModifyOrder_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Order provides a mock function with given fields: pair, id
 func (_m *Broker) Order(pair string, id int64) (model.Order, error) {
 	ret := _m.Called(pair, id)
@@ -432,6 +478,50 @@ func (_c *Broker_Position_Call) Return(asset float64, quote float64, err error)
 	return _c
 }
 
+// PositionRisk provides a mock function with given fields: pair
+func (_m *Broker) PositionRisk(pair string) (model.PositionRisk, error) {
+	ret := _m.Called(pair)
+
+	var r0 model.PositionRisk
+	if rf, ok := ret.Get(0).(func(string) model.PositionRisk); ok {
+		r0 = rf(pair)
+	} else {
+		r0 = ret.Get(0).(model.PositionRisk)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Broker_PositionRisk_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PositionRisk'
+type Broker_PositionRisk_Call struct {
+	*mock.Call
+}
+
+// PositionRisk is a helper method to define mock.On call
+//   - pair string
+func (_e *Broker_Expecter) PositionRisk(pair interface{}) *Broker_PositionRisk_Call {
+	return &Broker_PositionRisk_Call{Call: _e.mock.On("PositionRisk", pair)}
+}
+
+func (_c *Broker_PositionRisk_Call) Run(run func(pair string)) *Broker_PositionRisk_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Broker_PositionRisk_Call) Return(_a0 model.PositionRisk, _a1 error) *Broker_PositionRisk_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 type mockConstructorTestingTNewBroker interface {
 	mock.TestingT
 	Cleanup(func())
@@ -526,6 +526,56 @@ func (_c *Exchange_CreateOrderStop_Call) Return(_a0 model.Order, _a1 error) *Exc
 	return _c
 }
 
+// DepthSubscription provides a mock function with given fields: ctx, pair, levels
+func (_m *Exchange) DepthSubscription(ctx context.Context, pair string, levels int) (chan model.OrderBook, chan error) {
+	ret := _m.Called(ctx, pair, levels)
+
+	var r0 chan model.OrderBook
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) chan model.OrderBook); ok {
+		r0 = rf(ctx, pair, levels)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(chan model.OrderBook)
+		}
+	}
+
+	var r1 chan error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) chan error); ok {
+		r1 = rf(ctx, pair, levels)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(chan error)
+		}
+	}
+
+	return r0, r1
+}
+
+// Exchange_DepthSubscription_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DepthSubscription'
+type Exchange_DepthSubscription_Call struct {
+	*mock.Call
+}
+
+// DepthSubscription is a helper method to define mock.On call
+//   - ctx context.Context
+//   - pair string
+//   - levels int
+func (_e *Exchange_Expecter) DepthSubscription(ctx interface{}, pair interface{}, levels interface{}) *Exchange_DepthSubscription_Call {
+	return &Exchange_DepthSubscription_Call{Call: _e.mock.On("DepthSubscription", ctx, pair, levels)}
+}
+
+func (_c *Exchange_DepthSubscription_Call) Run(run func(ctx context.Context, pair string, levels int)) *Exchange_DepthSubscription_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(int))
+	})
+	return _c
+}
+
+func (_c *Exchange_DepthSubscription_Call) Return(_a0 chan model.OrderBook, _a1 chan error) *Exchange_DepthSubscription_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // LastQuote provides a mock function with given fields: ctx, pair
 func (_m *Exchange) LastQuote(ctx context.Context, pair string) (float64, error) {
 	ret := _m.Called(ctx, pair)
@@ -571,6 +621,52 @@ func (_c *Exchange_LastQuote_Call) Return(_a0 float64, _a1 error) *Exchange_Last
 	return _c
 }
 
+// ModifyOrder provides a mock function with given fields: order, price, quantity
+func (_m *Exchange) ModifyOrder(order model.Order, price float64, quantity float64) (model.Order, error) {
+	ret := _m.Called(order, price, quantity)
+
+	var r0 model.Order
+	if rf, ok := ret.Get(0).(func(model.Order, float64, float64) model.Order); ok {
+		r0 = rf(order, price, quantity)
+	} else {
+		r0 = ret.Get(0).(model.Order)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(model.Order, float64, float64) error); ok {
+		r1 = rf(order, price, quantity)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Exchange_ModifyOrder_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ModifyOrder'
+type Exchange_ModifyOrder_Call struct {
+	*mock.Call
+}
+
+// ModifyOrder is a helper method to define mock.On call
+//   - order model.Order
+//   - price float64
+//   - quantity float64
+func (_e *Exchange_Expecter) ModifyOrder(order interface{}, price interface{}, quantity interface{}) *Exchange_ModifyOrder_Call {
+	return &Exchange_ModifyOrder_Call{Call: _e.mock.On("ModifyOrder", order, price, quantity)}
+}
+
+func (_c *Exchange_ModifyOrder_Call) Run(run func(order model.Order, price float64, quantity float64)) *Exchange_ModifyOrder_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(model.Order), args[1].(float64), args[2].(float64))
+	})
+	return _c
+}
+
+func (_c *Exchange_ModifyOrder_Call) Return(_a0 model.Order, _a1 error) *Exchange_ModifyOrder_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // Order provides a mock function with given fields: pair, id
 func (_m *Exchange) Order(pair string, id int64) (model.Order, error) {
 	ret := _m.Called(pair, id)
@@ -667,6 +763,50 @@ func (_c *Exchange_Position_Call) Return(asset float64, quote float64, err error
 	return _c
 }
 
+// PositionRisk provides a mock function with given fields: pair
+func (_m *Exchange) PositionRisk(pair string) (model.PositionRisk, error) {
+	ret := _m.Called(pair)
+
+	var r0 model.PositionRisk
+	if rf, ok := ret.Get(0).(func(string) model.PositionRisk); ok {
+		r0 = rf(pair)
+	} else {
+		r0 = ret.Get(0).(model.PositionRisk)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(pair)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Exchange_PositionRisk_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PositionRisk'
+type Exchange_PositionRisk_Call struct {
+	*mock.Call
+}
+
+// PositionRisk is a helper method to define mock.On call
+//   - pair string
+func (_e *Exchange_Expecter) PositionRisk(pair interface{}) *Exchange_PositionRisk_Call {
+	return &Exchange_PositionRisk_Call{Call: _e.mock.On("PositionRisk", pair)}
+}
+
+func (_c *Exchange_PositionRisk_Call) Run(run func(pair string)) *Exchange_PositionRisk_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(string))
+	})
+	return _c
+}
+
+func (_c *Exchange_PositionRisk_Call) Return(_a0 model.PositionRisk, _a1 error) *Exchange_PositionRisk_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 type mockConstructorTestingTNewExchange interface {
 	mock.TestingT
 	Cleanup(func())
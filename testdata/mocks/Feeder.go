@@ -210,6 +210,56 @@ func (_c *Feeder_CandlesSubscription_Call) Return(_a0 chan model.Candle, _a1 cha
 	return _c
 }
 
+// DepthSubscription provides a mock function with given fields: ctx, pair, levels
+func (_m *Feeder) DepthSubscription(ctx context.Context, pair string, levels int) (chan model.OrderBook, chan error) {
+	ret := _m.Called(ctx, pair, levels)
+
+	var r0 chan model.OrderBook
+	if rf, ok := ret.Get(0).(func(context.Context, string, int) chan model.OrderBook); ok {
+		r0 = rf(ctx, pair, levels)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(chan model.OrderBook)
+		}
+	}
+
+	var r1 chan error
+	if rf, ok := ret.Get(1).(func(context.Context, string, int) chan error); ok {
+		r1 = rf(ctx, pair, levels)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(chan error)
+		}
+	}
+
+	return r0, r1
+}
+
+// Feeder_DepthSubscription_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'DepthSubscription'
+type Feeder_DepthSubscription_Call struct {
+	*mock.Call
+}
+
+// DepthSubscription is a helper method to define mock.On call
+//   - ctx context.Context
+//   - pair string
+//   - levels int
+func (_e *Feeder_Expecter) DepthSubscription(ctx interface{}, pair interface{}, levels interface{}) *Feeder_DepthSubscription_Call {
+	return &Feeder_DepthSubscription_Call{Call: _e.mock.On("DepthSubscription", ctx, pair, levels)}
+}
+
+func (_c *Feeder_DepthSubscription_Call) Run(run func(ctx context.Context, pair string, levels int)) *Feeder_DepthSubscription_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(context.Context), args[1].(string), args[2].(int))
+	})
+	return _c
+}
+
+func (_c *Feeder_DepthSubscription_Call) Return(_a0 chan model.OrderBook, _a1 chan error) *Feeder_DepthSubscription_Call {
+	_c.Call.Return(_a0, _a1)
+	return _c
+}
+
 // LastQuote provides a mock function with given fields: ctx, pair
 func (_m *Feeder) LastQuote(ctx context.Context, pair string) (float64, error) {
 	ret := _m.Called(ctx, pair)
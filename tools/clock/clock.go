@@ -0,0 +1,72 @@
+package clock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// Clock is the source of the current time. Live bots use the wall clock, while backtests use a simulated
+// clock driven by candle times, so time-dependent logic behaves the same in both modes.
+type Clock interface {
+	Now() time.Time
+}
+
+type wall struct{}
+
+func (wall) Now() time.Time {
+	return time.Now()
+}
+
+// Wall returns a clock based on the system time
+func Wall() Clock {
+	return wall{}
+}
+
+// Since returns the time elapsed since t, given a clock
+func Since(clock Clock, t time.Time) time.Duration {
+	return clock.Now().Sub(t)
+}
+
+// Simulated is a manual clock, usually advanced by the candles of a backtest
+type Simulated struct {
+	mtx sync.RWMutex
+	now time.Time
+}
+
+// NewSimulated creates a simulated clock starting at a given time
+func NewSimulated(start time.Time) *Simulated {
+	return &Simulated{now: start}
+}
+
+func (s *Simulated) Now() time.Time {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return s.now
+}
+
+// Set moves the clock to a given time. The clock is monotonic, so past times are ignored.
+func (s *Simulated) Set(t time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if t.After(s.now) {
+		s.now = t
+	}
+}
+
+// Advance moves the clock forward by a given duration
+func (s *Simulated) Advance(d time.Duration) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.now = s.now.Add(d)
+}
+
+// OnCandle moves the clock to the time of the last candle update
+func (s *Simulated) OnCandle(candle model.Candle) {
+	t := candle.Time
+	if candle.UpdatedAt.After(t) {
+		t = candle.UpdatedAt
+	}
+	s.Set(t)
+}
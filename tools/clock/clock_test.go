@@ -0,0 +1,30 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestSimulated(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewSimulated(start)
+	require.Equal(t, start, clock.Now())
+
+	clock.Advance(time.Minute)
+	require.Equal(t, time.Minute, Since(clock, start))
+
+	// past times are ignored
+	clock.Set(start)
+	require.Equal(t, start.Add(time.Minute), clock.Now())
+
+	clock.OnCandle(model.Candle{Time: start.Add(time.Hour), UpdatedAt: start.Add(90 * time.Minute)})
+	require.Equal(t, start.Add(90*time.Minute), clock.Now())
+}
+
+func TestWall(t *testing.T) {
+	require.WithinDuration(t, time.Now(), Wall().Now(), time.Second)
+}
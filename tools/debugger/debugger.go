@@ -0,0 +1,290 @@
+package debugger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// Frame is the state of a backtest after a candle is processed
+type Frame struct {
+	Step      int          `json:"step"`
+	Candle    model.Candle `json:"candle"`
+	Timeframe string       `json:"timeframe"`
+	// Breakpoint is the name of the breakpoint that paused the backtest in this frame, if any
+	Breakpoint string          `json:"breakpoint,omitempty"`
+	Orders     []model.Order   `json:"orders"`
+	Account    model.Account   `json:"account"`
+	Dataframes []DataframeView `json:"dataframes"`
+}
+
+// DataframeView is a printable view of the last rows of a strategy dataframe, including indicator values
+type DataframeView struct {
+	Pair      string     `json:"pair"`
+	Timeframe string     `json:"timeframe"`
+	Columns   []string   `json:"columns"`
+	Rows      [][]string `json:"rows"`
+}
+
+// Dataframe returns the dataframe view of a given pair, if available in the frame
+func (f Frame) Dataframe(pair string) (DataframeView, bool) {
+	for _, view := range f.Dataframes {
+		if view.Pair == pair {
+			return view, true
+		}
+	}
+	return DataframeView{}, false
+}
+
+// NewDataframeView creates a view with the last rows of a dataframe
+func NewDataframeView(df model.Dataframe, timeframe string, rows int) DataframeView {
+	view := DataframeView{
+		Pair:      df.Pair,
+		Timeframe: timeframe,
+		Columns:   []string{"time", "open", "high", "low", "close", "volume"},
+	}
+
+	metadata := make([]string, 0, len(df.Metadata))
+	for key := range df.Metadata {
+		metadata = append(metadata, key)
+	}
+	sort.Strings(metadata)
+	view.Columns = append(view.Columns, metadata...)
+
+	start := len(df.Time) - rows
+	if start < 0 || rows <= 0 {
+		start = 0
+	}
+
+	value := func(series model.Series[float64], i int) string {
+		if i >= len(series) || math.IsNaN(series[i]) {
+			return "-"
+		}
+		return strconv.FormatFloat(series[i], 'f', -1, 64)
+	}
+
+	for i := start; i < len(df.Time); i++ {
+		row := []string{
+			df.Time[i].Format(time.RFC3339),
+			value(df.Open, i), value(df.High, i), value(df.Low, i), value(df.Close, i), value(df.Volume, i),
+		}
+		for _, key := range metadata {
+			row = append(row, value(df.Metadata[key], i))
+		}
+		view.Rows = append(view.Rows, row)
+	}
+
+	return view
+}
+
+// Breakpoint pauses the backtest when its condition is true for a processed frame
+type Breakpoint struct {
+	Name      string
+	Condition func(frame Frame) bool
+}
+
+// AtTime pauses the backtest at the first candle of a given time or later
+func AtTime(t time.Time) Breakpoint {
+	var hit bool
+	return Breakpoint{
+		Name: fmt.Sprintf("time %s", t.Format(time.RFC3339)),
+		Condition: func(frame Frame) bool {
+			if hit || frame.Candle.Time.Before(t) {
+				return false
+			}
+			hit = true
+			return true
+		},
+	}
+}
+
+// When pauses the backtest when a custom condition is true, eg: a given indicator value
+func When(name string, condition func(frame Frame) bool) Breakpoint {
+	return Breakpoint{Name: name, Condition: condition}
+}
+
+// Debugger controls the execution of a backtest, allowing it to be paused, stepped candle-by-candle
+// and inspected between candles. It is used with `ninjabot.WithDebugger`.
+type Debugger struct {
+	mtx         sync.Mutex
+	cond        *sync.Cond
+	running     bool
+	steps       int
+	waiting     bool
+	pauses      int
+	done        bool
+	frame       Frame
+	breakpoints []Breakpoint
+	rows        int
+}
+
+type Option func(*Debugger)
+
+// WithBreakpoints adds breakpoints to the debugger
+func WithBreakpoints(breakpoints ...Breakpoint) Option {
+	return func(d *Debugger) {
+		d.breakpoints = append(d.breakpoints, breakpoints...)
+	}
+}
+
+// WithStartPaused pauses the backtest before the first candle
+func WithStartPaused() Option {
+	return func(d *Debugger) {
+		d.running = false
+	}
+}
+
+// WithRows sets the number of dataframe rows included in frames, default: 10
+func WithRows(rows int) Option {
+	return func(d *Debugger) {
+		d.rows = rows
+	}
+}
+
+func New(options ...Option) *Debugger {
+	d := &Debugger{
+		running: true,
+		rows:    10,
+	}
+	d.cond = sync.NewCond(&d.mtx)
+
+	for _, option := range options {
+		option(d)
+	}
+
+	return d
+}
+
+// Rows returns the number of dataframe rows to include in frames
+func (d *Debugger) Rows() int {
+	return d.rows
+}
+
+// AddBreakpoint adds a breakpoint at runtime
+func (d *Debugger) AddBreakpoint(breakpoint Breakpoint) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.breakpoints = append(d.breakpoints, breakpoint)
+}
+
+// Pause stops the backtest before the next candle
+func (d *Debugger) Pause() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.running = false
+	d.cond.Broadcast()
+}
+
+// Continue runs the backtest until the next breakpoint
+func (d *Debugger) Continue() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.running = true
+	d.cond.Broadcast()
+}
+
+// Step processes a given number of candles and pauses again
+func (d *Debugger) Step(candles int) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.running = false
+	d.steps += candles
+	d.cond.Broadcast()
+}
+
+// Paused returns true when the backtest is paused
+func (d *Debugger) Paused() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return !d.running
+}
+
+// Done returns true when the backtest is finished
+func (d *Debugger) Done() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.done
+}
+
+// Frame returns the state after the last processed candle
+func (d *Debugger) Frame() Frame {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.frame
+}
+
+// WaitPaused blocks until the backtest is paused waiting for a command, or finished
+func (d *Debugger) WaitPaused() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for !d.waiting && !d.done {
+		d.cond.Wait()
+	}
+}
+
+// await runs a command and blocks until the backtest pauses again, or finishes
+func (d *Debugger) await(command func()) {
+	d.mtx.Lock()
+	pauses := d.pauses
+	d.mtx.Unlock()
+
+	command()
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	for d.pauses == pauses && !d.done {
+		d.cond.Wait()
+	}
+}
+
+// Wait blocks the backtest before a candle, while the debugger is paused
+func (d *Debugger) Wait() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if !d.running && d.steps == 0 && !d.done {
+		d.pauses++
+		d.waiting = true
+		d.cond.Broadcast()
+	}
+
+	for !d.running && d.steps == 0 && !d.done {
+		d.cond.Wait()
+	}
+	d.waiting = false
+
+	if !d.running && d.steps > 0 {
+		d.steps--
+	}
+}
+
+// Record registers the state after a candle is processed, and pauses the backtest on breakpoints
+func (d *Debugger) Record(frame Frame) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	frame.Step = d.frame.Step + 1
+	for _, breakpoint := range d.breakpoints {
+		if breakpoint.Condition(frame) {
+			frame.Breakpoint = breakpoint.Name
+			d.running = false
+			d.steps = 0
+			break
+		}
+	}
+	d.frame = frame
+	d.cond.Broadcast()
+}
+
+// Finish releases the commands waiting for the backtest, it is called when the backtest ends
+func (d *Debugger) Finish() {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.done = true
+	d.cond.Broadcast()
+}
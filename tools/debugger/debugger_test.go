@@ -0,0 +1,87 @@
+package debugger
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// run simulates a backtest with a given number of candles
+func run(d *Debugger, candles int) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < candles; i++ {
+		d.Wait()
+		d.Record(Frame{Candle: model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(i) * time.Hour)}})
+	}
+	d.Finish()
+}
+
+func TestDebugger_Step(t *testing.T) {
+	d := New(WithStartPaused())
+	go run(d, 5)
+
+	d.WaitPaused()
+	require.Zero(t, d.Frame().Step)
+
+	d.await(func() { d.Step(2) })
+	require.Equal(t, 2, d.Frame().Step)
+
+	d.await(func() { d.Step(1) })
+	require.Equal(t, 3, d.Frame().Step)
+
+	d.await(d.Continue)
+	require.True(t, d.Done())
+	require.Equal(t, 5, d.Frame().Step)
+}
+
+func TestDebugger_Breakpoint(t *testing.T) {
+	d := New(WithBreakpoints(AtTime(time.Date(2021, 1, 1, 2, 0, 0, 0, time.UTC))))
+	go run(d, 5)
+
+	d.WaitPaused()
+	frame := d.Frame()
+	require.Equal(t, 3, frame.Step)
+	require.Equal(t, "time 2021-01-01T02:00:00Z", frame.Breakpoint)
+
+	d.await(d.Continue)
+	require.True(t, d.Done())
+}
+
+func TestDebugger_REPL(t *testing.T) {
+	d := New(WithStartPaused())
+	go run(d, 5)
+
+	out := &bytes.Buffer{}
+	require.NoError(t, d.REPL(strings.NewReader("step 2\nframe\nq\n"), out))
+	require.Contains(t, out.String(), "#2 BTCUSDT")
+	require.Contains(t, out.String(), "2021-01-01T01:00:00Z")
+}
+
+func TestNewDataframeView(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	df := model.Dataframe{
+		Pair:     "BTCUSDT",
+		Time:     []time.Time{start, start.Add(time.Hour), start.Add(2 * time.Hour)},
+		Open:     []float64{1, 2, 3},
+		High:     []float64{1, 2, 3},
+		Low:      []float64{1, 2, 3},
+		Close:    []float64{1, 2, 3},
+		Volume:   []float64{1, 2, 3},
+		Metadata: map[string]model.Series[float64]{"ema": {math.NaN(), 1.5, 2.5}},
+	}
+
+	view := NewDataframeView(df, "1h", 2)
+	require.Equal(t, []string{"time", "open", "high", "low", "close", "volume", "ema"}, view.Columns)
+	require.Len(t, view.Rows, 2)
+	require.Equal(t, "1.5", view.Rows[0][6])
+
+	view = NewDataframeView(df, "1h", 0)
+	require.Len(t, view.Rows, 3)
+	require.Equal(t, "-", view.Rows[0][6])
+}
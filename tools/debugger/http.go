@@ -0,0 +1,63 @@
+package debugger
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Handler returns the HTTP API of the debugger, eg: to control the backtest from the chart server
+// with `plot.WithHandler("/debug/", debugger.Handler())`. Routes:
+//
+//	GET  /debug/frame              current frame
+//	POST /debug/step?candles=n     process n candles (default: 1)
+//	POST /debug/continue           run until the next breakpoint
+//	POST /debug/pause              pause before the next candle
+func (d *Debugger) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/frame", d.handleFrame)
+	mux.HandleFunc("/debug/step", d.command(func(r *http.Request) error {
+		candles := 1
+		if value := r.URL.Query().Get("candles"); value != "" {
+			var err error
+			candles, err = strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+		}
+		d.await(func() { d.Step(candles) })
+		return nil
+	}))
+	mux.HandleFunc("/debug/continue", d.command(func(_ *http.Request) error {
+		d.Continue()
+		return nil
+	}))
+	mux.HandleFunc("/debug/pause", d.command(func(_ *http.Request) error {
+		d.Pause()
+		return nil
+	}))
+	return mux
+}
+
+func (d *Debugger) handleFrame(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(d.Frame()); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (d *Debugger) command(handler func(r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := handler(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		d.handleFrame(w, r)
+	}
+}
@@ -0,0 +1,150 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+const replHelp = `commands:
+  s, step [n]        process n candles (default: 1)
+  c, continue        run until the next breakpoint
+  b, break <time>    pause at a given time, eg: 2021-05-01 or 2021-05-01T10:00:00Z
+  f, frame           show the current candle and breakpoint
+  df [pair]          show the strategy dataframe with indicator values
+  o, orders          show pending orders
+  w, wallet          show wallet balances
+  q, quit            leave the debugger and finish the backtest
+`
+
+// REPL runs an interactive command line to control the backtest, eg: `debugger.REPL(os.Stdin, os.Stdout)`.
+// It returns when the input is closed, the user quits or the backtest ends.
+func (d *Debugger) REPL(in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		d.WaitPaused()
+		if d.Done() {
+			fmt.Fprintln(out, "backtest finished")
+			return nil
+		}
+
+		fmt.Fprintf(out, "(ninjabot #%d) ", d.Frame().Step)
+		if !scanner.Scan() {
+			d.Continue()
+			return scanner.Err()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "s", "step":
+			steps := 1
+			if len(fields) > 1 {
+				value, err := strconv.Atoi(fields[1])
+				if err != nil || value < 1 {
+					fmt.Fprintf(out, "invalid steps: %s\n", fields[1])
+					continue
+				}
+				steps = value
+			}
+			d.await(func() { d.Step(steps) })
+			d.printFrame(out)
+		case "c", "continue":
+			d.await(d.Continue)
+			d.printFrame(out)
+		case "b", "break":
+			if len(fields) < 2 {
+				fmt.Fprintln(out, "missing time")
+				continue
+			}
+			t, err := parseTime(fields[1])
+			if err != nil {
+				fmt.Fprintf(out, "invalid time: %v\n", err)
+				continue
+			}
+			d.AddBreakpoint(AtTime(t))
+		case "f", "frame":
+			printFrame(out, d.Frame())
+		case "df":
+			printDataframes(out, d.Frame(), fields[1:]...)
+		case "o", "orders":
+			printOrders(out, d.Frame())
+		case "w", "wallet":
+			printWallet(out, d.Frame())
+		case "q", "quit":
+			d.Continue()
+			return nil
+		default:
+			fmt.Fprint(out, replHelp)
+		}
+	}
+}
+
+// printFrame prints the current frame, if the backtest is not finished
+func (d *Debugger) printFrame(out io.Writer) {
+	if !d.Done() {
+		printFrame(out, d.Frame())
+	}
+}
+
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func printFrame(out io.Writer, frame Frame) {
+	candle := frame.Candle
+	fmt.Fprintf(out, "#%d %s %s [%s] O: %f H: %f L: %f C: %f V: %f\n", frame.Step, candle.Pair, frame.Timeframe,
+		candle.Time.Format(time.RFC3339), candle.Open, candle.High, candle.Low, candle.Close, candle.Volume)
+	if frame.Breakpoint != "" {
+		fmt.Fprintf(out, "breakpoint: %s\n", frame.Breakpoint)
+	}
+}
+
+func printDataframes(out io.Writer, frame Frame, pairs ...string) {
+	for _, view := range frame.Dataframes {
+		if len(pairs) > 0 && !strings.EqualFold(pairs[0], view.Pair) {
+			continue
+		}
+
+		fmt.Fprintf(out, "%s %s\n", view.Pair, view.Timeframe)
+		table := tablewriter.NewWriter(out)
+		table.SetHeader(view.Columns)
+		table.AppendBulk(view.Rows)
+		table.Render()
+	}
+}
+
+func printOrders(out io.Writer, frame Frame) {
+	if len(frame.Orders) == 0 {
+		fmt.Fprintln(out, "no pending orders")
+		return
+	}
+
+	for _, order := range frame.Orders {
+		fmt.Fprintln(out, order)
+	}
+}
+
+func printWallet(out io.Writer, frame Frame) {
+	table := tablewriter.NewWriter(out)
+	table.SetHeader([]string{"Asset", "Free", "Lock"})
+	for _, balance := range frame.Account.Balances {
+		table.Append([]string{
+			balance.Asset,
+			strconv.FormatFloat(balance.Free, 'f', -1, 64),
+			strconv.FormatFloat(balance.Lock, 'f', -1, 64),
+		})
+	}
+	table.Render()
+}
@@ -0,0 +1,225 @@
+// Package export writes the orders, closed trades and equity of a run to CSV or Parquet files, to analyze
+// the results in other tools, eg: pandas or a spreadsheet.
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// ErrUnknownFormat is returned for a format that is not CSV or Parquet
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Format is the file format of an export
+type Format string
+
+var (
+	CSV     Format = "csv"
+	Parquet Format = "parquet"
+)
+
+// Trade is a closed trade of a pair
+type Trade struct {
+	Pair   string
+	Start  time.Time
+	End    time.Time
+	Profit float64
+	MAE    float64
+	MFE    float64
+}
+
+// EquityPoint is the value of the account at a time
+type EquityPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// record is a row of an export, with the columns of the CSV format and the tags of the Parquet format
+type record interface {
+	header() []string
+	values() []string
+}
+
+type orderRecord struct {
+	ID         int64   `parquet:"name=id, type=INT64"`
+	ExchangeID int64   `parquet:"name=exchange_id, type=INT64"`
+	Pair       string  `parquet:"name=pair, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Side       string  `parquet:"name=side, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Type       string  `parquet:"name=type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Status     string  `parquet:"name=status, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Price      float64 `parquet:"name=price, type=DOUBLE"`
+	Quantity   float64 `parquet:"name=quantity, type=DOUBLE"`
+	Executed   float64 `parquet:"name=executed, type=DOUBLE"`
+	Stop       float64 `parquet:"name=stop, type=DOUBLE"`
+	CreatedAt  int64   `parquet:"name=created_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	UpdatedAt  int64   `parquet:"name=updated_at, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+}
+
+func (orderRecord) header() []string {
+	return []string{"id", "exchange_id", "pair", "side", "type", "status", "price", "quantity", "executed", "stop",
+		"created_at", "updated_at"}
+}
+
+func (r orderRecord) values() []string {
+	return []string{strconv.FormatInt(r.ID, 10), strconv.FormatInt(r.ExchangeID, 10), r.Pair, r.Side, r.Type,
+		r.Status, formatFloat(r.Price), formatFloat(r.Quantity), formatFloat(r.Executed), formatFloat(r.Stop),
+		formatTime(r.CreatedAt), formatTime(r.UpdatedAt)}
+}
+
+type tradeRecord struct {
+	Pair     string  `parquet:"name=pair, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Start    int64   `parquet:"name=start, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	End      int64   `parquet:"name=end, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Duration int64   `parquet:"name=duration_seconds, type=INT64"`
+	Profit   float64 `parquet:"name=profit, type=DOUBLE"`
+	MAE      float64 `parquet:"name=mae, type=DOUBLE"`
+	MFE      float64 `parquet:"name=mfe, type=DOUBLE"`
+}
+
+func (tradeRecord) header() []string {
+	return []string{"pair", "start", "end", "duration_seconds", "profit", "mae", "mfe"}
+}
+
+func (r tradeRecord) values() []string {
+	return []string{r.Pair, formatTime(r.Start), formatTime(r.End), strconv.FormatInt(r.Duration, 10),
+		formatFloat(r.Profit), formatFloat(r.MAE), formatFloat(r.MFE)}
+}
+
+type equityRecord struct {
+	Time  int64   `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Value float64 `parquet:"name=value, type=DOUBLE"`
+}
+
+func (equityRecord) header() []string {
+	return []string{"time", "value"}
+}
+
+func (r equityRecord) values() []string {
+	return []string{formatTime(r.Time), formatFloat(r.Value)}
+}
+
+// Orders writes orders, one row by order
+func Orders(w io.Writer, format Format, orders []*model.Order) error {
+	records := make([]orderRecord, 0, len(orders))
+	for _, order := range orders {
+		record := orderRecord{
+			ID:         order.ID,
+			ExchangeID: order.ExchangeID,
+			Pair:       order.Pair,
+			Side:       string(order.Side),
+			Type:       string(order.Type),
+			Status:     string(order.Status),
+			Price:      order.Price,
+			Quantity:   order.Quantity,
+			Executed:   order.Executed,
+			CreatedAt:  order.CreatedAt.UnixMilli(),
+			UpdatedAt:  order.UpdatedAt.UnixMilli(),
+		}
+		if order.Stop != nil {
+			record.Stop = *order.Stop
+		}
+		records = append(records, record)
+	}
+	return write(w, format, records)
+}
+
+// Trades writes closed trades, one row by trade
+func Trades(w io.Writer, format Format, trades []Trade) error {
+	records := make([]tradeRecord, 0, len(trades))
+	for _, trade := range trades {
+		records = append(records, tradeRecord{
+			Pair:     trade.Pair,
+			Start:    trade.Start.UnixMilli(),
+			End:      trade.End.UnixMilli(),
+			Duration: int64(trade.End.Sub(trade.Start).Seconds()),
+			Profit:   trade.Profit,
+			MAE:      trade.MAE,
+			MFE:      trade.MFE,
+		})
+	}
+	return write(w, format, records)
+}
+
+// Equity writes the equity time series, one row by time
+func Equity(w io.Writer, format Format, equity []EquityPoint) error {
+	records := make([]equityRecord, 0, len(equity))
+	for _, point := range equity {
+		records = append(records, equityRecord{Time: point.Time.UnixMilli(), Value: point.Value})
+	}
+	return write(w, format, records)
+}
+
+// File creates a file of the format in a directory, eg: File("results", "orders", CSV) = results/orders.csv
+func File(dir, name string, format Format, export func(io.Writer) error) (err error) {
+	if format != CSV && format != Parquet {
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+
+	file, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s.%s", name, format)))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	return export(file)
+}
+
+func write[T record](w io.Writer, format Format, records []T) error {
+	switch format {
+	case CSV:
+		return writeCSV(w, records)
+	case Parquet:
+		return writeParquet(w, records)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+}
+
+func writeCSV[T record](w io.Writer, records []T) error {
+	var empty T
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(empty.header()); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := csvWriter.Write(record.values()); err != nil {
+			return err
+		}
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func writeParquet[T record](w io.Writer, records []T) error {
+	parquetWriter, err := writer.NewParquetWriterFromWriter(w, new(T), 1)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := parquetWriter.Write(record); err != nil {
+			return err
+		}
+	}
+	return parquetWriter.WriteStop()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func formatTime(milliseconds int64) string {
+	return time.UnixMilli(milliseconds).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestExport(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	stop := 900.0
+	orders := []*model.Order{
+		{ID: 1, ExchangeID: 10, Pair: "BTCUSDT", Side: model.SideTypeBuy, Type: model.OrderTypeMarket,
+			Status: model.OrderStatusTypeFilled, Price: 1000, Quantity: 0.5, Executed: 0.5, CreatedAt: start,
+			UpdatedAt: start},
+		{ID: 2, ExchangeID: 11, Pair: "BTCUSDT", Side: model.SideTypeSell, Type: model.OrderTypeStopLoss,
+			Status: model.OrderStatusTypeNew, Price: 890, Quantity: 0.5, Stop: &stop, CreatedAt: start,
+			UpdatedAt: start.Add(time.Hour)},
+	}
+	trades := []Trade{
+		{Pair: "BTCUSDT", Start: start, End: start.Add(2 * time.Hour), Profit: 50.5, MAE: 0.01, MFE: 0.12},
+	}
+	equity := []EquityPoint{{Time: start, Value: 1000}, {Time: start.Add(time.Hour), Value: 1050.5}}
+
+	t.Run("csv", func(t *testing.T) {
+		buffer := bytes.NewBuffer(nil)
+		require.NoError(t, Orders(buffer, CSV, orders))
+		require.Equal(t, "id,exchange_id,pair,side,type,status,price,quantity,executed,stop,created_at,updated_at\n"+
+			"1,10,BTCUSDT,BUY,MARKET,FILLED,1000,0.5,0.5,0,2022-01-01T00:00:00Z,2022-01-01T00:00:00Z\n"+
+			"2,11,BTCUSDT,SELL,STOP_LOSS,NEW,890,0.5,0,900,2022-01-01T00:00:00Z,2022-01-01T01:00:00Z\n",
+			buffer.String())
+
+		buffer.Reset()
+		require.NoError(t, Trades(buffer, CSV, trades))
+		require.Equal(t, "pair,start,end,duration_seconds,profit,mae,mfe\n"+
+			"BTCUSDT,2022-01-01T00:00:00Z,2022-01-01T02:00:00Z,7200,50.5,0.01,0.12\n", buffer.String())
+
+		buffer.Reset()
+		require.NoError(t, Equity(buffer, CSV, equity))
+		require.Equal(t, "time,value\n2022-01-01T00:00:00Z,1000\n2022-01-01T01:00:00Z,1050.5\n", buffer.String())
+	})
+
+	t.Run("parquet", func(t *testing.T) {
+		output := bytes.NewBuffer(nil)
+		require.NoError(t, Trades(output, Parquet, trades))
+
+		file, err := buffer.NewBufferFile(output.Bytes())
+		require.NoError(t, err)
+		parquetReader, err := reader.NewParquetReader(file, new(tradeRecord), 1)
+		require.NoError(t, err)
+		defer parquetReader.ReadStop()
+
+		require.Equal(t, int64(1), parquetReader.GetNumRows())
+		records := make([]tradeRecord, 1)
+		require.NoError(t, parquetReader.Read(&records))
+		require.Equal(t, tradeRecord{Pair: "BTCUSDT", Start: start.UnixMilli(), End: start.Add(2 * time.Hour).UnixMilli(),
+			Duration: 7200, Profit: 50.5, MAE: 0.01, MFE: 0.12}, records[0])
+	})
+
+	t.Run("file", func(t *testing.T) {
+		dir := t.TempDir()
+		err := File(dir, "equity", CSV, func(w io.Writer) error {
+			return Equity(w, CSV, equity)
+		})
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(dir + "/equity.csv")
+		require.NoError(t, err)
+		require.Contains(t, string(content), "1050.5")
+
+		err = File(dir, "equity", Format("xlsx"), func(w io.Writer) error {
+			return nil
+		})
+		require.ErrorIs(t, err, ErrUnknownFormat)
+	})
+}
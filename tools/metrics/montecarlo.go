@@ -0,0 +1,206 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"gonum.org/v1/gonum/stat"
+)
+
+// MonteCarloMethod is how a simulation resamples the sequence of trades
+type MonteCarloMethod string
+
+var (
+	// MonteCarloShuffle reorders the trades, the final equity is the same and the drawdown changes
+	MonteCarloShuffle MonteCarloMethod = "SHUFFLE"
+	// MonteCarloBootstrap draws the same number of trades with replacement
+	MonteCarloBootstrap MonteCarloMethod = "BOOTSTRAP"
+	// MonteCarloSkip removes each trade with a probability, keeping the order, eg: missed signals
+	MonteCarloSkip MonteCarloMethod = "SKIP"
+)
+
+type monteCarlo struct {
+	method      MonteCarloMethod
+	simulations int
+	skip        float64
+	confidence  float64
+	seed        int64
+}
+
+type MonteCarloOption func(*monteCarlo)
+
+// WithMonteCarloMethod sets how the trades are resampled, default: MonteCarloBootstrap
+func WithMonteCarloMethod(method MonteCarloMethod) MonteCarloOption {
+	return func(m *monteCarlo) {
+		m.method = method
+	}
+}
+
+// WithSimulations sets the number of simulated sequences of trades, default: 10000
+func WithSimulations(simulations int) MonteCarloOption {
+	return func(m *monteCarlo) {
+		m.simulations = simulations
+	}
+}
+
+// WithSkipProbability sets the probability of removing a trade with MonteCarloSkip, default: 0.1
+func WithSkipProbability(probability float64) MonteCarloOption {
+	return func(m *monteCarlo) {
+		m.skip = probability
+	}
+}
+
+// WithConfidence sets the confidence of the intervals, default: 0.95
+func WithConfidence(confidence float64) MonteCarloOption {
+	return func(m *monteCarlo) {
+		m.confidence = confidence
+	}
+}
+
+// WithMonteCarloSeed sets the seed of the resampling, for reproducible simulations
+func WithMonteCarloSeed(seed int64) MonteCarloOption {
+	return func(m *monteCarlo) {
+		m.seed = seed
+	}
+}
+
+// Distribution is the result of a measure in all the simulations
+type Distribution struct {
+	BootstrapInterval
+	// Values are the measures of the simulations, sorted
+	Values []float64
+}
+
+// Percentile returns the value below which a fraction of the simulations fall, eg: 0.05
+func (d Distribution) Percentile(p float64) float64 {
+	if len(d.Values) == 0 {
+		return 0
+	}
+	return stat.Quantile(p, stat.LinInterp, d.Values, nil)
+}
+
+// MonteCarloResult is the distribution of the final equity and the maximum drawdown of the simulations
+type MonteCarloResult struct {
+	Method      MonteCarloMethod
+	Simulations int
+	Confidence  float64
+	FinalEquity Distribution
+	// MaxDrawdown is the largest fall of the equity from a peak, as a fraction of the peak
+	MaxDrawdown Distribution
+	// LossProbability is the fraction of simulations that end below the initial equity
+	LossProbability float64
+}
+
+// MonteCarlo simulates sequences of trades resampled from the profits of a backtest, in order, starting from
+// an initial equity, to estimate the confidence intervals of the final equity and the maximum drawdown
+func MonteCarlo(profits []float64, initialEquity float64, options ...MonteCarloOption) MonteCarloResult {
+	m := &monteCarlo{
+		method:      MonteCarloBootstrap,
+		simulations: 10000,
+		skip:        0.1,
+		confidence:  0.95,
+		seed:        time.Now().UnixNano(),
+	}
+	for _, option := range options {
+		option(m)
+	}
+
+	random := rand.New(rand.NewSource(m.seed))
+	finals := make([]float64, 0, m.simulations)
+	drawdowns := make([]float64, 0, m.simulations)
+	var losses int
+
+	sequence := make([]float64, 0, len(profits))
+	for i := 0; i < m.simulations; i++ {
+		sequence = m.resample(random, profits, sequence[:0])
+
+		equity, peak, maxDrawdown := initialEquity, initialEquity, 0.0
+		for _, profit := range sequence {
+			equity += profit
+			peak = math.Max(peak, equity)
+			if peak > 0 {
+				maxDrawdown = math.Max(maxDrawdown, (peak-equity)/peak)
+			}
+		}
+
+		finals = append(finals, equity)
+		drawdowns = append(drawdowns, maxDrawdown)
+		if equity < initialEquity {
+			losses++
+		}
+	}
+
+	result := MonteCarloResult{
+		Method:      m.method,
+		Simulations: m.simulations,
+		Confidence:  m.confidence,
+		FinalEquity: distribution(finals, m.confidence),
+		MaxDrawdown: distribution(drawdowns, m.confidence),
+	}
+	if m.simulations > 0 {
+		result.LossProbability = float64(losses) / float64(m.simulations)
+	}
+	return result
+}
+
+// resample appends a simulated sequence of the profits to a slice
+func (m *monteCarlo) resample(random *rand.Rand, profits, sequence []float64) []float64 {
+	switch m.method {
+	case MonteCarloShuffle:
+		sequence = append(sequence, profits...)
+		random.Shuffle(len(sequence), func(i, j int) {
+			sequence[i], sequence[j] = sequence[j], sequence[i]
+		})
+	case MonteCarloSkip:
+		for _, profit := range profits {
+			if random.Float64() >= m.skip {
+				sequence = append(sequence, profit)
+			}
+		}
+	default:
+		for range profits {
+			sequence = append(sequence, profits[random.Intn(len(profits))])
+		}
+	}
+	return sequence
+}
+
+// distribution sorts the values and returns their mean, standard deviation and confidence interval
+func distribution(values []float64, confidence float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+
+	sort.Float64s(values)
+	mean, stdDev := stat.MeanStdDev(values, nil)
+	tail := 1 - confidence
+	return Distribution{
+		BootstrapInterval: BootstrapInterval{
+			Lower:  stat.Quantile(tail/2, stat.LinInterp, values, nil),
+			Upper:  stat.Quantile(1-tail/2, stat.LinInterp, values, nil),
+			StdDev: stdDev,
+			Mean:   mean,
+		},
+		Values: values,
+	}
+}
+
+func (r MonteCarloResult) String() string {
+	buffer := bytes.NewBuffer(nil)
+	table := tablewriter.NewWriter(buffer)
+	confidence := fmt.Sprintf("%.0f%%", r.Confidence*100)
+	table.SetHeader([]string{"Monte Carlo", "Mean", "Lower " + confidence, "Upper " + confidence})
+	table.Append([]string{"Final equity", fmt.Sprintf("%.2f", r.FinalEquity.Mean),
+		fmt.Sprintf("%.2f", r.FinalEquity.Lower), fmt.Sprintf("%.2f", r.FinalEquity.Upper)})
+	table.Append([]string{"Max drawdown", fmt.Sprintf("%.1f %%", r.MaxDrawdown.Mean*100),
+		fmt.Sprintf("%.1f %%", r.MaxDrawdown.Lower*100), fmt.Sprintf("%.1f %%", r.MaxDrawdown.Upper*100)})
+	table.SetFooter([]string{fmt.Sprintf("%d x %s", r.Simulations, r.Method),
+		fmt.Sprintf("loss %.1f %%", r.LossProbability*100), "", ""})
+	table.Render()
+	return buffer.String()
+}
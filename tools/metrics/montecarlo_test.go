@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonteCarlo(t *testing.T) {
+	profits := []float64{100, -50, 200, -150, 80, -30, 120, -60}
+
+	t.Run("shuffle", func(t *testing.T) {
+		result := MonteCarlo(profits, 1000, WithMonteCarloMethod(MonteCarloShuffle),
+			WithSimulations(2000), WithMonteCarloSeed(1))
+
+		// the order does not change the final equity
+		require.Equal(t, 1210.0, result.FinalEquity.Lower)
+		require.Equal(t, 1210.0, result.FinalEquity.Upper)
+		require.Zero(t, result.LossProbability)
+
+		// the worst order loses all the losing trades in a row from the initial equity
+		require.LessOrEqual(t, result.MaxDrawdown.Upper, 290.0/1000)
+		require.Greater(t, result.MaxDrawdown.Upper, result.MaxDrawdown.Lower)
+		require.Len(t, result.MaxDrawdown.Values, 2000)
+	})
+
+	t.Run("bootstrap", func(t *testing.T) {
+		result := MonteCarlo(profits, 1000, WithSimulations(5000), WithMonteCarloSeed(1))
+		require.Equal(t, MonteCarloBootstrap, result.Method)
+		require.InDelta(t, 1210, result.FinalEquity.Mean, 10)
+		require.Less(t, result.FinalEquity.Lower, 1210.0)
+		require.Greater(t, result.FinalEquity.Upper, 1210.0)
+		require.Greater(t, result.LossProbability, 0.0)
+		require.Less(t, result.LossProbability, 0.5)
+		require.LessOrEqual(t, result.FinalEquity.Percentile(0.05), result.FinalEquity.Percentile(0.5))
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		result := MonteCarlo(profits, 1000, WithMonteCarloMethod(MonteCarloSkip), WithSkipProbability(0.5),
+			WithSimulations(5000), WithMonteCarloSeed(1))
+		require.InDelta(t, 1000+210*0.5, result.FinalEquity.Mean, 5)
+
+		none := MonteCarlo(profits, 1000, WithMonteCarloMethod(MonteCarloSkip), WithSkipProbability(0),
+			WithSimulations(10), WithMonteCarloSeed(1))
+		require.Equal(t, 1210.0, none.FinalEquity.Mean)
+		require.InDelta(t, 150.0/1250, none.MaxDrawdown.Mean, 1e-9)
+	})
+
+	t.Run("no trades", func(t *testing.T) {
+		result := MonteCarlo(nil, 1000, WithSimulations(10))
+		require.Equal(t, 1000.0, result.FinalEquity.Mean)
+		require.Zero(t, result.MaxDrawdown.Upper)
+		require.Contains(t, result.String(), "10 X BOOTSTRAP")
+	})
+}
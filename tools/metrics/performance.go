@@ -0,0 +1,263 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"gonum.org/v1/gonum/stat"
+)
+
+const year = 365 * 24 * time.Hour
+
+// Trade is a closed trade, from the opening to the closing order of the position
+type Trade struct {
+	Start  time.Time
+	End    time.Time
+	Profit float64
+	// MAE and MFE are the maximum adverse and favorable excursion of the price during the trade, as a fraction
+	// of the entry price
+	MAE float64
+	MFE float64
+}
+
+// EquityPoint is the value of the account at a time
+type EquityPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// PerformanceResult is the risk and return of a sequence of trades and the equity curve of the account
+type PerformanceResult struct {
+	Trades int
+	Wins   int
+	Losses int
+	// WinRate is the fraction of trades with profit
+	WinRate float64
+	// ProfitFactor is the gross profit over the gross loss, 10 without losses
+	ProfitFactor float64
+	// Expectancy is the average profit by trade
+	Expectancy float64
+	// Return is the total return of the equity, as a fraction of the initial equity
+	Return float64
+	// Sharpe and Sortino are the annualized ratios of the returns of the equity, by the volatility and by the
+	// downside volatility
+	Sharpe  float64
+	Sortino float64
+	// Calmar is the annualized return over the maximum drawdown
+	Calmar float64
+	// MaxDrawdown is the largest fall of the equity from a peak, as a fraction of the peak,
+	// MaxDrawdownValue is the value of this fall
+	MaxDrawdown      float64
+	MaxDrawdownValue float64
+	// MaxDrawdownDuration is the longest time the equity took to recover a previous peak, or since the peak
+	// when it did not recover
+	MaxDrawdownDuration time.Duration
+	MaxWinStreak        int
+	MaxLossStreak       int
+	// Exposure is the fraction of the period with an open position
+	Exposure float64
+	// AvgMAE and AvgMFE are the average excursions of the trades and MaxMAE the largest adverse excursion.
+	// AvgWinMAE is the average adverse excursion of the winning trades, a reference for the placement of stops.
+	AvgMAE    float64
+	AvgMFE    float64
+	MaxMAE    float64
+	AvgWinMAE float64
+}
+
+// Performance computes the metrics of closed trades, in order, and the equity curve of the account.
+// Without an equity curve, eg: live trading without a paper wallet, the ratios are zero and the drawdown
+// value and duration are measured on the cumulative profit of the trades.
+func Performance(trades []Trade, equity []EquityPoint) PerformanceResult {
+	result := PerformanceResult{Trades: len(trades)}
+
+	profits := make([]float64, 0, len(trades))
+	var winStreak, lossStreak int
+	for _, trade := range trades {
+		profits = append(profits, trade.Profit)
+		result.AvgMAE += trade.MAE
+		result.AvgMFE += trade.MFE
+		result.MaxMAE = math.Max(result.MaxMAE, trade.MAE)
+		if trade.Profit >= 0 {
+			result.AvgWinMAE += trade.MAE
+			result.Wins++
+			winStreak, lossStreak = winStreak+1, 0
+		} else {
+			result.Losses++
+			winStreak, lossStreak = 0, lossStreak+1
+		}
+		result.MaxWinStreak = int(math.Max(float64(result.MaxWinStreak), float64(winStreak)))
+		result.MaxLossStreak = int(math.Max(float64(result.MaxLossStreak), float64(lossStreak)))
+	}
+
+	if len(trades) > 0 {
+		result.WinRate = float64(result.Wins) / float64(len(trades))
+		result.ProfitFactor = ProfitFactor(profits)
+		result.Expectancy = stat.Mean(profits, nil)
+		result.AvgMAE /= float64(len(trades))
+		result.AvgMFE /= float64(len(trades))
+	}
+	if result.Wins > 0 {
+		result.AvgWinMAE /= float64(result.Wins)
+	}
+
+	curve, relative := equity, true
+	if len(curve) == 0 {
+		curve, relative = cumulativeProfit(trades), false
+	}
+	result.MaxDrawdown, result.MaxDrawdownValue, result.MaxDrawdownDuration = drawdown(curve, relative)
+	if len(curve) < 2 {
+		return result
+	}
+
+	start, end := curve[0].Time, curve[len(curve)-1].Time
+	result.Exposure = exposure(trades, start, end)
+	if relative && equity[0].Value > 0 {
+		result.Return = equity[len(equity)-1].Value/equity[0].Value - 1
+		result.Sharpe, result.Sortino = ratios(equity)
+
+		if years := float64(end.Sub(start)) / float64(year); years > 0 && result.MaxDrawdown > 0 {
+			annual := math.Pow(1+result.Return, 1/years) - 1
+			result.Calmar = annual / result.MaxDrawdown
+		}
+	}
+	return result
+}
+
+// cumulativeProfit returns the sum of the profits of the trades by closing time, from zero at the first trade
+func cumulativeProfit(trades []Trade) []EquityPoint {
+	if len(trades) == 0 {
+		return nil
+	}
+
+	points := []EquityPoint{{Time: trades[0].Start}}
+	var total float64
+	for _, trade := range trades {
+		total += trade.Profit
+		points = append(points, EquityPoint{Time: trade.End, Value: total})
+	}
+	return points
+}
+
+// drawdown returns the largest fall of the equity from a peak as a fraction of the peak, with its value,
+// and the longest time below a peak. Curves that are not relative to an equity, eg: cumulative profits,
+// return the largest fall in value.
+func drawdown(equity []EquityPoint, relative bool) (maxDrawdown, value float64, duration time.Duration) {
+	if len(equity) == 0 {
+		return 0, 0, 0
+	}
+
+	peak := equity[0]
+	for _, point := range equity {
+		if point.Value >= peak.Value {
+			peak = point
+		}
+
+		fall := peak.Value - point.Value
+		if relative && peak.Value > 0 && fall/peak.Value > maxDrawdown {
+			maxDrawdown, value = fall/peak.Value, fall
+		} else if !relative && fall > value {
+			value = fall
+		}
+		if below := point.Time.Sub(peak.Time); below > duration {
+			duration = below
+		}
+	}
+	return maxDrawdown, value, duration
+}
+
+// ratios returns the annualized Sharpe and Sortino ratios of the returns of the equity, without risk-free rate
+func ratios(equity []EquityPoint) (sharpe, sortino float64) {
+	returns := make([]float64, 0, len(equity)-1)
+	var downside float64
+	for i := 1; i < len(equity); i++ {
+		if equity[i-1].Value <= 0 {
+			continue
+		}
+		value := equity[i].Value/equity[i-1].Value - 1
+		returns = append(returns, value)
+		downside += math.Pow(math.Min(value, 0), 2)
+	}
+	if len(returns) < 2 {
+		return 0, 0
+	}
+
+	interval := equity[len(equity)-1].Time.Sub(equity[0].Time) / time.Duration(len(equity)-1)
+	if interval <= 0 {
+		return 0, 0
+	}
+	annualization := math.Sqrt(float64(year) / float64(interval))
+
+	mean, stdDev := stat.MeanStdDev(returns, nil)
+	if stdDev > 0 {
+		sharpe = mean / stdDev * annualization
+	}
+	if downside = math.Sqrt(downside / float64(len(returns))); downside > 0 {
+		sortino = mean / downside * annualization
+	}
+	return sharpe, sortino
+}
+
+// exposure returns the fraction of a period covered by the trades, overlapping trades are counted once
+func exposure(trades []Trade, start, end time.Time) float64 {
+	if !end.After(start) || len(trades) == 0 {
+		return 0
+	}
+
+	intervals := make([]Trade, len(trades))
+	copy(intervals, trades)
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].Start.Before(intervals[j].Start)
+	})
+
+	var (
+		held    time.Duration
+		current time.Time
+	)
+	for _, trade := range intervals {
+		from, to := trade.Start, trade.End
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if from.Before(current) {
+			from = current
+		}
+		if to.After(from) {
+			held += to.Sub(from)
+			current = to
+		}
+	}
+	return float64(held) / float64(end.Sub(start))
+}
+
+func (r PerformanceResult) String() string {
+	buffer := bytes.NewBuffer(nil)
+	table := tablewriter.NewWriter(buffer)
+	table.AppendBulk([][]string{
+		{"Trades", strconv.Itoa(r.Trades)},
+		{"% Win", fmt.Sprintf("%.1f", r.WinRate*100)},
+		{"Pr.Fact", fmt.Sprintf("%.2f", r.ProfitFactor)},
+		{"Expectancy", fmt.Sprintf("%.4f", r.Expectancy)},
+		{"Return", fmt.Sprintf("%.2f %%", r.Return*100)},
+		{"Sharpe", fmt.Sprintf("%.2f", r.Sharpe)},
+		{"Sortino", fmt.Sprintf("%.2f", r.Sortino)},
+		{"Calmar", fmt.Sprintf("%.2f", r.Calmar)},
+		{"Max DD", fmt.Sprintf("%.2f %% (%.4f)", r.MaxDrawdown*100, r.MaxDrawdownValue)},
+		{"DD Duration", r.MaxDrawdownDuration.String()},
+		{"Win Streak", strconv.Itoa(r.MaxWinStreak)},
+		{"Loss Streak", strconv.Itoa(r.MaxLossStreak)},
+		{"Exposure", fmt.Sprintf("%.1f %%", r.Exposure*100)},
+		{"MAE / MFE", fmt.Sprintf("%.2f %% / %.2f %%", r.AvgMAE*100, r.AvgMFE*100)},
+		{"Max MAE", fmt.Sprintf("%.2f %% (%.2f %% wins)", r.MaxMAE*100, r.AvgWinMAE*100)},
+	})
+	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_RIGHT})
+	table.Render()
+	return buffer.String()
+}
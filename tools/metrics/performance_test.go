@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPerformance(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := func(days int) time.Time {
+		return start.Add(time.Duration(days) * 24 * time.Hour)
+	}
+
+	trades := []Trade{
+		{Start: day(0), End: day(2), Profit: 100},
+		{Start: day(3), End: day(4), Profit: 50},
+		{Start: day(4), End: day(6), Profit: -80},
+		{Start: day(5), End: day(7), Profit: -20},
+		{Start: day(8), End: day(9), Profit: 60},
+	}
+	equity := []EquityPoint{
+		{Time: day(0), Value: 1000},
+		{Time: day(2), Value: 1100},
+		{Time: day(4), Value: 1150},
+		{Time: day(6), Value: 1070},
+		{Time: day(7), Value: 1050},
+		{Time: day(9), Value: 1110},
+		{Time: day(10), Value: 1110},
+	}
+
+	t.Run("with equity", func(t *testing.T) {
+		result := Performance(trades, equity)
+		require.Equal(t, 5, result.Trades)
+		require.Equal(t, 3, result.Wins)
+		require.Equal(t, 2, result.Losses)
+		require.Equal(t, 0.6, result.WinRate)
+		require.InDelta(t, 210.0/100, result.ProfitFactor, 1e-9)
+		require.InDelta(t, 22.0, result.Expectancy, 1e-9)
+		require.Equal(t, 2, result.MaxWinStreak)
+		require.Equal(t, 2, result.MaxLossStreak)
+		require.InDelta(t, 0.11, result.Return, 1e-9)
+
+		// from the peak of 1150 to 1050, not recovered at the end
+		require.InDelta(t, 100.0/1150, result.MaxDrawdown, 1e-9)
+		require.InDelta(t, 100.0, result.MaxDrawdownValue, 1e-9)
+		require.Equal(t, 6*24*time.Hour, result.MaxDrawdownDuration)
+
+		// positions from day 0 to 2, 3 to 7 and 8 to 9, overlaps are counted once
+		require.InDelta(t, 0.7, result.Exposure, 1e-9)
+
+		require.Greater(t, result.Sharpe, 0.0)
+		require.Greater(t, result.Sortino, result.Sharpe)
+		require.Greater(t, result.Calmar, 0.0)
+		require.Contains(t, result.String(), "Sortino")
+	})
+
+	t.Run("without equity", func(t *testing.T) {
+		result := Performance(trades, nil)
+		require.Zero(t, result.Sharpe)
+		require.Zero(t, result.MaxDrawdown)
+		require.InDelta(t, 100.0, result.MaxDrawdownValue, 1e-9)
+		require.InDelta(t, 0.7/0.9, result.Exposure, 1e-9)
+	})
+
+	t.Run("excursion", func(t *testing.T) {
+		result := Performance([]Trade{
+			{Profit: 10, MAE: 0.01, MFE: 0.05},
+			{Profit: -5, MAE: 0.04, MFE: 0.01},
+			{Profit: 20, MAE: 0.03, MFE: 0.06},
+		}, nil)
+		require.InDelta(t, 0.08/3, result.AvgMAE, 1e-9)
+		require.InDelta(t, 0.04, result.AvgMFE, 1e-9)
+		require.Equal(t, 0.04, result.MaxMAE)
+		require.InDelta(t, 0.02, result.AvgWinMAE, 1e-9)
+	})
+
+	t.Run("no trades", func(t *testing.T) {
+		result := Performance(nil, nil)
+		require.Zero(t, result.Trades)
+		require.Zero(t, result.WinRate)
+		require.Zero(t, result.Exposure)
+	})
+}
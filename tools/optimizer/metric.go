@@ -0,0 +1,102 @@
+package optimizer
+
+import (
+	"math"
+	"time"
+
+	"gonum.org/v1/gonum/stat"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/strategytest"
+)
+
+// Metric measures a strategy run, used to rank the parameters, see Profit, Sharpe and Drawdown
+type Metric struct {
+	Name    string
+	Measure func(result *strategytest.Result) float64
+	// Lower ranks lower values first, eg: drawdown
+	Lower bool
+}
+
+var (
+	// Profit ranks by the profit of the trades in the quote asset
+	Profit = Metric{Name: "profit", Measure: profit}
+	// Sharpe ranks by the annualized Sharpe ratio of the changes of the equity by candle
+	Sharpe = Metric{Name: "sharpe", Measure: sharpe}
+	// Drawdown ranks by the lowest maximum drawdown of the equity in the quote asset
+	Drawdown = Metric{Name: "drawdown", Measure: drawdown, Lower: true}
+)
+
+// Score returns the measure of a run, higher is better
+func (m Metric) Score(result *strategytest.Result) float64 {
+	if m.Lower {
+		return -m.Measure(result)
+	}
+	return m.Measure(result)
+}
+
+// equity returns the profit of the trades of a run by candle, in the quote asset, with the open position
+// valued at the candle close. Fees are not included.
+func equity(result *strategytest.Result) []float64 {
+	trades := result.Trades()
+	values := make([]float64, 0, len(result.Candles))
+
+	var cash, position float64
+	next := 0
+	for _, candle := range result.Candles {
+		for next < len(trades) && !trades[next].UpdatedAt.After(candle.Time) {
+			trade := trades[next]
+			if trade.Side == model.SideTypeBuy {
+				cash -= trade.Price * trade.Quantity
+				position += trade.Quantity
+			} else {
+				cash += trade.Price * trade.Quantity
+				position -= trade.Quantity
+			}
+			next++
+		}
+		values = append(values, cash+position*candle.Close)
+	}
+	return values
+}
+
+func profit(result *strategytest.Result) float64 {
+	values := equity(result)
+	if len(values) == 0 {
+		return 0
+	}
+	return values[len(values)-1]
+}
+
+func sharpe(result *strategytest.Result) float64 {
+	values := equity(result)
+	if len(values) < 3 {
+		return 0
+	}
+
+	changes := make([]float64, 0, len(values)-1)
+	for i := 1; i < len(values); i++ {
+		changes = append(changes, values[i]-values[i-1])
+	}
+
+	mean, stdDev := stat.MeanStdDev(changes, nil)
+	if stdDev == 0 {
+		return 0
+	}
+
+	interval := result.Candles[1].Time.Sub(result.Candles[0].Time)
+	if interval <= 0 {
+		return mean / stdDev
+	}
+	periods := float64(365*24*time.Hour) / float64(interval)
+	return mean / stdDev * math.Sqrt(periods)
+}
+
+func drawdown(result *strategytest.Result) float64 {
+	var peak, maxDrawdown float64
+	for _, value := range equity(result) {
+		peak = math.Max(peak, value)
+		maxDrawdown = math.Max(maxDrawdown, peak-value)
+	}
+	return maxDrawdown
+}
@@ -0,0 +1,265 @@
+// Package optimizer searches the parameters of a strategy: it backtests every combination of the values of
+// the parameter ranges, of one or several pairs, in parallel with isolated paper wallets, and ranks the results
+// by a metric, eg: profit, Sharpe ratio or drawdown.
+// Large parameter spaces can be explored with an evolution strategy instead, see Optimizer.Search.
+package optimizer
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/strategy"
+	"github.com/bengalm/ninjabot/tools/strategytest"
+)
+
+// Params is a set of strategy parameters, by name
+type Params map[string]float64
+
+func (p Params) String() string {
+	values := make([]string, 0, len(p))
+	for _, name := range p.names() {
+		values = append(values, fmt.Sprintf("%s=%g", name, p[name]))
+	}
+	return strings.Join(values, " ")
+}
+
+// names returns the parameter names, sorted
+func (p Params) names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Range is the values of a parameter explored by the optimization
+type Range struct {
+	Name   string
+	Values []float64
+}
+
+// Steps returns a range of values from min to max, inclusive, eg: Steps("period", 10, 30, 5)
+func Steps(name string, min, max, step float64) Range {
+	values := make([]float64, 0)
+	if step > 0 {
+		for i := 0; min+float64(i)*step <= max+step*1e-9; i++ {
+			values = append(values, min+float64(i)*step)
+		}
+	}
+	return Range{Name: name, Values: values}
+}
+
+// Combinations returns all the sets of parameters of the ranges, the Cartesian product of their values
+func Combinations(ranges []Range) []Params {
+	combinations := []Params{{}}
+	for _, r := range ranges {
+		next := make([]Params, 0, len(combinations)*len(r.Values))
+		for _, params := range combinations {
+			for _, value := range r.Values {
+				combination := Params{r.Name: value}
+				for name, v := range params {
+					combination[name] = v
+				}
+				next = append(next, combination)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// Factory creates a strategy with a set of parameters
+type Factory func(params Params) strategy.Strategy
+
+// Optimizer is the grid search of the parameters of a strategy, see New
+type Optimizer struct {
+	factory     Factory
+	ranges      []Range
+	metric      Metric
+	parallelism int
+	start       time.Time
+	end         time.Time
+	options     []strategytest.Option
+}
+
+type Option func(*Optimizer)
+
+// WithMetric sets the metric used to rank the results, default: Profit
+func WithMetric(metric Metric) Option {
+	return func(o *Optimizer) {
+		o.metric = metric
+	}
+}
+
+// WithParallelism sets the number of backtests executed at the same time, default: number of CPUs
+func WithParallelism(parallelism int) Option {
+	return func(o *Optimizer) {
+		o.parallelism = parallelism
+	}
+}
+
+// WithPeriod limits the backtests to the candles with open time in [start, end), the previous candles are only
+// used for the warmup period of the strategy. A zero time is not limited.
+func WithPeriod(start, end time.Time) Option {
+	return func(o *Optimizer) {
+		o.start = start
+		o.end = end
+	}
+}
+
+// WithRunOptions sets the options of the backtests, eg: strategytest.WithFee(0.001, 0.001)
+func WithRunOptions(options ...strategytest.Option) Option {
+	return func(o *Optimizer) {
+		o.options = options
+	}
+}
+
+// New creates an optimizer of the strategies of a factory, exploring all the combinations of the values of
+// the ranges
+func New(factory Factory, ranges []Range, options ...Option) *Optimizer {
+	o := &Optimizer{
+		factory:     factory,
+		ranges:      ranges,
+		metric:      Profit,
+		parallelism: runtime.NumCPU(),
+	}
+	for _, option := range options {
+		option(o)
+	}
+	if o.parallelism < 1 {
+		o.parallelism = 1
+	}
+	return o
+}
+
+// Backtest executes the strategy of a set of parameters in the period of the optimizer, preceded by the candles
+// of its warmup period, so it trades from the start of the period
+func (o *Optimizer) Backtest(params Params, candles []model.Candle) (*strategytest.Result, error) {
+	str := o.factory(params)
+
+	first := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].Time.Before(o.start)
+	})
+	last := len(candles)
+	if !o.end.IsZero() {
+		last = sort.Search(len(candles), func(i int) bool {
+			return !candles[i].Time.Before(o.end)
+		})
+	}
+
+	first -= str.WarmupPeriod()
+	if first < 0 {
+		first = 0
+	}
+	if first > last {
+		first = last
+	}
+	return strategytest.Run(str, candles[first:last], o.options...)
+}
+
+// Run backtests all the combinations of parameters over the candles of a pair, sorted by time, and returns
+// the results ranked by the metric
+func (o *Optimizer) Run(candles []model.Candle) (Results, error) {
+	results, err := o.evaluateAll(jobs(Combinations(o.ranges), candles))
+	if err != nil {
+		return nil, err
+	}
+	results.sort()
+	return results, nil
+}
+
+// RunPairs backtests all the combinations of parameters over the candles of several pairs, by pair. All the
+// backtests share the workers, each one with its own paper wallet. Returns the results of all the pairs, ranked
+// by the metric, see Results.Pair.
+func (o *Optimizer) RunPairs(candles map[string][]model.Candle) (Results, error) {
+	pairs := make([]string, 0, len(candles))
+	for pair := range candles {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+
+	combinations := Combinations(o.ranges)
+	all := make([]job, 0, len(pairs)*len(combinations))
+	for _, pair := range pairs {
+		all = append(all, jobs(combinations, candles[pair])...)
+	}
+
+	results, err := o.evaluateAll(all)
+	if err != nil {
+		return nil, err
+	}
+	results.sort()
+	return results, nil
+}
+
+// job is a backtest of a set of parameters over the candles of a pair
+type job struct {
+	params  Params
+	candles []model.Candle
+}
+
+// jobs returns the backtests of the sets of parameters over the same candles
+func jobs(combinations []Params, candles []model.Candle) []job {
+	all := make([]job, 0, len(combinations))
+	for _, params := range combinations {
+		all = append(all, job{params: params, candles: candles})
+	}
+	return all
+}
+
+// evaluateAll executes backtests in parallel, the results are in the order of the jobs
+func (o *Optimizer) evaluateAll(all []job) (Results, error) {
+	results := make(Results, len(all))
+	errs := make([]error, len(all))
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < o.parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range queue {
+				results[index], errs[index] = o.evaluate(all[index].params, all[index].candles)
+			}
+		}()
+	}
+
+	for i := range all {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil && len(all[i].candles) > 0 {
+			return nil, fmt.Errorf("backtest %s %s: %w", all[i].candles[0].Pair, all[i].params, err)
+		} else if err != nil {
+			return nil, fmt.Errorf("backtest %s: %w", all[i].params, err)
+		}
+	}
+	return results, nil
+}
+
+// evaluate backtests a set of parameters and measures the result
+func (o *Optimizer) evaluate(params Params, candles []model.Candle) (Result, error) {
+	result, err := o.Backtest(params, candles)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Pair:     result.Pair,
+		Params:   params,
+		Profit:   profit(result),
+		Sharpe:   sharpe(result),
+		Drawdown: drawdown(result),
+		Trades:   len(result.Trades()),
+		Score:    o.metric.Score(result),
+	}, nil
+}
@@ -0,0 +1,185 @@
+package optimizer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/strategy"
+	"github.com/bengalm/ninjabot/tools/strategytest"
+)
+
+// momentum holds a position while the close is above the close of a number of candles before
+type momentum struct {
+	lookback int
+}
+
+func (m momentum) Timeframe() string {
+	return "1h"
+}
+
+func (m momentum) WarmupPeriod() int {
+	return m.lookback + 1
+}
+
+func (m momentum) Indicators(_ *model.Dataframe) []strategy.ChartIndicator {
+	return nil
+}
+
+func (m momentum) OnCandle(df *model.Dataframe, broker service.Broker) {
+	asset, _, err := broker.Position(df.Pair)
+	if err != nil {
+		return
+	}
+
+	rising := df.Close.Last(0) > df.Close.Last(m.lookback)
+	if rising && asset == 0 {
+		_, _ = broker.CreateOrderMarket(model.SideTypeBuy, df.Pair, 1, false)
+	} else if !rising && asset > 0 {
+		_, _ = broker.CreateOrderMarket(model.SideTypeSell, df.Pair, asset, false)
+	}
+}
+
+func factory(params Params) strategy.Strategy {
+	return momentum{lookback: int(params["lookback"])}
+}
+
+func TestSteps(t *testing.T) {
+	require.Equal(t, []float64{10, 15, 20}, Steps("period", 10, 20, 5).Values)
+	require.Equal(t, []float64{0.1, 0.2, 0.30000000000000004}, Steps("rate", 0.1, 0.3, 0.1).Values)
+	require.Empty(t, Steps("period", 10, 20, 0).Values)
+}
+
+func TestCombinations(t *testing.T) {
+	combinations := Combinations([]Range{{Name: "a", Values: []float64{1, 2}}, {Name: "b", Values: []float64{3, 4, 5}}})
+	require.Len(t, combinations, 6)
+	require.Equal(t, "a=1 b=3", combinations[0].String())
+	require.Equal(t, "a=2 b=5", combinations[5].String())
+}
+
+func TestMetrics(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	candle := func(hours int, close float64) model.Candle {
+		return model.Candle{Pair: "BTCUSDT", Time: start.Add(time.Duration(hours) * time.Hour), Close: close}
+	}
+	order := func(hours int, side model.SideType, price float64) model.Order {
+		return model.Order{
+			Pair:      "BTCUSDT",
+			Side:      side,
+			Type:      model.OrderTypeMarket,
+			Status:    model.OrderStatusTypeFilled,
+			Price:     price,
+			Quantity:  1,
+			UpdatedAt: start.Add(time.Duration(hours) * time.Hour),
+		}
+	}
+
+	// buy at 100, peak at 130, sell at 110 and hold cash
+	result := &strategytest.Result{
+		Pair: "BTCUSDT",
+		Candles: []model.Candle{
+			candle(0, 100), candle(1, 130), candle(2, 110), candle(3, 90),
+		},
+		Orders: []model.Order{
+			order(0, model.SideTypeBuy, 100),
+			order(2, model.SideTypeSell, 110),
+		},
+	}
+
+	require.Equal(t, []float64{0, 30, 10, 10}, equity(result))
+	require.Equal(t, 10.0, Profit.Score(result))
+	require.Equal(t, 20.0, Drawdown.Measure(result))
+	require.Equal(t, -20.0, Drawdown.Score(result))
+	require.Greater(t, Sharpe.Score(result), 0.0)
+}
+
+func TestOptimizer_Run(t *testing.T) {
+	candles := strategytest.NewGenerator("BTCUSDT", strategytest.WithSeed(1)).
+		Trend(100, 0.5).Range(100, 0.05).Trend(100, -0.3).Candles()
+	ranges := []Range{Steps("lookback", 2, 10, 4)}
+
+	t.Run("ranked", func(t *testing.T) {
+		for _, metric := range []Metric{Profit, Sharpe, Drawdown} {
+			results, err := New(factory, ranges, WithMetric(metric), WithParallelism(2)).Run(candles)
+			require.NoError(t, err)
+			require.Len(t, results, 3)
+
+			for i := 1; i < len(results); i++ {
+				require.GreaterOrEqual(t, results[i-1].Score, results[i].Score)
+			}
+
+			best, ok := results.Best()
+			require.True(t, ok)
+			require.Equal(t, results[0], best)
+		}
+	})
+
+	t.Run("parallel results match sequential", func(t *testing.T) {
+		parallel, err := New(factory, ranges, WithParallelism(4)).Run(candles)
+		require.NoError(t, err)
+		sequential, err := New(factory, ranges, WithParallelism(1)).Run(candles)
+		require.NoError(t, err)
+		require.Equal(t, sequential, parallel)
+	})
+
+	t.Run("period", func(t *testing.T) {
+		start, end := candles[100].Time, candles[200].Time
+		o := New(factory, ranges, WithPeriod(start, end))
+
+		result, err := o.Backtest(Params{"lookback": 6}, candles)
+		require.NoError(t, err)
+		require.Equal(t, candles[100-7].Time, result.Candles[0].Time)
+		require.Equal(t, candles[199].Time, result.Candles[len(result.Candles)-1].Time)
+	})
+
+	t.Run("pairs", func(t *testing.T) {
+		other := strategytest.NewGenerator("ETHUSDT", strategytest.WithSeed(2)).
+			Trend(100, -0.2).Range(100, 0.1).Trend(100, 0.4).Candles()
+
+		results, err := New(factory, ranges, WithParallelism(3)).RunPairs(map[string][]model.Candle{
+			"BTCUSDT": candles,
+			"ETHUSDT": other,
+		})
+		require.NoError(t, err)
+		require.Len(t, results, 6)
+		for i := 1; i < len(results); i++ {
+			require.GreaterOrEqual(t, results[i-1].Score, results[i].Score)
+		}
+
+		// each pair is backtested in isolation, as a single pair run
+		single, err := New(factory, ranges).Run(candles)
+		require.NoError(t, err)
+		require.Equal(t, single, results.Pair("BTCUSDT"))
+		require.Len(t, results.Pair("ETHUSDT"), 3)
+	})
+
+	t.Run("no candles", func(t *testing.T) {
+		_, err := New(factory, ranges).Run(nil)
+		require.ErrorIs(t, err, strategytest.ErrNoCandles)
+	})
+}
+
+func TestResults_WriteCSV(t *testing.T) {
+	results := Results{
+		{Pair: "BTCUSDT", Params: Params{"period": 10, "rate": 0.5}, Profit: 120.5, Sharpe: 1.25, Drawdown: 30,
+			Trades: 4, Score: 120.5},
+		{Pair: "ETHUSDT", Params: Params{"period": 20, "rate": 0.5}, Profit: -10, Sharpe: -0.5, Drawdown: 45.25,
+			Trades: 2, Score: -10},
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	require.NoError(t, results.WriteCSV(buffer))
+
+	rows, err := csv.NewReader(buffer).ReadAll()
+	require.NoError(t, err)
+	require.Equal(t, [][]string{
+		{"rank", "pair", "period", "rate", "profit", "sharpe", "drawdown", "trades"},
+		{"1", "BTCUSDT", "10", "0.5", "120.50", "1.2500", "30.00", "4"},
+		{"2", "ETHUSDT", "20", "0.5", "-10.00", "-0.5000", "45.25", "2"},
+	}, rows)
+}
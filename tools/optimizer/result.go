@@ -0,0 +1,83 @@
+package optimizer
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Result is the backtest of a set of parameters, with its metrics in the quote asset
+type Result struct {
+	Pair     string
+	Params   Params
+	Profit   float64
+	Sharpe   float64
+	Drawdown float64
+	Trades   int
+	// Score is the value of the metric of the optimizer, higher is better
+	Score float64
+}
+
+// Results are the backtests of an optimization, ranked by score
+type Results []Result
+
+// Best returns the result with the highest score
+func (r Results) Best() (Result, bool) {
+	if len(r) == 0 {
+		return Result{}, false
+	}
+	return r[0], true
+}
+
+// Pair returns the results of a pair, ranked
+func (r Results) Pair(pair string) Results {
+	results := make(Results, 0)
+	for _, result := range r {
+		if result.Pair == pair {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// sort ranks the results by score, keeping the order of equal scores
+func (r Results) sort() {
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Score > r[j].Score
+	})
+}
+
+// WriteCSV writes the ranked results with a header, the pair and one column by parameter followed by the metrics
+func (r Results) WriteCSV(w io.Writer) error {
+	var names []string
+	if len(r) > 0 {
+		names = r[0].Params.names()
+	}
+
+	writer := csv.NewWriter(w)
+	header := append([]string{"rank", "pair"}, names...)
+	header = append(header, "profit", "sharpe", "drawdown", "trades")
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for i, result := range r {
+		row := []string{strconv.Itoa(i + 1), result.Pair}
+		for _, name := range names {
+			row = append(row, strconv.FormatFloat(result.Params[name], 'f', -1, 64))
+		}
+		row = append(row,
+			strconv.FormatFloat(result.Profit, 'f', 2, 64),
+			strconv.FormatFloat(result.Sharpe, 'f', 4, 64),
+			strconv.FormatFloat(result.Drawdown, 'f', 2, 64),
+			strconv.Itoa(result.Trades),
+		)
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,346 @@
+package optimizer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+var ErrInvalidRange = errors.New("invalid parameter range")
+
+// SearchState is the progress of a search, serializable to JSON to resume it later, see WithResume
+type SearchState struct {
+	Generation int       `json:"generation"`
+	Mean       []float64 `json:"mean"`
+	Sigma      []float64 `json:"sigma"`
+	Stalled    int       `json:"stalled"`
+	// Results are the parameters backtested over the whole period
+	Results Results `json:"results"`
+	// Rejected are the parameters stopped early, see WithEarlyStop
+	Rejected []string `json:"rejected"`
+}
+
+type search struct {
+	population  int
+	generations int
+	patience    int
+	seed        int64
+	earlyStop   float64
+	state       *SearchState
+	checkpoint  func(state SearchState)
+}
+
+type SearchOption func(*search)
+
+// WithPopulation sets the number of candidates of each generation, default: 4 + 3 ln(parameters), as CMA-ES
+func WithPopulation(population int) SearchOption {
+	return func(s *search) {
+		s.population = population
+	}
+}
+
+// WithGenerations sets the maximum number of generations, default: 50
+func WithGenerations(generations int) SearchOption {
+	return func(s *search) {
+		s.generations = generations
+	}
+}
+
+// WithPatience stops the search after a number of generations without improving the best score, default: 10
+func WithPatience(patience int) SearchOption {
+	return func(s *search) {
+		s.patience = patience
+	}
+}
+
+// WithSeed sets the seed of the random sampling, a search with the same seed explores the same candidates
+func WithSeed(seed int64) SearchOption {
+	return func(s *search) {
+		s.seed = seed
+	}
+}
+
+// WithEarlyStop backtests the candidates first in a fraction of the period, eg: 0.3, and discards the half
+// of the generation with the worst scores without backtesting the rest of the period
+func WithEarlyStop(fraction float64) SearchOption {
+	return func(s *search) {
+		s.earlyStop = fraction
+	}
+}
+
+// WithResume continues a search from a saved state, see WithCheckpoint
+func WithResume(state SearchState) SearchOption {
+	return func(s *search) {
+		s.state = &state
+	}
+}
+
+// WithCheckpoint calls a function with the state of the search after each generation, eg: to save it to a file
+func WithCheckpoint(checkpoint func(state SearchState)) SearchOption {
+	return func(s *search) {
+		s.checkpoint = checkpoint
+	}
+}
+
+// Search explores the parameters with an evolution strategy instead of all the combinations, for large
+// parameter spaces. Each generation samples candidates around the mean of the best candidates of the previous
+// generation, adapting the spread of each parameter to the spread of the best candidates, like a diagonal
+// CMA-ES. Values are sampled between the minimum and maximum of each range and rounded to the nearest value of
+// the range. Returns the results of the candidates backtested over the whole period, ranked by the metric.
+func (o *Optimizer) Search(candles []model.Candle, options ...SearchOption) (Results, error) {
+	for _, r := range o.ranges {
+		if len(r.Values) == 0 {
+			return nil, fmt.Errorf("%w: %s without values", ErrInvalidRange, r.Name)
+		}
+	}
+
+	s := &search{
+		population:  4 + int(3*math.Log(math.Max(1, float64(len(o.ranges))))),
+		generations: 50,
+		patience:    10,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	if s.population < 2 {
+		s.population = 2
+	}
+
+	state := s.state
+	if state != nil {
+		state.Mean = append([]float64(nil), state.Mean...)
+		state.Sigma = append([]float64(nil), state.Sigma...)
+	} else {
+		state = &SearchState{Mean: make([]float64, len(o.ranges)), Sigma: make([]float64, len(o.ranges))}
+		for i := range o.ranges {
+			state.Mean[i], state.Sigma[i] = 0.5, 0.3
+		}
+	}
+	if len(state.Mean) != len(o.ranges) || len(state.Sigma) != len(o.ranges) {
+		return nil, fmt.Errorf("%w: state of %d parameters, expected %d", ErrInvalidRange, len(state.Mean),
+			len(o.ranges))
+	}
+
+	evaluated := make(map[string]Result, len(state.Results))
+	for _, result := range state.Results {
+		evaluated[result.Params.String()] = result
+	}
+	rejected := make(map[string]bool, len(state.Rejected))
+	for _, key := range state.Rejected {
+		rejected[key] = true
+	}
+
+	for state.Generation < s.generations && state.Stalled < s.patience &&
+		(len(state.Results) == 0 || !o.converged(state)) {
+
+		random := rand.New(rand.NewSource(s.seed + int64(state.Generation)))
+		points := make([][]float64, s.population)
+		candidates := make([]Params, s.population)
+		for i := range points {
+			points[i] = make([]float64, len(o.ranges))
+			for d := range o.ranges {
+				points[i][d] = math.Max(0, math.Min(1, state.Mean[d]+state.Sigma[d]*random.NormFloat64()))
+			}
+			candidates[i] = o.params(points[i])
+		}
+
+		scores, err := o.scoreGeneration(candidates, candles, s.earlyStop, evaluated, rejected)
+		if err != nil {
+			return nil, err
+		}
+
+		previous := math.Inf(-1)
+		if best, ok := state.Results.Best(); ok {
+			previous = best.Score
+		}
+
+		state.Results = make(Results, 0, len(evaluated))
+		for _, result := range evaluated {
+			state.Results = append(state.Results, result)
+		}
+		sort.SliceStable(state.Results, func(i, j int) bool {
+			return state.Results[i].Params.String() < state.Results[j].Params.String()
+		})
+		state.Results.sort()
+
+		state.Rejected = make([]string, 0, len(rejected))
+		for key := range rejected {
+			state.Rejected = append(state.Rejected, key)
+		}
+		sort.Strings(state.Rejected)
+
+		if best, ok := state.Results.Best(); ok && best.Score > previous {
+			state.Stalled = 0
+		} else {
+			state.Stalled++
+		}
+
+		adapt(state, points, scores)
+		state.Generation++
+		if s.checkpoint != nil {
+			s.checkpoint(*state)
+		}
+	}
+
+	results := make(Results, len(state.Results))
+	copy(results, state.Results)
+	return results, nil
+}
+
+// scoreGeneration returns the scores of the candidates of a generation, backtesting the candidates not
+// evaluated before. Rejected candidates score minus infinity.
+func (o *Optimizer) scoreGeneration(candidates []Params, candles []model.Candle, earlyStop float64,
+	evaluated map[string]Result, rejected map[string]bool) ([]float64, error) {
+
+	pending := make([]Params, 0, len(candidates))
+	seen := make(map[string]bool)
+	for _, params := range candidates {
+		key := params.String()
+		if _, ok := evaluated[key]; !ok && !rejected[key] && !seen[key] {
+			pending = append(pending, params)
+			seen[key] = true
+		}
+	}
+
+	if earlyStop > 0 && earlyStop < 1 && len(pending) > 1 {
+		prefix := *o
+		prefix.end = o.prefixEnd(candles, earlyStop)
+		results, err := prefix.evaluateAll(jobs(pending, candles))
+		if err != nil {
+			return nil, err
+		}
+
+		order := make([]int, len(results))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return results[order[i]].Score > results[order[j]].Score
+		})
+
+		survivors := make([]Params, 0, len(pending))
+		for rank, i := range order {
+			if rank < (len(order)+1)/2 {
+				survivors = append(survivors, pending[i])
+			} else {
+				rejected[pending[i].String()] = true
+			}
+		}
+		pending = survivors
+	}
+
+	results, err := o.evaluateAll(jobs(pending, candles))
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		evaluated[result.Params.String()] = result
+	}
+
+	scores := make([]float64, len(candidates))
+	for i, params := range candidates {
+		if result, ok := evaluated[params.String()]; ok {
+			scores[i] = result.Score
+		} else {
+			scores[i] = math.Inf(-1)
+		}
+	}
+	return scores, nil
+}
+
+// prefixEnd returns the end of the first fraction of the candles of the period
+func (o *Optimizer) prefixEnd(candles []model.Candle, fraction float64) time.Time {
+	first := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].Time.Before(o.start)
+	})
+	last := len(candles)
+	if !o.end.IsZero() {
+		last = sort.Search(len(candles), func(i int) bool {
+			return !candles[i].Time.Before(o.end)
+		})
+	}
+
+	index := first + int(float64(last-first)*fraction)
+	if index >= last {
+		return o.end
+	}
+	return candles[index].Time
+}
+
+// params returns the parameters of a point of the search space, each coordinate from zero to one is rounded
+// to the nearest value of its range
+func (o *Optimizer) params(point []float64) Params {
+	params := make(Params, len(o.ranges))
+	for d, r := range o.ranges {
+		min, max := r.Values[0], r.Values[0]
+		for _, value := range r.Values {
+			min, max = math.Min(min, value), math.Max(max, value)
+		}
+
+		target := min + point[d]*(max-min)
+		nearest := r.Values[0]
+		for _, value := range r.Values {
+			if math.Abs(value-target) < math.Abs(nearest-target) {
+				nearest = value
+			}
+		}
+		params[r.Name] = nearest
+	}
+	return params
+}
+
+// converged returns true when the spread of all the parameters is below half the distance between values
+func (o *Optimizer) converged(state *SearchState) bool {
+	for d, r := range o.ranges {
+		if len(r.Values) > 1 && state.Sigma[d] > 0.5/float64(len(r.Values)-1) {
+			return false
+		}
+	}
+	return true
+}
+
+// adapt moves the mean to the weighted mean of the best half of the candidates, and the spread of each
+// parameter towards the spread of the best candidates around the previous mean
+func adapt(state *SearchState, points [][]float64, scores []float64) {
+	order := make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	selected := make([]int, 0, len(order)/2)
+	for _, i := range order[:len(order)/2] {
+		if !math.IsInf(scores[i], -1) {
+			selected = append(selected, i)
+		}
+	}
+	if len(selected) == 0 {
+		return
+	}
+
+	// logarithmic weights, the best candidates move the mean further
+	weights := make([]float64, len(selected))
+	var total float64
+	for rank := range selected {
+		weights[rank] = math.Log(float64(len(selected))+0.5) - math.Log(float64(rank+1))
+		total += weights[rank]
+	}
+
+	const learningRate = 0.5
+	for d := range state.Mean {
+		var mean, variance float64
+		for rank, i := range selected {
+			mean += weights[rank] / total * points[i][d]
+			variance += weights[rank] / total * math.Pow(points[i][d]-state.Mean[d], 2)
+		}
+		state.Mean[d] = mean
+		state.Sigma[d] = (1-learningRate)*state.Sigma[d] + learningRate*math.Sqrt(variance)
+	}
+}
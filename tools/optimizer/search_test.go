@@ -0,0 +1,79 @@
+package optimizer
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/tools/strategytest"
+)
+
+func TestOptimizer_Search(t *testing.T) {
+	candles := strategytest.NewGenerator("BTCUSDT", strategytest.WithSeed(1)).
+		Trend(100, 0.5).Range(100, 0.05).Trend(100, -0.3).Candles()
+	ranges := []Range{Steps("lookback", 2, 40, 1)}
+
+	t.Run("finds the best parameters of the grid", func(t *testing.T) {
+		grid, err := New(factory, ranges).Run(candles)
+		require.NoError(t, err)
+
+		results, err := New(factory, ranges).Search(candles, WithSeed(1), WithPopulation(8))
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		require.Less(t, len(results), len(grid))
+
+		best, _ := results.Best()
+		require.InDelta(t, grid[0].Score, best.Score, math.Abs(grid[0].Score)*0.1)
+		for i := 1; i < len(results); i++ {
+			require.GreaterOrEqual(t, results[i-1].Score, results[i].Score)
+		}
+	})
+
+	t.Run("early stop", func(t *testing.T) {
+		var state SearchState
+		results, err := New(factory, ranges).Search(candles, WithSeed(1), WithPopulation(8),
+			WithEarlyStop(0.3), WithCheckpoint(func(s SearchState) { state = s }))
+		require.NoError(t, err)
+		require.NotEmpty(t, results)
+		require.NotEmpty(t, state.Rejected)
+		for _, result := range results {
+			require.NotContains(t, state.Rejected, result.Params.String())
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		complete, err := New(factory, ranges).Search(candles, WithSeed(2), WithGenerations(6), WithPatience(100))
+		require.NoError(t, err)
+
+		var saved []byte
+		_, err = New(factory, ranges).Search(candles, WithSeed(2), WithGenerations(3), WithPatience(100),
+			WithCheckpoint(func(s SearchState) {
+				saved, err = json.Marshal(s)
+				require.NoError(t, err)
+			}))
+		require.NoError(t, err)
+
+		var state SearchState
+		require.NoError(t, json.Unmarshal(saved, &state))
+		require.Equal(t, 3, state.Generation)
+
+		resumed, err := New(factory, ranges).Search(candles, WithSeed(2), WithGenerations(6), WithPatience(100),
+			WithResume(state))
+		require.NoError(t, err)
+		require.Equal(t, complete, resumed)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		_, err := New(factory, []Range{{Name: "lookback"}}).Search(candles)
+		require.ErrorIs(t, err, ErrInvalidRange)
+	})
+}
+
+func TestOptimizer_params(t *testing.T) {
+	o := New(factory, []Range{Steps("period", 10, 30, 5), {Name: "rate", Values: []float64{0.5, 0.1, 0.9}}})
+	require.Equal(t, Params{"period": 10, "rate": 0.1}, o.params([]float64{0, 0}))
+	require.Equal(t, Params{"period": 20, "rate": 0.5}, o.params([]float64{0.5, 0.5}))
+	require.Equal(t, Params{"period": 25, "rate": 0.9}, o.params([]float64{0.7, 1}))
+}
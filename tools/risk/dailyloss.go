@@ -0,0 +1,149 @@
+package risk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// DailyLossLimit is the maximum realized loss of a day, net of fees. With both an amount and a percentage,
+// the lowest limit applies, and zero values disable a limit.
+type DailyLossLimit struct {
+	// Amount is the maximum loss in the quote of the pairs
+	Amount float64
+	// Percent is the maximum loss as a fraction of the equity at the start of the day, eg: 0.05 for 5%
+	Percent float64
+	// Session defines the timezone and the start of the days, default: UTC days starting at 00:00
+	Session model.Session
+}
+
+// DailyLossGuard stops opening positions when the realized loss of the day reaches a limit, pausing the
+// entries of all pairs until the next day. Open positions are kept, and can still be closed.
+type DailyLossGuard struct {
+	config
+	mtx        sync.Mutex
+	controller Controller
+	limit      DailyLossLimit
+	// day is the start of the current day, with the realized profit and the equity at that time
+	day      time.Time
+	baseline float64
+	equity   float64
+	halted   bool
+	pairs    pairSet
+	holds    holds
+}
+
+// NewDailyLossGuard creates a guard of the realized loss of each day
+func NewDailyLossGuard(controller Controller, limit DailyLossLimit, options ...Option) *DailyLossGuard {
+	return &DailyLossGuard{
+		config:     newConfig(options),
+		controller: controller,
+		limit:      limit,
+		pairs:      make(pairSet),
+		holds:      newHolds("daily_loss"),
+	}
+}
+
+// OnCandle checks the day rollover and the loss with complete candles, so the guard follows the candle time
+// in backtests
+func (g *DailyLossGuard) OnCandle(candle model.Candle) {
+	if candle.Complete {
+		g.evaluate(candle.Time, candle.Pair)
+	}
+}
+
+// OnPosition checks the loss after the fills of a position, eg: subscribed to `event.Positions`
+func (g *DailyLossGuard) OnPosition(position model.PositionPnL) {
+	g.evaluate(position.UpdatedAt, position.Pair)
+}
+
+func (g *DailyLossGuard) evaluate(t time.Time, pair string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	g.pairs.add(pair)
+	if day := g.limit.Session.Day(t); day.After(g.day) {
+		g.rollover(t, day, pair)
+	}
+
+	if g.halted {
+		// pairs first seen after the halt are paused until the next day too
+		if _, ok := g.holds.pairs[pair]; !ok {
+			g.holds.hold(g.controller, pair, model.PauseEntries)
+		}
+		return
+	}
+
+	loss := g.baseline - realized(g.controller.Positions())
+	limit := g.maxLoss()
+	if limit <= 0 || loss < limit {
+		return
+	}
+
+	g.halted = true
+	pairs := g.pairs.sorted()
+	g.alert(t, "", "daily_loss", fmt.Sprintf("daily loss of %.2f reached the limit of %.2f, entries of %v paused "+
+		"until %s", loss, limit, pairs, g.limit.Session.NextDay(g.day).Format(time.RFC3339)))
+	for _, pair := range pairs {
+		g.holds.hold(g.controller, pair, model.PauseEntries)
+	}
+}
+
+// rollover starts a new day, releasing the pauses held by the guard in the previous day. Pairs paused by the
+// operator or other guards, eg: the drawdown guard, stay paused.
+func (g *DailyLossGuard) rollover(t, day time.Time, pair string) {
+	g.day = day
+	g.baseline = realized(g.controller.Positions())
+	if g.limit.Percent > 0 {
+		_, quote := exchange.SplitAssetQuote(pair)
+		equity, err := g.controller.Equity(quote)
+		if err != nil {
+			log.Error(err)
+		}
+		g.equity = equity
+	}
+
+	if g.halted {
+		g.halted = false
+		pairs := g.holds.release(g.controller)
+		g.alert(t, "", "daily_loss", fmt.Sprintf("new day, pauses of %v released", pairs))
+	}
+}
+
+// maxLoss returns the loss limit of the current day
+func (g *DailyLossGuard) maxLoss() float64 {
+	limit := g.limit.Amount
+	if g.limit.Percent > 0 && g.equity > 0 {
+		if byEquity := g.limit.Percent * g.equity; limit <= 0 || byEquity < limit {
+			limit = byEquity
+		}
+	}
+	return limit
+}
+
+// Halted returns true if the entries are paused until the next day
+func (g *DailyLossGuard) Halted() bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.halted
+}
+
+// Loss returns the realized loss of the current day, negative for profits
+func (g *DailyLossGuard) Loss() float64 {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.baseline - realized(g.controller.Positions())
+}
+
+// realized returns the realized profit of positions, net of fees
+func realized(positions []model.PositionPnL) float64 {
+	var total float64
+	for _, position := range positions {
+		total += position.RealizedPnL - position.Fees
+	}
+	return total
+}
@@ -0,0 +1,136 @@
+package risk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestDailyLossGuard(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("amount", func(t *testing.T) {
+		controller := &fakeController{paused: make(map[string]model.PauseMode)}
+		notifier := &fakeNotifier{}
+		guard := NewDailyLossGuard(controller, DailyLossLimit{Amount: 100}, WithNotifier(notifier))
+
+		candle := func(t time.Time, pair string) {
+			guard.OnCandle(model.Candle{Time: t, Pair: pair, Complete: true})
+		}
+		fill := func(t time.Time, pair string, realized float64) {
+			controller.positions = []model.PositionPnL{{Pair: pair, RealizedPnL: realized, UpdatedAt: t}}
+			guard.OnPosition(controller.positions[0])
+		}
+
+		candle(start.Add(time.Hour), "ETHUSDT")
+		fill(start.Add(2*time.Hour), "BTCUSDT", -60)
+		require.False(t, guard.Halted())
+		require.InDelta(t, 60, guard.Loss(), 1e-9)
+
+		// limit reached: entries of all pairs paused
+		fill(start.Add(3*time.Hour), "BTCUSDT", -110)
+		require.True(t, guard.Halted())
+		require.Equal(t, model.PauseEntries, controller.paused["BTCUSDT"])
+		require.Equal(t, model.PauseEntries, controller.paused["ETHUSDT"])
+		require.Len(t, notifier.messages, 1)
+
+		// pairs first seen after the halt are paused until the next day
+		candle(start.Add(4*time.Hour), "SOLUSDT")
+		require.Equal(t, model.PauseEntries, controller.paused["SOLUSDT"])
+		require.Len(t, notifier.messages, 1)
+
+		// resumed at rollover, with the losses of the previous day discarded
+		candle(start.Add(24*time.Hour), "BTCUSDT")
+		require.False(t, guard.Halted())
+		require.Empty(t, controller.paused)
+		require.Zero(t, guard.Loss())
+		require.Len(t, notifier.messages, 2)
+	})
+
+	t.Run("percent in a session", func(t *testing.T) {
+		controller := &fakeController{paused: make(map[string]model.PauseMode), equity: 1000}
+		session := model.Session{Location: time.FixedZone("UTC-3", -3*60*60)}
+		guard := NewDailyLossGuard(controller, DailyLossLimit{Amount: 100, Percent: 0.05, Session: session})
+
+		controller.positions = []model.PositionPnL{{Pair: "BTCUSDT", RealizedPnL: 20, Fees: 5}}
+		guard.OnCandle(model.Candle{Time: start, Pair: "BTCUSDT", Complete: true})
+
+		// the loss is net of fees, limited by the percentage of the equity
+		controller.positions = []model.PositionPnL{{Pair: "BTCUSDT", RealizedPnL: -20, Fees: 10,
+			UpdatedAt: start.Add(time.Hour)}}
+		guard.OnPosition(controller.positions[0])
+		require.InDelta(t, 45, guard.Loss(), 1e-9)
+		require.False(t, guard.Halted())
+
+		controller.positions[0].Fees = 15
+		guard.OnPosition(controller.positions[0])
+		require.True(t, guard.Halted())
+
+		// the day starts at 03:00 UTC
+		guard.OnCandle(model.Candle{Time: start.Add(2 * time.Hour), Pair: "BTCUSDT", Complete: true})
+		require.True(t, guard.Halted())
+		guard.OnCandle(model.Candle{Time: start.Add(3 * time.Hour), Pair: "BTCUSDT", Complete: true})
+		require.False(t, guard.Halted())
+	})
+
+	t.Run("day start", func(t *testing.T) {
+		controller := &fakeController{paused: make(map[string]model.PauseMode)}
+		guard := NewDailyLossGuard(controller, DailyLossLimit{Amount: 100, Session: model.Session{DayStart: 8 * time.Hour}})
+
+		guard.OnCandle(model.Candle{Time: start.Add(9 * time.Hour), Pair: "BTCUSDT", Complete: true})
+		controller.positions = []model.PositionPnL{{Pair: "BTCUSDT", RealizedPnL: -100,
+			UpdatedAt: start.Add(10 * time.Hour)}}
+		guard.OnPosition(controller.positions[0])
+		require.True(t, guard.Halted())
+
+		// the trading day starts at 08:00, midnight does not start a new day
+		guard.OnCandle(model.Candle{Time: start.Add(24 * time.Hour), Pair: "BTCUSDT", Complete: true})
+		require.True(t, guard.Halted())
+		guard.OnCandle(model.Candle{Time: start.Add(32 * time.Hour), Pair: "BTCUSDT", Complete: true})
+		require.False(t, guard.Halted())
+	})
+}
+
+func TestDailyLossGuard_OverlappingHalts(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	controller := &fakeController{paused: make(map[string]model.PauseMode), equity: 1000}
+	dailyLoss := NewDailyLossGuard(controller, DailyLossLimit{Amount: 100})
+	drawdown := NewDrawdownGuard(controller, 0.2)
+
+	candle := func(t time.Time, pair string, equity float64) {
+		controller.equity = equity
+		candle := model.Candle{Time: t, Pair: pair, Complete: true}
+		drawdown.OnCandle(candle)
+		dailyLoss.OnCandle(candle)
+	}
+
+	candle(start, "BTCUSDT", 1000)
+	candle(start, "ETHUSDT", 1000)
+	controller.Pause("ETHUSDT", model.PauseAll)
+
+	// the daily loss halts first, then the drawdown halts the same pairs
+	controller.positions = []model.PositionPnL{{Pair: "BTCUSDT", RealizedPnL: -150,
+		UpdatedAt: start.Add(23 * time.Hour)}}
+	dailyLoss.OnPosition(controller.positions[0])
+	require.True(t, dailyLoss.Halted())
+	require.Equal(t, model.PauseEntries, controller.paused["BTCUSDT"])
+	require.Equal(t, model.PauseAll, controller.paused["ETHUSDT"])
+
+	candle(start.Add(23*time.Hour+30*time.Minute), "BTCUSDT", 750)
+	require.True(t, drawdown.Halted())
+
+	// the new day releases the daily loss only, the drawdown halt and the operator pause are kept
+	candle(start.Add(24*time.Hour), "BTCUSDT", 750)
+	require.False(t, dailyLoss.Halted())
+	require.True(t, drawdown.Halted())
+	require.Equal(t, model.PauseEntries, controller.paused["BTCUSDT"])
+	require.Equal(t, model.PauseAll, controller.paused["ETHUSDT"])
+
+	// the drawdown halt is lifted by hand, keeping the operator pause
+	drawdown.Resume()
+	require.NotContains(t, controller.paused, "BTCUSDT")
+	require.Equal(t, model.PauseAll, controller.paused["ETHUSDT"])
+}
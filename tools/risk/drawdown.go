@@ -0,0 +1,129 @@
+package risk
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// DrawdownGuard is a kill switch on the drawdown of the account equity from its peak. When the drawdown
+// reaches the maximum, the positions of all pairs are flattened, their open orders are canceled and new
+// entries are paused until the guard is resumed.
+type DrawdownGuard struct {
+	config
+	mtx         sync.Mutex
+	controller  Controller
+	maxDrawdown float64
+	peak        float64
+	equity      float64
+	halted      bool
+	last        time.Time
+	pairs       pairSet
+	holds       holds
+}
+
+// NewDrawdownGuard creates a guard with a maximum drawdown as a fraction of the peak equity, eg: 0.2 for 20%
+func NewDrawdownGuard(controller Controller, maxDrawdown float64, options ...Option) *DrawdownGuard {
+	return &DrawdownGuard{
+		config:      newConfig(options),
+		controller:  controller,
+		maxDrawdown: maxDrawdown,
+		pairs:       make(pairSet),
+		holds:       newHolds("drawdown"),
+	}
+}
+
+// OnCandle evaluates the equity once per complete candle time, in the quote of the candle pair. It must be
+// called after the order controller receives the candle, so the equity is valued with its close price.
+func (g *DrawdownGuard) OnCandle(candle model.Candle) {
+	if !candle.Complete {
+		return
+	}
+
+	g.mtx.Lock()
+	g.pairs.add(candle.Pair)
+	evaluated := !candle.Time.After(g.last)
+	if !evaluated {
+		g.last = candle.Time
+	}
+	g.mtx.Unlock()
+	if evaluated {
+		return
+	}
+
+	_, quote := exchange.SplitAssetQuote(candle.Pair)
+	equity, err := g.controller.Equity(quote)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	g.OnEquity(candle.Time, equity)
+}
+
+// OnEquity updates the peak with a new equity value, halting the bot when the maximum drawdown is reached
+func (g *DrawdownGuard) OnEquity(t time.Time, equity float64) {
+	g.mtx.Lock()
+	g.equity = equity
+	if equity > g.peak {
+		g.peak = equity
+	}
+	drawdown := g.drawdown()
+	if g.halted || g.maxDrawdown <= 0 || drawdown < g.maxDrawdown {
+		g.mtx.Unlock()
+		return
+	}
+	g.halted = true
+	pairs := g.pairs.sorted()
+	peak := g.peak
+	for _, pair := range pairs {
+		// entries are paused before flattening, so strategies do not reopen the position
+		g.holds.hold(g.controller, pair, model.PauseEntries)
+	}
+	g.mtx.Unlock()
+
+	g.alert(t, "", "drawdown", fmt.Sprintf("drawdown of %.2f%% from peak %.2f to %.2f, flattening %v",
+		drawdown*100, peak, equity, pairs))
+	for _, pair := range pairs {
+		if err := g.controller.Flatten(pair); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// Resume releases the pauses held by the guard, restarting the peak from the current equity. Pairs paused by
+// the operator or other guards stay paused. Pairs resumed individually, eg: with the telegram /resume command,
+// do not reset the guard.
+func (g *DrawdownGuard) Resume() {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	g.halted = false
+	g.peak = g.equity
+	pairs := g.holds.release(g.controller)
+	log.Infof("[RISK] drawdown guard resumed with peak %.2f, released %v", g.equity, pairs)
+}
+
+// Halted returns true if the maximum drawdown was reached and the guard was not resumed
+func (g *DrawdownGuard) Halted() bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.halted
+}
+
+// Drawdown returns the current drawdown as a fraction of the peak equity
+func (g *DrawdownGuard) Drawdown() float64 {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.drawdown()
+}
+
+func (g *DrawdownGuard) drawdown() float64 {
+	if g.peak <= 0 {
+		return 0
+	}
+	return (g.peak - g.equity) / g.peak
+}
@@ -0,0 +1,173 @@
+package risk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/event"
+	"github.com/bengalm/ninjabot/model"
+)
+
+type fakeController struct {
+	equity    float64
+	flattened []string
+	// paused is the effective pause of the pairs, the strongest of the operator pause and the holds
+	paused    map[string]model.PauseMode
+	operator  map[string]model.PauseMode
+	holds     map[string]map[string]model.PauseMode
+	positions []model.PositionPnL
+}
+
+func (f *fakeController) Equity(string) (float64, error) {
+	return f.equity, nil
+}
+
+func (f *fakeController) Flatten(pair string) error {
+	f.flattened = append(f.flattened, pair)
+	return nil
+}
+
+func (f *fakeController) Pause(pair string, mode model.PauseMode) {
+	if f.operator == nil {
+		f.operator = make(map[string]model.PauseMode)
+	}
+	f.operator[pair] = mode
+	f.update(pair)
+}
+
+func (f *fakeController) Resume(pair string) {
+	delete(f.operator, pair)
+	delete(f.holds, pair)
+	f.update(pair)
+}
+
+func (f *fakeController) Hold(pair, owner string, mode model.PauseMode) {
+	if f.holds == nil {
+		f.holds = make(map[string]map[string]model.PauseMode)
+	}
+	if f.holds[pair] == nil {
+		f.holds[pair] = make(map[string]model.PauseMode)
+	}
+	f.holds[pair][owner] = mode
+	f.update(pair)
+}
+
+func (f *fakeController) Release(pair, owner string) {
+	delete(f.holds[pair], owner)
+	f.update(pair)
+}
+
+func (f *fakeController) update(pair string) {
+	mode := f.operator[pair]
+	for _, hold := range f.holds[pair] {
+		if hold > mode {
+			mode = hold
+		}
+	}
+	if mode == model.PauseNone {
+		delete(f.paused, pair)
+		return
+	}
+	f.paused[pair] = mode
+}
+
+func (f *fakeController) Positions() []model.PositionPnL {
+	return f.positions
+}
+
+type fakeNotifier struct {
+	messages []string
+}
+
+func (f *fakeNotifier) Notify(message string) {
+	f.messages = append(f.messages, message)
+}
+
+func (f *fakeNotifier) OnOrder(model.Order) {}
+
+func (f *fakeNotifier) OnError(error) {}
+
+func TestDrawdownGuard(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	controller := &fakeController{paused: make(map[string]model.PauseMode)}
+	notifier := &fakeNotifier{}
+	bus := event.NewBus()
+	risks := make([]event.RiskEvent, 0)
+	event.Subscribe(bus, event.Risks, func(e event.RiskEvent) {
+		risks = append(risks, e)
+	})
+	guard := NewDrawdownGuard(controller, 0.2, WithNotifier(notifier), WithEventBus(bus))
+
+	candle := func(minutes int, pair string, equity float64) {
+		controller.equity = equity
+		guard.OnCandle(model.Candle{Time: start.Add(time.Duration(minutes) * time.Minute), Pair: pair,
+			Complete: true})
+	}
+
+	candle(0, "BTCUSDT", 1000)
+	candle(0, "ETHUSDT", 1000)
+	candle(1, "BTCUSDT", 1200)
+	candle(2, "BTCUSDT", 1000)
+	require.False(t, guard.Halted())
+	require.InDelta(t, 1.0/6, guard.Drawdown(), 1e-9)
+
+	// partial candles and candles of an evaluated time are ignored
+	controller.equity = 900
+	guard.OnCandle(model.Candle{Time: start.Add(3 * time.Minute), Pair: "BTCUSDT"})
+	guard.OnCandle(model.Candle{Time: start.Add(2 * time.Minute), Pair: "ETHUSDT", Complete: true})
+	require.False(t, guard.Halted())
+
+	// 25% from the peak: all pairs are paused and flattened once
+	candle(3, "BTCUSDT", 900)
+	require.True(t, guard.Halted())
+	require.Equal(t, []string{"BTCUSDT", "ETHUSDT"}, controller.flattened)
+	require.Equal(t, model.PauseEntries, controller.paused["BTCUSDT"])
+	require.Equal(t, model.PauseEntries, controller.paused["ETHUSDT"])
+	require.Len(t, notifier.messages, 1)
+	require.Len(t, risks, 1)
+	require.Equal(t, "drawdown", risks[0].Kind)
+
+	candle(4, "BTCUSDT", 800)
+	require.Len(t, controller.flattened, 2)
+
+	// resumed with the peak restarted from the current equity
+	guard.Resume()
+	require.False(t, guard.Halted())
+	require.Empty(t, controller.paused)
+	require.Zero(t, guard.Drawdown())
+
+	candle(5, "BTCUSDT", 700)
+	require.False(t, guard.Halted())
+	candle(6, "BTCUSDT", 640)
+	require.True(t, guard.Halted())
+	require.Len(t, controller.flattened, 4)
+}
+
+func TestDrawdownGuard_Pauses(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	controller := &fakeController{paused: make(map[string]model.PauseMode)}
+	guard := NewDrawdownGuard(controller, 0.2)
+
+	candle := func(minutes int, pair string, equity float64) {
+		controller.equity = equity
+		guard.OnCandle(model.Candle{Time: start.Add(time.Duration(minutes) * time.Minute), Pair: pair,
+			Complete: true})
+	}
+
+	candle(0, "BTCUSDT", 1000)
+	candle(0, "ETHUSDT", 1000)
+	controller.Pause("ETHUSDT", model.PauseAll)
+
+	// the pause of the operator is not weakened by the halt
+	candle(1, "BTCUSDT", 700)
+	require.True(t, guard.Halted())
+	require.Equal(t, model.PauseEntries, controller.paused["BTCUSDT"])
+	require.Equal(t, model.PauseAll, controller.paused["ETHUSDT"])
+
+	// resuming the guard only lifts its own pauses
+	guard.Resume()
+	require.NotContains(t, controller.paused, "BTCUSDT")
+	require.Equal(t, model.PauseAll, controller.paused["ETHUSDT"])
+}
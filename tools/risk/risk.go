@@ -0,0 +1,110 @@
+// Package risk provides guards that watch the account of the bot and act on the order controller when
+// a risk limit is reached, eg: flattening positions and pausing entries on a maximum drawdown.
+package risk
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bengalm/ninjabot/event"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+// Controller is the order controller acted on by the guards, eg: `order.Controller`
+type Controller interface {
+	Equity(quote string) (float64, error)
+	Flatten(pair string) error
+	Hold(pair, owner string, mode model.PauseMode)
+	Release(pair, owner string)
+	Positions() []model.PositionPnL
+}
+
+// config is shared by the guards of the package
+type config struct {
+	notifier service.Notifier
+	bus      *event.Bus
+}
+
+type Option func(*config)
+
+// WithNotifier sets a notifier to receive the alerts of a guard
+func WithNotifier(notifier service.Notifier) Option {
+	return func(c *config) {
+		c.notifier = notifier
+	}
+}
+
+// WithEventBus publishes the alerts of a guard to the `event.Risks` topic of a bus
+func WithEventBus(bus *event.Bus) Option {
+	return func(c *config) {
+		c.bus = bus
+	}
+}
+
+func newConfig(options []Option) config {
+	var c config
+	for _, option := range options {
+		option(&c)
+	}
+	return c
+}
+
+// alert logs a risk event, notifies it and publishes it to the event bus
+func (c config) alert(t time.Time, pair, kind, message string) {
+	log.Warnf("[RISK] %s", message)
+	if c.notifier != nil {
+		c.notifier.Notify(fmt.Sprintf("[RISK] %s", message))
+	}
+	event.Publish(c.bus, event.Risks, event.RiskEvent{
+		Time:    t,
+		Pair:    pair,
+		Kind:    kind,
+		Message: message,
+	})
+}
+
+// pairSet is the set of pairs seen by a guard, acted on when the guard halts or resumes
+type pairSet map[string]struct{}
+
+func (p pairSet) add(pair string) {
+	p[pair] = struct{}{}
+}
+
+func (p pairSet) sorted() []string {
+	pairs := make([]string, 0, len(p))
+	for pair := range p {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// holds are the pauses held by a guard, so the guard only releases the pairs it paused. The controller keeps
+// the strongest of the pauses of the guards and the operator, so a guard never weakens another pause.
+type holds struct {
+	owner string
+	pairs pairSet
+}
+
+func newHolds(owner string) holds {
+	return holds{owner: owner, pairs: make(pairSet)}
+}
+
+// hold pauses a pair on behalf of the guard
+func (h holds) hold(controller Controller, pair string, mode model.PauseMode) {
+	controller.Hold(pair, h.owner, mode)
+	h.pairs.add(pair)
+}
+
+// release removes the pauses held by the guard, returning the released pairs
+func (h holds) release(controller Controller) []string {
+	pairs := h.pairs.sorted()
+	for _, pair := range pairs {
+		controller.Release(pair, h.owner)
+		delete(h.pairs, pair)
+	}
+	return pairs
+}
@@ -0,0 +1,114 @@
+// Package sizing computes the quantity of new positions, eg: a fixed fraction of the equity or a quantity
+// scaled by the volatility of the pair, so strategies do not hand-compute quantities. Quantities are rounded
+// to the lot size of the pair by the broker, see `order.Controller.Size`.
+package sizing
+
+import (
+	"math"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// Request is the context of a position size, see `model.SizeRequest`
+type Request = model.SizeRequest
+
+// Sizer returns the quantity of a new position, in the base asset of the pair, before lot size rounding
+type Sizer = model.Sizer
+
+// FixedQuote sizes positions with a fixed amount of the quote asset, eg: 100 USDT
+type FixedQuote struct {
+	Amount float64
+}
+
+func (f FixedQuote) Size(request Request) float64 {
+	if request.Price <= 0 {
+		return 0
+	}
+	return f.Amount / request.Price
+}
+
+// FixedFraction sizes positions with a fraction of the equity, eg: 0.1 for 10%
+type FixedFraction struct {
+	Fraction float64
+}
+
+func (f FixedFraction) Size(request Request) float64 {
+	if request.Price <= 0 {
+		return 0
+	}
+	return f.Fraction * request.Equity / request.Price
+}
+
+// Volatility sizes positions to risk a fraction of the equity over a move of a multiple of the ATR, so
+// volatile pairs get smaller positions, eg: Volatility{Risk: 0.01, Multiplier: 2}
+type Volatility struct {
+	Risk       float64
+	Multiplier float64
+}
+
+func (v Volatility) Size(request Request) float64 {
+	multiplier := v.Multiplier
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	if request.ATR <= 0 {
+		return 0
+	}
+	return v.Risk * request.Equity / (request.ATR * multiplier)
+}
+
+// Kelly sizes positions with the Kelly criterion of a win rate and a payoff ratio, the average win over the
+// average loss. The Kelly fraction is scaled by Fraction, eg: 0.5 for half Kelly, and limited by Max.
+type Kelly struct {
+	WinRate     float64
+	PayoffRatio float64
+	Fraction    float64
+	Max         float64
+}
+
+// Optimal returns the fraction of the equity of the Kelly criterion, zero without edge
+func (k Kelly) Optimal() float64 {
+	if k.PayoffRatio <= 0 {
+		return 0
+	}
+	return math.Max(k.WinRate-(1-k.WinRate)/k.PayoffRatio, 0)
+}
+
+func (k Kelly) Size(request Request) float64 {
+	if request.Price <= 0 {
+		return 0
+	}
+
+	fraction := k.Optimal()
+	if k.Fraction > 0 {
+		fraction *= k.Fraction
+	}
+	if k.Max > 0 {
+		fraction = math.Min(fraction, k.Max)
+	}
+	return fraction * request.Equity / request.Price
+}
+
+// Round rounds a quantity down to the lot size of a pair, limited to the maximum quantity. Quantities below
+// the minimum quantity are rounded to zero.
+func Round(info model.AssetInfo, quantity float64) float64 {
+	if quantity <= 0 {
+		return 0
+	}
+
+	if info.StepSize > 0 {
+		// the epsilon avoids rounding down exact multiples by float errors, eg: 0.3 / 0.1
+		quantity = math.Floor(quantity/info.StepSize+1e-9) * info.StepSize
+		if info.BaseAssetPrecision > 0 {
+			precision := math.Pow10(info.BaseAssetPrecision)
+			quantity = math.Round(quantity*precision) / precision
+		}
+	}
+	if info.MaxQuantity > 0 {
+		quantity = math.Min(quantity, info.MaxQuantity)
+	}
+	if quantity < info.MinQuantity {
+		return 0
+	}
+	return quantity
+}
@@ -0,0 +1,39 @@
+package sizing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+func TestSizers(t *testing.T) {
+	request := Request{Pair: "BTCUSDT", Price: 100, Equity: 10000, ATR: 5}
+
+	require.InDelta(t, 2.5, FixedQuote{Amount: 250}.Size(request), 1e-9)
+	require.InDelta(t, 10, FixedFraction{Fraction: 0.1}.Size(request), 1e-9)
+	// 1% of the equity over a move of 2 ATRs
+	require.InDelta(t, 10, Volatility{Risk: 0.01, Multiplier: 2}.Size(request), 1e-9)
+	require.Zero(t, Volatility{Risk: 0.01}.Size(Request{Price: 100, Equity: 10000}))
+
+	kelly := Kelly{WinRate: 0.6, PayoffRatio: 2}
+	require.InDelta(t, 0.4, kelly.Optimal(), 1e-9)
+	require.InDelta(t, 40, kelly.Size(request), 1e-9)
+	require.InDelta(t, 20, Kelly{WinRate: 0.6, PayoffRatio: 2, Fraction: 0.5}.Size(request), 1e-9)
+	require.InDelta(t, 10, Kelly{WinRate: 0.6, PayoffRatio: 2, Max: 0.1}.Size(request), 1e-9)
+	require.Zero(t, Kelly{WinRate: 0.3, PayoffRatio: 1}.Size(request))
+
+	require.Zero(t, FixedQuote{Amount: 250}.Size(Request{}))
+}
+
+func TestRound(t *testing.T) {
+	info := model.AssetInfo{StepSize: 0.1, MinQuantity: 0.2, MaxQuantity: 5, BaseAssetPrecision: 1}
+
+	require.Equal(t, 1.2, Round(info, 1.29))
+	require.Equal(t, 0.3, Round(info, 0.3))
+	require.Equal(t, 5.0, Round(info, 7))
+	require.Zero(t, Round(info, 0.15))
+	require.Zero(t, Round(info, -1))
+	require.Equal(t, 1.2345, Round(model.AssetInfo{}, 1.2345))
+}
@@ -0,0 +1,68 @@
+package strategytest
+
+import (
+	"math"
+	"testing"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// tolerance is the relative difference accepted when comparing prices and quantities
+const tolerance = 1e-6
+
+func equal(a, b float64) bool {
+	return math.Abs(a-b) <= tolerance*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// ExpectTrades checks the number of filled orders
+func ExpectTrades(t testing.TB, result *Result, trades int) {
+	t.Helper()
+	if filled := len(result.Trades()); filled != trades {
+		t.Errorf("expected %d trades, got %d", trades, filled)
+	}
+}
+
+// ExpectSide checks the number of filled orders of a given side
+func ExpectSide(t testing.TB, result *Result, side model.SideType, trades int) {
+	t.Helper()
+	filled := 0
+	for _, order := range result.Trades() {
+		if order.Side == side {
+			filled++
+		}
+	}
+	if filled != trades {
+		t.Errorf("expected %d %s trades, got %d", trades, side, filled)
+	}
+}
+
+// ExpectStopHit checks that a stop order with a given stop price was filled
+func ExpectStopHit(t testing.TB, result *Result, price float64) {
+	t.Helper()
+	for _, order := range result.Trades() {
+		if (order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit) &&
+			order.Stop != nil && equal(*order.Stop, price) {
+			return
+		}
+	}
+	t.Errorf("expected stop hit at %f", price)
+}
+
+// ExpectNoStopHit checks that no stop order was filled
+func ExpectNoStopHit(t testing.TB, result *Result) {
+	t.Helper()
+	for _, order := range result.Trades() {
+		if order.Type == model.OrderTypeStopLoss || order.Type == model.OrderTypeStopLossLimit {
+			t.Errorf("unexpected stop hit at %f", order.Price)
+			return
+		}
+	}
+}
+
+// ExpectPosition checks the final size of the asset position
+func ExpectPosition(t testing.TB, result *Result, size float64) {
+	t.Helper()
+	if position := result.Position(); !equal(position, size) {
+		t.Errorf("expected position of %f, got %f", size, position)
+	}
+}
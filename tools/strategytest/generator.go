@@ -0,0 +1,175 @@
+package strategytest
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+// rangePeriod is the number of candles of a full oscillation in a range market
+const rangePeriod = 20
+
+// Generator creates synthetic candles for strategy tests. Market scenarios are chained,
+// each one starting at the price where the previous one stopped, eg:
+//
+//	candles := strategytest.NewGenerator("BTCUSDT").Trend(50, 0.2).FlashCrash(0.3, 5).Range(30, 0.05).Candles()
+type Generator struct {
+	pair      string
+	timeframe time.Duration
+	time      time.Time
+	price     float64
+	volume    float64
+	noise     float64
+	rand      *rand.Rand
+	candles   []model.Candle
+}
+
+type GeneratorOption func(*Generator)
+
+// WithStart sets the time of the first candle, default: 2022-01-01 UTC
+func WithStart(start time.Time) GeneratorOption {
+	return func(g *Generator) {
+		g.time = start
+	}
+}
+
+// WithTimeframe sets the interval between candles, default: 1 hour
+func WithTimeframe(timeframe time.Duration) GeneratorOption {
+	return func(g *Generator) {
+		g.timeframe = timeframe
+	}
+}
+
+// WithPrice sets the initial price, default: 100
+func WithPrice(price float64) GeneratorOption {
+	return func(g *Generator) {
+		g.price = price
+	}
+}
+
+// WithVolume sets the volume of each candle, default: 1000
+func WithVolume(volume float64) GeneratorOption {
+	return func(g *Generator) {
+		g.volume = volume
+	}
+}
+
+// WithNoise sets the maximum size of candle wicks, as a fraction of the price, default: 0.002.
+// Use zero noise to get candles with high and low equal to the open and close prices.
+func WithNoise(noise float64) GeneratorOption {
+	return func(g *Generator) {
+		g.noise = noise
+	}
+}
+
+// WithSeed sets the seed of the wick generator, the same seed always generates the same candles
+func WithSeed(seed int64) GeneratorOption {
+	return func(g *Generator) {
+		g.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+func NewGenerator(pair string, options ...GeneratorOption) *Generator {
+	g := &Generator{
+		pair:      pair,
+		timeframe: time.Hour,
+		time:      time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		price:     100,
+		volume:    1000,
+		noise:     0.002,
+		rand:      rand.New(rand.NewSource(1)),
+	}
+
+	for _, option := range options {
+		option(g)
+	}
+
+	return g
+}
+
+// Price returns the close price of the last generated candle
+func (g *Generator) Price() float64 {
+	return g.price
+}
+
+// Candles returns all generated candles
+func (g *Generator) Candles() []model.Candle {
+	return append([]model.Candle(nil), g.candles...)
+}
+
+func (g *Generator) wick() float64 {
+	if g.noise <= 0 {
+		return 0
+	}
+	return g.rand.Float64() * g.noise
+}
+
+func (g *Generator) move(closePrice float64) {
+	open := g.price
+	candle := model.Candle{
+		Pair:      g.pair,
+		Time:      g.time,
+		UpdatedAt: g.time.Add(g.timeframe - time.Second),
+		Open:      open,
+		Close:     closePrice,
+		Low:       math.Min(open, closePrice) * (1 - g.wick()),
+		High:      math.Max(open, closePrice) * (1 + g.wick()),
+		Volume:    g.volume,
+		Complete:  true,
+	}
+
+	g.candles = append(g.candles, candle)
+	g.time = g.time.Add(g.timeframe)
+	g.price = closePrice
+}
+
+// Trend generates candles with a constant growth rate, the total price change is a fraction, eg:
+// 0.1 for a 10% uptrend and -0.1 for a 10% downtrend
+func (g *Generator) Trend(candles int, change float64) *Generator {
+	if candles <= 0 {
+		return g
+	}
+
+	rate := math.Pow(1+change, 1/float64(candles))
+	for i := 0; i < candles; i++ {
+		g.move(g.price * rate)
+	}
+	return g
+}
+
+// Range generates a sideways market oscillating around the current price, in a given width as a fraction
+// of the price, eg: 0.05 for prices between -2.5% and +2.5%. A full oscillation takes 20 candles.
+func (g *Generator) Range(candles int, width float64) *Generator {
+	center := g.price
+	for i := 1; i <= candles; i++ {
+		g.move(center * (1 + width/2*math.Sin(2*math.Pi*float64(i)/rangePeriod)))
+	}
+	return g
+}
+
+// Gap changes the price without trading, the next candle opens with a gap of a given fraction, eg: -0.05
+func (g *Generator) Gap(change float64) *Generator {
+	g.price *= 1 + change
+	return g
+}
+
+// FlashCrash generates a candle that drops a given fraction of the price, eg: 0.3 for a 30% crash,
+// followed by a recovery to the previous price in a given number of candles
+func (g *Generator) FlashCrash(drop float64, recovery int) *Generator {
+	before := g.price
+	g.move(before * (1 - drop))
+	if recovery > 0 {
+		g.Trend(recovery, before/g.price-1)
+	}
+	return g
+}
+
+// Flat generates candles without price changes, other than the wicks
+func (g *Generator) Flat(candles int) *Generator {
+	for i := 0; i < candles; i++ {
+		g.move(g.price)
+	}
+	return g
+}
@@ -0,0 +1,189 @@
+package strategytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bengalm/ninjabot/exchange"
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/strategy"
+)
+
+var ErrNoCandles = errors.New("no candles to run")
+
+// Result is the outcome of a strategy run
+type Result struct {
+	Pair    string
+	Candles []model.Candle
+	// Orders created by the strategy, in creation order, with their final status
+	Orders  []model.Order
+	Account model.Account
+}
+
+// Trades returns the filled orders
+func (r Result) Trades() []model.Order {
+	trades := make([]model.Order, 0)
+	for _, order := range r.Orders {
+		if order.Status == model.OrderStatusTypeFilled {
+			trades = append(trades, order)
+		}
+	}
+	return trades
+}
+
+// Position returns the final size of the asset position
+func (r Result) Position() float64 {
+	asset, quote := exchange.SplitAssetQuote(r.Pair)
+	balance, _ := r.Account.Balance(asset, quote)
+	return balance.Free + balance.Lock
+}
+
+type harness struct {
+	balances map[string]float64
+	maker    float64
+	taker    float64
+}
+
+type Option func(*harness)
+
+// WithBalance sets the initial balance of an asset, default: 10000 of the quote currency
+func WithBalance(asset string, amount float64) Option {
+	return func(h *harness) {
+		h.balances[asset] = amount
+	}
+}
+
+// WithFee sets the maker and taker fees of the broker, eg: 0.001 for 0.1%
+func WithFee(maker, taker float64) Option {
+	return func(h *harness) {
+		h.maker = maker
+		h.taker = taker
+	}
+}
+
+// recorder is a broker that keeps track of the orders created by the strategy
+type recorder struct {
+	service.Broker
+	ids []int64
+}
+
+func (r *recorder) record(order model.Order, err error) (model.Order, error) {
+	if err == nil {
+		r.ids = append(r.ids, order.ExchangeID)
+	}
+	return order, err
+}
+
+func (r *recorder) CreateOrderOCO(side model.SideType, pair string,
+	size, price, stop, stopLimit float64) ([]model.Order, error) {
+	orders, err := r.Broker.CreateOrderOCO(side, pair, size, price, stop, stopLimit)
+	for _, order := range orders {
+		r.ids = append(r.ids, order.ExchangeID)
+	}
+	return orders, err
+}
+
+func (r *recorder) CreateOrderLimit(side model.SideType, pair string, size, limit float64) (model.Order, error) {
+	return r.record(r.Broker.CreateOrderLimit(side, pair, size, limit))
+}
+
+func (r *recorder) CreateOrderLimitTIF(side model.SideType, pair string, size, limit float64,
+	timeInForce model.TimeInForceType) (model.Order, error) {
+	return r.record(r.Broker.(service.TimeInForceBroker).CreateOrderLimitTIF(side, pair, size, limit, timeInForce))
+}
+
+func (r *recorder) CreateOrderLimitOptions(side model.SideType, pair string, size, limit float64,
+	options model.OrderOptions) (model.Order, error) {
+	return r.record(r.Broker.(service.OrderOptionsBroker).CreateOrderLimitOptions(side, pair, size, limit, options))
+}
+
+func (r *recorder) CreateOrderMarket(side model.SideType, pair string, size float64,
+	reduceOnly bool) (model.Order, error) {
+	return r.record(r.Broker.CreateOrderMarket(side, pair, size, reduceOnly))
+}
+
+func (r *recorder) CreateOrderMarketQuote(side model.SideType, pair string, quote float64) (model.Order, error) {
+	return r.record(r.Broker.CreateOrderMarketQuote(side, pair, quote))
+}
+
+func (r *recorder) CreateOrderStop(pair string, quantity float64, limit float64) (model.Order, error) {
+	return r.record(r.Broker.CreateOrderStop(pair, quantity, limit))
+}
+
+func (r *recorder) CreateOrderTrailingStop(side model.SideType, pair string, quantity, activation,
+	callbackRate float64) (model.Order, error) {
+	return r.record(r.Broker.(service.TrailingStopBroker).CreateOrderTrailingStop(side, pair, quantity, activation,
+		callbackRate))
+}
+
+func (r *recorder) TakeProfit(side model.SideType, pair string, quantity float64,
+	limit float64) (model.Order, error) {
+	return r.record(r.Broker.TakeProfit(side, pair, quantity, limit))
+}
+
+// ModifyOrder records the new order when the broker replaces the modified one
+func (r *recorder) ModifyOrder(order model.Order, price, quantity float64) (model.Order, error) {
+	modified, err := r.Broker.ModifyOrder(order, price, quantity)
+	if err != nil || modified.ExchangeID == order.ExchangeID {
+		return modified, err
+	}
+	return r.record(modified, nil)
+}
+
+// Run executes a strategy over the given candles with an in-memory broker, without storage, feeds
+// or notifications. Orders are filled with the candle prices, as in a backtest: market orders at the
+// close of the current candle and limit and stop orders when the price is reached by the next candles.
+func Run(str strategy.Strategy, candles []model.Candle, options ...Option) (*Result, error) {
+	if len(candles) == 0 {
+		return nil, ErrNoCandles
+	}
+
+	pair := candles[0].Pair
+	_, quote := exchange.SplitAssetQuote(pair)
+
+	h := &harness{balances: map[string]float64{quote: 10000}}
+	for _, option := range options {
+		option(h)
+	}
+
+	walletOptions := []exchange.PaperWalletOption{exchange.WithPaperFee(h.maker, h.taker)}
+	for asset, amount := range h.balances {
+		walletOptions = append(walletOptions, exchange.WithPaperAsset(asset, amount))
+	}
+	wallet := exchange.NewPaperWallet(context.Background(), quote, walletOptions...)
+
+	broker := &recorder{Broker: wallet}
+	controller := strategy.NewStrategyController(pair, str, broker)
+	controller.Start()
+
+	for _, candle := range candles {
+		if candle.Pair != pair {
+			return nil, fmt.Errorf("invalid candle pair %s, expected %s", candle.Pair, pair)
+		}
+
+		wallet.OnCandle(candle)
+		controller.OnPartialCandle(candle)
+		if candle.Complete {
+			controller.OnCandle(candle)
+		}
+	}
+
+	result := &Result{Pair: pair, Candles: candles}
+	for _, id := range broker.ids {
+		order, err := wallet.Order(pair, id)
+		if err != nil {
+			return nil, err
+		}
+		result.Orders = append(result.Orders, order)
+	}
+
+	account, err := wallet.Account()
+	if err != nil {
+		return nil, err
+	}
+	result.Account = account
+
+	return result, nil
+}
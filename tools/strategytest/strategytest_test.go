@@ -0,0 +1,152 @@
+package strategytest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/strategy"
+)
+
+// breakout buys when the price closes above the previous close, protected by a stop loss
+type breakout struct {
+	stop float64
+}
+
+func (b breakout) Timeframe() string {
+	return "1h"
+}
+
+func (b breakout) WarmupPeriod() int {
+	return 2
+}
+
+func (b breakout) Indicators(_ *model.Dataframe) []strategy.ChartIndicator {
+	return nil
+}
+
+func (b breakout) OnCandle(df *model.Dataframe, broker service.Broker) {
+	asset, _, err := broker.Position(df.Pair)
+	if err != nil || asset > 0 {
+		return
+	}
+
+	orders, err := broker.OpenOrders(df.Pair)
+	if err != nil || len(orders) > 0 {
+		return
+	}
+
+	if df.Close.Last(0) > df.Close.Last(1) {
+		if _, err := broker.CreateOrderMarket(model.SideTypeBuy, df.Pair, 1, false); err != nil {
+			return
+		}
+		_, _ = broker.CreateOrderStop(df.Pair, 1, df.Close.Last(0)*(1-b.stop))
+	}
+}
+
+// testingTB records assertion failures instead of failing the test
+type testingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (t *testingTB) Helper() {}
+
+func (t *testingTB) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestGenerator(t *testing.T) {
+	t.Run("trend", func(t *testing.T) {
+		candles := NewGenerator("BTCUSDT", WithPrice(100)).Trend(10, 0.1).Candles()
+		require.Len(t, candles, 10)
+		require.InDelta(t, 110, candles[9].Close, 1e-6)
+		for i, candle := range candles {
+			require.True(t, candle.Complete)
+			require.LessOrEqual(t, candle.Low, candle.Open)
+			require.GreaterOrEqual(t, candle.High, candle.Close)
+			if i > 0 {
+				require.Greater(t, candle.Close, candles[i-1].Close)
+				require.Equal(t, candles[i-1].Time.Add(time.Hour), candle.Time)
+			}
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		candles := NewGenerator("BTCUSDT", WithNoise(0)).Range(40, 0.1).Candles()
+		require.Len(t, candles, 40)
+		for _, candle := range candles {
+			require.InDelta(t, 100, candle.Close, 5+1e-6)
+		}
+		require.InDelta(t, 100, candles[39].Close, 1e-6)
+	})
+
+	t.Run("gap", func(t *testing.T) {
+		candles := NewGenerator("BTCUSDT", WithNoise(0)).Flat(1).Gap(-0.1).Flat(1).Candles()
+		require.Equal(t, 100.0, candles[0].Close)
+		require.InDelta(t, 90, candles[1].Open, 1e-6)
+		require.InDelta(t, 90, candles[1].Low, 1e-6)
+	})
+
+	t.Run("flash crash", func(t *testing.T) {
+		candles := NewGenerator("BTCUSDT", WithNoise(0)).FlashCrash(0.3, 3).Candles()
+		require.Len(t, candles, 4)
+		require.InDelta(t, 70, candles[0].Low, 1e-6)
+		require.InDelta(t, 100, candles[3].Close, 1e-6)
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		first := NewGenerator("BTCUSDT", WithSeed(42)).Trend(5, 0.1).Candles()
+		second := NewGenerator("BTCUSDT", WithSeed(42)).Trend(5, 0.1).Candles()
+		require.Equal(t, first, second)
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("no candles", func(t *testing.T) {
+		_, err := Run(breakout{stop: 0.05}, nil)
+		require.ErrorIs(t, err, ErrNoCandles)
+	})
+
+	t.Run("stop hit on flash crash", func(t *testing.T) {
+		candles := NewGenerator("BTCUSDT", WithNoise(0)).Flat(3).Trend(1, 0.1).Flat(2).FlashCrash(0.3, 5).Candles()
+		result, err := Run(breakout{stop: 0.05}, candles)
+		require.NoError(t, err)
+
+		// buy after the breakout, sell on the stop and buy again on the recovery
+		ExpectTrades(t, result, 3)
+		ExpectSide(t, result, model.SideTypeBuy, 2)
+		ExpectStopHit(t, result, 110*0.95)
+		ExpectPosition(t, result, 1)
+	})
+
+	t.Run("no stop hit in range", func(t *testing.T) {
+		candles := NewGenerator("BTCUSDT").Flat(2).Range(20, 0.02).Candles()
+		result, err := Run(breakout{stop: 0.1}, candles)
+		require.NoError(t, err)
+
+		ExpectTrades(t, result, 1)
+		ExpectNoStopHit(t, result)
+		ExpectPosition(t, result, 1)
+	})
+
+	t.Run("failed expectations", func(t *testing.T) {
+		candles := NewGenerator("BTCUSDT").Flat(5).Candles()
+		result, err := Run(breakout{stop: 0.1}, candles, WithBalance("USDT", 500))
+		require.NoError(t, err)
+
+		tb := &testingTB{}
+		ExpectTrades(tb, result, 1)
+		ExpectStopHit(tb, result, 90)
+		ExpectPosition(tb, result, 1)
+		require.Equal(t, []string{
+			"expected 1 trades, got 0",
+			"expected stop hit at 90.000000",
+			"expected position of 1.000000, got 0.000000",
+		}, tb.errors)
+	})
+}
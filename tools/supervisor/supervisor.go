@@ -0,0 +1,182 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jpillora/backoff"
+
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+var ErrMaxRestarts = errors.New("max restarts reached")
+
+// Task is a long-lived function, eg: a candle subscription loop. Returning nil means the task is done,
+// while errors and panics are restarted by the supervisor.
+type Task func(ctx context.Context) error
+
+// Status is the current state of a supervised task
+type Status struct {
+	Name      string
+	Running   bool
+	Restarts  int
+	LastError error
+	StartedAt time.Time
+}
+
+// Supervisor monitors long-lived goroutines, restarting them on panic or failure and alerting the notifier
+type Supervisor struct {
+	mtx         sync.Mutex
+	notifier    service.Notifier
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxRestarts int
+	tasks       map[string]*Status
+}
+
+type Option func(*Supervisor)
+
+// WithNotifier sets a notifier to receive alerts of restarted tasks
+func WithNotifier(notifier service.Notifier) Option {
+	return func(supervisor *Supervisor) {
+		supervisor.notifier = notifier
+	}
+}
+
+// WithBackoff sets the minimum and maximum wait time between restarts, default: 1s and 1 minute
+func WithBackoff(min, max time.Duration) Option {
+	return func(supervisor *Supervisor) {
+		supervisor.minBackoff = min
+		supervisor.maxBackoff = max
+	}
+}
+
+// WithMaxRestarts sets the maximum number of restarts of a task, default: unlimited
+func WithMaxRestarts(restarts int) Option {
+	return func(supervisor *Supervisor) {
+		supervisor.maxRestarts = restarts
+	}
+}
+
+func New(options ...Option) *Supervisor {
+	supervisor := &Supervisor{
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+		tasks:      make(map[string]*Status),
+	}
+
+	for _, option := range options {
+		option(supervisor)
+	}
+
+	return supervisor
+}
+
+// SetNotifier sets the notifier of alerts, it may be called after tasks are started
+func (s *Supervisor) SetNotifier(notifier service.Notifier) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.notifier = notifier
+}
+
+// Go starts a supervised task in a new goroutine, until the task is done or the context is canceled
+func (s *Supervisor) Go(ctx context.Context, name string, task Task) {
+	status := &Status{Name: name}
+	s.mtx.Lock()
+	s.tasks[name] = status
+	s.mtx.Unlock()
+
+	go func() {
+		ba := &backoff.Backoff{Min: s.minBackoff, Max: s.maxBackoff}
+		for {
+			s.update(name, func(status *Status) {
+				status.Running = true
+				status.StartedAt = time.Now()
+			})
+
+			err := s.run(ctx, task)
+
+			s.update(name, func(status *Status) {
+				status.Running = false
+				status.LastError = err
+			})
+
+			if err == nil || ctx.Err() != nil {
+				return
+			}
+
+			restarts := s.restarts(name)
+			if s.maxRestarts > 0 && restarts >= s.maxRestarts {
+				s.alert(fmt.Errorf("supervisor: %s stopped: %v: %w", name, err, ErrMaxRestarts))
+				return
+			}
+
+			s.alert(fmt.Errorf("supervisor: %s stopped: %w, restarting (#%d)", name, err, restarts+1))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ba.Duration()):
+			}
+
+			s.update(name, func(status *Status) {
+				status.Restarts++
+			})
+		}
+	}()
+}
+
+func (s *Supervisor) run(ctx context.Context, task Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("supervisor: panic: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return task(ctx)
+}
+
+func (s *Supervisor) update(name string, fn func(status *Status)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	fn(s.tasks[name])
+}
+
+func (s *Supervisor) restarts(name string) int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.tasks[name].Restarts
+}
+
+func (s *Supervisor) alert(err error) {
+	log.Error(err)
+
+	s.mtx.Lock()
+	notifier := s.notifier
+	s.mtx.Unlock()
+
+	if notifier != nil {
+		notifier.OnError(err)
+	}
+}
+
+// Status returns the state of all supervised tasks, sorted by name
+func (s *Supervisor) Status() []Status {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	status := make([]Status, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		status = append(status, *task)
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+	return status
+}
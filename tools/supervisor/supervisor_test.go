@@ -0,0 +1,77 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+)
+
+type fakeNotifier struct {
+	errors int64
+}
+
+func (f *fakeNotifier) Notify(string) {}
+
+func (f *fakeNotifier) OnOrder(model.Order) {}
+
+func (f *fakeNotifier) OnError(error) {
+	atomic.AddInt64(&f.errors, 1)
+}
+
+func TestSupervisor(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("restart on panic and error", func(t *testing.T) {
+		notifier := &fakeNotifier{}
+		supervisor := New(WithNotifier(notifier), WithBackoff(time.Millisecond, time.Millisecond))
+
+		var calls int64
+		done := make(chan struct{})
+		supervisor.Go(ctx, "task", func(ctx context.Context) error {
+			switch atomic.AddInt64(&calls, 1) {
+			case 1:
+				panic("fail")
+			case 2:
+				return errors.New("fail")
+			}
+			close(done)
+			return nil
+		})
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			require.Fail(t, "task not restarted")
+		}
+
+		require.Eventually(t, func() bool {
+			status := supervisor.Status()
+			return len(status) == 1 && !status[0].Running && status[0].Restarts == 2
+		}, time.Second, time.Millisecond)
+		require.Equal(t, int64(2), atomic.LoadInt64(&notifier.errors))
+	})
+
+	t.Run("max restarts", func(t *testing.T) {
+		supervisor := New(WithMaxRestarts(1), WithBackoff(time.Millisecond, time.Millisecond))
+
+		var calls int64
+		supervisor.Go(ctx, "task", func(ctx context.Context) error {
+			atomic.AddInt64(&calls, 1)
+			return errors.New("fail")
+		})
+
+		require.Eventually(t, func() bool {
+			status := supervisor.Status()
+			return status[0].LastError != nil && !status[0].Running && status[0].Restarts == 1
+		}, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		require.Equal(t, int64(2), atomic.LoadInt64(&calls))
+	})
+}
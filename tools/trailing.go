@@ -1,19 +1,42 @@
 package tools
 
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/bengalm/ninjabot/tools/clock"
+)
+
 type TrailingStop struct {
-	current float64
-	stop    float64
-	active  bool
+	current   float64
+	stop      float64
+	active    bool
+	clock     clock.Clock
+	startedAt time.Time
 }
 
 func NewTrailingStop() *TrailingStop {
-	return &TrailingStop{}
+	return &TrailingStop{clock: clock.Wall()}
+}
+
+// SetClock sets the clock used to measure the trailing duration, eg: `bot.Clock()` in backtests
+func (t *TrailingStop) SetClock(clock clock.Clock) {
+	t.clock = clock
 }
 
 func (t *TrailingStop) Start(current, stop float64) {
 	t.stop = stop
 	t.current = current
 	t.active = true
+	t.startedAt = t.clock.Now()
+}
+
+// Elapsed returns the time since the trailing stop was started, useful for time based exits
+func (t TrailingStop) Elapsed() time.Duration {
+	if !t.active {
+		return 0
+	}
+	return clock.Since(t.clock, t.startedAt)
 }
 
 func (t *TrailingStop) Stop() {
@@ -38,3 +61,35 @@ func (t *TrailingStop) Update(current float64) bool {
 	t.current = current
 	return current <= t.stop
 }
+
+type trailingStopState struct {
+	Current   float64   `json:"current"`
+	Stop      float64   `json:"stop"`
+	Active    bool      `json:"active"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// SaveState exports the trailing levels, it can be registered in the order controller with `RegisterState`
+// to restore the levels after a restart.
+func (t *TrailingStop) SaveState() ([]byte, error) {
+	return json.Marshal(trailingStopState{
+		Current:   t.current,
+		Stop:      t.stop,
+		Active:    t.active,
+		StartedAt: t.startedAt,
+	})
+}
+
+// RestoreState loads the trailing levels exported by SaveState
+func (t *TrailingStop) RestoreState(data []byte) error {
+	var state trailingStopState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	t.current = state.Current
+	t.stop = state.Stop
+	t.active = state.Active
+	t.startedAt = state.StartedAt
+	return nil
+}
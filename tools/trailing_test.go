@@ -2,10 +2,12 @@ package tools_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/bengalm/ninjabot/tools"
+	"github.com/bengalm/ninjabot/tools/clock"
 )
 
 func TestNewTrailingStop(t *testing.T) {
@@ -51,3 +53,29 @@ func TestTrailingStop_Update(t *testing.T) {
 	require.True(t, ts.Update(stop+difference))
 	require.True(t, ts.Update(stop-difference))
 }
+
+func TestTrailingStop_Elapsed(t *testing.T) {
+	simulated := clock.NewSimulated(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+	ts := tools.NewTrailingStop()
+	ts.SetClock(simulated)
+	ts.Start(21.5, 13.0)
+
+	simulated.Advance(time.Hour)
+	require.Equal(t, time.Hour, ts.Elapsed())
+
+	ts.Stop()
+	require.Zero(t, ts.Elapsed())
+}
+
+func TestTrailingStop_State(t *testing.T) {
+	ts := tools.NewTrailingStop()
+	ts.Start(21.5, 13.0)
+
+	data, err := ts.SaveState()
+	require.NoError(t, err)
+
+	restored := tools.NewTrailingStop()
+	require.NoError(t, restored.RestoreState(data))
+	require.True(t, restored.Active())
+	require.True(t, restored.Update(13.0))
+}
@@ -0,0 +1,106 @@
+package walkforward
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Report is the result of a walk-forward analysis, by window
+type Report struct {
+	Windows []Window
+}
+
+// OutOfSampleScore is the sum of the out-of-sample scores, the expected performance of the strategy
+// re-optimized periodically
+func (r Report) OutOfSampleScore() float64 {
+	var score float64
+	for _, window := range r.Windows {
+		score += window.OutOfSampleScore
+	}
+	return score
+}
+
+// Efficiency is the walk-forward efficiency: the out-of-sample score by unit of time relative to the in-sample
+// score, averaged over the windows with a positive in-sample score. Values close to one or higher indicate
+// robust parameters, while values near zero or negative indicate overfitting.
+func (r Report) Efficiency() float64 {
+	var (
+		total float64
+		count int
+	)
+
+	for _, window := range r.Windows {
+		inSample := window.OutOfSampleStart.Sub(window.InSampleStart)
+		outOfSample := window.OutOfSampleEnd.Sub(window.OutOfSampleStart)
+		if window.InSampleScore <= 0 || inSample <= 0 || outOfSample <= 0 {
+			continue
+		}
+
+		total += (window.OutOfSampleScore / outOfSample.Hours()) / (window.InSampleScore / inSample.Hours())
+		count++
+	}
+
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
+
+// Consistency is the fraction of windows with a positive out-of-sample score
+func (r Report) Consistency() float64 {
+	if len(r.Windows) == 0 {
+		return 0
+	}
+
+	var positive int
+	for _, window := range r.Windows {
+		if window.OutOfSampleScore > 0 {
+			positive++
+		}
+	}
+	return float64(positive) / float64(len(r.Windows))
+}
+
+// Stability is the fraction of windows that keep the parameters of the previous window, parameters that
+// change on every window are a sign of optimizing noise
+func (r Report) Stability() float64 {
+	if len(r.Windows) < 2 {
+		return 1
+	}
+
+	var kept int
+	for i := 1; i < len(r.Windows); i++ {
+		if r.Windows[i].Params.String() == r.Windows[i-1].Params.String() {
+			kept++
+		}
+	}
+	return float64(kept) / float64(len(r.Windows)-1)
+}
+
+func (r Report) String() string {
+	buffer := bytes.NewBuffer(nil)
+	table := tablewriter.NewWriter(buffer)
+	table.SetHeader([]string{"Period", "Params", "In-sample", "Out-of-sample", "Trades"})
+	for _, window := range r.Windows {
+		table.Append([]string{
+			fmt.Sprintf("%s - %s", window.OutOfSampleStart.Format("2006-01-02"),
+				window.OutOfSampleEnd.Format("2006-01-02")),
+			window.Params.String(),
+			strconv.FormatFloat(window.InSampleScore, 'f', 2, 64),
+			strconv.FormatFloat(window.OutOfSampleScore, 'f', 2, 64),
+			strconv.Itoa(window.OutOfSampleTrades),
+		})
+	}
+	table.SetFooter([]string{
+		fmt.Sprintf("%d windows", len(r.Windows)),
+		fmt.Sprintf("stability %.0f%%", r.Stability()*100),
+		fmt.Sprintf("efficiency %.2f", r.Efficiency()),
+		strconv.FormatFloat(r.OutOfSampleScore(), 'f', 2, 64),
+		fmt.Sprintf("%.0f%% positive", r.Consistency()*100),
+	})
+	table.Render()
+	return buffer.String()
+}
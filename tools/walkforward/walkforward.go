@@ -0,0 +1,146 @@
+// Package walkforward optimizes the parameters of a strategy with a walk-forward analysis: the history is
+// split in rolling windows, the parameters are optimized in the in-sample period of each window and evaluated
+// in the following out-of-sample period, which was not used by the optimization.
+package walkforward
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/optimizer"
+	"github.com/bengalm/ninjabot/tools/strategytest"
+)
+
+var (
+	ErrInvalidWindow = errors.New("invalid walk-forward window")
+	ErrNoWindows     = errors.New("not enough candles for a walk-forward window")
+)
+
+// Window is a period of the walk-forward analysis, with the best parameters of the in-sample period and
+// their score in the out-of-sample period
+type Window struct {
+	InSampleStart     time.Time
+	OutOfSampleStart  time.Time
+	OutOfSampleEnd    time.Time
+	Params            optimizer.Params
+	InSampleScore     float64
+	OutOfSampleScore  float64
+	OutOfSampleTrades int
+}
+
+// WalkForward is the walk-forward optimization of a strategy, see New
+type WalkForward struct {
+	factory     optimizer.Factory
+	ranges      []optimizer.Range
+	inSample    time.Duration
+	outOfSample time.Duration
+	anchored    bool
+	objective   optimizer.Metric
+	options     []strategytest.Option
+}
+
+type Option func(*WalkForward)
+
+// WithWindows sets the length of the in-sample and out-of-sample periods of each window,
+// default: 90 days and 30 days. Windows move forward by the out-of-sample period.
+func WithWindows(inSample, outOfSample time.Duration) Option {
+	return func(w *WalkForward) {
+		w.inSample = inSample
+		w.outOfSample = outOfSample
+	}
+}
+
+// WithAnchored starts all in-sample periods at the first candle, growing with each window
+func WithAnchored() Option {
+	return func(w *WalkForward) {
+		w.anchored = true
+	}
+}
+
+// WithObjective sets the metric optimized in the in-sample periods, default: optimizer.Profit
+func WithObjective(objective optimizer.Metric) Option {
+	return func(w *WalkForward) {
+		w.objective = objective
+	}
+}
+
+// WithRunOptions sets the options of the strategy runs, eg: strategytest.WithFee(0.001, 0.001)
+func WithRunOptions(options ...strategytest.Option) Option {
+	return func(w *WalkForward) {
+		w.options = options
+	}
+}
+
+// New creates a walk-forward optimization of the strategies of a factory, exploring all the combinations of
+// the values of the ranges
+func New(factory optimizer.Factory, ranges []optimizer.Range, options ...Option) *WalkForward {
+	w := &WalkForward{
+		factory:     factory,
+		ranges:      ranges,
+		inSample:    90 * 24 * time.Hour,
+		outOfSample: 30 * 24 * time.Hour,
+		objective:   optimizer.Profit,
+	}
+	for _, option := range options {
+		option(w)
+	}
+	return w
+}
+
+// search returns the grid search of the parameters in a period
+func (w *WalkForward) search(start, end time.Time) *optimizer.Optimizer {
+	return optimizer.New(w.factory, w.ranges,
+		optimizer.WithMetric(w.objective),
+		optimizer.WithPeriod(start, end),
+		optimizer.WithRunOptions(w.options...),
+	)
+}
+
+// Run executes the walk-forward analysis over the candles of a pair, sorted by time
+func (w *WalkForward) Run(candles []model.Candle) (*Report, error) {
+	if w.inSample <= 0 || w.outOfSample <= 0 {
+		return nil, fmt.Errorf("%w: in-sample %s, out-of-sample %s", ErrInvalidWindow, w.inSample, w.outOfSample)
+	}
+	if len(candles) == 0 {
+		return nil, ErrNoWindows
+	}
+
+	first, last := candles[0].Time, candles[len(candles)-1].Time
+	report := &Report{}
+	for start := first; !start.Add(w.inSample).After(last); start = start.Add(w.outOfSample) {
+		inSampleStart := start
+		if w.anchored {
+			inSampleStart = first
+		}
+		outOfSampleStart := start.Add(w.inSample)
+		outOfSampleEnd := outOfSampleStart.Add(w.outOfSample)
+
+		results, err := w.search(inSampleStart, outOfSampleStart).Run(candles)
+		if err != nil {
+			return nil, err
+		}
+		best, _ := results.Best()
+
+		result, err := w.search(outOfSampleStart, outOfSampleEnd).Backtest(best.Params, candles)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Windows = append(report.Windows, Window{
+			InSampleStart:     inSampleStart,
+			OutOfSampleStart:  outOfSampleStart,
+			OutOfSampleEnd:    outOfSampleEnd,
+			Params:            best.Params,
+			InSampleScore:     best.Score,
+			OutOfSampleScore:  w.objective.Score(result),
+			OutOfSampleTrades: len(result.Trades()),
+		})
+	}
+
+	if len(report.Windows) == 0 {
+		return nil, ErrNoWindows
+	}
+	return report, nil
+}
@@ -0,0 +1,116 @@
+package walkforward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/strategy"
+	"github.com/bengalm/ninjabot/tools/optimizer"
+	"github.com/bengalm/ninjabot/tools/strategytest"
+)
+
+// momentum holds a position while the close is above the close of a number of candles before
+type momentum struct {
+	lookback int
+}
+
+func (m momentum) Timeframe() string {
+	return "1h"
+}
+
+func (m momentum) WarmupPeriod() int {
+	return m.lookback + 1
+}
+
+func (m momentum) Indicators(_ *model.Dataframe) []strategy.ChartIndicator {
+	return nil
+}
+
+func (m momentum) OnCandle(df *model.Dataframe, broker service.Broker) {
+	asset, _, err := broker.Position(df.Pair)
+	if err != nil {
+		return
+	}
+
+	rising := df.Close.Last(0) > df.Close.Last(m.lookback)
+	if rising && asset == 0 {
+		_, _ = broker.CreateOrderMarket(model.SideTypeBuy, df.Pair, 1, false)
+	} else if !rising && asset > 0 {
+		_, _ = broker.CreateOrderMarket(model.SideTypeSell, df.Pair, asset, false)
+	}
+}
+
+func TestWalkForward_Run(t *testing.T) {
+	candles := strategytest.NewGenerator("BTCUSDT", strategytest.WithSeed(1)).
+		Trend(100, 0.5).Range(100, 0.05).Trend(100, -0.3).Trend(100, 0.4).Candles()
+
+	factory := func(params optimizer.Params) strategy.Strategy {
+		return momentum{lookback: int(params["lookback"])}
+	}
+	ranges := []optimizer.Range{optimizer.Steps("lookback", 2, 10, 4)}
+
+	t.Run("rolling", func(t *testing.T) {
+		report, err := New(factory, ranges, WithWindows(100*time.Hour, 50*time.Hour)).Run(candles)
+		require.NoError(t, err)
+		require.Len(t, report.Windows, 6)
+
+		for i, window := range report.Windows {
+			require.Equal(t, window.InSampleStart.Add(100*time.Hour), window.OutOfSampleStart)
+			require.Equal(t, window.OutOfSampleStart.Add(50*time.Hour), window.OutOfSampleEnd)
+			require.Contains(t, []float64{2, 6, 10}, window.Params["lookback"])
+			if i > 0 {
+				require.Equal(t, report.Windows[i-1].OutOfSampleEnd, window.OutOfSampleStart)
+			}
+		}
+
+		// the first window is optimized in a bull market
+		require.Greater(t, report.Windows[0].InSampleScore, 0.0)
+		require.Contains(t, report.String(), "6 WINDOWS")
+	})
+
+	t.Run("anchored", func(t *testing.T) {
+		report, err := New(factory, ranges, WithWindows(100*time.Hour, 100*time.Hour), WithAnchored()).Run(candles)
+		require.NoError(t, err)
+		require.Len(t, report.Windows, 3)
+		for _, window := range report.Windows {
+			require.Equal(t, candles[0].Time, window.InSampleStart)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := New(factory, ranges, WithWindows(0, time.Hour)).Run(candles)
+		require.ErrorIs(t, err, ErrInvalidWindow)
+
+		_, err = New(factory, ranges, WithWindows(1000*time.Hour, time.Hour)).Run(candles)
+		require.ErrorIs(t, err, ErrNoWindows)
+	})
+}
+
+func TestReport(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := func(days int, inSample, outOfSample, lookback float64) Window {
+		inSampleStart := start.AddDate(0, 0, days)
+		return Window{
+			InSampleStart:    inSampleStart,
+			OutOfSampleStart: inSampleStart.AddDate(0, 0, 20),
+			OutOfSampleEnd:   inSampleStart.AddDate(0, 0, 30),
+			Params:           optimizer.Params{"lookback": lookback},
+			InSampleScore:    inSample,
+			OutOfSampleScore: outOfSample,
+		}
+	}
+
+	report := Report{Windows: []Window{
+		window(0, 200, 50, 2),
+		window(10, 100, -10, 2),
+		window(20, -50, 20, 6),
+	}}
+	require.Equal(t, 60.0, report.OutOfSampleScore())
+	require.InDelta(t, (0.5-0.2)/2, report.Efficiency(), 1e-9)
+	require.InDelta(t, 2.0/3, report.Consistency(), 1e-9)
+	require.InDelta(t, 0.5, report.Stability(), 1e-9)
+}
@@ -0,0 +1,218 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bengalm/ninjabot/service"
+	"github.com/bengalm/ninjabot/tools/clock"
+	"github.com/bengalm/ninjabot/tools/log"
+)
+
+var ErrStaleStream = errors.New("stale stream")
+
+// stream is a monitored stream, with the time of its last message
+type stream struct {
+	timeout   time.Duration
+	reconnect func()
+	last      time.Time
+	// since is the start of the current timeout, the last message or reconnection
+	since   time.Time
+	stale   int
+	alerted bool
+}
+
+// Status is the current state of a monitored stream
+type Status struct {
+	Name        string
+	LastMessage time.Time
+	// Reconnects is the number of reconnections since the last message
+	Reconnects int
+}
+
+// Watchdog monitors live streams, eg: candle feeds and user data streams. Streams without messages within
+// their timeout are reconnected, and the notifier is alerted when a stream stays stale after reconnecting.
+type Watchdog struct {
+	mtx      sync.Mutex
+	notifier service.Notifier
+	clock    clock.Clock
+	interval time.Duration
+	retries  int
+	streams  map[string]*stream
+}
+
+type Option func(*Watchdog)
+
+// WithNotifier sets a notifier to receive alerts of stale streams
+func WithNotifier(notifier service.Notifier) Option {
+	return func(watchdog *Watchdog) {
+		watchdog.notifier = notifier
+	}
+}
+
+// WithInterval sets the interval between checks of the streams, default: 5s
+func WithInterval(interval time.Duration) Option {
+	return func(watchdog *Watchdog) {
+		watchdog.interval = interval
+	}
+}
+
+// WithRetries sets the reconnections of a stale stream before alerting the notifier, default: 1
+func WithRetries(retries int) Option {
+	return func(watchdog *Watchdog) {
+		watchdog.retries = retries
+	}
+}
+
+// WithClock sets the clock of the watchdog, default: wall clock
+func WithClock(c clock.Clock) Option {
+	return func(watchdog *Watchdog) {
+		watchdog.clock = c
+	}
+}
+
+func New(options ...Option) *Watchdog {
+	watchdog := &Watchdog{
+		clock:    clock.Wall(),
+		interval: 5 * time.Second,
+		retries:  1,
+		streams:  make(map[string]*stream),
+	}
+
+	for _, option := range options {
+		option(watchdog)
+	}
+
+	return watchdog
+}
+
+// SetNotifier sets the notifier of alerts, it may be called after the watchdog is started
+func (w *Watchdog) SetNotifier(notifier service.Notifier) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	w.notifier = notifier
+}
+
+// Watch monitors a stream, reconnect is called when no message is received within the timeout. Watching
+// a stream again, eg: after a reconnection, replaces its reconnect function and keeps its stale state.
+func (w *Watchdog) Watch(name string, timeout time.Duration, reconnect func()) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if current, ok := w.streams[name]; ok {
+		current.timeout = timeout
+		current.reconnect = reconnect
+		return
+	}
+	now := w.clock.Now()
+	w.streams[name] = &stream{timeout: timeout, reconnect: reconnect, last: now, since: now}
+}
+
+// Remove stops monitoring a stream
+func (w *Watchdog) Remove(name string) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	delete(w.streams, name)
+}
+
+// Beat registers a message of a stream, notifying when a stale stream recovers
+func (w *Watchdog) Beat(name string) {
+	w.mtx.Lock()
+	current, ok := w.streams[name]
+	if !ok {
+		w.mtx.Unlock()
+		return
+	}
+
+	current.last = w.clock.Now()
+	current.since = current.last
+	current.stale = 0
+	recovered := current.alerted
+	current.alerted = false
+	notifier := w.notifier
+	w.mtx.Unlock()
+
+	if recovered {
+		log.Infof("[WATCHDOG] %s recovered", name)
+		if notifier != nil {
+			notifier.Notify(fmt.Sprintf("[WATCHDOG] %s recovered", name))
+		}
+	}
+}
+
+// Start checks the streams periodically, until the context is done
+func (w *Watchdog) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.check()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// check reconnects the streams without messages within their timeout, the timeout is restarted after
+// each reconnection
+func (w *Watchdog) check() {
+	now := w.clock.Now()
+	reconnects := make([]func(), 0)
+	alerts := make([]error, 0)
+
+	w.mtx.Lock()
+	for name, current := range w.streams {
+		if now.Sub(current.since) < current.timeout {
+			continue
+		}
+
+		current.stale++
+		current.since = now
+		log.Warnf("[WATCHDOG] %s without messages since %s, reconnecting (#%d)", name, current.last, current.stale)
+		if current.reconnect != nil {
+			reconnects = append(reconnects, current.reconnect)
+		}
+
+		if current.stale > w.retries && !current.alerted {
+			current.alerted = true
+			alerts = append(alerts, fmt.Errorf("%w: %s without messages after %d reconnections",
+				ErrStaleStream, name, current.stale-1))
+		}
+	}
+	notifier := w.notifier
+	w.mtx.Unlock()
+
+	for _, reconnect := range reconnects {
+		reconnect()
+	}
+
+	for _, err := range alerts {
+		log.Error(err)
+		if notifier != nil {
+			notifier.OnError(err)
+		}
+	}
+}
+
+// Status returns the state of all monitored streams, sorted by name
+func (w *Watchdog) Status() []Status {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	status := make([]Status, 0, len(w.streams))
+	for name, current := range w.streams {
+		status = append(status, Status{Name: name, LastMessage: current.last, Reconnects: current.stale})
+	}
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Name < status[j].Name
+	})
+	return status
+}
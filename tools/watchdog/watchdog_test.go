@@ -0,0 +1,77 @@
+package watchdog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/bengalm/ninjabot/model"
+	"github.com/bengalm/ninjabot/tools/clock"
+)
+
+type fakeNotifier struct {
+	messages []string
+	errors   []error
+}
+
+func (f *fakeNotifier) Notify(message string) {
+	f.messages = append(f.messages, message)
+}
+
+func (f *fakeNotifier) OnOrder(model.Order) {}
+
+func (f *fakeNotifier) OnError(err error) {
+	f.errors = append(f.errors, err)
+}
+
+func TestWatchdog(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	simulated := clock.NewSimulated(start)
+	notifier := &fakeNotifier{}
+	watchdog := New(WithClock(simulated), WithNotifier(notifier), WithRetries(1))
+
+	reconnects := 0
+	watchdog.Watch("feed/BTCUSDT--1m", 3*time.Minute, func() {
+		reconnects++
+	})
+
+	simulated.Advance(2 * time.Minute)
+	watchdog.check()
+	require.Zero(t, reconnects)
+
+	// messages restart the timeout
+	watchdog.Beat("feed/BTCUSDT--1m")
+	simulated.Advance(2 * time.Minute)
+	watchdog.check()
+	require.Zero(t, reconnects)
+
+	simulated.Advance(time.Minute)
+	watchdog.check()
+	require.Equal(t, 1, reconnects)
+	require.Empty(t, notifier.errors)
+
+	// the timeout is restarted after a reconnection, and the notifier is alerted once
+	watchdog.check()
+	require.Equal(t, 1, reconnects)
+	for i := 0; i < 2; i++ {
+		simulated.Advance(3 * time.Minute)
+		watchdog.check()
+	}
+	require.Equal(t, 3, reconnects)
+	require.Len(t, notifier.errors, 1)
+	require.ErrorIs(t, notifier.errors[0], ErrStaleStream)
+
+	status := watchdog.Status()
+	require.Len(t, status, 1)
+	require.Equal(t, 3, status[0].Reconnects)
+	require.Equal(t, start.Add(2*time.Minute), status[0].LastMessage)
+
+	watchdog.Beat("feed/BTCUSDT--1m")
+	require.Equal(t, []string{"[WATCHDOG] feed/BTCUSDT--1m recovered"}, notifier.messages)
+
+	watchdog.Remove("feed/BTCUSDT--1m")
+	simulated.Advance(time.Hour)
+	watchdog.check()
+	require.Equal(t, 3, reconnects)
+}